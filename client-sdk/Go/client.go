@@ -1,11 +1,15 @@
-package main
+package oasisdb
 
 import (
 	"bytes"
+	"encoding/binary"
 	"encoding/json"
 	"fmt"
 	"io"
+	"math"
 	"net/http"
+	"net/url"
+	"strconv"
 	"time"
 )
 
@@ -28,6 +32,7 @@ const TIMEOUT = 20000
 type OasisDBClient struct {
 	BaseURL string
 	Client  *http.Client
+	Tenant  string // sent as X-Tenant, collections are scoped to it when set
 }
 
 // OasisDBError represents an error returned by the OasisDB server.
@@ -51,7 +56,6 @@ func NewOasisDBClient(baseURL string) *OasisDBClient {
 // ----------------- Low-level request helper -----------------
 // request sends an HTTP request and returns the response body.
 func (c *OasisDBClient) request(method, path string, body any) ([]byte, error) {
-	url := c.BaseURL + path
 	var reqBody io.Reader
 	if body != nil {
 		b, err := json.Marshal(body)
@@ -60,11 +64,40 @@ func (c *OasisDBClient) request(method, path string, body any) ([]byte, error) {
 		}
 		reqBody = bytes.NewReader(b)
 	}
-	req, err := http.NewRequest(method, url, reqBody)
+	return c.send(method, path, "application/json", reqBody)
+}
+
+// BinaryContentType is the content type of binary search and batch upsert
+// bodies: the little-endian uint32 length of a JSON header holding the request
+// without vectors, the header, then the vectors as little-endian float32s.
+const BinaryContentType = "application/octet-stream"
+
+// requestBinary sends a POST request with a binary body and returns the
+// response body.
+func (c *OasisDBClient) requestBinary(path string, header any, vectors ...[]float32) ([]byte, error) {
+	b, err := json.Marshal(header)
 	if err != nil {
 		return nil, err
 	}
-	req.Header.Set("Content-Type", "application/json")
+	body := binary.LittleEndian.AppendUint32(nil, uint32(len(b)))
+	body = append(body, b...)
+	for _, vector := range vectors {
+		for _, v := range vector {
+			body = binary.LittleEndian.AppendUint32(body, math.Float32bits(v))
+		}
+	}
+	return c.send(http.MethodPost, path, BinaryContentType, bytes.NewReader(body))
+}
+
+func (c *OasisDBClient) send(method, path, contentType string, reqBody io.Reader) ([]byte, error) {
+	req, err := http.NewRequest(method, c.BaseURL+path, reqBody)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", contentType)
+	if c.Tenant != "" {
+		req.Header.Set("X-Tenant", c.Tenant)
+	}
 	resp, err := c.Client.Do(req)
 	if err != nil {
 		return nil, err
@@ -109,6 +142,23 @@ func (c *OasisDBClient) CreateCollection(name string, dimension int, indexType s
 	return result, err
 }
 
+// CreateCollectionWithOptions creates a new collection from the fields of a
+// create request other than its name, e.g. "dimension", "index_type",
+// "store_vectors" or "schema".
+func (c *OasisDBClient) CreateCollectionWithOptions(name string, options map[string]any) (map[string]any, error) {
+	payload := map[string]any{"name": name}
+	for k, v := range options {
+		payload[k] = v
+	}
+	resp, err := c.request("POST", "/v1/collections", payload)
+	if err != nil {
+		return nil, err
+	}
+	var result map[string]any
+	err = json.Unmarshal(resp, &result)
+	return result, err
+}
+
 // GetCollection retrieves collection information.
 func (c *OasisDBClient) GetCollection(name string) (map[string]any, error) {
 	resp, err := c.request("GET", "/v1/collections/"+name, nil)
@@ -120,15 +170,17 @@ func (c *OasisDBClient) GetCollection(name string) (map[string]any, error) {
 	return result, err
 }
 
-// ListCollections lists all collections.
-func (c *OasisDBClient) ListCollections() ([]map[string]any, error) {
+// ListCollections lists the names of all collections.
+func (c *OasisDBClient) ListCollections() ([]string, error) {
 	resp, err := c.request("GET", "/v1/collections", nil)
 	if err != nil {
 		return nil, err
 	}
-	var result []map[string]any
+	var result struct {
+		Collections []string `json:"collections"`
+	}
 	err = json.Unmarshal(resp, &result)
-	return result, err
+	return result.Collections, err
 }
 
 // DeleteCollection deletes a collection.
@@ -137,6 +189,83 @@ func (c *OasisDBClient) DeleteCollection(name string) error {
 	return err
 }
 
+// RestoreCollection brings back a deleted collection before it is purged.
+func (c *OasisDBClient) RestoreCollection(name string) (map[string]any, error) {
+	resp, err := c.request("POST", "/v1/collections/"+name+"/restore", nil)
+	if err != nil {
+		return nil, err
+	}
+	var result map[string]any
+	err = json.Unmarshal(resp, &result)
+	return result, err
+}
+
+// CloneCollection copies the documents of a collection into target,
+// indexType and indexParams replace the index settings of the source when
+// not empty.
+func (c *OasisDBClient) CloneCollection(source, target, indexType string, indexParams map[string]any) (map[string]any, error) {
+	payload := map[string]any{"target": target}
+	if indexType != "" {
+		payload["index_type"] = indexType
+	}
+	if indexParams != nil {
+		payload["index_params"] = indexParams
+	}
+	resp, err := c.request("POST", fmt.Sprintf("/v1/collections/%s/clone", source), payload)
+	if err != nil {
+		return nil, err
+	}
+	var result map[string]any
+	err = json.Unmarshal(resp, &result)
+	return result, err
+}
+
+// Reindex starts rebuilding the index of a collection in the background,
+// indexType and parameters replace its index settings when not empty.
+func (c *OasisDBClient) Reindex(collection, indexType string, parameters map[string]any) (map[string]any, error) {
+	payload := map[string]any{}
+	if indexType != "" {
+		payload["index_type"] = indexType
+	}
+	if parameters != nil {
+		payload["parameters"] = parameters
+	}
+	resp, err := c.request("POST", fmt.Sprintf("/v1/collections/%s/reindex", collection), payload)
+	if err != nil {
+		return nil, err
+	}
+	var result map[string]any
+	err = json.Unmarshal(resp, &result)
+	return result, err
+}
+
+// ReindexStatus returns the status of the last reindex of a collection.
+func (c *OasisDBClient) ReindexStatus(collection string) (map[string]any, error) {
+	resp, err := c.request("GET", fmt.Sprintf("/v1/collections/%s/reindex", collection), nil)
+	if err != nil {
+		return nil, err
+	}
+	var result map[string]any
+	err = json.Unmarshal(resp, &result)
+	return result, err
+}
+
+// ListJobs returns the running index builds and the last finished ones with
+// their progress, an empty collection returns the builds of every collection.
+func (c *OasisDBClient) ListJobs(collection string) (map[string]any, error) {
+	path := "/v1/jobs"
+	if collection != "" {
+		path += "?" + url.Values{"collection": {collection}}.Encode()
+	}
+	resp, err := c.request("GET", path, nil)
+	if err != nil {
+		return nil, err
+	}
+	var result map[string]any
+	err = json.Unmarshal(resp, &result)
+	return result, err
+}
+
 // UpsertDocument inserts or updates a document.
 func (c *OasisDBClient) UpsertDocument(collection, docID string, vector []float32, parameters map[string]any) (map[string]any, error) {
 	payload := map[string]any{
@@ -160,6 +289,53 @@ func (c *OasisDBClient) BatchUpsertDocuments(collection string, documents []map[
 	return err
 }
 
+// BatchUpsertDocumentsBinary is BatchUpsertDocuments sending the vectors in
+// the binary layout, which is smaller and faster to decode than JSON. The
+// "vector" of each document must be a []float32.
+func (c *OasisDBClient) BatchUpsertDocumentsBinary(collection string, documents []map[string]any) error {
+	headers := make([]map[string]any, len(documents))
+	vectors := make([][]float32, len(documents))
+	for i, doc := range documents {
+		vector, ok := doc["vector"].([]float32)
+		if !ok {
+			return fmt.Errorf("document %d: vector must be a []float32", i)
+		}
+		headers[i] = make(map[string]any, len(doc))
+		for k, v := range doc {
+			if k != "vector" {
+				headers[i][k] = v
+			}
+		}
+		headers[i]["dimension"] = len(vector)
+		vectors[i] = vector
+	}
+	_, err := c.requestBinary(fmt.Sprintf("/v1/collections/%s/documents/batchupsert", collection), map[string]any{"documents": headers}, vectors...)
+	return err
+}
+
+// IngestDocument splits a long text into chunk documents on the server, which
+// embeds and upserts them. startID gives the chunks numeric IDs, as HNSW
+// collections require, nil names them "<docID>#<n>".
+func (c *OasisDBClient) IngestDocument(collection, docID, text string, parameters, chunking map[string]any, startID *int) (map[string]any, error) {
+	payload := map[string]any{"id": docID, "text": text}
+	if parameters != nil {
+		payload["parameters"] = parameters
+	}
+	if chunking != nil {
+		payload["chunking"] = chunking
+	}
+	if startID != nil {
+		payload["start_id"] = *startID
+	}
+	resp, err := c.request("POST", fmt.Sprintf("/v1/collections/%s/documents/ingest", collection), payload)
+	if err != nil {
+		return nil, err
+	}
+	var result map[string]any
+	err = json.Unmarshal(resp, &result)
+	return result, err
+}
+
 // GetDocument retrieves a document.
 func (c *OasisDBClient) GetDocument(collection, docID string) (map[string]any, error) {
 	resp, err := c.request("GET", fmt.Sprintf("/v1/collections/%s/documents/%s", collection, docID), nil)
@@ -184,6 +360,18 @@ func (c *OasisDBClient) BuildIndex(collection string, documents []map[string]any
 	return err
 }
 
+// RebuildIndex recreates the index of a collection created with
+// store_vectors from the vectors kept in scalar storage.
+func (c *OasisDBClient) RebuildIndex(collection string) (map[string]any, error) {
+	resp, err := c.request("POST", fmt.Sprintf("/v1/collections/%s/rebuild", collection), nil)
+	if err != nil {
+		return nil, err
+	}
+	var result map[string]any
+	err = json.Unmarshal(resp, &result)
+	return result, err
+}
+
 // SetParams sets collection parameters.
 func (c *OasisDBClient) SetParams(collection string, parameters map[string]any) error {
 	payload := map[string]any{"parameters": parameters}
@@ -203,6 +391,31 @@ func (c *OasisDBClient) SearchVectors(collection string, vector []float32, limit
 	return result, err
 }
 
+// SearchVectorsBinary is SearchVectors sending the query vector in the binary
+// layout.
+func (c *OasisDBClient) SearchVectorsBinary(collection string, vector []float32, limit int) (map[string]any, error) {
+	resp, err := c.requestBinary(fmt.Sprintf("/v1/collections/%s/vectors/search", collection), map[string]any{"limit": limit}, vector)
+	if err != nil {
+		return nil, err
+	}
+	var result map[string]any
+	err = json.Unmarshal(resp, &result)
+	return result, err
+}
+
+// SearchVectorsWithinDistance returns the vectors at most maxDistance from the
+// query, limit 0 returns all of them up to the server's cap.
+func (c *OasisDBClient) SearchVectorsWithinDistance(collection string, vector []float32, maxDistance float32, limit int) (map[string]any, error) {
+	payload := map[string]any{"vector": vector, "limit": limit, "max_distance": maxDistance}
+	resp, err := c.request("POST", fmt.Sprintf("/v1/collections/%s/vectors/search", collection), payload)
+	if err != nil {
+		return nil, err
+	}
+	var result map[string]any
+	err = json.Unmarshal(resp, &result)
+	return result, err
+}
+
 // SearchDocuments performs a document search.
 func (c *OasisDBClient) SearchDocuments(collection string, vector []float32, limit int, filter map[string]any) (map[string]any, error) {
 	payload := map[string]any{"vector": vector, "limit": limit}
@@ -217,3 +430,153 @@ func (c *OasisDBClient) SearchDocuments(collection string, vector []float32, lim
 	err = json.Unmarshal(resp, &result)
 	return result, err
 }
+
+// SearchDocumentsWithinDistance performs a document search returning only
+// documents at most maxDistance from the query, limit 0 returns all of them
+// up to the server's cap.
+func (c *OasisDBClient) SearchDocumentsWithinDistance(collection string, vector []float32, maxDistance float32, limit int, filter map[string]any) (map[string]any, error) {
+	payload := map[string]any{"vector": vector, "limit": limit, "max_distance": maxDistance}
+	if filter != nil {
+		payload["filter"] = filter
+	}
+	resp, err := c.request("POST", fmt.Sprintf("/v1/collections/%s/documents/search", collection), payload)
+	if err != nil {
+		return nil, err
+	}
+	var result map[string]any
+	err = json.Unmarshal(resp, &result)
+	return result, err
+}
+
+// SearchDocumentsByText performs a document search, the server embeds the query text.
+func (c *OasisDBClient) SearchDocumentsByText(collection, queryText string, limit int, filter map[string]any) (map[string]any, error) {
+	payload := map[string]any{"query_text": queryText, "limit": limit}
+	if filter != nil {
+		payload["filter"] = filter
+	}
+	resp, err := c.request("POST", fmt.Sprintf("/v1/collections/%s/documents/search", collection), payload)
+	if err != nil {
+		return nil, err
+	}
+	var result map[string]any
+	err = json.Unmarshal(resp, &result)
+	return result, err
+}
+
+// SearchDocumentsWithRerank performs a document search and reranks the top-N
+// candidates, e.g. rerank = {"type": "mmr", "lambda": 0.5}.
+func (c *OasisDBClient) SearchDocumentsWithRerank(collection string, vector []float32, limit int, filter, rerank map[string]any) (map[string]any, error) {
+	payload := map[string]any{"vector": vector, "limit": limit, "rerank": rerank}
+	if filter != nil {
+		payload["filter"] = filter
+	}
+	resp, err := c.request("POST", fmt.Sprintf("/v1/collections/%s/documents/search", collection), payload)
+	if err != nil {
+		return nil, err
+	}
+	var result map[string]any
+	err = json.Unmarshal(resp, &result)
+	return result, err
+}
+
+// ArchiveDocuments moves documents unread for unreadDays out of the vector
+// index, 0 uses the server's archive.after_days.
+func (c *OasisDBClient) ArchiveDocuments(collection string, unreadDays int) (map[string]any, error) {
+	var payload any
+	if unreadDays > 0 {
+		payload = map[string]any{"unread_days": unreadDays}
+	}
+	resp, err := c.request("POST", fmt.Sprintf("/v1/collections/%s/archive", collection), payload)
+	if err != nil {
+		return nil, err
+	}
+	var result map[string]any
+	err = json.Unmarshal(resp, &result)
+	return result, err
+}
+
+// RestoreDocument moves an archived document back into the vector index.
+func (c *OasisDBClient) RestoreDocument(collection, docID string) error {
+	_, err := c.request("POST", fmt.Sprintf("/v1/collections/%s/documents/%s/restore", collection, docID), nil)
+	return err
+}
+
+// ScrollDocuments fetches a page of all documents matching filter in ID
+// order, pass the returned "cursor" to get the next page, it is empty after
+// the last one. The filter is only used when starting a scroll.
+func (c *OasisDBClient) ScrollDocuments(collection string, filter map[string]any, size int, cursor string) (map[string]any, error) {
+	payload := map[string]any{}
+	if filter != nil {
+		payload["filter"] = filter
+	}
+	if size > 0 {
+		payload["size"] = size
+	}
+	if cursor != "" {
+		payload["cursor"] = cursor
+	}
+	resp, err := c.request("POST", fmt.Sprintf("/v1/collections/%s/scroll", collection), payload)
+	if err != nil {
+		return nil, err
+	}
+	var result map[string]any
+	err = json.Unmarshal(resp, &result)
+	return result, err
+}
+
+// ScrollDocumentsSnapshot is ScrollDocuments reading every page as of the
+// first one, whose response holds the "seq" of the snapshot read. Writes
+// made during the scroll are not returned.
+func (c *OasisDBClient) ScrollDocumentsSnapshot(collection string, size int, cursor string) (map[string]any, error) {
+	payload := map[string]any{}
+	if size > 0 {
+		payload["size"] = size
+	}
+	if cursor != "" {
+		payload["cursor"] = cursor
+	} else {
+		payload["snapshot"] = true
+	}
+	resp, err := c.request("POST", fmt.Sprintf("/v1/collections/%s/scroll", collection), payload)
+	if err != nil {
+		return nil, err
+	}
+	var result map[string]any
+	err = json.Unmarshal(resp, &result)
+	return result, err
+}
+
+// ListDocumentIDs returns a page of the document IDs of a collection without
+// the documents, pass the "cursor" of the response to get the next page, it
+// is empty after the last one. A limit of 0 uses the server default.
+func (c *OasisDBClient) ListDocumentIDs(collection string, limit int, cursor string) (map[string]any, error) {
+	query := url.Values{}
+	if limit > 0 {
+		query.Set("limit", strconv.Itoa(limit))
+	}
+	if cursor != "" {
+		query.Set("cursor", cursor)
+	}
+	path := fmt.Sprintf("/v1/collections/%s/ids", collection)
+	if len(query) > 0 {
+		path += "?" + query.Encode()
+	}
+	resp, err := c.request("GET", path, nil)
+	if err != nil {
+		return nil, err
+	}
+	var result map[string]any
+	err = json.Unmarshal(resp, &result)
+	return result, err
+}
+
+// ListClusters lists the approximate clusters of a collection's index.
+func (c *OasisDBClient) ListClusters(collection string, samples int) (map[string]any, error) {
+	resp, err := c.request("GET", fmt.Sprintf("/v1/collections/%s/clusters?samples=%d", collection, samples), nil)
+	if err != nil {
+		return nil, err
+	}
+	var result map[string]any
+	err = json.Unmarshal(resp, &result)
+	return result, err
+}
@@ -1,11 +1,10 @@
-package main
+package oasisdb
 
 import (
 	"encoding/json"
 	"errors"
 	"io"
 	"net/http"
-	"os"
 	"reflect"
 	"strings"
 	"testing"
@@ -90,6 +89,21 @@ func TestClientMethods(t *testing.T) {
 				}
 			},
 		},
+		{
+			name:         "CreateCollectionWithOptions",
+			responseBody: `{"name":"docs","dimension":3}`,
+			responseCode: http.StatusOK,
+			wantMethod:   http.MethodPost,
+			wantPath:     "/v1/collections",
+			wantBody: map[string]any{
+				"name":          "docs",
+				"dimension":     3,
+				"store_vectors": true,
+			},
+			run: func(c *OasisDBClient) (any, error) {
+				return c.CreateCollectionWithOptions("docs", map[string]any{"dimension": 3, "store_vectors": true})
+			},
+		},
 		{
 			name:         "GetCollection",
 			responseBody: `{"name":"docs","dimension":3}`,
@@ -109,7 +123,7 @@ func TestClientMethods(t *testing.T) {
 		},
 		{
 			name:         "ListCollections",
-			responseBody: `[{"name":"docs"},{"name":"logs"}]`,
+			responseBody: `{"collections":["docs","logs"],"count":2}`,
 			responseCode: http.StatusOK,
 			wantMethod:   http.MethodGet,
 			wantPath:     "/v1/collections",
@@ -118,9 +132,9 @@ func TestClientMethods(t *testing.T) {
 			},
 			assertResult: func(t *testing.T, result any) {
 				t.Helper()
-				got := result.([]map[string]any)
-				if len(got) != 2 {
-					t.Fatalf("expected 2 collections, got %d", len(got))
+				got := result.([]string)
+				if !reflect.DeepEqual(got, []string{"docs", "logs"}) {
+					t.Fatalf("unexpected collections: %v", got)
 				}
 			},
 		},
@@ -134,6 +148,79 @@ func TestClientMethods(t *testing.T) {
 				return nil, c.DeleteCollection("docs")
 			},
 		},
+		{
+			name:         "CloneCollection",
+			responseBody: `{"name":"docs_ivf","index_type":"ivf_flat","count":2}`,
+			responseCode: http.StatusOK,
+			wantMethod:   http.MethodPost,
+			wantPath:     "/v1/collections/docs/clone",
+			wantBody: map[string]any{
+				"target":       "docs_ivf",
+				"index_type":   "ivf_flat",
+				"index_params": map[string]any{"nlist": 4},
+			},
+			run: func(c *OasisDBClient) (any, error) {
+				return c.CloneCollection("docs", "docs_ivf", "ivf_flat", map[string]any{"nlist": 4})
+			},
+		},
+		{
+			name:         "Reindex",
+			responseBody: `{"state":"running","index_type":"hnsw"}`,
+			responseCode: http.StatusAccepted,
+			wantMethod:   http.MethodPost,
+			wantPath:     "/v1/collections/docs/reindex",
+			wantBody: map[string]any{
+				"index_type": "hnsw",
+				"parameters": map[string]any{"M": 32},
+			},
+			run: func(c *OasisDBClient) (any, error) {
+				return c.Reindex("docs", "hnsw", map[string]any{"M": 32})
+			},
+		},
+		{
+			name:         "ReindexStatus",
+			responseBody: `{"state":"done","index_type":"hnsw","count":2}`,
+			responseCode: http.StatusOK,
+			wantMethod:   http.MethodGet,
+			wantPath:     "/v1/collections/docs/reindex",
+			run: func(c *OasisDBClient) (any, error) {
+				return c.ReindexStatus("docs")
+			},
+		},
+		{
+			name:         "ListJobs",
+			responseBody: `{"jobs":[{"id":1,"collection":"docs","kind":"build","state":"running","total":10,"inserted":4}],"count":1}`,
+			responseCode: http.StatusOK,
+			wantMethod:   http.MethodGet,
+			wantPath:     "/v1/jobs",
+			run: func(c *OasisDBClient) (any, error) {
+				return c.ListJobs("docs")
+			},
+			assertResult: func(t *testing.T, result any) {
+				t.Helper()
+				got := result.(map[string]any)
+				if got["count"] != float64(1) {
+					t.Fatalf("expected 1 job, got %v", got["count"])
+				}
+			},
+		},
+		{
+			name:         "RestoreCollection",
+			responseBody: `{"name":"docs","dimension":3}`,
+			responseCode: http.StatusOK,
+			wantMethod:   http.MethodPost,
+			wantPath:     "/v1/collections/docs/restore",
+			run: func(c *OasisDBClient) (any, error) {
+				return c.RestoreCollection("docs")
+			},
+			assertResult: func(t *testing.T, result any) {
+				t.Helper()
+				got := result.(map[string]any)
+				if got["name"] != "docs" {
+					t.Fatalf("expected collection name docs, got %v", got["name"])
+				}
+			},
+		},
 		{
 			name:         "UpsertDocument",
 			responseBody: `{"id":"doc-1"}`,
@@ -175,6 +262,23 @@ func TestClientMethods(t *testing.T) {
 				})
 			},
 		},
+		{
+			name:         "IngestDocument",
+			responseBody: `{"ids":["100","101"],"count":2}`,
+			responseCode: http.StatusOK,
+			wantMethod:   http.MethodPost,
+			wantPath:     "/v1/collections/docs/documents/ingest",
+			wantBody: map[string]any{
+				"id":       "guide",
+				"text":     "First. Second.",
+				"chunking": map[string]any{"size": 10, "splitter": "sentence"},
+				"start_id": 100,
+			},
+			run: func(c *OasisDBClient) (any, error) {
+				startID := 100
+				return c.IngestDocument("docs", "guide", "First. Second.", nil, map[string]any{"size": 10, "splitter": "sentence"}, &startID)
+			},
+		},
 		{
 			name:         "GetDocument",
 			responseBody: `{"id":"doc-1"}`,
@@ -217,6 +321,22 @@ func TestClientMethods(t *testing.T) {
 				return nil, c.BuildIndex("docs", []map[string]any{{"id": "doc-1"}})
 			},
 		},
+		{
+			name:         "RebuildIndex",
+			responseBody: `{"count":2}`,
+			responseCode: http.StatusOK,
+			wantMethod:   http.MethodPost,
+			wantPath:     "/v1/collections/docs/rebuild",
+			run: func(c *OasisDBClient) (any, error) {
+				return c.RebuildIndex("docs")
+			},
+			assertResult: func(t *testing.T, result any) {
+				t.Helper()
+				if got := result.(map[string]any)["count"]; got != float64(2) {
+					t.Fatalf("unexpected count: %v", got)
+				}
+			},
+		},
 		{
 			name:         "SetParams",
 			responseBody: `{}`,
@@ -281,6 +401,140 @@ func TestClientMethods(t *testing.T) {
 				return c.SearchDocuments("docs", []float32{1, 2, 3}, 2, map[string]any{"tag": "news"})
 			},
 		},
+		{
+			name:         "SearchDocumentsByText",
+			responseBody: `{"documents":[]}`,
+			responseCode: http.StatusOK,
+			wantMethod:   http.MethodPost,
+			wantPath:     "/v1/collections/docs/documents/search",
+			wantBody: map[string]any{
+				"query_text": "hello",
+				"limit":      2,
+				"filter":     map[string]any{"tag": "news"},
+			},
+			run: func(c *OasisDBClient) (any, error) {
+				return c.SearchDocumentsByText("docs", "hello", 2, map[string]any{"tag": "news"})
+			},
+		},
+		{
+			name:         "SearchDocumentsWithRerank",
+			responseBody: `{"documents":[]}`,
+			responseCode: http.StatusOK,
+			wantMethod:   http.MethodPost,
+			wantPath:     "/v1/collections/docs/documents/search",
+			wantBody: map[string]any{
+				"vector": []float32{1, 2, 3},
+				"limit":  2,
+				"rerank": map[string]any{"type": "mmr", "lambda": 0.5},
+			},
+			run: func(c *OasisDBClient) (any, error) {
+				return c.SearchDocumentsWithRerank("docs", []float32{1, 2, 3}, 2, nil, map[string]any{"type": "mmr", "lambda": 0.5})
+			},
+		},
+		{
+			name:         "ArchiveDocuments",
+			responseBody: `{"archived":["doc-1"],"count":1}`,
+			responseCode: http.StatusOK,
+			wantMethod:   http.MethodPost,
+			wantPath:     "/v1/collections/docs/archive",
+			wantBody:     map[string]any{"unread_days": 30},
+			run: func(c *OasisDBClient) (any, error) {
+				return c.ArchiveDocuments("docs", 30)
+			},
+		},
+		{
+			name:         "ArchiveDocumentsDefaultThreshold",
+			responseBody: `{"archived":[],"count":0}`,
+			responseCode: http.StatusOK,
+			wantMethod:   http.MethodPost,
+			wantPath:     "/v1/collections/docs/archive",
+			run: func(c *OasisDBClient) (any, error) {
+				return c.ArchiveDocuments("docs", 0)
+			},
+		},
+		{
+			name:         "RestoreDocument",
+			responseBody: `{}`,
+			responseCode: http.StatusOK,
+			wantMethod:   http.MethodPost,
+			wantPath:     "/v1/collections/docs/documents/doc-1/restore",
+			run: func(c *OasisDBClient) (any, error) {
+				return nil, c.RestoreDocument("docs", "doc-1")
+			},
+		},
+		{
+			name:         "ScrollDocuments",
+			responseBody: `{"documents":[{"id":"doc-1"}],"count":1,"cursor":"abc"}`,
+			responseCode: http.StatusOK,
+			wantMethod:   http.MethodPost,
+			wantPath:     "/v1/collections/docs/scroll",
+			wantBody:     map[string]any{"filter": map[string]any{"tag": "a"}, "size": 50},
+			run: func(c *OasisDBClient) (any, error) {
+				return c.ScrollDocuments("docs", map[string]any{"tag": "a"}, 50, "")
+			},
+			assertResult: func(t *testing.T, result any) {
+				t.Helper()
+				if got := result.(map[string]any)["cursor"]; got != "abc" {
+					t.Fatalf("unexpected cursor: %v", got)
+				}
+			},
+		},
+		{
+			name:         "ScrollDocumentsNextPage",
+			responseBody: `{"documents":[],"count":0,"cursor":""}`,
+			responseCode: http.StatusOK,
+			wantMethod:   http.MethodPost,
+			wantPath:     "/v1/collections/docs/scroll",
+			wantBody:     map[string]any{"cursor": "abc"},
+			run: func(c *OasisDBClient) (any, error) {
+				return c.ScrollDocuments("docs", nil, 0, "abc")
+			},
+		},
+		{
+			name:         "ScrollDocumentsSnapshot",
+			responseBody: `{"documents":[],"count":0,"cursor":"","seq":7}`,
+			responseCode: http.StatusOK,
+			wantMethod:   http.MethodPost,
+			wantPath:     "/v1/collections/docs/scroll",
+			wantBody:     map[string]any{"snapshot": true, "size": 10},
+			run: func(c *OasisDBClient) (any, error) {
+				return c.ScrollDocumentsSnapshot("docs", 10, "")
+			},
+		},
+		{
+			name:         "ListDocumentIDs",
+			responseBody: `{"ids":["a","b"],"count":2,"cursor":"b"}`,
+			responseCode: http.StatusOK,
+			wantMethod:   http.MethodGet,
+			wantPath:     "/v1/collections/docs/ids",
+			run: func(c *OasisDBClient) (any, error) {
+				return c.ListDocumentIDs("docs", 2, "a")
+			},
+			assertResult: func(t *testing.T, result any) {
+				t.Helper()
+				got := result.(map[string]any)
+				if got["cursor"] != "b" {
+					t.Fatalf("expected cursor b, got %v", got["cursor"])
+				}
+			},
+		},
+		{
+			name:         "ListClusters",
+			responseBody: `{"clusters":[{"id":0,"centroid":[1,2,3],"count":2,"sample_ids":["1"]}],"count":1}`,
+			responseCode: http.StatusOK,
+			wantMethod:   http.MethodGet,
+			wantPath:     "/v1/collections/docs/clusters",
+			run: func(c *OasisDBClient) (any, error) {
+				return c.ListClusters("docs", 1)
+			},
+			assertResult: func(t *testing.T, result any) {
+				t.Helper()
+				got := result.(map[string]any)
+				if got["count"] != float64(1) {
+					t.Fatalf("expected one cluster, got %v", got["count"])
+				}
+			},
+		},
 	}
 
 	for _, tt := range tests {
@@ -370,6 +624,26 @@ func TestRequestReturnsOasisDBError(t *testing.T) {
 	}
 }
 
+func TestRequestSendsTenantHeader(t *testing.T) {
+	client := NewOasisDBClient("http://example.com")
+	client.Tenant = "acme"
+	var tenant string
+	client.Client = &http.Client{Transport: roundTripFunc(func(r *http.Request) (*http.Response, error) {
+		tenant = r.Header.Get("X-Tenant")
+		return &http.Response{
+			StatusCode: http.StatusOK,
+			Body:       io.NopCloser(strings.NewReader(`{"collections":[],"count":0}`)),
+			Header:     make(http.Header),
+		}, nil
+	})}
+	if _, err := client.ListCollections(); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if tenant != "acme" {
+		t.Fatalf("expected tenant header acme, got %q", tenant)
+	}
+}
+
 func TestRequestReturnsMarshalError(t *testing.T) {
 	client := NewOasisDBClient("http://example.com")
 	_, err := client.request(http.MethodPost, "/broken", map[string]any{
@@ -412,97 +686,3 @@ func TestGetCollectionReturnsJSONError(t *testing.T) {
 		t.Fatal("expected invalid json response to fail")
 	}
 }
-
-func TestExampleProgramMain(t *testing.T) {
-	oldTransport := http.DefaultTransport
-	oldStdout := os.Stdout
-	defer func() {
-		http.DefaultTransport = oldTransport
-		os.Stdout = oldStdout
-	}()
-
-	var calls []string
-	http.DefaultTransport = roundTripFunc(func(r *http.Request) (*http.Response, error) {
-		calls = append(calls, r.Method+" "+r.URL.Path)
-
-		if r.URL.Path == "/v1/collections/demo/documents/batchupsert" {
-			var payload map[string]any
-			if err := json.NewDecoder(r.Body).Decode(&payload); err != nil {
-				t.Fatalf("failed to decode batch upsert payload: %v", err)
-			}
-			documents, ok := payload["documents"].([]any)
-			if !ok || len(documents) != 10 {
-				t.Fatalf("expected 10 documents in batch upsert, got %v", payload["documents"])
-			}
-		}
-
-		var body string
-		switch r.Method + " " + r.URL.Path {
-		case "GET /":
-			body = `{"status":"ok"}`
-		case "POST /v1/collections":
-			body = `{"name":"demo"}`
-		case "POST /v1/collections/demo/documents/batchupsert":
-			body = `{}`
-		case "POST /v1/collections/demo/vectors/search":
-			body = `{"results":[]}`
-		case "POST /v1/collections/demo/documents/search":
-			body = `{"results":[]}`
-		case "DELETE /v1/collections/demo":
-			body = `{}`
-		default:
-			t.Fatalf("unexpected request: %s %s", r.Method, r.URL.Path)
-		}
-
-		return &http.Response{
-			StatusCode: http.StatusOK,
-			Body:       io.NopCloser(strings.NewReader(body)),
-			Header:     make(http.Header),
-		}, nil
-	})
-
-	reader, writer, err := os.Pipe()
-	if err != nil {
-		t.Fatalf("failed to create stdout pipe: %v", err)
-	}
-	os.Stdout = writer
-
-	main()
-
-	if err := writer.Close(); err != nil {
-		t.Fatalf("failed to close stdout writer: %v", err)
-	}
-	os.Stdout = oldStdout
-
-	output, err := io.ReadAll(reader)
-	if err != nil {
-		t.Fatalf("failed to read stdout: %v", err)
-	}
-
-	expectedCalls := []string{
-		"GET /",
-		"POST /v1/collections",
-		"POST /v1/collections/demo/documents/batchupsert",
-		"POST /v1/collections/demo/vectors/search",
-		"POST /v1/collections/demo/documents/search",
-		"DELETE /v1/collections/demo",
-	}
-	if !reflect.DeepEqual(expectedCalls, calls) {
-		t.Fatalf("unexpected request sequence: want %v, got %v", expectedCalls, calls)
-	}
-
-	outputText := string(output)
-	expectedOutput := []string{
-		"Health check: true",
-		"Created collection: demo",
-		"Upserted 10 documents",
-		"Vector search results:",
-		"Document search results:",
-		"Deleted collection 'demo'",
-	}
-	for _, want := range expectedOutput {
-		if !strings.Contains(outputText, want) {
-			t.Fatalf("expected output to contain %q, got %q", want, outputText)
-		}
-	}
-}
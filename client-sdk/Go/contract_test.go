@@ -0,0 +1,299 @@
+package oasisdb
+
+import (
+	"bytes"
+	"encoding/binary"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"regexp"
+	"slices"
+	"testing"
+	"time"
+
+	"oasisdb/internal/config"
+	"oasisdb/internal/db"
+	"oasisdb/internal/server"
+)
+
+// contractRoutes maps every SDK request to the server type it is bound to,
+// bodies are decoded strictly so a field renamed on either side fails here
+// instead of being silently dropped by the server
+var contractRoutes = []struct {
+	method string
+	path   *regexp.Regexp
+	newReq func() any
+}{
+	{http.MethodPost, regexp.MustCompile(`^/v1/collections$`), func() any { return &server.CreateCollectionRequest{} }},
+	{http.MethodPost, regexp.MustCompile(`^/v1/collections/[^/]+/documents$`), func() any { return &server.UpsertDocumentRequest{} }},
+	{http.MethodPost, regexp.MustCompile(`^/v1/collections/[^/]+/documents/batchupsert$`), func() any { return &server.BatchUpsertRequest{} }},
+	{http.MethodPost, regexp.MustCompile(`^/v1/collections/[^/]+/buildindex$`), func() any { return &server.BatchUpsertRequest{} }},
+	{http.MethodPost, regexp.MustCompile(`^/v1/collections/[^/]+/documents/ingest$`), func() any { return &server.IngestDocumentRequest{} }},
+	{http.MethodPost, regexp.MustCompile(`^/v1/collections/[^/]+/documents/setparams$`), func() any { return &server.SetParamsRequest{} }},
+	{http.MethodPost, regexp.MustCompile(`^/v1/collections/[^/]+/documents/search$`), func() any { return &server.SearchDocumentRequest{} }},
+	{http.MethodPost, regexp.MustCompile(`^/v1/collections/[^/]+/vectors/search$`), func() any { return &server.SearchVectorRequest{} }},
+	{http.MethodPost, regexp.MustCompile(`^/v1/collections/[^/]+/archive$`), func() any { return &server.ArchiveRequest{} }},
+	{http.MethodPost, regexp.MustCompile(`^/v1/collections/[^/]+/clone$`), func() any { return &server.CloneRequest{} }},
+	{http.MethodPost, regexp.MustCompile(`^/v1/collections/[^/]+/reindex$`), func() any { return &server.ReindexRequest{} }},
+	{http.MethodPost, regexp.MustCompile(`^/v1/collections/[^/]+/scroll$`), func() any { return &server.ScrollRequest{} }},
+}
+
+// newContractClient starts a real server backed by a temporary database and
+// returns a client talking to it through the strict request check
+func newContractClient(t *testing.T) *OasisDBClient {
+	t.Helper()
+
+	conf, err := config.NewConfig(t.TempDir())
+	if err != nil {
+		t.Fatalf("failed to create config: %v", err)
+	}
+	database, err := db.New(conf)
+	if err != nil {
+		t.Fatalf("failed to create db: %v", err)
+	}
+	if err := database.Open(); err != nil {
+		t.Fatalf("failed to open db: %v", err)
+	}
+	handler := server.New(database).Handler()
+
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, err := io.ReadAll(r.Body)
+		if err != nil {
+			t.Errorf("failed to read request body: %v", err)
+		}
+		if len(body) > 0 {
+			checkContract(t, r.Method, r.URL.Path, contractHeader(t, r, body))
+		}
+		r.Body = io.NopCloser(bytes.NewReader(body))
+		handler.ServeHTTP(w, r)
+	}))
+	t.Cleanup(func() {
+		ts.Close()
+		database.Close()
+	})
+
+	return NewOasisDBClient(ts.URL)
+}
+
+// contractHeader returns the JSON part of a body, the header of binary bodies
+func contractHeader(t *testing.T, r *http.Request, body []byte) []byte {
+	t.Helper()
+	if r.Header.Get("Content-Type") != BinaryContentType {
+		return body
+	}
+	if len(body) < 4 || int(binary.LittleEndian.Uint32(body)) > len(body)-4 {
+		t.Errorf("%s %s: malformed binary body", r.Method, r.URL.Path)
+		return body
+	}
+	return body[4 : 4+binary.LittleEndian.Uint32(body)]
+}
+
+func checkContract(t *testing.T, method, path string, body []byte) {
+	t.Helper()
+	for _, route := range contractRoutes {
+		if route.method != method || !route.path.MatchString(path) {
+			continue
+		}
+		dec := json.NewDecoder(bytes.NewReader(body))
+		dec.DisallowUnknownFields()
+		if err := dec.Decode(route.newReq()); err != nil {
+			t.Errorf("%s %s: SDK body %s does not match server schema: %v", method, path, body, err)
+		}
+		return
+	}
+	t.Errorf("%s %s: SDK sent a body to a route without a server request type", method, path)
+}
+
+func TestClientServerContract(t *testing.T) {
+	client := newContractClient(t)
+
+	ok, err := client.HealthCheck()
+	if err != nil || !ok {
+		t.Fatalf("health check failed: %v", err)
+	}
+
+	// index parameters may be sent as numbers
+	_, err = client.CreateCollection("contract", 3, "hnsw", map[string]any{"M": 16, "efConstruction": 200})
+	if err != nil {
+		t.Fatalf("CreateCollection failed: %v", err)
+	}
+
+	collection, err := client.GetCollection("contract")
+	if err != nil {
+		t.Fatalf("GetCollection failed: %v", err)
+	}
+	if collection["name"] != "contract" || collection["dimension"] != float64(3) {
+		t.Fatalf("unexpected collection: %v", collection)
+	}
+
+	names, err := client.ListCollections()
+	if err != nil {
+		t.Fatalf("ListCollections failed: %v", err)
+	}
+	if !slices.Contains(names, "contract") {
+		t.Fatalf("expected contract in %v", names)
+	}
+
+	parameters := map[string]any{"genre": "drama", "year": float64(1999)}
+	if _, err := client.UpsertDocument("contract", "1", []float32{1, 0, 0}, parameters); err != nil {
+		t.Fatalf("UpsertDocument failed: %v", err)
+	}
+	err = client.BatchUpsertDocuments("contract", []map[string]any{
+		{"id": "2", "vector": []float32{0, 1, 0}, "parameters": map[string]any{"genre": "comedy"}},
+		{"id": "3", "vector": []float32{0, 0, 1}, "parameters": map[string]any{"genre": "drama"}},
+	})
+	if err != nil {
+		t.Fatalf("BatchUpsertDocuments failed: %v", err)
+	}
+
+	err = client.BatchUpsertDocumentsBinary("contract", []map[string]any{
+		{"id": "4", "vector": []float32{0, 1, 1}, "parameters": map[string]any{"genre": "comedy"}},
+	})
+	if err != nil {
+		t.Fatalf("BatchUpsertDocumentsBinary failed: %v", err)
+	}
+	binaryVectors, err := client.SearchVectorsBinary("contract", []float32{0, 1, 1}, 1)
+	if err != nil {
+		t.Fatalf("SearchVectorsBinary failed: %v", err)
+	}
+	if ids, _ := binaryVectors["ids"].([]any); len(ids) != 1 || ids[0] != "4" {
+		t.Fatalf("unexpected binary vector search result: %v", binaryVectors)
+	}
+	if err := client.DeleteDocument("contract", "4"); err != nil {
+		t.Fatalf("DeleteDocument failed: %v", err)
+	}
+
+	doc, err := client.GetDocument("contract", "1")
+	if err != nil {
+		t.Fatalf("GetDocument failed: %v", err)
+	}
+	if doc["id"] != "1" || !reflect.DeepEqual(doc["vector"], []any{float64(1), float64(0), float64(0)}) {
+		t.Fatalf("document did not round-trip: %v", doc)
+	}
+	if !reflect.DeepEqual(doc["parameters"], parameters) {
+		t.Fatalf("parameters did not round-trip: got %v, want %v", doc["parameters"], parameters)
+	}
+
+	if err := client.SetParams("contract", map[string]any{"efsearch": 64}); err != nil {
+		t.Fatalf("SetParams failed: %v", err)
+	}
+
+	vectors, err := client.SearchVectors("contract", []float32{1, 0, 0}, 2)
+	if err != nil {
+		t.Fatalf("SearchVectors failed: %v", err)
+	}
+	if ids, _ := vectors["ids"].([]any); len(ids) != 2 || ids[0] != "1" {
+		t.Fatalf("unexpected vector search result: %v", vectors)
+	}
+
+	docs, err := client.SearchDocuments("contract", []float32{0, 0, 1}, 3, map[string]any{"genre": "drama"})
+	if err != nil {
+		t.Fatalf("SearchDocuments failed: %v", err)
+	}
+	found, _ := docs["documents"].([]any)
+	if len(found) != 2 || found[0].(map[string]any)["id"] != "3" {
+		t.Fatalf("unexpected document search result: %v", docs)
+	}
+
+	within, err := client.SearchVectorsWithinDistance("contract", []float32{1, 0, 0}, 0.5, 0)
+	if err != nil {
+		t.Fatalf("SearchVectorsWithinDistance failed: %v", err)
+	}
+	if ids, _ := within["ids"].([]any); len(ids) != 1 || ids[0] != "1" {
+		t.Fatalf("unexpected range search result: %v", within)
+	}
+
+	docs, err = client.SearchDocumentsWithinDistance("contract", []float32{0, 0, 1}, 0.5, 0, nil)
+	if err != nil {
+		t.Fatalf("SearchDocumentsWithinDistance failed: %v", err)
+	}
+	if found, _ := docs["documents"].([]any); len(found) != 1 || found[0].(map[string]any)["id"] != "3" {
+		t.Fatalf("unexpected range document search result: %v", docs)
+	}
+
+	reranked, err := client.SearchDocumentsWithRerank("contract", []float32{1, 0, 0}, 2, nil, map[string]any{"type": "mmr", "lambda": 0.5})
+	if err != nil {
+		t.Fatalf("SearchDocumentsWithRerank failed: %v", err)
+	}
+	found, _ = reranked["documents"].([]any)
+	if len(found) != 2 {
+		t.Fatalf("unexpected reranked result: %v", reranked)
+	}
+	if _, ok := found[0].(map[string]any)["rerank_score"]; !ok {
+		t.Fatalf("expected rerank_score in %v", found[0])
+	}
+
+	page, err := client.ScrollDocuments("contract", map[string]any{"genre": "drama"}, 1, "")
+	if err != nil {
+		t.Fatalf("ScrollDocuments failed: %v", err)
+	}
+	cursor, _ := page["cursor"].(string)
+	if cursor == "" {
+		t.Fatalf("expected a cursor after the first page: %v", page)
+	}
+	page, err = client.ScrollDocuments("contract", nil, 1, cursor)
+	if err != nil {
+		t.Fatalf("ScrollDocuments failed: %v", err)
+	}
+	if found, _ := page["documents"].([]any); len(found) != 1 || found[0].(map[string]any)["id"] != "3" {
+		t.Fatalf("unexpected second scroll page: %v", page)
+	}
+
+	if _, err := client.CloneCollection("contract", "contract_flat", "flat", map[string]any{"searchThreads": 2}); err != nil {
+		t.Fatalf("CloneCollection failed: %v", err)
+	}
+	if _, err := client.Reindex("contract_flat", "hnsw", map[string]any{"M": 8}); err != nil {
+		t.Fatalf("Reindex failed: %v", err)
+	}
+	for {
+		status, err := client.ReindexStatus("contract_flat")
+		if err != nil {
+			t.Fatalf("ReindexStatus failed: %v", err)
+		}
+		if status["state"] == "done" {
+			break
+		}
+		if status["state"] != "running" {
+			t.Fatalf("unexpected reindex status: %v", status)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	if _, err := client.ArchiveDocuments("contract", 1); err != nil {
+		t.Fatalf("ArchiveDocuments failed: %v", err)
+	}
+
+	if err := client.DeleteDocument("contract", "2"); err != nil {
+		t.Fatalf("DeleteDocument failed: %v", err)
+	}
+	if _, err := client.GetDocument("contract", "2"); err == nil {
+		t.Fatal("expected deleted document to be gone")
+	}
+
+	if err := client.DeleteCollection("contract"); err != nil {
+		t.Fatalf("DeleteCollection failed: %v", err)
+	}
+	if _, err := client.GetCollection("contract"); err == nil {
+		t.Fatal("expected deleted collection to be gone")
+	}
+	if _, err := client.RestoreCollection("contract"); err != nil {
+		t.Fatalf("RestoreCollection failed: %v", err)
+	}
+	if _, err := client.GetCollection("contract"); err != nil {
+		t.Fatalf("expected restored collection, got %v", err)
+	}
+}
+
+// TestIngestContract only checks the request schema, ingest needs an
+// embedding provider which the contract server doesn't have
+func TestIngestContract(t *testing.T) {
+	client := newContractClient(t)
+	if _, err := client.CreateCollection("ingest", 3, "hnsw", nil); err != nil {
+		t.Fatalf("CreateCollection failed: %v", err)
+	}
+	startID := 10
+	_, _ = client.IngestDocument("ingest", "book", "One. Two.", map[string]any{"lang": "en"},
+		map[string]any{"size": 64, "overlap": 8, "splitter": "sentence"}, &startID)
+}
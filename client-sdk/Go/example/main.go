@@ -11,12 +11,14 @@ It will:
   5. Clean up by deleting the collection.
 
 Usage:
-$ go run example.go
+$ go run ./client-sdk/Go/example
 */
 
 import (
 	"fmt"
 	"math/rand"
+
+	oasisdb "oasisdb/client-sdk/Go"
 )
 
 func randomVector(dim int) []float32 {
@@ -28,7 +30,7 @@ func randomVector(dim int) []float32 {
 }
 
 func main() {
-	client := NewOasisDBClient("http://localhost:8080")
+	client := oasisdb.NewOasisDBClient("http://localhost:8080")
 
 	// 1. Health check
 	ok, err := client.HealthCheck()
@@ -0,0 +1,111 @@
+package main
+
+import (
+	"encoding/json"
+	"io"
+	"net/http"
+	"os"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+type roundTripFunc func(*http.Request) (*http.Response, error)
+
+func (f roundTripFunc) RoundTrip(req *http.Request) (*http.Response, error) {
+	return f(req)
+}
+
+func TestExampleProgramMain(t *testing.T) {
+	oldTransport := http.DefaultTransport
+	oldStdout := os.Stdout
+	defer func() {
+		http.DefaultTransport = oldTransport
+		os.Stdout = oldStdout
+	}()
+
+	var calls []string
+	http.DefaultTransport = roundTripFunc(func(r *http.Request) (*http.Response, error) {
+		calls = append(calls, r.Method+" "+r.URL.Path)
+
+		if r.URL.Path == "/v1/collections/demo/documents/batchupsert" {
+			var payload map[string]any
+			if err := json.NewDecoder(r.Body).Decode(&payload); err != nil {
+				t.Fatalf("failed to decode batch upsert payload: %v", err)
+			}
+			documents, ok := payload["documents"].([]any)
+			if !ok || len(documents) != 10 {
+				t.Fatalf("expected 10 documents in batch upsert, got %v", payload["documents"])
+			}
+		}
+
+		var body string
+		switch r.Method + " " + r.URL.Path {
+		case "GET /":
+			body = `{"status":"ok"}`
+		case "POST /v1/collections":
+			body = `{"name":"demo"}`
+		case "POST /v1/collections/demo/documents/batchupsert":
+			body = `{}`
+		case "POST /v1/collections/demo/vectors/search":
+			body = `{"results":[]}`
+		case "POST /v1/collections/demo/documents/search":
+			body = `{"results":[]}`
+		case "DELETE /v1/collections/demo":
+			body = `{}`
+		default:
+			t.Fatalf("unexpected request: %s %s", r.Method, r.URL.Path)
+		}
+
+		return &http.Response{
+			StatusCode: http.StatusOK,
+			Body:       io.NopCloser(strings.NewReader(body)),
+			Header:     make(http.Header),
+		}, nil
+	})
+
+	reader, writer, err := os.Pipe()
+	if err != nil {
+		t.Fatalf("failed to create stdout pipe: %v", err)
+	}
+	os.Stdout = writer
+
+	main()
+
+	if err := writer.Close(); err != nil {
+		t.Fatalf("failed to close stdout writer: %v", err)
+	}
+	os.Stdout = oldStdout
+
+	output, err := io.ReadAll(reader)
+	if err != nil {
+		t.Fatalf("failed to read stdout: %v", err)
+	}
+
+	expectedCalls := []string{
+		"GET /",
+		"POST /v1/collections",
+		"POST /v1/collections/demo/documents/batchupsert",
+		"POST /v1/collections/demo/vectors/search",
+		"POST /v1/collections/demo/documents/search",
+		"DELETE /v1/collections/demo",
+	}
+	if !reflect.DeepEqual(expectedCalls, calls) {
+		t.Fatalf("unexpected request sequence: want %v, got %v", expectedCalls, calls)
+	}
+
+	outputText := string(output)
+	expectedOutput := []string{
+		"Health check: true",
+		"Created collection: demo",
+		"Upserted 10 documents",
+		"Vector search results:",
+		"Document search results:",
+		"Deleted collection 'demo'",
+	}
+	for _, want := range expectedOutput {
+		if !strings.Contains(outputText, want) {
+			t.Fatalf("expected output to contain %q, got %q", want, outputText)
+		}
+	}
+}
@@ -0,0 +1,263 @@
+package oasisdb
+
+import (
+	"context"
+	"crypto/rand"
+	"fmt"
+	"reflect"
+)
+
+// TextKey is the document parameter holding the text of a vector store
+// document, the server embeds it when no vector is sent
+const TextKey = "text"
+
+// embeddingKey flags a document for server side embedding of its TextKey
+const embeddingKey = "embedding"
+
+// Embedder turns texts into vectors on the client. Its method set is the
+// embeddings.Embedder of langchaingo, so its embedders can be passed as is.
+type Embedder interface {
+	EmbedDocuments(ctx context.Context, texts []string) ([][]float32, error)
+	EmbedQuery(ctx context.Context, text string) ([]float32, error)
+}
+
+// Document is a text with its metadata, shaped like the schema.Document of
+// langchaingo.
+type Document struct {
+	PageContent string
+	Metadata    map[string]any
+	Score       float32 // similarity of a search result, 1 / (1 + distance)
+	ID          string
+}
+
+// VectorStore stores texts and their metadata in a collection for retrieval
+// augmented generation, with the methods of the langchaingo vector store
+// interface. Texts are embedded by the Embedder, or by the server's embedding
+// provider when it is nil.
+//
+// Search filters use the LangChain filter syntax: {"genre": "drama"} or
+// {"genre": {"$eq": "drama"}}, combined with {"$and": [...]}. The server
+// only matches equal values, other operators are rejected by
+// TranslateFilter.
+type VectorStore struct {
+	Client     *OasisDBClient
+	Collection string
+	Embedder   Embedder
+}
+
+// NewVectorStore returns a vector store on an existing collection, embedder
+// may be nil to embed on the server.
+func NewVectorStore(client *OasisDBClient, collection string, embedder Embedder) *VectorStore {
+	return &VectorStore{Client: client, Collection: collection, Embedder: embedder}
+}
+
+// AddTexts stores texts with their metadata and returns their IDs, random
+// IDs are generated for texts without one. metadatas and ids may be nil,
+// otherwise they must have one entry per text.
+func (s *VectorStore) AddTexts(ctx context.Context, texts []string, metadatas []map[string]any, ids []string) ([]string, error) {
+	if metadatas != nil && len(metadatas) != len(texts) {
+		return nil, fmt.Errorf("got %d metadatas for %d texts", len(metadatas), len(texts))
+	}
+	if ids != nil && len(ids) != len(texts) {
+		return nil, fmt.Errorf("got %d ids for %d texts", len(ids), len(texts))
+	}
+	if len(texts) == 0 {
+		return []string{}, nil
+	}
+
+	var vectors [][]float32
+	if s.Embedder != nil {
+		var err error
+		if vectors, err = s.Embedder.EmbedDocuments(ctx, texts); err != nil {
+			return nil, err
+		}
+		if len(vectors) != len(texts) {
+			return nil, fmt.Errorf("embedder returned %d vectors for %d texts", len(vectors), len(texts))
+		}
+	}
+
+	documents := make([]map[string]any, len(texts))
+	stored := make([]string, len(texts))
+	for i, text := range texts {
+		parameters := map[string]any{}
+		if metadatas != nil {
+			for k, v := range metadatas[i] {
+				parameters[k] = v
+			}
+		}
+		parameters[TextKey] = text
+		vector := []float32{}
+		if vectors != nil {
+			vector = vectors[i]
+		} else {
+			parameters[embeddingKey] = true
+		}
+		if ids != nil && ids[i] != "" {
+			stored[i] = ids[i]
+		} else {
+			stored[i] = newDocumentID()
+		}
+		documents[i] = map[string]any{"id": stored[i], "vector": vector, "parameters": parameters}
+	}
+	if err := s.Client.BatchUpsertDocuments(s.Collection, documents); err != nil {
+		return nil, err
+	}
+	return stored, nil
+}
+
+// AddDocuments stores documents like AddTexts, using their ID when set.
+func (s *VectorStore) AddDocuments(ctx context.Context, docs []Document) ([]string, error) {
+	texts := make([]string, len(docs))
+	metadatas := make([]map[string]any, len(docs))
+	ids := make([]string, len(docs))
+	for i, doc := range docs {
+		texts[i], metadatas[i], ids[i] = doc.PageContent, doc.Metadata, doc.ID
+	}
+	return s.AddTexts(ctx, texts, metadatas, ids)
+}
+
+// SimilaritySearch returns the k documents most similar to query that match
+// filter, which may be nil.
+func (s *VectorStore) SimilaritySearch(ctx context.Context, query string, k int, filter map[string]any) ([]Document, error) {
+	serverFilter, err := TranslateFilter(filter)
+	if err != nil {
+		return nil, err
+	}
+	var result map[string]any
+	if s.Embedder != nil {
+		vector, err := s.Embedder.EmbedQuery(ctx, query)
+		if err != nil {
+			return nil, err
+		}
+		result, err = s.Client.SearchDocuments(s.Collection, vector, k, serverFilter)
+		if err != nil {
+			return nil, err
+		}
+	} else {
+		result, err = s.Client.SearchDocumentsByText(s.Collection, query, k, serverFilter)
+		if err != nil {
+			return nil, err
+		}
+	}
+	return searchResultDocuments(result), nil
+}
+
+// SimilaritySearchByVector is SimilaritySearch with an embedded query.
+func (s *VectorStore) SimilaritySearchByVector(vector []float32, k int, filter map[string]any) ([]Document, error) {
+	serverFilter, err := TranslateFilter(filter)
+	if err != nil {
+		return nil, err
+	}
+	result, err := s.Client.SearchDocuments(s.Collection, vector, k, serverFilter)
+	if err != nil {
+		return nil, err
+	}
+	return searchResultDocuments(result), nil
+}
+
+// Delete removes the documents with the given IDs, missing ones are
+// ignored.
+func (s *VectorStore) Delete(ids []string) error {
+	for _, id := range ids {
+		err := s.Client.DeleteDocument(s.Collection, id)
+		if apiErr, ok := err.(*OasisDBError); ok && apiErr.StatusCode == 404 {
+			continue
+		}
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// TranslateFilter converts a LangChain metadata filter to the server's
+// filter, a map of parameters to the values they must equal. Conditions
+// the server can't evaluate, e.g. $gt, $in or $or, return an error instead
+// of being dropped.
+func TranslateFilter(filter map[string]any) (map[string]any, error) {
+	if len(filter) == 0 {
+		return nil, nil
+	}
+	translated := make(map[string]any, len(filter))
+	if err := translateFilter(filter, translated); err != nil {
+		return nil, err
+	}
+	return translated, nil
+}
+
+func translateFilter(filter, into map[string]any) error {
+	for key, value := range filter {
+		if key == "$and" {
+			var conditions []map[string]any
+			switch value := value.(type) {
+			case []map[string]any:
+				conditions = value
+			case []any:
+				for _, condition := range value {
+					sub, ok := condition.(map[string]any)
+					if !ok {
+						return fmt.Errorf("$and takes a list of filters, got a %T", condition)
+					}
+					conditions = append(conditions, sub)
+				}
+			default:
+				return fmt.Errorf("$and takes a list of filters, got %T", value)
+			}
+			for _, condition := range conditions {
+				if err := translateFilter(condition, into); err != nil {
+					return err
+				}
+			}
+			continue
+		}
+		if len(key) > 0 && key[0] == '$' {
+			return fmt.Errorf("filter operator %s is not supported, only equality and $and are", key)
+		}
+		if operators, ok := value.(map[string]any); ok {
+			for operator, operand := range operators {
+				if operator != "$eq" {
+					return fmt.Errorf("filter operator %s on %s is not supported, only $eq is", operator, key)
+				}
+				value = operand
+			}
+		}
+		if previous, ok := into[key]; ok && !reflect.DeepEqual(previous, value) {
+			return fmt.Errorf("filter requires %s to equal both %v and %v", key, previous, value)
+		}
+		into[key] = value
+	}
+	return nil
+}
+
+// searchResultDocuments converts the documents of a search response
+func searchResultDocuments(result map[string]any) []Document {
+	found, _ := result["documents"].([]any)
+	docs := make([]Document, 0, len(found))
+	for _, item := range found {
+		doc, ok := item.(map[string]any)
+		if !ok {
+			continue
+		}
+		metadata := map[string]any{}
+		parameters, _ := doc["parameters"].(map[string]any)
+		for k, v := range parameters {
+			metadata[k] = v
+		}
+		text, _ := metadata[TextKey].(string)
+		delete(metadata, TextKey)
+		delete(metadata, embeddingKey)
+		id, _ := doc["id"].(string)
+		distance, _ := doc["distance"].(float64)
+		docs = append(docs, Document{PageContent: text, Metadata: metadata, Score: float32(1 / (1 + distance)), ID: id})
+	}
+	return docs
+}
+
+// newDocumentID returns a random version 4 UUID
+func newDocumentID() string {
+	var b [16]byte
+	_, _ = rand.Read(b[:])
+	b[6] = b[6]&0x0f | 0x40
+	b[8] = b[8]&0x3f | 0x80
+	return fmt.Sprintf("%x-%x-%x-%x-%x", b[0:4], b[4:6], b[6:8], b[8:10], b[10:16])
+}
@@ -0,0 +1,105 @@
+package oasisdb
+
+import (
+	"context"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// letterEmbedder embeds a text by counting the letters a, b and c in it
+type letterEmbedder struct{}
+
+func (letterEmbedder) EmbedDocuments(ctx context.Context, texts []string) ([][]float32, error) {
+	vectors := make([][]float32, len(texts))
+	for i, text := range texts {
+		vectors[i], _ = letterEmbedder{}.EmbedQuery(ctx, text)
+	}
+	return vectors, nil
+}
+
+func (letterEmbedder) EmbedQuery(_ context.Context, text string) ([]float32, error) {
+	return []float32{float32(strings.Count(text, "a")), float32(strings.Count(text, "b")), float32(strings.Count(text, "c"))}, nil
+}
+
+func TestVectorStore(t *testing.T) {
+	client := newContractClient(t)
+	if _, err := client.CreateCollection("rag", 3, "hnsw", nil); err != nil {
+		t.Fatalf("CreateCollection failed: %v", err)
+	}
+	store := NewVectorStore(client, "rag", letterEmbedder{})
+	ctx := context.Background()
+
+	ids, err := store.AddTexts(ctx, []string{"aaa", "bbb", "abc"}, []map[string]any{
+		{"source": "x"}, {"source": "y"}, {"source": "x"},
+	}, []string{"first", "", ""})
+	if err != nil {
+		t.Fatalf("AddTexts failed: %v", err)
+	}
+	if len(ids) != 3 || ids[0] != "first" || ids[1] == "" || ids[1] == ids[2] {
+		t.Fatalf("unexpected ids: %v", ids)
+	}
+	if _, err := store.AddDocuments(ctx, []Document{{PageContent: "ccc", Metadata: map[string]any{"source": "y"}, ID: "last"}}); err != nil {
+		t.Fatalf("AddDocuments failed: %v", err)
+	}
+
+	docs, err := store.SimilaritySearch(ctx, "aa", 1, nil)
+	if err != nil {
+		t.Fatalf("SimilaritySearch failed: %v", err)
+	}
+	want := Document{PageContent: "aaa", Metadata: map[string]any{"source": "x"}, ID: "first"}
+	if len(docs) != 1 || docs[0].Score <= 0 || docs[0].Score > 1 {
+		t.Fatalf("unexpected search result: %+v", docs)
+	}
+	docs[0].Score = 0
+	if !reflect.DeepEqual(docs[0], want) {
+		t.Fatalf("got %+v, want %+v", docs[0], want)
+	}
+
+	docs, err = store.SimilaritySearch(ctx, "bb", 2, map[string]any{"$and": []any{map[string]any{"source": map[string]any{"$eq": "x"}}}})
+	if err != nil {
+		t.Fatalf("filtered SimilaritySearch failed: %v", err)
+	}
+	if len(docs) != 2 || docs[0].PageContent != "abc" || docs[1].PageContent != "aaa" {
+		t.Fatalf("unexpected filtered search result: %+v", docs)
+	}
+	if _, err := store.SimilaritySearch(ctx, "bb", 2, map[string]any{"year": map[string]any{"$gt": 2000}}); err == nil {
+		t.Fatal("expected an unsupported filter operator to fail")
+	}
+
+	if err := store.Delete([]string{"first", "missing"}); err != nil {
+		t.Fatalf("Delete failed: %v", err)
+	}
+	docs, err = store.SimilaritySearchByVector([]float32{3, 0, 0}, 1, map[string]any{"source": "x"})
+	if err != nil {
+		t.Fatalf("SimilaritySearchByVector failed: %v", err)
+	}
+	if len(docs) != 1 || docs[0].PageContent != "abc" {
+		t.Fatalf("deleted document still found: %+v", docs)
+	}
+}
+
+func TestTranslateFilter(t *testing.T) {
+	filter, err := TranslateFilter(map[string]any{
+		"genre": "drama",
+		"$and":  []map[string]any{{"year": map[string]any{"$eq": 1999}}, {"genre": "drama"}},
+	})
+	if err != nil {
+		t.Fatalf("TranslateFilter failed: %v", err)
+	}
+	if want := map[string]any{"genre": "drama", "year": 1999}; !reflect.DeepEqual(filter, want) {
+		t.Fatalf("got %v, want %v", filter, want)
+	}
+	if filter, err := TranslateFilter(nil); err != nil || filter != nil {
+		t.Fatalf("expected no filter, got %v, %v", filter, err)
+	}
+	for _, unsupported := range []map[string]any{
+		{"$or": []any{map[string]any{"genre": "drama"}}},
+		{"genre": map[string]any{"$in": []any{"drama"}}},
+		{"genre": "drama", "$and": []any{map[string]any{"genre": "comedy"}}},
+	} {
+		if _, err := TranslateFilter(unsupported); err == nil {
+			t.Fatalf("expected %v to be rejected", unsupported)
+		}
+	}
+}
@@ -16,7 +16,9 @@ returns a non-successful status code.
 
 from __future__ import annotations
 
+import json
 import logging
+import struct
 from typing import (
     Any,
     Mapping,
@@ -25,7 +27,9 @@ from typing import (
     Sequence,
     Iterable,
     Dict,
+    Iterator,
     List,
+    Union,
 )
 
 import requests
@@ -38,6 +42,26 @@ __all__ = [
 logger = logging.getLogger(__name__)
 logger.addHandler(logging.NullHandler())
 
+BINARY_CONTENT_TYPE = "application/octet-stream"
+
+
+def _binary_body(header: Mapping[str, Any], vectors: Iterable[Sequence[float]]) -> bytes:
+    """Encode a request in the binary layout: the little-endian uint32 length
+    of the JSON *header*, the header, then every vector as little-endian
+    float32 values."""
+    encoded = json.dumps(header).encode()
+    parts = [struct.pack("<I", len(encoded)), encoded]
+    for vector in vectors:
+        parts.append(struct.pack(f"<{len(vector)}f", *vector))
+    return b"".join(parts)
+
+
+def _dry_run_query(dry_run: bool, skip_embedding: bool) -> str:
+    """Return the query string of a batch write validated without writing."""
+    if not dry_run:
+        return ""
+    return "?dry_run=true" + ("&skip_embedding=true" if skip_embedding else "")
+
 
 class OasisDBError(RuntimeError):
     """Represents an error returned by the OasisDB server."""
@@ -61,6 +85,9 @@ class OasisDBClient:
     timeout:
         Default timeout (in seconds) applied to every request unless explicitly
         overridden.
+    tenant:
+        Optional tenant sent as the ``X-Tenant`` header. Collections are
+        scoped to the tenant, ``None`` uses the default tenant.
     """
 
     def __init__(
@@ -69,10 +96,12 @@ class OasisDBClient:
         *,
         session: Optional[requests.Session] = None,
         timeout: Optional[float] | tuple[float, float] = 20000,
+        tenant: Optional[str] = None,
     ) -> None:
         self.base_url = base_url.rstrip("/")
         self.session: requests.Session = session or requests.Session()
         self._timeout = timeout
+        self.tenant = tenant
 
     # ------------------------------------------------------------------
     # Low-level helpers
@@ -81,10 +110,22 @@ class OasisDBClient:
         """Return full URL for *path* (which must start with '/')."""
         return f"{self.base_url}{path}"
 
+    def _post_binary(
+        self, path: str, header: Mapping[str, Any], vectors: Iterable[Sequence[float]]
+    ):
+        return self._request(
+            "POST",
+            path,
+            data=_binary_body(header, vectors),
+            headers={"Content-Type": BINARY_CONTENT_TYPE},
+        )
+
     def _request(self, method: str, path: str, **kwargs: Any):
         url = self._url(path)
         if "timeout" not in kwargs and self._timeout is not None:
             kwargs["timeout"] = self._timeout
+        if self.tenant:
+            kwargs["headers"] = {"X-Tenant": self.tenant, **kwargs.get("headers", {})}
 
         logger.debug("%s %s", method.upper(), url)
         response = self.session.request(method, url, **kwargs)
@@ -108,6 +149,14 @@ class OasisDBClient:
         """Ping the root endpoint and return True if server replies."""
         return self._request("GET", "/") == {"status": "ok"}
 
+    def readiness(self, *, embedding: bool = False) -> Dict[str, Any]:
+        """Return the readiness checks, also when the server is not ready."""
+        params = {"embedding": "true"} if embedding else None
+        response = self.session.get(self._url("/readyz"), params=params, timeout=self._timeout)
+        if response.status_code not in (200, 503):
+            raise OasisDBError(response.status_code, response.text)
+        return response.json()
+
     # Collections -------------------------------------------------------
     def create_collection(
         self,
@@ -115,7 +164,13 @@ class OasisDBClient:
         dimension: int,
         *,
         index_type: str = "hnsw",
-        parameters: Optional[Mapping[str, str]] = None,
+        parameters: Optional[Mapping[str, Any]] = None,
+        store_vectors: bool = False,
+        normalize: bool = False,
+        schema: Optional[List[Mapping[str, Any]]] = None,
+        cache: Optional[Mapping[str, Any]] = None,
+        dedup_threshold: Optional[float] = None,
+        dedup_mode: Optional[str] = None,
     ) -> Dict[str, Any]:
         payload = {
             "name": name,
@@ -123,17 +178,41 @@ class OasisDBClient:
             "index_type": index_type,
             "parameters": parameters or {},
         }
+        if store_vectors:
+            payload["store_vectors"] = True
+        if normalize:
+            payload["normalize"] = True
+        if schema:
+            payload["schema"] = {"fields": list(schema)}
+        if cache is not None:
+            payload["cache"] = dict(cache)
+        if dedup_threshold is not None:
+            payload["dedup_threshold"] = dedup_threshold
+        if dedup_mode is not None:
+            payload["dedup_mode"] = dedup_mode
         return self._request("POST", "/v1/collections", json=payload)
 
     def get_collection(self, name: str) -> Dict[str, Any]:
         return self._request("GET", f"/v1/collections/{name}")
 
-    def list_collections(self) -> List[Dict[str, Any]]:
-        return self._request("GET", "/v1/collections")
+    def list_collections(self) -> List[str]:
+        return self._request("GET", "/v1/collections").get("collections", [])
+
+    def collection_stats(self) -> Dict[str, Dict[str, Any]]:
+        """Return the counters of every collection keyed by name."""
+        return self._request("GET", "/v1/collections").get("stats", {})
 
     def delete_collection(self, name: str) -> None:
         self._request("DELETE", f"/v1/collections/{name}")
 
+    def restore_collection(self, name: str) -> Dict[str, Any]:
+        """Bring back a deleted collection before it is purged."""
+        return self._request("POST", f"/v1/collections/{name}/restore")
+
+    def list_trash(self) -> List[Dict[str, Any]]:
+        """List the deleted collections that can still be restored."""
+        return self._request("GET", "/v1/trash").get("collections", [])
+
     # Documents ---------------------------------------------------------
     def upsert_document(
         self,
@@ -156,16 +235,51 @@ class OasisDBClient:
         self,
         collection: str,
         documents: Iterable[Mapping[str, Any]],
-    ) -> None:
+        *,
+        binary: bool = False,
+        dry_run: bool = False,
+        skip_embedding: bool = False,
+    ) -> Optional[Dict[str, Any]]:
+        """Write *documents*, or with *dry_run* only return the rejected ones."""
         docs = []
         for doc in documents:
             if "id" not in doc or "vector" not in doc:
                 raise ValueError("Each document must contain 'id' and 'vector'.")
             docs.append(doc)
-        self._request(
-            "POST",
-            f"/v1/collections/{collection}/documents/batchupsert",
-            json={"documents": docs},
+        path = f"/v1/collections/{collection}/documents/batchupsert"
+        path += _dry_run_query(dry_run, skip_embedding)
+        if binary:
+            header = [
+                {k: v for k, v in doc.items() if k != "vector"}
+                | {"dimension": len(doc["vector"])}
+                for doc in docs
+            ]
+            return self._post_binary(
+                path,
+                {"documents": header},
+                [doc["vector"] for doc in docs],
+            )
+        return self._request("POST", path, json={"documents": docs})
+
+    def ingest_document(
+        self,
+        collection: str,
+        *,
+        doc_id: str,
+        text: str,
+        parameters: Optional[Mapping[str, Any]] = None,
+        chunking: Optional[Mapping[str, Any]] = None,
+        start_id: Optional[int] = None,
+    ) -> Dict[str, Any]:
+        payload: MutableMapping[str, Any] = {"id": doc_id, "text": text}
+        if parameters:
+            payload["parameters"] = dict(parameters)
+        if chunking:
+            payload["chunking"] = dict(chunking)
+        if start_id is not None:
+            payload["start_id"] = start_id
+        return self._request(
+            "POST", f"/v1/collections/{collection}/documents/ingest", json=payload
         )
 
     def get_document(self, collection: str, doc_id: str) -> Dict[str, Any]:
@@ -176,11 +290,17 @@ class OasisDBClient:
 
     # Index building ----------------------------------------------------
     def build_index(
-        self, collection: str, documents: Iterable[Mapping[str, Any]]
-    ) -> None:
-        self._request(
+        self,
+        collection: str,
+        documents: Iterable[Mapping[str, Any]],
+        *,
+        dry_run: bool = False,
+        skip_embedding: bool = False,
+    ) -> Optional[Dict[str, Any]]:
+        return self._request(
             "POST",
-            f"/v1/collections/{collection}/buildindex",
+            f"/v1/collections/{collection}/buildindex"
+            + _dry_run_query(dry_run, skip_embedding),
             json={"documents": list(documents)},
         )
 
@@ -212,27 +332,280 @@ class OasisDBClient:
         vector: Sequence[float],
         *,
         limit: int = 10,
+        offset: int = 0,
+        max_distance: Optional[float] = None,
+        params: Optional[Mapping[str, Any]] = None,
+        rerank_exact: bool = False,
+        binary: bool = False,
+        debug: bool = False,
     ) -> Dict[str, Any]:
-        payload = {"vector": list(vector), "limit": limit}
-        return self._request(
-            "POST", f"/v1/collections/{collection}/vectors/search", json=payload
-        )
+        payload: MutableMapping[str, Any] = {"limit": limit}
+        if offset:
+            payload["offset"] = offset
+        if max_distance is not None:
+            payload["max_distance"] = max_distance
+        if params:
+            payload["params"] = dict(params)
+        if rerank_exact:
+            payload["rerank_exact"] = True
+        path = f"/v1/collections/{collection}/vectors/search"
+        if debug:
+            path += "?debug=true"
+        if binary:
+            return self._post_binary(path, payload, [vector])
+        payload["vector"] = list(vector)
+        return self._request("POST", path, json=payload)
 
     def search_documents(
         self,
         collection: str,
-        vector: Sequence[float],
+        vector: Optional[Sequence[float]] = None,
+        *,
+        query_text: Optional[str] = None,
+        limit: int = 10,
+        filter: Optional[Mapping[str, Any]] = None,
+        rerank: Optional[Mapping[str, Any]] = None,
+        offset: int = 0,
+        max_distance: Optional[float] = None,
+        params: Optional[Mapping[str, Any]] = None,
+        rerank_exact: bool = False,
+        binary: bool = False,
+        debug: bool = False,
+    ) -> Dict[str, Any]:
+        payload: MutableMapping[str, Any] = {"limit": limit}
+        if offset:
+            payload["offset"] = offset
+        if vector is not None and not binary:
+            payload["vector"] = list(vector)
+        if query_text is not None:
+            payload["query_text"] = query_text
+        if filter:
+            payload["filter"] = filter
+        if rerank:
+            payload["rerank"] = dict(rerank)
+        if max_distance is not None:
+            payload["max_distance"] = max_distance
+        if params:
+            payload["params"] = dict(params)
+        if rerank_exact:
+            payload["rerank_exact"] = True
+        path = f"/v1/collections/{collection}/documents/search"
+        if debug:
+            path += "?debug=true"
+        if binary and vector is not None:
+            return self._post_binary(path, payload, [vector])
+        return self._request("POST", path, json=payload)
+
+    def search_multi(
+        self,
+        collections: Sequence[Union[str, Mapping[str, Any]]],
+        vector: Optional[Sequence[float]] = None,
         *,
+        query_text: Optional[str] = None,
         limit: int = 10,
+        offset: int = 0,
         filter: Optional[Mapping[str, Any]] = None,
     ) -> Dict[str, Any]:
-        payload: MutableMapping[str, Any] = {"vector": list(vector), "limit": limit}
+        payload: MutableMapping[str, Any] = {
+            "collections": [
+                {"name": c} if isinstance(c, str) else dict(c) for c in collections
+            ],
+            "limit": limit,
+        }
+        if offset:
+            payload["offset"] = offset
+        if vector is not None:
+            payload["vector"] = list(vector)
+        if query_text is not None:
+            payload["query_text"] = query_text
         if filter:
             payload["filter"] = filter
+        return self._request("POST", "/v1/search/multi", json=payload)
+
+    def archive_documents(
+        self, collection: str, *, unread_days: Optional[int] = None
+    ) -> Dict[str, Any]:
+        payload = {"unread_days": unread_days} if unread_days else None
+        return self._request(
+            "POST", f"/v1/collections/{collection}/archive", json=payload
+        )
+
+    def restore_document(self, collection: str, doc_id: str) -> None:
+        self._request(
+            "POST", f"/v1/collections/{collection}/documents/{doc_id}/restore"
+        )
+
+    def rebuild_index(self, collection: str) -> Dict[str, Any]:
+        return self._request("POST", f"/v1/collections/{collection}/rebuild")
+
+    def clone_collection(
+        self,
+        collection: str,
+        target: str,
+        *,
+        index_type: Optional[str] = None,
+        index_params: Optional[Mapping[str, Any]] = None,
+    ) -> Dict[str, Any]:
+        """Copy the documents of *collection* into a new collection *target*,
+        optionally with another index type or parameters."""
+        payload: Dict[str, Any] = {"target": target}
+        if index_type is not None:
+            payload["index_type"] = index_type
+        if index_params is not None:
+            payload["index_params"] = dict(index_params)
+        return self._request(
+            "POST", f"/v1/collections/{collection}/clone", json=payload
+        )
+
+    def reindex(
+        self,
+        collection: str,
+        *,
+        index_type: Optional[str] = None,
+        parameters: Optional[Mapping[str, Any]] = None,
+    ) -> Dict[str, Any]:
+        """Rebuild the index of *collection* in the background, optionally
+        with another index type or parameters."""
+        payload: Dict[str, Any] = {}
+        if index_type is not None:
+            payload["index_type"] = index_type
+        if parameters is not None:
+            payload["parameters"] = dict(parameters)
+        return self._request(
+            "POST", f"/v1/collections/{collection}/reindex", json=payload
+        )
+
+    def reindex_status(self, collection: str) -> Dict[str, Any]:
+        return self._request("GET", f"/v1/collections/{collection}/reindex")
+
+    def list_jobs(self, collection: Optional[str] = None) -> Dict[str, Any]:
+        """Return the running index builds and the last finished ones."""
+        params: Dict[str, Any] = {}
+        if collection:
+            params["collection"] = collection
+        return self._request("GET", "/v1/jobs", params=params)
+
+    def vacuum(self, collection: str) -> Dict[str, Any]:
+        return self._request("POST", f"/v1/collections/{collection}/vacuum")
+
+    def scroll_documents(
+        self,
+        collection: str,
+        *,
+        filter: Optional[Mapping[str, Any]] = None,
+        size: Optional[int] = None,
+        cursor: Optional[str] = None,
+        keep_alive_seconds: Optional[int] = None,
+        snapshot: bool = False,
+    ) -> Dict[str, Any]:
+        payload: Dict[str, Any] = {}
+        if filter:
+            payload["filter"] = dict(filter)
+        if size:
+            payload["size"] = size
+        if cursor:
+            payload["cursor"] = cursor
+        if keep_alive_seconds:
+            payload["keep_alive_seconds"] = keep_alive_seconds
+        if snapshot:
+            payload["snapshot"] = True
+        return self._request(
+            "POST", f"/v1/collections/{collection}/scroll", json=payload
+        )
+
+    def iter_documents(
+        self,
+        collection: str,
+        *,
+        filter: Optional[Mapping[str, Any]] = None,
+        size: Optional[int] = None,
+        snapshot: bool = False,
+    ) -> Iterator[Dict[str, Any]]:
+        page = self.scroll_documents(
+            collection, filter=filter, size=size, snapshot=snapshot
+        )
+        while True:
+            yield from page.get("documents", [])
+            if not page.get("cursor"):
+                return
+            page = self.scroll_documents(collection, cursor=page["cursor"], size=size)
+
+    def export_documents(
+        self,
+        collection: str,
+        *,
+        filter: Optional[Mapping[str, Any]] = None,
+        cursor: Optional[str] = None,
+    ) -> Iterator[Dict[str, Any]]:
+        """Stream the documents of a collection, gzip compressed on the wire.
+
+        Pass the ID of the last document received as *cursor* to resume.
+        """
+        params: Dict[str, Any] = {}
+        if filter:
+            params["filter"] = json.dumps(dict(filter))
+        if cursor:
+            params["cursor"] = cursor
+        headers = {"X-Tenant": self.tenant} if self.tenant else {}
+        with self.session.get(
+            self._url(f"/v1/collections/{collection}/export"),
+            params=params,
+            headers=headers,
+            stream=True,
+            timeout=self._timeout,
+        ) as response:
+            if response.status_code >= 400:
+                raise OasisDBError(response.status_code, response.text)
+            for line in response.iter_lines():
+                if line:
+                    yield json.loads(line)
+
+    def list_document_ids(
+        self,
+        collection: str,
+        *,
+        limit: Optional[int] = None,
+        cursor: Optional[str] = None,
+    ) -> Dict[str, Any]:
+        """Return a page of document IDs, pass its "cursor" to get the next one."""
+        params: Dict[str, Any] = {}
+        if limit:
+            params["limit"] = limit
+        if cursor:
+            params["cursor"] = cursor
+        return self._request("GET", f"/v1/collections/{collection}/ids", params=params)
+
+    def list_clusters(self, collection: str, *, samples: int = 5) -> Dict[str, Any]:
         return self._request(
-            "POST", f"/v1/collections/{collection}/documents/search", json=payload
+            "GET",
+            f"/v1/collections/{collection}/clusters",
+            params={"samples": samples},
         )
 
+    def collection_usage(self, collection: str) -> Dict[str, Any]:
+        return self._request("GET", f"/v1/collections/{collection}/usage")
+
+    def server_stats(self) -> Dict[str, Any]:
+        return self._request("GET", "/v1/stats")
+
+    # Admin -------------------------------------------------------------
+    def warmup(self, *, searches: int = 0) -> Dict[str, Any]:
+        payload = {"searches": searches} if searches else None
+        return self._request("POST", "/v1/admin/warmup", json=payload)
+
+    def compact(self, *, level: Optional[int] = None) -> Dict[str, Any]:
+        params = {"level": level} if level is not None else None
+        return self._request("POST", "/v1/admin/compact", params=params)
+
+    def compaction_status(self) -> Dict[str, Any]:
+        return self._request("GET", "/v1/admin/compaction/status")
+
+    def watch_status(self) -> Dict[str, Any]:
+        return self._request("GET", "/v1/admin/watch/status")
+
+    def reload_config(self) -> Dict[str, Any]:
+        return self._request("POST", "/v1/admin/reload")
+
     # ------------------------------------------------------------------
     # Helpers
     # ------------------------------------------------------------------
@@ -0,0 +1,217 @@
+"""LangChain vector store backed by OasisDB
+
+Example
+-------
+>>> from client import OasisDBClient
+>>> from langchain_oasisdb import OasisDBVectorStore
+>>> store = OasisDBVectorStore(OasisDBClient(), "docs", embedding=embeddings)
+>>> store.add_texts(["OasisDB is a vector database"], [{"source": "readme"}])
+>>> store.similarity_search("what is OasisDB?", k=4, filter={"source": "readme"})
+
+Texts are stored in the ``text`` parameter of their document and metadata in
+the other parameters. Without an ``embedding`` the server's embedding provider
+embeds the texts and queries.
+
+Filters use the LangChain syntax, ``{"source": "readme"}`` or
+``{"source": {"$eq": "readme"}}`` combined with ``{"$and": [...]}``. The server
+only matches equal values, other operators raise ``ValueError``.
+"""
+
+from __future__ import annotations
+
+import uuid
+from typing import Any, Iterable, List, Mapping, Optional, Sequence, Tuple
+
+from langchain_core.documents import Document
+from langchain_core.embeddings import Embeddings
+from langchain_core.vectorstores import VectorStore
+
+from client import OasisDBClient, OasisDBError
+
+__all__ = ["OasisDBVectorStore", "translate_filter"]
+
+TEXT_KEY = "text"
+# flags a document for server side embedding of its text
+EMBEDDING_KEY = "embedding"
+
+
+def translate_filter(filter: Optional[Mapping[str, Any]]) -> Optional[dict]:
+    """Convert a LangChain metadata filter to the server's filter, a mapping of
+    parameters to the values they must equal."""
+    if not filter:
+        return None
+    translated: dict = {}
+    _translate_filter(filter, translated)
+    return translated
+
+
+def _translate_filter(filter: Mapping[str, Any], into: dict) -> None:
+    for key, value in filter.items():
+        if key == "$and":
+            if not isinstance(value, (list, tuple)):
+                raise ValueError(f"$and takes a list of filters, got {value!r}")
+            for condition in value:
+                if not isinstance(condition, Mapping):
+                    raise ValueError(f"$and takes a list of filters, got {condition!r}")
+                _translate_filter(condition, into)
+            continue
+        if key.startswith("$"):
+            raise ValueError(f"filter operator {key} is not supported, only equality and $and are")
+        if isinstance(value, Mapping):
+            for operator, operand in value.items():
+                if operator != "$eq":
+                    raise ValueError(f"filter operator {operator} on {key} is not supported, only $eq is")
+                value = operand
+        if key in into and into[key] != value:
+            raise ValueError(f"filter requires {key} to equal both {into[key]!r} and {value!r}")
+        into[key] = value
+
+
+def _to_document(doc: Mapping[str, Any]) -> Tuple[Document, float]:
+    metadata = dict(doc.get("parameters") or {})
+    text = metadata.pop(TEXT_KEY, "")
+    metadata.pop(EMBEDDING_KEY, None)
+    return Document(id=doc.get("id"), page_content=text, metadata=metadata), doc.get("distance", 0.0)
+
+
+class OasisDBVectorStore(VectorStore):
+    """LangChain ``VectorStore`` on an existing OasisDB collection."""
+
+    def __init__(
+        self,
+        client: OasisDBClient,
+        collection: str,
+        embedding: Optional[Embeddings] = None,
+    ):
+        self._client = client
+        self._collection = collection
+        self._embedding = embedding
+
+    @property
+    def embeddings(self) -> Optional[Embeddings]:
+        return self._embedding
+
+    def add_texts(
+        self,
+        texts: Iterable[str],
+        metadatas: Optional[List[dict]] = None,
+        *,
+        ids: Optional[List[str]] = None,
+        **kwargs: Any,
+    ) -> List[str]:
+        texts = list(texts)
+        if metadatas is not None and len(metadatas) != len(texts):
+            raise ValueError(f"got {len(metadatas)} metadatas for {len(texts)} texts")
+        if ids is not None and len(ids) != len(texts):
+            raise ValueError(f"got {len(ids)} ids for {len(texts)} texts")
+        if not texts:
+            return []
+
+        vectors = self._embedding.embed_documents(texts) if self._embedding else None
+        stored = [(ids[i] if ids and ids[i] else str(uuid.uuid4())) for i in range(len(texts))]
+        documents = []
+        for i, text in enumerate(texts):
+            parameters = dict(metadatas[i] if metadatas else {})
+            parameters[TEXT_KEY] = text
+            if vectors is None:
+                parameters[EMBEDDING_KEY] = True
+            documents.append(
+                {
+                    "id": stored[i],
+                    "vector": list(vectors[i]) if vectors is not None else [],
+                    "parameters": parameters,
+                }
+            )
+        self._client.batch_upsert_documents(self._collection, documents)
+        return stored
+
+    def delete(self, ids: Optional[List[str]] = None, **kwargs: Any) -> Optional[bool]:
+        """Delete the documents with the given *ids*, missing ones are ignored."""
+        if ids is None:
+            raise ValueError("ids are required to delete documents")
+        for doc_id in ids:
+            try:
+                self._client.delete_document(self._collection, doc_id)
+            except OasisDBError as e:
+                if e.status_code != 404:
+                    raise
+        return True
+
+    def get_by_ids(self, ids: Sequence[str], /) -> List[Document]:
+        documents = []
+        for doc_id in ids:
+            try:
+                doc = self._client.get_document(self._collection, doc_id)
+            except OasisDBError as e:
+                if e.status_code == 404:
+                    continue
+                raise
+            documents.append(_to_document(doc)[0])
+        return documents
+
+    def similarity_search(
+        self,
+        query: str,
+        k: int = 4,
+        filter: Optional[Mapping[str, Any]] = None,
+        **kwargs: Any,
+    ) -> List[Document]:
+        return [doc for doc, _ in self.similarity_search_with_score(query, k, filter, **kwargs)]
+
+    def similarity_search_with_score(
+        self,
+        query: str,
+        k: int = 4,
+        filter: Optional[Mapping[str, Any]] = None,
+        **kwargs: Any,
+    ) -> List[Tuple[Document, float]]:
+        """Return the *k* nearest documents with their distance to *query*."""
+        if self._embedding is None:
+            result = self._client.search_documents(
+                self._collection, query_text=query, limit=k, filter=translate_filter(filter)
+            )
+            return [_to_document(doc) for doc in result.get("documents", [])]
+        return self.similarity_search_by_vector_with_score(
+            self._embedding.embed_query(query), k, filter
+        )
+
+    def similarity_search_by_vector(
+        self,
+        embedding: List[float],
+        k: int = 4,
+        filter: Optional[Mapping[str, Any]] = None,
+        **kwargs: Any,
+    ) -> List[Document]:
+        return [doc for doc, _ in self.similarity_search_by_vector_with_score(embedding, k, filter)]
+
+    def similarity_search_by_vector_with_score(
+        self,
+        embedding: List[float],
+        k: int = 4,
+        filter: Optional[Mapping[str, Any]] = None,
+    ) -> List[Tuple[Document, float]]:
+        result = self._client.search_documents(
+            self._collection, list(embedding), limit=k, filter=translate_filter(filter)
+        )
+        return [_to_document(doc) for doc in result.get("documents", [])]
+
+    def _select_relevance_score_fn(self):
+        # smaller distances are more relevant whatever the collection's metric
+        return lambda distance: 1.0 / (1.0 + distance)
+
+    @classmethod
+    def from_texts(
+        cls,
+        texts: List[str],
+        embedding: Optional[Embeddings],
+        metadatas: Optional[List[dict]] = None,
+        *,
+        client: Optional[OasisDBClient] = None,
+        collection: str = "langchain",
+        ids: Optional[List[str]] = None,
+        **kwargs: Any,
+    ) -> "OasisDBVectorStore":
+        """Store *texts* in *collection*, which must exist."""
+        store = cls(client or OasisDBClient(), collection, embedding)
+        store.add_texts(texts, metadatas, ids=ids)
+        return store
@@ -0,0 +1,156 @@
+"""LlamaIndex vector store backed by OasisDB
+
+Example
+-------
+>>> from llama_index.core import StorageContext, VectorStoreIndex
+>>> from client import OasisDBClient
+>>> from llama_index_oasisdb import OasisDBVectorStore
+>>> store = OasisDBVectorStore(client=OasisDBClient(), collection="docs")
+>>> index = VectorStoreIndex.from_documents(
+...     documents, storage_context=StorageContext.from_defaults(vector_store=store)
+... )
+
+Nodes are stored as documents holding their text in the ``text`` parameter
+and their metadata, node content and ``ref_doc_id`` in the other parameters.
+Nodes without an embedding are embedded by the server's embedding provider,
+as are queries without one.
+
+Metadata filters must combine ``FilterOperator.EQ`` filters with
+``FilterCondition.AND``, the server only matches equal values. Other filters
+raise ``ValueError``.
+"""
+
+from __future__ import annotations
+
+from typing import Any, List, Optional
+
+from llama_index.core.bridge.pydantic import PrivateAttr
+from llama_index.core.schema import BaseNode, MetadataMode, TextNode
+from llama_index.core.vector_stores.types import (
+    BasePydanticVectorStore,
+    FilterCondition,
+    FilterOperator,
+    MetadataFilters,
+    VectorStoreQuery,
+    VectorStoreQueryResult,
+)
+from llama_index.core.vector_stores.utils import (
+    metadata_dict_to_node,
+    node_to_metadata_dict,
+)
+
+from client import OasisDBClient, OasisDBError
+
+__all__ = ["OasisDBVectorStore", "translate_filters"]
+
+TEXT_KEY = "text"
+# flags a document for server side embedding of its text
+EMBEDDING_KEY = "embedding"
+
+
+def translate_filters(filters: Optional[MetadataFilters]) -> Optional[dict]:
+    """Convert LlamaIndex metadata filters to the server's filter, a mapping
+    of parameters to the values they must equal."""
+    if filters is None or not filters.filters:
+        return None
+    translated: dict = {}
+    _translate_filters(filters, translated)
+    return translated
+
+
+def _translate_filters(filters: MetadataFilters, into: dict) -> None:
+    if len(filters.filters) > 1 and filters.condition != FilterCondition.AND:
+        raise ValueError(f"filter condition {filters.condition} is not supported, only AND is")
+    for f in filters.filters:
+        if isinstance(f, MetadataFilters):
+            _translate_filters(f, into)
+            continue
+        if f.operator != FilterOperator.EQ:
+            raise ValueError(f"filter operator {f.operator} on {f.key} is not supported, only EQ is")
+        if f.key in into and into[f.key] != f.value:
+            raise ValueError(f"filter requires {f.key} to equal both {into[f.key]!r} and {f.value!r}")
+        into[f.key] = f.value
+
+
+def _to_node(doc: dict) -> BaseNode:
+    parameters = dict(doc.get("parameters") or {})
+    text = parameters.pop(TEXT_KEY, "")
+    parameters.pop(EMBEDDING_KEY, None)
+    try:
+        node = metadata_dict_to_node(parameters)
+        node.set_content(text)
+    except Exception:
+        # a document written without LlamaIndex
+        node = TextNode(id_=doc["id"], text=text, metadata=parameters)
+    return node
+
+
+class OasisDBVectorStore(BasePydanticVectorStore):
+    """LlamaIndex vector store on an existing OasisDB collection."""
+
+    stores_text: bool = True
+    flat_metadata: bool = False
+
+    collection: str
+    _client: OasisDBClient = PrivateAttr()
+
+    def __init__(self, client: Optional[OasisDBClient] = None, collection: str = "llama_index", **kwargs: Any):
+        super().__init__(collection=collection, **kwargs)
+        self._client = client or OasisDBClient()
+
+    @classmethod
+    def class_name(cls) -> str:
+        return "OasisDBVectorStore"
+
+    @property
+    def client(self) -> OasisDBClient:
+        return self._client
+
+    def add(self, nodes: List[BaseNode], **add_kwargs: Any) -> List[str]:
+        documents = []
+        for node in nodes:
+            parameters = node_to_metadata_dict(node, remove_text=True, flat_metadata=self.flat_metadata)
+            parameters[TEXT_KEY] = node.get_content(metadata_mode=MetadataMode.NONE)
+            vector = node.embedding
+            if vector is None:
+                parameters[EMBEDDING_KEY] = True
+            documents.append({"id": node.node_id, "vector": list(vector or []), "parameters": parameters})
+        if documents:
+            self._client.batch_upsert_documents(self.collection, documents)
+        return [node.node_id for node in nodes]
+
+    def delete(self, ref_doc_id: str, **delete_kwargs: Any) -> None:
+        """Delete the nodes of the document *ref_doc_id*."""
+        ids = [
+            doc["id"]
+            for doc in self._client.iter_documents(self.collection, filter={"ref_doc_id": ref_doc_id})
+        ]
+        for doc_id in ids:
+            try:
+                self._client.delete_document(self.collection, doc_id)
+            except OasisDBError as e:
+                if e.status_code != 404:
+                    raise
+
+    def query(self, query: VectorStoreQuery, **kwargs: Any) -> VectorStoreQueryResult:
+        if query.doc_ids or query.node_ids:
+            raise ValueError("querying by doc_ids or node_ids is not supported")
+        filter = translate_filters(query.filters)
+        if query.query_embedding is not None:
+            result = self._client.search_documents(
+                self.collection, list(query.query_embedding), limit=query.similarity_top_k, filter=filter
+            )
+        elif query.query_str:
+            result = self._client.search_documents(
+                self.collection, query_text=query.query_str, limit=query.similarity_top_k, filter=filter
+            )
+        else:
+            raise ValueError("query needs a query_embedding or a query_str")
+
+        documents = result.get("documents", [])
+        return VectorStoreQueryResult(
+            nodes=[_to_node(doc) for doc in documents],
+            # smaller distances are more similar whatever the collection's metric
+            similarities=[1.0 / (1.0 + doc.get("distance", 0.0)) for doc in documents],
+            ids=[doc["id"] for doc in documents],
+        )
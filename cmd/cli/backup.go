@@ -0,0 +1,313 @@
+package main
+
+import (
+	"bufio"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/url"
+	"os"
+	"path"
+	"time"
+
+	oasisdb "oasisdb/client-sdk/Go"
+
+	"github.com/spf13/cobra"
+)
+
+// manifestFile lists the collections of a backup directory
+const manifestFile = "manifest.json"
+
+// backupManifest describes a backup, restore checks the files against it
+// before writing anything
+type backupManifest struct {
+	Version     int                `json:"version"`
+	CreatedAt   time.Time          `json:"created_at"`
+	Tenant      string             `json:"tenant,omitempty"`
+	Collections []backupCollection `json:"collections"`
+}
+
+// backupCollection is a collection of a backup, its documents are the NDJSON
+// lines of File as of the write sequence Seq
+type backupCollection struct {
+	Name      string         `json:"name"`
+	Options   map[string]any `json:"options"` // create request without the name
+	File      string         `json:"file"`
+	Documents int            `json:"documents"`
+	Seq       uint64         `json:"seq"`
+	SHA256    string         `json:"sha256"`
+}
+
+// collectionOptions returns the create request of a collection described by
+// GET /v1/collections/:name
+func collectionOptions(info map[string]any) map[string]any {
+	options := map[string]any{"dimension": info["dimension"]}
+	if index, ok := info["index"].(map[string]any); ok {
+		options["index_type"] = index["type"]
+	}
+	// the metadata holds the index parameters and the declared schema
+	if metadata, ok := info["metadata"].(map[string]any); ok {
+		parameters := make(map[string]any, len(metadata))
+		for k, v := range metadata {
+			if k != "schema" {
+				parameters[k] = v
+			}
+		}
+		options["parameters"] = parameters
+	}
+	for _, key := range []string{"default_filter", "store_vectors", "normalize", "schema", "cache", "dedup_threshold", "dedup_mode"} {
+		if v, ok := info[key]; ok && v != nil {
+			options[key] = v
+		}
+	}
+	return options
+}
+
+// backupCollectionTo writes the documents of a collection as of a snapshot to
+// file, writes made meanwhile are left out
+func backupCollectionTo(client *oasisdb.OasisDBClient, name, file string, pageSize int) (*backupCollection, error) {
+	info, err := client.GetCollection(name)
+	if err != nil {
+		return nil, err
+	}
+	f, err := os.Create(file)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	hash := sha256.New()
+	w := bufio.NewWriter(io.MultiWriter(f, hash))
+	enc := json.NewEncoder(w)
+
+	backup := &backupCollection{Name: name, Options: collectionOptions(info), File: path.Base(file)}
+	cursor := ""
+	for {
+		page, err := client.ScrollDocumentsSnapshot(name, pageSize, cursor)
+		if err != nil {
+			return nil, err
+		}
+		if seq, ok := page["seq"].(float64); ok && cursor == "" {
+			backup.Seq = uint64(seq)
+		}
+		docs, _ := page["documents"].([]any)
+		for _, d := range docs {
+			doc, _ := d.(map[string]any)
+			if err := enc.Encode(map[string]any{
+				"id":         doc["id"],
+				"vector":     doc["vector"],
+				"parameters": doc["parameters"],
+			}); err != nil {
+				return nil, err
+			}
+			backup.Documents++
+		}
+		cursor, _ = page["cursor"].(string)
+		if cursor == "" {
+			break
+		}
+	}
+	if err := w.Flush(); err != nil {
+		return nil, err
+	}
+	if err := f.Sync(); err != nil {
+		return nil, err
+	}
+	backup.SHA256 = hex.EncodeToString(hash.Sum(nil))
+	return backup, nil
+}
+
+func newBackupCmd(opts *options) *cobra.Command {
+	var (
+		out      string
+		pageSize int
+	)
+	cmd := &cobra.Command{
+		Use:   "backup [collection...]",
+		Short: "Back up collections of a running server to a directory",
+		Long: "backup writes the settings and documents of the given collections, all of\n" +
+			"them by default, to --out. Each collection is read from a snapshot taken\n" +
+			"when its backup starts, so writes may continue meanwhile. manifest.json\n" +
+			"records the write sequence of every snapshot and the checksums restore\n" +
+			"verifies.",
+		RunE: func(cmd *cobra.Command, args []string) error {
+			if out == "" {
+				return fmt.Errorf("--out is required")
+			}
+			if _, err := os.Stat(path.Join(out, manifestFile)); err == nil {
+				return fmt.Errorf("%s already holds a backup", out)
+			}
+			if err := os.MkdirAll(out, 0755); err != nil {
+				return err
+			}
+			client := opts.client()
+			names := args
+			if len(names) == 0 {
+				var err error
+				if names, err = client.ListCollections(); err != nil {
+					return err
+				}
+			}
+
+			manifest := backupManifest{Version: 1, CreatedAt: time.Now().UTC(), Tenant: opts.tenant}
+			for _, name := range names {
+				file := path.Join(out, url.PathEscape(name)+".ndjson")
+				backup, err := backupCollectionTo(client, name, file, pageSize)
+				if err != nil {
+					return fmt.Errorf("failed to back up %s: %w", name, err)
+				}
+				manifest.Collections = append(manifest.Collections, *backup)
+				fmt.Fprintf(cmd.OutOrStdout(), "Backed up %d documents of %s at seq %d\n", backup.Documents, name, backup.Seq)
+			}
+
+			// the manifest is written last, a directory without one is incomplete
+			data, err := json.MarshalIndent(manifest, "", "  ")
+			if err != nil {
+				return err
+			}
+			tmp := path.Join(out, manifestFile+".tmp")
+			if err := os.WriteFile(tmp, data, 0644); err != nil {
+				return err
+			}
+			return os.Rename(tmp, path.Join(out, manifestFile))
+		},
+	}
+	cmd.Flags().StringVar(&out, "out", "", "directory to write the backup to")
+	cmd.Flags().IntVar(&pageSize, "page-size", 500, "documents fetched per scroll request")
+	return cmd
+}
+
+// verifyBackup checks the files of a backup against its manifest
+func verifyBackup(dir string, manifest *backupManifest) error {
+	for _, c := range manifest.Collections {
+		f, err := os.Open(path.Join(dir, c.File))
+		if err != nil {
+			return err
+		}
+		hash := sha256.New()
+		lines := 0
+		scanner := bufio.NewScanner(io.TeeReader(f, hash))
+		scanner.Buffer(make([]byte, 0, 64*1024), 64*1024*1024)
+		for scanner.Scan() {
+			lines++
+		}
+		err = scanner.Err()
+		f.Close()
+		if err != nil {
+			return fmt.Errorf("failed to read %s: %w", c.File, err)
+		}
+		if sum := hex.EncodeToString(hash.Sum(nil)); sum != c.SHA256 {
+			return fmt.Errorf("checksum mismatch for %s: expected %s, got %s", c.File, c.SHA256, sum)
+		}
+		if lines != c.Documents {
+			return fmt.Errorf("%s holds %d documents, expected %d", c.File, lines, c.Documents)
+		}
+	}
+	return nil
+}
+
+func newRestoreCmd(opts *options) *cobra.Command {
+	var (
+		in        string
+		batchSize int
+	)
+	cmd := &cobra.Command{
+		Use:   "restore",
+		Short: "Restore the collections of a backup directory into a server",
+		Long: "restore verifies the checksums of every file of the backup in --in, then\n" +
+			"creates its collections and upserts their documents. Collections that\n" +
+			"exist already are not overwritten, delete them first.",
+		Args: cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			if in == "" {
+				return fmt.Errorf("--in is required")
+			}
+			if batchSize <= 0 {
+				return fmt.Errorf("--batch-size must be positive")
+			}
+			data, err := os.ReadFile(path.Join(in, manifestFile))
+			if err != nil {
+				return err
+			}
+			var manifest backupManifest
+			if err := json.Unmarshal(data, &manifest); err != nil {
+				return fmt.Errorf("invalid %s: %w", manifestFile, err)
+			}
+			if manifest.Version != 1 {
+				return fmt.Errorf("unsupported backup version %d", manifest.Version)
+			}
+			if err := verifyBackup(in, &manifest); err != nil {
+				return err
+			}
+
+			client := opts.client()
+			existing, err := client.ListCollections()
+			if err != nil {
+				return err
+			}
+			for _, c := range manifest.Collections {
+				for _, name := range existing {
+					if name == c.Name {
+						return fmt.Errorf("collection %s already exists", c.Name)
+					}
+				}
+			}
+
+			for _, c := range manifest.Collections {
+				if _, err := client.CreateCollectionWithOptions(c.Name, c.Options); err != nil {
+					return fmt.Errorf("failed to create %s: %w", c.Name, err)
+				}
+				total, err := restoreDocuments(client, c.Name, path.Join(in, c.File), batchSize)
+				if err != nil {
+					return fmt.Errorf("failed to restore %s: %w", c.Name, err)
+				}
+				fmt.Fprintf(cmd.OutOrStdout(), "Restored %d documents of %s\n", total, c.Name)
+			}
+			return nil
+		},
+	}
+	cmd.Flags().StringVar(&in, "in", "", "directory holding the backup")
+	cmd.Flags().IntVar(&batchSize, "batch-size", 500, "documents per batch upsert")
+	return cmd
+}
+
+// restoreDocuments batch upserts the documents of a backup file
+func restoreDocuments(client *oasisdb.OasisDBClient, collection, file string, batchSize int) (int, error) {
+	f, err := os.Open(file)
+	if err != nil {
+		return 0, err
+	}
+	defer f.Close()
+	reader := newNDJSONReader(f)
+
+	total := 0
+	batch := make([]map[string]any, 0, batchSize)
+	flush := func() error {
+		if len(batch) == 0 {
+			return nil
+		}
+		if err := client.BatchUpsertDocuments(collection, batch); err != nil {
+			return fmt.Errorf("failed to upsert documents %d-%d: %w", total+1, total+len(batch), err)
+		}
+		total += len(batch)
+		batch = batch[:0]
+		return nil
+	}
+	for {
+		doc, err := reader.next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return total, err
+		}
+		batch = append(batch, doc)
+		if len(batch) == batchSize {
+			if err := flush(); err != nil {
+				return total, err
+			}
+		}
+	}
+	return total, flush()
+}
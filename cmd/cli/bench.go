@@ -0,0 +1,106 @@
+package main
+
+import (
+	"fmt"
+	"math/rand"
+	"slices"
+	"strconv"
+	"time"
+
+	"github.com/spf13/cobra"
+)
+
+func newBenchCmd(opts *options) *cobra.Command {
+	var (
+		dimension int
+		indexType string
+		docs      int
+		queries   int
+		batchSize int
+		limit     int
+		keep      bool
+	)
+	cmd := &cobra.Command{
+		Use:   "bench [collection]",
+		Short: "Measure upsert throughput and search latency on a scratch collection",
+		Long: "bench creates a collection, upserts random vectors in batches, runs random\n" +
+			"searches and reports the timings. The collection is deleted afterwards unless\n" +
+			"--keep is given.",
+		Args: cobra.MaximumNArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			if dimension <= 0 || docs <= 0 || batchSize <= 0 {
+				return fmt.Errorf("--dim, --docs and --batch-size must be positive")
+			}
+			name := fmt.Sprintf("bench_%d", time.Now().Unix())
+			if len(args) == 1 {
+				name = args[0]
+			}
+			client := opts.client()
+			out := cmd.OutOrStdout()
+
+			if _, err := client.CreateCollection(name, dimension, indexType, nil); err != nil {
+				return err
+			}
+			if !keep {
+				defer client.DeleteCollection(name)
+			}
+
+			start := time.Now()
+			for i := 0; i < docs; i += batchSize {
+				batch := make([]map[string]any, 0, batchSize)
+				for j := i; j < docs && j < i+batchSize; j++ {
+					batch = append(batch, map[string]any{
+						"id":     strconv.Itoa(j),
+						"vector": randomVector(dimension),
+					})
+				}
+				if err := client.BatchUpsertDocuments(name, batch); err != nil {
+					return err
+				}
+			}
+			elapsed := time.Since(start)
+			fmt.Fprintf(out, "upsert: %d documents in %s (%.0f docs/s)\n",
+				docs, elapsed.Round(time.Millisecond), float64(docs)/elapsed.Seconds())
+
+			if queries <= 0 {
+				return nil
+			}
+			latencies := make([]time.Duration, queries)
+			start = time.Now()
+			for i := range latencies {
+				begin := time.Now()
+				if _, err := client.SearchVectors(name, randomVector(dimension), limit); err != nil {
+					return err
+				}
+				latencies[i] = time.Since(begin)
+			}
+			elapsed = time.Since(start)
+			slices.Sort(latencies)
+			fmt.Fprintf(out, "search: %d queries in %s (%.0f qps) p50=%s p99=%s max=%s\n",
+				queries, elapsed.Round(time.Millisecond), float64(queries)/elapsed.Seconds(),
+				percentile(latencies, 0.50), percentile(latencies, 0.99), latencies[len(latencies)-1])
+			return nil
+		},
+	}
+	cmd.Flags().IntVar(&dimension, "dim", 128, "vector dimension")
+	cmd.Flags().StringVar(&indexType, "index", "hnsw", "index type: hnsw, ivf_flat or ivfpq")
+	cmd.Flags().IntVar(&docs, "docs", 10000, "documents to upsert")
+	cmd.Flags().IntVar(&queries, "queries", 1000, "searches to run")
+	cmd.Flags().IntVar(&batchSize, "batch-size", 500, "documents per batch upsert")
+	cmd.Flags().IntVar(&limit, "limit", 10, "results per search")
+	cmd.Flags().BoolVar(&keep, "keep", false, "keep the collection after the run")
+	return cmd
+}
+
+// percentile returns the p-th percentile of sorted latencies
+func percentile(sorted []time.Duration, p float64) time.Duration {
+	return sorted[int(float64(len(sorted)-1)*p)]
+}
+
+func randomVector(dim int) []float32 {
+	v := make([]float32, dim)
+	for i := range v {
+		v[i] = rand.Float32()
+	}
+	return v
+}
@@ -0,0 +1,126 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+
+	"github.com/spf13/cobra"
+)
+
+func newCollectionCmd(opts *options) *cobra.Command {
+	cmd := &cobra.Command{
+		Use:     "collection",
+		Aliases: []string{"coll"},
+		Short:   "Manage collections",
+	}
+
+	var (
+		dimension int
+		indexType string
+		params    string
+	)
+	create := &cobra.Command{
+		Use:   "create <name>",
+		Short: "Create a collection",
+		Args:  cobra.ExactArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			var parameters map[string]any
+			if params != "" {
+				if err := json.Unmarshal([]byte(params), &parameters); err != nil {
+					return fmt.Errorf("invalid --params: %w", err)
+				}
+			}
+			collection, err := opts.client().CreateCollection(args[0], dimension, indexType, parameters)
+			if err != nil {
+				return err
+			}
+			return printJSON(cmd.OutOrStdout(), collection)
+		},
+	}
+	create.Flags().IntVar(&dimension, "dim", 0, "vector dimension")
+	create.Flags().StringVar(&indexType, "index", "hnsw", "index type: hnsw, ivf_flat or ivfpq")
+	create.Flags().StringVar(&params, "params", "", `index parameters as JSON, e.g. '{"M":16}'`)
+	create.MarkFlagRequired("dim")
+
+	list := &cobra.Command{
+		Use:   "list",
+		Short: "List collections",
+		Args:  cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			names, err := opts.client().ListCollections()
+			if err != nil {
+				return err
+			}
+			for _, name := range names {
+				fmt.Fprintln(cmd.OutOrStdout(), name)
+			}
+			return nil
+		},
+	}
+
+	del := &cobra.Command{
+		Use:   "delete <name>",
+		Short: "Delete a collection and its documents",
+		Args:  cobra.ExactArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			return opts.client().DeleteCollection(args[0])
+		},
+	}
+
+	restore := &cobra.Command{
+		Use:   "restore <name>",
+		Short: "Bring back a deleted collection before it is purged",
+		Args:  cobra.ExactArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			_, err := opts.client().RestoreCollection(args[0])
+			return err
+		},
+	}
+
+	var cloneIndexType, cloneParams string
+	clone := &cobra.Command{
+		Use:   "clone <source> <target>",
+		Short: "Copy the documents of a collection into a new one",
+		Args:  cobra.ExactArgs(2),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			var parameters map[string]any
+			if cloneParams != "" {
+				if err := json.Unmarshal([]byte(cloneParams), &parameters); err != nil {
+					return fmt.Errorf("invalid --params: %w", err)
+				}
+			}
+			result, err := opts.client().CloneCollection(args[0], args[1], cloneIndexType, parameters)
+			if err != nil {
+				return err
+			}
+			return printJSON(cmd.OutOrStdout(), result)
+		},
+	}
+	clone.Flags().StringVar(&cloneIndexType, "index", "", "index type of the copy, defaults to the one of the source")
+	clone.Flags().StringVar(&cloneParams, "params", "", `index parameters of the copy as JSON, defaults to the ones of the source`)
+
+	var reindexType, reindexParams string
+	reindex := &cobra.Command{
+		Use:   "reindex <name>",
+		Short: "Rebuild the index of a collection in the background",
+		Args:  cobra.ExactArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			var parameters map[string]any
+			if reindexParams != "" {
+				if err := json.Unmarshal([]byte(reindexParams), &parameters); err != nil {
+					return fmt.Errorf("invalid --params: %w", err)
+				}
+			}
+			result, err := opts.client().Reindex(args[0], reindexType, parameters)
+			if err != nil {
+				return err
+			}
+			return printJSON(cmd.OutOrStdout(), result)
+		},
+	}
+	reindex.Flags().StringVar(&reindexType, "index", "", "new index type, defaults to the current one")
+	reindex.Flags().StringVar(&reindexParams, "params", "", `new index parameters as JSON, defaults to the current ones`)
+
+	cmd.AddCommand(create, list, del, restore, clone, reindex)
+	return cmd
+}
@@ -0,0 +1,71 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+
+	"github.com/spf13/cobra"
+)
+
+func newDocCmd(opts *options) *cobra.Command {
+	cmd := &cobra.Command{
+		Use:     "doc",
+		Aliases: []string{"document"},
+		Short:   "Manage the documents of a collection",
+	}
+
+	var (
+		vector string
+		params string
+	)
+	upsert := &cobra.Command{
+		Use:   "upsert <collection> <id>",
+		Short: "Insert or update a document",
+		Args:  cobra.ExactArgs(2),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			var v []float32
+			if err := json.Unmarshal([]byte(vector), &v); err != nil {
+				return fmt.Errorf("invalid --vector: %w", err)
+			}
+			var parameters map[string]any
+			if params != "" {
+				if err := json.Unmarshal([]byte(params), &parameters); err != nil {
+					return fmt.Errorf("invalid --params: %w", err)
+				}
+			}
+			doc, err := opts.client().UpsertDocument(args[0], args[1], v, parameters)
+			if err != nil {
+				return err
+			}
+			return printJSON(cmd.OutOrStdout(), doc)
+		},
+	}
+	upsert.Flags().StringVar(&vector, "vector", "", "vector as a JSON array, e.g. '[0.1,0.2]'")
+	upsert.Flags().StringVar(&params, "params", "", "document parameters as a JSON object")
+	upsert.MarkFlagRequired("vector")
+
+	get := &cobra.Command{
+		Use:   "get <collection> <id>",
+		Short: "Print a document",
+		Args:  cobra.ExactArgs(2),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			doc, err := opts.client().GetDocument(args[0], args[1])
+			if err != nil {
+				return err
+			}
+			return printJSON(cmd.OutOrStdout(), doc)
+		},
+	}
+
+	del := &cobra.Command{
+		Use:   "delete <collection> <id>",
+		Short: "Delete a document",
+		Args:  cobra.ExactArgs(2),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			return opts.client().DeleteDocument(args[0], args[1])
+		},
+	}
+
+	cmd.AddCommand(upsert, get, del)
+	return cmd
+}
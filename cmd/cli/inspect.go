@@ -0,0 +1,132 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"path"
+	"strconv"
+	"unicode/utf8"
+
+	"oasisdb/internal/config"
+	"oasisdb/internal/storage/sstable"
+	"oasisdb/internal/storage/wal"
+
+	"github.com/spf13/cobra"
+)
+
+func newInspectCmd() *cobra.Command {
+	var maxValue int
+	cmd := &cobra.Command{
+		Use:   "inspect",
+		Short: "Dump local storage files for debugging, the server needn't be running",
+	}
+	cmd.PersistentFlags().IntVar(&maxValue, "max-value", 200, "truncate printed values to this many bytes, 0 prints them whole")
+
+	var footerSize uint64
+	sst := &cobra.Command{
+		Use:   "sst <file.sst>",
+		Short: "Print the records and index of an SSTable",
+		Args:  cobra.ExactArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			conf := &config.Config{
+				Paths:   config.PathsConfig{SST: path.Dir(args[0])},
+				Storage: config.StorageConfig{SSTFooterSize: footerSize},
+			}
+			reader, err := sstable.NewSSTableReader(path.Base(args[0]), conf)
+			if err != nil {
+				return err
+			}
+			defer reader.Close()
+
+			records, err := reader.ReadData()
+			if err != nil {
+				return fmt.Errorf("failed to read data blocks: %w", err)
+			}
+			index, err := reader.ReadIndex()
+			if err != nil {
+				return fmt.Errorf("failed to read index block: %w", err)
+			}
+
+			out := cmd.OutOrStdout()
+			for _, kv := range records {
+				fmt.Fprintf(out, "%s\t%s\n", formatBytes(kv.Key, 0), formatValue(kv.Value, maxValue))
+			}
+			// the first index entry precedes the first block and is empty
+			var blocks []*sstable.IndexEntry
+			for _, entry := range index {
+				if entry.PrevSize > 0 {
+					blocks = append(blocks, entry)
+				}
+			}
+			fmt.Fprintf(out, "# %d records, %d data blocks\n", len(records), len(blocks))
+			for i, entry := range blocks {
+				fmt.Fprintf(out, "# block %d: offset=%d size=%d separator=%s\n",
+					i, entry.PrevOffset, entry.PrevSize, formatBytes(entry.Key, 0))
+			}
+			return nil
+		},
+	}
+	sst.Flags().Uint64Var(&footerSize, "footer-size", config.DefaultSSTFooterSize, "sst_footer_size the file was written with")
+
+	walCmd := &cobra.Command{
+		Use:   "wal <file.wal>",
+		Short: "Print the records of a WAL file in write order",
+		Args:  cobra.ExactArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			reader, err := wal.NewWALReader(args[0])
+			if err != nil {
+				return err
+			}
+			defer reader.Close()
+
+			out := cmd.OutOrStdout()
+			count := 0
+			for {
+				kv, err := reader.Next()
+				if err == io.EOF {
+					break
+				}
+				if err == io.ErrUnexpectedEOF {
+					fmt.Fprintf(out, "# torn record after record %d\n", count)
+					break
+				}
+				if err != nil {
+					return err
+				}
+				count++
+				fmt.Fprintf(out, "%s\t%s\n", formatBytes(kv.Key, 0), formatValue(kv.Value, maxValue))
+			}
+			fmt.Fprintf(out, "# %d records\n", count)
+			return nil
+		},
+	}
+
+	cmd.AddCommand(sst, walCmd)
+	return cmd
+}
+
+// formatValue prints a value, empty values are the tombstones of deletes
+func formatValue(b []byte, max int) string {
+	if len(b) == 0 {
+		return "<deleted>"
+	}
+	return formatBytes(b, max)
+}
+
+// formatBytes prints text as is and quotes binary data, longer data than max
+// is cut off
+func formatBytes(b []byte, max int) string {
+	suffix := ""
+	if max > 0 && len(b) > max {
+		suffix = fmt.Sprintf("...(%d bytes)", len(b))
+		b = b[:max]
+	}
+	s := string(b)
+	for _, r := range s {
+		if r == utf8.RuneError || r < ' ' {
+			s = strconv.Quote(s)
+			break
+		}
+	}
+	return s + suffix
+}
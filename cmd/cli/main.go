@@ -0,0 +1,68 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+
+	oasisdb "oasisdb/client-sdk/Go"
+
+	"github.com/spf13/cobra"
+)
+
+// options are the global flags shared by all subcommands
+type options struct {
+	addr   string
+	tenant string
+}
+
+// client returns an SDK client for the server and tenant given by the flags
+func (o *options) client() *oasisdb.OasisDBClient {
+	client := oasisdb.NewOasisDBClient(o.addr)
+	client.Tenant = o.tenant
+	return client
+}
+
+func newRootCmd() *cobra.Command {
+	opts := &options{}
+	root := &cobra.Command{
+		Use:           "oasisdb-cli",
+		Short:         "Administer an OasisDB server and inspect its storage files",
+		SilenceUsage:  true,
+		SilenceErrors: true,
+	}
+
+	addr := os.Getenv("OASISDB_ADDR")
+	if addr == "" {
+		addr = "http://localhost:8080"
+	}
+	root.PersistentFlags().StringVar(&opts.addr, "addr", addr, "server address, defaults to $OASISDB_ADDR")
+	root.PersistentFlags().StringVar(&opts.tenant, "tenant", "", "tenant the collections belong to")
+
+	root.AddCommand(
+		newCollectionCmd(opts),
+		newDocCmd(opts),
+		newImportCmd(opts),
+		newExportCmd(opts),
+		newBackupCmd(opts),
+		newRestoreCmd(opts),
+		newBenchCmd(opts),
+		newInspectCmd(),
+	)
+	return root
+}
+
+// printJSON writes v as indented JSON
+func printJSON(w io.Writer, v any) error {
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	return enc.Encode(v)
+}
+
+func main() {
+	if err := newRootCmd().Execute(); err != nil {
+		fmt.Fprintln(os.Stderr, "Error:", err)
+		os.Exit(1)
+	}
+}
@@ -0,0 +1,267 @@
+package main
+
+import (
+	"bytes"
+	"encoding/binary"
+	"encoding/json"
+	"net/http/httptest"
+	"os"
+	"path"
+	"strings"
+	"testing"
+
+	"oasisdb/internal/config"
+	"oasisdb/internal/db"
+	"oasisdb/internal/server"
+	"oasisdb/internal/storage/sstable"
+	"oasisdb/internal/storage/wal"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// runCLI runs the CLI with args against addr and returns its output
+func runCLI(t *testing.T, addr, stdin string, args ...string) (string, error) {
+	t.Helper()
+	cmd := newRootCmd()
+	var out bytes.Buffer
+	cmd.SetOut(&out)
+	cmd.SetErr(&out)
+	cmd.SetIn(strings.NewReader(stdin))
+	cmd.SetArgs(append([]string{"--addr", addr}, args...))
+	err := cmd.Execute()
+	return out.String(), err
+}
+
+func newTestServer(t *testing.T) string {
+	t.Helper()
+	conf, err := config.NewConfig(t.TempDir())
+	require.NoError(t, err)
+	database, err := db.New(conf)
+	require.NoError(t, err)
+	require.NoError(t, database.Open())
+	ts := httptest.NewServer(server.New(database).Handler())
+	t.Cleanup(func() {
+		ts.Close()
+		database.Close()
+	})
+	return ts.URL
+}
+
+func TestCLIAdminCommands(t *testing.T) {
+	addr := newTestServer(t)
+
+	_, err := runCLI(t, addr, "", "collection", "create", "docs", "--dim", "2", "--index", "hnsw")
+	require.NoError(t, err)
+	out, err := runCLI(t, addr, "", "collection", "list")
+	require.NoError(t, err)
+	assert.Equal(t, "docs\n", out)
+
+	input := `{"id":"1","vector":[1,0],"parameters":{"tag":"a"}}
+{"id":"2","vector":[0,1]}
+
+{"id":"3","vector":[1,1]}
+`
+	out, err = runCLI(t, addr, input, "import", "docs", "-", "--batch-size", "2")
+	require.NoError(t, err)
+	assert.Contains(t, out, "Imported 3 documents")
+
+	_, err = runCLI(t, addr, "", "doc", "upsert", "docs", "4", "--vector", "[0.5,0.5]")
+	require.NoError(t, err)
+	out, err = runCLI(t, addr, "", "doc", "get", "docs", "1")
+	require.NoError(t, err)
+	assert.Contains(t, out, `"tag": "a"`)
+	_, err = runCLI(t, addr, "", "doc", "delete", "docs", "2")
+	require.NoError(t, err)
+
+	out, err = runCLI(t, addr, "", "export", "docs", "--page-size", "1")
+	require.NoError(t, err)
+	var ids []string
+	for _, line := range strings.Split(strings.TrimSpace(out), "\n") {
+		var doc struct{ ID string }
+		require.NoError(t, json.Unmarshal([]byte(line), &doc))
+		ids = append(ids, doc.ID)
+	}
+	assert.Equal(t, []string{"1", "3", "4"}, ids)
+
+	// collections of other tenants are not visible
+	out, err = runCLI(t, addr, "", "--tenant", "acme", "collection", "list")
+	require.NoError(t, err)
+	assert.Empty(t, out)
+
+	_, err = runCLI(t, addr, "", "collection", "delete", "docs")
+	require.NoError(t, err)
+	_, err = runCLI(t, addr, "", "doc", "get", "docs", "1")
+	assert.Error(t, err)
+}
+
+func TestCLIImportExportFormats(t *testing.T) {
+	addr := newTestServer(t)
+	dir := t.TempDir()
+	for _, name := range []string{"vecs", "copy"} {
+		_, err := runCLI(t, addr, "", "collection", "create", name, "--dim", "2", "--index", "hnsw")
+		require.NoError(t, err)
+	}
+
+	// fvecs and bvecs: an int32 dimension before each vector
+	var fvecs, bvecs bytes.Buffer
+	for _, v := range [][]float32{{1, 0}, {0, 1}} {
+		binary.Write(&fvecs, binary.LittleEndian, int32(2))
+		binary.Write(&fvecs, binary.LittleEndian, v)
+		binary.Write(&bvecs, binary.LittleEndian, int32(2))
+		bvecs.Write([]byte{byte(v[0] * 3), byte(v[1] * 3)})
+	}
+	require.NoError(t, os.WriteFile(path.Join(dir, "a.fvecs"), fvecs.Bytes(), 0644))
+	require.NoError(t, os.WriteFile(path.Join(dir, "b.bvecs"), bvecs.Bytes(), 0644))
+	out, err := runCLI(t, addr, "", "import", "vecs", path.Join(dir, "a.fvecs"), "--id-start", "10")
+	require.NoError(t, err)
+	assert.Contains(t, out, "Imported 2 documents")
+	_, err = runCLI(t, addr, "", "import", "vecs", path.Join(dir, "b.bvecs"), "--id-start", "20")
+	require.NoError(t, err)
+
+	// a float64 npy array with IDs from a file
+	header := "{'descr': '<f8', 'fortran_order': False, 'shape': (2, 2), }"
+	header += strings.Repeat(" ", 63-(10+len(header))%64) + "\n"
+	var npy bytes.Buffer
+	npy.WriteString("\x93NUMPY\x01\x00")
+	binary.Write(&npy, binary.LittleEndian, uint16(len(header)))
+	npy.WriteString(header)
+	binary.Write(&npy, binary.LittleEndian, []float64{0.5, 0.5, 2, 2})
+	require.NoError(t, os.WriteFile(path.Join(dir, "c.npy"), npy.Bytes(), 0644))
+	require.NoError(t, os.WriteFile(path.Join(dir, "ids.txt"), []byte("30\n31\n"), 0644))
+	_, err = runCLI(t, addr, "", "import", "vecs", path.Join(dir, "c.npy"), "--ids", path.Join(dir, "ids.txt"))
+	require.NoError(t, err)
+	_, err = runCLI(t, addr, "", "doc", "upsert", "vecs", "40", "--vector", "[1,1]", "--params", `{"tag":"a"}`)
+	require.NoError(t, err)
+
+	// a parquet export imports into another collection unchanged
+	file := path.Join(dir, "docs.parquet")
+	_, err = runCLI(t, addr, "", "export", "vecs", "-o", file)
+	require.NoError(t, err)
+	out, err = runCLI(t, addr, "", "import", "copy", file)
+	require.NoError(t, err)
+	assert.Contains(t, out, "Imported 7 documents")
+
+	out, err = runCLI(t, addr, "", "export", "copy")
+	require.NoError(t, err)
+	assert.Equal(t, `{"id":"10","parameters":null,"vector":[1,0]}
+{"id":"11","parameters":null,"vector":[0,1]}
+{"id":"20","parameters":null,"vector":[3,0]}
+{"id":"21","parameters":null,"vector":[0,3]}
+{"id":"30","parameters":null,"vector":[0.5,0.5]}
+{"id":"31","parameters":null,"vector":[2,2]}
+{"id":"40","parameters":{"tag":"a"},"vector":[1,1]}
+`, out)
+
+	_, err = runCLI(t, addr, "", "import", "copy", path.Join(dir, "ids.txt"), "--format", "csv")
+	assert.ErrorContains(t, err, "unknown format")
+}
+
+func TestCLIBackupRestore(t *testing.T) {
+	addr := newTestServer(t)
+	dir := path.Join(t.TempDir(), "backup")
+	_, err := runCLI(t, addr, "", "collection", "create", "docs", "--dim", "2", "--index", "ivf_flat", "--params", `{"nlist":2}`)
+	require.NoError(t, err)
+	input := `{"id":"1","vector":[1,0],"parameters":{"tag":"a"}}
+{"id":"2","vector":[0,1]}
+{"id":"3","vector":[1,1]}
+`
+	_, err = runCLI(t, addr, input, "import", "docs", "-")
+	require.NoError(t, err)
+
+	out, err := runCLI(t, addr, "", "backup", "--out", dir, "--page-size", "2")
+	require.NoError(t, err)
+	assert.Contains(t, out, "Backed up 3 documents of docs")
+	_, err = runCLI(t, addr, "", "backup", "--out", dir)
+	assert.ErrorContains(t, err, "already holds a backup")
+
+	data, err := os.ReadFile(path.Join(dir, "manifest.json"))
+	require.NoError(t, err)
+	var manifest backupManifest
+	require.NoError(t, json.Unmarshal(data, &manifest))
+	require.Len(t, manifest.Collections, 1)
+	assert.Equal(t, 3, manifest.Collections[0].Documents)
+	assert.NotZero(t, manifest.Collections[0].Seq)
+	assert.Equal(t, "ivf_flat", manifest.Collections[0].Options["index_type"])
+	assert.Equal(t, map[string]any{"nlist": "2"}, manifest.Collections[0].Options["parameters"])
+
+	// the collections of a backup aren't overwritten
+	_, err = runCLI(t, addr, "", "restore", "--in", dir)
+	assert.ErrorContains(t, err, "already exists")
+
+	target := newTestServer(t)
+	out, err = runCLI(t, target, "", "restore", "--in", dir, "--batch-size", "2")
+	require.NoError(t, err)
+	assert.Contains(t, out, "Restored 3 documents of docs")
+	out, err = runCLI(t, target, "", "export", "docs")
+	require.NoError(t, err)
+	assert.Equal(t, `{"id":"1","parameters":{"tag":"a"},"vector":[1,0]}
+{"id":"2","parameters":null,"vector":[0,1]}
+{"id":"3","parameters":null,"vector":[1,1]}
+`, out)
+	// so are the settings of the collection
+	_, err = runCLI(t, target, "", "backup", "--out", dir+"2")
+	require.NoError(t, err)
+	data, err = os.ReadFile(path.Join(dir+"2", "manifest.json"))
+	require.NoError(t, err)
+	var restored backupManifest
+	require.NoError(t, json.Unmarshal(data, &restored))
+	assert.Equal(t, manifest.Collections[0].Options, restored.Collections[0].Options)
+	assert.Equal(t, manifest.Collections[0].SHA256, restored.Collections[0].SHA256)
+
+	// a damaged file fails the checksum before anything is written
+	file := path.Join(dir, manifest.Collections[0].File)
+	require.NoError(t, os.WriteFile(file, []byte(strings.Replace(input, "[1,0]", "[1,2]", 1)), 0644))
+	_, err = runCLI(t, newTestServer(t), "", "restore", "--in", dir)
+	assert.ErrorContains(t, err, "checksum mismatch")
+}
+
+func TestCLIBench(t *testing.T) {
+	addr := newTestServer(t)
+
+	out, err := runCLI(t, addr, "", "bench", "--dim", "4", "--index", "hnsw", "--docs", "20", "--queries", "5", "--batch-size", "8")
+	require.NoError(t, err)
+	assert.Contains(t, out, "upsert: 20 documents")
+	assert.Contains(t, out, "search: 5 queries")
+
+	out, err = runCLI(t, addr, "", "collection", "list")
+	require.NoError(t, err)
+	assert.Empty(t, out, "bench collection should be deleted")
+}
+
+func TestCLIInspect(t *testing.T) {
+	dir := t.TempDir()
+
+	walFile := path.Join(dir, "0.wal")
+	writer, err := wal.NewWALWriter(walFile)
+	require.NoError(t, err)
+	require.NoError(t, writer.Write([]byte("k1"), []byte("v1")))
+	require.NoError(t, writer.Write([]byte("k2"), nil))
+	writer.Close()
+	// a record cut off by a crash
+	f, err := os.OpenFile(walFile, os.O_APPEND|os.O_WRONLY, 0644)
+	require.NoError(t, err)
+	_, err = f.Write([]byte{5})
+	require.NoError(t, err)
+	f.Close()
+
+	out, err := runCLI(t, "", "", "inspect", "wal", walFile)
+	require.NoError(t, err)
+	assert.Equal(t, "k1\tv1\nk2\t<deleted>\n# torn record after record 2\n# 2 records\n", out)
+
+	conf, err := config.NewConfig(dir)
+	require.NoError(t, err)
+	sst, err := sstable.NewSSTableWriter("0_0.sst", conf)
+	require.NoError(t, err)
+	require.NoError(t, sst.Append([]byte("a"), []byte("1")))
+	require.NoError(t, sst.Append([]byte("b"), []byte{0xff, 0x00}))
+	_, _, _, err = sst.Finish()
+	require.NoError(t, err)
+	sst.Close()
+
+	out, err = runCLI(t, "", "", "inspect", "sst", path.Join(conf.SSTDir(), "0_0.sst"), "--max-value", "1")
+	require.NoError(t, err)
+	assert.Contains(t, out, "a\t1\n")
+	assert.Contains(t, out, "b\t\"\\xff\"...(2 bytes)\n")
+	assert.Contains(t, out, "# 2 records, 1 data blocks\n")
+}
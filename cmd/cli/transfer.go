@@ -0,0 +1,224 @@
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+
+	"github.com/parquet-go/parquet-go"
+	"github.com/spf13/cobra"
+)
+
+// openInput opens a file argument, "-" reads stdin
+func openInput(cmd *cobra.Command, name string) (io.ReadCloser, error) {
+	if name == "-" {
+		return io.NopCloser(cmd.InOrStdin()), nil
+	}
+	return os.Open(name)
+}
+
+func newImportCmd(opts *options) *cobra.Command {
+	var (
+		batchSize    int
+		format       string
+		idsFile      string
+		idStart      int
+		idColumn     string
+		vectorColumn string
+	)
+	cmd := &cobra.Command{
+		Use:   "import <collection> <file|->",
+		Short: "Batch upsert documents from NDJSON, fvecs, bvecs, npy or parquet files",
+		Long: "import reads NDJSON with one {id, vector, parameters} object per line unless\n" +
+			"--format or the file extension selects another format. fvecs, bvecs and npy\n" +
+			"files hold vectors only, their IDs are the lines of --ids or numbers counting\n" +
+			"from --id-start. Parquet rows hold the ID and vector in --id-column and\n" +
+			"--vector-column, a string parameters column is read as JSON and the other\n" +
+			"columns become parameters.",
+		Args: cobra.ExactArgs(2),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			if batchSize <= 0 {
+				return fmt.Errorf("--batch-size must be positive")
+			}
+			format, err := fileFormat(format, args[1])
+			if err != nil {
+				return err
+			}
+			if format == formatParquet && args[1] == "-" {
+				return fmt.Errorf("parquet files can't be read from stdin")
+			}
+			in, err := openInput(cmd, args[1])
+			if err != nil {
+				return err
+			}
+			defer in.Close()
+
+			ids := &idSource{next: idStart}
+			if idsFile != "" {
+				f, err := os.Open(idsFile)
+				if err != nil {
+					return err
+				}
+				defer f.Close()
+				ids.scanner = bufio.NewScanner(f)
+			}
+			var reader docReader
+			switch format {
+			case formatFvecs:
+				reader = &vecsReader{r: bufio.NewReader(in), elemSize: 4, ids: ids}
+			case formatBvecs:
+				reader = &vecsReader{r: bufio.NewReader(in), elemSize: 1, ids: ids}
+			case formatNPY:
+				if reader, err = newNPYReader(in, ids); err != nil {
+					return err
+				}
+			case formatParquet:
+				if reader, err = newParquetReader(in.(*os.File), idColumn, vectorColumn); err != nil {
+					return err
+				}
+			default:
+				reader = newNDJSONReader(in)
+			}
+
+			// vectors read from binary formats are sent in the binary layout
+			client := opts.client()
+			upsert := client.BatchUpsertDocumentsBinary
+			if format == formatNDJSON {
+				upsert = client.BatchUpsertDocuments
+			}
+			total := 0
+			batch := make([]map[string]any, 0, batchSize)
+			flush := func() error {
+				if len(batch) == 0 {
+					return nil
+				}
+				if err := upsert(args[0], batch); err != nil {
+					return fmt.Errorf("failed to upsert documents %d-%d: %w", total+1, total+len(batch), err)
+				}
+				total += len(batch)
+				batch = batch[:0]
+				return nil
+			}
+
+			for {
+				doc, err := reader.next()
+				if err == io.EOF {
+					break
+				}
+				if err != nil {
+					return err
+				}
+				batch = append(batch, doc)
+				if len(batch) == batchSize {
+					if err := flush(); err != nil {
+						return err
+					}
+				}
+			}
+			if err := flush(); err != nil {
+				return err
+			}
+			fmt.Fprintf(cmd.OutOrStdout(), "Imported %d documents into %s\n", total, args[0])
+			return nil
+		},
+	}
+	cmd.Flags().IntVar(&batchSize, "batch-size", 500, "documents per batch upsert")
+	cmd.Flags().StringVar(&format, "format", "", "ndjson, fvecs, bvecs, npy or parquet, defaults to the file extension")
+	cmd.Flags().StringVar(&idsFile, "ids", "", "file with one ID per line for the vectors of fvecs, bvecs and npy files")
+	cmd.Flags().IntVar(&idStart, "id-start", 0, "first ID of vectors numbered without --ids")
+	cmd.Flags().StringVar(&idColumn, "id-column", "id", "parquet column holding the document IDs")
+	cmd.Flags().StringVar(&vectorColumn, "vector-column", "vector", "parquet column holding the vectors")
+	return cmd
+}
+
+func newExportCmd(opts *options) *cobra.Command {
+	var (
+		output   string
+		format   string
+		filter   string
+		pageSize int
+	)
+	cmd := &cobra.Command{
+		Use:   "export <collection>",
+		Short: "Write all documents of a collection as NDJSON or parquet in the format read by import",
+		Args:  cobra.ExactArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			format, err := fileFormat(format, output)
+			if err != nil {
+				return err
+			}
+			if format != formatNDJSON && format != formatParquet {
+				return fmt.Errorf("documents can only be exported as ndjson or parquet")
+			}
+			var filterMap map[string]any
+			if filter != "" {
+				if err := json.Unmarshal([]byte(filter), &filterMap); err != nil {
+					return fmt.Errorf("invalid --filter: %w", err)
+				}
+			}
+
+			out := cmd.OutOrStdout()
+			if output != "-" {
+				f, err := os.Create(output)
+				if err != nil {
+					return err
+				}
+				defer f.Close()
+				out = f
+			}
+			w := bufio.NewWriter(out)
+			enc := json.NewEncoder(w)
+			var pw *parquet.GenericWriter[parquetDoc]
+			if format == formatParquet {
+				pw = parquet.NewGenericWriter[parquetDoc](w)
+			}
+
+			client := opts.client()
+			cursor := ""
+			for {
+				page, err := client.ScrollDocuments(args[0], filterMap, pageSize, cursor)
+				if err != nil {
+					return err
+				}
+				docs, _ := page["documents"].([]any)
+				for _, d := range docs {
+					doc, _ := d.(map[string]any)
+					if pw != nil {
+						row, err := newParquetDoc(doc)
+						if err != nil {
+							return err
+						}
+						if _, err := pw.Write([]parquetDoc{row}); err != nil {
+							return err
+						}
+						continue
+					}
+					if err := enc.Encode(map[string]any{
+						"id":         doc["id"],
+						"vector":     doc["vector"],
+						"parameters": doc["parameters"],
+					}); err != nil {
+						return err
+					}
+				}
+				cursor, _ = page["cursor"].(string)
+				if cursor == "" {
+					break
+				}
+			}
+			if pw != nil {
+				if err := pw.Close(); err != nil {
+					return err
+				}
+			}
+			return w.Flush()
+		},
+	}
+	cmd.Flags().StringVarP(&output, "output", "o", "-", "file to write, - writes stdout")
+	cmd.Flags().StringVar(&format, "format", "", "ndjson or parquet, defaults to the file extension")
+	cmd.Flags().StringVar(&filter, "filter", "", "only export documents matching this JSON filter")
+	cmd.Flags().IntVar(&pageSize, "page-size", 500, "documents fetched per scroll request")
+	return cmd
+}
@@ -0,0 +1,380 @@
+package main
+
+import (
+	"bufio"
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+	"io"
+	"math"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/parquet-go/parquet-go"
+)
+
+// Formats of import and export files. fvecs and bvecs are the TEXMEX
+// benchmark layout: every vector is a little-endian int32 dimension followed
+// by its values as float32 or uint8. npy is a 2-D NumPy array with one vector
+// per row. Neither carries IDs, they are read from --ids or numbered from
+// --id-start. A parquet file holds a document per row.
+const (
+	formatNDJSON  = "ndjson"
+	formatFvecs   = "fvecs"
+	formatBvecs   = "bvecs"
+	formatNPY     = "npy"
+	formatParquet = "parquet"
+)
+
+// fileFormat returns the format given by flag, or by the extension of name
+func fileFormat(flag, name string) (string, error) {
+	if flag != "" {
+		switch flag {
+		case formatNDJSON, formatFvecs, formatBvecs, formatNPY, formatParquet:
+			return flag, nil
+		}
+		return "", fmt.Errorf("unknown format %q", flag)
+	}
+	switch strings.ToLower(filepath.Ext(name)) {
+	case ".fvecs":
+		return formatFvecs, nil
+	case ".bvecs":
+		return formatBvecs, nil
+	case ".npy":
+		return formatNPY, nil
+	case ".parquet":
+		return formatParquet, nil
+	}
+	return formatNDJSON, nil
+}
+
+// docReader yields the documents of an import file, io.EOF after the last
+type docReader interface {
+	next() (map[string]any, error)
+}
+
+// ndjsonReader reads one {id, vector, parameters} object per line
+type ndjsonReader struct {
+	scanner *bufio.Scanner
+	line    int
+}
+
+func newNDJSONReader(in io.Reader) *ndjsonReader {
+	scanner := bufio.NewScanner(in)
+	scanner.Buffer(make([]byte, 64*1024), 64*1024*1024)
+	return &ndjsonReader{scanner: scanner}
+}
+
+func (r *ndjsonReader) next() (map[string]any, error) {
+	for r.scanner.Scan() {
+		r.line++
+		if len(r.scanner.Bytes()) == 0 {
+			continue
+		}
+		var doc map[string]any
+		if err := json.Unmarshal(r.scanner.Bytes(), &doc); err != nil {
+			return nil, fmt.Errorf("line %d: %w", r.line, err)
+		}
+		return doc, nil
+	}
+	if err := r.scanner.Err(); err != nil {
+		return nil, err
+	}
+	return nil, io.EOF
+}
+
+// idSource names the vectors of formats without IDs, by the lines of a file
+// or by number
+type idSource struct {
+	scanner *bufio.Scanner
+	next    int
+}
+
+func (s *idSource) id() (string, error) {
+	if s.scanner == nil {
+		id := strconv.Itoa(s.next)
+		s.next++
+		return id, nil
+	}
+	if s.scanner.Scan() {
+		return strings.TrimSpace(s.scanner.Text()), nil
+	}
+	if err := s.scanner.Err(); err != nil {
+		return "", err
+	}
+	return "", fmt.Errorf("the IDs file has fewer lines than there are vectors")
+}
+
+// vecsReader reads fvecs, or bvecs when elemSize is 1
+type vecsReader struct {
+	r        *bufio.Reader
+	elemSize int
+	ids      *idSource
+	buf      []byte
+	n        int
+}
+
+func (r *vecsReader) next() (map[string]any, error) {
+	var dim int32
+	if err := binary.Read(r.r, binary.LittleEndian, &dim); err == io.EOF {
+		return nil, err
+	} else if err != nil {
+		return nil, fmt.Errorf("vector %d: %w", r.n, err)
+	}
+	if dim <= 0 {
+		return nil, fmt.Errorf("vector %d: invalid dimension %d", r.n, dim)
+	}
+	size := int(dim) * r.elemSize
+	if cap(r.buf) < size {
+		r.buf = make([]byte, size)
+	}
+	buf := r.buf[:size]
+	if _, err := io.ReadFull(r.r, buf); err != nil {
+		return nil, fmt.Errorf("vector %d cut off: %w", r.n, err)
+	}
+	r.n++
+	vector := make([]float32, dim)
+	for i := range vector {
+		if r.elemSize == 1 {
+			vector[i] = float32(buf[i])
+		} else {
+			vector[i] = math.Float32frombits(binary.LittleEndian.Uint32(buf[i*4:]))
+		}
+	}
+	id, err := r.ids.id()
+	if err != nil {
+		return nil, err
+	}
+	return map[string]any{"id": id, "vector": vector}, nil
+}
+
+// npyReader reads the rows of a 2-D NumPy array in C order
+type npyReader struct {
+	r      *bufio.Reader
+	rows   int
+	dim    int
+	size   int // bytes per value
+	decode func([]byte) float32
+	ids    *idSource
+	row    int
+	buf    []byte
+}
+
+var (
+	npyMagic = []byte("\x93NUMPY")
+	npyDescr = regexp.MustCompile(`'descr':\s*'([^']*)'`)
+	npyOrder = regexp.MustCompile(`'fortran_order':\s*(True|False)`)
+	npyShape = regexp.MustCompile(`'shape':\s*\(\s*(\d+)\s*,\s*(\d+)\s*,?\s*\)`)
+)
+
+// npyDecoders decode the supported little-endian value types
+var npyDecoders = map[string]struct {
+	size   int
+	decode func([]byte) float32
+}{
+	"<f4": {4, func(b []byte) float32 { return math.Float32frombits(binary.LittleEndian.Uint32(b)) }},
+	"<f8": {8, func(b []byte) float32 { return float32(math.Float64frombits(binary.LittleEndian.Uint64(b))) }},
+	"|u1": {1, func(b []byte) float32 { return float32(b[0]) }},
+	"|i1": {1, func(b []byte) float32 { return float32(int8(b[0])) }},
+}
+
+func newNPYReader(in io.Reader, ids *idSource) (*npyReader, error) {
+	r := bufio.NewReader(in)
+	prefix := make([]byte, len(npyMagic)+2)
+	if _, err := io.ReadFull(r, prefix); err != nil || string(prefix[:len(npyMagic)]) != string(npyMagic) {
+		return nil, fmt.Errorf("not a .npy file")
+	}
+	var headerLen int
+	switch major := prefix[len(npyMagic)]; major {
+	case 1:
+		var n uint16
+		if err := binary.Read(r, binary.LittleEndian, &n); err != nil {
+			return nil, err
+		}
+		headerLen = int(n)
+	case 2, 3:
+		var n uint32
+		if err := binary.Read(r, binary.LittleEndian, &n); err != nil {
+			return nil, err
+		}
+		headerLen = int(n)
+	default:
+		return nil, fmt.Errorf("unsupported .npy version %d", major)
+	}
+	header := make([]byte, headerLen)
+	if _, err := io.ReadFull(r, header); err != nil {
+		return nil, fmt.Errorf("npy header cut off: %w", err)
+	}
+
+	descr := npyDescr.FindSubmatch(header)
+	shape := npyShape.FindSubmatch(header)
+	if descr == nil || shape == nil {
+		return nil, fmt.Errorf("npy array must be 2-D, got header %s", strings.TrimSpace(string(header)))
+	}
+	if order := npyOrder.FindSubmatch(header); order != nil && string(order[1]) == "True" {
+		return nil, fmt.Errorf("fortran ordered npy arrays are not supported")
+	}
+	decoder, ok := npyDecoders[string(descr[1])]
+	if !ok {
+		return nil, fmt.Errorf("unsupported npy dtype %s, use float32, float64, uint8 or int8", descr[1])
+	}
+	rows, _ := strconv.Atoi(string(shape[1]))
+	dim, _ := strconv.Atoi(string(shape[2]))
+	if dim == 0 {
+		return nil, fmt.Errorf("npy array has no columns")
+	}
+	return &npyReader{r: r, rows: rows, dim: dim, size: decoder.size, decode: decoder.decode, ids: ids,
+		buf: make([]byte, dim*decoder.size)}, nil
+}
+
+func (r *npyReader) next() (map[string]any, error) {
+	if r.row == r.rows {
+		return nil, io.EOF
+	}
+	if _, err := io.ReadFull(r.r, r.buf); err != nil {
+		return nil, fmt.Errorf("npy row %d cut off: %w", r.row, err)
+	}
+	r.row++
+	vector := make([]float32, r.dim)
+	for i := range vector {
+		vector[i] = r.decode(r.buf[i*r.size:])
+	}
+	id, err := r.ids.id()
+	if err != nil {
+		return nil, err
+	}
+	return map[string]any{"id": id, "vector": vector}, nil
+}
+
+// parquetReader reads a document per row. The vector column is a list of
+// numbers, a string parameters column holds JSON and the other columns
+// become parameters
+type parquetReader struct {
+	reader       *parquet.Reader
+	idColumn     string
+	vectorColumn string
+	row          int
+}
+
+func newParquetReader(f *os.File, idColumn, vectorColumn string) (*parquetReader, error) {
+	info, err := f.Stat()
+	if err != nil {
+		return nil, err
+	}
+	file, err := parquet.OpenFile(f, info.Size())
+	if err != nil {
+		return nil, fmt.Errorf("not a parquet file: %w", err)
+	}
+	columns := map[string]bool{}
+	for _, field := range file.Schema().Fields() {
+		columns[field.Name()] = true
+	}
+	for _, column := range []string{idColumn, vectorColumn} {
+		if !columns[column] {
+			return nil, fmt.Errorf("parquet file has no column %q", column)
+		}
+	}
+	return &parquetReader{reader: parquet.NewReader(file), idColumn: idColumn, vectorColumn: vectorColumn}, nil
+}
+
+func (r *parquetReader) next() (map[string]any, error) {
+	row := map[string]any{}
+	if err := r.reader.Read(&row); err != nil {
+		return nil, err
+	}
+	r.row++
+
+	doc := map[string]any{}
+	switch id := row[r.idColumn].(type) {
+	case string:
+		doc["id"] = id
+	case []byte:
+		doc["id"] = string(id)
+	case nil:
+		return nil, fmt.Errorf("row %d: %s is null", r.row, r.idColumn)
+	default:
+		doc["id"] = fmt.Sprint(id)
+	}
+	vector, err := floats(row[r.vectorColumn])
+	if err != nil {
+		return nil, fmt.Errorf("row %d: %s: %w", r.row, r.vectorColumn, err)
+	}
+	doc["vector"] = vector
+
+	parameters := map[string]any{}
+	for name, value := range row {
+		if name == r.idColumn || name == r.vectorColumn || value == nil {
+			continue
+		}
+		if name == "parameters" {
+			if s, ok := value.(string); ok {
+				if err := json.Unmarshal([]byte(s), &parameters); err != nil {
+					return nil, fmt.Errorf("row %d: parameters: %w", r.row, err)
+				}
+				continue
+			}
+		}
+		parameters[name] = value
+	}
+	if len(parameters) > 0 {
+		doc["parameters"] = parameters
+	}
+	return doc, nil
+}
+
+// floats converts a list column value to a vector
+func floats(value any) ([]float32, error) {
+	list, ok := value.([]any)
+	if !ok {
+		return nil, fmt.Errorf("expected a list of numbers, got %T", value)
+	}
+	vector := make([]float32, len(list))
+	for i, v := range list {
+		switch v := v.(type) {
+		case float32:
+			vector[i] = v
+		case float64:
+			vector[i] = float32(v)
+		case int32:
+			vector[i] = float32(v)
+		case int64:
+			vector[i] = float32(v)
+		default:
+			return nil, fmt.Errorf("element %d is a %T, not a number", i, v)
+		}
+	}
+	return vector, nil
+}
+
+// parquetDoc is a row of an exported parquet file, the parameters are JSON
+type parquetDoc struct {
+	ID         string    `parquet:"id"`
+	Vector     []float32 `parquet:"vector,list"`
+	Parameters *string   `parquet:"parameters,optional"`
+}
+
+// newParquetDoc converts a scrolled document
+func newParquetDoc(doc map[string]any) (parquetDoc, error) {
+	row := parquetDoc{ID: fmt.Sprint(doc["id"])}
+	values, _ := doc["vector"].([]any)
+	row.Vector = make([]float32, len(values))
+	for i, v := range values {
+		f, ok := v.(float64)
+		if !ok {
+			return row, fmt.Errorf("document %s: vector element %d is not a number", row.ID, i)
+		}
+		row.Vector[i] = float32(f)
+	}
+	if parameters, ok := doc["parameters"].(map[string]any); ok && len(parameters) > 0 {
+		data, err := json.Marshal(parameters)
+		if err != nil {
+			return row, err
+		}
+		s := string(data)
+		row.Parameters = &s
+	}
+	return row, nil
+}
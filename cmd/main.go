@@ -1,14 +1,22 @@
 package main
 
 import (
+	"context"
 	"fmt"
+	"os"
+	"os/signal"
+	"syscall"
 
 	"oasisdb/internal/config"
 	dblib "oasisdb/internal/db"
 	"oasisdb/internal/server"
+	"oasisdb/internal/tracing"
 	"oasisdb/pkg/logger"
 )
 
+// configFile is read from the working directory at startup and on SIGHUP
+const configFile = "conf.yaml"
+
 func printBanner() {
 	fmt.Print(`
 =================================================
@@ -24,16 +32,24 @@ func printBanner() {
 
 func main() {
 	// Init Config from file
-	conf, err := config.FromFile("conf.yaml")
+	conf, err := config.FromFile(configFile)
 	if err != nil {
 		logger.Error("Failed to load config from file", "error", err)
 		return
 	}
 
 	// Initialize logger with config settings
-	logger.InitLogger(conf.LogLevel, conf.LogFile)
+	logger.InitLogger(conf.Logging.Level, conf.Logging.File)
+	logger.InitSlowLogger(conf.Logging.SlowQueryFile)
+	shutdownTracing, err := tracing.Init(conf.Tracing)
+	if err != nil {
+		logger.Error("Failed to init tracing", "error", err)
+		return
+	}
+	defer shutdownTracing(context.Background())
 	printBanner()
-	logger.Info("OasisDB starting", "log_level", conf.LogLevel, "log_file", conf.LogFile)
+	logger.Info("OasisDB starting", "log_level", conf.Logging.Level, "log_file", conf.Logging.File)
+	logger.Info("Effective config:\n" + conf.Dump())
 
 	// Init DB
 	db, err := dblib.New(conf)
@@ -46,10 +62,36 @@ func main() {
 		return
 	}
 	defer db.Close()
+	if conf.Server.WarmupOnStart {
+		if _, err := db.Warmup(context.Background(), conf.Server.WarmupSearches); err != nil {
+			logger.Error("Failed to warm up database", "error", err)
+		}
+	}
 
 	// Init Server
 	server := server.New(db)
+	if err := server.StartConsensus(); err != nil {
+		logger.Error("Failed to start raft", "error", err)
+		return
+	}
+	defer server.Close()
+	if err := server.OpenAuditLog(); err != nil {
+		logger.Error("Failed to open audit log", "error", err)
+		return
+	}
+
+	// SIGHUP reloads the settings of conf.yaml that can change while running
+	server.SetConfigFile(configFile)
+	hup := make(chan os.Signal, 1)
+	signal.Notify(hup, syscall.SIGHUP)
+	go func() {
+		for range hup {
+			if _, err := server.ReloadConfig(); err != nil {
+				logger.Error("Failed to reload config", "error", err)
+			}
+		}
+	}()
 
 	// Run Server
-	server.Run(":8080")
+	server.Run(conf.Server.Addr)
 }
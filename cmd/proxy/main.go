@@ -0,0 +1,41 @@
+package main
+
+import (
+	"flag"
+	"net/http"
+	"strings"
+
+	"oasisdb/internal/proxy"
+	"oasisdb/pkg/logger"
+
+	"github.com/gin-gonic/gin"
+)
+
+func main() {
+	nodes := flag.String("nodes", "", "comma separated API addresses of the nodes, e.g. http://10.0.0.1:8080,http://10.0.0.2:8080")
+	addr := flag.String("addr", ":9090", "address to listen on")
+	spread := flag.Int("spread", 1, "nodes the documents of each collection are partitioned over")
+	vnodes := flag.Int("vnodes", 100, "points of each node on the hash ring")
+	logLevel := flag.String("log-level", "info", "log level")
+	flag.Parse()
+
+	logger.InitLogger(*logLevel, "")
+	gin.SetMode(gin.ReleaseMode)
+
+	var nodeList []string
+	for _, node := range strings.Split(*nodes, ",") {
+		if node = strings.TrimSpace(node); node != "" {
+			nodeList = append(nodeList, strings.TrimSuffix(node, "/"))
+		}
+	}
+	p, err := proxy.New(proxy.Options{Nodes: nodeList, Spread: *spread, VirtualNodes: *vnodes})
+	if err != nil {
+		logger.Error("Failed to init proxy", "error", err)
+		return
+	}
+
+	logger.Info("OasisDB proxy starting", "addr", *addr, "nodes", nodeList, "spread", *spread)
+	if err := http.ListenAndServe(*addr, p.Handler()); err != nil {
+		logger.Error("Proxy stopped", "error", err)
+	}
+}
@@ -0,0 +1,108 @@
+package audit
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"sync"
+	"time"
+)
+
+// Record is one audited operation, written as a JSON line
+type Record struct {
+	Time       time.Time      `json:"time"`
+	Action     string         `json:"action"` // e.g. delete_collection
+	Collection string         `json:"collection,omitempty"`
+	DocumentID string         `json:"document_id,omitempty"`
+	Tenant     string         `json:"tenant,omitempty"`
+	ClientIP   string         `json:"client_ip"`
+	APIKey     string         `json:"api_key,omitempty"` // fingerprint of the key, never the key
+	RequestID  string         `json:"request_id,omitempty"`
+	Status     int            `json:"status"` // HTTP status the operation was answered with
+	Details    map[string]any `json:"details,omitempty"`
+}
+
+// Log appends records to a file, which is rotated to file.1, file.2 and so
+// on once it reaches maxBytes. It is safe for concurrent use
+type Log struct {
+	mu       sync.Mutex
+	path     string
+	maxBytes int64
+	maxFiles int // rotated files kept
+	file     *os.File
+	size     int64
+}
+
+// Open opens the audit log at path for appending, maxBytes of 0 never rotates
+func Open(path string, maxBytes int64, maxFiles int) (*Log, error) {
+	l := &Log{path: path, maxBytes: maxBytes, maxFiles: maxFiles}
+	if err := l.open(); err != nil {
+		return nil, err
+	}
+	return l, nil
+}
+
+func (l *Log) open() error {
+	file, err := os.OpenFile(l.path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0600)
+	if err != nil {
+		return fmt.Errorf("failed to open audit log: %w", err)
+	}
+	info, err := file.Stat()
+	if err != nil {
+		file.Close()
+		return fmt.Errorf("failed to stat audit log: %w", err)
+	}
+	l.file, l.size = file, info.Size()
+	return nil
+}
+
+// Write appends a record and syncs it to disk, so an acknowledged operation
+// is never missing from the log
+func (l *Log) Write(record *Record) error {
+	data, err := json.Marshal(record)
+	if err != nil {
+		return fmt.Errorf("failed to marshal audit record: %w", err)
+	}
+	data = append(data, '\n')
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if l.maxBytes > 0 && l.size > 0 && l.size+int64(len(data)) > l.maxBytes {
+		if err := l.rotate(); err != nil {
+			return err
+		}
+	}
+	n, err := l.file.Write(data)
+	l.size += int64(n)
+	if err != nil {
+		return fmt.Errorf("failed to write audit record: %w", err)
+	}
+	return l.file.Sync()
+}
+
+// rotate shifts the rotated files by one, dropping the oldest, and starts a
+// new file
+func (l *Log) rotate() error {
+	if err := l.file.Close(); err != nil {
+		return fmt.Errorf("failed to close audit log: %w", err)
+	}
+	if l.maxFiles > 0 {
+		os.Remove(fmt.Sprintf("%s.%d", l.path, l.maxFiles))
+		for i := l.maxFiles - 1; i >= 1; i-- {
+			os.Rename(fmt.Sprintf("%s.%d", l.path, i), fmt.Sprintf("%s.%d", l.path, i+1))
+		}
+		if err := os.Rename(l.path, l.path+".1"); err != nil {
+			return fmt.Errorf("failed to rotate audit log: %w", err)
+		}
+	} else if err := os.Remove(l.path); err != nil {
+		return fmt.Errorf("failed to rotate audit log: %w", err)
+	}
+	return l.open()
+}
+
+// Close closes the log file
+func (l *Log) Close() error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return l.file.Close()
+}
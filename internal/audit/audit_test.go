@@ -0,0 +1,48 @@
+package audit
+
+import (
+	"bufio"
+	"encoding/json"
+	"os"
+	"path"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func readRecords(t *testing.T, file string) []Record {
+	f, err := os.Open(file)
+	assert.NoError(t, err)
+	defer f.Close()
+	var records []Record
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		var record Record
+		assert.NoError(t, json.Unmarshal(scanner.Bytes(), &record))
+		records = append(records, record)
+	}
+	return records
+}
+
+func TestLogRotates(t *testing.T) {
+	file := path.Join(t.TempDir(), "audit.log")
+	log, err := Open(file, 200, 2)
+	assert.NoError(t, err)
+	for _, id := range []string{"1", "2", "3", "4"} {
+		assert.NoError(t, log.Write(&Record{Action: "delete_document", Collection: "docs", DocumentID: id, ClientIP: "10.0.0.1", Status: 200}))
+	}
+	assert.NoError(t, log.Close())
+
+	// every record is bigger than half the limit
+	assert.Equal(t, "4", readRecords(t, file)[0].DocumentID)
+	assert.Equal(t, "3", readRecords(t, file+".1")[0].DocumentID)
+	assert.Equal(t, "2", readRecords(t, file+".2")[0].DocumentID)
+	assert.NoFileExists(t, file+".3")
+
+	// reopening appends
+	log, err = Open(file, 0, 0)
+	assert.NoError(t, err)
+	assert.NoError(t, log.Write(&Record{Action: "delete_collection", Collection: "docs"}))
+	assert.NoError(t, log.Close())
+	assert.Len(t, readRecords(t, file), 2)
+}
@@ -1,40 +1,65 @@
 package cache
 
-import "container/list"
+import (
+	"container/list"
+	"sync"
+	"time"
+)
 
 // entry represents a key-value pair in the cache
 type entry struct {
-	key   string
-	value interface{}
+	key     string
+	value   interface{}
+	expires time.Time // zero if the entry doesn't expire
 }
 
-// LRUCache implements a Least Recently Used cache
+// LRUCache implements a Least Recently Used cache, safe for concurrent use
 type LRUCache struct {
+	mu         sync.Mutex
 	maxSize    int
+	ttl        time.Duration // entry lifetime, 0 keeps entries until evicted
 	cache      map[string]*list.Element
 	doubleList *list.List
+	now        func() time.Time
 }
 
 // NewLRUCache creates a new LRU cache with the given maximum size
 func NewLRUCache(maxSize int) *LRUCache {
+	return NewLRUCacheWithTTL(maxSize, 0)
+}
+
+// NewLRUCacheWithTTL creates a new LRU cache whose entries expire ttl after
+// they were set, 0 means they never expire
+func NewLRUCacheWithTTL(maxSize int, ttl time.Duration) *LRUCache {
 	return &LRUCache{
 		maxSize:    maxSize,
+		ttl:        ttl,
 		cache:      make(map[string]*list.Element),
 		doubleList: list.New(),
+		now:        time.Now,
 	}
 }
 
 // Set adds or updates a key-value pair in the cache
 func (l *LRUCache) Set(key string, value interface{}) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	var expires time.Time
+	if l.ttl > 0 {
+		expires = l.now().Add(l.ttl)
+	}
+
 	// If key exists, update its value and move to front
 	if element, exists := l.cache[key]; exists {
 		l.doubleList.MoveToFront(element)
 		element.Value.(*entry).value = value
+		element.Value.(*entry).expires = expires
 		return
 	}
 
 	// Add new entry
-	ele := l.doubleList.PushFront(&entry{key: key, value: value})
+	ele := l.doubleList.PushFront(&entry{key: key, value: value, expires: expires})
 	l.cache[key] = ele
 
 	// Remove oldest if cache is full
@@ -48,10 +73,17 @@ func (l *LRUCache) Set(key string, value interface{}) {
 
 // Get retrieves a value from the cache by key
 func (l *LRUCache) Get(key string) (interface{}, bool) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
 	element, exists := l.cache[key]
 	if !exists {
 		return nil, false
 	}
+	if expires := element.Value.(*entry).expires; !expires.IsZero() && !l.now().Before(expires) {
+		l.removeElement(element)
+		return nil, false
+	}
 
 	// Move to front (most recently used)
 	l.doubleList.MoveToFront(element)
@@ -60,6 +92,9 @@ func (l *LRUCache) Get(key string) (interface{}, bool) {
 
 // Delete removes a key-value pair from the cache
 func (l *LRUCache) Delete(key string) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
 	if element, exists := l.cache[key]; exists {
 		l.removeElement(element)
 	}
@@ -67,6 +102,9 @@ func (l *LRUCache) Delete(key string) {
 
 // DeleteWithPrefix removes all key-value pairs with the given prefix
 func (l *LRUCache) DeleteWithPrefix(prefix string) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
 	// Create a list of elements to remove to avoid modifying the map during iteration
 	toRemove := make([]*list.Element, 0)
 
@@ -84,11 +122,29 @@ func (l *LRUCache) DeleteWithPrefix(prefix string) {
 }
 
 func (l *LRUCache) Clear() {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
 	l.cache = make(map[string]*list.Element)
 	l.doubleList = list.New()
 }
 
+// Resize changes the maximum size, the least recently used entries over it
+// are evicted
+func (l *LRUCache) Resize(maxSize int) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	l.maxSize = maxSize
+	for l.doubleList.Len() > l.maxSize {
+		l.removeElement(l.doubleList.Back())
+	}
+}
+
 func (l *LRUCache) Len() int {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
 	return l.doubleList.Len()
 }
 
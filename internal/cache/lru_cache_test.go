@@ -2,6 +2,7 @@ package cache
 
 import (
 	"testing"
+	"time"
 
 	"github.com/stretchr/testify/assert"
 )
@@ -44,6 +45,23 @@ func TestLRUCache_Capacity(t *testing.T) {
 	assert.Equal(t, "value3", value)
 }
 
+func TestLRUCache_Resize(t *testing.T) {
+	cache := NewLRUCache(3)
+	cache.Set("key1", "value1")
+	cache.Set("key2", "value2")
+	cache.Set("key3", "value3")
+
+	// key1 is the least recently used
+	cache.Resize(2)
+	assert.Equal(t, 2, cache.Len())
+	_, exists := cache.Get("key1")
+	assert.False(t, exists)
+
+	cache.Resize(3)
+	cache.Set("key4", "value4")
+	assert.Equal(t, 3, cache.Len())
+}
+
 func TestLRUCache_UpdateExisting(t *testing.T) {
 	cache := NewLRUCache(2)
 
@@ -86,3 +104,24 @@ func TestLRUCache_LRUOrder(t *testing.T) {
 	assert.True(t, exists)
 	assert.Equal(t, "value3", value)
 }
+
+func TestLRUCache_TTL(t *testing.T) {
+	now := time.Unix(0, 0)
+	cache := NewLRUCacheWithTTL(2, time.Minute)
+	cache.now = func() time.Time { return now }
+
+	cache.Set("key1", "value1")
+	now = now.Add(30 * time.Second)
+	value, exists := cache.Get("key1")
+	assert.True(t, exists)
+	assert.Equal(t, "value1", value)
+
+	// setting a key again restarts its lifetime
+	cache.Set("key2", "value2")
+	now = now.Add(30 * time.Second)
+	_, exists = cache.Get("key1")
+	assert.False(t, exists)
+	_, exists = cache.Get("key2")
+	assert.True(t, exists)
+	assert.Equal(t, 1, cache.Len())
+}
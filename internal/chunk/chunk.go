@@ -0,0 +1,197 @@
+package chunk
+
+import (
+	"errors"
+	"fmt"
+	"regexp"
+	"strings"
+	"unicode/utf8"
+)
+
+const (
+	SentenceSplitter  = "sentence"
+	MarkdownSplitter  = "markdown"
+	CharacterSplitter = "character"
+
+	DefaultSize    = 512 // characters per chunk
+	DefaultOverlap = 64  // characters shared by neighbouring chunks
+)
+
+var ErrInvalidOptions = errors.New("invalid chunking options")
+
+// Options controls how text is split, sizes are in characters (runes)
+type Options struct {
+	Size     int    `json:"size"`     // max characters per chunk
+	Overlap  int    `json:"overlap"`  // characters repeated from the previous chunk
+	Splitter string `json:"splitter"` // sentence, markdown or character
+}
+
+// withDefaults fills zero options and validates the rest
+func (o Options) withDefaults() (Options, error) {
+	if o.Size == 0 {
+		o.Size = DefaultSize
+		if o.Overlap == 0 {
+			o.Overlap = DefaultOverlap
+		}
+	}
+	if o.Splitter == "" {
+		o.Splitter = SentenceSplitter
+	}
+	if o.Size < 0 || o.Overlap < 0 || o.Overlap >= o.Size {
+		return o, fmt.Errorf("%w: size must be positive and overlap in [0, size), got size %d overlap %d",
+			ErrInvalidOptions, o.Size, o.Overlap)
+	}
+	return o, nil
+}
+
+// Split breaks text into chunks of at most opts.Size characters, splitting
+// on sentence or markdown section boundaries where possible
+func Split(text string, opts Options) ([]string, error) {
+	opts, err := opts.withDefaults()
+	if err != nil {
+		return nil, err
+	}
+	if strings.TrimSpace(text) == "" {
+		return nil, nil
+	}
+
+	switch opts.Splitter {
+	case SentenceSplitter:
+		return pack(splitSentences(text), " ", opts), nil
+	case MarkdownSplitter:
+		return pack(splitMarkdown(text), "\n\n", opts), nil
+	case CharacterSplitter:
+		return splitRunes(strings.TrimSpace(text), opts), nil
+	default:
+		return nil, fmt.Errorf("%w: unknown splitter %q", ErrInvalidOptions, opts.Splitter)
+	}
+}
+
+// sentenceEnd matches sentence terminators followed by whitespace, and CJK
+// terminators which are usually not followed by a space
+var sentenceEnd = regexp.MustCompile(`[.!?]+["')\]]*\s+|[。！？]+`)
+
+func splitSentences(text string) []string {
+	var sentences []string
+	start := 0
+	for _, loc := range sentenceEnd.FindAllStringIndex(text, -1) {
+		sentences = appendTrimmed(sentences, text[start:loc[1]])
+		start = loc[1]
+	}
+	return appendTrimmed(sentences, text[start:])
+}
+
+// splitMarkdown splits on headings and blank lines, a heading stays with the
+// paragraph that follows it
+func splitMarkdown(text string) []string {
+	var sections []string
+	var current []string
+	var heading string
+	flush := func() {
+		if len(current) > 0 {
+			sections = appendTrimmed(sections, strings.Join(current, "\n"))
+			current = nil
+		}
+	}
+	for _, line := range strings.Split(text, "\n") {
+		trimmed := strings.TrimSpace(line)
+		switch {
+		case strings.HasPrefix(trimmed, "#"):
+			flush()
+			if heading != "" {
+				sections = append(sections, heading)
+			}
+			heading = trimmed
+		case trimmed == "":
+			flush()
+		default:
+			if heading != "" {
+				current = append(current, heading)
+				heading = ""
+			}
+			current = append(current, line)
+		}
+	}
+	flush()
+	if heading != "" {
+		sections = append(sections, heading)
+	}
+	return sections
+}
+
+// pack greedily joins segments into chunks of at most opts.Size characters,
+// starting each chunk with trailing segments of the previous one that fit in
+// opts.Overlap, segments longer than opts.Size are cut by splitRunes
+func pack(segments []string, sep string, opts Options) []string {
+	sepLen := utf8.RuneCountInString(sep)
+	joinedLen := func(parts []string) int {
+		n := 0
+		for i, s := range parts {
+			if i > 0 {
+				n += sepLen
+			}
+			n += utf8.RuneCountInString(s)
+		}
+		return n
+	}
+
+	var chunks []string
+	var current []string
+	fresh := false // current holds segments not yet emitted
+	for _, segment := range segments {
+		n := utf8.RuneCountInString(segment)
+		if n > opts.Size {
+			if fresh {
+				chunks = append(chunks, strings.Join(current, sep))
+			}
+			chunks = append(chunks, splitRunes(segment, opts)...)
+			current, fresh = nil, false
+			continue
+		}
+
+		if len(current) > 0 && joinedLen(current)+sepLen+n > opts.Size {
+			if fresh {
+				chunks = append(chunks, strings.Join(current, sep))
+			}
+			// keep the longest tail that fits the overlap and leaves room
+			keep := len(current)
+			for keep > 0 {
+				tail := current[keep-1:]
+				if joinedLen(tail) > opts.Overlap || joinedLen(tail)+sepLen+n > opts.Size {
+					break
+				}
+				keep--
+			}
+			current = append([]string(nil), current[keep:]...)
+		}
+		current = append(current, segment)
+		fresh = true
+	}
+	if fresh {
+		chunks = append(chunks, strings.Join(current, sep))
+	}
+	return chunks
+}
+
+// splitRunes cuts text into windows of opts.Size characters that overlap by
+// opts.Overlap characters
+func splitRunes(text string, opts Options) []string {
+	runes := []rune(text)
+	var chunks []string
+	step := opts.Size - opts.Overlap
+	for start := 0; start < len(runes); start += step {
+		end := min(start+opts.Size, len(runes))
+		chunks = appendTrimmed(chunks, string(runes[start:end]))
+		if end == len(runes) {
+			break
+		}
+	}
+	return chunks
+}
+
+func appendTrimmed(parts []string, s string) []string {
+	if s = strings.TrimSpace(s); s != "" {
+		parts = append(parts, s)
+	}
+	return parts
+}
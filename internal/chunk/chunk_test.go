@@ -0,0 +1,67 @@
+package chunk
+
+import (
+	"strings"
+	"testing"
+	"unicode/utf8"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSplitSentences(t *testing.T) {
+	text := "One fish. Two fish! Red fish? Blue fish."
+	chunks, err := Split(text, Options{Size: 20, Overlap: 0})
+	require.NoError(t, err)
+	assert.Equal(t, []string{"One fish. Two fish!", "Red fish? Blue fish."}, chunks)
+
+	// the last sentence of a chunk is repeated at the start of the next one
+	chunks, err = Split(text, Options{Size: 20, Overlap: 10})
+	require.NoError(t, err)
+	assert.Equal(t, []string{"One fish. Two fish!", "Two fish! Red fish?", "Red fish? Blue fish."}, chunks)
+
+	chunks, err = Split("第一句。第二句！第三句？", Options{Size: 9})
+	require.NoError(t, err)
+	assert.Equal(t, []string{"第一句。 第二句！", "第三句？"}, chunks)
+}
+
+func TestSplitMarkdown(t *testing.T) {
+	text := "# Title\nIntro paragraph.\n\n## Usage\nRun it.\n\nMore usage."
+	chunks, err := Split(text, Options{Size: 30, Splitter: MarkdownSplitter})
+	require.NoError(t, err)
+	assert.Equal(t, []string{"# Title\nIntro paragraph.", "## Usage\nRun it.\n\nMore usage."}, chunks)
+}
+
+func TestSplitCharacter(t *testing.T) {
+	chunks, err := Split("abcdefghij", Options{Size: 4, Overlap: 1, Splitter: CharacterSplitter})
+	require.NoError(t, err)
+	assert.Equal(t, []string{"abcd", "defg", "ghij"}, chunks)
+}
+
+func TestSplitLongSentence(t *testing.T) {
+	long := strings.Repeat("x", 25)
+	chunks, err := Split("Short one. "+long+". Tail.", Options{Size: 10, Overlap: 2})
+	require.NoError(t, err)
+	for _, c := range chunks {
+		assert.LessOrEqual(t, utf8.RuneCountInString(c), 10)
+	}
+	assert.Equal(t, "Short one.", chunks[0])
+	assert.Equal(t, "Tail.", chunks[len(chunks)-1])
+}
+
+func TestSplitOptions(t *testing.T) {
+	chunks, err := Split("  ", Options{})
+	require.NoError(t, err)
+	assert.Empty(t, chunks)
+
+	chunks, err = Split("Hello world.", Options{})
+	require.NoError(t, err)
+	assert.Equal(t, []string{"Hello world."}, chunks)
+
+	_, err = Split("text", Options{Size: 10, Overlap: 10})
+	assert.ErrorIs(t, err, ErrInvalidOptions)
+	_, err = Split("text", Options{Size: -1})
+	assert.ErrorIs(t, err, ErrInvalidOptions)
+	_, err = Split("text", Options{Splitter: "paragraph"})
+	assert.ErrorIs(t, err, ErrInvalidOptions)
+}
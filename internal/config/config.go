@@ -1,12 +1,16 @@
 package config
 
 import (
+	"bytes"
 	"errors"
+	"fmt"
+	"io"
 	"io/fs"
 	"oasisdb/internal/embedding"
 	"oasisdb/internal/embedding/provider"
 	"oasisdb/internal/storage/filter"
 	"oasisdb/internal/storage/memtable"
+	"oasisdb/internal/tier"
 	"os"
 	"path"
 	"strings"
@@ -14,30 +18,267 @@ import (
 	"gopkg.in/yaml.v3"
 )
 
+// Config is the single configuration aggregate of OasisDB, loaded from the
+// sections of conf.yaml and threaded through db.New to every subsystem
 type Config struct {
-	Dir      string `yaml:"dir"` // dir to save sst files
-	MaxLevel int    `yaml:"max_level"`
+	Dir   string      `yaml:"dir"`   // data directory
+	Paths PathsConfig `yaml:"paths"` // parts of the data directory placed elsewhere
 
-	// SSTable Config
+	Server      ServerConfig      `yaml:"server"`
+	Storage     StorageConfig     `yaml:"storage"`
+	Index       IndexConfig       `yaml:"index"`
+	Cache       CacheConfig       `yaml:"cache"`
+	Embedding   EmbeddingConfig   `yaml:"embedding"`
+	Rerank      RerankConfig      `yaml:"rerank"`
+	Archive     ArchiveConfig     `yaml:"archive"`
+	Replication ReplicationConfig `yaml:"replication"`
+	Consensus   ConsensusConfig   `yaml:"consensus"`
+	GC          GCConfig          `yaml:"gc"`
+	Logging     LoggingConfig     `yaml:"logging"`
+	Tracing     TracingConfig     `yaml:"tracing"`
+	Audit       AuditConfig       `yaml:"audit"`
+	Trash       TrashConfig       `yaml:"trash"`
+	Watch       WatchConfig       `yaml:"watch"`
+	Tier        TierConfig        `yaml:"tier"`
+
+	Filter              filter.Filter                `yaml:"-"`
+	MemTableConstructor memtable.MemTableConstructor `yaml:"-"`
+	EmbeddingProvider   embedding.EmbeddingProvider  `yaml:"-"`
+	ColdTier            *tier.Tier                   `yaml:"-"` // opened by db.Open if tier.endpoint is set
+}
+
+// PathsConfig places parts of the data directory on other disks, e.g. the
+// WALs on a fast SSD and the SSTables on a large disk. Empty means under
+// dir, relative paths are relative to the working directory like dir
+type PathsConfig struct {
+	WAL   string `yaml:"wal"`   // memtable, index and batch WALs, defaults to <dir>/walfile
+	SST   string `yaml:"sst"`   // SSTables of the scalar storage, defaults to <dir>/sstfile
+	Index string `yaml:"index"` // saved vector indices and their configs, defaults to <dir>/indexfile
+}
+
+// GCConfig configures the removal of the files a crash left behind, which
+// runs on startup
+type GCConfig struct {
+	Disabled bool `yaml:"disabled"` // keep orphaned files
+	DryRun   bool `yaml:"dry_run"`  // only log the files that would be removed
+}
+
+// ServerConfig configures the HTTP server
+type ServerConfig struct {
+	Addr string `yaml:"addr"` // listen address, e.g. ":8080"
+
+	// Overload protection, requests over a limit get 429 with Retry-After
+	RateLimit      float64 `yaml:"rate_limit"`       // requests per second per client IP, 0 means unlimited
+	RateLimitBurst int     `yaml:"rate_limit_burst"` // requests a client may send at once, 0 means the rate rounded up
+	MaxInflight    int     `yaml:"max_inflight"`     // concurrent search and build index requests, 0 means unlimited
+
+	// Request guardrails, requests over a cap get 400, 0 means unlimited
+	MaxLimit     int   `yaml:"max_limit"`      // limit plus offset of a search, and rerank top_n
+	MaxEfSearch  int   `yaml:"max_ef_search"`  // efsearch search parameter of HNSW indices
+	MaxNProbe    int   `yaml:"max_nprobe"`     // nprobe search parameter of IVF indices
+	MaxBatchSize int   `yaml:"max_batch_size"` // documents of a batch upsert or build index
+	MaxBodyBytes int64 `yaml:"max_body_bytes"` // request body size
+
+	// Load shedding, heavy requests get 503 with Retry-After while the Go heap
+	// is over the watermark
+	MaxHeapBytes uint64 `yaml:"max_heap_bytes"` // 0 means no watermark
+
+	// Warm-up after a restart, also available at POST /v1/admin/warmup
+	WarmupOnStart  bool `yaml:"warmup_on_start"` // load indices and read SSTables into the page cache before serving
+	WarmupSearches int  `yaml:"warmup_searches"` // dummy searches run per collection by the startup warm-up
+
+	// Filters enforced on the searches and gets of the requests sent with an
+	// API key, requests with another key or none are not filtered
+	APIKeys []APIKeyConfig `yaml:"api_keys"`
+}
+
+// APIKeyConfig attaches a filter to an API key, sent as the Authorization
+// bearer token or in the X-API-Key header
+type APIKeyConfig struct {
+	KeyEnv string         `yaml:"key_env"` // env var holding the key
+	Filter map[string]any `yaml:"filter"`  // e.g. {"tenant_id": "a"}, like a collection default filter
+}
+
+// StorageConfig configures the LSM tree of the scalar storage
+type StorageConfig struct {
+	MaxLevel         int    `yaml:"max_level"`
 	SSTSize          uint64 `yaml:"sst_size"`
 	SSTNumPerLevel   uint64 `yaml:"sst_num_per_level"`
 	SSTDataBlockSize uint64 `yaml:"sst_data_block_size"`
 	SSTFooterSize    uint64 `yaml:"sst_footer_size"`
 
-	// Cache Config
-	CacheSize int `yaml:"cache_size"`
+	MmapReads bool `yaml:"mmap_reads"` // map SSTables and read blocks in place instead of copying them from the file
+
+	// compression of new SSTable data blocks, existing tables are read whatever they use
+	Compression      string `yaml:"compression"`       // none, snappy or zstd
+	CompressionLevel int    `yaml:"compression_level"` // zstd level from 1 to 22, 0 means its default
+
+	// write stalls let compaction catch up with heavy writes, negative disables a trigger
+	L0SlowdownFiles   int `yaml:"l0_slowdown_files"`   // level 0 tables from which every write is delayed
+	L0StopFiles       int `yaml:"l0_stop_files"`       // level 0 tables from which writes wait for compaction
+	MaxPendingFlushes int `yaml:"max_pending_flushes"` // full memtables waiting for a flush from which writes wait
+	WriteStallSeconds int `yaml:"write_stall_seconds"` // longest wait of a stopped write before it fails
+
+	// fsync of the memtable WAL, without it writes are lost if the machine crashes before the OS writes them back
+	WALSync             string `yaml:"wal_sync"`              // none, background or group
+	WALSyncIntervalMs   int    `yaml:"wal_sync_interval_ms"`  // period of background fsyncs
+	WALPreallocateBytes int64  `yaml:"wal_preallocate_bytes"` // disk space reserved for a new WAL, negative disables
+}
+
+// IndexConfig holds defaults for new vector indices, zero means the index's
+// built-in default and collection parameters take precedence
+type IndexConfig struct {
+	M              int `yaml:"m"`               // HNSW max connections per node
+	EfConstruction int `yaml:"ef_construction"` // HNSW build-time candidate list size
+	EfSearch       int `yaml:"ef_search"`       // HNSW query-time candidate list size
+	MaxElements    int `yaml:"max_elements"`    // initial HNSW capacity, the index grows when full
+	NList          int `yaml:"nlist"`           // IVF number of clusters
+	NProbe         int `yaml:"nprobe"`          // IVF clusters scanned per query
+	SearchThreads  int `yaml:"search_threads"`  // IVF goroutines scanning the clusters of a query, 0 means GOMAXPROCS
+	BuildThreads   int `yaml:"build_threads"`   // goroutines of HNSW batch inserts and IVF training, 0 means 4 for HNSW and GOMAXPROCS for IVF
+
+	AllowReplaceDeleted bool    `yaml:"allow_replace_deleted"` // HNSW reuses the slots of deleted elements for new documents
+	VacuumDeletedRatio  float64 `yaml:"vacuum_deleted_ratio"`  // HNSW is rebuilt without deleted elements once they are this fraction, 0 disables
+
+	ShadowRecallRate float64 `yaml:"shadow_recall_rate"` // fraction of searches checked against exact search, 0 disables
+
+	// checkpoints save an index and truncate its WAL, negative disables
+	CheckpointOps             int `yaml:"checkpoint_ops"`              // writes to a collection between checkpoints
+	CheckpointIntervalSeconds int `yaml:"checkpoint_interval_seconds"` // max age of unsaved writes
+
+	WALSegmentSize uint64 `yaml:"wal_segment_size"` // bytes per index WAL segment file
+	BulkBuildMin   int    `yaml:"bulk_build_min"`   // builds of this many vectors save the index instead of logging them, negative disables
+
+	MemoryLogIntervalSeconds int `yaml:"memory_log_interval_seconds"` // log the estimated memory of the loaded indices this often, negative disables
+
+	LoadThreads int `yaml:"load_threads"` // goroutines loading index files at startup, 0 means GOMAXPROCS
+
+	// with many collections only the used indices are kept in memory
+	LazyLoad          bool `yaml:"lazy_load"`           // load an index on the first use of its collection instead of at startup
+	IdleUnloadSeconds int  `yaml:"idle_unload_seconds"` // save and unload indices unused this long, they are loaded again on use, 0 disables
+}
+
+// CacheConfig configures the search result cache, collections may override
+// it when they are created
+type CacheConfig struct {
+	Size       int  `yaml:"size"`        // max cached entries, per collection for search results
+	Disabled   bool `yaml:"disabled"`    // don't cache search results
+	TTLSeconds int  `yaml:"ttl_seconds"` // lifetime of cached search results, 0 keeps them until evicted
+}
+
+// LoggingConfig configures the logger
+type LoggingConfig struct {
+	Level string `yaml:"level"` // debug, info, warn, error
+	File  string `yaml:"file"`  // path to log file, empty means stdout
+
+	SlowQueryMs   int    `yaml:"slow_query_ms"`   // searches taking longer are written to the slow query log, 0 disables
+	SlowQueryFile string `yaml:"slow_query_file"` // path to the slow query log, empty means the main log
+}
+
+// AuditConfig configures the audit log of destructive operations, a JSON
+// line per deleted collection or document, archive and parameter change
+type AuditConfig struct {
+	Enabled  bool   `yaml:"enabled"`
+	File     string `yaml:"file"`      // empty means <dir>/audit.log
+	MaxBytes int64  `yaml:"max_bytes"` // rotate the file at this size, negative never rotates
+	MaxFiles int    `yaml:"max_files"` // rotated files kept, the oldest is removed
+}
+
+// WatchConfig makes the server ingest the text, markdown and JSON lines files
+// dropped into a directory, like the ingest API
+type WatchConfig struct {
+	Dir             string `yaml:"dir"`              // directory to watch, empty disables it
+	Collection      string `yaml:"collection"`       // existing collection the files are ingested into
+	IntervalSeconds int    `yaml:"interval_seconds"` // how often the directory is scanned
+	ChunkSize       int    `yaml:"chunk_size"`       // characters per chunk, 0 means the chunker default
+	ChunkOverlap    int    `yaml:"chunk_overlap"`    // characters repeated from the previous chunk
+}
+
+// TierConfig moves the SSTables and saved indices not modified for a while
+// to S3 compatible object storage, they are fetched back when read
+type TierConfig struct {
+	Endpoint        string `yaml:"endpoint"`         // e.g. "https://s3.us-east-1.amazonaws.com" or "http://localhost:9000", empty disables tiering
+	Bucket          string `yaml:"bucket"`           // existing bucket
+	Prefix          string `yaml:"prefix"`           // prepended to the object keys, e.g. "node1/"
+	Region          string `yaml:"region"`           // empty means us-east-1
+	AccessKey       string `yaml:"access_key"`       // also OASISDB_TIER_ACCESS_KEY
+	SecretKey       string `yaml:"secret_key"`       // also OASISDB_TIER_SECRET_KEY, redacted from the logged config
+	AfterHours      int    `yaml:"after_hours"`      // files unmodified this long are moved
+	IntervalSeconds int    `yaml:"interval_seconds"` // how often cold files are looked for
+	CacheDir        string `yaml:"cache_dir"`        // local copies of the SSTables read, empty means <dir>/tiercache
+	CacheBytes      int64  `yaml:"cache_bytes"`      // the least recently read copies are removed above this size
+}
+
+// TrashConfig configures how long deleted collections can be restored
+// before their data is purged
+type TrashConfig struct {
+	RetentionHours int `yaml:"retention_hours"` // 0 means DefaultTrashRetention, negative deletes collections immediately
+}
+
+// TracingConfig configures the export of OpenTelemetry traces
+type TracingConfig struct {
+	Endpoint    string  `yaml:"endpoint"`     // OTLP/HTTP collector, e.g. "localhost:4318", empty disables tracing
+	Insecure    bool    `yaml:"insecure"`     // export over plain HTTP
+	SampleRate  float64 `yaml:"sample_rate"`  // fraction of traces recorded, 0 means every trace
+	ServiceName string  `yaml:"service_name"` // empty means "oasisdb"
+}
+
+// EmbeddingConfig selects the embedding provider used for `embedding: true` requests
+type EmbeddingConfig struct {
+	Provider  string `yaml:"provider"`    // aliyun, openai, ollama
+	APIKeyEnv string `yaml:"api_key_env"` // env var holding the API key, empty means provider default
+	Model     string `yaml:"model"`       // empty means provider default
+	BaseURL   string `yaml:"base_url"`    // empty means provider default
+
+	// Batch embedding for batch upsert and build index
+	BatchSize   int     `yaml:"batch_size"`  // texts per provider call
+	Concurrency int     `yaml:"concurrency"` // max in-flight provider calls
+	RateLimit   float64 `yaml:"rate_limit"`  // provider calls per second, 0 means unlimited
+}
+
+// RerankConfig holds defaults for search rerankers, requests may override the model
+type RerankConfig struct {
+	TopN      int    `yaml:"top_n"`       // candidates fetched before reranking, 0 means 3x the limit
+	APIKeyEnv string `yaml:"api_key_env"` // env var holding the rerank API key, empty means default
+	Model     string `yaml:"model"`       // API reranker model, empty means default
+	BaseURL   string `yaml:"base_url"`    // Cohere/Jina-compatible API, empty means default
+}
 
-	// Logging Config
-	LogLevel string `yaml:"log_level"` // debug, info, warn, error
-	LogFile  string `yaml:"log_file"`  // path to log file, empty means stdout
+// ArchiveConfig configures read tracking and the archiving of cold documents
+type ArchiveConfig struct {
+	AfterDays            int     `yaml:"after_days"`             // archive documents unread for this many days, 0 disables the job
+	IntervalMinutes      int     `yaml:"interval_minutes"`       // how often the archiving job runs
+	AccessSampleRate     float64 `yaml:"access_sample_rate"`     // fraction of reads recorded, 0 means every read
+	FlushIntervalSeconds int     `yaml:"flush_interval_seconds"` // how often recorded reads are persisted
+}
 
-	Filter              filter.Filter
-	MemTableConstructor memtable.MemTableConstructor
-	EmbeddingProvider   embedding.EmbeddingProvider
+// ReplicationConfig configures asynchronous replication. A leader keeps its
+// latest writes in memory for followers to fetch, a follower is read-only and
+// must start from a copy of the leader's data directory
+type ReplicationConfig struct {
+	Leader  string `yaml:"leader"`   // address of the leader, e.g. "http://10.0.0.1:8080", makes this server a follower
+	LogSize int    `yaml:"log_size"` // writes kept for followers to fetch, negative disables serving followers
 }
+
+// ConsensusConfig configures the raft mode, where collection and document
+// writes are committed through a raft log before the nodes apply them
+type ConsensusConfig struct {
+	NodeID              string       `yaml:"node_id"`               // ID of this node among the peers, empty disables raft
+	Peers               []PeerConfig `yaml:"peers"`                 // every node of the cluster, including this one
+	ApplyTimeoutSeconds int          `yaml:"apply_timeout_seconds"` // how long a write waits to be committed
+}
+
+// PeerConfig is a node of a raft cluster
+type PeerConfig struct {
+	ID       string `yaml:"id"`
+	RaftAddr string `yaml:"raft_addr"` // address of the raft transport, e.g. "10.0.0.1:7000"
+	HTTPAddr string `yaml:"http_addr"` // address of the API writes are forwarded to, e.g. "http://10.0.0.1:8080"
+}
+
 type ConfigOption func(*Config)
 
 const (
+	DefaultServerAddr       = ":8080"
 	DefaultMaxLevel         = 7
 	DefaultSSTSize          = 1024 * 1024 // 1MB
 	DefaultSSTNumPerLevel   = 10
@@ -46,36 +287,140 @@ const (
 	DefaultCacheSize        = 10
 	DefaultLogLevel         = "info"
 	DefaultLogFile          = ""
+	DefaultArchiveInterval  = 60 // minutes
+	DefaultAccessFlush      = 30 // seconds
+	DefaultCheckpointOps    = 10000
+	DefaultCheckpointPeriod = 300              // seconds
+	DefaultWALSegmentSize   = 64 * 1024 * 1024 // 64MB
+	DefaultBulkBuildMin     = 10000
+	DefaultMemoryLogPeriod  = 600 // seconds
+	DefaultReplicationLog   = 100000
+	DefaultApplyTimeout     = 10                // seconds
+	DefaultAuditMaxBytes    = 100 * 1024 * 1024 // 100MB
+	DefaultAuditMaxFiles    = 10
+	DefaultTrashRetention   = 24 // hours
+	DefaultL0SlowdownFiles  = 20
+	DefaultL0StopFiles      = 36
+	DefaultPendingFlushes   = 8
+	DefaultWriteStall       = 5   // seconds
+	DefaultWALSyncInterval  = 100 // ms
+	DefaultWatchInterval    = 10  // seconds
+	DefaultTierRegion       = "us-east-1"
+	DefaultTierAfter        = 24 * 7             // hours
+	DefaultTierInterval     = 600                // seconds
+	DefaultTierCacheBytes   = 1024 * 1024 * 1024 // 1GB
 )
 
 func NewConfig(dir string, opts ...ConfigOption) (*Config, error) {
 	c := Config{
-		Dir:           dir,
-		SSTFooterSize: DefaultSSTFooterSize,
-		CacheSize:     DefaultCacheSize,
-		LogLevel:      DefaultLogLevel,
-		LogFile:       DefaultLogFile,
+		Dir:     dir,
+		Server:  ServerConfig{Addr: DefaultServerAddr},
+		Storage: StorageConfig{SSTFooterSize: DefaultSSTFooterSize},
+		Cache:   CacheConfig{Size: DefaultCacheSize},
+		Logging: LoggingConfig{Level: DefaultLogLevel, File: DefaultLogFile},
 	}
 	for _, opt := range opts {
 		opt(&c)
 	}
-	if c.MaxLevel <= 1 {
-		c.MaxLevel = DefaultMaxLevel
+	if c.Server.Addr == "" {
+		c.Server.Addr = DefaultServerAddr
+	}
+	if c.Storage.MaxLevel <= 1 {
+		c.Storage.MaxLevel = DefaultMaxLevel
+	}
+	if c.Storage.SSTSize <= 0 {
+		c.Storage.SSTSize = DefaultSSTSize
+	}
+	if c.Storage.SSTNumPerLevel <= 0 {
+		c.Storage.SSTNumPerLevel = DefaultSSTNumPerLevel
+	}
+	if c.Storage.SSTDataBlockSize <= 0 {
+		c.Storage.SSTDataBlockSize = DefaultSSTDataBlockSize
+	}
+	if c.Storage.SSTFooterSize <= 0 {
+		c.Storage.SSTFooterSize = DefaultSSTFooterSize
+	}
+	if c.Storage.L0SlowdownFiles == 0 {
+		c.Storage.L0SlowdownFiles = DefaultL0SlowdownFiles
+	}
+	if c.Storage.L0StopFiles == 0 {
+		c.Storage.L0StopFiles = DefaultL0StopFiles
+	}
+	if c.Storage.MaxPendingFlushes == 0 {
+		c.Storage.MaxPendingFlushes = DefaultPendingFlushes
+	}
+	if c.Storage.WriteStallSeconds == 0 {
+		c.Storage.WriteStallSeconds = DefaultWriteStall
+	}
+	if c.Storage.WALSyncIntervalMs == 0 {
+		c.Storage.WALSyncIntervalMs = DefaultWALSyncInterval
+	}
+	if c.Storage.WALPreallocateBytes == 0 {
+		// a WAL grows to about the size of its memtable
+		c.Storage.WALPreallocateBytes = int64(c.Storage.SSTSize)
 	}
-	if c.SSTSize <= 0 {
-		c.SSTSize = DefaultSSTSize
+	if c.Cache.Size <= 0 {
+		c.Cache.Size = DefaultCacheSize
 	}
-	if c.SSTNumPerLevel <= 0 {
-		c.SSTNumPerLevel = DefaultSSTNumPerLevel
+	if c.Logging.Level == "" {
+		c.Logging.Level = DefaultLogLevel
 	}
-	if c.SSTDataBlockSize <= 0 {
-		c.SSTDataBlockSize = DefaultSSTDataBlockSize
+	if c.Index.CheckpointOps == 0 {
+		c.Index.CheckpointOps = DefaultCheckpointOps
 	}
-	if c.SSTFooterSize <= 0 {
-		c.SSTFooterSize = DefaultSSTFooterSize
+	if c.Index.CheckpointIntervalSeconds == 0 {
+		c.Index.CheckpointIntervalSeconds = DefaultCheckpointPeriod
 	}
-	if c.CacheSize <= 0 {
-		c.CacheSize = DefaultCacheSize
+	if c.Index.WALSegmentSize == 0 {
+		c.Index.WALSegmentSize = DefaultWALSegmentSize
+	}
+	if c.Index.BulkBuildMin == 0 {
+		c.Index.BulkBuildMin = DefaultBulkBuildMin
+	}
+	if c.Index.MemoryLogIntervalSeconds == 0 {
+		c.Index.MemoryLogIntervalSeconds = DefaultMemoryLogPeriod
+	}
+	if c.Replication.LogSize == 0 {
+		c.Replication.LogSize = DefaultReplicationLog
+	}
+	if c.Consensus.ApplyTimeoutSeconds <= 0 {
+		c.Consensus.ApplyTimeoutSeconds = DefaultApplyTimeout
+	}
+	if c.Audit.File == "" {
+		c.Audit.File = path.Join(c.Dir, "audit.log")
+	}
+	if c.Audit.MaxBytes == 0 {
+		c.Audit.MaxBytes = DefaultAuditMaxBytes
+	}
+	if c.Audit.MaxFiles <= 0 {
+		c.Audit.MaxFiles = DefaultAuditMaxFiles
+	}
+	if c.Trash.RetentionHours == 0 {
+		c.Trash.RetentionHours = DefaultTrashRetention
+	}
+	if c.Watch.IntervalSeconds == 0 {
+		c.Watch.IntervalSeconds = DefaultWatchInterval
+	}
+	if c.Tier.Region == "" {
+		c.Tier.Region = DefaultTierRegion
+	}
+	if c.Tier.AfterHours == 0 {
+		c.Tier.AfterHours = DefaultTierAfter
+	}
+	if c.Tier.IntervalSeconds == 0 {
+		c.Tier.IntervalSeconds = DefaultTierInterval
+	}
+	if c.Tier.CacheDir == "" {
+		c.Tier.CacheDir = path.Join(c.Dir, "tiercache")
+	}
+	if c.Tier.CacheBytes == 0 {
+		c.Tier.CacheBytes = DefaultTierCacheBytes
+	}
+	if c.Archive.IntervalMinutes <= 0 {
+		c.Archive.IntervalMinutes = DefaultArchiveInterval
+	}
+	if c.Archive.FlushIntervalSeconds <= 0 {
+		c.Archive.FlushIntervalSeconds = DefaultAccessFlush
 	}
 	if c.Filter == nil {
 		c.Filter = filter.NewBloomFilter(1024)
@@ -83,8 +428,30 @@ func NewConfig(dir string, opts ...ConfigOption) (*Config, error) {
 	if c.MemTableConstructor == nil {
 		c.MemTableConstructor = memtable.NewSkipList
 	}
+	if c.Embedding.Provider == "" {
+		c.Embedding.Provider = provider.DefaultProvider
+	}
+	if c.Embedding.BatchSize <= 0 {
+		c.Embedding.BatchSize = embedding.DefaultBatchSize
+	}
+	if c.Embedding.Concurrency <= 0 {
+		c.Embedding.Concurrency = embedding.DefaultConcurrency
+	}
 	if c.EmbeddingProvider == nil {
-		c.EmbeddingProvider, _ = provider.NewAliyunEmbeddingProvider()
+		// embedding is optional, a missing API key only disables it
+		embeddingProvider, err := provider.New(provider.Options{
+			Name:      c.Embedding.Provider,
+			APIKeyEnv: c.Embedding.APIKeyEnv,
+			Model:     c.Embedding.Model,
+			BaseURL:   c.Embedding.BaseURL,
+		})
+		if errors.Is(err, provider.ErrUnknownProvider) {
+			return nil, err
+		}
+		c.EmbeddingProvider = embeddingProvider
+	}
+	if err := c.Validate(); err != nil {
+		return nil, err
 	}
 	return &c, c.Check()
 }
@@ -100,47 +467,99 @@ func (c *Config) Check() error {
 		}
 	}
 
-	// Create WAL directory if not exists
-	if err := os.MkdirAll(path.Join(c.Dir, "walfile", "memtable"), 0755); err != nil {
-		return err
-	}
-	if err := os.MkdirAll(path.Join(c.Dir, "walfile", "index"), 0755); err != nil {
-		return err
+	// Create the WAL, index and SST directories if not exists
+	for _, dir := range []string{c.MemTableWALDir(), c.IndexWALDir(), c.BatchWALDir(), c.IndexDir(), c.SSTDir()} {
+		if err := os.MkdirAll(dir, 0755); err != nil {
+			return err
+		}
 	}
-	// Create index directory if not exists
-	if err := os.MkdirAll(path.Join(c.Dir, "indexfile"), 0755); err != nil {
-		return err
+	return nil
+}
+
+// WALDir returns the directory holding the WALs of every kind
+func (c *Config) WALDir() string {
+	if c.Paths.WAL != "" {
+		return c.Paths.WAL
 	}
-	// Create SST directory if not exists
-	if err := os.MkdirAll(path.Join(c.Dir, "sstfile"), 0755); err != nil {
-		return err
+	return path.Join(c.Dir, "walfile")
+}
+
+// MemTableWALDir returns the directory of the WALs of the scalar storage
+// memtables
+func (c *Config) MemTableWALDir() string {
+	return path.Join(c.WALDir(), "memtable")
+}
+
+// IndexWALDir returns the directory holding a WAL directory per collection
+func (c *Config) IndexWALDir() string {
+	return path.Join(c.WALDir(), "index")
+}
+
+// BatchWALDir returns the directory of the batch log
+func (c *Config) BatchWALDir() string {
+	return path.Join(c.WALDir(), "batch")
+}
+
+// SSTDir returns the directory of the SSTables
+func (c *Config) SSTDir() string {
+	if c.Paths.SST != "" {
+		return c.Paths.SST
 	}
+	return path.Join(c.Dir, "sstfile")
+}
 
-	return nil
+// IndexDir returns the directory of the saved vector indices
+func (c *Config) IndexDir() string {
+	if c.Paths.Index != "" {
+		return c.Paths.Index
+	}
+	return path.Join(c.Dir, "indexfile")
 }
 
-// FromFile reads configuration from a YAML file
+// FromFile reads configuration from a YAML file, then applies OASISDB_*
+// environment overrides, see applyEnvOverrides
 func FromFile(filename string) (*Config, error) {
 	data, err := os.ReadFile(filename)
 	if err != nil {
 		return nil, err
 	}
 
-	var config Config
-	if err := yaml.Unmarshal(data, &config); err != nil {
+	// unknown keys are rejected, a misspelled key would silently keep its default
+	var file struct {
+		Config       `yaml:",inline"`
+		legacyConfig `yaml:",inline"`
+	}
+	decoder := yaml.NewDecoder(bytes.NewReader(data))
+	decoder.KnownFields(true)
+	if err := decoder.Decode(&file); err != nil && err != io.EOF {
+		return nil, fmt.Errorf("invalid config file %s: %w", filename, err)
+	}
+	config := file.Config
+	file.legacyConfig.apply(&config)
+
+	if err := applyEnvOverrides(&config); err != nil {
 		return nil, err
 	}
 
 	// Create config with options from file
 	opts := []ConfigOption{
-		WithMaxLevel(config.MaxLevel),
-		WithSSTSize(config.SSTSize),
-		WithSSTNumPerLevel(config.SSTNumPerLevel),
-		WithSSTDataBlockSize(config.SSTDataBlockSize),
-		WithSSTFooterSize(config.SSTFooterSize),
-		WithCacheSize(config.CacheSize),
-		WithLogLevel(config.LogLevel),
-		WithLogFile(config.LogFile),
+		WithPaths(config.Paths),
+		WithServer(config.Server),
+		WithStorage(config.Storage),
+		WithIndex(config.Index),
+		WithCache(config.Cache),
+		WithLogging(config.Logging),
+		WithTracing(config.Tracing),
+		WithEmbedding(config.Embedding),
+		WithRerank(config.Rerank),
+		WithArchive(config.Archive),
+		WithReplication(config.Replication),
+		WithConsensus(config.Consensus),
+		WithGC(config.GC),
+		WithAudit(config.Audit),
+		WithTrash(config.Trash),
+		WithWatch(config.Watch),
+		WithTier(config.Tier),
 	}
 
 	return NewConfig(config.Dir, opts...)
@@ -149,35 +568,35 @@ func FromFile(filename string) (*Config, error) {
 // WithMaxLevel set max level of lsm tree
 func WithMaxLevel(maxLevel int) ConfigOption {
 	return func(c *Config) {
-		c.MaxLevel = maxLevel
+		c.Storage.MaxLevel = maxLevel
 	}
 }
 
 // WithSSTSize set sstable size
 func WithSSTSize(sstSize uint64) ConfigOption {
 	return func(c *Config) {
-		c.SSTSize = sstSize
+		c.Storage.SSTSize = sstSize
 	}
 }
 
 // WithSSTFooterSize set sstable footer size
 func WithSSTFooterSize(sstFooterSize uint64) ConfigOption {
 	return func(c *Config) {
-		c.SSTFooterSize = sstFooterSize
+		c.Storage.SSTFooterSize = sstFooterSize
 	}
 }
 
 // WithSSTNumPerLevel set sstable num per level
 func WithSSTNumPerLevel(sstNumPerLevel uint64) ConfigOption {
 	return func(c *Config) {
-		c.SSTNumPerLevel = sstNumPerLevel
+		c.Storage.SSTNumPerLevel = sstNumPerLevel
 	}
 }
 
 // WithSSTDataBlockSize set sstable data block size
 func WithSSTDataBlockSize(sstDataBlockSize uint64) ConfigOption {
 	return func(c *Config) {
-		c.SSTDataBlockSize = sstDataBlockSize
+		c.Storage.SSTDataBlockSize = sstDataBlockSize
 	}
 }
 
@@ -198,20 +617,139 @@ func WithMemTableConstructor(constructor memtable.MemTableConstructor) ConfigOpt
 // WithCacheSize set cache size
 func WithCacheSize(cacheSize int) ConfigOption {
 	return func(c *Config) {
-		c.CacheSize = cacheSize
+		c.Cache.Size = cacheSize
 	}
 }
 
 // WithLogLevel set log level
 func WithLogLevel(logLevel string) ConfigOption {
 	return func(c *Config) {
-		c.LogLevel = logLevel
+		c.Logging.Level = logLevel
 	}
 }
 
 // WithLogFile set log file path
 func WithLogFile(logFile string) ConfigOption {
 	return func(c *Config) {
-		c.LogFile = logFile
+		c.Logging.File = logFile
+	}
+}
+
+// WithEmbedding set embedding provider config
+func WithEmbedding(embedding EmbeddingConfig) ConfigOption {
+	return func(c *Config) {
+		c.Embedding = embedding
+	}
+}
+
+// WithRerank set reranker defaults
+func WithRerank(rerank RerankConfig) ConfigOption {
+	return func(c *Config) {
+		c.Rerank = rerank
+	}
+}
+
+// WithArchive set archiving config
+func WithArchive(archive ArchiveConfig) ConfigOption {
+	return func(c *Config) {
+		c.Archive = archive
+	}
+}
+
+// WithReplication set replication config
+func WithReplication(replication ReplicationConfig) ConfigOption {
+	return func(c *Config) {
+		c.Replication = replication
+	}
+}
+
+// WithConsensus set raft config
+func WithConsensus(consensus ConsensusConfig) ConfigOption {
+	return func(c *Config) {
+		c.Consensus = consensus
+	}
+}
+
+// WithPaths set the directories placed outside the data directory
+func WithPaths(paths PathsConfig) ConfigOption {
+	return func(c *Config) {
+		c.Paths = paths
+	}
+}
+
+// WithGC set the startup garbage collection config
+func WithGC(gc GCConfig) ConfigOption {
+	return func(c *Config) {
+		c.GC = gc
+	}
+}
+
+// WithAudit set the audit log config
+func WithAudit(audit AuditConfig) ConfigOption {
+	return func(c *Config) {
+		c.Audit = audit
+	}
+}
+
+// WithTrash set the retention of deleted collections
+func WithTrash(trash TrashConfig) ConfigOption {
+	return func(c *Config) {
+		c.Trash = trash
+	}
+}
+
+// WithTier set the object storage cold files are moved to
+func WithTier(tier TierConfig) ConfigOption {
+	return func(c *Config) {
+		c.Tier = tier
+	}
+}
+
+// WithWatch set the directory whose files are ingested
+func WithWatch(watch WatchConfig) ConfigOption {
+	return func(c *Config) {
+		c.Watch = watch
+	}
+}
+
+// WithServer set server config
+func WithServer(server ServerConfig) ConfigOption {
+	return func(c *Config) {
+		c.Server = server
+	}
+}
+
+// WithStorage set storage config
+func WithStorage(storage StorageConfig) ConfigOption {
+	return func(c *Config) {
+		c.Storage = storage
+	}
+}
+
+// WithIndex set index defaults
+func WithIndex(index IndexConfig) ConfigOption {
+	return func(c *Config) {
+		c.Index = index
+	}
+}
+
+// WithCache set cache config
+func WithCache(cache CacheConfig) ConfigOption {
+	return func(c *Config) {
+		c.Cache = cache
+	}
+}
+
+// WithLogging set logging config
+func WithLogging(logging LoggingConfig) ConfigOption {
+	return func(c *Config) {
+		c.Logging = logging
+	}
+}
+
+// WithTracing set tracing config
+func WithTracing(tracing TracingConfig) ConfigOption {
+	return func(c *Config) {
+		c.Tracing = tracing
 	}
 }
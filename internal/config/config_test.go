@@ -21,6 +21,12 @@ sst_num_per_level: 4
 sst_data_block_size: 16384
 sst_footer_size: 32
 cache_size: 10
+embedding:
+  provider: ollama
+  model: nomic-embed-text
+  base_url: http://localhost:11434
+  batch_size: 32
+  rate_limit: 5
 `
 	err := os.WriteFile(testConfigPath, []byte(testConfig), 0644)
 	assert.NoError(t, err)
@@ -32,17 +38,237 @@ cache_size: 10
 
 	// Verify the values
 	assert.Equal(t, "../../", cfg.Dir)
-	assert.Equal(t, 7, cfg.MaxLevel)
-	assert.Equal(t, uint64(1048576), cfg.SSTSize)
-	assert.Equal(t, uint64(4), cfg.SSTNumPerLevel)
-	assert.Equal(t, uint64(16384), cfg.SSTDataBlockSize)
-	assert.Equal(t, uint64(32), cfg.SSTFooterSize)
-	assert.Equal(t, 10, cfg.CacheSize)
+	assert.Equal(t, 7, cfg.Storage.MaxLevel)
+	assert.Equal(t, uint64(1048576), cfg.Storage.SSTSize)
+	assert.Equal(t, uint64(4), cfg.Storage.SSTNumPerLevel)
+	assert.Equal(t, uint64(16384), cfg.Storage.SSTDataBlockSize)
+	assert.Equal(t, uint64(32), cfg.Storage.SSTFooterSize)
+	assert.Equal(t, 10, cfg.Cache.Size)
 	assert.NotNil(t, cfg.Filter)
 	assert.NotNil(t, cfg.MemTableConstructor)
+	assert.Equal(t, "ollama", cfg.Embedding.Provider)
+	assert.Equal(t, "nomic-embed-text", cfg.Embedding.Model)
+	assert.Equal(t, 32, cfg.Embedding.BatchSize)
+	assert.Equal(t, 4, cfg.Embedding.Concurrency)
+	assert.Equal(t, 5.0, cfg.Embedding.RateLimit)
+	assert.NotNil(t, cfg.EmbeddingProvider)
 
 	// Test with non-existent file
 	cfg, err = FromFile("non_existent_file.yaml")
 	assert.Error(t, err)
 	assert.Nil(t, cfg)
 }
+
+func TestNewConfigUnknownEmbeddingProvider(t *testing.T) {
+	_, err := NewConfig(t.TempDir(), WithEmbedding(EmbeddingConfig{Provider: "unknown"}))
+	assert.Error(t, err)
+}
+
+func TestFromFileSections(t *testing.T) {
+	tmpDir := t.TempDir()
+	testConfigPath := path.Join(tmpDir, "test_config.yaml")
+
+	testConfig := `
+dir: ` + tmpDir + `
+server:
+  addr: ":9090"
+storage:
+  max_level: 5
+  sst_size: 2048
+cache:
+  size: 20
+index:
+  m: 32
+  ef_search: 64
+logging:
+  level: debug
+embedding:
+  provider: ollama
+`
+	assert.NoError(t, os.WriteFile(testConfigPath, []byte(testConfig), 0644))
+
+	t.Setenv("OASISDB_SERVER_ADDR", ":7070")
+	t.Setenv("OASISDB_STORAGE_SST_SIZE", "4096")
+	t.Setenv("OASISDB_INDEX_NLIST", "50")
+	t.Setenv("OASISDB_EMBEDDING_RATE_LIMIT", "2.5")
+	t.Setenv("OASISDB_CACHE_TTL_SECONDS", "60")
+	t.Setenv("OASISDB_CACHE_DISABLED", "true")
+
+	cfg, err := FromFile(testConfigPath)
+	assert.NoError(t, err)
+	assert.Equal(t, ":7070", cfg.Server.Addr)
+	assert.Equal(t, 5, cfg.Storage.MaxLevel)
+	assert.Equal(t, uint64(4096), cfg.Storage.SSTSize)
+	assert.Equal(t, uint64(DefaultSSTNumPerLevel), cfg.Storage.SSTNumPerLevel)
+	assert.Equal(t, CacheConfig{Size: 20, Disabled: true, TTLSeconds: 60}, cfg.Cache)
+	assert.Equal(t, 32, cfg.Index.M)
+	assert.Equal(t, 64, cfg.Index.EfSearch)
+	assert.Equal(t, 50, cfg.Index.NList)
+	assert.Equal(t, "debug", cfg.Logging.Level)
+	assert.Equal(t, 2.5, cfg.Embedding.RateLimit)
+
+	t.Setenv("OASISDB_CACHE_SIZE", "many")
+	_, err = FromFile(testConfigPath)
+	assert.ErrorContains(t, err, "OASISDB_CACHE_SIZE")
+}
+
+func TestNewConfigDefaults(t *testing.T) {
+	cfg, err := NewConfig(t.TempDir())
+	assert.NoError(t, err)
+	assert.Equal(t, DefaultServerAddr, cfg.Server.Addr)
+	assert.Equal(t, DefaultMaxLevel, cfg.Storage.MaxLevel)
+	assert.Equal(t, DefaultL0StopFiles, cfg.Storage.L0StopFiles)
+	assert.Equal(t, DefaultWriteStall, cfg.Storage.WriteStallSeconds)
+	assert.Equal(t, int64(DefaultSSTSize), cfg.Storage.WALPreallocateBytes)
+	assert.Equal(t, DefaultCacheSize, cfg.Cache.Size)
+	assert.Equal(t, DefaultLogLevel, cfg.Logging.Level)
+	assert.Equal(t, IndexConfig{
+		CheckpointOps:             DefaultCheckpointOps,
+		CheckpointIntervalSeconds: DefaultCheckpointPeriod,
+		WALSegmentSize:            DefaultWALSegmentSize,
+		BulkBuildMin:              DefaultBulkBuildMin,
+		MemoryLogIntervalSeconds:  DefaultMemoryLogPeriod,
+	}, cfg.Index)
+	assert.Equal(t, ReplicationConfig{LogSize: DefaultReplicationLog}, cfg.Replication)
+	assert.Equal(t, ConsensusConfig{ApplyTimeoutSeconds: DefaultApplyTimeout}, cfg.Consensus)
+}
+
+func TestFromFilePaths(t *testing.T) {
+	tmpDir, walDir, sstDir, indexDir := t.TempDir(), t.TempDir(), t.TempDir(), t.TempDir()
+	testConfigPath := path.Join(tmpDir, "test_config.yaml")
+	testConfig := `
+dir: ` + tmpDir + `
+paths:
+  wal: ` + walDir + `
+  sst: ` + sstDir + `
+`
+	assert.NoError(t, os.WriteFile(testConfigPath, []byte(testConfig), 0644))
+	t.Setenv("OASISDB_PATHS_INDEX", indexDir)
+
+	cfg, err := FromFile(testConfigPath)
+	assert.NoError(t, err)
+	assert.Equal(t, path.Join(walDir, "memtable"), cfg.MemTableWALDir())
+	assert.Equal(t, path.Join(walDir, "index"), cfg.IndexWALDir())
+	assert.Equal(t, path.Join(walDir, "batch"), cfg.BatchWALDir())
+	assert.Equal(t, sstDir, cfg.SSTDir())
+	assert.Equal(t, indexDir, cfg.IndexDir())
+	for _, dir := range []string{cfg.MemTableWALDir(), cfg.IndexWALDir(), cfg.BatchWALDir()} {
+		assert.DirExists(t, dir)
+	}
+	assert.NoDirExists(t, path.Join(tmpDir, "walfile"))
+
+	// without paths everything lives under dir
+	cfg, err = NewConfig(tmpDir)
+	assert.NoError(t, err)
+	assert.Equal(t, path.Join(tmpDir, "walfile", "memtable"), cfg.MemTableWALDir())
+	assert.Equal(t, path.Join(tmpDir, "sstfile"), cfg.SSTDir())
+	assert.Equal(t, path.Join(tmpDir, "indexfile"), cfg.IndexDir())
+}
+
+func TestFromFileValidation(t *testing.T) {
+	tmpDir := t.TempDir()
+	testConfigPath := path.Join(tmpDir, "test_config.yaml")
+	write := func(content string) {
+		assert.NoError(t, os.WriteFile(testConfigPath, []byte(content), 0644))
+	}
+
+	// a misspelled key is an error instead of a silent default
+	write("dir: " + tmpDir + "\nindex:\n  nlsit: 10\n")
+	_, err := FromFile(testConfigPath)
+	assert.ErrorContains(t, err, "nlsit")
+
+	// every invalid value is reported
+	write("dir: " + tmpDir + `
+storage:
+  compression: lz4
+  l0_stop_files: 5
+  wal_sync: always
+index:
+  shadow_recall_rate: 2
+logging:
+  level: verbose
+`)
+	_, err = FromFile(testConfigPath)
+	assert.ErrorContains(t, err, "storage.compression must be one of none, snappy, zstd")
+	assert.ErrorContains(t, err, "storage.l0_stop_files must be above storage.sst_num_per_level (10)")
+	assert.ErrorContains(t, err, "storage.wal_sync must be one of none, background, group")
+	assert.ErrorContains(t, err, "index.shadow_recall_rate")
+	assert.ErrorContains(t, err, "logging.level")
+
+	write("")
+	_, err = FromFile(testConfigPath)
+	assert.ErrorContains(t, err, "dir must be set")
+
+	t.Setenv("OASISDB_DIR", tmpDir)
+	t.Setenv("OASISDB_PORT", "9090")
+	cfg, err := FromFile(testConfigPath)
+	assert.NoError(t, err)
+	assert.Equal(t, tmpDir, cfg.Dir)
+	assert.Equal(t, ":9090", cfg.Server.Addr)
+	assert.Contains(t, cfg.Dump(), `addr: :9090`)
+
+	t.Setenv("OASISDB_SERVER_ADDR", "127.0.0.1:8080")
+	cfg, err = FromFile(testConfigPath)
+	assert.NoError(t, err)
+	assert.Equal(t, "127.0.0.1:9090", cfg.Server.Addr)
+
+	t.Setenv("OASISDB_PORT", "http")
+	_, err = FromFile(testConfigPath)
+	assert.ErrorContains(t, err, "OASISDB_PORT")
+}
+
+func TestFromFileTier(t *testing.T) {
+	tmpDir := t.TempDir()
+	testConfigPath := path.Join(tmpDir, "conf.yaml")
+	write := func(content string) {
+		assert.NoError(t, os.WriteFile(testConfigPath, []byte(content), 0644))
+	}
+
+	write("dir: " + tmpDir + `
+tier:
+  endpoint: http://localhost:9000
+  cache_bytes: -1
+`)
+	_, err := FromFile(testConfigPath)
+	assert.ErrorContains(t, err, "tier.bucket must be set")
+	assert.ErrorContains(t, err, "tier.cache_bytes must not be negative")
+
+	write("dir: " + tmpDir + `
+tier:
+  endpoint: http://localhost:9000
+  bucket: oasisdb
+`)
+	t.Setenv("OASISDB_TIER_SECRET_KEY", "hunter2")
+	cfg, err := FromFile(testConfigPath)
+	assert.NoError(t, err)
+	assert.Equal(t, "hunter2", cfg.Tier.SecretKey)
+	assert.Equal(t, DefaultTierRegion, cfg.Tier.Region)
+	assert.Equal(t, path.Join(tmpDir, "tiercache"), cfg.Tier.CacheDir)
+	assert.NotContains(t, cfg.Dump(), "hunter2")
+}
+
+func TestFromFileRepoConfig(t *testing.T) {
+	// the shipped conf.yaml only holds known keys
+	data, err := os.ReadFile("../../conf.yaml")
+	assert.NoError(t, err)
+	testConfigPath := path.Join(t.TempDir(), "conf.yaml")
+	assert.NoError(t, os.WriteFile(testConfigPath, data, 0644))
+	t.Setenv("OASISDB_DIR", t.TempDir())
+	_, err = FromFile(testConfigPath)
+	assert.NoError(t, err)
+}
+
+func TestDiff(t *testing.T) {
+	a, err := NewConfig(t.TempDir())
+	assert.NoError(t, err)
+	b := *a
+	assert.Empty(t, Diff(a, &b))
+
+	b.Dir = t.TempDir()
+	b.Server.RateLimit = 10
+	b.Storage.MaxLevel = 3
+	b.Consensus.Peers = []PeerConfig{{ID: "1"}}
+	assert.Equal(t, []string{"dir", "server.rate_limit", "storage.max_level", "consensus.peers"}, Diff(a, &b))
+	assert.True(t, IsReloadable("server.rate_limit"))
+	assert.False(t, IsReloadable("storage.max_level"))
+}
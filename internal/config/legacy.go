@@ -0,0 +1,42 @@
+package config
+
+// legacyConfig holds the flat top-level keys used before conf.yaml was split
+// into sections, so existing files keep working
+type legacyConfig struct {
+	MaxLevel         int    `yaml:"max_level"`
+	SSTSize          uint64 `yaml:"sst_size"`
+	SSTNumPerLevel   uint64 `yaml:"sst_num_per_level"`
+	SSTDataBlockSize uint64 `yaml:"sst_data_block_size"`
+	SSTFooterSize    uint64 `yaml:"sst_footer_size"`
+	CacheSize        int    `yaml:"cache_size"`
+	LogLevel         string `yaml:"log_level"`
+	LogFile          string `yaml:"log_file"`
+}
+
+// apply copies legacy keys into sections that don't set them
+func (l *legacyConfig) apply(c *Config) {
+	if c.Storage.MaxLevel == 0 {
+		c.Storage.MaxLevel = l.MaxLevel
+	}
+	if c.Storage.SSTSize == 0 {
+		c.Storage.SSTSize = l.SSTSize
+	}
+	if c.Storage.SSTNumPerLevel == 0 {
+		c.Storage.SSTNumPerLevel = l.SSTNumPerLevel
+	}
+	if c.Storage.SSTDataBlockSize == 0 {
+		c.Storage.SSTDataBlockSize = l.SSTDataBlockSize
+	}
+	if c.Storage.SSTFooterSize == 0 {
+		c.Storage.SSTFooterSize = l.SSTFooterSize
+	}
+	if c.Cache.Size == 0 {
+		c.Cache.Size = l.CacheSize
+	}
+	if c.Logging.Level == "" {
+		c.Logging.Level = l.LogLevel
+	}
+	if c.Logging.File == "" {
+		c.Logging.File = l.LogFile
+	}
+}
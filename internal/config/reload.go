@@ -0,0 +1,50 @@
+package config
+
+import (
+	"reflect"
+	"slices"
+	"strings"
+)
+
+// Reloadable are the keys a running server applies when its config is
+// reloaded, changing any other key needs a restart
+var Reloadable = []string{
+	"logging.level",
+	"logging.slow_query_ms",
+	"server.rate_limit",
+	"server.rate_limit_burst",
+	"cache.size",
+	"cache.ttl_seconds",
+	"cache.disabled",
+}
+
+// IsReloadable reports whether a key of Diff can be changed without a restart
+func IsReloadable(key string) bool {
+	return slices.Contains(Reloadable, key)
+}
+
+// Diff returns the yaml paths of the values that differ between two configs,
+// e.g. server.rate_limit, in the order of the config
+func Diff(a, b *Config) []string {
+	var keys []string
+	diff(reflect.ValueOf(a).Elem(), reflect.ValueOf(b).Elem(), "", &keys)
+	return keys
+}
+
+func diff(a, b reflect.Value, prefix string, keys *[]string) {
+	t := a.Type()
+	for i := 0; i < t.NumField(); i++ {
+		tag := strings.Split(t.Field(i).Tag.Get("yaml"), ",")[0]
+		if tag == "" || tag == "-" {
+			continue
+		}
+		key := prefix + tag
+		if a.Field(i).Kind() == reflect.Struct {
+			diff(a.Field(i), b.Field(i), key+".", keys)
+			continue
+		}
+		if !reflect.DeepEqual(a.Field(i).Interface(), b.Field(i).Interface()) {
+			*keys = append(*keys, key)
+		}
+	}
+}
@@ -0,0 +1,154 @@
+package config
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"slices"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// Validate checks the ranges of the values once the defaults are applied,
+// every invalid value is reported with the key to fix
+func (c *Config) Validate() error {
+	v := &validator{}
+
+	v.check(c.Dir != "", "dir must be set to the data directory, e.g. dir: ./data or OASISDB_DIR=./data")
+	if _, _, err := net.SplitHostPort(c.Server.Addr); err != nil {
+		v.fail("server.addr must be host:port or :port, e.g. \":8080\", got %q", c.Server.Addr)
+	}
+	nonNegative(v, "server.rate_limit", c.Server.RateLimit)
+	nonNegative(v, "server.rate_limit_burst", c.Server.RateLimitBurst)
+	nonNegative(v, "server.max_inflight", c.Server.MaxInflight)
+	nonNegative(v, "server.max_limit", c.Server.MaxLimit)
+	nonNegative(v, "server.max_ef_search", c.Server.MaxEfSearch)
+	nonNegative(v, "server.max_nprobe", c.Server.MaxNProbe)
+	nonNegative(v, "server.max_batch_size", c.Server.MaxBatchSize)
+	nonNegative(v, "server.max_body_bytes", c.Server.MaxBodyBytes)
+	nonNegative(v, "server.warmup_searches", c.Server.WarmupSearches)
+
+	v.oneOf("storage.compression", c.Storage.Compression, "", "none", "snappy", "zstd")
+	if c.Storage.CompressionLevel != 0 {
+		v.check(c.Storage.Compression == "zstd", "storage.compression_level only applies to zstd, remove it or set storage.compression: zstd")
+		v.check(c.Storage.CompressionLevel >= 1 && c.Storage.CompressionLevel <= 22,
+			"storage.compression_level must be between 1 and 22, or 0 for the zstd default, got %d", c.Storage.CompressionLevel)
+	}
+
+	// level 0 is only compacted once it holds more than sst_num_per_level tables
+	aboveCompaction := func(key string, files int) {
+		v.check(files < 0 || uint64(files) > c.Storage.SSTNumPerLevel,
+			"%s must be above storage.sst_num_per_level (%d), or negative to disable it, got %d", key, c.Storage.SSTNumPerLevel, files)
+	}
+	aboveCompaction("storage.l0_slowdown_files", c.Storage.L0SlowdownFiles)
+	aboveCompaction("storage.l0_stop_files", c.Storage.L0StopFiles)
+	v.oneOf("storage.wal_sync", c.Storage.WALSync, "", "none", "background", "group")
+	nonNegative(v, "storage.wal_sync_interval_ms", c.Storage.WALSyncIntervalMs)
+
+	nonNegative(v, "index.m", c.Index.M)
+	nonNegative(v, "index.ef_construction", c.Index.EfConstruction)
+	nonNegative(v, "index.ef_search", c.Index.EfSearch)
+	nonNegative(v, "index.max_elements", c.Index.MaxElements)
+	nonNegative(v, "index.nlist", c.Index.NList)
+	nonNegative(v, "index.nprobe", c.Index.NProbe)
+	nonNegative(v, "index.search_threads", c.Index.SearchThreads)
+	nonNegative(v, "index.build_threads", c.Index.BuildThreads)
+	nonNegative(v, "index.load_threads", c.Index.LoadThreads)
+	nonNegative(v, "index.idle_unload_seconds", c.Index.IdleUnloadSeconds)
+	v.fraction("index.vacuum_deleted_ratio", c.Index.VacuumDeletedRatio)
+	v.fraction("index.shadow_recall_rate", c.Index.ShadowRecallRate)
+	v.check(c.Index.M == 0 || c.Index.M >= 2, "index.m must be at least 2, or 0 for the HNSW default, got %d", c.Index.M)
+
+	nonNegative(v, "cache.size", c.Cache.Size)
+	nonNegative(v, "cache.ttl_seconds", c.Cache.TTLSeconds)
+
+	v.oneOf("logging.level", strings.ToLower(c.Logging.Level), "debug", "info", "warn", "error", "fatal")
+	nonNegative(v, "logging.slow_query_ms", c.Logging.SlowQueryMs)
+	v.fraction("tracing.sample_rate", c.Tracing.SampleRate)
+
+	nonNegative(v, "embedding.rate_limit", c.Embedding.RateLimit)
+	nonNegative(v, "rerank.top_n", c.Rerank.TopN)
+	nonNegative(v, "archive.after_days", c.Archive.AfterDays)
+	v.fraction("archive.access_sample_rate", c.Archive.AccessSampleRate)
+	if c.Watch.Dir != "" {
+		v.check(c.Watch.Collection != "", "watch.collection must be set to ingest the files of watch.dir")
+	}
+	nonNegative(v, "watch.interval_seconds", c.Watch.IntervalSeconds)
+	nonNegative(v, "watch.chunk_size", c.Watch.ChunkSize)
+	nonNegative(v, "watch.chunk_overlap", c.Watch.ChunkOverlap)
+	if c.Tier.Endpoint != "" {
+		v.check(c.Tier.Bucket != "", "tier.bucket must be set to move cold files to tier.endpoint")
+	}
+	nonNegative(v, "tier.after_hours", c.Tier.AfterHours)
+	nonNegative(v, "tier.interval_seconds", c.Tier.IntervalSeconds)
+	nonNegative(v, "tier.cache_bytes", c.Tier.CacheBytes)
+
+	if leader := c.Replication.Leader; leader != "" {
+		v.check(strings.HasPrefix(leader, "http://") || strings.HasPrefix(leader, "https://"),
+			"replication.leader must be a URL such as http://10.0.0.1:8080, got %q", leader)
+	}
+	if c.Consensus.NodeID != "" {
+		v.check(slices.ContainsFunc(c.Consensus.Peers, func(p PeerConfig) bool { return p.ID == c.Consensus.NodeID }),
+			"consensus.peers must list this node, consensus.node_id %q is missing", c.Consensus.NodeID)
+	}
+
+	return v.err()
+}
+
+// Dump returns the effective configuration as YAML, as logged at startup
+func (c *Config) Dump() string {
+	redacted := *c
+	if redacted.Tier.SecretKey != "" {
+		redacted.Tier.SecretKey = "REDACTED"
+	}
+	data, err := yaml.Marshal(&redacted)
+	if err != nil {
+		return err.Error()
+	}
+	return string(data)
+}
+
+// validator collects the problems of a config so all of them are reported
+// at once
+type validator struct {
+	errs []error
+}
+
+func (v *validator) fail(format string, args ...any) {
+	v.errs = append(v.errs, fmt.Errorf(format, args...))
+}
+
+func (v *validator) check(ok bool, format string, args ...any) {
+	if !ok {
+		v.fail(format, args...)
+	}
+}
+
+func nonNegative[T int | int64 | float64](v *validator, key string, value T) {
+	v.check(value >= 0, "%s must not be negative, got %v", key, value)
+}
+
+func (v *validator) fraction(key string, value float64) {
+	v.check(value >= 0 && value <= 1, "%s must be a fraction between 0 and 1, got %v", key, value)
+}
+
+func (v *validator) oneOf(key, value string, allowed ...string) {
+	if slices.Contains(allowed, value) {
+		return
+	}
+	var names []string
+	for _, name := range allowed {
+		if name != "" {
+			names = append(names, name)
+		}
+	}
+	v.fail("%s must be one of %s, got %q", key, strings.Join(names, ", "), value)
+}
+
+func (v *validator) err() error {
+	if len(v.errs) == 0 {
+		return nil
+	}
+	return fmt.Errorf("invalid config: %w", errors.Join(v.errs...))
+}
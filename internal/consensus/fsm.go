@@ -0,0 +1,198 @@
+package consensus
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"sync"
+
+	"oasisdb/pkg/logger"
+
+	"github.com/hashicorp/raft"
+)
+
+// ErrResync is returned when a node is sent a snapshot newer than its data.
+// Snapshots only record a position, the node must be restarted from a copy of
+// the data directory of another node, without its raft directory
+var ErrResync = errors.New("node must be resynced from a copy of another node's data")
+
+// Command is a write request committed through the raft log, every node
+// applies it by serving it to its own API
+type Command struct {
+	Method string      `json:"method"`
+	URL    string      `json:"url"`
+	Header http.Header `json:"header,omitempty"`
+	Body   []byte      `json:"body,omitempty"`
+}
+
+// Response is what a node answered when it applied a command
+type Response struct {
+	Status int
+	Header http.Header
+	Body   []byte
+}
+
+// applyingKey marks the context of requests applied from the raft log
+type applyingKey struct{}
+
+// Applying reports whether a request is applied from the raft log, it must
+// be served as is instead of being committed again
+func Applying(ctx context.Context) bool {
+	return ctx.Value(applyingKey{}) != nil
+}
+
+// fsm applies committed commands to the API of the node. The data of the node
+// is its state, so a snapshot only records the last applied index
+type fsm struct {
+	handler   http.Handler
+	statePath string
+
+	mu      sync.Mutex
+	applied uint64
+}
+
+// fsmState is the position of the data, persisted with every snapshot
+type fsmState struct {
+	Index uint64 `json:"index"`
+}
+
+func (f *fsm) Apply(log *raft.Log) any {
+	var cmd Command
+	if err := json.Unmarshal(log.Data, &cmd); err != nil {
+		logger.Error("Failed to decode raft command", "index", log.Index, "error", err)
+		return &Response{Status: http.StatusInternalServerError}
+	}
+	ctx := context.WithValue(context.Background(), applyingKey{}, true)
+	req, err := http.NewRequestWithContext(ctx, cmd.Method, cmd.URL, bytes.NewReader(cmd.Body))
+	if err != nil {
+		logger.Error("Invalid raft command", "index", log.Index, "error", err)
+		return &Response{Status: http.StatusInternalServerError}
+	}
+	req.Header = cmd.Header
+	if req.Header == nil {
+		req.Header = http.Header{}
+	}
+
+	w := &recorder{header: http.Header{}}
+	f.handler.ServeHTTP(w, req)
+	if w.status == 0 {
+		w.status = http.StatusOK
+	}
+	if w.status >= http.StatusInternalServerError {
+		// the leader answered the same, but a node failing alone diverges
+		logger.Warn("Failed to apply raft command", "index", log.Index, "method", cmd.Method,
+			"url", cmd.URL, "status", w.status, "body", w.body.String())
+	}
+
+	f.mu.Lock()
+	f.applied = log.Index
+	f.mu.Unlock()
+	return &Response{Status: w.status, Header: w.header, Body: w.body.Bytes()}
+}
+
+func (f *fsm) Snapshot() (raft.FSMSnapshot, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return &fsmSnapshot{fsm: f, state: fsmState{Index: f.applied}}, nil
+}
+
+// Restore accepts the snapshots the node took itself, the data already
+// contains them
+func (f *fsm) Restore(snapshot io.ReadCloser) error {
+	defer snapshot.Close()
+	var state fsmState
+	if err := json.NewDecoder(snapshot).Decode(&state); err != nil {
+		return fmt.Errorf("invalid raft snapshot: %w", err)
+	}
+	local, err := f.readState()
+	if err != nil {
+		return err
+	}
+	if local.Index < state.Index {
+		return fmt.Errorf("%w: data is at index %d, the snapshot at %d", ErrResync, local.Index, state.Index)
+	}
+	f.mu.Lock()
+	f.applied = state.Index
+	f.mu.Unlock()
+	return nil
+}
+
+func (f *fsm) readState() (fsmState, error) {
+	var state fsmState
+	data, err := os.ReadFile(f.statePath)
+	if os.IsNotExist(err) {
+		return state, nil
+	}
+	if err != nil {
+		return state, fmt.Errorf("failed to read raft state: %w", err)
+	}
+	if err := json.Unmarshal(data, &state); err != nil {
+		return state, fmt.Errorf("invalid raft state: %w", err)
+	}
+	return state, nil
+}
+
+// writeState saves the position crash-safely, replacing the previous one
+func (f *fsm) writeState(state fsmState) error {
+	data, err := json.Marshal(state)
+	if err != nil {
+		return err
+	}
+	tmp := f.statePath + ".tmp"
+	if err := os.WriteFile(tmp, data, 0644); err != nil {
+		return fmt.Errorf("failed to save raft state: %w", err)
+	}
+	if err := os.Rename(tmp, f.statePath); err != nil {
+		return fmt.Errorf("failed to save raft state: %w", err)
+	}
+	return nil
+}
+
+type fsmSnapshot struct {
+	fsm   *fsm
+	state fsmState
+}
+
+func (s *fsmSnapshot) Persist(sink raft.SnapshotSink) error {
+	// the data must not be older than a snapshot raft truncates its log to
+	if err := s.fsm.writeState(s.state); err != nil {
+		sink.Cancel()
+		return err
+	}
+	if err := json.NewEncoder(sink).Encode(s.state); err != nil {
+		sink.Cancel()
+		return err
+	}
+	return sink.Close()
+}
+
+func (s *fsmSnapshot) Release() {}
+
+// recorder keeps the response of an applied command
+type recorder struct {
+	header http.Header
+	status int
+	body   bytes.Buffer
+}
+
+func (r *recorder) Header() http.Header {
+	return r.header
+}
+
+func (r *recorder) Write(b []byte) (int, error) {
+	if r.status == 0 {
+		r.status = http.StatusOK
+	}
+	return r.body.Write(b)
+}
+
+func (r *recorder) WriteHeader(status int) {
+	if r.status == 0 {
+		r.status = status
+	}
+}
@@ -0,0 +1,60 @@
+package consensus
+
+import (
+	"bytes"
+	"encoding/json"
+	"io"
+	"net/http"
+	"path"
+	"testing"
+
+	"github.com/hashicorp/raft"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestFSMApply(t *testing.T) {
+	var applied *http.Request
+	f := &fsm{
+		handler: http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			applied = r
+			w.WriteHeader(http.StatusCreated)
+			w.Write([]byte("done"))
+		}),
+		statePath: path.Join(t.TempDir(), stateFile),
+	}
+
+	data, err := json.Marshal(&Command{Method: http.MethodPost, URL: "/v1/collections?x=1",
+		Header: http.Header{"X-Tenant": {"acme"}}, Body: []byte("{}")})
+	assert.NoError(t, err)
+	resp := f.Apply(&raft.Log{Index: 7, Data: data}).(*Response)
+	assert.Equal(t, http.StatusCreated, resp.Status)
+	assert.Equal(t, "done", string(resp.Body))
+	assert.True(t, Applying(applied.Context()))
+	assert.Equal(t, "acme", applied.Header.Get("X-Tenant"))
+	assert.Equal(t, "1", applied.URL.Query().Get("x"))
+	assert.Equal(t, uint64(7), f.applied)
+}
+
+type bufferSink struct {
+	bytes.Buffer
+}
+
+func (s *bufferSink) ID() string    { return "test" }
+func (s *bufferSink) Cancel() error { return nil }
+func (s *bufferSink) Close() error  { return nil }
+
+func TestFSMSnapshotRestore(t *testing.T) {
+	f := &fsm{statePath: path.Join(t.TempDir(), stateFile), applied: 5}
+	snapshot, err := f.Snapshot()
+	assert.NoError(t, err)
+	var sink bufferSink
+	assert.NoError(t, snapshot.Persist(&sink))
+	data := sink.Bytes()
+
+	// the node took the snapshot, its data contains it
+	assert.NoError(t, f.Restore(io.NopCloser(bytes.NewReader(data))))
+
+	// a node with older data can't catch up from a snapshot
+	other := &fsm{statePath: path.Join(t.TempDir(), stateFile)}
+	assert.ErrorIs(t, other.Restore(io.NopCloser(bytes.NewReader(data))), ErrResync)
+}
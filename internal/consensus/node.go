@@ -0,0 +1,185 @@
+// Package consensus commits the writes of a cluster through a raft log, so a
+// write is acknowledged once a majority of the nodes has it and every node
+// applies the writes in the same order
+package consensus
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"path"
+	"time"
+
+	"oasisdb/internal/config"
+
+	"github.com/hashicorp/raft"
+	raftboltdb "github.com/hashicorp/raft-boltdb/v2"
+)
+
+const (
+	// stateFile keeps the position of the data, it belongs to the data and is
+	// copied with it when a node is reseeded
+	stateFile = "consensus.state"
+
+	transportPool    = 3
+	transportTimeout = 10 * time.Second
+	snapshotsRetain  = 2
+)
+
+// ErrNotLeader is returned when a command is applied on a node that isn't
+// the leader
+var ErrNotLeader = errors.New("node is not the raft leader")
+
+// Status describes a node and its view of the cluster
+type Status struct {
+	NodeID       string            `json:"node_id"`
+	State        string            `json:"state"` // Leader, Follower, Candidate or Shutdown
+	Leader       string            `json:"leader"`
+	LeaderHTTP   string            `json:"leader_http"`
+	AppliedIndex uint64            `json:"applied_index"`
+	CommitIndex  uint64            `json:"commit_index"`
+	Stats        map[string]string `json:"stats"`
+}
+
+// Node is a member of a raft cluster
+type Node struct {
+	id        string
+	raft      *raft.Raft
+	store     *raftboltdb.BoltStore
+	transport *raft.NetworkTransport
+	httpAddrs map[raft.ServerID]string
+	timeout   time.Duration
+}
+
+// NewNode starts the raft node conf.NodeID, its log is kept in dir/raft and
+// committed commands are applied by serving them to handler. A node without
+// raft state bootstraps the cluster of all peers
+func NewNode(conf config.ConsensusConfig, dir string, handler http.Handler) (*Node, error) {
+	n := &Node{
+		id:        conf.NodeID,
+		httpAddrs: make(map[raft.ServerID]string, len(conf.Peers)),
+		timeout:   time.Duration(conf.ApplyTimeoutSeconds) * time.Second,
+	}
+	var servers []raft.Server
+	var raftAddr string
+	for _, peer := range conf.Peers {
+		if peer.ID == "" || peer.RaftAddr == "" || peer.HTTPAddr == "" {
+			return nil, fmt.Errorf("raft peers need an id, raft_addr and http_addr")
+		}
+		if _, ok := n.httpAddrs[raft.ServerID(peer.ID)]; ok {
+			return nil, fmt.Errorf("raft peer %s is listed twice", peer.ID)
+		}
+		n.httpAddrs[raft.ServerID(peer.ID)] = peer.HTTPAddr
+		servers = append(servers, raft.Server{ID: raft.ServerID(peer.ID), Address: raft.ServerAddress(peer.RaftAddr)})
+		if peer.ID == conf.NodeID {
+			raftAddr = peer.RaftAddr
+		}
+	}
+	if raftAddr == "" {
+		return nil, fmt.Errorf("raft node %s is not one of the peers", conf.NodeID)
+	}
+
+	raftDir := path.Join(dir, "raft")
+	if err := os.MkdirAll(raftDir, 0755); err != nil {
+		return nil, err
+	}
+	store, err := raftboltdb.NewBoltStore(path.Join(raftDir, "raft.db"))
+	if err != nil {
+		return nil, fmt.Errorf("failed to open raft log: %w", err)
+	}
+	n.store = store
+	snapshots, err := raft.NewFileSnapshotStore(raftDir, snapshotsRetain, os.Stderr)
+	if err != nil {
+		store.Close()
+		return nil, err
+	}
+	transport, err := raft.NewTCPTransport(raftAddr, nil, transportPool, transportTimeout, os.Stderr)
+	if err != nil {
+		store.Close()
+		return nil, fmt.Errorf("failed to listen for raft on %s: %w", raftAddr, err)
+	}
+	n.transport = transport
+
+	raftConf := raft.DefaultConfig()
+	raftConf.LocalID = raft.ServerID(conf.NodeID)
+	raftConf.LogLevel = "WARN"
+	f := &fsm{handler: handler, statePath: path.Join(dir, stateFile)}
+	n.raft, err = raft.NewRaft(raftConf, f, store, store, snapshots, transport)
+	if err != nil {
+		transport.Close()
+		store.Close()
+		return nil, err
+	}
+
+	existing, err := raft.HasExistingState(store, store, snapshots)
+	if err != nil {
+		n.Close()
+		return nil, err
+	}
+	if !existing {
+		// every peer bootstraps with the same configuration, which is safe
+		if err := n.raft.BootstrapCluster(raft.Configuration{Servers: servers}).Error(); err != nil &&
+			!errors.Is(err, raft.ErrCantBootstrap) {
+			n.Close()
+			return nil, err
+		}
+	}
+	return n, nil
+}
+
+// Apply commits a command and returns the response of applying it on this
+// node, which must be the leader
+func (n *Node) Apply(cmd *Command) (*Response, error) {
+	data, err := json.Marshal(cmd)
+	if err != nil {
+		return nil, err
+	}
+	future := n.raft.Apply(data, n.timeout)
+	if err := future.Error(); err != nil {
+		if errors.Is(err, raft.ErrNotLeader) || errors.Is(err, raft.ErrLeadershipLost) {
+			return nil, fmt.Errorf("%w: %v", ErrNotLeader, err)
+		}
+		return nil, err
+	}
+	return future.Response().(*Response), nil
+}
+
+// IsLeader reports whether writes can be applied on this node
+func (n *Node) IsLeader() bool {
+	return n.raft.State() == raft.Leader
+}
+
+// LeaderHTTPAddr returns the API address of the leader, empty while there is
+// none
+func (n *Node) LeaderHTTPAddr() string {
+	_, id := n.raft.LeaderWithID()
+	return n.httpAddrs[id]
+}
+
+// Status returns the state of the node
+func (n *Node) Status() Status {
+	_, leader := n.raft.LeaderWithID()
+	return Status{
+		NodeID:       n.id,
+		State:        n.raft.State().String(),
+		Leader:       string(leader),
+		LeaderHTTP:   n.httpAddrs[leader],
+		AppliedIndex: n.raft.AppliedIndex(),
+		CommitIndex:  n.raft.CommitIndex(),
+		Stats:        n.raft.Stats(),
+	}
+}
+
+// Close stops the node, it can be started again from its raft directory
+func (n *Node) Close() error {
+	err := n.raft.Shutdown().Error()
+	if cerr := n.transport.Close(); err == nil {
+		err = cerr
+	}
+	if cerr := n.store.Close(); err == nil {
+		err = cerr
+	}
+	return err
+}
@@ -0,0 +1,186 @@
+package db
+
+import (
+	"encoding/json"
+	"fmt"
+	"math/rand"
+	"oasisdb/pkg/logger"
+	"sync"
+	"time"
+)
+
+// accessGranularity is the minimum age of a recorded access before a new
+// read replaces it, so hot documents don't dirty their collection every read
+const accessGranularity = time.Minute
+
+// accessRecord tracks when a document was last read or written
+type accessRecord struct {
+	LastAccess int64 `json:"last_access"` // unix seconds
+	Archived   bool  `json:"archived,omitempty"`
+}
+
+// accessTracker keeps per-collection access records in memory and persists
+// dirty collections in batches, one scalar key per collection
+type accessTracker struct {
+	mu      sync.Mutex
+	records map[string]map[string]*accessRecord // collection -> id -> record
+	dirty   map[string]bool
+}
+
+func newAccessTracker() *accessTracker {
+	return &accessTracker{
+		records: make(map[string]map[string]*accessRecord),
+		dirty:   make(map[string]bool),
+	}
+}
+
+func accessKey(collectionName string) []byte {
+	return []byte(fmt.Sprintf("access:%s", collectionName))
+}
+
+// accessRecordsLocked returns the records of a collection, loading them from
+// scalar storage on first use, the caller must hold db.access.mu
+func (db *DB) accessRecordsLocked(collectionName string) (map[string]*accessRecord, error) {
+	if records, ok := db.access.records[collectionName]; ok {
+		return records, nil
+	}
+	records := make(map[string]*accessRecord)
+	data, exists, err := db.Storage.GetScalar(accessKey(collectionName))
+	if err != nil {
+		return nil, err
+	}
+	if exists && len(data) > 0 {
+		if err := json.Unmarshal(data, &records); err != nil {
+			return nil, err
+		}
+	}
+	db.access.records[collectionName] = records
+	return records, nil
+}
+
+// touch marks documents as accessed now and returns those that were
+// archived, writes always count so new documents start out hot
+func (db *DB) touch(collectionName string, ids ...string) []string {
+	db.access.mu.Lock()
+	defer db.access.mu.Unlock()
+
+	records, err := db.accessRecordsLocked(collectionName)
+	if err != nil {
+		logger.Error("Failed to load access records", "collection", collectionName, "error", err)
+		return nil
+	}
+	now := time.Now().Unix()
+	var archived []string
+	for _, id := range ids {
+		if r, ok := records[id]; ok && r.Archived {
+			archived = append(archived, id)
+		}
+		records[id] = &accessRecord{LastAccess: now}
+	}
+	db.access.dirty[collectionName] = true
+	return archived
+}
+
+// recordRead marks documents as read, subject to the configured sample rate
+func (db *DB) recordRead(collectionName string, ids ...string) {
+	if rate := db.conf.Archive.AccessSampleRate; rate > 0 && rand.Float64() >= rate {
+		return
+	}
+
+	db.access.mu.Lock()
+	defer db.access.mu.Unlock()
+
+	records, err := db.accessRecordsLocked(collectionName)
+	if err != nil {
+		logger.Error("Failed to load access records", "collection", collectionName, "error", err)
+		return
+	}
+	now := time.Now()
+	for _, id := range ids {
+		r, ok := records[id]
+		if !ok {
+			r = &accessRecord{}
+			records[id] = r
+		}
+		if now.Sub(time.Unix(r.LastAccess, 0)) < accessGranularity {
+			continue
+		}
+		r.LastAccess = now.Unix()
+		db.access.dirty[collectionName] = true
+	}
+}
+
+// forgetAccess drops the records of deleted documents
+func (db *DB) forgetAccess(collectionName string, ids ...string) {
+	db.access.mu.Lock()
+	defer db.access.mu.Unlock()
+
+	records, err := db.accessRecordsLocked(collectionName)
+	if err != nil {
+		logger.Error("Failed to load access records", "collection", collectionName, "error", err)
+		return
+	}
+	for _, id := range ids {
+		delete(records, id)
+	}
+	db.access.dirty[collectionName] = true
+}
+
+// dropAccess removes all records and archived vectors of a deleted collection
+func (db *DB) dropAccess(collectionName string) error {
+	db.access.mu.Lock()
+	defer db.access.mu.Unlock()
+
+	records, err := db.accessRecordsLocked(collectionName)
+	if err != nil {
+		return err
+	}
+	for id, r := range records {
+		if r.Archived {
+			if err := db.Storage.DeleteScalar(archiveKey(collectionName, id)); err != nil {
+				return err
+			}
+		}
+	}
+	delete(db.access.records, collectionName)
+	delete(db.access.dirty, collectionName)
+	return db.Storage.DeleteScalar(accessKey(collectionName))
+}
+
+// isArchived reports whether a document has been moved to the archive
+func (db *DB) isArchived(collectionName, id string) bool {
+	db.access.mu.Lock()
+	defer db.access.mu.Unlock()
+
+	records, err := db.accessRecordsLocked(collectionName)
+	if err != nil {
+		return false
+	}
+	r, ok := records[id]
+	return ok && r.Archived
+}
+
+// flushAccess persists the records of all dirty collections in one batch
+func (db *DB) flushAccess() error {
+	db.access.mu.Lock()
+	defer db.access.mu.Unlock()
+
+	if len(db.access.dirty) == 0 {
+		return nil
+	}
+	keys := make([][]byte, 0, len(db.access.dirty))
+	values := make([][]byte, 0, len(db.access.dirty))
+	for name := range db.access.dirty {
+		data, err := json.Marshal(db.access.records[name])
+		if err != nil {
+			return err
+		}
+		keys = append(keys, accessKey(name))
+		values = append(values, data)
+	}
+	if err := db.Storage.BatchPutScalar(keys, values); err != nil {
+		return fmt.Errorf("failed to persist access records: %w", err)
+	}
+	db.access.dirty = make(map[string]bool)
+	return nil
+}
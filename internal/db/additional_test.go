@@ -1,10 +1,12 @@
 package db
 
 import (
+	"context"
 	"fmt"
 	"testing"
 
 	"oasisdb/internal/config"
+	"oasisdb/internal/embedding"
 	pkgerrors "oasisdb/pkg/errors"
 
 	"github.com/stretchr/testify/assert"
@@ -79,13 +81,13 @@ func TestDBSearchAndListCollections(t *testing.T) {
 	require.NoError(t, err)
 	assert.Contains(t, names, "docs")
 
-	ids, distances, err := db.SearchVectors("docs", []float32{1, 0, 0}, 2)
+	ids, distances, err := db.SearchVectors(context.Background(), "docs", []float32{1, 0, 0}, 2)
 	require.NoError(t, err)
 	require.NotEmpty(t, ids)
 	assert.Equal(t, "1", ids[0])
 	assert.Len(t, distances, len(ids))
 
-	docs, docDistances, err := db.SearchDocuments("docs", &Document{
+	docs, docDistances, err := db.SearchDocuments(context.Background(), "docs", &Document{
 		Vector: []float32{1, 0, 0},
 	}, 2, nil)
 	require.NoError(t, err)
@@ -94,6 +96,110 @@ func TestDBSearchAndListCollections(t *testing.T) {
 	assert.Len(t, docDistances, len(docs))
 }
 
+func TestSearchMultiple(t *testing.T) {
+	db := newTestDBWithProvider(t, stubEmbeddingProvider{})
+
+	createTestCollection(t, db, "en", 2)
+	createTestCollection(t, db, "de", 2)
+	require.NoError(t, db.BuildIndex("en", []*Document{
+		{ID: "a", Vector: []float32{1, 0}},
+		{ID: "b", Vector: []float32{0, 1}},
+	}))
+	require.NoError(t, db.BuildIndex("de", []*Document{
+		{ID: "c", Vector: []float32{0.9, 0}},
+		{ID: "d", Vector: []float32{0, -1}},
+	}))
+
+	query := &Document{Vector: []float32{1, 0}}
+	results, err := db.SearchMultiple(context.Background(), []MultiSearchTarget{{Collection: "en"}, {Collection: "de"}}, query, 3, nil, 0)
+	require.NoError(t, err)
+	require.Len(t, results, 3)
+	assert.Equal(t, []string{"a", "c", "b"}, []string{results[0].Document.ID, results[1].Document.ID, results[2].Document.ID})
+	assert.Equal(t, "de", results[1].Collection)
+
+	// a heavier collection ranks lower, offset skips merged results
+	results, err = db.SearchMultiple(context.Background(), []MultiSearchTarget{{Collection: "en"}, {Collection: "de", Weight: 1000}}, query, 1, nil, 1)
+	require.NoError(t, err)
+	require.Len(t, results, 1)
+	assert.Equal(t, "b", results[0].Document.ID)
+	assert.Equal(t, results[0].Distance, results[0].WeightedDistance)
+
+	// a collection without matches or documents adds no results
+	createTestCollection(t, db, "empty", 2)
+	results, err = db.SearchMultiple(context.Background(), []MultiSearchTarget{{Collection: "en"}, {Collection: "de"}, {Collection: "empty"}},
+		query, 3, map[string]any{"lang": "en"}, 0)
+	require.NoError(t, err)
+	assert.Empty(t, results)
+	require.NoError(t, db.UpsertDocument("en", &Document{ID: "e", Vector: []float32{1, 0.1}, Dimension: 2, Parameters: map[string]any{"lang": "en"}}))
+	results, err = db.SearchMultiple(context.Background(), []MultiSearchTarget{{Collection: "en"}, {Collection: "de"}, {Collection: "empty"}},
+		query, 3, map[string]any{"lang": "en"}, 0)
+	require.NoError(t, err)
+	require.Len(t, results, 1)
+	assert.Equal(t, "e", results[0].Document.ID)
+
+	_, err = db.SearchMultiple(context.Background(), []MultiSearchTarget{{Collection: "en"}, {Collection: "en"}}, query, 1, nil, 0)
+	assert.ErrorIs(t, err, pkgerrors.ErrInvalidParameter)
+	_, err = db.SearchMultiple(context.Background(), []MultiSearchTarget{{Collection: "en", Weight: -1}}, query, 1, nil, 0)
+	assert.ErrorIs(t, err, pkgerrors.ErrInvalidParameter)
+	_, err = db.SearchMultiple(context.Background(), []MultiSearchTarget{{Collection: "en"}, {Collection: "missing"}}, query, 1, nil, 0)
+	assert.ErrorIs(t, err, pkgerrors.ErrCollectionNotFound)
+}
+
+func TestUpsertDedup(t *testing.T) {
+	db := newTestDBWithProvider(t, stubEmbeddingProvider{})
+
+	_, err := db.CreateCollection(&CreateCollectionOptions{Name: "bad", Dimension: 2, DedupThreshold: -1})
+	assert.ErrorIs(t, err, pkgerrors.ErrInvalidParameter)
+	_, err = db.CreateCollection(&CreateCollectionOptions{Name: "bad", Dimension: 2, DedupMode: "replace"})
+	assert.ErrorIs(t, err, pkgerrors.ErrInvalidParameter)
+
+	_, err = db.CreateCollection(&CreateCollectionOptions{Name: "skip", Dimension: 2, DedupThreshold: 0.01})
+	require.NoError(t, err)
+	require.NoError(t, db.UpsertDocument("skip", &Document{ID: "1", Vector: []float32{1, 0}, Dimension: 2}))
+
+	// upserting a document again isn't a duplicate of itself
+	match, err := db.UpsertDocumentDedup("skip", &Document{ID: "1", Vector: []float32{1, 0}, Dimension: 2, Parameters: map[string]any{"v": 2.0}})
+	require.NoError(t, err)
+	assert.Nil(t, match)
+
+	match, err = db.UpsertDocumentDedup("skip", &Document{ID: "2", Vector: []float32{1, 0.05}, Dimension: 2})
+	require.NoError(t, err)
+	require.NotNil(t, match)
+	assert.Equal(t, "2", match.ID)
+	assert.Equal(t, "1", match.MatchedID)
+	assert.False(t, match.Merged)
+	_, err = db.GetDocument("skip", "2")
+	assert.ErrorIs(t, err, pkgerrors.ErrDocumentNotFound)
+
+	duplicates, err := db.BatchUpsertDocumentsDedup("skip", []*Document{
+		{ID: "3", Vector: []float32{0.99, 0}},
+		{ID: "4", Vector: []float32{0, 1}},
+	})
+	require.NoError(t, err)
+	require.Len(t, duplicates, 1)
+	assert.Equal(t, "3", duplicates[0].ID)
+	_, err = db.GetDocument("skip", "4")
+	assert.NoError(t, err)
+
+	_, err = db.CreateCollection(&CreateCollectionOptions{Name: "merge", Dimension: 2, DedupThreshold: 0.01, DedupMode: DedupMerge})
+	require.NoError(t, err)
+	require.NoError(t, db.UpsertDocument("merge", &Document{ID: "1", Vector: []float32{1, 0}, Dimension: 2, Parameters: map[string]any{"a": "x", "b": "x"}}))
+	duplicates, err = db.BatchUpsertDocumentsDedup("merge", []*Document{
+		{ID: "2", Vector: []float32{1, 0.01}, Parameters: map[string]any{"b": "y"}},
+		{ID: "3", Vector: []float32{1, -0.01}, Parameters: map[string]any{"c": "z"}},
+	})
+	require.NoError(t, err)
+	require.Len(t, duplicates, 2)
+	assert.True(t, duplicates[1].Merged)
+	doc, err := db.GetDocument("merge", "1")
+	require.NoError(t, err)
+	assert.Equal(t, map[string]any{"a": "x", "b": "y", "c": "z"}, doc.Parameters)
+	assert.Equal(t, []float32{1, 0}, doc.Vector)
+	stats, err := db.CollectionStats("merge")
+	require.NoError(t, err)
+	assert.Equal(t, int64(1), stats.Documents)
+}
+
 func TestDBEmbeddingAndSearchErrorPaths(t *testing.T) {
 	db := newTestDBWithProvider(t, stubEmbeddingProvider{
 		embedFn: func(text string) ([]float64, error) {
@@ -119,7 +225,7 @@ func TestDBEmbeddingAndSearchErrorPaths(t *testing.T) {
 	assert.Len(t, doc.Vector, 3)
 	assert.Equal(t, 3, doc.Dimension)
 
-	docs, distances, err := db.SearchDocuments("docs", &Document{
+	docs, distances, err := db.SearchDocuments(context.Background(), "docs", &Document{
 		Parameters: map[string]any{
 			"embedding": true,
 			"text":      "hello",
@@ -130,10 +236,10 @@ func TestDBEmbeddingAndSearchErrorPaths(t *testing.T) {
 	assert.Equal(t, "10", docs[0].ID)
 	assert.Len(t, distances, 1)
 
-	_, _, err = db.SearchVectors("missing", []float32{0.1, 0.2, 0.3}, 1)
+	_, _, err = db.SearchVectors(context.Background(), "missing", []float32{0.1, 0.2, 0.3}, 1)
 	assert.ErrorIs(t, err, pkgerrors.ErrCollectionNotFound)
 
-	_, _, err = db.SearchDocuments("docs", &Document{}, 1, nil)
+	_, _, err = db.SearchDocuments(context.Background(), "docs", &Document{}, 1, nil)
 	assert.ErrorContains(t, err, "query document must have a vector")
 
 	err = db.UpsertDocument("docs", &Document{
@@ -144,14 +250,14 @@ func TestDBEmbeddingAndSearchErrorPaths(t *testing.T) {
 	})
 	assert.ErrorContains(t, err, "text parameter is required")
 
-	_, _, err = db.SearchDocuments("docs", &Document{
+	_, _, err = db.SearchDocuments(context.Background(), "docs", &Document{
 		Parameters: map[string]any{
 			"embedding": true,
 		},
 	}, 1, nil)
 	assert.ErrorContains(t, err, "text parameter is required")
 
-	_, _, err = db.SearchDocuments("docs", &Document{
+	_, _, err = db.SearchDocuments(context.Background(), "docs", &Document{
 		Parameters: map[string]any{
 			"embedding": true,
 			"text":      "boom",
@@ -194,7 +300,7 @@ func TestDBBatchOperationsAndHelpers(t *testing.T) {
 
 	prepared, err := db.prepareBatchData("batch_docs", []*Document{
 		{ID: "3", Vector: []float32{1, 1}, Parameters: map[string]any{"ok": true}},
-	})
+	}, true)
 	require.NoError(t, err)
 	require.Len(t, prepared.ids, 1)
 	assert.Equal(t, "3", prepared.ids[0])
@@ -204,12 +310,12 @@ func TestDBBatchOperationsAndHelpers(t *testing.T) {
 
 	_, err = db.prepareBatchData("batch_docs", []*Document{
 		{ID: "4", Vector: []float32{1}},
-	})
+	}, true)
 	assert.ErrorContains(t, err, "vector dimension mismatch")
 
 	_, err = db.prepareBatchData("batch_docs", []*Document{
 		{ID: "5", Parameters: map[string]any{"embedding": true}},
-	})
+	}, true)
 	assert.ErrorContains(t, err, "text parameter is required")
 
 	require.NoError(t, db.BuildIndex("build_docs", []*Document{
@@ -217,10 +323,142 @@ func TestDBBatchOperationsAndHelpers(t *testing.T) {
 		{ID: "7", Vector: []float32{0, 1}},
 	}))
 
-	ids, _, err := db.SearchVectors("build_docs", []float32{1, 0}, 1)
+	ids, _, err := db.SearchVectors(context.Background(), "build_docs", []float32{1, 0}, 1)
 	require.NoError(t, err)
 	require.Len(t, ids, 1)
 	assert.Equal(t, "6", ids[0])
 
 	assert.Equal(t, []float32{1.5, -2.25}, float64SliceTo32([]float64{1.5, -2.25}))
 }
+
+func TestDBBatchUpsertPartialEmbeddingFailure(t *testing.T) {
+	db := newTestDBWithProvider(t, stubEmbeddingProvider{
+		embedFn: func(text string) ([]float64, error) {
+			if text == "boom" {
+				return nil, fmt.Errorf("embedding failed")
+			}
+			return []float64{1, 0}, nil
+		},
+	})
+	// one document per provider call so only the failing one is skipped
+	db.embedder = embedding.NewBatcher(db.conf.EmbeddingProvider, embedding.BatchOptions{BatchSize: 1})
+
+	createTestCollection(t, db, "partial", 2)
+	err := db.BatchUpsertDocuments("partial", []*Document{
+		{ID: "1", Parameters: map[string]any{"embedding": true, "text": "ok"}},
+		{ID: "2", Parameters: map[string]any{"embedding": true, "text": "boom"}},
+		{ID: "3", Vector: []float32{0, 1}},
+	})
+
+	var embedErr *BatchEmbeddingError
+	require.ErrorAs(t, err, &embedErr)
+	require.Len(t, embedErr.Failures, 1)
+	assert.Equal(t, "2", embedErr.Failures[0].ID)
+	assert.Equal(t, 2, embedErr.Succeeded)
+
+	_, err = db.GetDocument("partial", "1")
+	assert.NoError(t, err)
+	_, err = db.GetDocument("partial", "3")
+	assert.NoError(t, err)
+	_, err = db.GetDocument("partial", "2")
+	assert.ErrorIs(t, err, pkgerrors.ErrDocumentNotFound)
+}
+
+func TestNormalizeCollection(t *testing.T) {
+	db := newTestDBWithProvider(t, stubEmbeddingProvider{})
+	_, err := db.CreateCollection(&CreateCollectionOptions{
+		Name:      "unit",
+		Dimension: 2,
+		IndexType: "hnsw",
+		Normalize: true,
+	})
+	require.NoError(t, err)
+
+	require.NoError(t, db.UpsertDocument("unit", &Document{ID: "a", Vector: []float32{3, 4}, Dimension: 2}))
+	require.NoError(t, db.BatchUpsertDocuments("unit", []*Document{
+		{ID: "b", Vector: []float32{0, 10}},
+		{ID: "zero", Vector: []float32{0, 0}},
+	}))
+
+	doc, err := db.GetDocument("unit", "a")
+	require.NoError(t, err)
+	assert.InDeltaSlice(t, []float32{0.6, 0.8}, doc.Vector, 1e-6)
+	doc, err = db.GetDocument("unit", "b")
+	require.NoError(t, err)
+	assert.InDeltaSlice(t, []float32{0, 1}, doc.Vector, 1e-6)
+	doc, err = db.GetDocument("unit", "zero")
+	require.NoError(t, err)
+	assert.Equal(t, []float32{0, 0}, doc.Vector)
+
+	// the query is scaled too, so its length doesn't change the ranking
+	query := []float32{30, 40}
+	ids, distances, err := db.SearchVectors(context.Background(), "unit", query, 1)
+	require.NoError(t, err)
+	assert.Equal(t, []string{"a"}, ids)
+	assert.InDelta(t, 0, distances[0], 1e-6)
+	assert.Equal(t, []float32{30, 40}, query)
+
+	docs, _, err := db.SearchDocuments(context.Background(), "unit", &Document{Vector: []float32{0, 0.01}}, 1, nil)
+	require.NoError(t, err)
+	assert.Equal(t, "b", docs[0].ID)
+}
+
+func TestValidateBatch(t *testing.T) {
+	db := newTestDBWithProvider(t, stubEmbeddingProvider{
+		embedFn: func(text string) ([]float64, error) {
+			if text == "fail" {
+				return nil, fmt.Errorf("provider unavailable")
+			}
+			return []float64{1, 0}, nil
+		},
+	})
+	_, err := db.CreateCollection(&CreateCollectionOptions{Name: "docs", Dimension: 2,
+		Schema: &Schema{Fields: []SchemaField{{Name: "genre", Type: FieldKeyword, Required: true}}}})
+	require.NoError(t, err)
+
+	genre := map[string]any{"genre": "x"}
+	embed := func(text string) map[string]any {
+		params := map[string]any{"genre": "x", "embedding": true}
+		if text != "" {
+			params["text"] = text
+		}
+		return params
+	}
+	docs := []*Document{
+		{ID: "a", Vector: []float32{1, 2}, Parameters: genre},
+		{Vector: []float32{1, 2}, Parameters: genre},
+		{ID: "a", Vector: []float32{3, 4}, Parameters: genre},
+		{ID: "b", Vector: []float32{1}, Parameters: genre},
+		{ID: "c", Vector: []float32{1, 2}},
+		{ID: "d", Parameters: embed("ok")},
+		{ID: "e", Parameters: embed("fail")},
+		{ID: "f", Parameters: embed("")},
+	}
+
+	validation, err := db.ValidateBatch("docs", docs, true)
+	require.NoError(t, err)
+	// the provider fails the whole embedding batch
+	assert.Equal(t, 1, validation.Valid)
+	var rejected []int
+	for _, e := range validation.Errors {
+		rejected = append(rejected, e.Index)
+	}
+	assert.Equal(t, []int{1, 2, 3, 4, 5, 6, 7}, rejected)
+	assert.Contains(t, validation.Errors[1].Err.Error(), "duplicate of document 0")
+	assert.Contains(t, validation.Errors[4].Err.Error(), "provider unavailable")
+
+	// nothing was written
+	_, err = db.GetDocument("docs", "a")
+	assert.ErrorIs(t, err, pkgerrors.ErrDocumentNotFound)
+	stats, err := db.CollectionStats("docs")
+	require.NoError(t, err)
+	assert.Zero(t, stats.Documents)
+
+	// without embedding, documents to embed only need a text
+	validation, err = db.ValidateBatch("docs", docs, false)
+	require.NoError(t, err)
+	assert.Equal(t, 3, validation.Valid)
+
+	_, err = db.ValidateBatch("missing", docs, false)
+	assert.ErrorIs(t, err, pkgerrors.ErrCollectionNotFound)
+}
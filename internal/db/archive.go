@@ -0,0 +1,172 @@
+package db
+
+import (
+	"encoding/json"
+	"fmt"
+	"oasisdb/pkg/errors"
+	"oasisdb/pkg/logger"
+	"sort"
+	"time"
+)
+
+// archiveKey stores the vector of an archived document, its metadata stays
+// under the doc: key
+func archiveKey(collectionName, id string) []byte {
+	return []byte(keyPrefix("archive", collectionName) + id)
+}
+
+// ArchiveDocuments moves documents not read or written for unreadFor out of
+// the vector index into scalar storage, they no longer appear in searches
+// but GetDocument still returns them and RestoreDocument brings them back.
+// Only documents within scope are archived, see WithScopeFilter
+func (db *DB) ArchiveDocuments(collectionName string, unreadFor time.Duration, scope map[string]any) ([]string, error) {
+	if _, err := db.GetCollection(collectionName); err != nil {
+		return nil, err
+	}
+
+	cutoff := time.Now().Add(-unreadFor).Unix()
+	db.access.mu.Lock()
+	records, err := db.accessRecordsLocked(collectionName)
+	var candidates []string
+	for id, r := range records {
+		if !r.Archived && r.LastAccess < cutoff {
+			candidates = append(candidates, id)
+		}
+	}
+	db.access.mu.Unlock()
+	if err != nil {
+		return nil, err
+	}
+	sort.Strings(candidates)
+
+	archived := make([]string, 0, len(candidates))
+	defer func() {
+		// archived documents no longer appear in searches
+		if len(archived) > 0 {
+			db.ClearSearchCache(collectionName)
+		}
+	}()
+	for _, id := range candidates {
+		if len(scope) > 0 {
+			params, err := db.storedParameters(collectionName, id)
+			if err != nil {
+				return archived, fmt.Errorf("failed to get document %s: %w", id, err)
+			}
+			if !matchFilter(params, scope) {
+				continue
+			}
+		}
+		vector, err := db.IndexManager.GetVector(collectionName, id)
+		if err != nil {
+			logger.Error("Failed to get vector for archiving", "collection", collectionName, "id", id, "error", err)
+			continue
+		}
+		data, err := json.Marshal(vector)
+		if err != nil {
+			return archived, err
+		}
+		if err := db.Storage.PutScalar(archiveKey(collectionName, id), data); err != nil {
+			return archived, fmt.Errorf("failed to archive document %s: %w", id, err)
+		}
+		if err := db.IndexManager.DeleteVector(collectionName, id); err != nil {
+			return archived, fmt.Errorf("failed to remove archived document %s from index: %w", id, err)
+		}
+
+		db.access.mu.Lock()
+		// a concurrent write may have replaced the record meanwhile
+		if r, ok := records[id]; ok && r.LastAccess < cutoff {
+			r.Archived = true
+			db.access.dirty[collectionName] = true
+		}
+		db.access.mu.Unlock()
+		archived = append(archived, id)
+	}
+
+	if len(archived) > 0 {
+		logger.Info("Archived documents", "collection", collectionName, "count", len(archived))
+	}
+	return archived, db.flushAccess()
+}
+
+// ArchiveAfterDays returns the configured archiving threshold, 0 if disabled
+func (db *DB) ArchiveAfterDays() int {
+	return db.conf.Archive.AfterDays
+}
+
+// RestoreDocument moves an archived document back into the vector index
+func (db *DB) RestoreDocument(collectionName, id string) error {
+	if !db.isArchived(collectionName, id) {
+		return fmt.Errorf("%w: document %s is not archived", errors.ErrInvalidParameter, id)
+	}
+	vector, err := db.archivedVector(collectionName, id)
+	if err != nil {
+		return err
+	}
+	if err := db.IndexManager.AddVector(collectionName, id, vector); err != nil {
+		return fmt.Errorf("failed to restore document %s: %w", id, err)
+	}
+	db.ClearSearchCache(collectionName)
+	db.touch(collectionName, id)
+	return db.Storage.DeleteScalar(archiveKey(collectionName, id))
+}
+
+// archivedVector loads the vector of an archived document
+func (db *DB) archivedVector(collectionName, id string) ([]float32, error) {
+	data, exists, err := db.Storage.GetScalar(archiveKey(collectionName, id))
+	if err != nil {
+		return nil, err
+	}
+	if !exists || len(data) == 0 {
+		return nil, errors.ErrDocumentNotFound
+	}
+	var vector []float32
+	if err := json.Unmarshal(data, &vector); err != nil {
+		return nil, err
+	}
+	return vector, nil
+}
+
+// deleteArchived removes the archived vectors of documents that were written
+// again and are back in the index
+func (db *DB) deleteArchived(collectionName string, ids []string) {
+	for _, id := range ids {
+		if err := db.Storage.DeleteScalar(archiveKey(collectionName, id)); err != nil {
+			logger.Error("Failed to delete archived vector", "collection", collectionName, "id", id, "error", err)
+		}
+	}
+}
+
+// runAccessLoop persists access records and, when enabled, archives cold
+// documents of every collection until Close
+func (db *DB) runAccessLoop() {
+	defer close(db.doneCh)
+
+	flush := time.NewTicker(time.Duration(db.conf.Archive.FlushIntervalSeconds) * time.Second)
+	defer flush.Stop()
+	archive := time.NewTicker(time.Duration(db.conf.Archive.IntervalMinutes) * time.Minute)
+	defer archive.Stop()
+
+	for {
+		select {
+		case <-flush.C:
+			if err := db.flushAccess(); err != nil {
+				logger.Error("Failed to flush access records", "error", err)
+			}
+		case <-archive.C:
+			// followers and raft nodes archive what is replicated to them,
+			// POST /v1/collections/:name/archive on the leader
+			if db.conf.Archive.AfterDays <= 0 || db.follower != nil || db.conf.Consensus.NodeID != "" {
+				continue
+			}
+			unreadFor := time.Duration(db.conf.Archive.AfterDays) * 24 * time.Hour
+			names, _ := db.ListCollections()
+			for _, name := range names {
+				if _, err := db.ArchiveDocuments(name, unreadFor, nil); err != nil {
+					logger.Error("Failed to archive documents", "collection", name, "error", err)
+				}
+			}
+		case <-db.stopCh:
+			return
+		}
+	}
+}
@@ -0,0 +1,92 @@
+package db
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	pkgerrors "oasisdb/pkg/errors"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// age moves the recorded access of documents back in time
+func age(db *DB, collectionName string, d time.Duration, ids ...string) {
+	db.access.mu.Lock()
+	defer db.access.mu.Unlock()
+	records, _ := db.accessRecordsLocked(collectionName)
+	for _, id := range ids {
+		records[id].LastAccess -= int64(d.Seconds())
+	}
+}
+
+func TestArchiveDocuments(t *testing.T) {
+	db := newTestDBWithProvider(t, stubEmbeddingProvider{})
+	createTestCollection(t, db, "docs", 2)
+	require.NoError(t, db.BatchUpsertDocuments("docs", []*Document{
+		{ID: "1", Vector: []float32{1, 0}, Dimension: 2, Parameters: map[string]any{"tag": "cold"}},
+		{ID: "2", Vector: []float32{0, 1}, Dimension: 2},
+		{ID: "3", Vector: []float32{1, 1}, Dimension: 2},
+	}))
+
+	// freshly written documents are hot
+	ids, err := db.ArchiveDocuments("docs", 24*time.Hour, nil)
+	require.NoError(t, err)
+	assert.Empty(t, ids)
+
+	// a read keeps document 2 hot
+	age(db, "docs", 48*time.Hour, "1", "2")
+	_, err = db.GetDocument("docs", "2")
+	require.NoError(t, err)
+
+	ids, err = db.ArchiveDocuments("docs", 24*time.Hour, nil)
+	require.NoError(t, err)
+	assert.Equal(t, []string{"1"}, ids)
+
+	// archived documents leave the index but stay retrievable
+	results, _, err := db.SearchDocuments(context.Background(), "docs", &Document{Vector: []float32{1, 0}}, 3, nil)
+	require.NoError(t, err)
+	for _, doc := range results {
+		assert.NotEqual(t, "1", doc.ID)
+	}
+	doc, err := db.GetDocument("docs", "1")
+	require.NoError(t, err)
+	assert.Equal(t, []float32{1, 0}, doc.Vector)
+	assert.Equal(t, "cold", doc.Parameters["tag"])
+
+	require.NoError(t, db.RestoreDocument("docs", "1"))
+	results, _, err = db.SearchDocuments(context.Background(), "docs", &Document{Vector: []float32{1, 0}}, 1, nil)
+	require.NoError(t, err)
+	assert.Equal(t, "1", results[0].ID)
+	assert.ErrorIs(t, db.RestoreDocument("docs", "1"), pkgerrors.ErrInvalidParameter)
+
+	// deleting an archived document removes its archived vector
+	age(db, "docs", 48*time.Hour, "3")
+	ids, err = db.ArchiveDocuments("docs", 24*time.Hour, nil)
+	require.NoError(t, err)
+	assert.Equal(t, []string{"3"}, ids)
+	require.NoError(t, db.DeleteDocument("docs", "3"))
+	_, err = db.archivedVector("docs", "3")
+	assert.ErrorIs(t, err, pkgerrors.ErrDocumentNotFound)
+
+	_, err = db.ArchiveDocuments("missing", time.Hour, nil)
+	assert.ErrorIs(t, err, pkgerrors.ErrCollectionNotFound)
+}
+
+func TestAccessRecordsPersist(t *testing.T) {
+	db := newTestDBWithProvider(t, stubEmbeddingProvider{})
+	createTestCollection(t, db, "docs", 2)
+	require.NoError(t, db.UpsertDocument("docs", &Document{ID: "1", Vector: []float32{1, 0}, Dimension: 2}))
+	require.NoError(t, db.flushAccess())
+
+	// drop the in-memory copy and reload from scalar storage
+	db.access = newAccessTracker()
+	assert.False(t, db.isArchived("docs", "1"))
+	db.access.mu.Lock()
+	records, err := db.accessRecordsLocked("docs")
+	db.access.mu.Unlock()
+	require.NoError(t, err)
+	require.Contains(t, records, "1")
+	assert.InDelta(t, time.Now().Unix(), records["1"].LastAccess, 5)
+}
@@ -0,0 +1,363 @@
+package db
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+
+	"oasisdb/internal/config"
+	"oasisdb/internal/storage/wal"
+	"oasisdb/pkg/logger"
+)
+
+const (
+	batchOpUpsert = "upsert"
+	batchOpBuild  = "build"
+
+	// batchLogResetSize is the size after which the batch log is emptied once
+	// no batch is in flight
+	batchLogResetSize = 64 * 1024 * 1024
+
+	batchBeginPrefix  = "begin:"
+	batchCommitPrefix = "commit:"
+)
+
+// batchRecord is the logged intent of a batch write, it covers both the
+// scalar and the index part so either can be redone after a crash. Builds
+// log neither vectors nor stored vector keys, the built index holds them
+type batchRecord struct {
+	Op         string      `json:"op"`
+	Collection string      `json:"collection"`
+	Keys       [][]byte    `json:"keys"`
+	Values     [][]byte    `json:"values"`
+	IDs        []string    `json:"ids"`
+	Vectors    [][]float32 `json:"vectors"`
+}
+
+// batchLog makes batch writes atomic across scalar storage and the index: a
+// batch is logged and synced before it is applied and marked committed after,
+// batches without a commit are redone on startup
+type batchLog struct {
+	mu       sync.Mutex
+	file     string
+	writer   *wal.WALWriter
+	nextID   uint64
+	inflight int
+	size     int
+}
+
+func batchLogFile(conf *config.Config) string {
+	return path.Join(conf.BatchWALDir(), "batch.wal")
+}
+
+// newBatchLog starts an empty batch log, uncommitted batches must have been
+// recovered before
+func newBatchLog(file string) (*batchLog, error) {
+	writer, err := resetBatchLog(file)
+	if err != nil {
+		return nil, err
+	}
+	return &batchLog{file: file, writer: writer}, nil
+}
+
+func resetBatchLog(file string) (*wal.WALWriter, error) {
+	if err := os.Remove(file); err != nil && !os.IsNotExist(err) {
+		return nil, fmt.Errorf("failed to reset batch log: %w", err)
+	}
+	writer, err := wal.NewWALWriter(file)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create batch log: %w", err)
+	}
+	return writer, nil
+}
+
+// begin logs a batch durably and returns its id for commit
+func (l *batchLog) begin(record *batchRecord) (uint64, error) {
+	value, err := json.Marshal(record)
+	if err != nil {
+		return 0, fmt.Errorf("failed to marshal batch record: %w", err)
+	}
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	id := l.nextID
+	key := []byte(batchBeginPrefix + strconv.FormatUint(id, 10))
+	if err := l.writer.Write(key, value); err != nil {
+		return 0, fmt.Errorf("failed to write batch log: %w", err)
+	}
+	if err := l.writer.Sync(); err != nil {
+		return 0, fmt.Errorf("failed to sync batch log: %w", err)
+	}
+	l.nextID++
+	l.inflight++
+	l.size += len(key) + len(value)
+	return id, nil
+}
+
+// commit marks a batch as finished, failed batches are committed as well
+// since their error was returned to the caller
+func (l *batchLog) commit(id uint64) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.inflight--
+	if err := l.writer.Write([]byte(batchCommitPrefix+strconv.FormatUint(id, 10)), nil); err != nil {
+		// the batch is redone on the next start, which is harmless
+		logger.Error("Failed to commit batch", "id", id, "error", err)
+	}
+	if l.inflight > 0 || l.size < batchLogResetSize {
+		return
+	}
+
+	l.writer.Close()
+	writer, err := resetBatchLog(l.file)
+	if err != nil {
+		logger.Error("Failed to reset batch log", "error", err)
+		return
+	}
+	l.writer, l.size = writer, 0
+}
+
+func (l *batchLog) close() {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.writer.Close()
+}
+
+// readUncommittedBatches returns the logged batches that have no commit in
+// log order, a torn last record was never applied and is ignored
+func readUncommittedBatches(file string) ([]*batchRecord, error) {
+	reader, err := wal.NewWALReader(file)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, nil
+		}
+		return nil, err
+	}
+	defer reader.Close()
+
+	var order []string
+	records := make(map[string]*batchRecord)
+	for {
+		kv, err := reader.Next()
+		if err == io.ErrUnexpectedEOF {
+			logger.Warn("Ignoring torn batch log record", "file", file)
+			break
+		}
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+
+		key := string(kv.Key)
+		if id, ok := strings.CutPrefix(key, batchCommitPrefix); ok {
+			delete(records, id)
+			continue
+		}
+		id, ok := strings.CutPrefix(key, batchBeginPrefix)
+		if !ok {
+			return nil, fmt.Errorf("unknown batch log record %q", key)
+		}
+		var record batchRecord
+		if err := json.Unmarshal(kv.Value, &record); err != nil {
+			return nil, fmt.Errorf("failed to decode batch record %s: %w", id, err)
+		}
+		records[id] = &record
+		order = append(order, id)
+	}
+
+	var uncommitted []*batchRecord
+	for _, id := range order {
+		if record, ok := records[id]; ok {
+			uncommitted = append(uncommitted, record)
+		}
+	}
+	return uncommitted, nil
+}
+
+// newBatchRecord returns the record logged for a batch, of a build only the
+// scalar writes are logged: the saved index and its WAL are the redo record
+// of the vectors
+func newBatchRecord(op, collectionName string, data *batchData) *batchRecord {
+	if op != batchOpBuild {
+		return &batchRecord{
+			Op:         op,
+			Collection: collectionName,
+			Keys:       data.docKeys,
+			Values:     data.docValues,
+			IDs:        data.ids,
+			Vectors:    data.vectors,
+		}
+	}
+
+	record := &batchRecord{Op: op, Collection: collectionName, IDs: data.ids}
+	vectorPrefix := vectorKey(collectionName, "")
+	for i, key := range data.docKeys {
+		if !bytes.HasPrefix(key, vectorPrefix) {
+			record.Keys = append(record.Keys, key)
+			record.Values = append(record.Values, data.docValues[i])
+		}
+	}
+	return record
+}
+
+// writeBatch applies a batch to scalar storage and the index as one logical
+// transaction
+func (db *DB) writeBatch(op, collectionName string, data *batchData) error {
+	// keyword index sets are logged with the documents moving between them
+	if len(data.keywordChanges) > 0 {
+		defer db.lockKeywords(collectionName)()
+		keys, values, err := db.keywordIndexWrites(collectionName, data.keywordFields, data.keywordChanges)
+		if err != nil {
+			return err
+		}
+		data.docKeys = append(data.docKeys, keys...)
+		data.docValues = append(data.docValues, values...)
+	}
+
+	// the counters are logged and written with the documents
+	unlockStats := db.lockStats(collectionName)
+	key, value, err := db.statsWrite(collectionName, data.docKeys, data.docValues)
+	if err != nil {
+		unlockStats()
+		return err
+	}
+	data.docKeys = append(data.docKeys, key)
+	data.docValues = append(data.docValues, value)
+
+	id, err := db.batches.begin(newBatchRecord(op, collectionName, data))
+	if err != nil {
+		unlockStats()
+		return err
+	}
+	defer db.batches.commit(id)
+
+	// cached results may miss part of the batch even if it fails halfway
+	defer db.ClearSearchCache(collectionName)
+
+	// a build is indexed first, so recovery only redoes the scalar writes of
+	// builds the index holds
+	if op == batchOpBuild {
+		if err := db.IndexManager.BuildIndex(collectionName, data.ids, data.vectors); err != nil {
+			unlockStats()
+			return fmt.Errorf("failed to build vector index: %w", err)
+		}
+	}
+
+	// Batch store document metadata, and vectors if the collection stores them
+	err = db.Storage.BatchPutScalar(data.docKeys, data.docValues)
+	unlockStats()
+	if err != nil {
+		return fmt.Errorf("failed to batch store document metadata: %w", err)
+	}
+	if op == batchOpBuild {
+		return nil
+	}
+	if err := db.IndexManager.AddVectorBatch(collectionName, data.ids, data.vectors); err != nil {
+		return fmt.Errorf("failed to batch update vector index: %w", err)
+	}
+	return nil
+}
+
+// recoverBatch redoes a batch interrupted by a crash, the scalar writes are
+// repeated and only vectors the index doesn't hold yet are added
+func (db *DB) recoverBatch(record *batchRecord) error {
+	if _, err := db.IndexManager.GetIndex(record.Collection); err != nil {
+		// the collection was deleted, or its index is lost and rebuilt
+		// separately
+		return err
+	}
+	keys, values := record.Keys[:0:0], record.Values[:0:0]
+	for i, key := range record.Keys {
+		// later writes of the collection may have counted the batch already
+		if bytes.Equal(key, statsKey(record.Collection)) && db.staleStats(record.Collection, record.Values[i]) {
+			continue
+		}
+		keys, values = append(keys, key), append(values, record.Values[i])
+	}
+	if record.Op == batchOpBuild && len(record.Vectors) == 0 {
+		return db.recoverBuild(record, keys, values)
+	}
+	if err := db.Storage.BatchPutScalar(keys, values); err != nil {
+		return fmt.Errorf("failed to store document metadata: %w", err)
+	}
+
+	var ids []string
+	var vectors [][]float32
+	for i, id := range record.IDs {
+		if vector, err := db.IndexManager.GetVector(record.Collection, id); err == nil && slices.Equal(vector, record.Vectors[i]) {
+			continue
+		}
+		ids = append(ids, id)
+		vectors = append(vectors, record.Vectors[i])
+	}
+	if len(ids) == 0 {
+		return nil
+	}
+	if record.Op == batchOpBuild && len(ids) == len(record.IDs) {
+		return db.IndexManager.BuildIndex(record.Collection, ids, vectors)
+	}
+	return db.IndexManager.AddVectorBatch(record.Collection, ids, vectors)
+}
+
+// recoverBuild redoes the scalar writes of a build logged without its
+// vectors. The index is built before the documents are stored, a build the
+// index doesn't hold stored nothing and is dropped
+func (db *DB) recoverBuild(record *batchRecord, keys, values [][]byte) error {
+	vectors := make([][]float32, len(record.IDs))
+	for i, id := range record.IDs {
+		vector, err := db.IndexManager.GetVector(record.Collection, id)
+		if err != nil {
+			logger.Warn("Dropping interrupted build missing from the index", "collection", record.Collection, "documents", len(record.IDs))
+			return nil
+		}
+		vectors[i] = vector
+	}
+
+	collection, err := db.GetCollection(record.Collection)
+	if err != nil {
+		return err
+	}
+	if collection.StoreVectors {
+		for i, id := range record.IDs {
+			vectorData, err := encodeVector(vectors[i])
+			if err != nil {
+				return fmt.Errorf("failed to encode vector %s: %w", id, err)
+			}
+			keys = append(keys, vectorKey(record.Collection, id))
+			values = append(values, vectorData)
+		}
+	}
+	if err := db.Storage.BatchPutScalar(keys, values); err != nil {
+		return fmt.Errorf("failed to store document metadata: %w", err)
+	}
+	return nil
+}
+
+// recoverBatches redoes the batches left uncommitted by a crash and starts a
+// new batch log
+func (db *DB) recoverBatches() error {
+	file := batchLogFile(db.conf)
+	records, err := readUncommittedBatches(file)
+	if err != nil {
+		return fmt.Errorf("failed to read batch log: %w", err)
+	}
+	for _, record := range records {
+		if err := db.recoverBatch(record); err != nil {
+			logger.Error("Failed to recover interrupted batch", "collection", record.Collection, "error", err)
+			continue
+		}
+		logger.Info("Recovered interrupted batch", "collection", record.Collection, "documents", len(record.IDs))
+	}
+
+	db.batches, err = newBatchLog(file)
+	return err
+}
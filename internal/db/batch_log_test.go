@@ -0,0 +1,140 @@
+package db
+
+import (
+	"os"
+	"path"
+	"testing"
+
+	"oasisdb/internal/config"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestReadUncommittedBatches(t *testing.T) {
+	file := path.Join(t.TempDir(), "batch.wal")
+	log, err := newBatchLog(file)
+	require.NoError(t, err)
+
+	first, err := log.begin(&batchRecord{Op: batchOpUpsert, Collection: "a", IDs: []string{"1"}})
+	require.NoError(t, err)
+	_, err = log.begin(&batchRecord{Op: batchOpBuild, Collection: "b", IDs: []string{"2"}})
+	require.NoError(t, err)
+	log.commit(first)
+	_, err = log.begin(&batchRecord{Op: batchOpUpsert, Collection: "c", IDs: []string{"3"}})
+	require.NoError(t, err)
+	log.close()
+
+	// the last record is torn, it was never applied
+	info, err := os.Stat(file)
+	require.NoError(t, err)
+	require.NoError(t, os.Truncate(file, info.Size()-1))
+
+	records, err := readUncommittedBatches(file)
+	require.NoError(t, err)
+	require.Len(t, records, 1)
+	assert.Equal(t, "b", records[0].Collection)
+	assert.Equal(t, batchOpBuild, records[0].Op)
+
+	records, err = readUncommittedBatches(path.Join(t.TempDir(), "missing.wal"))
+	assert.NoError(t, err)
+	assert.Empty(t, records)
+}
+
+func TestBatchRecoveredAfterCrash(t *testing.T) {
+	conf, err := config.NewConfig(t.TempDir())
+	require.NoError(t, err)
+	db, err := New(conf)
+	require.NoError(t, err)
+	require.NoError(t, db.Open())
+	createTestCollection(t, db, "docs", 2)
+
+	require.NoError(t, db.BatchUpsertDocuments("docs", []*Document{{ID: "1", Vector: []float32{1, 0}}}))
+
+	// crash after logging a batch and storing its metadata, before indexing
+	data, err := db.prepareBatchData("docs", []*Document{
+		{ID: "2", Vector: []float32{0, 1}, Parameters: map[string]any{"tag": "new"}},
+		{ID: "3", Vector: []float32{1, 1}},
+	}, true)
+	require.NoError(t, err)
+	_, err = db.batches.begin(&batchRecord{
+		Op:         batchOpUpsert,
+		Collection: "docs",
+		Keys:       data.docKeys,
+		Values:     data.docValues,
+		IDs:        data.ids,
+		Vectors:    data.vectors,
+	})
+	require.NoError(t, err)
+	require.NoError(t, db.Storage.BatchPutScalar(data.docKeys, data.docValues))
+	db.Close()
+
+	db, err = New(conf)
+	require.NoError(t, err)
+	require.NoError(t, db.Open())
+	t.Cleanup(db.Close)
+
+	doc, err := db.GetDocument("docs", "2")
+	require.NoError(t, err)
+	assert.Equal(t, []float32{0, 1}, doc.Vector)
+	assert.Equal(t, "new", doc.Parameters["tag"])
+	doc, err = db.GetDocument("docs", "1")
+	require.NoError(t, err)
+	assert.Equal(t, []float32{1, 0}, doc.Vector)
+
+	records, err := readUncommittedBatches(batchLogFile(conf))
+	require.NoError(t, err)
+	assert.Empty(t, records)
+}
+
+func TestBuildRecoveredAfterCrash(t *testing.T) {
+	conf, err := config.NewConfig(t.TempDir())
+	require.NoError(t, err)
+	db, err := New(conf)
+	require.NoError(t, err)
+	require.NoError(t, db.Open())
+	_, err = db.CreateCollection(&CreateCollectionOptions{Name: "docs", Dimension: 2, IndexType: "hnsw", Parameters: map[string]string{}, StoreVectors: true})
+	require.NoError(t, err)
+	createTestCollection(t, db, "lost", 2)
+
+	// the build of docs reached the index, the build of lost didn't
+	built, err := db.prepareBatchData("docs", []*Document{
+		{ID: "1", Vector: []float32{1, 0}, Parameters: map[string]any{"tag": "built"}},
+		{ID: "2", Vector: []float32{0, 1}},
+	}, false)
+	require.NoError(t, err)
+	record := newBatchRecord(batchOpBuild, "docs", built)
+	assert.Empty(t, record.Vectors)
+	for _, key := range record.Keys {
+		assert.NotContains(t, string(key), "vec:")
+	}
+	_, err = db.batches.begin(record)
+	require.NoError(t, err)
+	require.NoError(t, db.IndexManager.BuildIndex("docs", built.ids, built.vectors))
+
+	lost, err := db.prepareBatchData("lost", []*Document{{ID: "3", Vector: []float32{1, 1}}}, false)
+	require.NoError(t, err)
+	_, err = db.batches.begin(newBatchRecord(batchOpBuild, "lost", lost))
+	require.NoError(t, err)
+	db.Close()
+
+	db, err = New(conf)
+	require.NoError(t, err)
+	require.NoError(t, db.Open())
+	t.Cleanup(db.Close)
+
+	doc, err := db.GetDocument("docs", "1")
+	require.NoError(t, err)
+	assert.Equal(t, []float32{1, 0}, doc.Vector)
+	assert.Equal(t, "built", doc.Parameters["tag"])
+	_, exists, err := db.Storage.GetScalar(vectorKey("docs", "2"))
+	require.NoError(t, err)
+	assert.True(t, exists, "stored vectors are rewritten from the index")
+
+	_, err = db.GetDocument("lost", "3")
+	assert.Error(t, err)
+
+	records, err := readUncommittedBatches(batchLogFile(conf))
+	require.NoError(t, err)
+	assert.Empty(t, records)
+}
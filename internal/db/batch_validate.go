@@ -0,0 +1,103 @@
+package db
+
+import "fmt"
+
+// BatchValidation is the outcome of a batch write checked without writing
+type BatchValidation struct {
+	Valid  int             // documents the batch would write
+	Errors []DocumentError // documents the batch would reject, in batch order
+}
+
+// DocumentError is why a document of a batch would be rejected
+type DocumentError struct {
+	Index int // position of the document in the batch
+	ID    string
+	Err   error
+}
+
+// ValidateBatch runs the checks of a batch write without writing anything,
+// and reports every rejected document instead of stopping at the first:
+// processors, dimension, schema and IDs repeated in the batch, which a write
+// would silently overwrite. Embeddings are generated if embed is set,
+// otherwise documents to embed only need a text and their dimension isn't
+// checked. Processors may modify the documents
+func (db *DB) ValidateBatch(collectionName string, docs []*Document, embed bool) (*BatchValidation, error) {
+	collection, err := db.GetCollection(collectionName)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get collection: %w", err)
+	}
+
+	errs := make(map[int]error)
+	seen := make(map[string]int, len(docs))
+	var toEmbed []*Document
+	var toEmbedAt []int
+	for i, doc := range docs {
+		switch {
+		case doc == nil:
+			errs[i] = fmt.Errorf("document is null")
+			continue
+		case doc.ID == "":
+			errs[i] = fmt.Errorf("document ID is required")
+			continue
+		}
+		if first, ok := seen[doc.ID]; ok {
+			errs[i] = fmt.Errorf("duplicate of document %d", first)
+			continue
+		}
+		seen[doc.ID] = i
+		if err := db.beforeUpsert(collectionName, doc); err != nil {
+			errs[i] = err
+			continue
+		}
+		if flag, ok := doc.Parameters["embedding"].(bool); ok && flag && len(doc.Vector) == 0 {
+			if _, ok := doc.Parameters["text"].(string); !ok {
+				errs[i] = fmt.Errorf("text parameter is required for embedding when vector is not provided")
+				continue
+			}
+			toEmbed, toEmbedAt = append(toEmbed, doc), append(toEmbedAt, i)
+		}
+	}
+
+	// the dimension of documents left without a vector isn't known
+	unchecked := make(map[int]bool)
+	if embed && len(toEmbed) > 0 {
+		failed, err := db.embedDocuments(toEmbed)
+		for j, i := range toEmbedAt {
+			if err != nil {
+				errs[i] = fmt.Errorf("failed to generate embedding: %w", err)
+			} else if failed[j] != nil {
+				errs[i] = fmt.Errorf("failed to generate embedding: %w", failed[j])
+			}
+		}
+	} else {
+		for _, i := range toEmbedAt {
+			unchecked[i] = true
+		}
+	}
+
+	for i, doc := range docs {
+		if errs[i] != nil {
+			continue
+		}
+		if !unchecked[i] && len(doc.Vector) != collection.Dimension {
+			errs[i] = fmt.Errorf("vector dimension mismatch: expected %d, got %d", collection.Dimension, len(doc.Vector))
+			continue
+		}
+		if err := validateDocument(collection, doc); err != nil {
+			errs[i] = err
+		}
+	}
+
+	result := &BatchValidation{Valid: len(docs) - len(errs)}
+	for i, doc := range docs {
+		if errs[i] == nil {
+			continue
+		}
+		docErr := DocumentError{Index: i, Err: errs[i]}
+		if doc != nil {
+			docErr.ID = doc.ID
+		}
+		result.Errors = append(result.Errors, docErr)
+	}
+	return result, nil
+}
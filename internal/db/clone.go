@@ -0,0 +1,81 @@
+package db
+
+import (
+	"cmp"
+	stderrors "errors"
+	"fmt"
+
+	"oasisdb/pkg/errors"
+	"oasisdb/pkg/logger"
+)
+
+// CloneOptions configures the copy of a collection
+type CloneOptions struct {
+	Target     string            // name of the new collection
+	IndexType  string            // empty keeps the index type of the source
+	Parameters map[string]string // index parameters, nil keeps the ones of the source
+}
+
+// CloneCollection copies the documents of a collection into a new one, with
+// another index type or parameters if given, and returns the new collection
+// and the number of documents copied. The copy reads a snapshot of the
+// source, writes to it meanwhile are not copied. The index of the new
+// collection is built in one go, so IVF centroids are trained on every vector
+func (db *DB) CloneCollection(source string, opts CloneOptions) (*Collection, int, error) {
+	if opts.Target == "" {
+		return nil, 0, fmt.Errorf("%w: target collection name is required", errors.ErrInvalidParameter)
+	}
+	collection, err := db.GetCollection(source)
+	if err != nil {
+		return nil, 0, err
+	}
+	snapshot, err := db.SnapshotCollection(source)
+	if err != nil {
+		return nil, 0, err
+	}
+	defer snapshot.Release()
+
+	target, err := db.CreateCollection(&CreateCollectionOptions{
+		Name:           opts.Target,
+		Parameters:     withIndexParameters(collection.Metadata, opts.Parameters),
+		Dimension:      collection.Dimension,
+		IndexType:      cmp.Or(opts.IndexType, collection.IndexType),
+		DefaultFilter:  collection.DefaultFilter,
+		StoreVectors:   collection.StoreVectors,
+		Normalize:      collection.Normalize,
+		Cache:          collection.Cache,
+		DedupThreshold: collection.DedupThreshold,
+		DedupMode:      collection.DedupMode,
+	})
+	if err != nil {
+		return nil, 0, err
+	}
+
+	docs := make([]*Document, 0, len(snapshot.IDs()))
+	for _, id := range snapshot.IDs() {
+		doc, err := snapshot.GetDocument(id)
+		if stderrors.Is(err, errors.ErrDocumentNotFound) {
+			continue
+		}
+		if err != nil {
+			return nil, 0, db.abortClone(opts.Target, err)
+		}
+		docs = append(docs, doc)
+	}
+	if len(docs) > 0 {
+		if err := db.BuildIndex(opts.Target, docs); err != nil {
+			return nil, 0, db.abortClone(opts.Target, err)
+		}
+	}
+	logger.Info("Cloned collection", "source", source, "target", opts.Target,
+		"index_type", target.IndexType, "documents", len(docs))
+	return target, len(docs), nil
+}
+
+// abortClone deletes the partial copy of a failed clone and returns err
+func (db *DB) abortClone(target string, err error) error {
+	if purgeErr := db.purgeCollection(target); purgeErr != nil {
+		logger.Error("Failed to delete partial clone", "collection", target, "error", purgeErr)
+	}
+	return fmt.Errorf("failed to copy documents: %w", err)
+}
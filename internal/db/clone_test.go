@@ -0,0 +1,78 @@
+package db
+
+import (
+	"context"
+	"fmt"
+	"testing"
+
+	"oasisdb/pkg/errors"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestCloneCollection(t *testing.T) {
+	db := newTestDBWithProvider(t, stubEmbeddingProvider{})
+	_, err := db.CreateCollection(&CreateCollectionOptions{
+		Name:         "docs",
+		Dimension:    2,
+		IndexType:    "hnsw",
+		Parameters:   map[string]string{"M": "8"},
+		StoreVectors: true,
+		Schema:       &Schema{Fields: []SchemaField{{Name: "genre", Type: FieldString}}},
+	})
+	require.NoError(t, err)
+	var docs []*Document
+	for i := 0; i < 20; i++ {
+		docs = append(docs, &Document{
+			ID:         fmt.Sprint(i),
+			Vector:     []float32{float32(i), float32(20 - i)},
+			Parameters: map[string]any{"genre": fmt.Sprint("g", i%2)},
+		})
+	}
+	require.NoError(t, db.BatchUpsertDocuments("docs", docs))
+	require.NoError(t, db.DeleteDocument("docs", "19"))
+
+	clone, copied, err := db.CloneCollection("docs", CloneOptions{
+		Target:     "docs_flat",
+		IndexType:  "flat",
+		Parameters: map[string]string{},
+	})
+	require.NoError(t, err)
+	assert.Equal(t, 19, copied)
+	assert.Equal(t, "flat", clone.IndexType)
+	assert.True(t, clone.StoreVectors)
+	assert.NotContains(t, clone.Metadata, "M")
+	schema, err := clone.ParameterSchema()
+	require.NoError(t, err)
+	assert.NotNil(t, schema)
+
+	doc, err := db.GetDocument("docs_flat", "3")
+	require.NoError(t, err)
+	assert.Equal(t, []float32{3, 17}, doc.Vector)
+	assert.Equal(t, "g1", doc.Parameters["genre"])
+	ids, _, err := db.SearchVectors(context.Background(), "docs_flat", []float32{5, 15}, 1)
+	require.NoError(t, err)
+	assert.Equal(t, []string{"5"}, ids)
+	_, err = db.GetDocument("docs_flat", "19")
+	assert.ErrorIs(t, err, errors.ErrDocumentNotFound)
+
+	// the copies are independent
+	require.NoError(t, db.DeleteDocument("docs_flat", "3"))
+	_, err = db.GetDocument("docs", "3")
+	require.NoError(t, err)
+
+	// without options the index settings are kept
+	clone, copied, err = db.CloneCollection("docs", CloneOptions{Target: "docs_copy"})
+	require.NoError(t, err)
+	assert.Equal(t, 19, copied)
+	assert.Equal(t, "hnsw", clone.IndexType)
+	assert.Equal(t, "8", clone.Metadata["M"])
+
+	_, _, err = db.CloneCollection("docs", CloneOptions{Target: "docs_copy"})
+	assert.ErrorIs(t, err, errors.ErrCollectionExists)
+	_, _, err = db.CloneCollection("missing", CloneOptions{Target: "other"})
+	assert.ErrorIs(t, err, errors.ErrCollectionNotFound)
+	_, _, err = db.CloneCollection("docs", CloneOptions{})
+	assert.ErrorIs(t, err, errors.ErrInvalidParameter)
+}
@@ -3,41 +3,66 @@ package db
 import (
 	"encoding/json"
 	"fmt"
+	"maps"
+	"slices"
+	"strconv"
+	"time"
 
 	"oasisdb/internal/index"
 	"oasisdb/pkg/errors"
+	"oasisdb/pkg/vectorindex"
 )
 
 // Collection represents a collection of vectors
 type Collection struct {
-	Name      string            `json:"name"`      // collection name
-	Metadata  map[string]string `json:"metadata"`  // collection metadata
-	Dimension int               `json:"dimension"` // vector dimension
-	IndexType string            `json:"indexType"` // index type (e.g., "hnsw")
+	Name           string            `json:"name"`                     // collection name
+	Metadata       map[string]string `json:"metadata"`                 // collection metadata
+	Dimension      int               `json:"dimension"`                // vector dimension
+	IndexType      string            `json:"indexType"`                // index type (e.g., "hnsw")
+	DefaultFilter  map[string]any    `json:"defaultFilter,omitempty"`  // enforced on every search and get
+	StoreVectors   bool              `json:"storeVectors,omitempty"`   // also persist vectors in scalar storage
+	Normalize      bool              `json:"normalize,omitempty"`      // L2-normalize stored and query vectors
+	Cache          *CacheSettings    `json:"cache,omitempty"`          // search cache overrides
+	DedupThreshold float32           `json:"dedupThreshold,omitempty"` // upserts this close to another document are deduplicated
+	DedupMode      string            `json:"dedupMode,omitempty"`      // DedupSkip or DedupMerge, empty means DedupSkip
+	DeletedAt      *time.Time        `json:"deletedAt,omitempty"`      // set while the collection is in the trash
 }
 
 // CreateCollectionOptions represents options for creating a collection
 type CreateCollectionOptions struct {
-	Name       string            `json:"name"`
-	Parameters map[string]string `json:"parameters"`
-	Dimension  int               `json:"dimension"`
-	IndexType  string            `json:"indexType"` // e.g., "hnsw"
+	Name           string            `json:"name"`
+	Parameters     map[string]string `json:"parameters"`
+	Dimension      int               `json:"dimension"`
+	IndexType      string            `json:"indexType"`      // e.g., "hnsw"
+	DefaultFilter  map[string]any    `json:"defaultFilter"`  // e.g., {"tenant_id": "a"}
+	StoreVectors   bool              `json:"storeVectors"`   // write vectors through to scalar storage
+	Normalize      bool              `json:"normalize"`      // scale vectors to unit length on write and search
+	Schema         *Schema           `json:"schema"`         // declared document parameters, stored in Metadata
+	Cache          *CacheSettings    `json:"cache"`          // search cache overrides, nil uses the config
+	DedupThreshold float32           `json:"dedupThreshold"` // e.g. 0.01, 0 keeps near-identical documents
+	DedupMode      string            `json:"dedupMode"`      // DedupSkip or DedupMerge
 }
 
 func NewCollection(opts *CreateCollectionOptions) *Collection {
 	return &Collection{
-		Name:      opts.Name,
-		Metadata:  opts.Parameters,
-		Dimension: opts.Dimension,
-		IndexType: opts.IndexType,
+		Name:           opts.Name,
+		Metadata:       opts.Parameters,
+		Dimension:      opts.Dimension,
+		IndexType:      opts.IndexType,
+		DefaultFilter:  opts.DefaultFilter,
+		StoreVectors:   opts.StoreVectors,
+		Normalize:      opts.Normalize,
+		Cache:          opts.Cache,
+		DedupThreshold: opts.DedupThreshold,
+		DedupMode:      opts.DedupMode,
 	}
 }
 
 // CreateCollection creates a new collection
 func (db *DB) CreateCollection(opts *CreateCollectionOptions) (*Collection, error) {
 	// Validate options
-	if opts.Name == "" {
-		return nil, fmt.Errorf("collection name is required")
+	if err := ValidateCollectionName(opts.Name); err != nil {
+		return nil, err
 	}
 	if opts.Dimension <= 0 {
 		return nil, fmt.Errorf("dimension must be positive")
@@ -45,6 +70,24 @@ func (db *DB) CreateCollection(opts *CreateCollectionOptions) (*Collection, erro
 	if opts.IndexType == "" {
 		opts.IndexType = string(index.HNSWIndex) // default to HNSW
 	}
+	if !vectorindex.IsRegistered(vectorindex.IndexType(opts.IndexType)) {
+		return nil, fmt.Errorf("%w: unsupported index type %s, registered types are %v",
+			errors.ErrInvalidParameter, opts.IndexType, vectorindex.RegisteredTypes())
+	}
+
+	if opts.Schema != nil {
+		if err := opts.Schema.Validate(); err != nil {
+			return nil, fmt.Errorf("%w: %v", errors.ErrInvalidParameter, err)
+		}
+	}
+	if opts.Cache != nil {
+		if err := opts.Cache.validate(); err != nil {
+			return nil, err
+		}
+	}
+	if err := validateDedup(opts.DedupThreshold, opts.DedupMode); err != nil {
+		return nil, err
+	}
 
 	// Check if collection exists
 	key := fmt.Sprintf("collection:%s", opts.Name)
@@ -53,21 +96,21 @@ func (db *DB) CreateCollection(opts *CreateCollectionOptions) (*Collection, erro
 		return nil, err
 	}
 	if exists && result != nil {
+		var existing Collection
+		if err := json.Unmarshal(result, &existing); err == nil && existing.DeletedAt != nil {
+			return nil, fmt.Errorf("%w: %s is in the trash until %s, restore it or wait for it to be purged",
+				errors.ErrCollectionExists, opts.Name, db.purgeTime(&existing).Format(time.RFC3339))
+		}
 		return nil, errors.ErrCollectionExists
 	}
 
-	// Create index configuration
-	indexConf := &index.IndexConfig{
-		IndexType: index.IndexType(opts.IndexType),
-		Dimension: opts.Dimension,
-		SpaceType: index.L2Space, // default to L2 distance
-		Parameters: map[string]interface{}{
-			"M":              opts.Parameters["M"],
-			"efConstruction": opts.Parameters["efConstruction"],
-		},
+	// Register the name first, Reconcile finds a create a crash interrupted
+	if err := db.registerCollection(opts.Name); err != nil {
+		return nil, fmt.Errorf("failed to register collection: %w", err)
 	}
 
 	// Create index
+	indexConf := db.indexConfig(opts.IndexType, opts.Dimension, opts.Parameters)
 	_, err = db.IndexManager.CreateIndex(opts.Name, indexConf)
 	if err != nil {
 		return nil, fmt.Errorf("failed to create index: %w", err)
@@ -75,6 +118,17 @@ func (db *DB) CreateCollection(opts *CreateCollectionOptions) (*Collection, erro
 
 	// Create collection
 	collection := NewCollection(opts)
+	if opts.Schema != nil {
+		data, err := json.Marshal(opts.Schema)
+		if err != nil {
+			return nil, err
+		}
+		collection.Metadata = maps.Clone(collection.Metadata)
+		if collection.Metadata == nil {
+			collection.Metadata = make(map[string]string)
+		}
+		collection.Metadata[schemaMetadataKey] = string(data)
+	}
 
 	// Save collection metadata
 	data, err := json.Marshal(collection)
@@ -85,10 +139,55 @@ func (db *DB) CreateCollection(opts *CreateCollectionOptions) (*Collection, erro
 	if err := db.Storage.PutScalar([]byte(key), data); err != nil {
 		return nil, err
 	}
+	if err := db.putStats(opts.Name); err != nil {
+		return nil, fmt.Errorf("failed to save collection stats: %w", err)
+	}
 
 	return collection, nil
 }
 
+// indexConfig builds the index configuration of a collection
+func (db *DB) indexConfig(indexType string, dimension int, params map[string]string) *index.IndexConfig {
+	return &index.IndexConfig{
+		IndexType:  index.IndexType(indexType),
+		Dimension:  dimension,
+		SpaceType:  index.L2Space, // default to L2 distance
+		Parameters: db.indexParameters(params),
+	}
+}
+
+// indexParameters merges the configured index defaults with the collection's
+// own parameters, which arrive as strings from the API
+func (db *DB) indexParameters(params map[string]string) map[string]interface{} {
+	defaults := map[string]int{
+		"M":              db.conf.Index.M,
+		"efConstruction": db.conf.Index.EfConstruction,
+		"efSearch":       db.conf.Index.EfSearch,
+		"maxElements":    db.conf.Index.MaxElements,
+		"nlist":          db.conf.Index.NList,
+		"nprobe":         db.conf.Index.NProbe,
+		"searchThreads":  db.conf.Index.SearchThreads,
+		"buildThreads":   db.conf.Index.BuildThreads,
+	}
+	result := make(map[string]interface{})
+	for key, value := range defaults {
+		if value > 0 {
+			result[key] = float64(value)
+		}
+	}
+	if db.conf.Index.AllowReplaceDeleted {
+		result["allowReplaceDeleted"] = true
+	}
+	for key, value := range params {
+		if f, err := strconv.ParseFloat(value, 64); err == nil {
+			result[key] = f
+		} else if b, err := strconv.ParseBool(value); err == nil {
+			result[key] = b
+		}
+	}
+	return result
+}
+
 func (db *DB) GetCollection(name string) (*Collection, error) {
 	key := fmt.Sprintf("collection:%s", name)
 	data, exists, err := db.Storage.GetScalar([]byte(key))
@@ -103,6 +202,9 @@ func (db *DB) GetCollection(name string) (*Collection, error) {
 	if err := json.Unmarshal(data, &collection); err != nil {
 		return nil, err
 	}
+	if collection.DeletedAt != nil {
+		return nil, errors.ErrCollectionNotFound
+	}
 
 	// Get index
 	_, err = db.IndexManager.GetIndex(name)
@@ -113,8 +215,18 @@ func (db *DB) GetCollection(name string) (*Collection, error) {
 	return &collection, nil
 }
 
-// DeleteCollection deletes a collection and its index
+// DeleteCollection moves a collection to the trash, from where
+// RestoreCollection brings it back until it is purged. Without trash
+// retention the collection is purged right away
 func (db *DB) DeleteCollection(name string) error {
+	if db.conf.Trash.RetentionHours < 0 {
+		return db.purgeCollection(name)
+	}
+	return db.trashCollection(name)
+}
+
+// purgeCollection deletes a collection, its index and its documents
+func (db *DB) purgeCollection(name string) error {
 	// Delete index first
 	if err := db.IndexManager.DeleteIndex(name); err != nil {
 		return fmt.Errorf("failed to delete index: %w", err)
@@ -129,15 +241,91 @@ func (db *DB) DeleteCollection(name string) error {
 	if !exists || result == nil {
 		return errors.ErrCollectionNotFound
 	}
+	var collection Collection
+	if err := json.Unmarshal(result, &collection); err != nil {
+		return err
+	}
 	if err := db.Storage.DeleteScalar([]byte(key)); err != nil {
 		return fmt.Errorf("failed to delete metadata: %w", err)
 	}
-	return nil
+	if err := db.Storage.DeleteScalar(statsKey(name)); err != nil {
+		return fmt.Errorf("failed to delete stats: %w", err)
+	}
+	if err := db.unregisterCollection(name); err != nil {
+		return fmt.Errorf("failed to unregister collection: %w", err)
+	}
+	// a collection created again under the name starts with its own settings
+	db.searchCaches.Delete(name)
+	fields := keywordFields(&collection)
+	if collection.StoreVectors || len(fields) > 0 {
+		ids, err := db.documentIDs(name)
+		if err != nil {
+			return err
+		}
+		if err := db.deleteStoredVectors(name, ids...); err != nil {
+			return err
+		}
+		if err := db.dropKeywordIndex(name, fields, ids); err != nil {
+			return err
+		}
+	}
+	return db.dropAccess(name)
 }
 
 // ListCollections lists all collection names
 func (db *DB) ListCollections() ([]string, error) {
 	// Get all collection names from index manager
-	collectionNames := db.IndexManager.GetAllIndexNames()
+	collectionNames := slices.DeleteFunc(db.IndexManager.GetAllIndexNames(), db.inTrash)
 	return collectionNames, nil
 }
+
+// VacuumCollection rebuilds the HNSW index of a collection without its
+// deleted elements and returns how many were purged, writes wait while the
+// index is rebuilt
+func (db *DB) VacuumCollection(name string) (int, error) {
+	if _, err := db.GetCollection(name); err != nil {
+		return 0, err
+	}
+	return db.IndexManager.Vacuum(name)
+}
+
+// ListClusters lists the approximate clusters of a collection's index with up
+// to sampleSize member IDs each. Members outside the default filter or the
+// caller's scope, see WithScopeFilter, are neither sampled nor counted, so
+// with a filter every member is read
+func (db *DB) ListClusters(name string, sampleSize int, scope map[string]any) ([]index.Cluster, error) {
+	collection, err := db.GetCollection(name)
+	if err != nil {
+		return nil, err
+	}
+	filter, inScope := scopeFilter(collection.DefaultFilter, scope, nil)
+	if len(filter) == 0 {
+		return db.IndexManager.ListClusters(name, sampleSize)
+	}
+
+	total, err := db.IndexManager.Count(name)
+	if err != nil {
+		return nil, err
+	}
+	clusters, err := db.IndexManager.ListClusters(name, total)
+	if err != nil {
+		return nil, err
+	}
+	for i := range clusters {
+		visible := clusters[i].SampleIDs[:0]
+		// a scope contradicting the default filter sees no member
+		for _, id := range clusters[i].SampleIDs {
+			if !inScope {
+				break
+			}
+			doc, err := db.getDocument(name, id)
+			if err != nil || !matchFilter(doc.Parameters, filter) {
+				continue
+			}
+			visible = append(visible, id)
+		}
+		clusters[i].Count = len(visible)
+		clusters[i].SampleIDs = visible[:min(len(visible), sampleSize)]
+	}
+	return clusters, nil
+}
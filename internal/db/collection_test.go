@@ -1,9 +1,13 @@
 package db
 
 import (
+	"fmt"
 	"oasisdb/internal/config"
+	"oasisdb/pkg/errors"
 	"os"
+	"strings"
 	"testing"
+	"time"
 
 	"github.com/stretchr/testify/assert"
 )
@@ -55,6 +59,15 @@ func TestCollectionOperations(t *testing.T) {
 	assert.Error(t, err)
 	assert.Nil(t, collection4)
 
+	// Test CreateCollection with an unregistered index type
+	collection6, err := db.CreateCollection(&CreateCollectionOptions{
+		Name:      "unknown_index",
+		Dimension: 2,
+		IndexType: "annoy",
+	})
+	assert.ErrorIs(t, err, errors.ErrInvalidParameter)
+	assert.Nil(t, collection6)
+
 	// Test DeleteCollection
 	err = db.DeleteCollection("test_collection")
 	assert.NoError(t, err)
@@ -68,3 +81,117 @@ func TestCollectionOperations(t *testing.T) {
 	err = db.DeleteCollection("non_existent")
 	assert.Error(t, err)
 }
+
+func TestIndexParameters(t *testing.T) {
+	conf, err := config.NewConfig(t.TempDir(), config.WithIndex(config.IndexConfig{
+		M:        32,
+		EfSearch: 100,
+	}))
+	assert.NoError(t, err)
+	db, err := New(conf)
+	assert.NoError(t, err)
+
+	params := db.indexParameters(map[string]string{"M": "8", "nlist": "4", "name": "x"})
+	assert.Equal(t, map[string]interface{}{
+		"M":        float64(8),
+		"efSearch": float64(100),
+		"nlist":    float64(4),
+	}, params)
+}
+
+func TestDataOnSeparateDirectories(t *testing.T) {
+	dir, paths := t.TempDir(), config.PathsConfig{WAL: t.TempDir(), SST: t.TempDir(), Index: t.TempDir()}
+	conf, err := config.NewConfig(dir, config.WithPaths(paths), config.WithSSTSize(1024))
+	assert.NoError(t, err)
+	db, err := New(conf)
+	assert.NoError(t, err)
+	assert.NoError(t, db.Open())
+
+	createTestCollection(t, db, "docs", 2)
+	for i := 0; i < 20; i++ {
+		assert.NoError(t, db.UpsertDocument("docs", &Document{
+			ID:         fmt.Sprintf("doc%02d", i),
+			Vector:     []float32{float32(i), 1},
+			Dimension:  2,
+			Parameters: map[string]any{"text": strings.Repeat("x", 100)},
+		}))
+	}
+	// memtables are flushed in the background
+	assert.Eventually(t, func() bool {
+		entries, err := os.ReadDir(conf.SSTDir())
+		return err == nil && len(entries) > 0
+	}, 5*time.Second, 10*time.Millisecond)
+	db.Close()
+
+	entries, err := os.ReadDir(dir)
+	assert.NoError(t, err)
+	assert.Empty(t, entries, "nothing is written to the data directory")
+	for _, dir := range []string{conf.MemTableWALDir(), conf.IndexWALDir(), conf.SSTDir(), conf.IndexDir()} {
+		entries, err := os.ReadDir(dir)
+		assert.NoError(t, err)
+		assert.NotEmpty(t, entries, dir)
+	}
+
+	db, err = New(conf)
+	assert.NoError(t, err)
+	assert.NoError(t, db.Open())
+	defer db.Close()
+	doc, err := db.GetDocument("docs", "doc07")
+	assert.NoError(t, err)
+	assert.Equal(t, []float32{7, 1}, doc.Vector)
+}
+
+func TestCollectionStats(t *testing.T) {
+	conf, err := config.NewConfig(t.TempDir())
+	assert.NoError(t, err)
+	db, err := New(conf)
+	assert.NoError(t, err)
+	assert.NoError(t, db.Open())
+
+	_, err = db.CreateCollection(&CreateCollectionOptions{Name: "docs", Dimension: 2, StoreVectors: true})
+	assert.NoError(t, err)
+	stats, err := db.CollectionStats("docs")
+	assert.NoError(t, err)
+	assert.Zero(t, stats.Documents)
+	assert.False(t, stats.CreatedAt.IsZero())
+	created := stats.CreatedAt
+
+	doc := func(id string) *Document {
+		return &Document{ID: id, Vector: []float32{1, 2}, Dimension: 2, Parameters: map[string]any{"id": id}}
+	}
+	assert.NoError(t, db.UpsertDocument("docs", doc("a")))
+	assert.NoError(t, db.UpsertDocument("docs", doc("b")))
+	assert.NoError(t, db.UpsertDocument("docs", doc("a")))
+	// the batch overwrites b and writes c twice
+	assert.NoError(t, db.BatchUpsertDocuments("docs", []*Document{doc("b"), doc("c"), doc("c")}))
+	assert.NoError(t, db.DeleteDocument("docs", "a"))
+
+	stats, err = db.CollectionStats("docs")
+	assert.NoError(t, err)
+	assert.Equal(t, int64(2), stats.Documents)
+	assert.Equal(t, int64(2), stats.Vectors)
+	assert.True(t, stats.UpdatedAt.After(created))
+
+	// the counters match a count of the stored documents
+	unlock := db.lockStats("docs")
+	assert.NoError(t, db.Storage.DeleteScalar(statsKey("docs")))
+	counted, err := db.loadStats("docs")
+	unlock()
+	assert.NoError(t, err)
+	assert.Equal(t, stats.Documents, counted.Documents)
+	assert.Equal(t, stats.Bytes, counted.Bytes)
+	assert.NotZero(t, counted.Bytes)
+	assert.NoError(t, db.UpsertDocument("docs", doc("d")))
+	db.Close()
+
+	// the counters are persisted
+	db, err = New(conf)
+	assert.NoError(t, err)
+	assert.NoError(t, db.Open())
+	defer db.Close()
+	stats, err = db.CollectionStats("docs")
+	assert.NoError(t, err)
+	assert.Equal(t, int64(3), stats.Documents)
+	assert.Equal(t, int64(3), stats.Vectors)
+	assert.Greater(t, stats.Bytes, counted.Bytes)
+}
@@ -0,0 +1,33 @@
+package db
+
+import "oasisdb/internal/storage/tree"
+
+// CompactionQueueMetric is the number of flushes and level compactions queued
+// in the scalar storage, observed every time it changes
+const CompactionQueueMetric = "compaction_queue_depth"
+
+// CompactStorage queues the compaction of a level of the scalar storage into
+// the next one, a negative level queues every level. It returns once queued,
+// CompactionStatus shows the progress
+func (db *DB) CompactStorage(level int) error {
+	return db.Storage.Compact(level)
+}
+
+// CompactionStatus returns the levels of the scalar storage and the state of
+// their compactions
+func (db *DB) CompactionStatus() tree.CompactionStatus {
+	return db.Storage.CompactionStatus()
+}
+
+// WritesStopped reports whether writes wait for the compaction of the scalar
+// storage to catch up
+func (db *DB) WritesStopped() bool {
+	return db.Storage.WriteState() == tree.WritesStopped
+}
+
+// observeCompactionQueue records the depth of the compaction queue in Metrics
+func (db *DB) observeCompactionQueue() {
+	db.Storage.ObserveCompactionQueue(func(depth int) {
+		db.Metrics.Observe(CompactionQueueMetric, float64(depth))
+	})
+}
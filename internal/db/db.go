@@ -1,17 +1,51 @@
 package db
 
 import (
+	"fmt"
 	"oasisdb/internal/cache"
 	"oasisdb/internal/config"
+	"oasisdb/internal/embedding"
 	"oasisdb/internal/index"
+	"oasisdb/internal/metrics"
+	"oasisdb/internal/replication"
 	"oasisdb/internal/storage"
+	"oasisdb/internal/tier"
+	"oasisdb/pkg/logger"
+	"sync"
+	"time"
 )
 
 type DB struct {
 	conf         *config.Config
+	confMu       sync.RWMutex // guards the settings of conf a reload changes, see ApplyConfig
 	Storage      storage.ScalarStorage
 	IndexManager *index.Manager
 	Cache        *cache.LRUCache
+	Metrics      *metrics.Registry
+
+	embedder *embedding.Batcher // batches and throttles bulk embedding
+	access   *accessTracker     // last access of documents, drives archiving
+	batches  *batchLog          // makes batch writes atomic across storage and index
+	replLog  *replication.Log   // writes served to followers, nil on followers
+	follower *replication.Follower
+	scrolls  scrollSnapshots // snapshots pinned by scrolls
+	watch    watchStats      // ingestion of the watch directory
+
+	keywordLocks  sync.Map   // collection name to the lock of its keyword index
+	statsLocks    sync.Map   // collection name to the lock of its counters
+	searchCaches  sync.Map   // collection name to its search result cache
+	writeVersions sync.Map   // collection name to its *atomic.Uint64 write version, see WriteVersion
+	reindexes     sync.Map   // collection name to the status of its last reindex
+	registryMu    sync.Mutex // serializes updates of the collection registry
+	trashMu       sync.Mutex // serializes moving collections to and from the trash
+
+	processorsMu sync.RWMutex
+	processors   []Processor
+
+	background sync.WaitGroup // background work that must finish before close
+	stopCh     chan struct{}  // stops the access loop on close
+	doneCh     chan struct{}  // closed when the access loop has exited
+	purgeDone  chan struct{}  // closed when the trash purge loop has exited
 }
 
 func New(conf *config.Config) (*DB, error) {
@@ -20,7 +54,28 @@ func New(conf *config.Config) (*DB, error) {
 	}, nil
 }
 
+// Config returns the configuration the database was created with
+func (db *DB) Config() *config.Config {
+	return db.conf
+}
+
 func (db *DB) Open() error {
+	if db.conf.Tier.Endpoint != "" && db.conf.ColdTier == nil {
+		coldTier, err := tier.New(tier.Options{
+			Endpoint:   db.conf.Tier.Endpoint,
+			Bucket:     db.conf.Tier.Bucket,
+			Prefix:     db.conf.Tier.Prefix,
+			Region:     db.conf.Tier.Region,
+			AccessKey:  db.conf.Tier.AccessKey,
+			SecretKey:  db.conf.Tier.SecretKey,
+			CacheDir:   db.conf.Tier.CacheDir,
+			CacheBytes: db.conf.Tier.CacheBytes,
+		})
+		if err != nil {
+			return fmt.Errorf("failed to open tier: %w", err)
+		}
+		db.conf.ColdTier = coldTier
+	}
 	storage, err := storage.NewStorage(db.conf)
 	if err != nil {
 		return err
@@ -29,17 +84,79 @@ func (db *DB) Open() error {
 	if err != nil {
 		return err
 	}
-	// load indexs
-	if err := indexManager.LoadIndexs(); err != nil {
-		return err
-	}
 	db.Storage = storage
 	db.IndexManager = indexManager
-	db.Cache = cache.NewLRUCache(db.conf.CacheSize)
+	if err := db.openReplication(); err != nil {
+		return err
+	}
+	// indices are loaded, redo batches a crash interrupted
+	if err := db.recoverBatches(); err != nil {
+		return err
+	}
+	db.Cache = cache.NewLRUCache(db.conf.Cache.Size)
+	db.Metrics = metrics.NewRegistry()
+	db.observeCompactionQueue()
+	db.access = newAccessTracker()
+	// keys written before their parts were escaped, batches included
+	if err := db.migrateKeys(); err != nil {
+		return fmt.Errorf("failed to migrate storage keys: %w", err)
+	}
+	// repair collections a crash left without metadata or index
+	report, err := db.Reconcile()
+	if err != nil {
+		return fmt.Errorf("failed to reconcile collections: %w", err)
+	}
+	if len(report.RemovedIndices)+len(report.RestoredIndices)+len(report.Orphans) > 0 {
+		logger.Warn("Reconciled collections", "removed_indices", report.RemovedIndices,
+			"restored_indices", report.RestoredIndices, "orphans", report.Orphans)
+	}
+	// every collection has an index now, the other index files are orphans
+	if !db.conf.GC.Disabled {
+		garbage, err := db.IndexManager.CollectGarbage(db.conf.GC.DryRun)
+		if err != nil {
+			return fmt.Errorf("failed to collect index garbage: %w", err)
+		}
+		if len(garbage.Files) > 0 {
+			logger.Info("Index garbage collection completed", "files", len(garbage.Files),
+				"bytes", garbage.Bytes, "dry_run", garbage.DryRun)
+		}
+	}
+	db.stopCh = make(chan struct{})
+	db.doneCh = make(chan struct{})
+	if db.conf.EmbeddingProvider != nil {
+		db.embedder = embedding.NewBatcher(db.conf.EmbeddingProvider, embedding.BatchOptions{
+			BatchSize:   db.conf.Embedding.BatchSize,
+			Concurrency: db.conf.Embedding.Concurrency,
+			RateLimit:   db.conf.Embedding.RateLimit,
+		})
+	}
+	go db.runAccessLoop()
+	db.purgeDone = make(chan struct{})
+	go db.runPurgeLoop()
+	if db.watching() {
+		db.background.Add(1)
+		go db.runWatchLoop()
+	}
+	if db.follower != nil {
+		db.background.Add(1)
+		go func() {
+			defer db.background.Done()
+			db.follower.Run(db.stopCh)
+		}()
+	}
 	return nil
 }
 
 func (db *DB) Close() {
+	close(db.stopCh)
+	<-db.doneCh
+	<-db.purgeDone
+	db.background.Wait()
+	db.scrolls.expire(time.Time{})
+	if err := db.flushAccess(); err != nil {
+		logger.Error("Failed to flush access records", "error", err)
+	}
+	db.batches.close()
 	db.Storage.Stop()
 	db.IndexManager.Close()
 	db.Cache.Clear()
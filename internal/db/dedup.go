@@ -0,0 +1,81 @@
+package db
+
+import (
+	"fmt"
+	"maps"
+
+	"oasisdb/pkg/errors"
+)
+
+// Dedup modes of a collection, what an upsert near an existing document does
+const (
+	DedupSkip  = "skip"  // the upsert is dropped
+	DedupMerge = "merge" // its parameters are merged into the existing document
+)
+
+// DedupMatch is an upsert deduplicated against an existing document
+type DedupMatch struct {
+	ID        string  // ID of the upserted document, which wasn't written
+	MatchedID string  // existing document within the dedup threshold
+	Distance  float32 // distance between their vectors
+	Merged    bool    // the parameters were merged into the existing document
+}
+
+func validateDedup(threshold float32, mode string) error {
+	if threshold < 0 {
+		return fmt.Errorf("%w: dedup threshold must not be negative", errors.ErrInvalidParameter)
+	}
+	if mode != "" && mode != DedupSkip && mode != DedupMerge {
+		return fmt.Errorf("%w: dedup mode must be %s or %s", errors.ErrInvalidParameter, DedupSkip, DedupMerge)
+	}
+	return nil
+}
+
+// findDuplicate returns the nearest other document within the dedup
+// threshold of the collection, or nil. Documents upserted at the same time
+// don't see each other, so near duplicates may still slip through
+func (db *DB) findDuplicate(collection *Collection, doc *Document) (*DedupMatch, error) {
+	idx, release, err := db.IndexManager.AcquireIndex(collection.Name)
+	if err != nil {
+		return nil, err
+	}
+	defer release()
+	if idx.Count() == 0 {
+		return nil, nil
+	}
+
+	// the document itself is found when it is upserted again
+	result, err := idx.Search(doc.Vector, 2)
+	if err != nil {
+		return nil, fmt.Errorf("failed to search for duplicates: %w", err)
+	}
+	for i, id := range result.IDs {
+		if id == doc.ID {
+			continue
+		}
+		if result.Distances[i] > collection.DedupThreshold {
+			return nil, nil
+		}
+		return &DedupMatch{ID: doc.ID, MatchedID: id, Distance: result.Distances[i]}, nil
+	}
+	return nil, nil
+}
+
+// mergeDuplicate returns the matched document with the parameters of doc
+// merged into those of base, the matched document as stored if base is nil
+func (db *DB) mergeDuplicate(collectionName string, match *DedupMatch, doc, base *Document) (*Document, error) {
+	if base == nil {
+		existing, err := db.getDocument(collectionName, match.MatchedID)
+		if err != nil {
+			return nil, fmt.Errorf("failed to get duplicate %s: %w", match.MatchedID, err)
+		}
+		base = existing
+	}
+	params := maps.Clone(base.Parameters)
+	if params == nil {
+		params = make(map[string]any, len(doc.Parameters))
+	}
+	maps.Copy(params, doc.Parameters)
+	match.Merged = true
+	return &Document{ID: base.ID, Vector: base.Vector, Parameters: params, Dimension: len(base.Vector)}, nil
+}
@@ -1,20 +1,21 @@
 package db
 
 import (
+	"context"
 	"encoding/json"
+	stderrors "errors"
 	"fmt"
+	"oasisdb/internal/tracing"
 	"oasisdb/pkg/errors"
 	"oasisdb/pkg/logger"
+	"oasisdb/pkg/processor"
 	"time"
+
+	"go.opentelemetry.io/otel/attribute"
 )
 
 // Document represents a document (used for client API)
-type Document struct {
-	ID         string         `json:"id"`
-	Vector     []float32      `json:"vector"`
-	Parameters map[string]any `json:"parameters"`
-	Dimension  int            `json:"dimension"`
-}
+type Document = processor.Document
 
 // DocumentMetadata represents document metadata stored in scalar storage (without vector)
 type DocumentMetadata struct {
@@ -28,6 +29,11 @@ type batchData struct {
 	docValues [][]byte
 	ids       []string
 	vectors   [][]float32
+
+	keywordFields  []string        // keyword indexed fields of the collection
+	keywordChanges []keywordChange // applied to the keyword index with the batch
+
+	duplicates []DedupMatch // documents deduplicated against existing ones
 }
 
 // docToMetadata converts a Document to DocumentMetadata (without vector)
@@ -51,55 +57,194 @@ func metadataToDoc(metadata *DocumentMetadata, vector []float32) *Document {
 
 // UpsertDocument inserts or updates a document
 func (db *DB) UpsertDocument(collectionName string, doc *Document) error {
+	_, err := db.UpsertDocumentDedup(collectionName, doc)
+	return err
+}
+
+// UpsertDocumentDedup is UpsertDocument reporting the existing document the
+// upsert was deduplicated against, nil if the document was written
+func (db *DB) UpsertDocumentDedup(collectionName string, doc *Document) (*DedupMatch, error) {
+	return db.upsertDocument(collectionName, doc, true)
+}
+
+func (db *DB) upsertDocument(collectionName string, doc *Document, dedup bool) (*DedupMatch, error) {
+	if err := db.beforeUpsert(collectionName, doc); err != nil {
+		return nil, err
+	}
+
 	// handle automatic embedding generation if requested
 	if doc.Parameters != nil {
 		if flag, ok := doc.Parameters["embedding"].(bool); ok && flag && len(doc.Vector) == 0 {
 			text, okText := doc.Parameters["text"].(string)
 			if !okText {
-				return fmt.Errorf("text parameter is required for embedding when vector is not provided")
+				return nil, fmt.Errorf("text parameter is required for embedding when vector is not provided")
 			}
-			vec64, err := db.conf.EmbeddingProvider.Embed(text)
+			vector, err := db.embed(text)
 			if err != nil {
-				return fmt.Errorf("failed to generate embedding: %w", err)
+				return nil, fmt.Errorf("failed to generate embedding: %w", err)
 			}
-			doc.Vector = float64SliceTo32(vec64)
+			doc.Vector = vector
 			doc.Dimension = len(doc.Vector)
 		}
 	}
 
 	// validate vector dimension
 	if len(doc.Vector) != doc.Dimension {
-		return fmt.Errorf("vector dimension mismatch: expected %d, got %d", doc.Dimension, len(doc.Vector))
+		return nil, fmt.Errorf("vector dimension mismatch: expected %d, got %d", doc.Dimension, len(doc.Vector))
+	}
+
+	collection, collectionErr := db.GetCollection(collectionName)
+	if collectionErr == nil {
+		if err := validateDocument(collection, doc); err != nil {
+			return nil, err
+		}
+		// unit length vectors rank the same under L2, inner product and cosine
+		if collection.Normalize {
+			doc.Vector = normalizeVector(doc.Vector)
+		}
+		if dedup && collection.DedupThreshold > 0 {
+			match, err := db.findDuplicate(collection, doc)
+			if err != nil {
+				return nil, err
+			}
+			if match != nil {
+				if collection.DedupMode == DedupMerge {
+					merged, err := db.mergeDuplicate(collectionName, match, doc, nil)
+					if err != nil {
+						return nil, err
+					}
+					if _, err := db.upsertDocument(collectionName, merged, false); err != nil {
+						return nil, err
+					}
+				}
+				return match, nil
+			}
+		}
+		if fields := keywordFields(collection); len(fields) > 0 {
+			defer db.lockKeywords(collectionName)()
+			if err := db.updateKeywordIndex(collectionName, fields, keywordChange{doc.ID, doc.Parameters}); err != nil {
+				return nil, err
+			}
+		}
 	}
 
 	// store document metadata (without vector)
-	docKey := fmt.Sprintf("doc:%s:%s", collectionName, doc.ID)
+	docKey := documentKey(collectionName, doc.ID)
 	metadata := docToMetadata(doc)
 	docData, err := json.Marshal(metadata)
 	if err != nil {
-		return err
+		return nil, err
 	}
-	if err := db.Storage.PutScalar([]byte(docKey), docData); err != nil {
-		return err
+	keys, values := [][]byte{docKey}, [][]byte{docData}
+	if collectionErr == nil && collection.StoreVectors {
+		data, err := encodeVector(doc.Vector)
+		if err != nil {
+			return nil, err
+		}
+		keys, values = append(keys, vectorKey(collectionName, doc.ID)), append(values, data)
+	}
+	// the counters are written with the document
+	unlock := func() {}
+	if collectionErr == nil {
+		unlock = db.lockStats(collectionName)
+		key, value, err := db.statsWrite(collectionName, keys, values)
+		if err != nil {
+			unlock()
+			return nil, err
+		}
+		keys, values = append(keys, key), append(values, value)
+	}
+	err = db.Storage.BatchPutScalar(keys, values)
+	unlock()
+	if err != nil {
+		return nil, err
 	}
 
 	// upsert vector index
 	if err := db.IndexManager.AddVector(collectionName, doc.ID, doc.Vector); err != nil {
-		return err
+		return nil, err
 	}
+	db.ClearSearchCache(collectionName)
 
-	return nil
+	db.deleteArchived(collectionName, db.touch(collectionName, doc.ID))
+	return nil, nil
 }
 
-// GetDocument gets a document
+// GetDocument gets a document, hiding it if it does not match the
+// collection's default filter. Processors see it before it is returned
 func (db *DB) GetDocument(collectionName string, id string) (*Document, error) {
+	return db.GetScopedDocument(collectionName, id, nil)
+}
+
+// GetScopedDocument gets a document, hiding it if it does not match the
+// collection's default filter or scope, see WithScopeFilter
+func (db *DB) GetScopedDocument(collectionName string, id string, scope map[string]any) (*Document, error) {
+	collection, err := db.GetCollection(collectionName)
+	if err != nil {
+		return nil, err
+	}
+
+	doc, err := db.getDocument(collectionName, id)
+	if err != nil {
+		return nil, err
+	}
+	if !matchFilter(doc.Parameters, collection.DefaultFilter) || !matchFilter(doc.Parameters, scope) {
+		return nil, errors.ErrDocumentNotFound
+	}
+	if err := db.afterFetch(collectionName, doc); err != nil {
+		return nil, err
+	}
+	db.recordRead(collectionName, id)
+	return doc, nil
+}
+
+// CheckWriteScope checks that a caller whose reads are limited to scope, see
+// WithScopeFilter, may write docs: their parameters must match the scope and
+// so must the documents they replace, ErrOutOfScope tells otherwise
+func (db *DB) CheckWriteScope(collectionName string, docs []*Document, scope map[string]any) error {
+	if len(scope) == 0 {
+		return nil
+	}
+	for _, doc := range docs {
+		if !matchFilter(doc.Parameters, scope) {
+			return fmt.Errorf("%w: %s", errors.ErrOutOfScope, doc.ID)
+		}
+		data, exists, err := db.Storage.GetScalar(documentKey(collectionName, doc.ID))
+		if err != nil {
+			return fmt.Errorf("failed to get document %s: %w", doc.ID, err)
+		}
+		if !exists || len(data) == 0 {
+			continue
+		}
+		var metadata DocumentMetadata
+		if err := json.Unmarshal(data, &metadata); err != nil {
+			return fmt.Errorf("failed to decode document %s: %w", doc.ID, err)
+		}
+		if !matchFilter(metadata.Parameters, scope) {
+			return fmt.Errorf("%w: %s", errors.ErrOutOfScope, doc.ID)
+		}
+	}
+	return nil
+}
+
+// getDocument loads a document without applying any filter
+func (db *DB) getDocument(collectionName string, id string) (*Document, error) {
+	return db.getDocumentContext(context.Background(), collectionName, id)
+}
+
+// getDocumentContext is getDocument tracing the storage read as part of the
+// request in ctx
+func (db *DB) getDocumentContext(ctx context.Context, collectionName string, id string) (*Document, error) {
 	// Get document metadata from scalar storage
-	docKey := fmt.Sprintf("doc:%s:%s", collectionName, id)
-	data, exists, err := db.Storage.GetScalar([]byte(docKey))
+	docKey := documentKey(collectionName, id)
+	_, span := tracing.Start(ctx, "lsm.Get", attribute.String("key", string(docKey)))
+	data, exists, err := db.Storage.GetScalar(docKey)
+	span.SetAttributes(attribute.Bool("found", exists))
+	tracing.End(span, err)
 	if err != nil {
 		return nil, err
 	}
-	if !exists {
+	if !exists || len(data) == 0 {
 		return nil, errors.ErrDocumentNotFound
 	}
 
@@ -108,8 +253,7 @@ func (db *DB) GetDocument(collectionName string, id string) (*Document, error) {
 		return nil, err
 	}
 
-	// Get vector from vector index
-	vector, err := db.IndexManager.GetVector(collectionName, id)
+	vector, err := db.documentVector(collectionName, id)
 	if err != nil {
 		return nil, fmt.Errorf("failed to get vector: %w", err)
 	}
@@ -119,162 +263,306 @@ func (db *DB) GetDocument(collectionName string, id string) (*Document, error) {
 	return doc, nil
 }
 
+// documentVector loads the vector of a document from the vector index, or
+// from the archive for cold documents
+func (db *DB) documentVector(collectionName string, id string) ([]float32, error) {
+	vector, err := db.IndexManager.GetVector(collectionName, id)
+	if err != nil && db.isArchived(collectionName, id) {
+		vector, err = db.archivedVector(collectionName, id)
+	}
+	if err != nil {
+		// collections storing vectors can serve reads the index lost
+		if stored, storedErr := db.storedVector(collectionName, id); storedErr == nil {
+			vector, err = stored, nil
+		}
+	}
+	return vector, err
+}
+
 // DeleteDocument deletes a document
 func (db *DB) DeleteDocument(collectionName string, id string) error {
-	docKey := fmt.Sprintf("doc:%s:%s", collectionName, id)
-	if err := db.Storage.DeleteScalar([]byte(docKey)); err != nil {
+	// cached results may hold the document even if the delete fails halfway
+	defer db.ClearSearchCache(collectionName)
+
+	collection, collectionErr := db.GetCollection(collectionName)
+	if collectionErr == nil {
+		if fields := keywordFields(collection); len(fields) > 0 {
+			defer db.lockKeywords(collectionName)()
+			if err := db.updateKeywordIndex(collectionName, fields, keywordChange{id: id}); err != nil {
+				return err
+			}
+		}
+	}
+
+	docKey := documentKey(collectionName, id)
+	if collectionErr == nil {
+		if err := db.deleteCounted(collectionName, id); err != nil {
+			return err
+		}
+	} else if err := db.Storage.DeleteScalar(docKey); err != nil {
 		return err
 	}
 
-	if err := db.IndexManager.DeleteVector(collectionName, id); err != nil {
+	if db.isArchived(collectionName, id) {
+		// archived documents are no longer in the index
+		if err := db.Storage.DeleteScalar(archiveKey(collectionName, id)); err != nil {
+			return err
+		}
+	} else if err := db.IndexManager.DeleteVector(collectionName, id); err != nil {
 		return err
 	}
+	if collectionErr == nil && collection.StoreVectors {
+		if err := db.deleteStoredVectors(collectionName, id); err != nil {
+			return err
+		}
+	}
+	db.forgetAccess(collectionName, id)
 	return nil
 }
 
 // SearchVectors returns top-k vector ids and distances
-func (db *DB) SearchVectors(collectionName string, queryVector []float32, k int) ([]string, []float32, error) {
+func (db *DB) SearchVectors(ctx context.Context, collectionName string, queryVector []float32, k int, opts ...SearchOption) ([]string, []float32, error) {
+	o := newSearchOptions(opts)
+	k, err := o.window(k)
+	if err != nil {
+		return nil, nil, err
+	}
+	log := logger.Ctx(ctx)
 	startTime := time.Now()
-	logger.Info("Starting vector search", "collection", collectionName, "k", k, "vector_dim", len(queryVector))
+	log.Infow("Starting vector search", "collection", collectionName, "k", k, "vector_dim", len(queryVector))
 
 	// check if collection exists
-	_, err := db.GetCollection(collectionName)
+	collection, err := db.GetCollection(collectionName)
 	if err != nil {
-		logger.Error("Collection not found", "collection", collectionName, "error", err)
+		log.Errorw("Collection not found", "collection", collectionName, "error", err)
 		return nil, nil, err
 	}
-	logger.Debug("Collection validated", "collection", collectionName)
+	if collection.Normalize {
+		queryVector = normalizeVector(queryVector)
+	}
+	log.Debugw("Collection validated", "collection", collectionName)
 
-	index, err := db.IndexManager.GetIndex(collectionName)
+	index, release, err := db.IndexManager.AcquireIndex(collectionName)
 	if err != nil {
-		logger.Error("Failed to get index", "collection", collectionName, "error", err)
+		log.Errorw("Failed to get index", "collection", collectionName, "error", err)
 		return nil, nil, err
 	}
-	logger.Debug("Retrieved index for collection", "collection", collectionName)
-
+	defer release()
+	log.Debugw("Retrieved index for collection", "collection", collectionName)
+
+	// enforce the collection default and scope filters, which need document
+	// metadata
+	filter, ok := scopeFilter(collection.DefaultFilter, o.scope, nil)
+	if !ok {
+		o.pageStart(0)
+		return []string{}, []float32{}, nil
+	}
+	var fetchDuration time.Duration
 	searchStart := time.Now()
-	searchResult, err := index.Search(queryVector, k)
-	searchDuration := time.Since(searchStart)
+	searchResult, err := db.searchFiltered(ctx, index, collection, queryVector, k, filter, o, func(id string) (bool, error) {
+		fetchStart := time.Now()
+		defer func() { fetchDuration += time.Since(fetchStart) }()
+		doc, err := db.getDocumentContext(ctx, collectionName, id)
+		if err != nil {
+			log.Errorw("Failed to get document", "collection", collectionName, "id", id, "error", err)
+			return false, err
+		}
+		return matchFilter(doc.Parameters, filter), nil
+	})
+	searchDuration := time.Since(searchStart) - fetchDuration
 	if err != nil {
-		logger.Error("Vector search failed", "collection", collectionName, "error", err)
+		log.Errorw("Vector search failed", "collection", collectionName, "error", err)
 		return nil, nil, err
 	}
 
+	ids, distances := searchResult.IDs, searchResult.Distances
+
+	o.recordTimings(searchDuration, fetchDuration)
 	totalDuration := time.Since(startTime)
-	logger.Info("Vector search completed", "collection", collectionName, "k", k,
-		"results", len(searchResult.IDs), "search_duration", searchDuration, "total_duration", totalDuration)
+	log.Infow("Vector search completed", "collection", collectionName, "k", k,
+		"results", len(ids), "search_duration", searchDuration, "total_duration", totalDuration)
+	db.logSlowSearch(ctx, "vector", collection, k, searchDuration, totalDuration)
 
-	return searchResult.IDs, searchResult.Distances, nil
+	start := o.pageStart(len(ids))
+	ids, distances = ids[start:], distances[start:]
+	return ids, distances, nil
 }
 
 // SearchDocuments returns top-k documents and distances
-func (db *DB) SearchDocuments(collectionName string, queryDoc *Document, k int, filter map[string]any) ([]*Document, []float32, error) {
+func (db *DB) SearchDocuments(ctx context.Context, collectionName string, queryDoc *Document, k int, filter map[string]any, opts ...SearchOption) ([]*Document, []float32, error) {
+	o := newSearchOptions(opts)
+	k, err := o.window(k)
+	if err != nil {
+		return nil, nil, err
+	}
+	log := logger.Ctx(ctx)
 	startTime := time.Now()
-	logger.Info("Starting document search", "collection", collectionName, "k", k, "has_filter", filter != nil)
+	log.Infow("Starting document search", "collection", collectionName, "k", k, "has_filter", filter != nil)
 
 	// Handle automatic embedding generation if requested
 	if queryDoc.Parameters != nil {
 		if flag, ok := queryDoc.Parameters["embedding"].(bool); ok && flag && len(queryDoc.Vector) == 0 {
 			text, okText := queryDoc.Parameters["text"].(string)
 			if !okText {
-				logger.Error("Text parameter missing for embedding generation")
+				log.Errorw("Text parameter missing for embedding generation")
 				return nil, nil, fmt.Errorf("text parameter is required for embedding when vector is not provided")
 			}
-			logger.Debug("Generating embedding for text", "text_length", len(text))
-			vec64, err := db.conf.EmbeddingProvider.Embed(text)
+			log.Debugw("Generating embedding for text", "text_length", len(text))
+			_, span := tracing.Start(ctx, "embedding.Embed", attribute.Int("text_length", len(text)))
+			vector, err := db.embed(text)
+			tracing.End(span, err)
 			if err != nil {
-				logger.Error("Failed to generate embedding", "error", err)
+				log.Errorw("Failed to generate embedding", "error", err)
 				return nil, nil, fmt.Errorf("failed to generate embedding: %w", err)
 			}
-			queryDoc.Vector = float64SliceTo32(vec64)
+			queryDoc.Vector = vector
 			queryDoc.Dimension = len(queryDoc.Vector)
-			logger.Debug("Generated embedding", "dimension", queryDoc.Dimension)
+			log.Debugw("Generated embedding", "dimension", queryDoc.Dimension)
 		}
 	}
 
 	// Validate that query document has a vector
 	if len(queryDoc.Vector) == 0 {
-		logger.Error("Query document missing vector")
+		log.Errorw("Query document missing vector")
 		return nil, nil, fmt.Errorf("query document must have a vector or embedding parameters")
 	}
-	logger.Debug("Query vector validated", "dimension", len(queryDoc.Vector))
+	log.Debugw("Query vector validated", "dimension", len(queryDoc.Vector))
 
-	// 1. get index
-	index, err := db.IndexManager.GetIndex(collectionName)
+	// 1. get collection and index
+	collection, err := db.GetCollection(collectionName)
 	if err != nil {
-		logger.Error("Failed to get index", "collection", collectionName, "error", err)
+		log.Errorw("Collection not found", "collection", collectionName, "error", err)
 		return nil, nil, err
 	}
-	logger.Debug("Retrieved index for collection", "collection", collectionName)
+	filter, ok := scopeFilter(collection.DefaultFilter, o.scope, filter)
+	if !ok {
+		log.Infow("Filter excludes every document", "collection", collectionName)
+		return o.noResults()
+	}
+	queryVector := queryDoc.Vector
+	if collection.Normalize {
+		queryVector = normalizeVector(queryVector)
+	}
 
-	// 2. search using hnsw index
+	index, release, err := db.IndexManager.AcquireIndex(collectionName)
+	if err != nil {
+		log.Errorw("Failed to get index", "collection", collectionName, "error", err)
+		return nil, nil, err
+	}
+	defer release()
+	log.Debugw("Retrieved index for collection", "collection", collectionName)
+
+	// 2. search the index, fetching the documents of the results to drop
+	// those rejected by the filter
+	var fetchDuration time.Duration
+	fetched := make(map[string]*Document)
+	fetchCtx, fetchSpan := tracing.Start(ctx, "storage.MultiGet", attribute.String("collection", collectionName))
+	defer fetchSpan.End()
 	searchStart := time.Now()
-	searchResult, err := index.Search(queryDoc.Vector, k)
-	searchDuration := time.Since(searchStart)
+	searchResult, err := db.searchFiltered(ctx, index, collection, queryVector, k, filter, o, func(id string) (bool, error) {
+		fetchStart := time.Now()
+		defer func() { fetchDuration += time.Since(fetchStart) }()
+		doc, err := db.getDocumentContext(fetchCtx, collectionName, id)
+		if err != nil {
+			log.Errorw("Failed to get document", "collection", collectionName, "id", id, "error", err)
+			return false, err
+		}
+		fetched[id] = doc
+		return matchFilter(doc.Parameters, filter), nil
+	})
+	searchDuration := time.Since(searchStart) - fetchDuration
 	if err != nil {
-		logger.Error("Index search failed", "collection", collectionName, "error", err)
+		log.Errorw("Index search failed", "collection", collectionName, "error", err)
 		return nil, nil, err
 	}
-	logger.Debug("Index search completed", "collection", collectionName, "k", k,
+	log.Debugw("Index search completed", "collection", collectionName, "k", k,
 		"found_results", len(searchResult.IDs), "search_duration", searchDuration)
+	o.recordTimings(searchDuration, 0)
 
 	// 3. check if any results found
 	if len(searchResult.IDs) == 0 {
-		logger.Info("No search results found", "collection", collectionName, "k", k)
-		return nil, nil, errors.ErrNoResultsFound
+		log.Infow("No search results found", "collection", collectionName, "k", k)
+		return o.noResults()
 	}
 
-	// 4. get documents by ids
-	docs := make([]*Document, len(searchResult.IDs))
+	// 4. get the documents of the results, fetched already when filtered
+	docs := make([]*Document, 0, len(searchResult.IDs))
 	fetchStart := time.Now()
-	for i, id := range searchResult.IDs {
-		doc, err := db.GetDocument(collectionName, id)
-		if err != nil {
-			logger.Error("Failed to get document", "collection", collectionName, "id", id, "error", err)
+	for _, id := range searchResult.IDs {
+		doc, ok := fetched[id]
+		if !ok {
+			if doc, err = db.getDocumentContext(fetchCtx, collectionName, id); err != nil {
+				log.Errorw("Failed to get document", "collection", collectionName, "id", id, "error", err)
+				return nil, nil, err
+			}
+		}
+		if err := db.afterFetch(collectionName, doc); err != nil {
+			log.Errorw("Failed to process document", "collection", collectionName, "id", id, "error", err)
 			return nil, nil, err
 		}
-		docs[i] = doc
+		docs = append(docs, doc)
+	}
+	distances := searchResult.Distances
+	fetchDuration += time.Since(fetchStart)
+	o.recordTimings(searchDuration, fetchDuration)
+	fetchSpan.SetAttributes(attribute.Int("candidates", max(len(fetched), len(docs))), attribute.Int("fetched", len(docs)))
+	log.Debugw("Document fetch completed", "collection", collectionName, "count", len(docs), "fetch_duration", fetchDuration)
+	start := o.pageStart(len(docs))
+	docs, distances = docs[start:], distances[start:]
+
+	ids := make([]string, len(docs))
+	for i, doc := range docs {
+		ids[i] = doc.ID
 	}
-	fetchDuration := time.Since(fetchStart)
-	logger.Debug("Document fetch completed", "collection", collectionName, "count", len(docs), "fetch_duration", fetchDuration)
+	db.recordRead(collectionName, ids...)
 
 	totalDuration := time.Since(startTime)
-	logger.Info("Document search completed", "collection", collectionName, "k", k,
+	log.Infow("Document search completed", "collection", collectionName, "k", k,
 		"results", len(docs), "total_duration", totalDuration)
+	db.logSlowSearch(ctx, "document", collection, k, searchDuration, totalDuration)
 
 	// 5. return documents
-	return docs, searchResult.Distances, nil
+	return docs, distances, nil
 }
 
-func (db *DB) prepareBatchData(collectionName string, docs []*Document) (*batchData, error) {
+// prepareBatchData validates documents and encodes them for a batch write,
+// documents whose embedding failed are left out and reported in a
+// *BatchEmbeddingError alongside the prepared data
+func (db *DB) prepareBatchData(collectionName string, docs []*Document, dedup bool) (*batchData, error) {
 	// Get collection to validate dimension
 	collection, err := db.GetCollection(collectionName)
 	if err != nil {
 		return nil, fmt.Errorf("failed to get collection: %w", err)
 	}
 
+	for _, doc := range docs {
+		if err := db.beforeUpsert(collectionName, doc); err != nil {
+			return nil, err
+		}
+	}
+
+	// Automatic embedding generation for batch docs
+	failed, err := db.embedDocuments(docs)
+	if err != nil {
+		return nil, err
+	}
+
 	// Prepare batch data
-	docKeys := make([][]byte, len(docs))
-	docValues := make([][]byte, len(docs))
-	ids := make([]string, len(docs))
-	vectors := make([][]float32, len(docs))
+	docKeys := make([][]byte, 0, len(docs))
+	docValues := make([][]byte, 0, len(docs))
+	ids := make([]string, 0, len(docs))
+	vectors := make([][]float32, 0, len(docs))
+	var failures []EmbeddingFailure
+	var keywordChanges []keywordChange
+	var duplicates []DedupMatch
+	// documents merged into by this batch, a later merge adds to the earlier
+	merged := make(map[string]*Document)
 
 	// Validate and prepare data
 	for i, doc := range docs {
-		// Automatic embedding generation for batch docs
-		if doc.Parameters != nil {
-			if flag, ok := doc.Parameters["embedding"].(bool); ok && flag && len(doc.Vector) == 0 {
-				text, okText := doc.Parameters["text"].(string)
-				if !okText {
-					return nil, fmt.Errorf("text parameter is required for embedding when vector is not provided for document %s", doc.ID)
-				}
-				vec64, err := db.conf.EmbeddingProvider.Embed(text)
-				if err != nil {
-					return nil, fmt.Errorf("failed to generate embedding for document %s: %w", doc.ID, err)
-				}
-				doc.Vector = float64SliceTo32(vec64)
-				doc.Dimension = len(doc.Vector)
-			}
+		if err, ok := failed[i]; ok {
+			failures = append(failures, EmbeddingFailure{ID: doc.ID, Err: err})
+			continue
 		}
 
 		// Validate vector dimension
@@ -283,67 +571,139 @@ func (db *DB) prepareBatchData(collectionName string, docs []*Document) (*batchD
 				doc.ID, collection.Dimension, len(doc.Vector))
 		}
 		doc.Dimension = collection.Dimension
+		if err := validateDocument(collection, doc); err != nil {
+			return nil, err
+		}
+		if collection.Normalize {
+			doc.Vector = normalizeVector(doc.Vector)
+		}
+		if dedup && collection.DedupThreshold > 0 {
+			match, err := db.findDuplicate(collection, doc)
+			if err != nil {
+				return nil, err
+			}
+			if match != nil && collection.DedupMode != DedupMerge {
+				duplicates = append(duplicates, *match)
+				continue
+			}
+			if match != nil {
+				if doc, err = db.mergeDuplicate(collectionName, match, doc, merged[match.MatchedID]); err != nil {
+					return nil, err
+				}
+				merged[doc.ID] = doc
+				duplicates = append(duplicates, *match)
+			}
+		}
 
 		// Prepare document key and value (only metadata, without vector)
-		docKey := fmt.Sprintf("doc:%s:%s", collectionName, doc.ID)
+		docKey := documentKey(collectionName, doc.ID)
 		metadata := docToMetadata(doc)
 		docData, err := json.Marshal(metadata)
 		if err != nil {
 			return nil, fmt.Errorf("failed to marshal document metadata %s: %w", doc.ID, err)
 		}
 
-		docKeys[i] = []byte(docKey)
-		docValues[i] = docData
-		ids[i] = doc.ID
-		vectors[i] = doc.Vector
+		docKeys = append(docKeys, docKey)
+		docValues = append(docValues, docData)
+		if collection.StoreVectors {
+			vectorData, err := encodeVector(doc.Vector)
+			if err != nil {
+				return nil, fmt.Errorf("failed to encode vector %s: %w", doc.ID, err)
+			}
+			docKeys = append(docKeys, vectorKey(collectionName, doc.ID))
+			docValues = append(docValues, vectorData)
+		}
+		ids = append(ids, doc.ID)
+		vectors = append(vectors, doc.Vector)
+		keywordChanges = append(keywordChanges, keywordChange{doc.ID, doc.Parameters})
 	}
 
-	return &batchData{
+	data := &batchData{
 		docKeys:   docKeys,
 		docValues: docValues,
 		ids:       ids,
 		vectors:   vectors,
-	}, nil
+
+		duplicates: duplicates,
+	}
+	if fields := keywordFields(collection); len(fields) > 0 {
+		data.keywordFields, data.keywordChanges = fields, keywordChanges
+	}
+	if len(failures) > 0 {
+		return data, &BatchEmbeddingError{Failures: failures, Succeeded: len(ids)}
+	}
+	return data, nil
 }
 
+// BuildIndex stores documents and builds the index from them in one pass, on
+// partial embedding failure the other documents are still indexed. Documents
+// aren't deduplicated
 func (db *DB) BuildIndex(collectionName string, docs []*Document) error {
 	// Prepare batch data
-	batchData, err := db.prepareBatchData(collectionName, docs)
-	if err != nil {
+	batchData, err := db.prepareBatchData(collectionName, docs, false)
+	var embedErr *BatchEmbeddingError
+	if err != nil && !stderrors.As(err, &embedErr) {
 		return err
 	}
-
-	// Batch store document metadata (without vectors)
-	if err := db.Storage.BatchPutScalar(batchData.docKeys, batchData.docValues); err != nil {
-		return fmt.Errorf("failed to batch store document metadata: %w", err)
+	if embedErr != nil && len(batchData.ids) == 0 {
+		return err
 	}
 
-	// Build vector index
-	if err := db.IndexManager.BuildIndex(collectionName, batchData.ids, batchData.vectors); err != nil {
-		return fmt.Errorf("failed to build vector index: %w", err)
+	// Store documents and build the vector index as one transaction
+	if err := db.writeBatch(batchOpBuild, collectionName, batchData); err != nil {
+		return err
 	}
 
-	return nil
+	db.deleteArchived(collectionName, db.touch(collectionName, batchData.ids...))
+	return err
 }
 
+// BatchUpsertDocuments upserts documents in one batch, on partial embedding
+// failure the other documents are still written and a *BatchEmbeddingError
+// lists the skipped ones
 func (db *DB) BatchUpsertDocuments(collectionName string, docs []*Document) error {
+	_, err := db.BatchUpsertDocumentsDedup(collectionName, docs)
+	return err
+}
+
+// BatchUpsertDocumentsDedup is BatchUpsertDocuments reporting the documents
+// deduplicated against existing ones. Documents of the batch aren't
+// deduplicated against each other
+func (db *DB) BatchUpsertDocumentsDedup(collectionName string, docs []*Document) ([]DedupMatch, error) {
 	// Prepare batch data
-	batchData, err := db.prepareBatchData(collectionName, docs)
-	if err != nil {
-		return err
+	batchData, err := db.prepareBatchData(collectionName, docs, true)
+	var embedErr *BatchEmbeddingError
+	if err != nil && !stderrors.As(err, &embedErr) {
+		return nil, err
 	}
-
-	// Batch store document metadata (without vectors)
-	if err := db.Storage.BatchPutScalar(batchData.docKeys, batchData.docValues); err != nil {
-		return fmt.Errorf("failed to batch store document metadata: %w", err)
+	if len(batchData.ids) == 0 {
+		return batchData.duplicates, err
 	}
 
-	// Batch update vector index
-	if err := db.IndexManager.AddVectorBatch(collectionName, batchData.ids, batchData.vectors); err != nil {
-		return fmt.Errorf("failed to batch update vector index: %w", err)
+	// Store documents and update the vector index as one transaction
+	if err := db.writeBatch(batchOpUpsert, collectionName, batchData); err != nil {
+		return nil, err
 	}
 
-	return nil
+	db.deleteArchived(collectionName, db.touch(collectionName, batchData.ids...))
+	return batchData.duplicates, err
+}
+
+// EmbedText generates a vector for text using the configured embedding provider
+func (db *DB) EmbedText(text string) ([]float32, error) {
+	return db.embed(text)
+}
+
+// embed generates a vector for text using the configured embedding provider
+func (db *DB) embed(text string) ([]float32, error) {
+	if db.conf.EmbeddingProvider == nil {
+		return nil, errors.ErrEmbeddingNotConfigured
+	}
+	vec64, err := db.conf.EmbeddingProvider.Embed(text)
+	if err != nil {
+		return nil, err
+	}
+	return float64SliceTo32(vec64), nil
 }
 
 // float64SliceTo32 converts a slice of float64 to float32
@@ -0,0 +1,71 @@
+package db
+
+import (
+	"fmt"
+	"oasisdb/pkg/errors"
+	"oasisdb/pkg/logger"
+	"strings"
+)
+
+// EmbeddingFailure records a document whose vector could not be generated
+type EmbeddingFailure struct {
+	ID  string
+	Err error
+}
+
+// BatchEmbeddingError reports the documents skipped by a batch write because
+// their embedding failed, the remaining documents are still written
+type BatchEmbeddingError struct {
+	Failures  []EmbeddingFailure
+	Succeeded int // documents written despite the failures
+}
+
+func (e *BatchEmbeddingError) Error() string {
+	msgs := make([]string, len(e.Failures))
+	for i, f := range e.Failures {
+		msgs[i] = fmt.Sprintf("%s: %v", f.ID, f.Err)
+	}
+	return fmt.Sprintf("failed to generate embedding for %d documents: %s", len(e.Failures), strings.Join(msgs, "; "))
+}
+
+// embedDocuments fills in missing vectors of documents flagged for automatic
+// embedding, returning the positions of documents whose embedding failed
+func (db *DB) embedDocuments(docs []*Document) (map[int]error, error) {
+	var positions []int
+	var texts []string
+	for i, doc := range docs {
+		if doc.Parameters == nil || len(doc.Vector) != 0 {
+			continue
+		}
+		if flag, ok := doc.Parameters["embedding"].(bool); !ok || !flag {
+			continue
+		}
+		text, ok := doc.Parameters["text"].(string)
+		if !ok {
+			return nil, fmt.Errorf("text parameter is required for embedding when vector is not provided for document %s", doc.ID)
+		}
+		positions = append(positions, i)
+		texts = append(texts, text)
+	}
+	if len(texts) == 0 {
+		return nil, nil
+	}
+	if db.embedder == nil {
+		return nil, errors.ErrEmbeddingNotConfigured
+	}
+
+	vectors, errs := db.embedder.EmbedAll(texts)
+	failed := make(map[int]error)
+	for j, pos := range positions {
+		if errs[j] != nil {
+			failed[pos] = errs[j]
+			continue
+		}
+		docs[pos].Vector = float64SliceTo32(vectors[j])
+		docs[pos].Dimension = len(docs[pos].Vector)
+	}
+	if len(failed) > 0 {
+		logger.Error("Failed to generate embeddings", "failed", len(failed), "total", len(texts))
+	}
+	return failed, nil
+}
@@ -0,0 +1,119 @@
+package db
+
+import (
+	"context"
+	"reflect"
+
+	"oasisdb/internal/index"
+)
+
+// mergeFilters combines a collection's default filter with a request filter.
+// Keys from the default filter always win so that callers cannot widen the
+// visible rows by overriding them.
+func mergeFilters(defaultFilter, filter map[string]any) map[string]any {
+	if len(defaultFilter) == 0 {
+		return filter
+	}
+	merged := make(map[string]any, len(defaultFilter)+len(filter))
+	for k, v := range filter {
+		merged[k] = v
+	}
+	for k, v := range defaultFilter {
+		merged[k] = v
+	}
+	return merged
+}
+
+// scopeFilter merges the filters a read enforces over its request filter:
+// the collection's default filter and the scope filter of the caller, see
+// WithScopeFilter. It returns false if the two contradict each other, no
+// document matches then
+func scopeFilter(defaultFilter, scope, filter map[string]any) (map[string]any, bool) {
+	merged := mergeFilters(defaultFilter, mergeFilters(scope, filter))
+	return merged, matchFilter(merged, scope)
+}
+
+// searchFiltered runs the index search of a query for the k nearest results
+// whose document passes keep. A filtered search starts with twice the
+// candidates and doubles them until k pass or the index has no more, so that
+// matches far from the query are found too. keep is called once per result
+func (db *DB) searchFiltered(ctx context.Context, idx index.VectorIndex, collection *Collection, query []float32, k int, filter map[string]any, o searchOptions, keep func(id string) (bool, error)) (*index.SearchResult, error) {
+	if len(filter) == 0 {
+		return db.searchIndex(ctx, idx, collection, query, k, k, filter, o)
+	}
+	kept := make(map[string]bool)
+	for searchK := k * 2; ; searchK *= 2 {
+		result, err := db.searchIndex(ctx, idx, collection, query, k, searchK, filter, o)
+		if err != nil {
+			return nil, err
+		}
+		matched := &index.SearchResult{}
+		for i, id := range result.IDs {
+			if len(matched.IDs) == k {
+				break
+			}
+			ok, checked := kept[id]
+			if !checked {
+				if ok, err = keep(id); err != nil {
+					return nil, err
+				}
+				kept[id] = ok
+			}
+			if ok {
+				matched.IDs = append(matched.IDs, id)
+				matched.Distances = append(matched.Distances, result.Distances[i])
+			}
+		}
+		// fewer results than searched for means the index has no more
+		if len(matched.IDs) == k || o.unbounded || len(result.IDs) < searchK || searchK >= idx.Stats().Count {
+			return matched, nil
+		}
+	}
+}
+
+// matchFilter reports whether every key in filter equals the corresponding
+// document parameter. An empty filter matches every document.
+func matchFilter(params map[string]any, filter map[string]any) bool {
+	for key, want := range filter {
+		got, ok := params[key]
+		if !ok {
+			return false
+		}
+		if !equalFilterValue(got, want) {
+			return false
+		}
+	}
+	return true
+}
+
+// equalFilterValue compares two filter values, treating all numeric types as
+// equal when they hold the same value (JSON decoding yields float64). Values
+// of different types never match, e.g. 1 and "1"
+func equalFilterValue(a, b any) bool {
+	if fa, ok := toFloat64(a); ok {
+		fb, ok := toFloat64(b)
+		return ok && fa == fb
+	}
+	return reflect.DeepEqual(a, b)
+}
+
+func toFloat64(v any) (float64, bool) {
+	switch n := v.(type) {
+	case float64:
+		return n, true
+	case float32:
+		return float64(n), true
+	case int:
+		return float64(n), true
+	case int32:
+		return float64(n), true
+	case int64:
+		return float64(n), true
+	case uint32:
+		return float64(n), true
+	case uint64:
+		return float64(n), true
+	default:
+		return 0, false
+	}
+}
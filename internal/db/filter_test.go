@@ -0,0 +1,180 @@
+package db
+
+import (
+	"context"
+	"fmt"
+	"testing"
+
+	pkgerrors "oasisdb/pkg/errors"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestMatchFilter(t *testing.T) {
+	params := map[string]any{"tenant_id": "a", "year": float64(2024)}
+
+	assert.True(t, matchFilter(params, nil))
+	assert.True(t, matchFilter(params, map[string]any{"tenant_id": "a"}))
+	assert.True(t, matchFilter(params, map[string]any{"year": 2024}))
+	assert.False(t, matchFilter(params, map[string]any{"tenant_id": "b"}))
+	assert.False(t, matchFilter(params, map[string]any{"missing": "a"}))
+	assert.False(t, matchFilter(nil, map[string]any{"tenant_id": "a"}))
+	assert.False(t, matchFilter(params, map[string]any{"year": "2024"}))
+	assert.False(t, matchFilter(map[string]any{"tenant_id": "1"}, map[string]any{"tenant_id": 1}))
+
+	merged := mergeFilters(map[string]any{"tenant_id": "a"}, map[string]any{"tenant_id": "b", "year": 2024})
+	assert.Equal(t, map[string]any{"tenant_id": "a", "year": 2024}, merged)
+}
+
+func TestCollectionDefaultFilter(t *testing.T) {
+	db := newTestDBWithProvider(t, stubEmbeddingProvider{})
+
+	_, err := db.CreateCollection(&CreateCollectionOptions{
+		Name:          "tenant_docs",
+		Dimension:     2,
+		IndexType:     "hnsw",
+		Parameters:    map[string]string{},
+		DefaultFilter: map[string]any{"tenant_id": "a"},
+	})
+	require.NoError(t, err)
+
+	require.NoError(t, db.BatchUpsertDocuments("tenant_docs", []*Document{
+		{ID: "1", Vector: []float32{1, 0}, Parameters: map[string]any{"tenant_id": "b"}},
+		{ID: "2", Vector: []float32{0.9, 0.1}, Parameters: map[string]any{"tenant_id": "a"}},
+		{ID: "3", Vector: []float32{0, 1}, Parameters: map[string]any{"tenant_id": "a"}},
+	}))
+
+	collection, err := db.GetCollection("tenant_docs")
+	require.NoError(t, err)
+	assert.Equal(t, map[string]any{"tenant_id": "a"}, collection.DefaultFilter)
+
+	// documents outside the default filter are invisible to get
+	_, err = db.GetDocument("tenant_docs", "1")
+	assert.ErrorIs(t, err, pkgerrors.ErrDocumentNotFound)
+	doc, err := db.GetDocument("tenant_docs", "2")
+	require.NoError(t, err)
+	assert.Equal(t, "2", doc.ID)
+
+	ids, distances, err := db.SearchVectors(context.Background(), "tenant_docs", []float32{1, 0}, 1)
+	require.NoError(t, err)
+	assert.Equal(t, []string{"2"}, ids)
+	assert.Len(t, distances, 1)
+
+	// a request filter cannot override the default filter
+	docs, _, err := db.SearchDocuments(context.Background(), "tenant_docs", &Document{Vector: []float32{1, 0}}, 3,
+		map[string]any{"tenant_id": "b"})
+	require.NoError(t, err)
+	require.Len(t, docs, 2)
+	for _, d := range docs {
+		assert.Equal(t, "a", d.Parameters["tenant_id"])
+	}
+}
+
+func TestDefaultFilterFindsFarMatches(t *testing.T) {
+	db := newTestDBWithProvider(t, stubEmbeddingProvider{})
+
+	_, err := db.CreateCollection(&CreateCollectionOptions{
+		Name:          "tenant_docs",
+		Dimension:     2,
+		IndexType:     "hnsw",
+		Parameters:    map[string]string{},
+		DefaultFilter: map[string]any{"tenant_id": "a"},
+	})
+	require.NoError(t, err)
+
+	// tenant a owns the document farthest from the query
+	docs := []*Document{{ID: "a", Vector: []float32{-10, 0}, Parameters: map[string]any{"tenant_id": "a"}}}
+	for i := range 9 {
+		docs = append(docs, &Document{ID: fmt.Sprintf("b%d", i), Vector: []float32{1, float32(i) / 10},
+			Parameters: map[string]any{"tenant_id": "b"}})
+	}
+	require.NoError(t, db.BatchUpsertDocuments("tenant_docs", docs))
+
+	ids, _, err := db.SearchVectors(context.Background(), "tenant_docs", []float32{1, 0}, 1)
+	require.NoError(t, err)
+	assert.Equal(t, []string{"a"}, ids)
+
+	found, _, err := db.SearchDocuments(context.Background(), "tenant_docs", &Document{Vector: []float32{1, 0}}, 1, nil)
+	require.NoError(t, err)
+	require.Len(t, found, 1)
+	assert.Equal(t, "a", found[0].ID)
+}
+
+func TestDefaultFilterHidesClusterMembers(t *testing.T) {
+	db := newTestDBWithProvider(t, stubEmbeddingProvider{})
+
+	_, err := db.CreateCollection(&CreateCollectionOptions{
+		Name:          "tenant_docs",
+		Dimension:     2,
+		IndexType:     "hnsw",
+		Parameters:    map[string]string{},
+		DefaultFilter: map[string]any{"tenant_id": "a"},
+	})
+	require.NoError(t, err)
+	require.NoError(t, db.BatchUpsertDocuments("tenant_docs", []*Document{
+		{ID: "1", Vector: []float32{1, 0}, Parameters: map[string]any{"tenant_id": "b"}},
+		{ID: "2", Vector: []float32{0.9, 0.1}, Parameters: map[string]any{"tenant_id": "a"}},
+		{ID: "3", Vector: []float32{0, 1}, Parameters: map[string]any{"tenant_id": "a"}},
+	}))
+
+	clusters, err := db.ListClusters("tenant_docs", 10, nil)
+	require.NoError(t, err)
+	require.NotEmpty(t, clusters)
+	for _, cluster := range clusters {
+		// the count matches the members that can be sampled
+		assert.Equal(t, len(cluster.SampleIDs), cluster.Count)
+		assert.NotContains(t, cluster.SampleIDs, "1")
+	}
+
+	clusters, err = db.ListClusters("tenant_docs", 0, nil)
+	require.NoError(t, err)
+	for _, cluster := range clusters {
+		assert.Empty(t, cluster.SampleIDs)
+		assert.LessOrEqual(t, cluster.Count, 2)
+	}
+}
+
+func TestScopeFilter(t *testing.T) {
+	db := newTestDBWithProvider(t, stubEmbeddingProvider{})
+
+	_, err := db.CreateCollection(&CreateCollectionOptions{
+		Name:       "docs",
+		Dimension:  2,
+		IndexType:  "hnsw",
+		Parameters: map[string]string{},
+	})
+	require.NoError(t, err)
+	require.NoError(t, db.BatchUpsertDocuments("docs", []*Document{
+		{ID: "1", Vector: []float32{1, 0}, Parameters: map[string]any{"tenant_id": "b"}},
+		{ID: "2", Vector: []float32{0, 1}, Parameters: map[string]any{"tenant_id": "a"}},
+	}))
+	scope := map[string]any{"tenant_id": "a"}
+
+	_, err = db.GetScopedDocument("docs", "1", scope)
+	assert.ErrorIs(t, err, pkgerrors.ErrDocumentNotFound)
+	doc, err := db.GetScopedDocument("docs", "2", scope)
+	require.NoError(t, err)
+	assert.Equal(t, "2", doc.ID)
+
+	ids, _, err := db.SearchVectors(context.Background(), "docs", []float32{1, 0}, 2, WithScopeFilter(scope))
+	require.NoError(t, err)
+	assert.Equal(t, []string{"2"}, ids)
+
+	// a request filter cannot widen the scope
+	docs, _, err := db.SearchDocuments(context.Background(), "docs", &Document{Vector: []float32{1, 0}}, 2,
+		map[string]any{"tenant_id": "b"}, WithScopeFilter(scope))
+	require.NoError(t, err)
+	require.Len(t, docs, 1)
+	assert.Equal(t, "2", docs[0].ID)
+
+	page, err := db.ScrollDocuments("docs", ScrollOptions{Scope: scope})
+	require.NoError(t, err)
+	require.Len(t, page.Documents, 1)
+	assert.Equal(t, "2", page.Documents[0].ID)
+
+	// a scope contradicting the default filter of the collection matches nothing
+	merged, ok := scopeFilter(map[string]any{"tenant_id": "b"}, scope, nil)
+	assert.False(t, ok)
+	assert.Equal(t, map[string]any{"tenant_id": "b"}, merged)
+}
@@ -0,0 +1,83 @@
+package db
+
+import (
+	stderrors "errors"
+	"fmt"
+	"time"
+)
+
+// embeddingCheckTimeout bounds the embedding call of a readiness check, the
+// provider calls can't be canceled so a slow one finishes in the background
+const embeddingCheckTimeout = 5 * time.Second
+
+// HealthCheck is the result of one readiness check, Err is nil if it passed
+type HealthCheck struct {
+	Name string
+	Err  error
+}
+
+// CheckReadiness checks that the database can serve requests: the scalar
+// storage answers reads and compacts, and the index manager is loaded.
+// The embedding provider is only called if embedding is set, as every check
+// costs a provider call
+func (db *DB) CheckReadiness(embedding bool) []HealthCheck {
+	checks := []HealthCheck{
+		{Name: "storage", Err: db.checkStorage()},
+		{Name: "compaction", Err: db.checkCompaction()},
+		{Name: "index_manager", Err: db.checkIndexManager()},
+	}
+	if embedding {
+		checks = append(checks, HealthCheck{Name: "embedding", Err: db.checkEmbedding()})
+	}
+	return checks
+}
+
+func (db *DB) checkStorage() error {
+	if db.Storage == nil {
+		return stderrors.New("storage is not open")
+	}
+	if _, _, err := db.Storage.GetScalar([]byte("__readiness")); err != nil {
+		return fmt.Errorf("storage read failed: %w", err)
+	}
+	return nil
+}
+
+func (db *DB) checkCompaction() error {
+	if db.Storage == nil {
+		return stderrors.New("storage is not open")
+	}
+	if !db.Storage.CompactionStatus().Alive {
+		return stderrors.New("compaction goroutine is not running")
+	}
+	return nil
+}
+
+func (db *DB) checkIndexManager() error {
+	if db.IndexManager == nil {
+		return stderrors.New("index manager is not loaded")
+	}
+	if !db.IndexManager.Running() {
+		return stderrors.New("index manager is closed")
+	}
+	return nil
+}
+
+func (db *DB) checkEmbedding() error {
+	if db.conf.EmbeddingProvider == nil {
+		return stderrors.New("embedding provider is not configured")
+	}
+	errCh := make(chan error, 1)
+	go func() {
+		_, err := db.conf.EmbeddingProvider.Embed("readiness check")
+		errCh <- err
+	}()
+	select {
+	case err := <-errCh:
+		if err != nil {
+			return fmt.Errorf("embedding provider unreachable: %w", err)
+		}
+		return nil
+	case <-time.After(embeddingCheckTimeout):
+		return fmt.Errorf("embedding provider did not answer within %s", embeddingCheckTimeout)
+	}
+}
@@ -0,0 +1,58 @@
+package db
+
+import (
+	"fmt"
+	"maps"
+	"oasisdb/internal/chunk"
+	"oasisdb/pkg/errors"
+	"strconv"
+)
+
+// IngestOptions describes a long text to be chunked, embedded and upserted
+type IngestOptions struct {
+	ID         string         // parent document ID, recorded on every chunk
+	Text       string         // text to split into chunks
+	Parameters map[string]any // copied to every chunk
+	Chunking   chunk.Options
+	// StartID numbers chunks StartID, StartID+1, ..., nil names them
+	// "<ID>#<n>"
+	StartID *int
+}
+
+// IngestDocument splits a long text into chunk documents carrying their
+// parent's metadata and batch-upserts them with automatic embedding, the
+// returned IDs include chunks skipped by a *BatchEmbeddingError
+func (db *DB) IngestDocument(collectionName string, opts IngestOptions) ([]string, error) {
+	if opts.ID == "" {
+		return nil, fmt.Errorf("%w: parent document id is required", errors.ErrInvalidParameter)
+	}
+	chunks, err := chunk.Split(opts.Text, opts.Chunking)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", errors.ErrInvalidParameter, err)
+	}
+	if len(chunks) == 0 {
+		return nil, fmt.Errorf("%w: text is empty", errors.ErrEmptyParameter)
+	}
+
+	ids := make([]string, len(chunks))
+	docs := make([]*Document, len(chunks))
+	for i, text := range chunks {
+		ids[i] = fmt.Sprintf("%s#%d", opts.ID, i)
+		if opts.StartID != nil {
+			ids[i] = strconv.Itoa(*opts.StartID + i)
+		}
+
+		parameters := maps.Clone(opts.Parameters)
+		if parameters == nil {
+			parameters = make(map[string]any)
+		}
+		parameters["text"] = text
+		parameters["embedding"] = true
+		parameters["parent_id"] = opts.ID
+		parameters["chunk_index"] = i
+		parameters["chunk_count"] = len(chunks)
+		docs[i] = &Document{ID: ids[i], Parameters: parameters}
+	}
+
+	return ids, db.BatchUpsertDocuments(collectionName, docs)
+}
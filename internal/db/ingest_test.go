@@ -0,0 +1,46 @@
+package db
+
+import (
+	"testing"
+
+	"oasisdb/internal/chunk"
+	pkgerrors "oasisdb/pkg/errors"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestIngestDocument(t *testing.T) {
+	db := newTestDBWithProvider(t, stubEmbeddingProvider{
+		embedFn: func(text string) ([]float64, error) {
+			return []float64{float64(len(text)), 1}, nil
+		},
+	})
+	createTestCollection(t, db, "docs", 2)
+
+	start := 100
+	ids, err := db.IngestDocument("docs", IngestOptions{
+		ID:         "guide",
+		Text:       "First sentence here. Second sentence here. Third sentence here.",
+		Parameters: map[string]any{"source": "manual"},
+		Chunking:   chunk.Options{Size: 25},
+		StartID:    &start,
+	})
+	require.NoError(t, err)
+	assert.Equal(t, []string{"100", "101", "102"}, ids)
+
+	doc, err := db.GetDocument("docs", "101")
+	require.NoError(t, err)
+	assert.Equal(t, "Second sentence here.", doc.Parameters["text"])
+	assert.Equal(t, "guide", doc.Parameters["parent_id"])
+	assert.Equal(t, "manual", doc.Parameters["source"])
+	assert.EqualValues(t, 1, doc.Parameters["chunk_index"])
+	assert.EqualValues(t, 3, doc.Parameters["chunk_count"])
+	assert.Equal(t, 2, doc.Dimension)
+
+	_, err = db.IngestDocument("docs", IngestOptions{ID: "empty", Text: " "})
+	assert.ErrorIs(t, err, pkgerrors.ErrEmptyParameter)
+
+	_, err = db.IngestDocument("docs", IngestOptions{ID: "bad", Text: "text", Chunking: chunk.Options{Size: 5, Overlap: 5}})
+	assert.ErrorIs(t, err, pkgerrors.ErrInvalidParameter)
+}
@@ -0,0 +1,94 @@
+package db
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+
+	"oasisdb/pkg/errors"
+)
+
+// collectionNamePattern is the shape of a collection name, a tenant's
+// collections are stored as "tenant:name" with both parts of this shape
+var collectionNamePattern = regexp.MustCompile(`^[A-Za-z0-9_-]{1,64}(:[A-Za-z0-9_-]{1,64})?$`)
+
+// reservedNamePrefix starts the names kept for the database itself, e.g.
+// the __readiness key
+const reservedNamePrefix = "__"
+
+// ValidateCollectionName checks the name of a collection to create, names
+// of existing collections aren't checked so collections created before the
+// rules stay usable
+func ValidateCollectionName(name string) error {
+	if !collectionNamePattern.MatchString(name) {
+		return fmt.Errorf("%w: collection name must be 1 to 64 letters, digits, '_' or '-', got %q",
+			errors.ErrInvalidParameter, name)
+	}
+	for _, part := range strings.Split(name, ":") {
+		if strings.HasPrefix(part, reservedNamePrefix) {
+			return fmt.Errorf("%w: collection names starting with %q are reserved, got %q",
+				errors.ErrInvalidParameter, reservedNamePrefix, name)
+		}
+	}
+	return nil
+}
+
+// keyEscaper escapes the separator of the parts of a storage key, and the
+// escape character so escaped parts stay distinct
+var keyEscaper = strings.NewReplacer("%", "%25", ":", "%3A")
+
+// escapeKey escapes a part of a storage key followed by other parts, e.g.
+// the tenant collection "acme:docs" would otherwise own the documents of
+// the collection "acme" whose IDs start with "docs:"
+func escapeKey(part string) string {
+	return keyEscaper.Replace(part)
+}
+
+// keyPrefix is the start of the keys of kind, e.g. "doc", of a collection
+func keyPrefix(kind, collectionName string) string {
+	return kind + ":" + escapeKey(collectionName) + ":"
+}
+
+// keyScanner is the scalar storage or a snapshot of it
+type keyScanner interface {
+	ScanScalar(start, end []byte, fn func(key, value []byte) bool) error
+}
+
+// scanKeys calls fn with the rest of every key of scanner starting with
+// prefix, from the first one sorting after prefix+after, and its value in key
+// order until fn returns false
+func scanKeys(scanner keyScanner, prefix, after string, fn func(suffix string, value []byte) bool) error {
+	start := prefix
+	if after != "" {
+		start = prefix + after + "\x00"
+	}
+	// prefixes end with the separator, the keys after them start with ';'
+	end := prefix[:len(prefix)-1] + string(prefix[len(prefix)-1]+1)
+	return scanner.ScanScalar([]byte(start), []byte(end), func(key, value []byte) bool {
+		return fn(string(key[len(prefix):]), value)
+	})
+}
+
+// documentIDs returns the IDs of all documents of a collection in order,
+// archived documents included
+func (db *DB) documentIDs(collectionName string) ([]string, error) {
+	return scanDocumentIDs(db.Storage, collectionName)
+}
+
+// scanDocumentIDs lists the IDs of the document keys of a collection
+func scanDocumentIDs(scanner keyScanner, collectionName string) ([]string, error) {
+	var ids []string
+	err := scanKeys(scanner, keyPrefix("doc", collectionName), "", func(id string, _ []byte) bool {
+		ids = append(ids, id)
+		return true
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to scan document IDs: %w", err)
+	}
+	return ids, nil
+}
+
+// documentKey stores the metadata of a document
+func documentKey(collectionName, id string) []byte {
+	return []byte(keyPrefix("doc", collectionName) + id)
+}
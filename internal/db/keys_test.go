@@ -0,0 +1,133 @@
+package db
+
+import (
+	"testing"
+
+	"oasisdb/internal/config"
+	"oasisdb/pkg/errors"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestValidateCollectionName(t *testing.T) {
+	for _, name := range []string{"docs", "my-docs_2", "acme:docs"} {
+		assert.NoError(t, ValidateCollectionName(name), name)
+	}
+	for _, name := range []string{"", "a/b", "a:b:c", ":docs", "docs:", "with space", "__system", "acme:__docs",
+		"a123456789012345678901234567890123456789012345678901234567890123456789"} {
+		assert.ErrorIs(t, ValidateCollectionName(name), errors.ErrInvalidParameter, name)
+	}
+
+	db := newTestDBWithProvider(t, stubEmbeddingProvider{})
+	_, err := db.CreateCollection(&CreateCollectionOptions{Name: "../docs", Dimension: 2})
+	assert.ErrorIs(t, err, errors.ErrInvalidParameter)
+}
+
+func TestTenantKeysDontCollide(t *testing.T) {
+	db := newTestDBWithProvider(t, stubEmbeddingProvider{})
+	createTestCollection(t, db, "acme", 2)
+	createTestCollection(t, db, "acme:docs", 2)
+
+	// the same key before collection names were escaped
+	require.NoError(t, db.UpsertDocument("acme", &Document{ID: "docs:1", Vector: []float32{1, 0}, Dimension: 2, Parameters: map[string]any{"owner": "acme"}}))
+	require.NoError(t, db.UpsertDocument("acme:docs", &Document{ID: "1", Vector: []float32{0, 1}, Dimension: 2, Parameters: map[string]any{"owner": "tenant"}}))
+
+	doc, err := db.GetDocument("acme", "docs:1")
+	require.NoError(t, err)
+	assert.Equal(t, "acme", doc.Parameters["owner"])
+	doc, err = db.GetDocument("acme:docs", "1")
+	require.NoError(t, err)
+	assert.Equal(t, "tenant", doc.Parameters["owner"])
+}
+
+func TestMigrateKeys(t *testing.T) {
+	conf, err := config.NewConfig(t.TempDir())
+	require.NoError(t, err)
+	db, err := New(conf)
+	require.NoError(t, err)
+	require.NoError(t, db.Open())
+
+	_, err = db.CreateCollection(&CreateCollectionOptions{
+		Name:         "acme:docs",
+		Dimension:    2,
+		StoreVectors: true,
+		Schema:       &Schema{Fields: []SchemaField{{Name: "genre", Type: FieldKeyword}}},
+	})
+	require.NoError(t, err)
+	require.NoError(t, db.UpsertDocument("acme:docs", &Document{ID: "1", Vector: []float32{1, 0}, Dimension: 2, Parameters: map[string]any{"genre": "drama"}}))
+	require.NoError(t, db.flushAccess())
+
+	// the keys as written before collection names were escaped
+	legacy := map[string][]byte{
+		"doc:acme:docs:1":           documentKey("acme:docs", "1"),
+		"vec:acme:docs:1":           vectorKey("acme:docs", "1"),
+		"idx:acme:docs:genre:drama": []byte(keywordIndexKey("acme:docs", "genre", "drama")),
+	}
+	for old, key := range legacy {
+		value, _, err := db.Storage.GetScalar(key)
+		require.NoError(t, err)
+		require.NotEmpty(t, value, old)
+		require.NoError(t, db.Storage.PutScalar([]byte(old), value))
+		require.NoError(t, db.Storage.DeleteScalar(key))
+	}
+	require.NoError(t, db.Storage.DeleteScalar(keyFormatKey))
+	db.Close()
+
+	db, err = New(conf)
+	require.NoError(t, err)
+	require.NoError(t, db.Open())
+	t.Cleanup(db.Close)
+
+	for old, key := range legacy {
+		value, _, err := db.Storage.GetScalar([]byte(old))
+		require.NoError(t, err)
+		assert.Empty(t, value, old)
+		value, _, err = db.Storage.GetScalar(key)
+		require.NoError(t, err)
+		assert.NotEmpty(t, value, string(key))
+	}
+	doc, err := db.GetDocument("acme:docs", "1")
+	require.NoError(t, err)
+	assert.Equal(t, "drama", doc.Parameters["genre"])
+	assert.Equal(t, []string{"1"}, keywordSet(t, db, "acme:docs", "genre", "drama"))
+	format, _, err := db.Storage.GetScalar(keyFormatKey)
+	require.NoError(t, err)
+	assert.Equal(t, keyFormatEscaped, string(format))
+}
+
+func TestDocumentsListedByTheirKeys(t *testing.T) {
+	db := newTestDBWithProvider(t, stubEmbeddingProvider{})
+	createTestCollection(t, db, "acme", 2)
+	createTestCollection(t, db, "acme:docs", 2)
+	require.NoError(t, db.BatchUpsertDocuments("acme", []*Document{
+		{ID: "docs:1", Vector: []float32{1, 0}, Dimension: 2},
+		{ID: "2", Vector: []float32{0, 1}, Dimension: 2},
+		{ID: "3", Vector: []float32{1, 1}, Dimension: 2},
+	}))
+	require.NoError(t, db.UpsertDocument("acme:docs", &Document{ID: "1", Vector: []float32{0, 1}, Dimension: 2}))
+
+	// the access records don't list documents, even lost ones don't matter
+	db.access = newAccessTracker()
+	require.NoError(t, db.Storage.DeleteScalar(accessKey("acme")))
+
+	ids, err := db.documentIDs("acme")
+	require.NoError(t, err)
+	assert.Equal(t, []string{"2", "3", "docs:1"}, ids)
+
+	snapshot, err := db.SnapshotCollection("acme")
+	require.NoError(t, err)
+	defer snapshot.Release()
+	require.NoError(t, db.DeleteDocument("acme", "2"))
+	assert.Equal(t, []string{"2", "3", "docs:1"}, snapshot.IDs(), "the snapshot lists documents deleted since")
+
+	page, err := db.ScrollDocuments("acme", ScrollOptions{Size: 1})
+	require.NoError(t, err)
+	require.Len(t, page.Documents, 1)
+	assert.Equal(t, "3", page.Documents[0].ID)
+	page, err = db.ScrollDocuments("acme", ScrollOptions{Size: 1, Cursor: page.Cursor})
+	require.NoError(t, err)
+	require.Len(t, page.Documents, 1)
+	assert.Equal(t, "docs:1", page.Documents[0].ID)
+	assert.Empty(t, page.Cursor)
+}
@@ -0,0 +1,327 @@
+package db
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"sort"
+	"sync"
+
+	"oasisdb/internal/index"
+	"oasisdb/internal/tracing"
+
+	"go.opentelemetry.io/otel/attribute"
+)
+
+// prefilterLimit is the largest keyword candidate set a filtered search ranks
+// exactly, larger sets only restrict the results of the ANN search
+const prefilterLimit = 1000
+
+// keywordIndexKey holds the sorted IDs of a collection's documents whose
+// keyword field has value
+func keywordIndexKey(collectionName, field, value string) string {
+	return keyPrefix("idx", collectionName) + escapeKey(field) + ":" + value
+}
+
+// keywordChange moves a document to the keyword values of params, nil params
+// remove it from the index
+type keywordChange struct {
+	id     string
+	params map[string]any
+}
+
+// keywordFields returns the fields of a collection with a keyword index,
+// those declared as keywords in its schema
+func keywordFields(collection *Collection) []string {
+	schema, err := collection.ParameterSchema()
+	if err != nil || schema == nil {
+		return nil
+	}
+	return schema.IndexedFields()
+}
+
+func keywordValue(params map[string]any, field string) (string, bool) {
+	value, ok := params[field].(string)
+	return value, ok
+}
+
+// lockKeywords serializes the keyword index updates of a collection, the id
+// sets are read, modified and written back
+func (db *DB) lockKeywords(collectionName string) (unlock func()) {
+	mu, _ := db.keywordLocks.LoadOrStore(collectionName, &sync.Mutex{})
+	mu.(*sync.Mutex).Lock()
+	return mu.(*sync.Mutex).Unlock
+}
+
+func (db *DB) loadKeywordSet(key string) (map[string]struct{}, error) {
+	data, exists, err := db.Storage.GetScalar([]byte(key))
+	if err != nil {
+		return nil, err
+	}
+	set := make(map[string]struct{})
+	if !exists || len(data) == 0 {
+		return set, nil
+	}
+	var ids []string
+	if err := json.Unmarshal(data, &ids); err != nil {
+		return nil, fmt.Errorf("failed to decode keyword index %s: %w", key, err)
+	}
+	for _, id := range ids {
+		set[id] = struct{}{}
+	}
+	return set, nil
+}
+
+// storedParameters returns the parameters a document was last written with,
+// nil if it doesn't exist
+func (db *DB) storedParameters(collectionName, id string) (map[string]any, error) {
+	data, exists, err := db.Storage.GetScalar(documentKey(collectionName, id))
+	if err != nil || !exists || len(data) == 0 {
+		return nil, err
+	}
+	var metadata DocumentMetadata
+	if err := json.Unmarshal(data, &metadata); err != nil {
+		return nil, err
+	}
+	return metadata.Parameters, nil
+}
+
+// keywordIndexWrites computes the id set writes applying changes to the
+// keyword index, emptied sets are written as deletes. The caller must hold
+// the collection's keyword lock until the writes are stored.
+func (db *DB) keywordIndexWrites(collectionName string, fields []string, changes []keywordChange) (keys, values [][]byte, err error) {
+	sets := make(map[string]map[string]struct{})
+	load := func(key string) (map[string]struct{}, error) {
+		if set, ok := sets[key]; ok {
+			return set, nil
+		}
+		set, err := db.loadKeywordSet(key)
+		if err != nil {
+			return nil, err
+		}
+		sets[key] = set
+		return set, nil
+	}
+
+	// a document written twice moves from the values of its first change
+	current := make(map[string]map[string]any, len(changes))
+	for _, change := range changes {
+		old, seen := current[change.id]
+		if !seen {
+			if old, err = db.storedParameters(collectionName, change.id); err != nil {
+				return nil, nil, err
+			}
+		}
+		current[change.id] = change.params
+
+		for _, field := range fields {
+			oldValue, hadOld := keywordValue(old, field)
+			newValue, hasNew := keywordValue(change.params, field)
+			if hadOld == hasNew && oldValue == newValue {
+				continue
+			}
+			if hadOld {
+				set, err := load(keywordIndexKey(collectionName, field, oldValue))
+				if err != nil {
+					return nil, nil, err
+				}
+				delete(set, change.id)
+			}
+			if hasNew {
+				set, err := load(keywordIndexKey(collectionName, field, newValue))
+				if err != nil {
+					return nil, nil, err
+				}
+				set[change.id] = struct{}{}
+			}
+		}
+	}
+
+	setKeys := make([]string, 0, len(sets))
+	for key := range sets {
+		setKeys = append(setKeys, key)
+	}
+	sort.Strings(setKeys)
+	for _, key := range setKeys {
+		var value []byte
+		if set := sets[key]; len(set) > 0 {
+			ids := make([]string, 0, len(set))
+			for id := range set {
+				ids = append(ids, id)
+			}
+			sort.Strings(ids)
+			if value, err = json.Marshal(ids); err != nil {
+				return nil, nil, err
+			}
+		}
+		keys = append(keys, []byte(key))
+		values = append(values, value)
+	}
+	return keys, values, nil
+}
+
+// updateKeywordIndex applies changes to the keyword index of a collection
+func (db *DB) updateKeywordIndex(collectionName string, fields []string, changes ...keywordChange) error {
+	keys, values, err := db.keywordIndexWrites(collectionName, fields, changes)
+	if err != nil {
+		return err
+	}
+	return db.Storage.BatchPutScalar(keys, values)
+}
+
+// dropKeywordIndex removes the documents of a deleted collection from its
+// keyword index, which deletes every id set
+func (db *DB) dropKeywordIndex(collectionName string, fields []string, ids []string) error {
+	if len(fields) == 0 {
+		return nil
+	}
+	defer db.lockKeywords(collectionName)()
+	changes := make([]keywordChange, len(ids))
+	for i, id := range ids {
+		changes[i] = keywordChange{id: id}
+	}
+	return db.updateKeywordIndex(collectionName, fields, changes...)
+}
+
+// keywordCandidates returns the IDs of the documents matching the filter on
+// the collection's keyword fields, restricted is false if the filter covers
+// none of them
+func (db *DB) keywordCandidates(collection *Collection, filter map[string]any) (candidates map[string]struct{}, restricted bool, err error) {
+	for _, field := range keywordFields(collection) {
+		value, ok := keywordValue(filter, field)
+		if !ok {
+			continue
+		}
+		set, err := db.loadKeywordSet(keywordIndexKey(collection.Name, field, value))
+		if err != nil {
+			return nil, false, err
+		}
+		if !restricted {
+			candidates, restricted = set, true
+			continue
+		}
+		for id := range candidates {
+			if _, ok := set[id]; !ok {
+				delete(candidates, id)
+			}
+		}
+	}
+	return candidates, restricted, nil
+}
+
+// searchIndex runs the index search of a query, when the filter covers a
+// keyword field only the documents of the keyword index are considered:
+// small candidate sets are ranked exactly, larger ones drop all other IDs
+// from the ANN results. Range searches drop results outside the radius and
+// without a limit search until they reach it. Search parameters only tune the
+// ANN search, exactly ranked candidates don't need them.
+func (db *DB) searchIndex(ctx context.Context, idx index.VectorIndex, collection *Collection, query []float32, k, searchK int, filter map[string]any, o searchOptions) (*index.SearchResult, error) {
+	candidates, restricted, err := db.keywordCandidates(collection, filter)
+	if err != nil {
+		return nil, err
+	}
+
+	_, span := db.startIndexSearchSpan(ctx, collection, k, searchK)
+	span.SetAttributes(attribute.Bool("prefiltered", restricted))
+	if restricted {
+		span.SetAttributes(attribute.Int("candidates", len(candidates)))
+	}
+	if restricted && len(candidates) <= prefilterLimit {
+		result, err := db.rankCandidates(idx, collection, query, candidates)
+		tracing.End(span, err)
+		if err != nil {
+			return nil, err
+		}
+		sortTies(result)
+		return withinDistance(result, o.maxDistance), nil
+	}
+
+	var result *index.SearchResult
+	if o.unbounded {
+		result, err = rangeSearch(idx, query, *o.maxDistance, o.params)
+	} else if o.exactRerank {
+		result, err = searchWithTies(idx, query, searchK*exactRerankFactor, o.params)
+	} else {
+		result, err = searchWithTies(idx, query, searchK, o.params)
+	}
+	if err == nil && o.exactRerank {
+		result = db.rerankExact(idx, collection, query, result, searchK, o.unbounded)
+	}
+	tracing.End(span, err)
+	if err != nil {
+		return nil, err
+	}
+	if o.maxDistance == nil {
+		db.sampleRecall(collection.Name, query, k, result.IDs)
+	}
+	sortTies(result)
+	result = withinDistance(result, o.maxDistance)
+	if !restricted {
+		return result, nil
+	}
+
+	restrictedResult := &index.SearchResult{}
+	for i, id := range result.IDs {
+		if _, ok := candidates[id]; ok {
+			restrictedResult.IDs = append(restrictedResult.IDs, id)
+			restrictedResult.Distances = append(restrictedResult.Distances, result.Distances[i])
+		}
+	}
+	return restrictedResult, nil
+}
+
+// rerankExact orders the candidates of an index search by their exact
+// distance to the query and keeps the k nearest, all of them for a range
+// search. Candidates deleted since the search are dropped
+func (db *DB) rerankExact(idx index.VectorIndex, collection *Collection, query []float32, result *index.SearchResult, k int, unbounded bool) *index.SearchResult {
+	ids := make([]string, 0, len(result.IDs))
+	vectors := make([][]float32, 0, len(result.IDs))
+	for _, id := range result.IDs {
+		var vector []float32
+		var err error
+		if collection.StoreVectors {
+			vector, err = db.storedVector(collection.Name, id)
+		} else {
+			vector, err = idx.GetVector(id)
+		}
+		if err != nil {
+			continue
+		}
+		ids = append(ids, id)
+		vectors = append(vectors, vector)
+	}
+	if unbounded {
+		k = len(ids)
+	}
+	space := db.indexConfig(collection.IndexType, collection.Dimension, collection.Metadata).SpaceType
+	reranked := index.RankCandidates(query, k, space, ids, vectors)
+	sortTies(reranked)
+	return reranked
+}
+
+// rankCandidates orders all candidates held by the index by distance, the
+// caller's filter may still reject some of them
+func (db *DB) rankCandidates(idx index.VectorIndex, collection *Collection, query []float32, candidates map[string]struct{}) (*index.SearchResult, error) {
+	if len(query) != collection.Dimension {
+		return nil, fmt.Errorf("vector dimension mismatch: expected %d, got %d", collection.Dimension, len(query))
+	}
+	ids := make([]string, 0, len(candidates))
+	for id := range candidates {
+		ids = append(ids, id)
+	}
+	sort.Strings(ids)
+
+	held := ids[:0]
+	vectors := make([][]float32, 0, len(ids))
+	for _, id := range ids {
+		// archived documents are not in the index
+		vector, err := idx.GetVector(id)
+		if err != nil {
+			continue
+		}
+		held = append(held, id)
+		vectors = append(vectors, vector)
+	}
+	space := db.indexConfig(collection.IndexType, collection.Dimension, collection.Metadata).SpaceType
+	return index.RankCandidates(query, len(held), space, held, vectors), nil
+}
@@ -0,0 +1,109 @@
+package db
+
+import (
+	"context"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func createKeywordCollection(t *testing.T, db *DB, name string) {
+	t.Helper()
+	_, err := db.CreateCollection(&CreateCollectionOptions{
+		Name:      name,
+		Dimension: 2,
+		IndexType: "hnsw",
+		Schema: &Schema{Fields: []SchemaField{
+			{Name: "genre", Type: FieldKeyword},
+			{Name: "lang", Type: FieldKeyword},
+		}},
+	})
+	require.NoError(t, err)
+}
+
+func keywordSet(t *testing.T, db *DB, collection, field, value string) []string {
+	t.Helper()
+	set, err := db.loadKeywordSet(keywordIndexKey(collection, field, value))
+	require.NoError(t, err)
+	ids := make([]string, 0, len(set))
+	for id := range set {
+		ids = append(ids, id)
+	}
+	return ids
+}
+
+func TestKeywordIndexMaintenance(t *testing.T) {
+	db := newTestDBWithProvider(t, stubEmbeddingProvider{})
+	createKeywordCollection(t, db, "movies")
+
+	require.NoError(t, db.UpsertDocument("movies", &Document{
+		ID: "1", Vector: []float32{1, 0}, Dimension: 2, Parameters: map[string]any{"genre": "drama", "lang": "en"},
+	}))
+	require.NoError(t, db.BatchUpsertDocuments("movies", []*Document{
+		{ID: "2", Vector: []float32{0, 1}, Parameters: map[string]any{"genre": "drama"}},
+		{ID: "3", Vector: []float32{1, 1}, Parameters: map[string]any{"genre": "comedy"}},
+		// the later write of a document wins
+		{ID: "3", Vector: []float32{1, 1}, Parameters: map[string]any{"genre": "horror"}},
+	}))
+	assert.ElementsMatch(t, []string{"1", "2"}, keywordSet(t, db, "movies", "genre", "drama"))
+	assert.Empty(t, keywordSet(t, db, "movies", "genre", "comedy"))
+	assert.Equal(t, []string{"3"}, keywordSet(t, db, "movies", "genre", "horror"))
+	assert.Equal(t, []string{"1"}, keywordSet(t, db, "movies", "lang", "en"))
+
+	// an update moves the document between sets
+	require.NoError(t, db.UpsertDocument("movies", &Document{
+		ID: "1", Vector: []float32{1, 0}, Dimension: 2, Parameters: map[string]any{"genre": "comedy"},
+	}))
+	assert.Equal(t, []string{"2"}, keywordSet(t, db, "movies", "genre", "drama"))
+	assert.Equal(t, []string{"1"}, keywordSet(t, db, "movies", "genre", "comedy"))
+	assert.Empty(t, keywordSet(t, db, "movies", "lang", "en"))
+
+	require.NoError(t, db.DeleteDocument("movies", "2"))
+	assert.Empty(t, keywordSet(t, db, "movies", "genre", "drama"))
+
+	require.NoError(t, db.DeleteCollection("movies"))
+	_, err := db.purgeTrash(time.Now().Add(25 * time.Hour))
+	require.NoError(t, err)
+	assert.Empty(t, keywordSet(t, db, "movies", "genre", "comedy"))
+	assert.Empty(t, keywordSet(t, db, "movies", "genre", "horror"))
+}
+
+func TestKeywordIndexSearch(t *testing.T) {
+	db := newTestDBWithProvider(t, stubEmbeddingProvider{})
+	createKeywordCollection(t, db, "movies")
+
+	// the rare genre is far from the query, post-filtering alone misses it
+	docs := make([]*Document, 0, 22)
+	for i := 0; i < 20; i++ {
+		docs = append(docs, &Document{
+			ID: fmt.Sprintf("c%d", i), Vector: []float32{1, float32(i) / 100}, Parameters: map[string]any{"genre": "comedy", "lang": "en"},
+		})
+	}
+	docs = append(docs,
+		&Document{ID: "d1", Vector: []float32{-1, 0}, Parameters: map[string]any{"genre": "drama", "lang": "en"}},
+		&Document{ID: "d2", Vector: []float32{-2, 0}, Parameters: map[string]any{"genre": "drama", "lang": "fr"}},
+	)
+	require.NoError(t, db.BatchUpsertDocuments("movies", docs))
+
+	found, distances, err := db.SearchDocuments(context.Background(), "movies", &Document{Vector: []float32{1, 0}}, 2,
+		map[string]any{"genre": "drama"})
+	require.NoError(t, err)
+	require.Len(t, found, 2)
+	assert.Equal(t, "d1", found[0].ID)
+	assert.Equal(t, "d2", found[1].ID)
+	assert.Less(t, distances[0], distances[1])
+
+	// indexed fields are intersected, other filter keys still apply
+	found, _, err = db.SearchDocuments(context.Background(), "movies", &Document{Vector: []float32{1, 0}}, 2,
+		map[string]any{"genre": "drama", "lang": "fr"})
+	require.NoError(t, err)
+	require.Len(t, found, 1)
+	assert.Equal(t, "d2", found[0].ID)
+
+	_, _, err = db.SearchDocuments(context.Background(), "movies", &Document{Vector: []float32{1, 0}}, 2,
+		map[string]any{"genre": "western"})
+	assert.Error(t, err)
+}
@@ -0,0 +1,130 @@
+package db
+
+import (
+	"fmt"
+	"slices"
+
+	"oasisdb/pkg/logger"
+)
+
+// keyFormatKey records the format of the storage keys, data directories
+// without it were written before the parts of keys were escaped
+var keyFormatKey = []byte("__key_format")
+
+// keyFormatEscaped is the format with escaped collection names and keyword
+// fields, see escapeKey
+const keyFormatEscaped = "escaped"
+
+// migrateKeys moves the keys of collections whose names or keyword fields
+// change when escaped, e.g. tenant collections, under their escaped names. A
+// key is written under its new name before the old one is deleted, so a
+// migration a crash interrupted is finished by the next start. The old keys
+// of a document of "acme:docs" and one of "acme" whose ID starts with "docs:"
+// were the same key already, it is moved to the former
+func (db *DB) migrateKeys() error {
+	format, _, err := db.Storage.GetScalar(keyFormatKey)
+	if err != nil {
+		return err
+	}
+	if string(format) == keyFormatEscaped {
+		return nil
+	}
+
+	names, _, err := db.registeredCollections()
+	if err != nil {
+		return err
+	}
+	names = append(names, db.IndexManager.GetAllIndexNames()...)
+	slices.Sort(names)
+	moved := 0
+	for _, name := range slices.Compact(names) {
+		n, err := db.migrateCollectionKeys(name)
+		if err != nil {
+			return err
+		}
+		moved += n
+	}
+	if moved > 0 {
+		logger.Info("Migrated storage keys to escaped collection names", "keys", moved)
+	}
+	return db.Storage.PutScalar(keyFormatKey, []byte(keyFormatEscaped))
+}
+
+// migrateCollectionKeys moves the keys of a collection's documents and
+// keyword index and returns how many were moved
+func (db *DB) migrateCollectionKeys(name string) (int, error) {
+	collection, err := db.storedCollection(name)
+	if err != nil {
+		return 0, err
+	}
+	var fields []string
+	if collection != nil {
+		fields = keywordFields(collection)
+	}
+	escaped := escapeKey(name) != name
+	for _, field := range fields {
+		escaped = escaped || escapeKey(field) != field
+	}
+	if !escaped {
+		return 0, nil
+	}
+
+	// the legacy document keys of "acme:docs" also hold those of "acme" whose
+	// IDs start with "docs:", as the unescaped names could not tell them apart
+	var ids []string
+	if err := scanKeys(db.Storage, "doc:"+name+":", "", func(id string, _ []byte) bool {
+		ids = append(ids, id)
+		return true
+	}); err != nil {
+		return 0, fmt.Errorf("failed to scan legacy document keys: %w", err)
+	}
+
+	legacyKey := func(kind, id string) []byte {
+		return []byte(kind + ":" + name + ":" + id)
+	}
+	moved := 0
+	move := func(from, to []byte) error {
+		if string(from) == string(to) {
+			return nil
+		}
+		value, exists, err := db.Storage.GetScalar(from)
+		if err != nil || !exists || len(value) == 0 {
+			return err
+		}
+		if err := db.Storage.PutScalar(to, value); err != nil {
+			return err
+		}
+		moved++
+		return db.Storage.DeleteScalar(from)
+	}
+	keywords := make(map[string]string) // old keyword index key -> new key
+	for _, id := range ids {
+		if err := move(legacyKey("doc", id), documentKey(name, id)); err != nil {
+			return moved, err
+		}
+		if err := move(legacyKey("vec", id), vectorKey(name, id)); err != nil {
+			return moved, err
+		}
+		if err := move(legacyKey("archive", id), archiveKey(name, id)); err != nil {
+			return moved, err
+		}
+		if len(fields) == 0 {
+			continue
+		}
+		params, err := db.storedParameters(name, id)
+		if err != nil {
+			return moved, err
+		}
+		for _, field := range fields {
+			if value, ok := keywordValue(params, field); ok {
+				keywords["idx:"+name+":"+field+":"+value] = keywordIndexKey(name, field, value)
+			}
+		}
+	}
+	for from, to := range keywords {
+		if err := move([]byte(from), []byte(to)); err != nil {
+			return moved, err
+		}
+	}
+	return moved, nil
+}
@@ -0,0 +1,112 @@
+package db
+
+import (
+	"context"
+	stderrors "errors"
+	"fmt"
+	"sort"
+	"sync"
+
+	"oasisdb/pkg/errors"
+)
+
+// MultiSearchTarget is a collection searched by SearchMultiple
+type MultiSearchTarget struct {
+	Collection string
+	Weight     float32 // distances are multiplied by it, 0 means 1. Below 1 favors the collection
+}
+
+// MultiSearchResult is a document found by SearchMultiple
+type MultiSearchResult struct {
+	Collection       string
+	Document         *Document
+	Distance         float32 // distance in its collection
+	WeightedDistance float32 // distance times the collection weight, results are ordered by it
+}
+
+// SearchMultiple searches the collections of targets for the query in
+// parallel and merges their results by weighted distance. The collections
+// must have the dimension of the query, filter applies to each of them
+// besides its default filter, collections without results add none. Offset
+// skips merged results, opts apply to the search of every collection and
+// must not page it, e.g. WithScopeFilter
+func (db *DB) SearchMultiple(ctx context.Context, targets []MultiSearchTarget, queryDoc *Document, k int, filter map[string]any, offset int, opts ...SearchOption) ([]MultiSearchResult, error) {
+	if len(targets) == 0 {
+		return nil, fmt.Errorf("%w: at least one collection is required", errors.ErrInvalidParameter)
+	}
+	if k <= 0 || offset < 0 {
+		return nil, fmt.Errorf("%w: limit must be positive and offset not negative", errors.ErrInvalidParameter)
+	}
+	seen := make(map[string]bool, len(targets))
+	for _, target := range targets {
+		if target.Weight < 0 {
+			return nil, fmt.Errorf("%w: weight of collection %s must not be negative", errors.ErrInvalidParameter, target.Collection)
+		}
+		if seen[target.Collection] {
+			return nil, fmt.Errorf("%w: collection %s is searched twice", errors.ErrInvalidParameter, target.Collection)
+		}
+		seen[target.Collection] = true
+	}
+
+	// each collection may hold the whole page, the rest of the window is skipped
+	window := k + offset
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	results := make([][]MultiSearchResult, len(targets))
+	errs := make([]error, len(targets))
+	var wg sync.WaitGroup
+	for i, target := range targets {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			query := &Document{Vector: queryDoc.Vector, Dimension: queryDoc.Dimension, Parameters: queryDoc.Parameters}
+			docs, distances, err := db.SearchDocuments(ctx, target.Collection, query, window, filter, opts...)
+			if stderrors.Is(err, errors.ErrNoResultsFound) {
+				// an empty collection or one without matches adds nothing
+				return
+			}
+			if err != nil {
+				errs[i] = fmt.Errorf("failed to search collection %s: %w", target.Collection, err)
+				cancel()
+				return
+			}
+			weight := target.Weight
+			if weight == 0 {
+				weight = 1
+			}
+			for j, doc := range docs {
+				results[i] = append(results[i], MultiSearchResult{
+					Collection:       target.Collection,
+					Document:         doc,
+					Distance:         distances[j],
+					WeightedDistance: distances[j] * weight,
+				})
+			}
+		}()
+	}
+	wg.Wait()
+	// a failed search cancels the others, report the failure and not theirs
+	for _, err := range errs {
+		if err != nil && !stderrors.Is(err, context.Canceled) {
+			return nil, err
+		}
+	}
+	for _, err := range errs {
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	var merged []MultiSearchResult
+	for _, r := range results {
+		merged = append(merged, r...)
+	}
+	// ties keep the target order
+	sort.SliceStable(merged, func(i, j int) bool {
+		return merged[i].WeightedDistance < merged[j].WeightedDistance
+	})
+	if offset >= len(merged) {
+		return []MultiSearchResult{}, nil
+	}
+	return merged[offset:min(len(merged), window)], nil
+}
@@ -0,0 +1,22 @@
+package db
+
+import "math"
+
+// normalizeVector returns a unit length copy of vector for collections
+// created with Normalize, zero vectors have no direction and are kept as is
+func normalizeVector(vector []float32) []float32 {
+	var norm float64
+	for _, v := range vector {
+		norm += float64(v) * float64(v)
+	}
+	if norm == 0 {
+		return vector
+	}
+	norm = math.Sqrt(norm)
+
+	normalized := make([]float32, len(vector))
+	for i, v := range vector {
+		normalized[i] = float32(float64(v) / norm)
+	}
+	return normalized
+}
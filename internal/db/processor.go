@@ -0,0 +1,50 @@
+package db
+
+import (
+	"fmt"
+
+	"oasisdb/pkg/processor"
+)
+
+// Processor lets applications embedding OasisDB as a library enrich or
+// sanitize documents without changing the write and read paths, see
+// processor.Register for processors run by every database
+type Processor = processor.Processor
+
+// ProcessorFuncs adapts plain functions to Processor, nil hooks are skipped
+type ProcessorFuncs = processor.Funcs
+
+// RegisterProcessor appends a processor of this database, processors run in
+// registration order after those of processor.Register
+func (db *DB) RegisterProcessor(p Processor) {
+	db.processorsMu.Lock()
+	defer db.processorsMu.Unlock()
+	db.processors = append(db.processors, p)
+}
+
+// getProcessors returns a snapshot of the registered processors
+func (db *DB) getProcessors() []Processor {
+	db.processorsMu.RLock()
+	defer db.processorsMu.RUnlock()
+	return append(processor.Registered(), db.processors...)
+}
+
+// beforeUpsert runs all processors on a document about to be written
+func (db *DB) beforeUpsert(collectionName string, doc *Document) error {
+	for _, p := range db.getProcessors() {
+		if err := p.BeforeUpsert(collectionName, doc); err != nil {
+			return fmt.Errorf("processor rejected document %s: %w", doc.ID, err)
+		}
+	}
+	return nil
+}
+
+// afterFetch runs all processors on a document about to be returned
+func (db *DB) afterFetch(collectionName string, doc *Document) error {
+	for _, p := range db.getProcessors() {
+		if err := p.AfterFetch(collectionName, doc); err != nil {
+			return fmt.Errorf("processor failed on document %s: %w", doc.ID, err)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,79 @@
+package db
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestProcessorHooks(t *testing.T) {
+	var embedded []string
+	db := newTestDBWithProvider(t, stubEmbeddingProvider{
+		embedFn: func(text string) ([]float64, error) {
+			embedded = append(embedded, text)
+			return []float64{1, 0}, nil
+		},
+	})
+	createTestCollection(t, db, "docs", 2)
+
+	db.RegisterProcessor(ProcessorFuncs{
+		Upsert: func(collectionName string, doc *Document) error {
+			if doc.ID == "reject" {
+				return fmt.Errorf("rejected")
+			}
+			if text, ok := doc.Parameters["text"].(string); ok {
+				doc.Parameters["text"] = strings.ReplaceAll(text, "secret", "***")
+			}
+			doc.Parameters["collection"] = collectionName
+			return nil
+		},
+	})
+	db.RegisterProcessor(ProcessorFuncs{
+		Fetch: func(collectionName string, doc *Document) error {
+			doc.Parameters["fetched"] = true
+			return nil
+		},
+	})
+
+	require.NoError(t, db.UpsertDocument("docs", &Document{
+		ID:         "1",
+		Parameters: map[string]any{"embedding": true, "text": "my secret"},
+	}))
+	require.NoError(t, db.BatchUpsertDocuments("docs", []*Document{
+		{ID: "2", Vector: []float32{0, 1}, Parameters: map[string]any{}},
+	}))
+	assert.Equal(t, []string{"my ***"}, embedded)
+
+	err := db.UpsertDocument("docs", &Document{ID: "reject", Vector: []float32{1, 1}, Dimension: 2, Parameters: map[string]any{}})
+	assert.ErrorContains(t, err, "processor rejected document reject")
+
+	doc, err := db.GetDocument("docs", "2")
+	require.NoError(t, err)
+	assert.Equal(t, "docs", doc.Parameters["collection"])
+	assert.Equal(t, true, doc.Parameters["fetched"])
+
+	page, err := db.ScrollDocuments("docs", ScrollOptions{})
+	require.NoError(t, err)
+	require.Len(t, page.Documents, 2)
+	for _, doc := range page.Documents {
+		assert.Equal(t, true, doc.Parameters["fetched"])
+	}
+
+	results, err := db.SearchMultiple(context.Background(), []MultiSearchTarget{{Collection: "docs"}}, &Document{Vector: []float32{1, 0}}, 2, nil, 0)
+	require.NoError(t, err)
+	require.Len(t, results, 2)
+	for _, result := range results {
+		assert.Equal(t, true, result.Document.Parameters["fetched"])
+	}
+
+	docs, _, err := db.SearchDocuments(context.Background(), "docs", &Document{Vector: []float32{1, 0}}, 2, nil)
+	require.NoError(t, err)
+	require.Len(t, docs, 2)
+	for _, doc := range docs {
+		assert.Equal(t, true, doc.Parameters["fetched"])
+	}
+}
@@ -0,0 +1,54 @@
+package db
+
+import (
+	"math/rand"
+	"oasisdb/pkg/logger"
+)
+
+// RecallMetricPrefix prefixes the per-collection shadow recall@k metric
+const RecallMetricPrefix = "search_recall_at_k:"
+
+// sampleRecall re-runs a fraction of live queries as exact searches in the
+// background and records the recall@k of the approximate results
+func (db *DB) sampleRecall(collectionName string, query []float32, k int, approxIDs []string) {
+	rate := db.conf.Index.ShadowRecallRate
+	if rate <= 0 || k <= 0 || rand.Float64() >= rate {
+		return
+	}
+
+	// the caller owns the slices, copy before handing them to the goroutine
+	query = append([]float32(nil), query...)
+	approxIDs = append([]string(nil), approxIDs[:min(k, len(approxIDs))]...)
+
+	db.background.Add(1)
+	go func() {
+		defer db.background.Done()
+
+		exact, err := db.IndexManager.ExactSearch(collectionName, query, k)
+		if err != nil {
+			logger.Debug("Shadow recall search failed", "collection", collectionName, "error", err)
+			return
+		}
+		if len(exact.IDs) == 0 {
+			return
+		}
+		r := recallAtK(approxIDs, exact.IDs)
+		db.Metrics.Observe(RecallMetricPrefix+collectionName, r)
+		logger.Debug("Recorded shadow recall", "collection", collectionName, "k", k, "recall", r)
+	}()
+}
+
+// recallAtK returns the fraction of the exact top-k found by the approximate search
+func recallAtK(approxIDs, exactIDs []string) float64 {
+	found := make(map[string]struct{}, len(approxIDs))
+	for _, id := range approxIDs {
+		found[id] = struct{}{}
+	}
+	hits := 0
+	for _, id := range exactIDs {
+		if _, ok := found[id]; ok {
+			hits++
+		}
+	}
+	return float64(hits) / float64(len(exactIDs))
+}
@@ -0,0 +1,76 @@
+package db
+
+import (
+	"context"
+	"encoding/json"
+	"os"
+	"path"
+	"strings"
+	"testing"
+	"time"
+
+	"oasisdb/pkg/logger"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRecallAtK(t *testing.T) {
+	assert.Equal(t, 1.0, recallAtK([]string{"1", "2"}, []string{"2", "1"}))
+	assert.Equal(t, 0.5, recallAtK([]string{"1", "3"}, []string{"1", "2"}))
+	assert.Equal(t, 0.0, recallAtK(nil, []string{"1"}))
+}
+
+func TestShadowRecallSampling(t *testing.T) {
+	db := newTestDBWithProvider(t, stubEmbeddingProvider{})
+	createTestCollection(t, db, "docs", 2)
+	require.NoError(t, db.BatchUpsertDocuments("docs", []*Document{
+		{ID: "1", Vector: []float32{1, 0}},
+		{ID: "2", Vector: []float32{0, 1}},
+		{ID: "3", Vector: []float32{1, 1}},
+	}))
+
+	// disabled by default
+	_, _, err := db.SearchVectors(context.Background(), "docs", []float32{1, 0}, 2)
+	require.NoError(t, err)
+	db.background.Wait()
+	_, ok := db.Metrics.Get(RecallMetricPrefix + "docs")
+	assert.False(t, ok)
+
+	db.conf.Index.ShadowRecallRate = 1
+	_, _, err = db.SearchVectors(context.Background(), "docs", []float32{1, 0}, 2)
+	require.NoError(t, err)
+	_, _, err = db.SearchDocuments(context.Background(), "docs", &Document{Vector: []float32{0, 1}}, 2, nil)
+	require.NoError(t, err)
+	db.background.Wait()
+
+	summary, ok := db.Metrics.Get(RecallMetricPrefix + "docs")
+	require.True(t, ok)
+	assert.Equal(t, int64(2), summary.Count)
+	assert.Equal(t, 1.0, summary.Mean())
+}
+
+func TestSlowSearchLog(t *testing.T) {
+	db := newTestDBWithProvider(t, stubEmbeddingProvider{})
+	collection := &Collection{Name: "docs", IndexType: "hnsw", Metadata: map[string]string{"efSearch": "64"}}
+	slowLog := path.Join(t.TempDir(), "slow.log")
+	logger.InitSlowLogger(slowLog)
+	defer logger.InitSlowLogger("")
+	ctx := logger.WithRequestID(context.Background(), "req-1")
+
+	// disabled by default
+	db.logSlowSearch(ctx, "vector", collection, 10, time.Second, time.Second)
+	db.conf.Logging.SlowQueryMs = 100
+	db.logSlowSearch(ctx, "vector", collection, 10, time.Millisecond, 50*time.Millisecond)
+	db.logSlowSearch(ctx, "document", collection, 10, 150*time.Millisecond, 200*time.Millisecond)
+
+	data, err := os.ReadFile(slowLog)
+	require.NoError(t, err)
+	lines := strings.Split(strings.TrimSpace(string(data)), "\n")
+	require.Len(t, lines, 1)
+	var entry map[string]any
+	require.NoError(t, json.Unmarshal([]byte(lines[0]), &entry))
+	assert.Equal(t, "document", entry["kind"])
+	assert.Equal(t, "req-1", entry["request_id"])
+	assert.Equal(t, map[string]any{"efSearch": "64"}, entry["parameters"])
+}
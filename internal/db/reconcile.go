@@ -0,0 +1,182 @@
+package db
+
+import (
+	"encoding/json"
+	"fmt"
+	"slices"
+	"sort"
+
+	"oasisdb/pkg/logger"
+)
+
+// collectionsKey holds the names of all collections, a name is registered
+// before its index is created and unregistered after its metadata is deleted
+// so a crash in between leaves it visible to Reconcile
+var collectionsKey = []byte("collections")
+
+// ReconcileReport describes the repairs made by Reconcile
+type ReconcileReport struct {
+	RemovedIndices  []string `json:"removed_indices"`  // empty indices without collection metadata, deleted
+	RestoredIndices []string `json:"restored_indices"` // collections whose missing index was recreated
+	Orphans         []string `json:"orphans"`          // indices without metadata that still have documents, kept
+}
+
+// registeredCollections returns the collection registry, exists is false for
+// data directories written before the registry was added
+func (db *DB) registeredCollections() (names []string, exists bool, err error) {
+	data, exists, err := db.Storage.GetScalar(collectionsKey)
+	if err != nil {
+		return nil, false, err
+	}
+	if !exists || len(data) == 0 {
+		return nil, false, nil
+	}
+	if err := json.Unmarshal(data, &names); err != nil {
+		return nil, false, fmt.Errorf("failed to unmarshal collection registry: %w", err)
+	}
+	return names, true, nil
+}
+
+// updateRegistry applies update to the collection registry and saves it
+func (db *DB) updateRegistry(update func(names []string) []string) error {
+	db.registryMu.Lock()
+	defer db.registryMu.Unlock()
+
+	names, _, err := db.registeredCollections()
+	if err != nil {
+		return err
+	}
+	names = update(names)
+	sort.Strings(names)
+	data, err := json.Marshal(names)
+	if err != nil {
+		return err
+	}
+	return db.Storage.PutScalar(collectionsKey, data)
+}
+
+func (db *DB) registerCollection(name string) error {
+	return db.updateRegistry(func(names []string) []string {
+		if slices.Contains(names, name) {
+			return names
+		}
+		return append(names, name)
+	})
+}
+
+func (db *DB) unregisterCollection(name string) error {
+	return db.updateRegistry(func(names []string) []string {
+		return slices.DeleteFunc(names, func(n string) bool { return n == name })
+	})
+}
+
+// Reconcile repairs collections left half created or half deleted by a
+// crash. An index without collection metadata comes from an interrupted
+// create and is deleted, unless documents reference it, then it's reported.
+// Collection metadata without an index comes from an interrupted delete or
+// lost index files, the index is recreated, from the stored vectors if the
+// collection keeps them, so the collection stays usable and can be deleted
+// again. Open runs it before serving requests.
+func (db *DB) Reconcile() (*ReconcileReport, error) {
+	report := &ReconcileReport{
+		RemovedIndices:  []string{},
+		RestoredIndices: []string{},
+		Orphans:         []string{},
+	}
+	registered, _, err := db.registeredCollections()
+	if err != nil {
+		return nil, err
+	}
+	names := append(slices.Clone(registered), db.IndexManager.GetAllIndexNames()...)
+	sort.Strings(names)
+	names = slices.Compact(names)
+
+	var live []string
+	for _, name := range names {
+		collection, err := db.storedCollection(name)
+		if err != nil {
+			return nil, err
+		}
+		_, indexErr := db.IndexManager.GetIndex(name)
+		hasIndex := indexErr == nil
+
+		switch {
+		case collection == nil && hasIndex:
+			ids, err := db.documentIDs(name)
+			if err != nil {
+				return nil, err
+			}
+			if len(ids) > 0 {
+				logger.Warn("Index has no collection metadata but documents reference it, keeping it",
+					"collection", name, "documents", len(ids))
+				report.Orphans = append(report.Orphans, name)
+				live = append(live, name)
+				continue
+			}
+			if err := db.IndexManager.DeleteIndex(name); err != nil {
+				return nil, fmt.Errorf("failed to delete orphaned index %s: %w", name, err)
+			}
+			logger.Warn("Deleted index without collection metadata", "collection", name)
+			report.RemovedIndices = append(report.RemovedIndices, name)
+		case collection != nil && !hasIndex:
+			count, err := db.restoreIndex(collection)
+			if err != nil {
+				return nil, fmt.Errorf("failed to restore index of collection %s: %w", name, err)
+			}
+			logger.Warn("Recreated missing index of collection", "collection", name,
+				"storeVectors", collection.StoreVectors, "indexed", count)
+			report.RestoredIndices = append(report.RestoredIndices, name)
+			live = append(live, name)
+		case collection != nil:
+			live = append(live, name)
+		}
+	}
+
+	if !slices.Equal(registered, live) {
+		if err := db.updateRegistry(func([]string) []string { return live }); err != nil {
+			return nil, fmt.Errorf("failed to save collection registry: %w", err)
+		}
+	}
+	return report, nil
+}
+
+// storedCollection reads the metadata of a collection without requiring its
+// index, nil if there is none
+func (db *DB) storedCollection(name string) (*Collection, error) {
+	data, exists, err := db.Storage.GetScalar([]byte(fmt.Sprintf("collection:%s", name)))
+	if err != nil {
+		return nil, err
+	}
+	if !exists || len(data) == 0 {
+		return nil, nil
+	}
+	var collection Collection
+	if err := json.Unmarshal(data, &collection); err != nil {
+		return nil, err
+	}
+	return &collection, nil
+}
+
+// restoreIndex creates the missing index of a collection and fills it with
+// the stored vectors, returning the number of documents indexed. Documents of
+// collections that don't store vectors stay unsearchable until upserted again
+func (db *DB) restoreIndex(collection *Collection) (int, error) {
+	var ids []string
+	var vectors [][]float32
+	if collection.StoreVectors {
+		var err error
+		if ids, vectors, err = db.loadStoredVectors(collection.Name); err != nil {
+			return 0, err
+		}
+	}
+	indexConf := db.indexConfig(collection.IndexType, collection.Dimension, collection.Metadata)
+	if _, err := db.IndexManager.CreateIndex(collection.Name, indexConf); err != nil {
+		return 0, err
+	}
+	if len(ids) > 0 {
+		if err := db.IndexManager.AddVectorBatch(collection.Name, ids, vectors); err != nil {
+			return 0, fmt.Errorf("failed to index stored vectors: %w", err)
+		}
+	}
+	return len(ids), nil
+}
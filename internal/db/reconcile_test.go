@@ -0,0 +1,74 @@
+package db
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"oasisdb/internal/config"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestReconcileAfterCrash(t *testing.T) {
+	conf, err := config.NewConfig(t.TempDir())
+	require.NoError(t, err)
+	db, err := New(conf)
+	require.NoError(t, err)
+	require.NoError(t, db.Open())
+
+	_, err = db.CreateCollection(&CreateCollectionOptions{Name: "kept", Dimension: 2, IndexType: "hnsw", Parameters: map[string]string{}, StoreVectors: true})
+	require.NoError(t, err)
+	require.NoError(t, db.UpsertDocument("kept", &Document{ID: "1", Vector: []float32{1, 0}, Dimension: 2}))
+	createTestCollection(t, db, "orphan", 2)
+	require.NoError(t, db.UpsertDocument("orphan", &Document{ID: "1", Vector: []float32{0, 1}, Dimension: 2}))
+
+	// crash during a create, after the index, before the metadata
+	require.NoError(t, db.registerCollection("ghost"))
+	_, err = db.IndexManager.CreateIndex("ghost", db.indexConfig("hnsw", 2, nil))
+	require.NoError(t, err)
+	// crash during a delete, after the index, before the metadata
+	require.NoError(t, db.IndexManager.DeleteIndex("kept"))
+	// metadata lost while documents still reference the index
+	require.NoError(t, db.Storage.DeleteScalar([]byte("collection:orphan")))
+	require.NoError(t, db.flushAccess())
+	db.Close()
+
+	db, err = New(conf)
+	require.NoError(t, err)
+	require.NoError(t, db.Open())
+	t.Cleanup(db.Close)
+
+	names, err := db.ListCollections()
+	require.NoError(t, err)
+	assert.ElementsMatch(t, []string{"kept", "orphan"}, names)
+
+	// the index of kept is recreated from the stored vectors
+	_, err = db.GetCollection("kept")
+	require.NoError(t, err)
+	ids, _, err := db.SearchVectors(context.Background(), "kept", []float32{1, 0}, 1)
+	require.NoError(t, err)
+	assert.Equal(t, []string{"1"}, ids)
+
+	registered, exists, err := db.registeredCollections()
+	require.NoError(t, err)
+	assert.True(t, exists)
+	assert.Equal(t, []string{"kept", "orphan"}, registered)
+
+	// a second pass only reports the orphan it keeps
+	report, err := db.Reconcile()
+	require.NoError(t, err)
+	assert.Empty(t, report.RemovedIndices)
+	assert.Empty(t, report.RestoredIndices)
+	assert.Equal(t, []string{"orphan"}, report.Orphans)
+
+	// a ghost is gone for good and can be created again
+	createTestCollection(t, db, "ghost", 2)
+	require.NoError(t, db.DeleteCollection("ghost"))
+	_, err = db.purgeTrash(time.Now().Add(25 * time.Hour))
+	require.NoError(t, err)
+	registered, _, err = db.registeredCollections()
+	require.NoError(t, err)
+	assert.NotContains(t, registered, "ghost")
+}
@@ -0,0 +1,152 @@
+package db
+
+import (
+	"cmp"
+	"fmt"
+	"maps"
+	"slices"
+	"time"
+
+	"oasisdb/internal/index"
+	"oasisdb/pkg/errors"
+	"oasisdb/pkg/logger"
+	"oasisdb/pkg/vectorindex"
+)
+
+// States of a reindex
+const (
+	ReindexRunning = "running"
+	ReindexDone    = "done"
+	ReindexFailed  = "failed"
+)
+
+// ReindexOptions configures the new index of a collection
+type ReindexOptions struct {
+	IndexType  string            // empty keeps the index type
+	Parameters map[string]string // index parameters, nil keeps the current ones
+}
+
+// ReindexStatus describes the last reindex of a collection
+type ReindexStatus struct {
+	State      string            `json:"state"` // ReindexRunning, ReindexDone or ReindexFailed
+	IndexType  string            `json:"index_type"`
+	Parameters map[string]string `json:"parameters,omitempty"`
+	StartedAt  time.Time         `json:"started_at"`
+	FinishedAt *time.Time        `json:"finished_at,omitempty"`
+	Count      int               `json:"count"` // vectors in the new index
+	Error      string            `json:"error,omitempty"`
+}
+
+// Reindex rebuilds the index of a collection with another index type or
+// parameters in the background and swaps it in once built, searches and
+// writes use the current index until then. The new index is built from the
+// stored vectors of collections storing them and from the current index
+// otherwise. It returns the status of the started reindex, ReindexStatus
+// reports its progress
+func (db *DB) Reindex(collectionName string, opts ReindexOptions) (*ReindexStatus, error) {
+	collection, err := db.GetCollection(collectionName)
+	if err != nil {
+		return nil, err
+	}
+	indexType := cmp.Or(opts.IndexType, collection.IndexType)
+	if !vectorindex.IsRegistered(vectorindex.IndexType(indexType)) {
+		return nil, fmt.Errorf("%w: unsupported index type %s, registered types are %v",
+			errors.ErrInvalidParameter, indexType, vectorindex.RegisteredTypes())
+	}
+	metadata := withIndexParameters(collection.Metadata, opts.Parameters)
+	status := &ReindexStatus{
+		State:      ReindexRunning,
+		IndexType:  indexType,
+		Parameters: opts.Parameters,
+		StartedAt:  time.Now(),
+	}
+	if previous, running := db.reindexes.LoadOrStore(collectionName, status); running {
+		if previous.(*ReindexStatus).State == ReindexRunning {
+			return nil, fmt.Errorf("%w: collection %s is already being reindexed", errors.ErrInvalidParameter, collectionName)
+		}
+		if !db.reindexes.CompareAndSwap(collectionName, previous, status) {
+			return nil, fmt.Errorf("%w: collection %s is already being reindexed", errors.ErrInvalidParameter, collectionName)
+		}
+	}
+
+	indexConf := db.indexConfig(indexType, collection.Dimension, metadata)
+	vectors := func(current index.VectorIndex) ([]string, [][]float32, error) {
+		if collection.StoreVectors {
+			return db.loadStoredVectors(collectionName)
+		}
+		var ids []string
+		var vectors [][]float32
+		err := current.Iterate(func(id string, vector []float32) bool {
+			ids = append(ids, id)
+			vectors = append(vectors, slices.Clone(vector))
+			return true
+		})
+		return ids, vectors, err
+	}
+	db.background.Add(1)
+	go func() {
+		defer db.background.Done()
+		count, err := db.IndexManager.Reindex(collectionName, indexConf, vectors)
+		if err == nil {
+			err = db.updateIndexMetadata(collectionName, indexType, metadata)
+		}
+		finished := *status
+		now := time.Now()
+		finished.FinishedAt = &now
+		finished.Count = count
+		finished.State = ReindexDone
+		if err != nil {
+			finished.State = ReindexFailed
+			finished.Error = err.Error()
+			logger.Error("Failed to reindex collection", "collection", collectionName, "error", err)
+		}
+		db.reindexes.Store(collectionName, &finished)
+	}()
+	return status, nil
+}
+
+// ReindexStatus returns the status of the last reindex of a collection since
+// the database was opened, false if there was none
+func (db *DB) ReindexStatus(collectionName string) (*ReindexStatus, bool) {
+	status, ok := db.reindexes.Load(collectionName)
+	if !ok {
+		return nil, false
+	}
+	return status.(*ReindexStatus), true
+}
+
+// updateIndexMetadata records the index settings of a reindexed collection
+func (db *DB) updateIndexMetadata(collectionName, indexType string, metadata map[string]string) error {
+	db.trashMu.Lock()
+	defer db.trashMu.Unlock()
+
+	collection, err := db.storedCollection(collectionName)
+	if err != nil {
+		return err
+	}
+	if collection == nil {
+		return errors.ErrCollectionNotFound
+	}
+	collection.IndexType = indexType
+	collection.Metadata = metadata
+	if err := db.putCollection(collection); err != nil {
+		return err
+	}
+	// cached results were found with the old index
+	db.ClearSearchCache(collectionName)
+	return nil
+}
+
+// withIndexParameters returns the metadata of a collection with its index
+// parameters replaced by params, the schema kept along with them stays. nil
+// params keep the current ones
+func withIndexParameters(metadata, params map[string]string) map[string]string {
+	if params == nil {
+		return maps.Clone(metadata)
+	}
+	result := maps.Clone(params)
+	if schema, ok := metadata[schemaMetadataKey]; ok {
+		result[schemaMetadataKey] = schema
+	}
+	return result
+}
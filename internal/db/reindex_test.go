@@ -0,0 +1,66 @@
+package db
+
+import (
+	"context"
+	"fmt"
+	"testing"
+
+	"oasisdb/internal/index"
+	"oasisdb/pkg/errors"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestReindex(t *testing.T) {
+	db := newTestDBWithProvider(t, stubEmbeddingProvider{})
+	for _, storeVectors := range []bool{false, true} {
+		name := fmt.Sprint("docs_", storeVectors)
+		_, err := db.CreateCollection(&CreateCollectionOptions{
+			Name:         name,
+			Dimension:    2,
+			IndexType:    "flat",
+			StoreVectors: storeVectors,
+			Schema:       &Schema{Fields: []SchemaField{{Name: "genre", Type: FieldString}}},
+		})
+		require.NoError(t, err)
+		var docs []*Document
+		for i := 0; i < 10; i++ {
+			docs = append(docs, &Document{ID: fmt.Sprint(i), Vector: []float32{float32(i), 1}})
+		}
+		require.NoError(t, db.BatchUpsertDocuments(name, docs))
+
+		status, err := db.Reindex(name, ReindexOptions{IndexType: "hnsw", Parameters: map[string]string{"M": "8"}})
+		require.NoError(t, err)
+		assert.Equal(t, ReindexRunning, status.State)
+		db.background.Wait()
+
+		status, ok := db.ReindexStatus(name)
+		require.True(t, ok)
+		assert.Equal(t, ReindexDone, status.State, status.Error)
+		assert.Equal(t, 10, status.Count)
+		assert.NotNil(t, status.FinishedAt)
+
+		collection, err := db.GetCollection(name)
+		require.NoError(t, err)
+		assert.Equal(t, "hnsw", collection.IndexType)
+		assert.Equal(t, "8", collection.Metadata["M"])
+		schema, err := collection.ParameterSchema()
+		require.NoError(t, err)
+		assert.NotNil(t, schema)
+		stats, err := db.IndexManager.Stats(name)
+		require.NoError(t, err)
+		assert.Equal(t, index.HNSWIndex, stats.Type)
+
+		ids, _, err := db.SearchVectors(context.Background(), name, []float32{3, 1}, 1)
+		require.NoError(t, err)
+		assert.Equal(t, []string{"3"}, ids)
+	}
+
+	_, ok := db.ReindexStatus("missing")
+	assert.False(t, ok)
+	_, err := db.Reindex("missing", ReindexOptions{})
+	assert.ErrorIs(t, err, errors.ErrCollectionNotFound)
+	_, err = db.Reindex("docs_false", ReindexOptions{IndexType: "annoy"})
+	assert.ErrorIs(t, err, errors.ErrInvalidParameter)
+}
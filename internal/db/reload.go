@@ -0,0 +1,63 @@
+package db
+
+import (
+	"fmt"
+	"strings"
+
+	"oasisdb/internal/config"
+	"oasisdb/pkg/errors"
+	"oasisdb/pkg/logger"
+)
+
+// ApplyConfig applies the reloadable settings of next, see config.Reloadable,
+// and returns the keys that changed. A change to any other key rejects the
+// whole config and nothing is applied
+func (db *DB) ApplyConfig(next *config.Config) ([]string, error) {
+	db.confMu.Lock()
+	defer db.confMu.Unlock()
+
+	changed := config.Diff(db.conf, next)
+	var fixed []string
+	for _, key := range changed {
+		if !config.IsReloadable(key) {
+			fixed = append(fixed, key)
+		}
+	}
+	if len(fixed) > 0 {
+		return nil, fmt.Errorf("%w: %s can't be changed without a restart", errors.ErrInvalidParameter, strings.Join(fixed, ", "))
+	}
+	if len(changed) == 0 {
+		return changed, nil
+	}
+	if err := logger.SetLevel(next.Logging.Level); err != nil {
+		return nil, fmt.Errorf("%w: %v", errors.ErrInvalidParameter, err)
+	}
+
+	db.conf.Logging.Level = next.Logging.Level
+	db.conf.Logging.SlowQueryMs = next.Logging.SlowQueryMs
+	db.conf.Server.RateLimit = next.Server.RateLimit
+	db.conf.Server.RateLimitBurst = next.Server.RateLimitBurst
+	if db.conf.Cache != next.Cache {
+		db.conf.Cache = next.Cache
+		db.Cache.Resize(next.Cache.Size)
+		// recreated with the new settings on their next search
+		db.searchCaches.Clear()
+	}
+	logger.Info("Applied reloaded config", "changed", changed)
+	return changed, nil
+}
+
+// cacheConfig returns the cache section of the config, which a reload may
+// change
+func (db *DB) cacheConfig() config.CacheConfig {
+	db.confMu.RLock()
+	defer db.confMu.RUnlock()
+	return db.conf.Cache
+}
+
+// slowQueryThreshold returns logging.slow_query_ms, which a reload may change
+func (db *DB) slowQueryThreshold() int {
+	db.confMu.RLock()
+	defer db.confMu.RUnlock()
+	return db.conf.Logging.SlowQueryMs
+}
@@ -0,0 +1,113 @@
+package db
+
+import (
+	"fmt"
+	"path"
+
+	"oasisdb/internal/index"
+	"oasisdb/internal/replication"
+	"oasisdb/internal/storage"
+	"oasisdb/pkg/errors"
+)
+
+// replicationStateFile keeps the position of a follower in the data directory
+const replicationStateFile = "replication.state"
+
+// replicatedStorage records the writes of the scalar storage in the
+// replication log
+type replicatedStorage struct {
+	storage.ScalarStorage
+	log *replication.Log
+}
+
+func (s *replicatedStorage) PutScalar(key, value []byte) error {
+	if err := s.ScalarStorage.PutScalar(key, value); err != nil {
+		return err
+	}
+	s.log.RecordScalar([][]byte{key}, [][]byte{value})
+	return nil
+}
+
+func (s *replicatedStorage) BatchPutScalar(keys, values [][]byte) error {
+	if err := s.ScalarStorage.BatchPutScalar(keys, values); err != nil {
+		return err
+	}
+	s.log.RecordScalar(keys, values)
+	return nil
+}
+
+func (s *replicatedStorage) DeleteScalar(key []byte) error {
+	if err := s.ScalarStorage.DeleteScalar(key); err != nil {
+		return err
+	}
+	s.log.RecordScalar([][]byte{key}, [][]byte{nil})
+	return nil
+}
+
+// openReplication records the writes of a leader, or creates the follower of
+// the configured leader. Followers don't record, they can't be followed
+func (db *DB) openReplication() error {
+	if leader := db.conf.Replication.Leader; leader != "" {
+		follower, err := replication.NewFollower(leader, path.Join(db.conf.Dir, replicationStateFile), db)
+		if err != nil {
+			return err
+		}
+		db.follower = follower
+		return nil
+	}
+	if db.conf.Replication.LogSize < 0 {
+		return nil
+	}
+	db.replLog = replication.NewLog(db.conf.Replication.LogSize)
+	db.Storage = &replicatedStorage{ScalarStorage: db.Storage, log: db.replLog}
+	db.IndexManager.SetWriteHook(db.replLog.RecordIndex)
+	return nil
+}
+
+// ReplicationLog returns the log followers fetch writes from, nil when this
+// server doesn't serve followers
+func (db *DB) ReplicationLog() *replication.Log {
+	return db.replLog
+}
+
+// Follower returns the follower replicating from the leader, nil on a leader
+func (db *DB) Follower() *replication.Follower {
+	return db.follower
+}
+
+// IsFollower reports whether the database is a read-only follower
+func (db *DB) IsFollower() bool {
+	return db.follower != nil
+}
+
+// ApplyReplicated applies a write of the leader
+func (db *DB) ApplyReplicated(entry *replication.Entry) error {
+	if entry.Index != nil {
+		if err := db.IndexManager.ApplyEntry(entry.Index); err != nil {
+			return fmt.Errorf("%s of collection %s: %w", entry.Index.OpType, entry.Index.Collection, err)
+		}
+		if entry.Index.OpType == index.WALOpDeleteIndex {
+			db.searchCaches.Delete(entry.Index.Collection)
+		} else {
+			db.ClearSearchCache(entry.Index.Collection)
+		}
+		return nil
+	}
+	if len(entry.Keys) != len(entry.Values) {
+		return fmt.Errorf("%w: %d keys but %d values", errors.ErrInvalidParameter, len(entry.Keys), len(entry.Values))
+	}
+	for i, key := range entry.Keys {
+		var err error
+		if entry.Values[i] == nil {
+			err = db.Storage.DeleteScalar(key)
+		} else {
+			err = db.Storage.PutScalar(key, entry.Values[i])
+		}
+		if err != nil {
+			return err
+		}
+	}
+	// documents and collection settings changed, which the keys don't tell
+	db.clearSearchCaches()
+	return nil
+}
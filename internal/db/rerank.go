@@ -0,0 +1,107 @@
+package db
+
+import (
+	"context"
+	stderrors "errors"
+	"fmt"
+	"oasisdb/internal/rerank"
+	"oasisdb/pkg/errors"
+	"oasisdb/pkg/logger"
+)
+
+// rerankCandidateFactor is how many candidates per result are fetched for
+// reranking when neither the request nor the config sets top_n
+const rerankCandidateFactor = 3
+
+// RerankOptions describes the optional rerank step of a document search
+type RerankOptions struct {
+	rerank.Options
+	TopN int // candidates fetched before reranking, 0 means the config default
+}
+
+// SearchDocumentsReranked fetches the top-N candidates of a document search
+// and lets the selected reranker choose the k results, scores are the
+// reranker's relevance for each returned document
+func (db *DB) SearchDocumentsReranked(ctx context.Context, collectionName string, queryDoc *Document, k int, filter map[string]any, opts RerankOptions, searchOpts ...SearchOption) ([]*Document, []float32, []float64, error) {
+	reranker, err := db.newReranker(opts.Options)
+	if err != nil {
+		return nil, nil, nil, fmt.Errorf("%w: %v", errors.ErrInvalidParameter, err)
+	}
+
+	topN := opts.TopN
+	if topN <= 0 {
+		topN = db.conf.Rerank.TopN
+	}
+	if topN <= 0 {
+		topN = k * rerankCandidateFactor
+	}
+	// the reranked order is paged, not the order of the search
+	o := newSearchOptions(searchOpts)
+	if o.offset < 0 {
+		return nil, nil, nil, fmt.Errorf("%w: offset must not be negative", errors.ErrInvalidParameter)
+	}
+	if k > 0 {
+		k += o.offset
+	}
+	topN = max(topN, k)
+
+	searchOpts = append(searchOpts, WithOffset(0), WithTotalCandidates(nil))
+	docs, distances, err := db.SearchDocuments(ctx, collectionName, queryDoc, topN, filter, searchOpts...)
+	if err != nil {
+		return nil, nil, nil, err
+	}
+	if k <= 0 {
+		// a range search without a limit reranks everything within its radius
+		k = len(docs)
+	}
+
+	query := rerank.Query{Vector: queryDoc.Vector}
+	if queryDoc.Parameters != nil {
+		query.Text, _ = queryDoc.Parameters["text"].(string)
+	}
+	candidates := make([]rerank.Candidate, len(docs))
+	byID := make(map[string]*Document, len(docs))
+	for i, doc := range docs {
+		candidates[i] = rerank.Candidate{ID: doc.ID, Vector: doc.Vector, Distance: distances[i]}
+		if doc.Parameters != nil {
+			candidates[i].Text, _ = doc.Parameters["text"].(string)
+		}
+		byID[doc.ID] = doc
+	}
+
+	reranked, err := reranker.Rerank(query, candidates, k)
+	if stderrors.Is(err, rerank.ErrQueryTextRequired) {
+		return nil, nil, nil, fmt.Errorf("%w: %v", errors.ErrInvalidParameter, err)
+	}
+	if err != nil {
+		return nil, nil, nil, fmt.Errorf("failed to rerank results: %w", err)
+	}
+	logger.Ctx(ctx).Debugw("Reranked search results", "collection", collectionName, "reranker", opts.Type,
+		"candidates", len(candidates), "results", len(reranked))
+
+	reranked = reranked[o.pageStart(len(reranked)):]
+	docs = make([]*Document, len(reranked))
+	distances = make([]float32, len(reranked))
+	scores := make([]float64, len(reranked))
+	for i, c := range reranked {
+		docs[i] = byID[c.ID]
+		distances[i] = c.Distance
+		scores[i] = c.Score
+	}
+	return docs, distances, scores, nil
+}
+
+// newReranker creates the reranker for opts, unset API settings fall back
+// to the rerank section of the config
+func (db *DB) newReranker(opts rerank.Options) (rerank.Reranker, error) {
+	if opts.Model == "" {
+		opts.Model = db.conf.Rerank.Model
+	}
+	if opts.BaseURL == "" {
+		opts.BaseURL = db.conf.Rerank.BaseURL
+	}
+	if opts.APIKeyEnv == "" {
+		opts.APIKeyEnv = db.conf.Rerank.APIKeyEnv
+	}
+	return rerank.New(opts)
+}
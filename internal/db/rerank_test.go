@@ -0,0 +1,46 @@
+package db
+
+import (
+	"context"
+	"testing"
+
+	"oasisdb/internal/rerank"
+	pkgerrors "oasisdb/pkg/errors"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSearchDocumentsReranked(t *testing.T) {
+	db := newTestDBWithProvider(t, stubEmbeddingProvider{})
+	createTestCollection(t, db, "docs", 2)
+
+	docs := []*Document{
+		{ID: "1", Vector: []float32{1, 0.1}, Dimension: 2, Parameters: map[string]any{"text": "a"}},
+		{ID: "2", Vector: []float32{1, 0.11}, Dimension: 2, Parameters: map[string]any{"text": "b"}},
+		{ID: "3", Vector: []float32{1, -1}, Dimension: 2, Parameters: map[string]any{"text": "c"}},
+	}
+	require.NoError(t, db.BatchUpsertDocuments("docs", docs))
+
+	query := &Document{Vector: []float32{1, 0}, Dimension: 2}
+	results, distances, scores, err := db.SearchDocumentsReranked(context.Background(), "docs", query, 2, nil, RerankOptions{
+		Options: rerank.Options{Type: rerank.MMRReranker, Lambda: rerank.DefaultLambda},
+	})
+	require.NoError(t, err)
+	require.Len(t, results, 2)
+	assert.Equal(t, "1", results[0].ID)
+	assert.Equal(t, "3", results[1].ID)
+	assert.Len(t, distances, 2)
+	assert.Len(t, scores, 2)
+
+	_, _, _, err = db.SearchDocumentsReranked(context.Background(), "docs", query, 2, nil, RerankOptions{
+		Options: rerank.Options{Type: "unknown"},
+	})
+	assert.ErrorIs(t, err, pkgerrors.ErrInvalidParameter)
+
+	t.Setenv("TEST_RERANK_KEY", "test-key")
+	_, _, _, err = db.SearchDocumentsReranked(context.Background(), "docs", query, 2, nil, RerankOptions{
+		Options: rerank.Options{Type: rerank.APIReranker, APIKeyEnv: "TEST_RERANK_KEY"},
+	})
+	assert.ErrorIs(t, err, pkgerrors.ErrInvalidParameter)
+}
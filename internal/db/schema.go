@@ -0,0 +1,123 @@
+package db
+
+import (
+	"encoding/json"
+	"fmt"
+
+	"oasisdb/pkg/errors"
+)
+
+// schemaMetadataKey is the collection metadata entry holding the encoded schema
+const schemaMetadataKey = "schema"
+
+// FieldType is the type of a document parameter declared in a schema
+type FieldType string
+
+const (
+	FieldString  FieldType = "string"
+	FieldNumber  FieldType = "number"
+	FieldBool    FieldType = "bool"
+	FieldKeyword FieldType = "keyword" // a string matched exactly, can carry a filter index
+)
+
+// SchemaField declares one document parameter
+type SchemaField struct {
+	Name     string    `json:"name"`
+	Type     FieldType `json:"type"`
+	Required bool      `json:"required,omitempty"`
+}
+
+// Schema declares the parameters of a collection's documents, parameters
+// not listed are accepted as they are
+type Schema struct {
+	Fields []SchemaField `json:"fields"`
+}
+
+// Validate checks that the schema itself is well formed
+func (s *Schema) Validate() error {
+	seen := make(map[string]bool, len(s.Fields))
+	for _, field := range s.Fields {
+		if field.Name == "" {
+			return fmt.Errorf("schema field name is required")
+		}
+		if seen[field.Name] {
+			return fmt.Errorf("schema field %q is declared twice", field.Name)
+		}
+		seen[field.Name] = true
+		switch field.Type {
+		case FieldString, FieldNumber, FieldBool, FieldKeyword:
+		default:
+			return fmt.Errorf("schema field %q has unknown type %q", field.Name, field.Type)
+		}
+	}
+	return nil
+}
+
+// ValidateParameters checks document parameters against the schema
+func (s *Schema) ValidateParameters(params map[string]any) error {
+	for _, field := range s.Fields {
+		value, ok := params[field.Name]
+		if !ok || value == nil {
+			if field.Required {
+				return fmt.Errorf("parameter %q is required", field.Name)
+			}
+			continue
+		}
+		if !field.Type.accepts(value) {
+			return fmt.Errorf("parameter %q must be a %s, got %T", field.Name, field.Type, value)
+		}
+	}
+	return nil
+}
+
+// IndexedFields returns the keyword fields, the ones metadata filters can
+// be indexed on
+func (s *Schema) IndexedFields() []string {
+	var fields []string
+	for _, field := range s.Fields {
+		if field.Type == FieldKeyword {
+			fields = append(fields, field.Name)
+		}
+	}
+	return fields
+}
+
+func (t FieldType) accepts(value any) bool {
+	switch t {
+	case FieldString, FieldKeyword:
+		_, ok := value.(string)
+		return ok
+	case FieldNumber:
+		_, ok := toFloat64(value)
+		return ok
+	case FieldBool:
+		_, ok := value.(bool)
+		return ok
+	}
+	return false
+}
+
+// ParameterSchema decodes the collection's schema, nil if it has none
+func (c *Collection) ParameterSchema() (*Schema, error) {
+	data, ok := c.Metadata[schemaMetadataKey]
+	if !ok {
+		return nil, nil
+	}
+	var schema Schema
+	if err := json.Unmarshal([]byte(data), &schema); err != nil {
+		return nil, fmt.Errorf("failed to decode schema of collection %s: %w", c.Name, err)
+	}
+	return &schema, nil
+}
+
+// validateDocument rejects documents violating the collection's schema
+func validateDocument(collection *Collection, doc *Document) error {
+	schema, err := collection.ParameterSchema()
+	if err != nil || schema == nil {
+		return err
+	}
+	if err := schema.ValidateParameters(doc.Parameters); err != nil {
+		return fmt.Errorf("%w: document %s: %v", errors.ErrInvalidParameter, doc.ID, err)
+	}
+	return nil
+}
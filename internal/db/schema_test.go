@@ -0,0 +1,101 @@
+package db
+
+import (
+	"testing"
+
+	pkgerrors "oasisdb/pkg/errors"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSchemaValidate(t *testing.T) {
+	assert.NoError(t, (&Schema{Fields: []SchemaField{{Name: "genre", Type: FieldKeyword}}}).Validate())
+	assert.Error(t, (&Schema{Fields: []SchemaField{{Name: "", Type: FieldString}}}).Validate())
+	assert.Error(t, (&Schema{Fields: []SchemaField{{Name: "year", Type: "date"}}}).Validate())
+	assert.Error(t, (&Schema{Fields: []SchemaField{{Name: "a", Type: FieldBool}, {Name: "a", Type: FieldBool}}}).Validate())
+}
+
+func TestSchemaValidateParameters(t *testing.T) {
+	schema := &Schema{Fields: []SchemaField{
+		{Name: "title", Type: FieldString, Required: true},
+		{Name: "genre", Type: FieldKeyword},
+		{Name: "year", Type: FieldNumber},
+		{Name: "draft", Type: FieldBool},
+	}}
+
+	tests := []struct {
+		name    string
+		params  map[string]any
+		wantErr bool
+	}{
+		{"all fields", map[string]any{"title": "a", "genre": "drama", "year": float64(1999), "draft": false}, false},
+		{"undeclared fields are kept", map[string]any{"title": "a", "extra": []any{1}}, false},
+		{"integer number", map[string]any{"title": "a", "year": 1999}, false},
+		{"missing required", map[string]any{"genre": "drama"}, true},
+		{"null required", map[string]any{"title": nil}, true},
+		{"wrong string", map[string]any{"title": 1}, true},
+		{"wrong keyword", map[string]any{"title": "a", "genre": true}, true},
+		{"wrong number", map[string]any{"title": "a", "year": "1999"}, true},
+		{"wrong bool", map[string]any{"title": "a", "draft": "no"}, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := schema.ValidateParameters(tt.params)
+			if tt.wantErr {
+				assert.Error(t, err)
+			} else {
+				assert.NoError(t, err)
+			}
+		})
+	}
+
+	assert.Equal(t, []string{"genre"}, schema.IndexedFields())
+}
+
+func TestCollectionSchema(t *testing.T) {
+	db := newTestDBWithProvider(t, stubEmbeddingProvider{})
+
+	_, err := db.CreateCollection(&CreateCollectionOptions{
+		Name:      "bad",
+		Dimension: 2,
+		Schema:    &Schema{Fields: []SchemaField{{Name: "year", Type: "date"}}},
+	})
+	assert.ErrorIs(t, err, pkgerrors.ErrInvalidParameter)
+
+	schema := &Schema{Fields: []SchemaField{{Name: "genre", Type: FieldKeyword, Required: true}}}
+	_, err = db.CreateCollection(&CreateCollectionOptions{
+		Name:       "movies",
+		Dimension:  2,
+		Parameters: map[string]string{"M": "8"},
+		Schema:     schema,
+	})
+	require.NoError(t, err)
+
+	// the schema survives in the metadata next to the index parameters
+	collection, err := db.GetCollection("movies")
+	require.NoError(t, err)
+	assert.Equal(t, "8", collection.Metadata["M"])
+	stored, err := collection.ParameterSchema()
+	require.NoError(t, err)
+	assert.Equal(t, schema, stored)
+
+	require.NoError(t, db.UpsertDocument("movies", &Document{
+		ID: "1", Vector: []float32{1, 0}, Dimension: 2, Parameters: map[string]any{"genre": "drama"},
+	}))
+	err = db.UpsertDocument("movies", &Document{
+		ID: "2", Vector: []float32{0, 1}, Dimension: 2, Parameters: map[string]any{"genre": 7},
+	})
+	assert.ErrorIs(t, err, pkgerrors.ErrInvalidParameter)
+	_, err = db.GetDocument("movies", "2")
+	assert.ErrorIs(t, err, pkgerrors.ErrDocumentNotFound)
+
+	// one invalid document rejects the whole batch
+	err = db.BatchUpsertDocuments("movies", []*Document{
+		{ID: "3", Vector: []float32{1, 1}, Parameters: map[string]any{"genre": "comedy"}},
+		{ID: "4", Vector: []float32{1, 1}},
+	})
+	assert.ErrorIs(t, err, pkgerrors.ErrInvalidParameter)
+	_, err = db.GetDocument("movies", "3")
+	assert.ErrorIs(t, err, pkgerrors.ErrDocumentNotFound)
+}
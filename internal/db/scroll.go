@@ -0,0 +1,249 @@
+package db
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	stderrors "errors"
+	"fmt"
+	"oasisdb/pkg/errors"
+	"sort"
+	"time"
+)
+
+const (
+	DefaultScrollSize      = 100
+	MaxScrollSize          = 1000
+	DefaultScrollKeepAlive = 5 * time.Minute
+
+	DefaultIDPageSize = 1000
+	MaxIDPageSize     = 10000
+)
+
+// ScrollOptions selects a page of a scroll over all documents of a collection
+type ScrollOptions struct {
+	Filter    map[string]any // only used to start a scroll, the cursor keeps it
+	Size      int            // documents per page, 0 means DefaultScrollSize
+	Cursor    string         // returned by the previous page, empty starts a scroll
+	KeepAlive time.Duration  // how long the returned cursor stays valid
+	Snapshot  bool           // only used to start a scroll, pages read the collection as of the first one
+	After     string         // only used to start a scroll, it begins after this document ID
+	Scope     map[string]any // enforced on every page like the collection default filter, see WithScopeFilter
+}
+
+// ScrollPage is one page of a scroll, Cursor is empty after the last page
+type ScrollPage struct {
+	Documents []*Document
+	Cursor    string
+	Seq       uint64 // sequence number of the snapshot read, 0 unless the scroll reads one
+}
+
+// scrollCursor is encoded into the opaque cursor handed to clients, the
+// server keeps no state between pages but the snapshot of the scroll
+type scrollCursor struct {
+	After    string         `json:"after"`              // last document ID returned
+	Filter   map[string]any `json:"filter"`             // filter of the first page
+	Expires  int64          `json:"expires"`            // unix seconds
+	Snapshot string         `json:"snapshot,omitempty"` // pinned snapshot of the scroll
+}
+
+func encodeScrollCursor(c scrollCursor) (string, error) {
+	data, err := json.Marshal(c)
+	if err != nil {
+		return "", err
+	}
+	return base64.RawURLEncoding.EncodeToString(data), nil
+}
+
+func decodeScrollCursor(s string) (scrollCursor, error) {
+	var c scrollCursor
+	data, err := base64.RawURLEncoding.DecodeString(s)
+	if err != nil {
+		return c, fmt.Errorf("%w: malformed scroll cursor", errors.ErrInvalidParameter)
+	}
+	if err := json.Unmarshal(data, &c); err != nil {
+		return c, fmt.Errorf("%w: malformed scroll cursor", errors.ErrInvalidParameter)
+	}
+	if time.Now().Unix() > c.Expires {
+		return c, fmt.Errorf("%w: scroll cursor expired", errors.ErrInvalidParameter)
+	}
+	return c, nil
+}
+
+// ScrollDocuments iterates all documents of a collection matching a filter in
+// ID order, archived documents included, across as many calls as needed.
+// Documents written during the scroll are returned if their ID sorts after
+// the cursor, unless the scroll reads a snapshot. Processors see the returned
+// documents, reads are not recorded so a full scan does not keep documents hot
+func (db *DB) ScrollDocuments(collectionName string, opts ScrollOptions) (*ScrollPage, error) {
+	db.scrolls.expire(time.Now())
+	collection, err := db.GetCollection(collectionName)
+	if err != nil {
+		return nil, err
+	}
+
+	size := opts.Size
+	if size <= 0 {
+		size = DefaultScrollSize
+	}
+	if size > MaxScrollSize {
+		return nil, fmt.Errorf("%w: scroll size must be at most %d", errors.ErrInvalidParameter, MaxScrollSize)
+	}
+	keepAlive := opts.KeepAlive
+	if keepAlive <= 0 {
+		keepAlive = DefaultScrollKeepAlive
+	}
+
+	cursor := scrollCursor{Filter: opts.Filter, After: opts.After}
+	if opts.Cursor != "" {
+		if cursor, err = decodeScrollCursor(opts.Cursor); err != nil {
+			return nil, err
+		}
+	}
+	filter, ok := scopeFilter(collection.DefaultFilter, opts.Scope, cursor.Filter)
+	if !ok {
+		return &ScrollPage{Documents: []*Document{}}, nil
+	}
+	expires := time.Now().Add(keepAlive)
+
+	var seq uint64
+	page := &ScrollPage{Documents: make([]*Document, 0, size)}
+	more := false
+	// visit adds a document to the page and tells whether to go on
+	visit := func(id string, getDocument func(id string) (*Document, error)) (bool, error) {
+		if len(page.Documents) == size {
+			// a full page followed by more documents
+			more = true
+			return false, nil
+		}
+		doc, err := getDocument(id)
+		if stderrors.Is(err, errors.ErrDocumentNotFound) {
+			return true, nil
+		}
+		if err != nil {
+			return false, fmt.Errorf("failed to get document %s: %w", id, err)
+		}
+		cursor.After = id
+		if !matchFilter(doc.Parameters, filter) {
+			return true, nil
+		}
+		if err := db.afterFetch(collectionName, doc); err != nil {
+			return false, err
+		}
+		page.Documents = append(page.Documents, doc)
+		return true, nil
+	}
+
+	var snapshot *CollectionSnapshot
+	switch {
+	case cursor.Snapshot != "":
+		if snapshot, ok = db.scrolls.get(cursor.Snapshot, expires); !ok {
+			return nil, fmt.Errorf("%w: scroll snapshot expired", errors.ErrInvalidParameter)
+		}
+	case opts.Snapshot && opts.Cursor == "":
+		if snapshot, err = db.SnapshotCollection(collectionName); err != nil {
+			return nil, err
+		}
+		cursor.Snapshot = db.scrolls.pin(snapshot, expires)
+	}
+	if snapshot != nil {
+		seq = snapshot.Seq()
+		ids := snapshot.IDs()
+		start := sort.SearchStrings(ids, cursor.After)
+		if start < len(ids) && ids[start] == cursor.After {
+			start++
+		}
+		for _, id := range ids[start:] {
+			next, err := visit(id, snapshot.GetDocument)
+			if err != nil {
+				return nil, err
+			}
+			if !next {
+				break
+			}
+		}
+	} else {
+		// the documents are read from the cursor on, up to the first one
+		// after a full page
+		getDocument := func(id string) (*Document, error) { return db.getDocument(collectionName, id) }
+		var visitErr error
+		err = scanKeys(db.Storage, keyPrefix("doc", collectionName), cursor.After, func(id string, _ []byte) bool {
+			next, err := visit(id, getDocument)
+			visitErr = err
+			return next
+		})
+		if err != nil {
+			return nil, fmt.Errorf("failed to scan documents: %w", err)
+		}
+		if visitErr != nil {
+			return nil, visitErr
+		}
+	}
+	page.Seq = seq
+
+	if more {
+		cursor.Expires = expires.Unix()
+		if page.Cursor, err = encodeScrollCursor(cursor); err != nil {
+			return nil, err
+		}
+	} else if cursor.Snapshot != "" {
+		db.scrolls.release(cursor.Snapshot)
+	}
+	return page, nil
+}
+
+// IDPage is a page of the document IDs of a collection, Cursor is empty after
+// the last page
+type IDPage struct {
+	IDs    []string
+	Cursor string // last ID of the page, the next page starts after it
+}
+
+// ListDocumentIDs returns up to limit IDs of a collection's documents in ID
+// order, starting after cursor, archived documents included. The IDs are read
+// from the document keys, the documents are only decoded if the collection's
+// default filter or the caller's scope, see WithScopeFilter, hides some
+func (db *DB) ListDocumentIDs(collectionName string, limit int, cursor string, scope map[string]any) (*IDPage, error) {
+	collection, err := db.GetCollection(collectionName)
+	if err != nil {
+		return nil, err
+	}
+	if limit <= 0 {
+		limit = DefaultIDPageSize
+	}
+	if limit > MaxIDPageSize {
+		return nil, fmt.Errorf("%w: limit must be at most %d", errors.ErrInvalidParameter, MaxIDPageSize)
+	}
+	page := &IDPage{IDs: []string{}}
+	filter, ok := scopeFilter(collection.DefaultFilter, scope, nil)
+	if !ok {
+		return page, nil
+	}
+
+	var decodeErr error
+	err = scanKeys(db.Storage, keyPrefix("doc", collectionName), cursor, func(id string, data []byte) bool {
+		if len(page.IDs) == limit {
+			// a full page followed by more IDs
+			page.Cursor = page.IDs[limit-1]
+			return false
+		}
+		if len(filter) > 0 {
+			var metadata DocumentMetadata
+			if err := json.Unmarshal(data, &metadata); err != nil {
+				decodeErr = fmt.Errorf("failed to decode document %s: %w", id, err)
+				return false
+			}
+			if !matchFilter(metadata.Parameters, filter) {
+				return true
+			}
+		}
+		page.IDs = append(page.IDs, id)
+		return true
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to scan document IDs: %w", err)
+	}
+	if decodeErr != nil {
+		return nil, decodeErr
+	}
+	return page, nil
+}
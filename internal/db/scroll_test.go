@@ -0,0 +1,202 @@
+package db
+
+import (
+	"strconv"
+	"testing"
+	"time"
+
+	pkgerrors "oasisdb/pkg/errors"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestScrollDocuments(t *testing.T) {
+	db := newTestDBWithProvider(t, stubEmbeddingProvider{})
+	createTestCollection(t, db, "docs", 2)
+
+	docs := make([]*Document, 0, 7)
+	for i := 1; i <= 7; i++ {
+		tag := "odd"
+		if i%2 == 0 {
+			tag = "even"
+		}
+		docs = append(docs, &Document{
+			ID:         strconv.Itoa(i),
+			Vector:     []float32{float32(i), 1},
+			Dimension:  2,
+			Parameters: map[string]any{"tag": tag},
+		})
+	}
+	require.NoError(t, db.BatchUpsertDocuments("docs", docs))
+	require.NoError(t, db.DeleteDocument("docs", "5"))
+
+	// the filter is only sent with the first page
+	var ids []string
+	opts := ScrollOptions{Filter: map[string]any{"tag": "odd"}, Size: 2}
+	for pages := 0; ; pages++ {
+		require.Less(t, pages, 5, "scroll did not terminate")
+		page, err := db.ScrollDocuments("docs", opts)
+		require.NoError(t, err)
+		for _, doc := range page.Documents {
+			assert.Equal(t, "odd", doc.Parameters["tag"])
+			ids = append(ids, doc.ID)
+		}
+		if page.Cursor == "" {
+			break
+		}
+		opts = ScrollOptions{Cursor: page.Cursor, Size: 2}
+	}
+	assert.Equal(t, []string{"1", "3", "7"}, ids)
+
+	// archived documents are still scrolled
+	age(db, "docs", 48*time.Hour, "2")
+	_, err := db.ArchiveDocuments("docs", 24*time.Hour, nil)
+	require.NoError(t, err)
+	page, err := db.ScrollDocuments("docs", ScrollOptions{Filter: map[string]any{"tag": "even"}})
+	require.NoError(t, err)
+	require.Len(t, page.Documents, 3)
+	assert.Equal(t, "2", page.Documents[0].ID)
+	assert.Equal(t, []float32{2, 1}, page.Documents[0].Vector)
+	assert.Empty(t, page.Cursor)
+}
+
+func TestScrollDocumentsCursor(t *testing.T) {
+	db := newTestDBWithProvider(t, stubEmbeddingProvider{})
+	createTestCollection(t, db, "docs", 2)
+	require.NoError(t, db.BatchUpsertDocuments("docs", []*Document{
+		{ID: "1", Vector: []float32{1, 0}, Dimension: 2},
+		{ID: "2", Vector: []float32{0, 1}, Dimension: 2},
+	}))
+
+	_, err := db.ScrollDocuments("docs", ScrollOptions{Cursor: "not a cursor"})
+	assert.ErrorIs(t, err, pkgerrors.ErrInvalidParameter)
+
+	_, err = db.ScrollDocuments("docs", ScrollOptions{Size: MaxScrollSize + 1})
+	assert.ErrorIs(t, err, pkgerrors.ErrInvalidParameter)
+
+	expired, err := encodeScrollCursor(scrollCursor{After: "1", Expires: time.Now().Add(-time.Minute).Unix()})
+	require.NoError(t, err)
+	_, err = db.ScrollDocuments("docs", ScrollOptions{Cursor: expired})
+	assert.ErrorIs(t, err, pkgerrors.ErrInvalidParameter)
+
+	// a scroll starting after a document ID, e.g. to resume an export
+	page, err := db.ScrollDocuments("docs", ScrollOptions{After: "1"})
+	require.NoError(t, err)
+	require.Len(t, page.Documents, 1)
+	assert.Equal(t, "2", page.Documents[0].ID)
+	page, err = db.ScrollDocuments("docs", ScrollOptions{After: "0"})
+	require.NoError(t, err)
+	assert.Len(t, page.Documents, 2)
+
+	_, err = db.ScrollDocuments("missing", ScrollOptions{})
+	assert.ErrorIs(t, err, pkgerrors.ErrCollectionNotFound)
+}
+
+func TestScrollDocumentsSnapshot(t *testing.T) {
+	db := newTestDBWithProvider(t, stubEmbeddingProvider{})
+	createTestCollection(t, db, "docs", 2)
+	require.NoError(t, db.BatchUpsertDocuments("docs", []*Document{
+		{ID: "1", Vector: []float32{1, 0}, Dimension: 2, Parameters: map[string]any{"v": "old"}},
+		{ID: "2", Vector: []float32{0, 1}, Dimension: 2, Parameters: map[string]any{"v": "old"}},
+		{ID: "3", Vector: []float32{1, 1}, Dimension: 2, Parameters: map[string]any{"v": "old"}},
+	}))
+
+	page, err := db.ScrollDocuments("docs", ScrollOptions{Size: 1, Snapshot: true})
+	require.NoError(t, err)
+	require.Len(t, page.Documents, 1)
+	ids := []string{page.Documents[0].ID}
+	seq := page.Seq
+	assert.NotZero(t, seq)
+
+	// writes after the first page are not seen by the rest of the scroll
+	require.NoError(t, db.UpsertDocument("docs", &Document{
+		ID: "2", Vector: []float32{0, 1}, Dimension: 2, Parameters: map[string]any{"v": "new"},
+	}))
+	require.NoError(t, db.UpsertDocument("docs", &Document{
+		ID: "4", Vector: []float32{2, 2}, Dimension: 2, Parameters: map[string]any{"v": "new"},
+	}))
+	for cursor := page.Cursor; cursor != ""; cursor = page.Cursor {
+		page, err = db.ScrollDocuments("docs", ScrollOptions{Cursor: cursor, Size: 1})
+		require.NoError(t, err)
+		assert.Equal(t, seq, page.Seq, "every page reads the same snapshot")
+		for _, doc := range page.Documents {
+			assert.Equal(t, "old", doc.Parameters["v"])
+			ids = append(ids, doc.ID)
+		}
+	}
+	assert.Equal(t, []string{"1", "2", "3"}, ids)
+	assert.Empty(t, db.scrolls.pinned, "the last page releases the snapshot")
+
+	snapshot, err := db.SnapshotCollection("docs")
+	require.NoError(t, err)
+	defer snapshot.Release()
+	require.NoError(t, db.DeleteDocument("docs", "1"))
+	doc, err := snapshot.GetDocument("2")
+	require.NoError(t, err)
+	assert.Equal(t, "new", doc.Parameters["v"])
+	_, err = db.GetDocument("docs", "1")
+	assert.ErrorIs(t, err, pkgerrors.ErrDocumentNotFound)
+}
+
+func TestListDocumentIDs(t *testing.T) {
+	db := newTestDBWithProvider(t, stubEmbeddingProvider{})
+	createTestCollection(t, db, "docs", 2)
+	docs := make([]*Document, 0, 5)
+	for i := 1; i <= 5; i++ {
+		docs = append(docs, &Document{ID: strconv.Itoa(i), Vector: []float32{float32(i), 1}, Dimension: 2})
+	}
+	require.NoError(t, db.BatchUpsertDocuments("docs", docs))
+	require.NoError(t, db.DeleteDocument("docs", "3"))
+
+	var ids []string
+	cursor := ""
+	for pages := 0; ; pages++ {
+		require.Less(t, pages, 5, "listing did not terminate")
+		page, err := db.ListDocumentIDs("docs", 2, cursor, nil)
+		require.NoError(t, err)
+		ids = append(ids, page.IDs...)
+		if page.Cursor == "" {
+			break
+		}
+		cursor = page.Cursor
+	}
+	assert.Equal(t, []string{"1", "2", "4", "5"}, ids)
+
+	page, err := db.ListDocumentIDs("docs", 0, "", nil)
+	require.NoError(t, err)
+	assert.Len(t, page.IDs, 4)
+	assert.Empty(t, page.Cursor)
+
+	_, err = db.ListDocumentIDs("docs", MaxIDPageSize+1, "", nil)
+	assert.ErrorIs(t, err, pkgerrors.ErrInvalidParameter)
+	_, err = db.ListDocumentIDs("missing", 0, "", nil)
+	assert.ErrorIs(t, err, pkgerrors.ErrCollectionNotFound)
+
+	// documents hidden by the default filter aren't listed
+	_, err = db.CreateCollection(&CreateCollectionOptions{Name: "tenant", Dimension: 2, DefaultFilter: map[string]any{"tenant": "a"}})
+	require.NoError(t, err)
+	require.NoError(t, db.BatchUpsertDocuments("tenant", []*Document{
+		{ID: "1", Vector: []float32{1, 0}, Dimension: 2, Parameters: map[string]any{"tenant": "a"}},
+		{ID: "2", Vector: []float32{0, 1}, Dimension: 2, Parameters: map[string]any{"tenant": "b"}},
+		{ID: "3", Vector: []float32{1, 1}, Dimension: 2, Parameters: map[string]any{"tenant": "a"}},
+	}))
+	page, err = db.ListDocumentIDs("tenant", 1, "", nil)
+	require.NoError(t, err)
+	assert.Equal(t, []string{"1"}, page.IDs)
+	page, err = db.ListDocumentIDs("tenant", 1, page.Cursor, nil)
+	require.NoError(t, err)
+	assert.Equal(t, []string{"3"}, page.IDs)
+	assert.Empty(t, page.Cursor)
+
+	// so are those outside the caller's scope
+	page, err = db.ListDocumentIDs("docs", 0, "", map[string]any{"tenant": "a"})
+	require.NoError(t, err)
+	assert.Empty(t, page.IDs)
+	page, err = db.ListDocumentIDs("tenant", 0, "", map[string]any{"tenant": "b"})
+	require.NoError(t, err)
+	assert.Empty(t, page.IDs)
+	page, err = db.ListDocumentIDs("tenant", 0, "1", map[string]any{"tenant": "a"})
+	require.NoError(t, err)
+	assert.Equal(t, []string{"3"}, page.IDs)
+}
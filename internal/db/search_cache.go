@@ -0,0 +1,89 @@
+package db
+
+import (
+	"fmt"
+	"sync/atomic"
+	"time"
+
+	"oasisdb/internal/cache"
+	"oasisdb/pkg/errors"
+)
+
+// CacheSettings overrides the cache config for the search results of one
+// collection, unset fields fall back to the cache section of the config
+type CacheSettings struct {
+	Enabled    *bool `json:"enabled,omitempty"`
+	MaxEntries int   `json:"maxEntries,omitempty"` // max cached results
+	TTLSeconds int   `json:"ttlSeconds,omitempty"` // lifetime of cached results
+}
+
+func (s *CacheSettings) validate() error {
+	if s.MaxEntries < 0 {
+		return fmt.Errorf("%w: cache max entries must not be negative", errors.ErrInvalidParameter)
+	}
+	if s.TTLSeconds < 0 {
+		return fmt.Errorf("%w: cache ttl must not be negative", errors.ErrInvalidParameter)
+	}
+	return nil
+}
+
+// SearchCache returns the search result cache of a collection, created on
+// first use, or nil if the collection doesn't cache its results
+func (db *DB) SearchCache(collectionName string) (*cache.LRUCache, error) {
+	if c, ok := db.searchCaches.Load(collectionName); ok {
+		return c.(*cache.LRUCache), nil
+	}
+	collection, err := db.GetCollection(collectionName)
+	if err != nil {
+		return nil, err
+	}
+
+	conf := db.cacheConfig()
+	enabled, size, ttl := !conf.Disabled, conf.Size, conf.TTLSeconds
+	if s := collection.Cache; s != nil {
+		if s.Enabled != nil {
+			enabled = *s.Enabled
+		}
+		if s.MaxEntries > 0 {
+			size = s.MaxEntries
+		}
+		if s.TTLSeconds > 0 {
+			ttl = s.TTLSeconds
+		}
+	}
+	if !enabled {
+		return nil, nil
+	}
+	c, _ := db.searchCaches.LoadOrStore(collectionName, cache.NewLRUCacheWithTTL(size, time.Duration(ttl)*time.Second))
+	return c.(*cache.LRUCache), nil
+}
+
+// WriteVersion counts the changes to the search results of a collection.
+// Results are cached under the version read before they were searched, so a
+// search started after a write returned never gets results found before it,
+// even ones cached after the write cleared the cache
+func (db *DB) WriteVersion(collectionName string) uint64 {
+	if v, ok := db.writeVersions.Load(collectionName); ok {
+		return v.(*atomic.Uint64).Load()
+	}
+	return 0
+}
+
+// ClearSearchCache drops the cached search results of a collection and
+// advances its write version, writes call it once they are applied
+func (db *DB) ClearSearchCache(collectionName string) {
+	v, _ := db.writeVersions.LoadOrStore(collectionName, new(atomic.Uint64))
+	v.(*atomic.Uint64).Add(1)
+	if c, ok := db.searchCaches.Load(collectionName); ok {
+		c.(*cache.LRUCache).Clear()
+	}
+}
+
+// clearSearchCaches is ClearSearchCache for every collection, for writes
+// whose collections aren't known
+func (db *DB) clearSearchCaches() {
+	db.searchCaches.Range(func(name, _ any) bool {
+		db.ClearSearchCache(name.(string))
+		return true
+	})
+}
@@ -0,0 +1,225 @@
+package db
+
+import (
+	"fmt"
+	"sort"
+	"time"
+
+	"oasisdb/internal/index"
+	"oasisdb/pkg/errors"
+)
+
+const (
+	// MaxRangeResults caps the results of a range search without a limit
+	MaxRangeResults = 1000
+
+	// rangeSearchStartK is the first k of a range search without a limit,
+	// doubled while every result is still within the radius
+	rangeSearchStartK = 32
+
+	// exactRerankFactor is how many candidates per result are fetched from
+	// the index when they are reranked by exact distance
+	exactRerankFactor = 4
+)
+
+// SearchOption adjusts a single vector or document search
+type SearchOption func(*searchOptions)
+
+type searchOptions struct {
+	maxDistance *float32       // only results at most this far from the query
+	unbounded   bool           // range search without a limit
+	offset      int            // results skipped before the page
+	total       *int           // receives the number of results found
+	params      map[string]any // index search parameters of this query
+	exactRerank bool           // rerank the index candidates by exact distance
+	timings     *SearchTimings // receives where the search spent its time
+	scope       map[string]any // enforced besides the collection default filter
+}
+
+// SearchTimings splits the duration of a search between the index and the
+// documents fetched from storage for its results and filters
+type SearchTimings struct {
+	Index time.Duration
+	Fetch time.Duration
+}
+
+func newSearchOptions(opts []SearchOption) searchOptions {
+	var o searchOptions
+	for _, opt := range opts {
+		opt(&o)
+	}
+	return o
+}
+
+// WithMaxDistance turns a search into a range search returning only results
+// within distance of the query, with k <= 0 all of them up to MaxRangeResults
+func WithMaxDistance(distance float32) SearchOption {
+	return func(o *searchOptions) {
+		o.maxDistance = &distance
+	}
+}
+
+// WithOffset skips the first offset results, the index is searched for
+// offset + k results so consecutive pages don't overlap
+func WithOffset(offset int) SearchOption {
+	return func(o *searchOptions) {
+		o.offset = offset
+	}
+}
+
+// WithTotalCandidates stores the number of results found for the offset and
+// the page together in total, a total below offset + k means no later page
+func WithTotalCandidates(total *int) SearchOption {
+	return func(o *searchOptions) {
+		o.total = total
+	}
+}
+
+// WithTimings stores the time the search spent in the index and fetching
+// documents in timings
+func WithTimings(timings *SearchTimings) SearchOption {
+	return func(o *searchOptions) {
+		o.timings = timings
+	}
+}
+
+// WithSearchParams overrides index search parameters for this search only,
+// efsearch for HNSW and nprobe for IVF indices
+func WithSearchParams(params map[string]any) SearchOption {
+	return func(o *searchOptions) {
+		o.params = params
+	}
+}
+
+// WithExactRerank fetches more candidates from the index and orders them by
+// their exact distance to the query, computed from the stored vectors of
+// collections storing them and from the vectors held by the index otherwise.
+// It corrects the approximate distances of quantized indices and the misses
+// of HNSW at the cost of extra vector reads
+func WithExactRerank() SearchOption {
+	return func(o *searchOptions) {
+		o.exactRerank = true
+	}
+}
+
+// WithScopeFilter restricts the search to the documents matching filter, like
+// the default filter of the collection it can't be widened by the request
+// filter. The server scopes the requests of an API key with it
+func WithScopeFilter(filter map[string]any) SearchOption {
+	return func(o *searchOptions) {
+		o.scope = filter
+	}
+}
+
+// window returns how many results a search looks for, the offset results
+// skipped and the k returned. A range search without a limit returns
+// everything within its radius.
+func (o *searchOptions) window(k int) (int, error) {
+	if o.offset < 0 {
+		return 0, fmt.Errorf("%w: offset must not be negative", errors.ErrInvalidParameter)
+	}
+	if k <= 0 && o.maxDistance != nil {
+		o.unbounded = true
+		return MaxRangeResults, nil
+	}
+	return k + o.offset, nil
+}
+
+// recordTimings reports the durations of a search to WithTimings
+func (o *searchOptions) recordTimings(index, fetch time.Duration) {
+	if o.timings != nil {
+		o.timings.Index, o.timings.Fetch = index, fetch
+	}
+}
+
+// pageStart returns where the page starts in the n results found, and
+// reports n as the total
+func (o *searchOptions) pageStart(n int) int {
+	if o.total != nil {
+		*o.total = n
+	}
+	return min(o.offset, n)
+}
+
+// noResults is the outcome of a document search without results, nothing
+// within the radius of a range search is a valid answer
+func (o *searchOptions) noResults() ([]*Document, []float32, error) {
+	if o.total != nil {
+		*o.total = 0
+	}
+	if o.maxDistance != nil {
+		return []*Document{}, []float32{}, nil
+	}
+	return nil, nil, errors.ErrNoResultsFound
+}
+
+// rangeSearch searches the index for every vector within the radius, growing
+// k, and with it the HNSW ef, until the farthest result lies outside of it
+func rangeSearch(idx index.VectorIndex, query []float32, maxDistance float32, params map[string]any) (*index.SearchResult, error) {
+	for k := rangeSearchStartK; ; k *= 2 {
+		k = min(k, MaxRangeResults)
+		result, err := index.SearchWithParams(idx, query, k, params)
+		if err != nil {
+			return nil, err
+		}
+		n := len(result.IDs)
+		if n < k || k == MaxRangeResults || result.Distances[n-1] > maxDistance {
+			return result, nil
+		}
+	}
+}
+
+// searchWithTies searches for k results, and further while the results after
+// the k-th are at its distance, so ties at the cut are decided by ID rather
+// than by the traversal of the index
+func searchWithTies(idx index.VectorIndex, query []float32, k int, params map[string]any) (*index.SearchResult, error) {
+	for n := k + 1; ; n *= 2 {
+		result, err := index.SearchWithParams(idx, query, n, params)
+		if err != nil {
+			return nil, err
+		}
+		if len(result.IDs) == n && k > 0 && result.Distances[n-1] == result.Distances[k-1] {
+			continue
+		}
+		sortTies(result)
+		if len(result.IDs) > k {
+			result.IDs, result.Distances = result.IDs[:k], result.Distances[:k]
+		}
+		return result, nil
+	}
+}
+
+// sortTies orders results at the same distance by ID, so repeated searches
+// page through them in the same order
+func sortTies(result *index.SearchResult) {
+	order := make([]int, len(result.IDs))
+	for i := range order {
+		order[i] = i
+	}
+	sort.SliceStable(order, func(i, j int) bool {
+		a, b := order[i], order[j]
+		if result.Distances[a] != result.Distances[b] {
+			return result.Distances[a] < result.Distances[b]
+		}
+		return result.IDs[a] < result.IDs[b]
+	})
+	ids := make([]string, len(order))
+	distances := make([]float32, len(order))
+	for i, j := range order {
+		ids[i], distances[i] = result.IDs[j], result.Distances[j]
+	}
+	result.IDs, result.Distances = ids, distances
+}
+
+// withinDistance drops the results farther than maxDistance, results are
+// ordered by distance
+func withinDistance(result *index.SearchResult, maxDistance *float32) *index.SearchResult {
+	if maxDistance == nil {
+		return result
+	}
+	n := 0
+	for n < len(result.IDs) && result.Distances[n] <= *maxDistance {
+		n++
+	}
+	return &index.SearchResult{IDs: result.IDs[:n], Distances: result.Distances[:n]}
+}
@@ -0,0 +1,150 @@
+package db
+
+import (
+	"context"
+	"fmt"
+	"testing"
+
+	"oasisdb/internal/rerank"
+	pkgerrors "oasisdb/pkg/errors"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRangeSearch(t *testing.T) {
+	db := newTestDBWithProvider(t, stubEmbeddingProvider{})
+	createTestCollection(t, db, "points", 1)
+
+	// 100 points on a line, more than the first round of an unbounded search
+	docs := make([]*Document, 100)
+	for i := range docs {
+		docs[i] = &Document{ID: fmt.Sprint(i), Vector: []float32{float32(i)}, Parameters: map[string]any{"even": i%2 == 0}}
+	}
+	require.NoError(t, db.BatchUpsertDocuments("points", docs))
+	ctx := context.Background()
+
+	// distances are squared L2, 49 is a radius of 7
+	ids, distances, err := db.SearchVectors(ctx, "points", []float32{0}, 0, WithMaxDistance(49))
+	require.NoError(t, err)
+	assert.Equal(t, []string{"0", "1", "2", "3", "4", "5", "6", "7"}, ids)
+	assert.Equal(t, float32(49), distances[7])
+
+	ids, _, err = db.SearchVectors(ctx, "points", []float32{0}, 3, WithMaxDistance(49))
+	require.NoError(t, err)
+	assert.Equal(t, []string{"0", "1", "2"}, ids)
+
+	// the radius covers more than the first rounds of an unbounded search
+	ids, _, err = db.SearchVectors(ctx, "points", []float32{0}, 0, WithMaxDistance(80*80))
+	require.NoError(t, err)
+	assert.Len(t, ids, 81)
+
+	found, _, err := db.SearchDocuments(ctx, "points", &Document{Vector: []float32{50}}, 0,
+		map[string]any{"even": true}, WithMaxDistance(4))
+	require.NoError(t, err)
+	foundIDs := make([]string, len(found))
+	for i, doc := range found {
+		foundIDs[i] = doc.ID
+	}
+	require.Len(t, foundIDs, 3)
+	assert.Equal(t, "50", foundIDs[0])
+	assert.ElementsMatch(t, []string{"50", "48", "52"}, foundIDs)
+
+	// nothing within the radius is an empty answer rather than an error
+	found, distances, err = db.SearchDocuments(ctx, "points", &Document{Vector: []float32{500}}, 5, nil, WithMaxDistance(1))
+	require.NoError(t, err)
+	assert.Empty(t, found)
+	assert.Empty(t, distances)
+}
+
+func TestSearchPaging(t *testing.T) {
+	db := newTestDBWithProvider(t, stubEmbeddingProvider{})
+	createTestCollection(t, db, "points", 1)
+
+	// pairs of points at the same distance from the query
+	docs := make([]*Document, 0, 10)
+	for i := 1; i <= 5; i++ {
+		docs = append(docs,
+			&Document{ID: fmt.Sprintf("p%d", i), Vector: []float32{float32(i)}},
+			&Document{ID: fmt.Sprintf("n%d", i), Vector: []float32{float32(-i)}},
+		)
+	}
+	require.NoError(t, db.BatchUpsertDocuments("points", docs))
+	ctx := context.Background()
+
+	var pages []string
+	for offset := 0; offset < 10; offset += 3 {
+		var total int
+		ids, _, err := db.SearchVectors(ctx, "points", []float32{0}, 3, WithOffset(offset), WithTotalCandidates(&total))
+		require.NoError(t, err)
+		assert.Equal(t, min(offset+3, 10), total)
+		pages = append(pages, ids...)
+	}
+	// ties are ordered by ID so the pages neither overlap nor skip results
+	assert.Equal(t, []string{"n1", "p1", "n2", "p2", "n3", "p3", "n4", "p4", "n5", "p5"}, pages)
+
+	var total int
+	found, _, err := db.SearchDocuments(ctx, "points", &Document{Vector: []float32{0}}, 2, nil, WithOffset(3), WithTotalCandidates(&total))
+	require.NoError(t, err)
+	require.Len(t, found, 2)
+	assert.Equal(t, "p2", found[0].ID)
+	assert.Equal(t, "n3", found[1].ID)
+	assert.Equal(t, 5, total)
+
+	found, _, _, err = db.SearchDocumentsReranked(ctx, "points", &Document{Vector: []float32{0}}, 2, nil,
+		RerankOptions{Options: rerank.Options{Type: "mmr", Lambda: 1}}, WithOffset(2), WithTotalCandidates(&total))
+	require.NoError(t, err)
+	require.Len(t, found, 2)
+	assert.Equal(t, "n2", found[0].ID)
+	assert.Equal(t, 4, total)
+
+	_, _, err = db.SearchVectors(ctx, "points", []float32{0}, 3, WithOffset(-1))
+	assert.ErrorIs(t, err, pkgerrors.ErrInvalidParameter)
+}
+
+func TestExactRerank(t *testing.T) {
+	db := newTestDBWithProvider(t, stubEmbeddingProvider{})
+	ctx := context.Background()
+	for _, storeVectors := range []bool{false, true} {
+		name := fmt.Sprint("pq_", storeVectors)
+		// product quantized distances are approximate
+		_, err := db.CreateCollection(&CreateCollectionOptions{
+			Name:         name,
+			Dimension:    4,
+			IndexType:    "ivfpq",
+			Parameters:   map[string]string{"nlist": "1", "nprobe": "1", "m": "2"},
+			StoreVectors: storeVectors,
+		})
+		require.NoError(t, err)
+		docs := make([]*Document, 64)
+		vectors := make(map[string][]float32, len(docs))
+		for i := range docs {
+			vector := []float32{float32(i % 4), float32(i / 4 % 4), float32(i / 16), float32(i % 7)}
+			docs[i] = &Document{ID: fmt.Sprint(i), Vector: vector}
+			vectors[docs[i].ID] = vector
+		}
+		// the build trains the quantizer
+		require.NoError(t, db.BuildIndex(name, docs))
+
+		query := vectors["37"]
+		ids, distances, err := db.SearchVectors(ctx, name, query, 5, WithExactRerank())
+		require.NoError(t, err)
+		require.Len(t, ids, 5)
+		assert.Equal(t, "37", ids[0])
+		assert.Zero(t, distances[0])
+		for i, id := range ids {
+			var exact float32
+			for j, v := range vectors[id] {
+				exact += (v - query[j]) * (v - query[j])
+			}
+			assert.Equal(t, exact, distances[i], id)
+			if i > 0 {
+				assert.LessOrEqual(t, distances[i-1], distances[i])
+			}
+		}
+
+		found, _, err := db.SearchDocuments(ctx, name, &Document{Vector: query}, 1, nil, WithExactRerank())
+		require.NoError(t, err)
+		assert.Equal(t, "37", found[0].ID)
+	}
+}
@@ -0,0 +1,26 @@
+package db
+
+import (
+	"context"
+	"time"
+
+	"oasisdb/pkg/logger"
+)
+
+// logSlowSearch writes a search slower than the configured threshold to the
+// slow query log, with the index parameters that decide its cost
+func (db *DB) logSlowSearch(ctx context.Context, kind string, collection *Collection, k int, searchDuration, totalDuration time.Duration) {
+	threshold := time.Duration(db.slowQueryThreshold()) * time.Millisecond
+	if threshold <= 0 || totalDuration < threshold {
+		return
+	}
+	logger.Slow(ctx, "Slow search",
+		"kind", kind,
+		"collection", collection.Name,
+		"index_type", collection.IndexType,
+		"parameters", collection.Metadata,
+		"k", k,
+		"search_duration", searchDuration,
+		"total_duration", totalDuration,
+		"threshold", threshold)
+}
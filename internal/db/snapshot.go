@@ -0,0 +1,156 @@
+package db
+
+import (
+	"encoding/json"
+	"fmt"
+	"oasisdb/internal/storage"
+	"oasisdb/pkg/errors"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// CollectionSnapshot is a consistent view of the documents of a collection,
+// for backups and exports that run while writes go on. Document metadata is
+// read as of the snapshot. Vectors are read from the snapshot for collections
+// storing them, others read them from the live index, so a document whose
+// vector was deleted since is skipped. The snapshot must be released
+type CollectionSnapshot struct {
+	db           *DB
+	collection   string
+	storeVectors bool
+	snapshot     *storage.Snapshot
+	ids          []string
+}
+
+// SnapshotCollection pins the current state of a collection
+func (db *DB) SnapshotCollection(collectionName string) (*CollectionSnapshot, error) {
+	collection, err := db.GetCollection(collectionName)
+	if err != nil {
+		return nil, err
+	}
+	snapshot := db.Storage.Snapshot()
+	ids, err := scanDocumentIDs(snapshot, collectionName)
+	if err != nil {
+		snapshot.Release()
+		return nil, err
+	}
+	return &CollectionSnapshot{
+		db:           db,
+		collection:   collectionName,
+		storeVectors: collection.StoreVectors,
+		snapshot:     snapshot,
+		ids:          ids,
+	}, nil
+}
+
+// Seq returns the storage seq the snapshot reads at
+func (s *CollectionSnapshot) Seq() uint64 {
+	return s.snapshot.Seq()
+}
+
+// IDs returns the IDs of the documents in the snapshot in order
+func (s *CollectionSnapshot) IDs() []string {
+	return s.ids
+}
+
+// GetDocument returns a document as it was when the snapshot was taken,
+// without applying any filter
+func (s *CollectionSnapshot) GetDocument(id string) (*Document, error) {
+	data, exists, err := s.snapshot.GetScalar(documentKey(s.collection, id))
+	if err != nil {
+		return nil, err
+	}
+	if !exists || len(data) == 0 {
+		return nil, errors.ErrDocumentNotFound
+	}
+	var metadata DocumentMetadata
+	if err := json.Unmarshal(data, &metadata); err != nil {
+		return nil, err
+	}
+
+	if s.storeVectors {
+		data, exists, err := s.snapshot.GetScalar(vectorKey(s.collection, id))
+		if err != nil {
+			return nil, err
+		}
+		if exists && len(data) > 0 {
+			vector, err := decodeVector(data)
+			if err != nil {
+				return nil, err
+			}
+			return metadataToDoc(&metadata, vector), nil
+		}
+	}
+	vector, err := s.db.documentVector(s.collection, id)
+	if err != nil {
+		return nil, fmt.Errorf("%w: the vector of %s is gone since the snapshot", errors.ErrDocumentNotFound, id)
+	}
+	return metadataToDoc(&metadata, vector), nil
+}
+
+// Release unpins the snapshot, it may be called more than once
+func (s *CollectionSnapshot) Release() {
+	s.snapshot.Release()
+}
+
+// scrollSnapshots are the snapshots pinned by scrolls, a scroll that isn't
+// continued within its keep alive releases its snapshot
+type scrollSnapshots struct {
+	mu     sync.Mutex
+	next   uint64
+	pinned map[string]*scrollSnapshot
+}
+
+type scrollSnapshot struct {
+	snapshot *CollectionSnapshot
+	expires  time.Time
+}
+
+// pin keeps a snapshot for a scroll until expires and returns its id
+func (s *scrollSnapshots) pin(snapshot *CollectionSnapshot, expires time.Time) string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.pinned == nil {
+		s.pinned = make(map[string]*scrollSnapshot)
+	}
+	s.next++
+	id := strconv.FormatUint(s.next, 10)
+	s.pinned[id] = &scrollSnapshot{snapshot: snapshot, expires: expires}
+	return id
+}
+
+// get returns the snapshot of a scroll and extends it until expires
+func (s *scrollSnapshots) get(id string, expires time.Time) (*CollectionSnapshot, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	pinned, ok := s.pinned[id]
+	if !ok {
+		return nil, false
+	}
+	pinned.expires = expires
+	return pinned.snapshot, true
+}
+
+// release releases the snapshot of a scroll
+func (s *scrollSnapshots) release(id string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if pinned, ok := s.pinned[id]; ok {
+		pinned.snapshot.Release()
+		delete(s.pinned, id)
+	}
+}
+
+// expire releases the snapshots of scrolls that weren't continued in time,
+// all of them if now is zero
+func (s *scrollSnapshots) expire(now time.Time) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for id, pinned := range s.pinned {
+		if now.IsZero() || now.After(pinned.expires) {
+			pinned.snapshot.Release()
+			delete(s.pinned, id)
+		}
+	}
+}
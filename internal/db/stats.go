@@ -0,0 +1,177 @@
+package db
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"sync"
+	"time"
+)
+
+// CollectionStats are the counters of a collection, they are written with
+// its documents so reading them doesn't scan the collection
+type CollectionStats struct {
+	Documents int64     `json:"documents"` // stored documents, archived ones included
+	Vectors   int64     `json:"-"`         // vectors in the index, counted by the index itself
+	Bytes     int64     `json:"bytes"`     // document metadata and stored vectors, before compression
+	CreatedAt time.Time `json:"createdAt"` // zero for collections created before stats were kept
+	UpdatedAt time.Time `json:"updatedAt"` // last document write, zero if there was none
+	Version   uint64    `json:"version"`   // incremented by every write of the counters
+}
+
+func statsKey(collectionName string) []byte {
+	return []byte(fmt.Sprintf("stats:%s", collectionName))
+}
+
+// lockStats serializes the writes of a collection's counters with the
+// documents they count, the counters are read, modified and written back
+func (db *DB) lockStats(collectionName string) (unlock func()) {
+	mu, _ := db.statsLocks.LoadOrStore(collectionName, &sync.Mutex{})
+	mu.(*sync.Mutex).Lock()
+	return mu.(*sync.Mutex).Unlock
+}
+
+// CollectionStats returns the counters of a collection
+func (db *DB) CollectionStats(collectionName string) (*CollectionStats, error) {
+	if _, err := db.GetCollection(collectionName); err != nil {
+		return nil, err
+	}
+	unlock := db.lockStats(collectionName)
+	stats, err := db.loadStats(collectionName)
+	unlock()
+	if err != nil {
+		return nil, err
+	}
+	count, err := db.IndexManager.Count(collectionName)
+	if err != nil {
+		return nil, err
+	}
+	stats.Vectors = int64(count)
+	return stats, nil
+}
+
+// loadStats reads the counters of a collection, collections created before
+// counters were kept are counted once. The caller holds the stats lock
+func (db *DB) loadStats(collectionName string) (*CollectionStats, error) {
+	data, exists, err := db.Storage.GetScalar(statsKey(collectionName))
+	if err != nil {
+		return nil, err
+	}
+	if exists && len(data) > 0 {
+		var stats CollectionStats
+		if err := json.Unmarshal(data, &stats); err != nil {
+			return nil, fmt.Errorf("failed to decode stats of collection %s: %w", collectionName, err)
+		}
+		return &stats, nil
+	}
+
+	ids, err := db.documentIDs(collectionName)
+	if err != nil {
+		return nil, err
+	}
+	stats := &CollectionStats{}
+	for _, id := range ids {
+		doc, exists, err := db.Storage.GetScalar(documentKey(collectionName, id))
+		if err != nil {
+			return nil, err
+		}
+		if !exists {
+			continue
+		}
+		vector, _, err := db.Storage.GetScalar(vectorKey(collectionName, id))
+		if err != nil {
+			return nil, err
+		}
+		stats.Documents++
+		stats.Bytes += int64(len(doc) + len(vector))
+	}
+	return stats, nil
+}
+
+// statsWrite returns the counters of a collection once keys are written with
+// values, a nil value deletes its key. Only document and stored vector keys
+// are counted. The caller holds the stats lock and writes the returned key
+// and value after the documents
+func (db *DB) statsWrite(collectionName string, keys, values [][]byte) (key, value []byte, err error) {
+	stats, err := db.loadStats(collectionName)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	docPrefix := []byte(keyPrefix("doc", collectionName))
+	vectorPrefix := vectorKey(collectionName, "")
+	written := make(map[string][]byte, len(keys))
+	for i, key := range keys {
+		if bytes.HasPrefix(key, docPrefix) || bytes.HasPrefix(key, vectorPrefix) {
+			written[string(key)] = values[i]
+		}
+	}
+	for key, value := range written {
+		old, exists, err := db.Storage.GetScalar([]byte(key))
+		if err != nil {
+			return nil, nil, err
+		}
+		if exists {
+			stats.Bytes -= int64(len(old))
+		}
+		if value != nil {
+			stats.Bytes += int64(len(value))
+		}
+		if bytes.HasPrefix([]byte(key), docPrefix) {
+			switch {
+			case exists && value == nil:
+				stats.Documents--
+			case !exists && value != nil:
+				stats.Documents++
+			}
+		}
+	}
+
+	stats.UpdatedAt = time.Now()
+	stats.Version++
+	value, err = json.Marshal(stats)
+	if err != nil {
+		return nil, nil, err
+	}
+	return statsKey(collectionName), value, nil
+}
+
+// deleteCounted deletes the metadata of a document and writes the counters
+// without it and its stored vector, which the caller deletes next
+func (db *DB) deleteCounted(collectionName, id string) error {
+	docKey := documentKey(collectionName, id)
+	defer db.lockStats(collectionName)()
+	key, value, err := db.statsWrite(collectionName, [][]byte{docKey, vectorKey(collectionName, id)}, make([][]byte, 2))
+	if err != nil {
+		return err
+	}
+	if err := db.Storage.DeleteScalar(docKey); err != nil {
+		return err
+	}
+	return db.Storage.PutScalar(key, value)
+}
+
+// putStats writes the counters of a new collection
+func (db *DB) putStats(collectionName string) error {
+	now := time.Now()
+	data, err := json.Marshal(&CollectionStats{CreatedAt: now, UpdatedAt: now})
+	if err != nil {
+		return err
+	}
+	return db.Storage.PutScalar(statsKey(collectionName), data)
+}
+
+// staleStats reports whether value holds counters older than the stored
+// ones. A batch redone after a crash logged its counters, writes that
+// finished after it wrote newer ones
+func (db *DB) staleStats(collectionName string, value []byte) bool {
+	var logged, stored CollectionStats
+	if err := json.Unmarshal(value, &logged); err != nil {
+		return true
+	}
+	data, exists, err := db.Storage.GetScalar(statsKey(collectionName))
+	if err != nil || !exists || json.Unmarshal(data, &stored) != nil {
+		return false
+	}
+	return logged.Version <= stored.Version
+}
@@ -0,0 +1,31 @@
+package db
+
+import (
+	"context"
+
+	"oasisdb/internal/tracing"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// searchParams are the collection parameters that decide the cost of an
+// index search
+var searchParams = []string{"efSearch", "nprobe"}
+
+// startIndexSearchSpan traces an index search with its k and search
+// parameters
+func (db *DB) startIndexSearchSpan(ctx context.Context, collection *Collection, k, searchK int) (context.Context, trace.Span) {
+	attrs := []attribute.KeyValue{
+		attribute.String("collection", collection.Name),
+		attribute.String("index_type", collection.IndexType),
+		attribute.Int("k", k),
+		attribute.Int("search_k", searchK),
+	}
+	for _, name := range searchParams {
+		if v, ok := collection.Metadata[name]; ok {
+			attrs = append(attrs, attribute.String(name, v))
+		}
+	}
+	return tracing.Start(ctx, "index.Search", attrs...)
+}
@@ -0,0 +1,47 @@
+package db
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+)
+
+func TestSearchSpans(t *testing.T) {
+	recorder := tracetest.NewSpanRecorder()
+	original := otel.GetTracerProvider()
+	otel.SetTracerProvider(sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(recorder)))
+	defer otel.SetTracerProvider(original)
+
+	db := newTestDBWithProvider(t, stubEmbeddingProvider{
+		embedFn: func(string) ([]float64, error) { return []float64{1, 0}, nil },
+	})
+	createTestCollection(t, db, "docs", 2)
+	require.NoError(t, db.BatchUpsertDocuments("docs", []*Document{
+		{ID: "1", Vector: []float32{1, 0}},
+		{ID: "2", Vector: []float32{0, 1}},
+	}))
+
+	ctx, root := otel.Tracer("test").Start(context.Background(), "request")
+	_, _, err := db.SearchDocuments(ctx, "docs", &Document{
+		Parameters: map[string]any{"embedding": true, "text": "query"},
+	}, 2, nil)
+	require.NoError(t, err)
+	root.End()
+
+	spans := make(map[string]sdktrace.ReadOnlySpan)
+	counts := make(map[string]int)
+	for _, span := range recorder.Ended() {
+		spans[span.Name()] = span
+		counts[span.Name()]++
+		assert.Equal(t, root.SpanContext().TraceID(), span.SpanContext().TraceID(), span.Name())
+	}
+	assert.Equal(t, map[string]int{"request": 1, "embedding.Embed": 1, "index.Search": 1, "storage.MultiGet": 1, "lsm.Get": 2}, counts)
+	assert.Contains(t, spans["index.Search"].Attributes(), attribute.Int("k", 2))
+	assert.Equal(t, spans["storage.MultiGet"].SpanContext().SpanID(), spans["lsm.Get"].Parent().SpanID())
+}
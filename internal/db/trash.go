@@ -0,0 +1,185 @@
+package db
+
+import (
+	"encoding/json"
+	"fmt"
+	"sort"
+	"time"
+
+	"oasisdb/pkg/errors"
+	"oasisdb/pkg/logger"
+)
+
+// trashPurgeInterval is how often collections past their retention are purged
+const trashPurgeInterval = time.Minute
+
+// TrashedCollection is a deleted collection that can still be restored
+type TrashedCollection struct {
+	Name      string    `json:"name"`
+	DeletedAt time.Time `json:"deleted_at"`
+	PurgeAt   time.Time `json:"purge_at"`
+}
+
+// trashCollection marks a collection deleted, its documents and index are
+// kept for the retention period but its index is unloaded from memory
+func (db *DB) trashCollection(name string) error {
+	db.trashMu.Lock()
+	defer db.trashMu.Unlock()
+
+	collection, err := db.storedCollection(name)
+	if err != nil {
+		return fmt.Errorf("failed to get metadata: %w", err)
+	}
+	if collection == nil || collection.DeletedAt != nil {
+		return errors.ErrCollectionNotFound
+	}
+	now := time.Now()
+	collection.DeletedAt = &now
+	if err := db.putCollection(collection); err != nil {
+		return err
+	}
+	db.searchCaches.Delete(name)
+	if err := db.IndexManager.Unload(name); err != nil {
+		logger.Warn("Failed to unload index of deleted collection", "collection", name, "error", err)
+	}
+	logger.Info("Moved collection to the trash", "collection", name, "purge_at", db.purgeTime(collection))
+	return nil
+}
+
+// RestoreCollection brings back a collection from the trash, its index is
+// loaded again on first use
+func (db *DB) RestoreCollection(name string) (*Collection, error) {
+	db.trashMu.Lock()
+	defer db.trashMu.Unlock()
+
+	collection, err := db.storedCollection(name)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get metadata: %w", err)
+	}
+	if collection == nil {
+		return nil, errors.ErrCollectionNotFound
+	}
+	if collection.DeletedAt == nil {
+		return nil, fmt.Errorf("%w: collection %s isn't in the trash", errors.ErrInvalidParameter, name)
+	}
+	collection.DeletedAt = nil
+	if err := db.putCollection(collection); err != nil {
+		return nil, err
+	}
+	logger.Info("Restored collection from the trash", "collection", name)
+	return collection, nil
+}
+
+// ListTrash lists the deleted collections that can be restored, the ones
+// purged first come first
+func (db *DB) ListTrash() ([]TrashedCollection, error) {
+	var trashed []TrashedCollection
+	for _, name := range db.IndexManager.GetAllIndexNames() {
+		collection, err := db.storedCollection(name)
+		if err != nil {
+			return nil, err
+		}
+		if collection == nil || collection.DeletedAt == nil {
+			continue
+		}
+		trashed = append(trashed, TrashedCollection{
+			Name:      name,
+			DeletedAt: *collection.DeletedAt,
+			PurgeAt:   db.purgeTime(collection),
+		})
+	}
+	sort.Slice(trashed, func(i, j int) bool { return trashed[i].PurgeAt.Before(trashed[j].PurgeAt) })
+	return trashed, nil
+}
+
+// purgeTrash purges the collections whose retention ended before now and
+// returns their names
+func (db *DB) purgeTrash(now time.Time) ([]string, error) {
+	trashed, err := db.ListTrash()
+	if err != nil {
+		return nil, err
+	}
+	var purged []string
+	for _, t := range trashed {
+		if t.PurgeAt.After(now) {
+			break
+		}
+		if err := db.purgeExpired(t.Name, now); err != nil {
+			return purged, fmt.Errorf("collection %s: %w", t.Name, err)
+		}
+		purged = append(purged, t.Name)
+	}
+	return purged, nil
+}
+
+// purgeExpired purges a trashed collection unless it was restored meanwhile
+func (db *DB) purgeExpired(name string, now time.Time) error {
+	db.trashMu.Lock()
+	defer db.trashMu.Unlock()
+
+	collection, err := db.storedCollection(name)
+	if err != nil {
+		return err
+	}
+	if collection == nil || collection.DeletedAt == nil || db.purgeTime(collection).After(now) {
+		return nil
+	}
+	if err := db.purgeCollection(name); err != nil {
+		return err
+	}
+	logger.Info("Purged collection from the trash", "collection", name, "deleted_at", *collection.DeletedAt)
+	return nil
+}
+
+// runPurgeLoop purges expired collections from the trash until Close, the
+// indices of trashed collections loaded on startup are unloaded first.
+// Followers purge what the leader purged
+func (db *DB) runPurgeLoop() {
+	defer close(db.purgeDone)
+	if db.follower != nil {
+		<-db.stopCh
+		return
+	}
+	if trashed, err := db.ListTrash(); err == nil {
+		for _, t := range trashed {
+			if err := db.IndexManager.Unload(t.Name); err != nil {
+				logger.Warn("Failed to unload index of deleted collection", "collection", t.Name, "error", err)
+			}
+		}
+	}
+	ticker := time.NewTicker(trashPurgeInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+			if _, err := db.purgeTrash(time.Now()); err != nil {
+				logger.Error("Failed to purge the trash", "error", err)
+			}
+		case <-db.stopCh:
+			return
+		}
+	}
+}
+
+// purgeTime returns when a trashed collection is purged
+func (db *DB) purgeTime(collection *Collection) time.Time {
+	return collection.DeletedAt.Add(time.Duration(db.conf.Trash.RetentionHours) * time.Hour)
+}
+
+// inTrash reports whether a collection is deleted but not yet purged
+func (db *DB) inTrash(name string) bool {
+	collection, err := db.storedCollection(name)
+	return err == nil && collection != nil && collection.DeletedAt != nil
+}
+
+// putCollection saves the metadata of a collection
+func (db *DB) putCollection(collection *Collection) error {
+	data, err := json.Marshal(collection)
+	if err != nil {
+		return err
+	}
+	if err := db.Storage.PutScalar([]byte(fmt.Sprintf("collection:%s", collection.Name)), data); err != nil {
+		return fmt.Errorf("failed to save metadata: %w", err)
+	}
+	return nil
+}
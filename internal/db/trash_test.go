@@ -0,0 +1,80 @@
+package db
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"oasisdb/internal/config"
+	"oasisdb/pkg/errors"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestCollectionTrash(t *testing.T) {
+	dir := t.TempDir()
+	conf, err := config.NewConfig(dir)
+	require.NoError(t, err)
+	db, err := New(conf)
+	require.NoError(t, err)
+	require.NoError(t, db.Open())
+
+	createTestCollection(t, db, "docs", 2)
+	createTestCollection(t, db, "other", 2)
+	require.NoError(t, db.UpsertDocument("docs", &Document{ID: "1", Vector: []float32{1, 0}, Dimension: 2}))
+	require.NoError(t, db.DeleteCollection("docs"))
+
+	// a trashed collection is gone for readers and can't be deleted twice
+	_, err = db.GetCollection("docs")
+	assert.ErrorIs(t, err, errors.ErrCollectionNotFound)
+	names, err := db.ListCollections()
+	require.NoError(t, err)
+	assert.Equal(t, []string{"other"}, names)
+	assert.ErrorIs(t, db.DeleteCollection("docs"), errors.ErrCollectionNotFound)
+	_, err = db.CreateCollection(&CreateCollectionOptions{Name: "docs", Dimension: 2})
+	assert.ErrorIs(t, err, errors.ErrCollectionExists)
+	assert.Contains(t, err.Error(), "in the trash")
+
+	trashed, err := db.ListTrash()
+	require.NoError(t, err)
+	require.Len(t, trashed, 1)
+	assert.Equal(t, "docs", trashed[0].Name)
+	assert.Equal(t, 24*time.Hour, trashed[0].PurgeAt.Sub(trashed[0].DeletedAt))
+
+	// the trash survives a restart
+	db.Close()
+	db, err = New(conf)
+	require.NoError(t, err)
+	require.NoError(t, db.Open())
+	t.Cleanup(db.Close)
+
+	_, err = db.RestoreCollection("other")
+	assert.ErrorIs(t, err, errors.ErrInvalidParameter)
+	_, err = db.RestoreCollection("docs")
+	require.NoError(t, err)
+	ids, _, err := db.SearchVectors(context.Background(), "docs", []float32{1, 0}, 1)
+	require.NoError(t, err)
+	assert.Equal(t, []string{"1"}, ids)
+
+	// nothing is purged before the retention ends
+	require.NoError(t, db.DeleteCollection("docs"))
+	purged, err := db.purgeTrash(time.Now())
+	require.NoError(t, err)
+	assert.Empty(t, purged)
+	purged, err = db.purgeTrash(time.Now().Add(25 * time.Hour))
+	require.NoError(t, err)
+	assert.Equal(t, []string{"docs"}, purged)
+	_, err = db.RestoreCollection("docs")
+	assert.ErrorIs(t, err, errors.ErrCollectionNotFound)
+	assert.NotContains(t, db.IndexManager.GetAllIndexNames(), "docs")
+	createTestCollection(t, db, "docs", 2)
+
+	// without retention collections are purged right away
+	db.conf.Trash.RetentionHours = -1
+	require.NoError(t, db.DeleteCollection("docs"))
+	assert.NotContains(t, db.IndexManager.GetAllIndexNames(), "docs")
+	trashed, err = db.ListTrash()
+	require.NoError(t, err)
+	assert.Empty(t, trashed)
+}
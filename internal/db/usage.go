@@ -0,0 +1,48 @@
+package db
+
+import (
+	"fmt"
+	"strings"
+)
+
+// CollectionUsage reports the disk and memory used by a collection, for
+// capacity planning
+type CollectionUsage struct {
+	StorageBytes     int64 // SSTable blocks holding the collection's keys, approximate
+	IndexFileBytes   int64 // checkpointed index
+	WALBytes         int64 // index writes since the last checkpoint
+	IndexMemoryBytes int64 // estimated in-memory index footprint
+}
+
+// DiskBytes is the total disk usage of the collection
+func (u *CollectionUsage) DiskBytes() int64 {
+	return u.StorageBytes + u.IndexFileBytes + u.WALBytes
+}
+
+// CollectionUsage reports the disk and memory used by a collection, keys still
+// in the memtable are not on disk yet and not counted
+func (db *DB) CollectionUsage(name string) (*CollectionUsage, error) {
+	if _, err := db.GetCollection(name); err != nil {
+		return nil, err
+	}
+	indexUsage, err := db.IndexManager.Usage(name)
+	if err != nil {
+		return nil, err
+	}
+
+	usage := &CollectionUsage{
+		IndexFileBytes:   indexUsage.IndexFileBytes,
+		WALBytes:         indexUsage.WALBytes,
+		IndexMemoryBytes: indexUsage.MemoryBytes,
+	}
+	for _, key := range []string{fmt.Sprintf("collection:%s", name), fmt.Sprintf("access:%s", name), string(statsKey(name))} {
+		usage.StorageBytes += db.Storage.ApproximateSize([]byte(key), []byte(key+"\x00"))
+	}
+	for _, prefix := range []string{"doc", "vec", "archive", "idx"} {
+		start := keyPrefix(prefix, name)
+		// ';' follows ':', the end of the keys with the prefix
+		end := strings.TrimSuffix(start, ":") + ";"
+		usage.StorageBytes += db.Storage.ApproximateSize([]byte(start), []byte(end))
+	}
+	return usage, nil
+}
@@ -0,0 +1,133 @@
+package db
+
+import (
+	"bytes"
+	"compress/flate"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"math"
+
+	"oasisdb/internal/index"
+	"oasisdb/pkg/errors"
+	"oasisdb/pkg/logger"
+)
+
+// vectorKey stores a copy of a document's vector for collections created
+// with StoreVectors, so the index can be rebuilt if it and its WAL are lost
+func vectorKey(collectionName, id string) []byte {
+	return []byte(keyPrefix("vec", collectionName) + id)
+}
+
+// encodeVector packs a vector as little-endian float32s and compresses it
+func encodeVector(vector []float32) ([]byte, error) {
+	raw := make([]byte, 4*len(vector))
+	for i, v := range vector {
+		binary.LittleEndian.PutUint32(raw[4*i:], math.Float32bits(v))
+	}
+
+	var buf bytes.Buffer
+	w, err := flate.NewWriter(&buf, flate.BestSpeed)
+	if err != nil {
+		return nil, err
+	}
+	if _, err := w.Write(raw); err != nil {
+		return nil, err
+	}
+	if err := w.Close(); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+func decodeVector(data []byte) ([]float32, error) {
+	raw, err := io.ReadAll(flate.NewReader(bytes.NewReader(data)))
+	if err != nil {
+		return nil, fmt.Errorf("failed to decompress vector: %w", err)
+	}
+	if len(raw)%4 != 0 {
+		return nil, fmt.Errorf("corrupt vector of %d bytes", len(raw))
+	}
+	vector := make([]float32, len(raw)/4)
+	for i := range vector {
+		vector[i] = math.Float32frombits(binary.LittleEndian.Uint32(raw[4*i:]))
+	}
+	return vector, nil
+}
+
+// storedVector loads the scalar storage copy of a document's vector
+func (db *DB) storedVector(collectionName, id string) ([]float32, error) {
+	data, exists, err := db.Storage.GetScalar(vectorKey(collectionName, id))
+	if err != nil {
+		return nil, err
+	}
+	if !exists || len(data) == 0 {
+		return nil, errors.ErrDocumentNotFound
+	}
+	return decodeVector(data)
+}
+
+// deleteStoredVectors removes the vector copies of deleted documents
+func (db *DB) deleteStoredVectors(collectionName string, ids ...string) error {
+	for _, id := range ids {
+		if err := db.Storage.DeleteScalar(vectorKey(collectionName, id)); err != nil {
+			return fmt.Errorf("failed to delete stored vector %s: %w", id, err)
+		}
+	}
+	return nil
+}
+
+// RebuildIndex recreates the index of a collection created with StoreVectors
+// from the vectors in scalar storage and returns the number of documents
+// indexed, archived documents stay out of the index. The new index is built
+// alongside the current one, which serves searches and writes until the new
+// one replaces it
+func (db *DB) RebuildIndex(collectionName string) (int, error) {
+	collection, err := db.GetCollection(collectionName)
+	if err != nil {
+		return 0, err
+	}
+	if !collection.StoreVectors {
+		return 0, fmt.Errorf("%w: collection %s does not store vectors", errors.ErrInvalidParameter, collectionName)
+	}
+
+	indexConf := db.indexConfig(collection.IndexType, collection.Dimension, collection.Metadata)
+	count, err := db.IndexManager.Reindex(collectionName, indexConf, func(index.VectorIndex) ([]string, [][]float32, error) {
+		return db.loadStoredVectors(collectionName)
+	})
+	if err != nil {
+		return 0, fmt.Errorf("failed to rebuild index: %w", err)
+	}
+
+	db.ClearSearchCache(collectionName)
+	logger.Info("Rebuilt index from stored vectors", "collection", collectionName, "count", count)
+	return count, nil
+}
+
+// loadStoredVectors loads the stored vectors of the documents of a collection
+// that aren't archived
+func (db *DB) loadStoredVectors(collectionName string) ([]string, [][]float32, error) {
+	var ids []string
+	var vectors [][]float32
+	var decodeErr error
+	err := scanKeys(db.Storage, keyPrefix("vec", collectionName), "", func(id string, data []byte) bool {
+		if db.isArchived(collectionName, id) {
+			return true
+		}
+		vector, err := decodeVector(data)
+		if err != nil {
+			decodeErr = fmt.Errorf("failed to load stored vector %s: %w", id, err)
+			return false
+		}
+		ids = append(ids, id)
+		vectors = append(vectors, vector)
+		return true
+	})
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to scan stored vectors: %w", err)
+	}
+	if decodeErr != nil {
+		return nil, nil, decodeErr
+	}
+	return ids, vectors, nil
+}
@@ -0,0 +1,83 @@
+package db
+
+import (
+	"context"
+	"testing"
+
+	pkgerrors "oasisdb/pkg/errors"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestEncodeVector(t *testing.T) {
+	vector := []float32{1.5, -2, 0, 3.25}
+	data, err := encodeVector(vector)
+	require.NoError(t, err)
+	decoded, err := decodeVector(data)
+	require.NoError(t, err)
+	assert.Equal(t, vector, decoded)
+
+	_, err = decodeVector([]byte("not flate"))
+	assert.Error(t, err)
+}
+
+func TestStoreVectorsRebuildIndex(t *testing.T) {
+	db := newTestDBWithProvider(t, stubEmbeddingProvider{})
+	_, err := db.CreateCollection(&CreateCollectionOptions{
+		Name:         "docs",
+		Dimension:    2,
+		IndexType:    "hnsw",
+		StoreVectors: true,
+	})
+	require.NoError(t, err)
+
+	require.NoError(t, db.UpsertDocument("docs", &Document{ID: "1", Vector: []float32{1, 0}, Dimension: 2}))
+	require.NoError(t, db.BatchUpsertDocuments("docs", []*Document{
+		{ID: "2", Vector: []float32{0, 1}, Dimension: 2},
+		{ID: "3", Vector: []float32{1, 1}, Dimension: 2},
+	}))
+	require.NoError(t, db.DeleteDocument("docs", "3"))
+
+	vector, err := db.storedVector("docs", "2")
+	require.NoError(t, err)
+	assert.Equal(t, []float32{0, 1}, vector)
+	_, err = db.storedVector("docs", "3")
+	assert.ErrorIs(t, err, pkgerrors.ErrDocumentNotFound)
+
+	// lose the indexed vectors, reads fall back to the stored copies
+	require.NoError(t, db.IndexManager.DeleteVector("docs", "1"))
+	doc, err := db.GetDocument("docs", "1")
+	require.NoError(t, err)
+	assert.Equal(t, []float32{1, 0}, doc.Vector)
+
+	count, err := db.RebuildIndex("docs")
+	require.NoError(t, err)
+	assert.Equal(t, 2, count)
+
+	results, _, err := db.SearchDocuments(context.Background(), "docs", &Document{Vector: []float32{1, 0}}, 1, nil)
+	require.NoError(t, err)
+	require.Len(t, results, 1)
+	assert.Equal(t, "1", results[0].ID)
+
+	// the stored vectors are found by their keys, not by the access records
+	data, err := encodeVector([]float32{-1, 0})
+	require.NoError(t, err)
+	require.NoError(t, db.Storage.PutScalar(vectorKey("docs", "4"), data))
+	count, err = db.RebuildIndex("docs")
+	require.NoError(t, err)
+	assert.Equal(t, 3, count)
+	vector, err = db.IndexManager.GetVector("docs", "4")
+	require.NoError(t, err)
+	assert.Equal(t, []float32{-1, 0}, vector)
+}
+
+func TestRebuildIndexRequiresStoredVectors(t *testing.T) {
+	db := newTestDBWithProvider(t, stubEmbeddingProvider{})
+	createTestCollection(t, db, "docs", 2)
+
+	_, err := db.RebuildIndex("docs")
+	assert.ErrorIs(t, err, pkgerrors.ErrInvalidParameter)
+	_, err = db.RebuildIndex("missing")
+	assert.ErrorIs(t, err, pkgerrors.ErrCollectionNotFound)
+}
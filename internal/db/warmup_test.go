@@ -0,0 +1,31 @@
+package db
+
+import (
+	"context"
+	"testing"
+
+	pkgerrors "oasisdb/pkg/errors"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestWarmup(t *testing.T) {
+	db := newTestDBWithProvider(t, stubEmbeddingProvider{})
+	createTestCollection(t, db, "b", 2)
+	createTestCollection(t, db, "a", 3)
+	require.NoError(t, db.BatchUpsertDocuments("a", []*Document{
+		{ID: "1", Vector: []float32{1, 0, 0}},
+		{ID: "2", Vector: []float32{0, 1, 0}},
+	}))
+
+	report, err := db.Warmup(context.Background(), 3)
+	require.NoError(t, err)
+	assert.Equal(t, []CollectionWarmup{
+		{Name: "a", Searches: 3},
+		{Name: "b", Searches: 3},
+	}, report.Collections)
+
+	_, err = db.Warmup(context.Background(), -1)
+	assert.ErrorIs(t, err, pkgerrors.ErrInvalidParameter)
+}
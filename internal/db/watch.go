@@ -0,0 +1,275 @@
+package db
+
+import (
+	"bufio"
+	"encoding/json"
+	stderrors "errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"oasisdb/internal/chunk"
+	"oasisdb/pkg/errors"
+	"oasisdb/pkg/logger"
+)
+
+// watchSettle is how long a file must stay unmodified before it is ingested,
+// files still being written wait for a later scan
+const watchSettle = 2 * time.Second
+
+// watchFileKey is the scalar key recording the ingestion of a watched file
+func watchFileKey(path string) []byte {
+	return []byte("watch:" + path)
+}
+
+// watchedFile records what a watched file was ingested as, it is ingested
+// again once its modification time or size change
+type watchedFile struct {
+	ModTime time.Time `json:"mod_time"`
+	Size    int64     `json:"size"`
+	IDs     []string  `json:"ids,omitempty"`   // documents upserted from the file
+	Error   string    `json:"error,omitempty"` // why the file was rejected
+}
+
+// WatchStatus describes the ingestion of the files of the watch directory
+// since the database was opened
+type WatchStatus struct {
+	Dir        string     `json:"dir"`
+	Collection string     `json:"collection"`
+	Files      int        `json:"files"`     // files ingested
+	Documents  int        `json:"documents"` // chunks upserted from them
+	Failed     int        `json:"failed"`    // files rejected, retried once changed
+	LastScanAt *time.Time `json:"last_scan_at,omitempty"`
+	LastError  string     `json:"last_error,omitempty"`
+}
+
+// watchStats guards the WatchStatus of the watch loop
+type watchStats struct {
+	mu     sync.Mutex
+	status WatchStatus
+}
+
+// WatchStatus returns the progress of the watch directory ingestion, false
+// if no directory is watched
+func (db *DB) WatchStatus() (WatchStatus, bool) {
+	if !db.watching() {
+		return WatchStatus{}, false
+	}
+	db.watch.mu.Lock()
+	defer db.watch.mu.Unlock()
+	status := db.watch.status
+	status.Dir, status.Collection = db.conf.Watch.Dir, db.conf.Watch.Collection
+	return status, true
+}
+
+// watching reports whether this server ingests the watch directory, followers
+// and raft nodes get the documents replicated from the node ingesting them
+func (db *DB) watching() bool {
+	return db.conf.Watch.Dir != "" && db.follower == nil && db.conf.Consensus.NodeID == ""
+}
+
+func (db *DB) runWatchLoop() {
+	defer db.background.Done()
+	logger.Info("Watching directory for ingestion", "dir", db.conf.Watch.Dir, "collection", db.conf.Watch.Collection)
+	ticker := time.NewTicker(time.Duration(db.conf.Watch.IntervalSeconds) * time.Second)
+	defer ticker.Stop()
+	for {
+		if err := db.scanWatchDir(time.Now()); err != nil {
+			logger.Error("Failed to scan watch directory", "dir", db.conf.Watch.Dir, "error", err)
+		}
+		select {
+		case <-ticker.C:
+		case <-db.stopCh:
+			return
+		}
+	}
+}
+
+// scanWatchDir ingests the new and changed files of the watch directory that
+// were last modified before now minus watchSettle
+func (db *DB) scanWatchDir(now time.Time) (err error) {
+	defer func() {
+		db.watch.mu.Lock()
+		db.watch.status.LastScanAt = &now
+		if err != nil {
+			db.watch.status.LastError = err.Error()
+		}
+		db.watch.mu.Unlock()
+	}()
+
+	if _, err := db.GetCollection(db.conf.Watch.Collection); err != nil {
+		return fmt.Errorf("collection %s: %w", db.conf.Watch.Collection, err)
+	}
+	dir := db.conf.Watch.Dir
+	return filepath.WalkDir(dir, func(path string, entry fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if path != dir && strings.HasPrefix(entry.Name(), ".") {
+			if entry.IsDir() {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		if entry.IsDir() || watchSplitter(path) == "" {
+			return nil
+		}
+		info, err := entry.Info()
+		if err != nil {
+			return err
+		}
+		if now.Sub(info.ModTime()) < watchSettle {
+			return nil
+		}
+		select {
+		case <-db.stopCh:
+			return filepath.SkipAll
+		default:
+		}
+		rel, err := filepath.Rel(dir, path)
+		if err != nil {
+			return err
+		}
+		return db.ingestWatchedFile(path, filepath.ToSlash(rel), info)
+	})
+}
+
+// watchSplitter returns the chunk splitter of a file type the watch directory
+// ingests, empty for files it skips
+func watchSplitter(path string) string {
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".txt", ".jsonl":
+		return chunk.SentenceSplitter
+	case ".md", ".markdown":
+		return chunk.MarkdownSplitter
+	}
+	return ""
+}
+
+// ingestWatchedFile ingests a file unless it was ingested unchanged, the
+// documents of a previous version missing from the new one are deleted. A
+// file the collection rejects is recorded as failed, other errors are
+// retried on the next scan
+func (db *DB) ingestWatchedFile(path, rel string, info fs.FileInfo) error {
+	key := watchFileKey(rel)
+	var previous watchedFile
+	value, ok, err := db.Storage.GetScalar(key)
+	if err != nil {
+		return err
+	}
+	if ok {
+		if err := json.Unmarshal(value, &previous); err != nil {
+			return fmt.Errorf("failed to unmarshal watched file %s: %w", rel, err)
+		}
+		if previous.ModTime.Equal(info.ModTime()) && previous.Size == info.Size() {
+			return nil
+		}
+	}
+
+	record := watchedFile{ModTime: info.ModTime(), Size: info.Size(), IDs: previous.IDs}
+	ids, err := db.ingestFile(path, rel, info)
+	switch {
+	case stderrors.Is(err, errors.ErrInvalidParameter) || stderrors.Is(err, errors.ErrEmptyParameter):
+		record.Error = err.Error()
+		logger.Warn("Rejected watched file", "file", rel, "error", err)
+		db.watch.mu.Lock()
+		db.watch.status.Failed++
+		db.watch.status.LastError = fmt.Sprintf("%s: %v", rel, err)
+		db.watch.mu.Unlock()
+	case err != nil:
+		return fmt.Errorf("failed to ingest %s: %w", rel, err)
+	default:
+		for _, id := range previous.IDs {
+			if slices.Contains(ids, id) {
+				continue
+			}
+			if err := db.DeleteDocument(db.conf.Watch.Collection, id); err != nil && !stderrors.Is(err, errors.ErrDocumentNotFound) {
+				return fmt.Errorf("failed to delete stale document %s of %s: %w", id, rel, err)
+			}
+		}
+		record.IDs = ids
+		logger.Info("Ingested watched file", "file", rel, "documents", len(ids))
+		db.watch.mu.Lock()
+		db.watch.status.Files++
+		db.watch.status.Documents += len(ids)
+		db.watch.mu.Unlock()
+	}
+
+	value, err = json.Marshal(record)
+	if err != nil {
+		return fmt.Errorf("failed to marshal watched file %s: %w", rel, err)
+	}
+	return db.Storage.PutScalar(key, value)
+}
+
+// ingestFile chunks and upserts a file with its provenance, text and
+// markdown files are one document named after their path, every line of a
+// JSON lines file is one with its "text", "id" and other fields
+func (db *DB) ingestFile(path, rel string, info fs.FileInfo) ([]string, error) {
+	chunking := chunk.Options{
+		Size:     db.conf.Watch.ChunkSize,
+		Overlap:  db.conf.Watch.ChunkOverlap,
+		Splitter: watchSplitter(path),
+	}
+	provenance := map[string]any{
+		"source_file":        rel,
+		"source_modified_at": info.ModTime().UTC().Format(time.RFC3339),
+	}
+	if strings.ToLower(filepath.Ext(path)) != ".jsonl" {
+		text, err := os.ReadFile(path)
+		if err != nil {
+			return nil, err
+		}
+		return db.IngestDocument(db.conf.Watch.Collection, IngestOptions{
+			ID:         rel,
+			Text:       string(text),
+			Parameters: provenance,
+			Chunking:   chunking,
+		})
+	}
+
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+	var ids []string
+	scanner := bufio.NewScanner(file)
+	scanner.Buffer(nil, 64*1024*1024)
+	for line := 1; scanner.Scan(); line++ {
+		if strings.TrimSpace(scanner.Text()) == "" {
+			continue
+		}
+		var fields map[string]any
+		if err := json.Unmarshal(scanner.Bytes(), &fields); err != nil {
+			return nil, fmt.Errorf("%w: line %d is not a JSON object: %v", errors.ErrInvalidParameter, line, err)
+		}
+		text, _ := fields["text"].(string)
+		id, _ := fields["id"].(string)
+		if id == "" {
+			id = fmt.Sprintf("%s:%d", rel, line)
+		}
+		delete(fields, "text")
+		delete(fields, "id")
+		for k, v := range provenance {
+			fields[k] = v
+		}
+		fields["source_line"] = line
+		lineIDs, err := db.IngestDocument(db.conf.Watch.Collection, IngestOptions{
+			ID:         id,
+			Text:       text,
+			Parameters: fields,
+			Chunking:   chunking,
+		})
+		if err != nil {
+			return nil, fmt.Errorf("line %d: %w", line, err)
+		}
+		ids = append(ids, lineIDs...)
+	}
+	return ids, scanner.Err()
+}
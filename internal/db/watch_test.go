@@ -0,0 +1,78 @@
+package db
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	pkgerrors "oasisdb/pkg/errors"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestScanWatchDir(t *testing.T) {
+	db := newTestDBWithProvider(t, stubEmbeddingProvider{
+		embedFn: func(text string) ([]float64, error) {
+			return []float64{float64(len(text)), 1}, nil
+		},
+	})
+	createTestCollection(t, db, "drop", 2)
+	dir := t.TempDir()
+	db.conf.Watch.Dir, db.conf.Watch.Collection, db.conf.Watch.ChunkSize = dir, "drop", 25
+
+	old := time.Now().Add(-time.Minute)
+	write := func(name, content string, modTime time.Time) {
+		path := filepath.Join(dir, name)
+		require.NoError(t, os.MkdirAll(filepath.Dir(path), 0755))
+		require.NoError(t, os.WriteFile(path, []byte(content), 0644))
+		require.NoError(t, os.Chtimes(path, modTime, modTime))
+	}
+	write("notes/guide.txt", "First sentence here. Second sentence here. Third sentence here.", old)
+	write("faq.jsonl", `{"id": "q1", "text": "How do I ingest?", "lang": "en"}`+"\n\n"+`{"text": "Drop files here."}`+"\n", old)
+	write("broken.jsonl", "not json\n", old)
+	write("image.png", "skipped", old)
+	write(".hidden.txt", "skipped", old)
+	write("fresh.md", "# Still being written", time.Now())
+
+	require.NoError(t, db.scanWatchDir(time.Now()))
+	doc, err := db.GetDocument("drop", "notes/guide.txt#1")
+	require.NoError(t, err)
+	assert.Equal(t, "Second sentence here.", doc.Parameters["text"])
+	assert.Equal(t, "notes/guide.txt", doc.Parameters["source_file"])
+	assert.Equal(t, old.UTC().Format(time.RFC3339), doc.Parameters["source_modified_at"])
+	doc, err = db.GetDocument("drop", "q1#0")
+	require.NoError(t, err)
+	assert.Equal(t, "en", doc.Parameters["lang"])
+	assert.EqualValues(t, 1, doc.Parameters["source_line"])
+	_, err = db.GetDocument("drop", "faq.jsonl:3#0")
+	require.NoError(t, err)
+	_, err = db.GetDocument("drop", ".hidden.txt#0")
+	assert.ErrorIs(t, err, pkgerrors.ErrDocumentNotFound)
+	_, err = db.GetDocument("drop", "fresh.md#0")
+	assert.ErrorIs(t, err, pkgerrors.ErrDocumentNotFound)
+
+	status, ok := db.WatchStatus()
+	require.True(t, ok)
+	assert.Equal(t, 2, status.Files)
+	assert.Equal(t, 5, status.Documents)
+	assert.Equal(t, 1, status.Failed)
+	assert.Contains(t, status.LastError, "broken.jsonl")
+	assert.NotNil(t, status.LastScanAt)
+
+	// unchanged files aren't ingested again, a changed one replaces its documents
+	write("notes/guide.txt", "Only one sentence now.", old.Add(time.Second))
+	require.NoError(t, db.scanWatchDir(time.Now().Add(time.Minute)))
+	status, _ = db.WatchStatus()
+	assert.Equal(t, 4, status.Files)
+	assert.Equal(t, 1, status.Failed)
+	doc, err = db.GetDocument("drop", "notes/guide.txt#0")
+	require.NoError(t, err)
+	assert.Equal(t, "Only one sentence now.", doc.Parameters["text"])
+	_, err = db.GetDocument("drop", "notes/guide.txt#1")
+	assert.ErrorIs(t, err, pkgerrors.ErrDocumentNotFound)
+
+	db.conf.Watch.Collection = "missing"
+	assert.ErrorIs(t, db.scanWatchDir(time.Now()), pkgerrors.ErrCollectionNotFound)
+}
@@ -0,0 +1,129 @@
+package embedding
+
+import (
+	"fmt"
+	"sync"
+	"time"
+)
+
+const (
+	DefaultBatchSize   = 16
+	DefaultConcurrency = 4
+)
+
+// BatchOptions controls how a Batcher splits and throttles provider calls
+type BatchOptions struct {
+	BatchSize   int     // texts per EmbedBatch call
+	Concurrency int     // max in-flight EmbedBatch calls
+	RateLimit   float64 // EmbedBatch calls per second, 0 means unlimited
+	Burst       int     // calls allowed at once before throttling, defaults to Concurrency
+}
+
+// Batcher embeds many texts through EmbedBatch with bounded concurrency and
+// a shared rate limit, so bulk loads don't hammer the provider
+type Batcher struct {
+	provider EmbeddingProvider
+	opts     BatchOptions
+	limiter  *RateLimiter
+}
+
+// NewBatcher wraps provider, zero options fall back to defaults
+func NewBatcher(provider EmbeddingProvider, opts BatchOptions) *Batcher {
+	if opts.BatchSize <= 0 {
+		opts.BatchSize = DefaultBatchSize
+	}
+	if opts.Concurrency <= 0 {
+		opts.Concurrency = DefaultConcurrency
+	}
+	if opts.Burst <= 0 {
+		opts.Burst = opts.Concurrency
+	}
+	return &Batcher{
+		provider: provider,
+		opts:     opts,
+		limiter:  NewRateLimiter(opts.RateLimit, opts.Burst),
+	}
+}
+
+// EmbedAll embeds texts and returns one vector and one error per text, a
+// failed batch marks every text in it as failed without affecting the others
+func (b *Batcher) EmbedAll(texts []string) ([][]float64, []error) {
+	vectors := make([][]float64, len(texts))
+	errs := make([]error, len(texts))
+
+	sem := make(chan struct{}, b.opts.Concurrency)
+	var wg sync.WaitGroup
+	for start := 0; start < len(texts); start += b.opts.BatchSize {
+		end := min(start+b.opts.BatchSize, len(texts))
+
+		sem <- struct{}{}
+		wg.Add(1)
+		go func(start, end int) {
+			defer wg.Done()
+			defer func() { <-sem }()
+
+			b.limiter.Wait()
+			embeddings, err := b.provider.EmbedBatch(texts[start:end])
+			if err == nil && len(embeddings) != end-start {
+				err = fmt.Errorf("expected %d embeddings, got %d", end-start, len(embeddings))
+			}
+			for i := start; i < end; i++ {
+				if err != nil {
+					errs[i] = err
+				} else {
+					vectors[i] = embeddings[i-start]
+				}
+			}
+		}(start, end)
+	}
+	wg.Wait()
+	return vectors, errs
+}
+
+// RateLimiter is a token bucket refilled at rate tokens per second, a nil
+// limiter never blocks
+type RateLimiter struct {
+	mu     sync.Mutex
+	rate   float64
+	burst  float64
+	tokens float64
+	last   time.Time
+}
+
+// NewRateLimiter returns nil when rate is not positive
+func NewRateLimiter(rate float64, burst int) *RateLimiter {
+	if rate <= 0 {
+		return nil
+	}
+	if burst <= 0 {
+		burst = 1
+	}
+	return &RateLimiter{
+		rate:   rate,
+		burst:  float64(burst),
+		tokens: float64(burst),
+		last:   time.Now(),
+	}
+}
+
+// Wait blocks until a token is available and takes it
+func (r *RateLimiter) Wait() {
+	if r == nil {
+		return
+	}
+	r.mu.Lock()
+	now := time.Now()
+	r.tokens = min(r.burst, r.tokens+now.Sub(r.last).Seconds()*r.rate)
+	r.last = now
+	r.tokens--
+	var delay time.Duration
+	if r.tokens < 0 {
+		// reserve the token now and sleep until it has been refilled
+		delay = time.Duration(-r.tokens / r.rate * float64(time.Second))
+	}
+	r.mu.Unlock()
+
+	if delay > 0 {
+		time.Sleep(delay)
+	}
+}
@@ -0,0 +1,91 @@
+package embedding
+
+import (
+	"fmt"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+type countingProvider struct {
+	mu       sync.Mutex
+	batches  [][]string
+	inFlight atomic.Int32
+	maxSeen  atomic.Int32
+	failOn   string
+}
+
+func (p *countingProvider) Embed(text string) ([]float64, error) {
+	return []float64{float64(len(text))}, nil
+}
+
+func (p *countingProvider) EmbedBatch(texts []string) ([][]float64, error) {
+	n := p.inFlight.Add(1)
+	defer p.inFlight.Add(-1)
+	for {
+		seen := p.maxSeen.Load()
+		if n <= seen || p.maxSeen.CompareAndSwap(seen, n) {
+			break
+		}
+	}
+	time.Sleep(5 * time.Millisecond)
+
+	p.mu.Lock()
+	p.batches = append(p.batches, texts)
+	p.mu.Unlock()
+
+	out := make([][]float64, len(texts))
+	for i, text := range texts {
+		if text == p.failOn {
+			return nil, fmt.Errorf("cannot embed %q", text)
+		}
+		out[i], _ = p.Embed(text)
+	}
+	return out, nil
+}
+
+func TestBatcherEmbedAll(t *testing.T) {
+	provider := &countingProvider{failOn: "bad"}
+	batcher := NewBatcher(provider, BatchOptions{BatchSize: 2, Concurrency: 2})
+
+	texts := []string{"a", "bb", "ccc", "bad", "eeeee"}
+	vectors, errs := batcher.EmbedAll(texts)
+
+	assert.Len(t, provider.batches, 3)
+	assert.LessOrEqual(t, provider.maxSeen.Load(), int32(2))
+
+	// the batch holding "bad" fails as a whole, the others succeed
+	assert.Equal(t, []float64{1}, vectors[0])
+	assert.Equal(t, []float64{2}, vectors[1])
+	assert.Error(t, errs[2])
+	assert.Error(t, errs[3])
+	assert.NoError(t, errs[4])
+	assert.Equal(t, []float64{5}, vectors[4])
+}
+
+func TestBatcherDefaults(t *testing.T) {
+	batcher := NewBatcher(&countingProvider{}, BatchOptions{})
+	assert.Equal(t, DefaultBatchSize, batcher.opts.BatchSize)
+	assert.Equal(t, DefaultConcurrency, batcher.opts.Concurrency)
+	assert.Nil(t, batcher.limiter)
+
+	vectors, errs := batcher.EmbedAll(nil)
+	assert.Empty(t, vectors)
+	assert.Empty(t, errs)
+}
+
+func TestRateLimiter(t *testing.T) {
+	var unlimited *RateLimiter
+	unlimited.Wait() // nil limiter never blocks
+
+	limiter := NewRateLimiter(50, 1)
+	start := time.Now()
+	for i := 0; i < 4; i++ {
+		limiter.Wait()
+	}
+	// first token is free, the next three take 20ms each
+	assert.GreaterOrEqual(t, time.Since(start), 55*time.Millisecond)
+}
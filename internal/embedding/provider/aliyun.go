@@ -8,28 +8,42 @@ import (
 	"io"
 	"net/http"
 	"oasisdb/internal/embedding"
-	"os"
+	"strings"
 	"time"
 )
 
 const (
 	MODEL   = "text-embedding-v4"
 	API_URL = "https://dashscope.aliyuncs.com/compatible-mode/v1/embeddings"
+
+	ALIYUN_API_KEY_ENV = "DASHSCOPE_API_KEY"
 )
 
 type AliyunEmbeddingProvider struct {
 	apiKey string
 	apiURL string
+	model  string
 }
 
 func NewAliyunEmbeddingProvider() (embedding.EmbeddingProvider, error) {
-	apiKey, exists := os.LookupEnv("DASHSCOPE_API_KEY")
-	if !exists {
-		return nil, errors.New("DASHSCOPE_API_KEY not found")
+	return newAliyunFromOptions(Options{Name: AliyunProvider})
+}
+
+// newAliyunFromOptions creates the DashScope provider, BaseURL is the
+// compatible-mode base without the trailing /embeddings
+func newAliyunFromOptions(opts Options) (embedding.EmbeddingProvider, error) {
+	apiKey, err := lookupAPIKey(opts, ALIYUN_API_KEY_ENV)
+	if err != nil {
+		return nil, err
+	}
+	apiURL := API_URL
+	if opts.BaseURL != "" {
+		apiURL = strings.TrimSuffix(opts.BaseURL, "/") + "/embeddings"
 	}
 	return &AliyunEmbeddingProvider{
 		apiKey: apiKey,
-		apiURL: API_URL,
+		apiURL: apiURL,
+		model:  orDefault(opts.Model, MODEL),
 	}, nil
 }
 
@@ -73,7 +87,7 @@ func (e *AliyunEmbeddingProvider) GetEmbeddings(input string) (*AliyunEmbeddingR
 
 func (e *AliyunEmbeddingProvider) buildRequest(input string) (*AliyunEmbeddingRequest, error) {
 	return &AliyunEmbeddingRequest{
-		Model:          MODEL,
+		Model:          e.model,
 		Input:          input,
 		EncodingFormat: "float",
 	}, nil
@@ -94,7 +108,7 @@ func (e *AliyunEmbeddingProvider) Embed(text string) ([]float64, error) {
 func (e *AliyunEmbeddingProvider) EmbedBatch(texts []string) ([][]float64, error) {
 	// Build request with slice input
 	req := &AliyunEmbeddingRequest{
-		Model:          MODEL,
+		Model:          e.model,
 		Input:          texts,
 		EncodingFormat: "float",
 	}
@@ -0,0 +1,83 @@
+package provider
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"oasisdb/internal/embedding"
+	"strings"
+	"time"
+)
+
+const (
+	OLLAMA_MODEL    = "nomic-embed-text"
+	OLLAMA_BASE_URL = "http://localhost:11434"
+)
+
+// OllamaEmbeddingProvider uses a local Ollama server, no API key is needed
+type OllamaEmbeddingProvider struct {
+	apiURL string
+	model  string
+}
+
+func NewOllamaEmbeddingProvider(opts Options) (embedding.EmbeddingProvider, error) {
+	baseURL := strings.TrimSuffix(orDefault(opts.BaseURL, OLLAMA_BASE_URL), "/")
+	return &OllamaEmbeddingProvider{
+		apiURL: baseURL + "/api/embed",
+		model:  orDefault(opts.Model, OLLAMA_MODEL),
+	}, nil
+}
+
+func (e *OllamaEmbeddingProvider) Embed(text string) ([]float64, error) {
+	embeddings, err := e.EmbedBatch([]string{text})
+	if err != nil {
+		return nil, err
+	}
+	return embeddings[0], nil
+}
+
+func (e *OllamaEmbeddingProvider) EmbedBatch(texts []string) ([][]float64, error) {
+	req := &OllamaEmbeddingRequest{
+		Model: e.model,
+		Input: texts,
+	}
+
+	body, err := json.Marshal(req)
+	if err != nil {
+		return nil, err
+	}
+
+	httpReq, err := http.NewRequest("POST", e.apiURL, bytes.NewBuffer(body))
+	if err != nil {
+		return nil, err
+	}
+	httpReq.Header.Set("Content-Type", "application/json")
+
+	client := &http.Client{Timeout: 30 * time.Second}
+	resp, err := client.Do(httpReq)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		respBody, _ := io.ReadAll(resp.Body)
+		return nil, fmt.Errorf("Ollama embed API returned status %d: %s", resp.StatusCode, string(respBody))
+	}
+
+	var embeddingResp OllamaEmbeddingResponse
+	if err := json.NewDecoder(resp.Body).Decode(&embeddingResp); err != nil {
+		return nil, err
+	}
+
+	if len(embeddingResp.Embeddings) == 0 {
+		return nil, errors.New("no embeddings returned")
+	}
+	if len(embeddingResp.Embeddings) != len(texts) {
+		return nil, fmt.Errorf("expected %d embeddings, got %d", len(texts), len(embeddingResp.Embeddings))
+	}
+	return embeddingResp.Embeddings, nil
+}
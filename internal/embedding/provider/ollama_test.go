@@ -0,0 +1,56 @@
+package provider
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestOllamaEmbeddingProvider(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, "/api/embed", r.URL.Path)
+		assert.Empty(t, r.Header.Get("Authorization"))
+
+		var req struct {
+			Model string   `json:"model"`
+			Input []string `json:"input"`
+		}
+		require.NoError(t, json.NewDecoder(r.Body).Decode(&req))
+		assert.Equal(t, OLLAMA_MODEL, req.Model)
+
+		resp := OllamaEmbeddingResponse{}
+		for i := range req.Input {
+			resp.Embeddings = append(resp.Embeddings, []float64{float64(i), 0.5})
+		}
+		json.NewEncoder(w).Encode(resp)
+	}))
+	defer server.Close()
+
+	provider, err := New(Options{Name: "Ollama", BaseURL: server.URL})
+	require.NoError(t, err)
+
+	vec, err := provider.Embed("hello")
+	require.NoError(t, err)
+	assert.Equal(t, []float64{0, 0.5}, vec)
+
+	vecs, err := provider.EmbedBatch([]string{"foo", "bar"})
+	require.NoError(t, err)
+	assert.Len(t, vecs, 2)
+}
+
+func TestOllamaEmbeddingProvider_ErrorStatus(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.Error(w, "model not found", http.StatusNotFound)
+	}))
+	defer server.Close()
+
+	provider, err := NewOllamaEmbeddingProvider(Options{BaseURL: server.URL})
+	require.NoError(t, err)
+
+	_, err = provider.Embed("hello")
+	assert.ErrorContains(t, err, "status 404")
+}
@@ -0,0 +1,103 @@
+package provider
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"oasisdb/internal/embedding"
+	"strings"
+	"time"
+)
+
+const (
+	OPENAI_MODEL       = "text-embedding-3-small"
+	OPENAI_BASE_URL    = "https://api.openai.com/v1"
+	OPENAI_API_KEY_ENV = "OPENAI_API_KEY"
+)
+
+// OpenAIEmbeddingProvider talks to any OpenAI-compatible /embeddings endpoint
+type OpenAIEmbeddingProvider struct {
+	apiKey string
+	apiURL string
+	model  string
+}
+
+func NewOpenAIEmbeddingProvider(opts Options) (embedding.EmbeddingProvider, error) {
+	apiKey, err := lookupAPIKey(opts, OPENAI_API_KEY_ENV)
+	if err != nil {
+		return nil, err
+	}
+	baseURL := strings.TrimSuffix(orDefault(opts.BaseURL, OPENAI_BASE_URL), "/")
+	return &OpenAIEmbeddingProvider{
+		apiKey: apiKey,
+		apiURL: baseURL + "/embeddings",
+		model:  orDefault(opts.Model, OPENAI_MODEL),
+	}, nil
+}
+
+func (e *OpenAIEmbeddingProvider) Embed(text string) ([]float64, error) {
+	embeddings, err := e.EmbedBatch([]string{text})
+	if err != nil {
+		return nil, err
+	}
+	return embeddings[0], nil
+}
+
+func (e *OpenAIEmbeddingProvider) EmbedBatch(texts []string) ([][]float64, error) {
+	req := &OpenAIEmbeddingRequest{
+		Model:          e.model,
+		Input:          texts,
+		EncodingFormat: "float",
+	}
+
+	body, err := json.Marshal(req)
+	if err != nil {
+		return nil, err
+	}
+
+	httpReq, err := http.NewRequest("POST", e.apiURL, bytes.NewBuffer(body))
+	if err != nil {
+		return nil, err
+	}
+	httpReq.Header.Set("Content-Type", "application/json")
+	httpReq.Header.Set("Authorization", fmt.Sprintf("Bearer %s", e.apiKey))
+
+	client := &http.Client{Timeout: 30 * time.Second}
+	resp, err := client.Do(httpReq)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		respBody, _ := io.ReadAll(resp.Body)
+		return nil, fmt.Errorf("OpenAI embeddings API returned status %d: %s", resp.StatusCode, string(respBody))
+	}
+
+	var embeddingResp OpenAIEmbeddingResponse
+	if err := json.NewDecoder(resp.Body).Decode(&embeddingResp); err != nil {
+		return nil, err
+	}
+
+	if len(embeddingResp.Data) == 0 {
+		return nil, errors.New("no embeddings returned")
+	}
+	if len(embeddingResp.Data) != len(texts) {
+		return nil, fmt.Errorf("expected %d embeddings, got %d", len(texts), len(embeddingResp.Data))
+	}
+
+	// the API may return items out of order, so place them by index
+	embeddings := make([][]float64, len(texts))
+	for i, item := range embeddingResp.Data {
+		pos := i
+		if item.Index != nil && *item.Index >= 0 && *item.Index < len(texts) {
+			pos = *item.Index
+		}
+		embeddings[pos] = item.Embedding
+	}
+
+	return embeddings, nil
+}
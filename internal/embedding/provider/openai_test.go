@@ -0,0 +1,65 @@
+package provider
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// mockOpenAIServer mimics the OpenAI embeddings API, returning items in
+// reverse order to exercise index-based placement.
+func mockOpenAIServer(t *testing.T) *httptest.Server {
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, "/v1/embeddings", r.URL.Path)
+		assert.Equal(t, "Bearer test-key", r.Header.Get("Authorization"))
+
+		var req struct {
+			Model string   `json:"model"`
+			Input []string `json:"input"`
+		}
+		require.NoError(t, json.NewDecoder(r.Body).Decode(&req))
+		assert.Equal(t, "custom-model", req.Model)
+
+		resp := OpenAIEmbeddingResponse{}
+		for i := len(req.Input) - 1; i >= 0; i-- {
+			index := i
+			resp.Data = append(resp.Data, struct {
+				Index     *int      `json:"index,omitempty"`
+				Embedding []float64 `json:"embedding"`
+			}{Index: &index, Embedding: []float64{float64(i), 1}})
+		}
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(resp)
+	}))
+}
+
+func TestOpenAIEmbeddingProvider(t *testing.T) {
+	server := mockOpenAIServer(t)
+	defer server.Close()
+
+	t.Setenv("TEST_OPENAI_KEY", "test-key")
+	provider, err := New(Options{
+		Name:      OpenAIProvider,
+		APIKeyEnv: "TEST_OPENAI_KEY",
+		Model:     "custom-model",
+		BaseURL:   server.URL + "/v1/",
+	})
+	require.NoError(t, err)
+
+	vec, err := provider.Embed("hello")
+	require.NoError(t, err)
+	assert.Equal(t, []float64{0, 1}, vec)
+
+	vecs, err := provider.EmbedBatch([]string{"foo", "bar", "baz"})
+	require.NoError(t, err)
+	assert.Equal(t, [][]float64{{0, 1}, {1, 1}, {2, 1}}, vecs)
+}
+
+func TestOpenAIEmbeddingProvider_MissingKey(t *testing.T) {
+	_, err := NewOpenAIEmbeddingProvider(Options{APIKeyEnv: "TEST_OPENAI_KEY_UNSET"})
+	assert.ErrorContains(t, err, "TEST_OPENAI_KEY_UNSET not found")
+}
@@ -0,0 +1,99 @@
+package provider
+
+import (
+	"errors"
+	"fmt"
+	"oasisdb/internal/embedding"
+	"os"
+	"sort"
+	"strings"
+	"sync"
+)
+
+const (
+	AliyunProvider = "aliyun"
+	OpenAIProvider = "openai"
+	OllamaProvider = "ollama"
+
+	DefaultProvider = AliyunProvider
+)
+
+var ErrUnknownProvider = errors.New("unknown embedding provider")
+
+// Options configures an embedding provider, usually from conf.yaml
+type Options struct {
+	Name      string // provider name, e.g. "aliyun", "openai", "ollama"
+	APIKeyEnv string // environment variable holding the API key
+	Model     string // model name, empty means provider default
+	BaseURL   string // API base URL, empty means provider default
+}
+
+// Constructor creates an embedding provider from options
+type Constructor func(opts Options) (embedding.EmbeddingProvider, error)
+
+var (
+	registryMu sync.RWMutex
+	registry   = map[string]Constructor{
+		AliyunProvider: newAliyunFromOptions,
+		OpenAIProvider: NewOpenAIEmbeddingProvider,
+		OllamaProvider: NewOllamaEmbeddingProvider,
+	}
+)
+
+// Register makes an embedding provider available by name, replacing any
+// provider previously registered under the same name
+func Register(name string, constructor Constructor) {
+	registryMu.Lock()
+	defer registryMu.Unlock()
+	registry[strings.ToLower(name)] = constructor
+}
+
+// New creates the embedding provider selected by opts.Name
+func New(opts Options) (embedding.EmbeddingProvider, error) {
+	name := strings.ToLower(opts.Name)
+	if name == "" {
+		name = DefaultProvider
+	}
+
+	registryMu.RLock()
+	constructor, ok := registry[name]
+	registryMu.RUnlock()
+	if !ok {
+		return nil, fmt.Errorf("%w %q, available: %s", ErrUnknownProvider, opts.Name, strings.Join(Names(), ", "))
+	}
+	return constructor(opts)
+}
+
+// Names returns all registered provider names in sorted order
+func Names() []string {
+	registryMu.RLock()
+	defer registryMu.RUnlock()
+
+	names := make([]string, 0, len(registry))
+	for name := range registry {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// lookupAPIKey reads the API key from the configured environment variable,
+// falling back to the provider's default variable
+func lookupAPIKey(opts Options, defaultEnv string) (string, error) {
+	env := opts.APIKeyEnv
+	if env == "" {
+		env = defaultEnv
+	}
+	apiKey, exists := os.LookupEnv(env)
+	if !exists {
+		return "", fmt.Errorf("%s not found", env)
+	}
+	return apiKey, nil
+}
+
+func orDefault(value, def string) string {
+	if value == "" {
+		return def
+	}
+	return value
+}
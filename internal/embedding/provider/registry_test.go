@@ -0,0 +1,41 @@
+package provider
+
+import (
+	"errors"
+	"testing"
+
+	"oasisdb/internal/embedding"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type staticProvider struct{}
+
+func (staticProvider) Embed(text string) ([]float64, error) { return []float64{1}, nil }
+
+func (staticProvider) EmbedBatch(texts []string) ([][]float64, error) {
+	return make([][]float64, len(texts)), nil
+}
+
+func TestRegistry(t *testing.T) {
+	assert.Subset(t, Names(), []string{AliyunProvider, OpenAIProvider, OllamaProvider})
+
+	_, err := New(Options{Name: "unknown"})
+	assert.True(t, errors.Is(err, ErrUnknownProvider))
+
+	Register("static", func(opts Options) (embedding.EmbeddingProvider, error) {
+		return staticProvider{}, nil
+	})
+	provider, err := New(Options{Name: "static"})
+	require.NoError(t, err)
+	vec, err := provider.Embed("anything")
+	require.NoError(t, err)
+	assert.Equal(t, []float64{1}, vec)
+
+	// empty name falls back to the default provider
+	t.Setenv(ALIYUN_API_KEY_ENV, "key")
+	provider, err = New(Options{})
+	require.NoError(t, err)
+	assert.IsType(t, &AliyunEmbeddingProvider{}, provider)
+}
@@ -11,3 +11,25 @@ type AliyunEmbeddingResponse struct {
 		Embedding []float64 `json:"embedding"`
 	} `json:"data"`
 }
+
+type OpenAIEmbeddingRequest struct {
+	Model          string `json:"model"`
+	Input          any    `json:"input"`
+	EncodingFormat string `json:"encoding_format,omitempty"`
+}
+
+type OpenAIEmbeddingResponse struct {
+	Data []struct {
+		Index     *int      `json:"index,omitempty"`
+		Embedding []float64 `json:"embedding"`
+	} `json:"data"`
+}
+
+type OllamaEmbeddingRequest struct {
+	Model string `json:"model"`
+	Input any    `json:"input"`
+}
+
+type OllamaEmbeddingResponse struct {
+	Embeddings [][]float64 `json:"embeddings"`
+}
@@ -0,0 +1,206 @@
+#include "gpu_flat_c_api.h"
+#include <algorithm>
+#include <cublas_v2.h>
+#include <cuda_runtime.h>
+#include <string>
+
+struct GPUFlatIndex {
+  size_t dim;
+  size_t batch_size;
+  int device;
+  cublasHandle_t handle;
+  size_t n;
+  size_t capacity;
+  float *vectors; // n row-major vectors
+  float *norms;   // squared norm of each vector
+  float *query;
+  float *batch; // distances of one batch
+  std::string error;
+};
+
+static const int threads_per_block = 256;
+
+static bool check(GPUFlatIndex *index, cudaError_t err, const char *what) {
+  if (err == cudaSuccess) {
+    return true;
+  }
+  index->error = std::string(what) + ": " + cudaGetErrorString(err);
+  return false;
+}
+
+static bool check(GPUFlatIndex *index, cublasStatus_t status,
+                  const char *what) {
+  if (status == CUBLAS_STATUS_SUCCESS) {
+    return true;
+  }
+  index->error = std::string(what) + ": cuBLAS status " +
+                 std::to_string(static_cast<int>(status));
+  return false;
+}
+
+__global__ void squared_norms(const float *vectors, size_t n, size_t dim,
+                              float *norms) {
+  size_t i = blockIdx.x * static_cast<size_t>(blockDim.x) + threadIdx.x;
+  if (i >= n) {
+    return;
+  }
+  const float *v = vectors + i * dim;
+  float sum = 0;
+  for (size_t j = 0; j < dim; j++) {
+    sum += v[j] * v[j];
+  }
+  norms[i] = sum;
+}
+
+// to_distances turns the dot products of a batch with the query into the
+// distances of the space, the same as the CPU flat index computes them
+__global__ void to_distances(float *dots, const float *norms, size_t n,
+                             float query_norm, char space) {
+  size_t i = blockIdx.x * static_cast<size_t>(blockDim.x) + threadIdx.x;
+  if (i >= n) {
+    return;
+  }
+  float dot = dots[i];
+  switch (space) {
+  case 'i':
+    dots[i] = -dot;
+    break;
+  case 'c': {
+    float norm = norms[i] * query_norm;
+    dots[i] = norm == 0 ? 1.0f : 1.0f - dot / sqrtf(norm);
+    break;
+  }
+  default:
+    // rounding may take the expansion of |x-q|^2 below zero
+    dots[i] = fmaxf(norms[i] + query_norm - 2.0f * dot, 0.0f);
+  }
+}
+
+static size_t blocks(size_t n) {
+  return (n + threads_per_block - 1) / threads_per_block;
+}
+
+int gpu_device_count(void) {
+  int count = 0;
+  if (cudaGetDeviceCount(&count) != cudaSuccess) {
+    return 0;
+  }
+  return count;
+}
+
+GPUFlatIndex *gpu_flat_new(size_t dim, size_t batch_size, int device) {
+  if (dim == 0 || batch_size == 0 || cudaSetDevice(device) != cudaSuccess) {
+    return nullptr;
+  }
+  auto index = new GPUFlatIndex();
+  index->dim = dim;
+  index->batch_size = batch_size;
+  index->device = device;
+  if (cublasCreate(&index->handle) != CUBLAS_STATUS_SUCCESS) {
+    delete index;
+    return nullptr;
+  }
+  if (cudaMalloc(&index->query, dim * sizeof(float)) != cudaSuccess ||
+      cudaMalloc(&index->batch, batch_size * sizeof(float)) != cudaSuccess) {
+    gpu_flat_free(index);
+    return nullptr;
+  }
+  return index;
+}
+
+void gpu_flat_free(GPUFlatIndex *index) {
+  if (!index) {
+    return;
+  }
+  cudaSetDevice(index->device);
+  cudaFree(index->vectors);
+  cudaFree(index->norms);
+  cudaFree(index->query);
+  cudaFree(index->batch);
+  cublasDestroy(index->handle);
+  delete index;
+}
+
+int gpu_flat_upload(GPUFlatIndex *index, const float *data, size_t n) {
+  if (!check(index, cudaSetDevice(index->device), "set device")) {
+    return -1;
+  }
+  if (n > index->capacity) {
+    cudaFree(index->vectors);
+    cudaFree(index->norms);
+    index->vectors = nullptr;
+    index->norms = nullptr;
+    index->n = 0;
+    index->capacity = 0;
+    if (!check(index,
+               cudaMalloc(&index->vectors, n * index->dim * sizeof(float)),
+               "allocate vectors") ||
+        !check(index, cudaMalloc(&index->norms, n * sizeof(float)),
+               "allocate norms")) {
+      return -1;
+    }
+    index->capacity = n;
+  }
+  index->n = 0;
+  if (n == 0) {
+    return 0;
+  }
+  if (!check(index,
+             cudaMemcpy(index->vectors, data, n * index->dim * sizeof(float),
+                        cudaMemcpyHostToDevice),
+             "copy vectors")) {
+    return -1;
+  }
+  squared_norms<<<blocks(n), threads_per_block>>>(index->vectors, n,
+                                                  index->dim, index->norms);
+  if (!check(index, cudaDeviceSynchronize(), "compute norms")) {
+    return -1;
+  }
+  index->n = n;
+  return 0;
+}
+
+int gpu_flat_distances(GPUFlatIndex *index, const float *query, char space,
+                       float *distances) {
+  if (!check(index, cudaSetDevice(index->device), "set device") ||
+      !check(index,
+             cudaMemcpy(index->query, query, index->dim * sizeof(float),
+                        cudaMemcpyHostToDevice),
+             "copy query")) {
+    return -1;
+  }
+  float query_norm = 0;
+  for (size_t j = 0; j < index->dim; j++) {
+    query_norm += query[j] * query[j];
+  }
+
+  const float one = 1, zero = 0;
+  for (size_t start = 0; start < index->n; start += index->batch_size) {
+    size_t count = std::min(index->batch_size, index->n - start);
+    // the row-major vectors are a column-major dim x count matrix, its
+    // transpose times the query is the dot product of every vector
+    if (!check(index,
+               cublasSgemv(index->handle, CUBLAS_OP_T,
+                           static_cast<int>(index->dim),
+                           static_cast<int>(count), &one,
+                           index->vectors + start * index->dim,
+                           static_cast<int>(index->dim), index->query, 1,
+                           &zero, index->batch, 1),
+               "dot products")) {
+      return -1;
+    }
+    to_distances<<<blocks(count), threads_per_block>>>(
+        index->batch, index->norms + start, count, query_norm, space);
+    if (!check(index,
+               cudaMemcpy(distances + start, index->batch,
+                          count * sizeof(float), cudaMemcpyDeviceToHost),
+               "copy distances")) {
+      return -1;
+    }
+  }
+  return 0;
+}
+
+const char *gpu_flat_error(GPUFlatIndex *index) {
+  return index->error.c_str();
+}
@@ -0,0 +1,40 @@
+#ifndef GPU_FLAT_C_API_H
+#define GPU_FLAT_C_API_H
+
+#ifdef __cplusplus
+extern "C" {
+#endif
+
+#include <stddef.h>
+
+// Opaque type for a set of vectors held on a GPU
+typedef struct GPUFlatIndex GPUFlatIndex;
+
+// Get the number of usable CUDA devices, 0 without a device or driver
+int gpu_device_count(void);
+
+// Create an empty index on device, distances are computed for batch_size
+// vectors at a time. Returns NULL if the device can't be used
+GPUFlatIndex *gpu_flat_new(size_t dim, size_t batch_size, int device);
+
+// Free the index and its device memory
+void gpu_flat_free(GPUFlatIndex *index);
+
+// Copy n row-major vectors to the device, replacing the previous ones.
+// Returns 0 on success, -1 on error
+int gpu_flat_upload(GPUFlatIndex *index, const float *data, size_t n);
+
+// Compute the distance of query to every uploaded vector, in upload order.
+// space is 'l' for squared L2, 'i' for the negative inner product and 'c' for
+// the cosine distance. Returns 0 on success, -1 on error
+int gpu_flat_distances(GPUFlatIndex *index, const float *query, char space,
+                       float *distances);
+
+// Get the message of the last failed call on index
+const char *gpu_flat_error(GPUFlatIndex *index);
+
+#ifdef __cplusplus
+}
+#endif
+
+#endif // GPU_FLAT_C_API_H
@@ -1,6 +1,7 @@
 #include "hnsw_c_api.h"
 #include "../../index/hnswlib/hnswlib.h"
 #include "../../index/hnswlib/space_l2.h"
+#include <algorithm>
 #include <memory>
 
 struct HNSWIndex {
@@ -10,7 +11,8 @@ struct HNSWIndex {
 };
 
 HNSWIndex *hnsw_new(size_t dim, size_t max_elements, size_t M,
-                    size_t ef_construction, char stype) {
+                    size_t ef_construction, char stype,
+                    int allow_replace_deleted) {
   auto index = new HNSWIndex();
   hnswlib::SpaceInterface<float> *space;
   index->dim = dim;
@@ -23,7 +25,8 @@ HNSWIndex *hnsw_new(size_t dim, size_t max_elements, size_t M,
   }
   index->space = std::unique_ptr<hnswlib::SpaceInterface<float>>(space);
   index->alg = std::make_unique<hnswlib::HierarchicalNSW<float>>(
-      index->space.get(), max_elements, M, ef_construction);
+      index->space.get(), max_elements, M, ef_construction, 100,
+      allow_replace_deleted != 0);
   return index;
 }
 
@@ -33,18 +36,55 @@ void hnsw_free(HNSWIndex *index) {
   }
 }
 
-int hnsw_add_point(HNSWIndex *index, const float *point, size_t id) {
+int hnsw_add_point(HNSWIndex *index, const float *point, size_t id,
+                   int replace_deleted) {
   try {
-    index->alg->addPoint(point, id);
+    auto alg = index->alg.get();
+    if (replace_deleted) {
+      // a known label is updated in place, replacing would leave its old
+      // element behind
+      std::unique_lock<std::mutex> lock_table(alg->label_lookup_lock);
+      if (alg->label_lookup_.count(id) > 0) {
+        replace_deleted = 0;
+      }
+    }
+    alg->addPoint(point, id, replace_deleted != 0);
     return 0;
   } catch (...) {
     return -1;
   }
 }
 
-void hnsw_search_knn(HNSWIndex *index, const float *query, size_t k,
-                     size_t *labels, float *distances) {
-  auto results = index->alg->searchKnn(query, k);
+int hnsw_add_point_level(HNSWIndex *index, const float *point, size_t id,
+                         int level) {
+  try {
+    auto alg = index->alg.get();
+    std::unique_lock<std::mutex> lock_label(alg->getLabelOpMutex(id));
+    alg->addPoint(point, id, level);
+    return 0;
+  } catch (...) {
+    return -1;
+  }
+}
+
+int hnsw_resize_index(HNSWIndex *index, size_t new_max_elements) {
+  try {
+    index->alg->resizeIndex(new_max_elements);
+    return 0;
+  } catch (...) {
+    return -1;
+  }
+}
+
+size_t hnsw_search_knn(HNSWIndex *index, const float *query, size_t k,
+                       size_t *labels, float *distances) {
+  return hnsw_search_knn_ef(index, query, k, index->alg->ef_, labels,
+                            distances);
+}
+
+size_t hnsw_search_knn_ef(HNSWIndex *index, const float *query, size_t k,
+                          size_t ef, size_t *labels, float *distances) {
+  auto results = index->alg->searchKnnWithEf(query, k, ef);
   size_t i = 0;
   while (!results.empty()) {
     auto &result = results.top();
@@ -53,6 +93,7 @@ void hnsw_search_knn(HNSWIndex *index, const float *query, size_t k,
     results.pop();
     i++;
   }
+  return i;
 }
 
 void hnsw_set_ef(HNSWIndex *index, size_t ef) {
@@ -61,6 +102,18 @@ void hnsw_set_ef(HNSWIndex *index, size_t ef) {
   }
 }
 
+size_t hnsw_get_ef(HNSWIndex *index) { return index->alg->ef_; }
+
+void hnsw_set_ef_construction(HNSWIndex *index, size_t ef_construction) {
+  if (index && index->alg) {
+    index->alg->ef_construction_ = std::max(ef_construction, index->alg->M_);
+  }
+}
+
+size_t hnsw_get_ef_construction(HNSWIndex *index) {
+  return index->alg->ef_construction_;
+}
+
 int hnsw_save_index(HNSWIndex *index, const char *path) {
   try {
     index->alg->saveIndex(path);
@@ -70,7 +123,8 @@ int hnsw_save_index(HNSWIndex *index, const char *path) {
   }
 }
 
-HNSWIndex *hnsw_load_index(const char *path, size_t dim, const char spaceType) {
+HNSWIndex *hnsw_load_index(const char *path, size_t dim, size_t max_elements,
+                           const char spaceType, int allow_replace_deleted) {
   auto index = new HNSWIndex();
   index->dim = dim;
   hnswlib::SpaceInterface<float> *space;
@@ -83,7 +137,9 @@ HNSWIndex *hnsw_load_index(const char *path, size_t dim, const char spaceType) {
   }
   index->space = std::unique_ptr<hnswlib::SpaceInterface<float>>(space);
   index->alg = std::unique_ptr<hnswlib::HierarchicalNSW<float>>(
-      new hnswlib::HierarchicalNSW<float>(space, std::string(path), false, 0));
+      new hnswlib::HierarchicalNSW<float>(space, std::string(path), false,
+                                          max_elements,
+                                          allow_replace_deleted != 0));
   return index;
 }
 
@@ -131,3 +187,57 @@ float get_avg_dist_computations(HNSWIndex *index) {
 }
 
 int get_query_count(HNSWIndex *index) { return index->alg->getQueryCount(); }
+
+int hnsw_get_entry_point(HNSWIndex *index, size_t *label) {
+  auto alg = index->alg.get();
+  if (alg->cur_element_count == 0 || alg->maxlevel_ < 0) {
+    return -1;
+  }
+  *label = alg->getExternalLabel(alg->enterpoint_node_);
+  return 0;
+}
+
+int hnsw_get_neighbors(HNSWIndex *index, size_t label, size_t *labels,
+                       size_t max_labels) {
+  auto alg = index->alg.get();
+  hnswlib::tableint internal_id;
+  {
+    std::unique_lock<std::mutex> lock_table(alg->label_lookup_lock);
+    auto search = alg->label_lookup_.find(label);
+    if (search == alg->label_lookup_.end()) {
+      return -1;
+    }
+    internal_id = search->second;
+  }
+
+  std::unique_lock<std::mutex> lock(alg->link_list_locks_[internal_id]);
+  auto *data = (int *)alg->get_linklist0(internal_id);
+  size_t size = alg->getListCount((hnswlib::linklistsizeint *)data);
+  auto *neighbors = (hnswlib::tableint *)(data + 1);
+  size_t n = 0;
+  for (size_t i = 0; i < size && n < max_labels; i++) {
+    if (alg->isMarkedDeleted(neighbors[i])) {
+      continue;
+    }
+    labels[n++] = alg->getExternalLabel(neighbors[i]);
+  }
+  return (int)n;
+}
+
+int hnsw_get_max_neighbors(HNSWIndex *index) { return index->alg->maxM0_; }
+
+int hnsw_get_labels(HNSWIndex *index, size_t *labels, size_t max_labels) {
+  auto alg = index->alg.get();
+  std::unique_lock<std::mutex> lock_table(alg->label_lookup_lock);
+  size_t n = 0;
+  for (const auto &entry : alg->label_lookup_) {
+    if (n >= max_labels) {
+      break;
+    }
+    if (alg->isMarkedDeleted(entry.second)) {
+      continue;
+    }
+    labels[n++] = entry.first;
+  }
+  return (int)n;
+}
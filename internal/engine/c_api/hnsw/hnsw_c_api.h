@@ -11,28 +11,56 @@ extern "C" {
 // Opaque type for HNSW index
 typedef struct HNSWIndex HNSWIndex;
 
-// Create a new HNSW index
+// Create a new HNSW index, with allow_replace_deleted set new points may
+// take the place of deleted ones
 HNSWIndex *hnsw_new(size_t dim, size_t max_elements, size_t M,
-                    size_t ef_construction, char stype);
+                    size_t ef_construction, char stype,
+                    int allow_replace_deleted);
 
 // Free the HNSW index
 void hnsw_free(HNSWIndex *index);
 
-// Add a point to the index
-int hnsw_add_point(HNSWIndex *index, const float *point, size_t id);
+// Add a point to the index, with replace_deleted a new label reuses the slot
+// of a deleted element if there is one, the index must allow it
+int hnsw_add_point(HNSWIndex *index, const float *point, size_t id,
+                   int replace_deleted);
 
-// Search for nearest neighbors
-void hnsw_search_knn(HNSWIndex *index, const float *query, size_t k,
-                     size_t *labels, float *distances);
+// Add a point at the given level instead of a random one, used by bulk builds
+// that assign levels up front. Returns 0 on success, -1 on error
+int hnsw_add_point_level(HNSWIndex *index, const float *point, size_t id,
+                         int level);
+
+// Resize the index to hold new_max_elements, not safe to call concurrently
+// with any other operation on the index. Returns 0 on success, -1 on error
+int hnsw_resize_index(HNSWIndex *index, size_t new_max_elements);
+
+// Search for nearest neighbors, returns the number of results written
+size_t hnsw_search_knn(HNSWIndex *index, const float *query, size_t k,
+                       size_t *labels, float *distances);
+
+// Search for nearest neighbors with the given ef for this query only, the
+// index ef is left unchanged
+size_t hnsw_search_knn_ef(HNSWIndex *index, const float *query, size_t k,
+                          size_t ef, size_t *labels, float *distances);
 
 // Set ef parameter for search
 void hnsw_set_ef(HNSWIndex *index, size_t ef);
 
+// Get ef parameter for search
+size_t hnsw_get_ef(HNSWIndex *index);
+
+// Set ef_construction, used by points added from now on
+void hnsw_set_ef_construction(HNSWIndex *index, size_t ef_construction);
+
+// Get ef_construction
+size_t hnsw_get_ef_construction(HNSWIndex *index);
+
 // Save index to file
 int hnsw_save_index(HNSWIndex *index, const char *path);
 
-// Load index from file
-HNSWIndex *hnsw_load_index(const char *path, size_t dim, const char spaceType);
+// Load index from file, max_elements is raised to the saved element count
+HNSWIndex *hnsw_load_index(const char *path, size_t dim, size_t max_elements,
+                           const char spaceType, int allow_replace_deleted);
 
 // Mark an element as deleted
 int hnsw_mark_deleted(HNSWIndex *index, size_t label);
@@ -58,6 +86,21 @@ float get_avg_dist_computations(HNSWIndex *index);
 // Get query count
 int get_query_count(HNSWIndex *index);
 
+// Get the label of the graph entry point, returns -1 if the index is empty
+int hnsw_get_entry_point(HNSWIndex *index, size_t *label);
+
+// Get the level-0 neighbors of label that are not deleted, returns the number
+// of labels written (at most max_labels) or -1 if label not found
+int hnsw_get_neighbors(HNSWIndex *index, size_t label, size_t *labels,
+                       size_t max_labels);
+
+// Get the max number of level-0 neighbors of an element
+int hnsw_get_max_neighbors(HNSWIndex *index);
+
+// Get the labels of all elements that are not deleted, returns the number of
+// labels written (at most max_labels)
+int hnsw_get_labels(HNSWIndex *index, size_t *labels, size_t max_labels);
+
 #ifdef __cplusplus
 }
 #endif
@@ -0,0 +1,10 @@
+// Package gpu computes the distances of brute force searches on a CUDA
+// device. It needs the gpuflat library built with `make engine-gpu` and the
+// gpu build tag, other builds report ErrUnavailable
+package gpu
+
+import "errors"
+
+// ErrUnavailable is returned when the binary was built without the gpu tag
+// or no CUDA device was found
+var ErrUnavailable = errors.New("GPU support unavailable")
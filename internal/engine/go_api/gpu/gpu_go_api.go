@@ -0,0 +1,97 @@
+//go:build gpu
+
+package gpu
+
+/*
+#cgo CFLAGS: -I${SRCDIR}/../../c_api/gpu
+#cgo LDFLAGS: -L${SRCDIR}/../../build -lgpuflat -Wl,-rpath,${SRCDIR}/../../build
+#include "gpu_flat_c_api.h"
+*/
+import "C"
+import (
+	"fmt"
+	"sync"
+	"unsafe"
+)
+
+// Index holds a copy of a flat index's vectors on a GPU. Calls are serialized,
+// the device buffers are shared by every search
+type Index struct {
+	mu    sync.Mutex
+	dim   int
+	n     int
+	index *C.GPUFlatIndex
+}
+
+// Available reports whether a CUDA device can be used
+func Available() bool {
+	return C.gpu_device_count() > 0
+}
+
+// NewIndex creates an empty index on the first device, computing distances
+// for batchSize vectors at a time
+func NewIndex(dim, batchSize int) (*Index, error) {
+	if !Available() {
+		return nil, ErrUnavailable
+	}
+	index := C.gpu_flat_new(C.size_t(dim), C.size_t(batchSize), 0)
+	if index == nil {
+		return nil, fmt.Errorf("failed to create GPU index of dimension %d", dim)
+	}
+	return &Index{dim: dim, index: index}, nil
+}
+
+// Upload replaces the vectors on the device with data, dim values per vector
+func (idx *Index) Upload(data []float32) error {
+	if len(data)%idx.dim != 0 {
+		return fmt.Errorf("data length %d is not a multiple of dimension %d", len(data), idx.dim)
+	}
+	idx.mu.Lock()
+	defer idx.mu.Unlock()
+	if idx.index == nil {
+		return fmt.Errorf("index not initialized")
+	}
+	n := len(data) / idx.dim
+	var ptr *C.float
+	if n > 0 {
+		ptr = (*C.float)(&data[0])
+	}
+	if C.gpu_flat_upload(idx.index, ptr, C.size_t(n)) != 0 {
+		idx.n = 0
+		return fmt.Errorf("failed to upload vectors: %s", C.GoString(C.gpu_flat_error(idx.index)))
+	}
+	idx.n = n
+	return nil
+}
+
+// Distances computes the distance of query to every uploaded vector in
+// space, 'l' for L2, 'i' for inner product or 'c' for cosine, in upload order
+func (idx *Index) Distances(query []float32, space byte) ([]float32, error) {
+	if len(query) != idx.dim {
+		return nil, fmt.Errorf("query dimension %d, expected %d", len(query), idx.dim)
+	}
+	idx.mu.Lock()
+	defer idx.mu.Unlock()
+	if idx.index == nil {
+		return nil, fmt.Errorf("index not initialized")
+	}
+	distances := make([]float32, idx.n)
+	if idx.n == 0 {
+		return distances, nil
+	}
+	ret := C.gpu_flat_distances(idx.index, (*C.float)(unsafe.Pointer(&query[0])), C.char(space), (*C.float)(&distances[0]))
+	if ret != 0 {
+		return nil, fmt.Errorf("failed to compute distances: %s", C.GoString(C.gpu_flat_error(idx.index)))
+	}
+	return distances, nil
+}
+
+// Free releases the device memory of the index
+func (idx *Index) Free() {
+	idx.mu.Lock()
+	defer idx.mu.Unlock()
+	if idx.index != nil {
+		C.gpu_flat_free(idx.index)
+		idx.index = nil
+	}
+}
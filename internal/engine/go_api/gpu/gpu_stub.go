@@ -0,0 +1,31 @@
+//go:build !gpu
+
+package gpu
+
+// Index holds a copy of a flat index's vectors on a GPU, binaries built
+// without the gpu tag can't create one
+type Index struct{}
+
+// Available reports whether a CUDA device can be used, never without the gpu
+// build tag
+func Available() bool {
+	return false
+}
+
+// NewIndex fails with ErrUnavailable, build with the gpu tag for GPU support
+func NewIndex(dim, batchSize int) (*Index, error) {
+	return nil, ErrUnavailable
+}
+
+// Upload fails with ErrUnavailable
+func (idx *Index) Upload(data []float32) error {
+	return ErrUnavailable
+}
+
+// Distances fails with ErrUnavailable
+func (idx *Index) Distances(query []float32, space byte) ([]float32, error) {
+	return nil, ErrUnavailable
+}
+
+// Free does nothing
+func (idx *Index) Free() {}
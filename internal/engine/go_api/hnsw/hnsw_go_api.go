@@ -13,24 +13,38 @@ import (
 )
 
 type Index struct {
+	// held shared by every call into hnswlib, exclusively by calls that
+	// reallocate the index
+	mu    sync.RWMutex
 	index *C.HNSWIndex
 }
 
-func NewIndex(dim, maxElements, m, efConstruction uint32, spaceType string) *Index {
+// NewIndex creates an empty index, with allowReplaceDeleted points added with
+// replaceDeleted may take the slots of deleted elements
+func NewIndex(dim, maxElements, m, efConstruction uint32, spaceType string, allowReplaceDeleted bool) *Index {
 	var index *C.HNSWIndex
 	switch spaceType {
 	case "l2":
-		index = C.hnsw_new(C.size_t(dim), C.size_t(maxElements), C.size_t(m), C.size_t(efConstruction), C.char('l'))
+		index = C.hnsw_new(C.size_t(dim), C.size_t(maxElements), C.size_t(m), C.size_t(efConstruction), C.char('l'), cBool(allowReplaceDeleted))
 	case "ip":
-		index = C.hnsw_new(C.size_t(dim), C.size_t(maxElements), C.size_t(m), C.size_t(efConstruction), C.char('i'))
+		index = C.hnsw_new(C.size_t(dim), C.size_t(maxElements), C.size_t(m), C.size_t(efConstruction), C.char('i'), cBool(allowReplaceDeleted))
 	default:
 		return nil
 	}
 	return &Index{index: index}
 }
 
+func cBool(b bool) C.int {
+	if b {
+		return 1
+	}
+	return 0
+}
+
 // Unload the index, free the memory, opposite to NewIndex
 func (idx *Index) Unload() bool {
+	idx.mu.Lock()
+	defer idx.mu.Unlock()
 	if idx.index == nil {
 		// already unloaded
 		return false
@@ -44,7 +58,8 @@ func (idx *Index) Free() {
 	C.hnsw_free(idx.index)
 }
 
-func (idx *Index) AddItems(points [][]float32, ids []uint32, numGoroutines int) error {
+// AddItems adds points in parallel, see AddPoint for replaceDeleted
+func (idx *Index) AddItems(points [][]float32, ids []uint32, numGoroutines int, replaceDeleted bool) error {
 	if len(ids) != len(points) {
 		return fmt.Errorf("ids and points must have the same length")
 	}
@@ -58,7 +73,7 @@ func (idx *Index) AddItems(points [][]float32, ids []uint32, numGoroutines int)
 	// TODO: 需要确定合适的参数
 	if len(points) <= 10000 || numGoroutines == 1 {
 		for i := 0; i < len(points); i++ {
-			err := idx.AddPoint(points[i], ids[i])
+			err := idx.AddPoint(points[i], ids[i], replaceDeleted)
 			if err != nil {
 				return fmt.Errorf("failed to add point: %w", err)
 			}
@@ -78,7 +93,7 @@ func (idx *Index) AddItems(points [][]float32, ids []uint32, numGoroutines int)
 		go func(start, end int) {
 			defer wg.Done()
 			for j := start; j < end; j++ {
-				err := idx.AddPoint(points[j], ids[j])
+				err := idx.AddPoint(points[j], ids[j], replaceDeleted)
 				if err != nil {
 					fmt.Printf("failed to add point: %v\n", err)
 				}
@@ -89,14 +104,37 @@ func (idx *Index) AddItems(points [][]float32, ids []uint32, numGoroutines int)
 	return nil
 }
 
-func (idx *Index) AddPoint(point []float32, id uint32) error {
+// AddPoint adds or updates a point, with replaceDeleted a new id reuses the
+// slot of a deleted element, which needs an index created with
+// allowReplaceDeleted
+func (idx *Index) AddPoint(point []float32, id uint32, replaceDeleted bool) error {
+	if len(point) == 0 {
+		return fmt.Errorf("empty point data")
+	}
+	if idx.index == nil {
+		return fmt.Errorf("index not initialized")
+	}
+	idx.mu.RLock()
+	defer idx.mu.RUnlock()
+	ret := C.hnsw_add_point(idx.index, (*C.float)(&point[0]), C.size_t(id), cBool(replaceDeleted))
+	if ret != 0 {
+		return fmt.Errorf("failed to add point")
+	}
+	return nil
+}
+
+// AddPointLevel adds or updates a point at the given level instead of a random
+// one, bulk builds assign levels up front and insert the top levels first
+func (idx *Index) AddPointLevel(point []float32, id uint32, level int) error {
 	if len(point) == 0 {
 		return fmt.Errorf("empty point data")
 	}
 	if idx.index == nil {
 		return fmt.Errorf("index not initialized")
 	}
-	ret := C.hnsw_add_point(idx.index, (*C.float)(&point[0]), C.size_t(id))
+	idx.mu.RLock()
+	defer idx.mu.RUnlock()
+	ret := C.hnsw_add_point_level(idx.index, (*C.float)(&point[0]), C.size_t(id), C.int(level))
 	if ret != 0 {
 		return fmt.Errorf("failed to add point")
 	}
@@ -104,6 +142,20 @@ func (idx *Index) AddPoint(point []float32, id uint32) error {
 }
 
 func (idx *Index) SearchKNN(query []float32, k int) ([]uint32, []float32, error) {
+	return idx.search(query, k, 0)
+}
+
+// SearchKNNWithEf searches with ef for this query only, concurrent searches
+// keep using the ef set by SetEf
+func (idx *Index) SearchKNNWithEf(query []float32, k, ef int) ([]uint32, []float32, error) {
+	if ef <= 0 {
+		return nil, nil, fmt.Errorf("ef must be positive")
+	}
+	return idx.search(query, k, ef)
+}
+
+// search runs a k-NN search, ef 0 uses the ef of the index
+func (idx *Index) search(query []float32, k, ef int) ([]uint32, []float32, error) {
 	if len(query) == 0 {
 		return nil, nil, fmt.Errorf("empty query data")
 	}
@@ -111,13 +163,22 @@ func (idx *Index) SearchKNN(query []float32, k int) ([]uint32, []float32, error)
 	labels := make([]C.size_t, k)
 	distances := make([]C.float, k)
 
-	C.hnsw_search_knn(idx.index, (*C.float)(&query[0]), C.size_t(k),
-		(*C.size_t)(&labels[0]), (*C.float)(&distances[0]))
+	idx.mu.RLock()
+	defer idx.mu.RUnlock()
+	var n int
+	if ef > 0 {
+		n = int(C.hnsw_search_knn_ef(idx.index, (*C.float)(&query[0]), C.size_t(k), C.size_t(ef),
+			(*C.size_t)(&labels[0]), (*C.float)(&distances[0])))
+	} else {
+		n = int(C.hnsw_search_knn(idx.index, (*C.float)(&query[0]), C.size_t(k),
+			(*C.size_t)(&labels[0]), (*C.float)(&distances[0])))
+	}
 
-	result_labels := make([]uint32, k)
-	result_distances := make([]float32, k)
+	// fewer than k results are returned when the index holds fewer elements
+	result_labels := make([]uint32, n)
+	result_distances := make([]float32, n)
 
-	for i := 0; i < k; i++ {
+	for i := 0; i < n; i++ {
 		result_labels[i] = uint32(labels[i])
 		result_distances[i] = float32(distances[i])
 	}
@@ -175,14 +236,44 @@ func (idx *Index) SetEf(ef int) error {
 	if idx.index == nil {
 		return fmt.Errorf("index is not initialized")
 	}
+	idx.mu.RLock()
+	defer idx.mu.RUnlock()
 	C.hnsw_set_ef(idx.index, C.size_t(ef))
 	return nil
 }
 
+// GetEf returns the ef searches use by default
+func (idx *Index) GetEf() int {
+	idx.mu.RLock()
+	defer idx.mu.RUnlock()
+	return int(C.hnsw_get_ef(idx.index))
+}
+
+// SetEfConstruction sets the ef used to link points added from now on, it is
+// raised to M if lower
+func (idx *Index) SetEfConstruction(ef int) error {
+	if idx.index == nil {
+		return fmt.Errorf("index is not initialized")
+	}
+	idx.mu.RLock()
+	defer idx.mu.RUnlock()
+	C.hnsw_set_ef_construction(idx.index, C.size_t(ef))
+	return nil
+}
+
+// GetEfConstruction returns the ef used to link new points
+func (idx *Index) GetEfConstruction() int {
+	idx.mu.RLock()
+	defer idx.mu.RUnlock()
+	return int(C.hnsw_get_ef_construction(idx.index))
+}
+
 func (idx *Index) SaveIndex(path string) error {
 	cPath := C.CString(path)
 	defer C.free(unsafe.Pointer(cPath))
 
+	idx.mu.RLock()
+	defer idx.mu.RUnlock()
 	ret := C.hnsw_save_index(idx.index, cPath)
 	if ret != 0 {
 		return fmt.Errorf("failed to save index")
@@ -190,16 +281,18 @@ func (idx *Index) SaveIndex(path string) error {
 	return nil
 }
 
-func LoadIndex(path string, dim int, spaceType string) (*Index, error) {
+// LoadIndex loads a saved index with room for maxElements, or for the saved
+// elements if there are more, see NewIndex for allowReplaceDeleted
+func LoadIndex(path string, dim int, maxElements uint32, spaceType string, allowReplaceDeleted bool) (*Index, error) {
 	cPath := C.CString(path)
 	defer C.free(unsafe.Pointer(cPath))
 
 	var index *C.HNSWIndex
 	switch spaceType {
 	case "l2":
-		index = C.hnsw_load_index(cPath, C.size_t(dim), C.char('l'))
+		index = C.hnsw_load_index(cPath, C.size_t(dim), C.size_t(maxElements), C.char('l'), cBool(allowReplaceDeleted))
 	case "ip":
-		index = C.hnsw_load_index(cPath, C.size_t(dim), C.char('i'))
+		index = C.hnsw_load_index(cPath, C.size_t(dim), C.size_t(maxElements), C.char('i'), cBool(allowReplaceDeleted))
 	default:
 		return nil, fmt.Errorf("unsupported space type: %s", spaceType)
 	}
@@ -211,6 +304,8 @@ func LoadIndex(path string, dim int, spaceType string) (*Index, error) {
 }
 
 func (idx *Index) MarkDeleted(label uint32) error {
+	idx.mu.RLock()
+	defer idx.mu.RUnlock()
 	ret := C.hnsw_mark_deleted(idx.index, C.size_t(label))
 	if ret != 0 {
 		return fmt.Errorf("failed to mark element as deleted")
@@ -220,38 +315,113 @@ func (idx *Index) MarkDeleted(label uint32) error {
 
 // GetVectorByLabel get index by label
 func (idx *Index) GetVectorByLabel(label uint32, dim int) []float32 {
-	var outDataPtr C.float
-	ret := C.get_data_by_label(idx.index, C.size_t(label), &outDataPtr)
-	if ret != 0 {
-		return nil // label not found
+	if dim <= 0 {
+		return nil
 	}
 	outData := make([]float32, dim)
-	for i := 0; i < dim; i++ {
-		outData[i] = float32(*(*C.float)(unsafe.Pointer(uintptr(unsafe.Pointer(&outDataPtr)) + uintptr(i)*unsafe.Sizeof(C.float(0)))))
+	idx.mu.RLock()
+	defer idx.mu.RUnlock()
+	ret := C.get_data_by_label(idx.index, C.size_t(label), (*C.float)(&outData[0]))
+	if ret != 0 {
+		return nil // label not found
 	}
 	return outData
 }
 
+// GetEntryPoint returns the label of the graph entry point, false if the index is empty
+func (idx *Index) GetEntryPoint() (uint32, bool) {
+	var label C.size_t
+	idx.mu.RLock()
+	defer idx.mu.RUnlock()
+	if C.hnsw_get_entry_point(idx.index, &label) != 0 {
+		return 0, false
+	}
+	return uint32(label), true
+}
+
+// GetNeighbors returns the labels of the level-0 neighbors of label
+func (idx *Index) GetNeighbors(label uint32) []uint32 {
+	idx.mu.RLock()
+	defer idx.mu.RUnlock()
+	maxNeighbors := int(C.hnsw_get_max_neighbors(idx.index))
+	if maxNeighbors <= 0 {
+		return nil
+	}
+	labels := make([]C.size_t, maxNeighbors)
+	n := int(C.hnsw_get_neighbors(idx.index, C.size_t(label), &labels[0], C.size_t(maxNeighbors)))
+	if n <= 0 {
+		return nil
+	}
+	neighbors := make([]uint32, n)
+	for i := 0; i < n; i++ {
+		neighbors[i] = uint32(labels[i])
+	}
+	return neighbors
+}
+
+// GetLabels returns the labels of all elements that are not deleted
+func (idx *Index) GetLabels() []uint32 {
+	idx.mu.RLock()
+	defer idx.mu.RUnlock()
+	count := int(C.get_current_element_count(idx.index))
+	if count <= 0 {
+		return nil
+	}
+	labels := make([]C.size_t, count)
+	n := int(C.hnsw_get_labels(idx.index, &labels[0], C.size_t(count)))
+	result := make([]uint32, n)
+	for i := 0; i < n; i++ {
+		result[i] = uint32(labels[i])
+	}
+	return result
+}
+
+// ResizeIndex changes the capacity of the index, it waits for calls in
+// progress and blocks new ones while the index is reallocated
+func (idx *Index) ResizeIndex(maxElements int) error {
+	idx.mu.Lock()
+	defer idx.mu.Unlock()
+	if idx.index == nil {
+		return fmt.Errorf("index not initialized")
+	}
+	if C.hnsw_resize_index(idx.index, C.size_t(maxElements)) != 0 {
+		return fmt.Errorf("failed to resize index to %d elements", maxElements)
+	}
+	return nil
+}
+
 func (idx *Index) GetMaxElements() int {
+	idx.mu.RLock()
+	defer idx.mu.RUnlock()
 	return int(C.get_max_elements(idx.index))
 }
 
 func (idx *Index) GetCurrentElementCount() int {
+	idx.mu.RLock()
+	defer idx.mu.RUnlock()
 	return int(C.get_current_element_count(idx.index))
 }
 
 func (idx *Index) GetDeletedCount() int {
+	idx.mu.RLock()
+	defer idx.mu.RUnlock()
 	return int(C.get_deleted_count(idx.index))
 }
 
 func (idx *Index) GetAvgHops() float32 {
+	idx.mu.RLock()
+	defer idx.mu.RUnlock()
 	return float32(C.get_avg_hops(idx.index))
 }
 
 func (idx *Index) GetAvgDistComputations() float32 {
+	idx.mu.RLock()
+	defer idx.mu.RUnlock()
 	return float32(C.get_avg_dist_computations(idx.index))
 }
 
 func (idx *Index) GetQueryCount() int {
+	idx.mu.RLock()
+	defer idx.mu.RUnlock()
 	return int(C.get_query_count(idx.index))
 }
@@ -1285,7 +1285,7 @@ public:
 
     std::unique_lock<std::mutex> lock_el(link_list_locks_[cur_c]);
     int curlevel = getRandomLevel(mult_);
-    if (level > 0)
+    if (level >= 0)
       curlevel = level;
 
     element_levels_[cur_c] = curlevel;
@@ -1380,6 +1380,14 @@ public:
   std::priority_queue<std::pair<dist_t, labeltype>>
   searchKnn(const void *query_data, size_t k,
             BaseFilterFunctor *isIdAllowed = nullptr) const {
+    return searchKnnWithEf(query_data, k, ef_, isIdAllowed);
+  }
+
+  // searchKnnWithEf searches with the given ef instead of ef_, so a single
+  // query can be tuned without changing the index for concurrent searches
+  std::priority_queue<std::pair<dist_t, labeltype>>
+  searchKnnWithEf(const void *query_data, size_t k, size_t ef,
+                  BaseFilterFunctor *isIdAllowed = nullptr) const {
     std::priority_queue<std::pair<dist_t, labeltype>> result;
     if (cur_element_count == 0)
       return result;
@@ -1424,10 +1432,10 @@ public:
     bool bare_bone_search = !num_deleted_ && !isIdAllowed;
     if (bare_bone_search) {
       top_candidates = searchBaseLayerST<true>(currObj, query_data,
-                                               std::max(ef_, k), isIdAllowed);
+                                               std::max(ef, k), isIdAllowed);
     } else {
       top_candidates = searchBaseLayerST<false>(currObj, query_data,
-                                                std::max(ef_, k), isIdAllowed);
+                                                std::max(ef, k), isIdAllowed);
     }
 
     while (top_candidates.size() > k) {
@@ -1,10 +1,12 @@
 package index
 
+import "oasisdb/pkg/vectorindex"
+
 const (
-	L2Space      SpaceType = "l2"
-	IPSpace      SpaceType = "ip"
-	CosSpace     SpaceType = "cos"
-	HammingSpace SpaceType = "hamming"
+	L2Space      = vectorindex.L2Space
+	IPSpace      = vectorindex.IPSpace
+	CosSpace     = vectorindex.CosSpace
+	HammingSpace = vectorindex.HammingSpace
 )
 
 const (
@@ -12,6 +14,8 @@ const (
 	IVFFLATIndex IndexType = "ivf_flat"
 	IVFPQIndex   IndexType = "ivfpq"
 	FLATIndex    IndexType = "flat"
+	FLATGPUIndex IndexType = "flat_gpu"
+	DISKANNIndex IndexType = "diskann"
 )
 
 // HNSW specific constants
@@ -20,6 +24,11 @@ const (
 	DEFAULT_EF_CONSTRUCTION = 200
 	DEFAULT_MAX_ELEMENTS    = 100000
 	DEFAULT_BUILD_THREADS   = 4
+	HNSW_GROWTH_FACTOR      = 2 // capacity multiplier when a full index grows
+
+	HNSW_BULK_EF_FULL        = 100000 // points a bulk build links with the default efConstruction
+	HNSW_BULK_EF_MIN         = 100    // lowest efConstruction a bulk build tunes down to
+	HNSW_BUILD_PROGRESS_STEP = 1024   // inserted points between two progress reports of a bulk build
 )
 
 // IVF specific constants
@@ -27,6 +36,8 @@ const (
 	DEFAULT_MAX_KMEANS_ITER = 40
 	DEFAULT_NLIST           = 100
 	DEFAULT_NPROBE          = 10
+	IVF_PARALLEL_SCAN_MIN   = 4096 // vectors in the probed lists from which a query is scanned in parallel
+	IVF_AUTO_NPROBE_GAP     = 0.5  // share of the centroid distance span within which auto_nprobe probes a list
 )
 
 // IVFPQ specific constants
@@ -34,3 +45,19 @@ const (
 	DEFAULT_IVFPQ_M     = 8
 	DEFAULT_IVFPQ_NBITS = 8
 )
+
+// Flat GPU specific constants
+const (
+	DEFAULT_GPU_MIN_VECTORS = 10000 // vectors from which distances are computed on the GPU
+	DEFAULT_GPU_BATCH       = 65536 // vectors per batch of distances on the GPU
+)
+
+// DiskANN specific constants
+const (
+	DEFAULT_DISKANN_MAX_DEGREE      = 32
+	DEFAULT_DISKANN_BUILD_LIST      = 64
+	DEFAULT_DISKANN_SEARCH_LIST     = 64
+	DEFAULT_DISKANN_ALPHA           = 1.2
+	DEFAULT_DISKANN_CACHE_NODES     = 4096
+	DEFAULT_DISKANN_BUILD_THRESHOLD = 10000 // delta vectors that trigger a background build
+)
@@ -0,0 +1,593 @@
+package index
+
+import (
+	"encoding/gob"
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"sort"
+	"sync"
+
+	"oasisdb/pkg/errors"
+	"oasisdb/pkg/logger"
+)
+
+// diskannIndex is a DiskANN style index for collections larger than memory.
+// Its Vamana graph and vectors live in a memory-mapped file and only the
+// navigation cache, the IDs and recent writes are held in memory. New vectors
+// go to an in-memory flat delta that is searched exhaustively, once it holds
+// buildThreshold vectors the graph is rebuilt with them in the background
+// while searches keep using the current graph. Deletes of graph nodes are
+// tombstones until the next build or a vacuum.
+type diskannIndex struct {
+	config         *IndexConfig
+	maxDegree      int
+	buildList      int
+	searchList     int
+	alpha          float32
+	cacheNodes     int
+	buildThreshold int
+
+	mu      sync.RWMutex
+	graph   *diskannGraph     // nil until the first build
+	ids     []string          // document ID of each graph node
+	nodes   map[string]uint32 // graph node of each live ID
+	deleted map[uint32]bool   // tombstoned graph nodes
+
+	deltaIDs     []string
+	deltaVectors [][]float32
+	deltaPos     map[string]int
+
+	dir       string          // directory for graph files, that of the index file once known
+	buildDone chan struct{}   // closed when the background build ends, nil if none runs
+	changed   map[string]bool // IDs written since the background build started
+}
+
+// diskannMeta is saved after the graph records
+type diskannMeta struct {
+	IDs          []string
+	Deleted      []uint32
+	DeltaIDs     []string
+	DeltaVectors [][]float32
+}
+
+// diskannSource is the set of vectors a graph is built from, live graph nodes
+// of an existing graph followed by delta vectors
+type diskannSource struct {
+	graph   *diskannGraph
+	nodes   []uint32
+	ids     []string
+	vectors [][]float32
+}
+
+func (s *diskannSource) vector(i uint32) []float32 {
+	if int(i) < len(s.nodes) {
+		return s.graph.vector(s.nodes[i])
+	}
+	return s.vectors[int(i)-len(s.nodes)]
+}
+
+func newDiskANNIndex(config *IndexConfig) (VectorIndex, error) {
+	if config.Dimension <= 0 {
+		return nil, errors.ErrInvalidDimension
+	}
+	d := &diskannIndex{
+		config:         config,
+		maxDegree:      DEFAULT_DISKANN_MAX_DEGREE,
+		buildList:      DEFAULT_DISKANN_BUILD_LIST,
+		searchList:     DEFAULT_DISKANN_SEARCH_LIST,
+		alpha:          DEFAULT_DISKANN_ALPHA,
+		cacheNodes:     DEFAULT_DISKANN_CACHE_NODES,
+		buildThreshold: DEFAULT_DISKANN_BUILD_THRESHOLD,
+		nodes:          make(map[string]uint32),
+		deleted:        make(map[uint32]bool),
+		deltaPos:       make(map[string]int),
+		dir:            os.TempDir(),
+	}
+	for key, target := range map[string]*int{
+		"maxDegree":      &d.maxDegree,
+		"buildList":      &d.buildList,
+		"searchList":     &d.searchList,
+		"cacheNodes":     &d.cacheNodes,
+		"buildThreshold": &d.buildThreshold,
+	} {
+		if val, ok := config.Parameters[key]; ok {
+			v, ok := intParam(val)
+			if !ok || v < 0 || (v == 0 && key != "cacheNodes" && key != "buildThreshold") {
+				return nil, fmt.Errorf("%w: diskann %s must be a positive integer", errors.ErrInvalidParameter, key)
+			}
+			*target = v
+		}
+	}
+	if val, ok := config.Parameters["alpha"]; ok {
+		v, ok := val.(float64)
+		if !ok || v < 1 {
+			return nil, fmt.Errorf("%w: diskann alpha must be at least 1", errors.ErrInvalidParameter)
+		}
+		d.alpha = float32(v)
+	}
+	return d, nil
+}
+
+func (d *diskannIndex) Add(id string, vector []float32) error {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if err := d.add(id, vector); err != nil {
+		return err
+	}
+	d.maybeBuild()
+	return nil
+}
+
+func (d *diskannIndex) AddBatch(ids []string, vectors [][]float32) error {
+	if len(ids) != len(vectors) {
+		return errors.ErrMisMatchKeysAndValues
+	}
+	for _, vector := range vectors {
+		if len(vector) != d.config.Dimension {
+			return errors.ErrInvalidDimension
+		}
+	}
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	for i := range ids {
+		if err := d.add(ids[i], vectors[i]); err != nil {
+			return err
+		}
+	}
+	d.maybeBuild()
+	return nil
+}
+
+// add writes a vector to the delta, replacing the vector of an existing ID,
+// the caller must hold d.mu
+func (d *diskannIndex) add(id string, vector []float32) error {
+	if len(vector) != d.config.Dimension {
+		return errors.ErrInvalidDimension
+	}
+	vector = append([]float32(nil), vector...)
+	d.tombstone(id)
+	if i, ok := d.deltaPos[id]; ok {
+		d.deltaVectors[i] = vector
+	} else {
+		d.deltaPos[id] = len(d.deltaIDs)
+		d.deltaIDs = append(d.deltaIDs, id)
+		d.deltaVectors = append(d.deltaVectors, vector)
+	}
+	if d.changed != nil {
+		d.changed[id] = true
+	}
+	return nil
+}
+
+// tombstone marks the graph node of an ID deleted, the caller must hold d.mu
+func (d *diskannIndex) tombstone(id string) bool {
+	node, ok := d.nodes[id]
+	if ok {
+		delete(d.nodes, id)
+		d.deleted[node] = true
+	}
+	return ok
+}
+
+// removeDelta removes an ID from the delta, the caller must hold d.mu
+func (d *diskannIndex) removeDelta(id string) bool {
+	i, ok := d.deltaPos[id]
+	if !ok {
+		return false
+	}
+	last := len(d.deltaIDs) - 1
+	d.deltaIDs[i], d.deltaVectors[i] = d.deltaIDs[last], d.deltaVectors[last]
+	d.deltaPos[d.deltaIDs[i]] = i
+	d.deltaIDs, d.deltaVectors = d.deltaIDs[:last], d.deltaVectors[:last]
+	delete(d.deltaPos, id)
+	return true
+}
+
+// Build replaces the contents of the index with a graph of the vectors
+func (d *diskannIndex) Build(ids []string, vectors [][]float32) error {
+	if len(ids) != len(vectors) {
+		return errors.ErrMisMatchKeysAndValues
+	}
+	for _, vector := range vectors {
+		if len(vector) != d.config.Dimension {
+			return errors.ErrInvalidDimension
+		}
+	}
+	d.lockIdle()
+	defer d.mu.Unlock()
+
+	// the last vector of a repeated ID wins
+	source := &diskannSource{}
+	positions := make(map[string]int, len(ids))
+	for i, id := range ids {
+		if j, ok := positions[id]; ok {
+			source.vectors[j] = vectors[i]
+			continue
+		}
+		positions[id] = len(source.ids)
+		source.ids = append(source.ids, id)
+		source.vectors = append(source.vectors, vectors[i])
+	}
+	graph, err := d.buildGraph(source, d.dir)
+	if err != nil {
+		return err
+	}
+	d.deltaIDs, d.deltaVectors, d.deltaPos = nil, nil, make(map[string]int)
+	d.install(graph, source.ids, nil)
+	return nil
+}
+
+// lockIdle locks d.mu once no background build runs
+func (d *diskannIndex) lockIdle() {
+	for {
+		d.mu.Lock()
+		done := d.buildDone
+		if done == nil {
+			return
+		}
+		d.mu.Unlock()
+		<-done
+	}
+}
+
+// snapshot returns the live graph nodes and the delta as a build source, the
+// caller must hold d.mu
+func (d *diskannIndex) snapshot() *diskannSource {
+	source := &diskannSource{graph: d.graph}
+	if d.graph != nil {
+		for node, id := range d.ids {
+			if !d.deleted[uint32(node)] {
+				source.nodes = append(source.nodes, uint32(node))
+				source.ids = append(source.ids, id)
+			}
+		}
+	}
+	source.ids = append(source.ids, d.deltaIDs...)
+	source.vectors = append([][]float32(nil), d.deltaVectors...)
+	return source
+}
+
+// maybeBuild starts a background build once the delta reached
+// buildThreshold, the caller must hold d.mu
+func (d *diskannIndex) maybeBuild() {
+	if d.buildThreshold <= 0 || len(d.deltaIDs) < d.buildThreshold || d.buildDone != nil {
+		return
+	}
+	source, dir := d.snapshot(), d.dir
+	merged := append([]string(nil), d.deltaIDs...)
+	done := make(chan struct{})
+	d.buildDone = done
+	d.changed = make(map[string]bool)
+
+	go func() {
+		defer close(done)
+		graph, err := d.buildGraph(source, dir)
+
+		d.mu.Lock()
+		defer d.mu.Unlock()
+		d.buildDone = nil
+		if err != nil {
+			d.changed = nil
+			logger.Error("Failed to build diskann graph", "error", err)
+			return
+		}
+		d.install(graph, source.ids, merged)
+		logger.Info("Built diskann graph", "nodes", len(source.ids), "merged", len(merged))
+		// writes made meanwhile may have filled the delta again
+		d.maybeBuild()
+	}()
+}
+
+// buildGraph builds a graph of the source vectors into an unlinked file in
+// dir and maps it
+func (d *diskannIndex) buildGraph(source *diskannSource, dir string) (*diskannGraph, error) {
+	entry, adjacency := buildVamana(len(source.ids), d.config.Dimension, source.vector,
+		d.config.SpaceType, d.maxDegree, d.buildList, d.alpha)
+
+	file, err := os.CreateTemp(dir, "diskann-*.graph")
+	if err != nil {
+		return nil, fmt.Errorf("failed to create diskann graph file: %w", err)
+	}
+	// the mapping keeps the data, the name is only needed to write it
+	defer os.Remove(file.Name())
+	defer file.Close()
+
+	if err := writeDiskannGraph(file, d.config.Dimension, d.maxDegree, entry, source.vector, adjacency); err != nil {
+		return nil, fmt.Errorf("failed to write diskann graph: %w", err)
+	}
+	if _, err := file.Seek(0, io.SeekStart); err != nil {
+		return nil, err
+	}
+	graph, _, err := openDiskannGraph(file, d.cacheNodes)
+	return graph, err
+}
+
+// install swaps in a graph built from ids and drops the merged IDs from the
+// delta, IDs written since the build started keep their newer state. The
+// caller must hold d.mu
+func (d *diskannIndex) install(graph *diskannGraph, ids []string, merged []string) {
+	old := d.graph
+	d.graph = graph
+	d.ids = ids
+	d.nodes = make(map[string]uint32, len(ids))
+	d.deleted = make(map[uint32]bool)
+	for node, id := range ids {
+		d.nodes[id] = uint32(node)
+	}
+	for id := range d.changed {
+		d.tombstone(id)
+	}
+	for _, id := range merged {
+		if !d.changed[id] {
+			d.removeDelta(id)
+		}
+	}
+	d.changed = nil
+	if err := old.close(); err != nil {
+		logger.Error("Failed to unmap diskann graph", "error", err)
+	}
+}
+
+func (d *diskannIndex) Delete(id string) error {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	inDelta := d.removeDelta(id)
+	if !d.tombstone(id) && !inDelta {
+		return errors.ErrDocumentNotFound
+	}
+	if d.changed != nil {
+		d.changed[id] = true
+	}
+	return nil
+}
+
+func (d *diskannIndex) Search(vector []float32, k int) (*SearchResult, error) {
+	return d.search(vector, k, 0)
+}
+
+// SearchWithParams searches with the searchlist of params for this query only
+func (d *diskannIndex) SearchWithParams(vector []float32, k int, params map[string]any) (*SearchResult, error) {
+	searchList := 0
+	for key, val := range params {
+		switch key {
+		case "searchlist":
+			v, ok := intParam(val)
+			if !ok || v <= 0 {
+				return nil, fmt.Errorf("%w: searchlist must be a positive integer", errors.ErrInvalidParameter)
+			}
+			searchList = v
+		default:
+			return nil, fmt.Errorf("%w: unknown diskann search parameter %q", errors.ErrInvalidParameter, key)
+		}
+	}
+	return d.search(vector, k, searchList)
+}
+
+// search walks the graph with a candidate list of searchList nodes, 0 uses
+// the searchList of the index, and scans the delta
+func (d *diskannIndex) search(vector []float32, k, searchList int) (*SearchResult, error) {
+	if len(vector) != d.config.Dimension {
+		return nil, errors.ErrInvalidDimension
+	}
+	d.mu.RLock()
+	defer d.mu.RUnlock()
+	if searchList <= 0 {
+		searchList = d.searchList
+	}
+
+	var candidates []diskannCandidate
+	var ids []string
+	if d.graph != nil {
+		nearest, _ := greedySearch(vector, d.graph.entry, max(searchList, k), d.config.SpaceType,
+			d.graph.vector, d.graph.neighbors)
+		for _, c := range nearest {
+			if !d.deleted[c.node] {
+				candidates = append(candidates, diskannCandidate{node: uint32(len(ids)), dist: c.dist})
+				ids = append(ids, d.ids[c.node])
+			}
+		}
+	}
+	for i, deltaVector := range d.deltaVectors {
+		candidates = append(candidates, diskannCandidate{node: uint32(len(ids)), dist: distance(vector, deltaVector, d.config.SpaceType)})
+		ids = append(ids, d.deltaIDs[i])
+	}
+
+	sort.Slice(candidates, func(i, j int) bool { return candidates[i].dist < candidates[j].dist })
+	k = min(k, len(candidates))
+	result := &SearchResult{IDs: make([]string, k), Distances: make([]float32, k)}
+	for i := 0; i < k; i++ {
+		result.IDs[i] = ids[candidates[i].node]
+		result.Distances[i] = candidates[i].dist
+	}
+	return result, nil
+}
+
+// ExactSearch compares the query with every live vector
+func (d *diskannIndex) ExactSearch(vector []float32, k int) (*SearchResult, error) {
+	if len(vector) != d.config.Dimension {
+		return nil, errors.ErrInvalidDimension
+	}
+	d.mu.RLock()
+	defer d.mu.RUnlock()
+	var ids []string
+	var vectors [][]float32
+	d.iterate(func(id string, vector []float32) bool {
+		ids = append(ids, id)
+		vectors = append(vectors, vector)
+		return true
+	})
+	return exactTopK(vector, k, d.config.SpaceType, ids, vectors), nil
+}
+
+func (d *diskannIndex) GetVector(id string) ([]float32, error) {
+	d.mu.RLock()
+	defer d.mu.RUnlock()
+	if i, ok := d.deltaPos[id]; ok {
+		return append([]float32(nil), d.deltaVectors[i]...), nil
+	}
+	if node, ok := d.nodes[id]; ok {
+		return append([]float32(nil), d.graph.vector(node)...), nil
+	}
+	return nil, errors.ErrDocumentNotFound
+}
+
+func (d *diskannIndex) Count() int {
+	d.mu.RLock()
+	defer d.mu.RUnlock()
+	return len(d.nodes) + len(d.deltaIDs)
+}
+
+func (d *diskannIndex) Stats() IndexStats {
+	d.mu.RLock()
+	defer d.mu.RUnlock()
+	return IndexStats{
+		Type:      DISKANNIndex,
+		Dimension: d.config.Dimension,
+		Count:     len(d.nodes) + len(d.deltaIDs),
+		Deleted:   len(d.deleted),
+		Params: map[string]any{
+			"max_degree":      d.maxDegree,
+			"build_list":      d.buildList,
+			"search_list":     d.searchList,
+			"alpha":           d.alpha,
+			"cache_nodes":     d.cacheNodes,
+			"build_threshold": d.buildThreshold,
+			"graph_nodes":     len(d.ids),
+			"delta":           len(d.deltaIDs),
+			"building":        d.buildDone != nil,
+		},
+	}
+}
+
+// Iterate visits the graph nodes in node order, then the delta
+func (d *diskannIndex) Iterate(fn func(id string, vector []float32) bool) error {
+	d.mu.RLock()
+	defer d.mu.RUnlock()
+	d.iterate(func(id string, vector []float32) bool {
+		return fn(id, append([]float32(nil), vector...))
+	})
+	return nil
+}
+
+// iterate passes vectors of graph nodes straight from the mapping, they are
+// only valid while d.mu is held
+func (d *diskannIndex) iterate(fn func(id string, vector []float32) bool) {
+	for node, id := range d.ids {
+		if d.deleted[uint32(node)] {
+			continue
+		}
+		if !fn(id, d.graph.vector(uint32(node))) {
+			return
+		}
+	}
+	for i, id := range d.deltaIDs {
+		if !fn(id, d.deltaVectors[i]) {
+			return
+		}
+	}
+}
+
+// SetParams sets the searchlist used by searches
+func (d *diskannIndex) SetParams(params map[string]any) error {
+	if len(params) == 0 {
+		return errors.ErrEmptyParameter
+	}
+	for key, val := range params {
+		switch key {
+		case "searchlist":
+			v, ok := intParam(val)
+			if !ok || v <= 0 {
+				return errors.ErrInvalidParameter
+			}
+			d.mu.Lock()
+			d.searchList = v
+			d.mu.Unlock()
+		default:
+			return errors.ErrInvalidParameter
+		}
+	}
+	return nil
+}
+
+// Load maps the graph of an index file, graph files of later builds are
+// created next to it
+func (d *diskannIndex) Load(filePath string) error {
+	file, err := os.Open(filePath)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+	graph, metaOffset, err := openDiskannGraph(file, d.cacheNodes)
+	if err != nil {
+		return err
+	}
+	if _, err := file.Seek(metaOffset, io.SeekStart); err != nil {
+		graph.close()
+		return err
+	}
+	var meta diskannMeta
+	if err := gob.NewDecoder(file).Decode(&meta); err != nil {
+		graph.close()
+		return fmt.Errorf("failed to decode diskann metadata: %w", err)
+	}
+
+	d.lockIdle()
+	defer d.mu.Unlock()
+	d.dir = path.Dir(filePath)
+	d.install(graph, meta.IDs, nil)
+	for _, node := range meta.Deleted {
+		d.deleted[node] = true
+		delete(d.nodes, meta.IDs[node])
+	}
+	d.deltaIDs, d.deltaVectors = meta.DeltaIDs, meta.DeltaVectors
+	d.deltaPos = make(map[string]int, len(meta.DeltaIDs))
+	for i, id := range meta.DeltaIDs {
+		d.deltaPos[id] = i
+	}
+	return nil
+}
+
+// Save writes the graph records followed by the IDs, tombstones and delta,
+// the graph records are copied from the mapping
+func (d *diskannIndex) Save(filePath string) error {
+	d.mu.Lock()
+	d.dir = path.Dir(filePath)
+	d.mu.Unlock()
+
+	d.mu.RLock()
+	defer d.mu.RUnlock()
+
+	file, err := os.Create(filePath)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+	if d.graph != nil {
+		_, err = file.Write(d.graph.data)
+	} else {
+		err = writeDiskannGraph(file, d.config.Dimension, d.maxDegree, 0, nil, nil)
+	}
+	if err != nil {
+		return err
+	}
+
+	meta := diskannMeta{IDs: d.ids, DeltaIDs: d.deltaIDs, DeltaVectors: d.deltaVectors}
+	for node := range d.deleted {
+		meta.Deleted = append(meta.Deleted, node)
+	}
+	if err := gob.NewEncoder(file).Encode(&meta); err != nil {
+		return err
+	}
+	return nil
+}
+
+// Close waits for a background build and unmaps the graph
+func (d *diskannIndex) Close() error {
+	d.lockIdle()
+	defer d.mu.Unlock()
+	err := d.graph.close()
+	d.graph = nil
+	return err
+}
@@ -0,0 +1,330 @@
+package index
+
+import (
+	"bufio"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"math"
+	"math/rand"
+	"os"
+	"sort"
+	"syscall"
+	"unsafe"
+)
+
+// A DiskANN graph file starts with a header and holds one fixed size record
+// per node, the vector followed by the degree and the neighbor list padded to
+// the max degree. Integers and floats are in host byte order so records are
+// read in place from the mapping:
+//
+//	header  magic, version, dimension, max degree, nodes, entry node
+//	nodes   nodes * (dimension*4 + 4 + max degree*4) bytes
+//
+// The index appends its metadata after the records when it saves.
+const (
+	diskannMagic      = "OASISDAN"
+	diskannVersion    = 1
+	diskannHeaderSize = 64
+)
+
+// diskannCandidate is a graph node and its distance to a query
+type diskannCandidate struct {
+	node uint32
+	dist float32
+}
+
+// diskannGraph is a Vamana graph read from a memory-mapped file, the nodes
+// closest to the entry node are copied to memory to navigate without page
+// faults
+type diskannGraph struct {
+	data     []byte // mapped header and node records
+	dim      int
+	degree   int
+	nodes    int
+	entry    uint32
+	nodeSize int
+
+	cache          map[uint32]int // cached node to its position in the cache slices
+	cacheVectors   [][]float32
+	cacheNeighbors [][]uint32
+}
+
+func diskannNodeSize(dim, degree int) int {
+	return dim*4 + 4 + degree*4
+}
+
+// openDiskannGraph maps the graph at the start of file and caches up to
+// cacheNodes nodes, it returns a nil graph for a file without nodes. The
+// mapping stays valid after the file is closed or removed
+func openDiskannGraph(file *os.File, cacheNodes int) (*diskannGraph, int64, error) {
+	header := make([]byte, diskannHeaderSize)
+	if _, err := io.ReadFull(file, header); err != nil {
+		return nil, 0, fmt.Errorf("failed to read diskann header: %w", err)
+	}
+	if string(header[:8]) != diskannMagic {
+		return nil, 0, fmt.Errorf("not a diskann index file")
+	}
+	if version := binary.NativeEndian.Uint32(header[8:]); version != diskannVersion {
+		return nil, 0, fmt.Errorf("unsupported diskann index version %d", version)
+	}
+	g := &diskannGraph{
+		dim:    int(binary.NativeEndian.Uint32(header[12:])),
+		degree: int(binary.NativeEndian.Uint32(header[16:])),
+		nodes:  int(binary.NativeEndian.Uint32(header[20:])),
+		entry:  binary.NativeEndian.Uint32(header[24:]),
+	}
+	g.nodeSize = diskannNodeSize(g.dim, g.degree)
+	size := int64(diskannHeaderSize) + int64(g.nodes)*int64(g.nodeSize)
+	if g.nodes == 0 {
+		return nil, size, nil
+	}
+
+	info, err := file.Stat()
+	if err != nil {
+		return nil, 0, err
+	}
+	if info.Size() < size {
+		return nil, 0, fmt.Errorf("diskann index file is truncated")
+	}
+	g.data, err = syscall.Mmap(int(file.Fd()), 0, int(size), syscall.PROT_READ, syscall.MAP_SHARED)
+	if err != nil {
+		return nil, 0, fmt.Errorf("failed to map diskann index file: %w", err)
+	}
+	g.warmCache(cacheNodes)
+	return g, size, nil
+}
+
+// warmCache copies the nodes nearest to the entry node in hops, which every
+// search passes through, to memory
+func (g *diskannGraph) warmCache(cacheNodes int) {
+	g.cache = make(map[uint32]int)
+	if cacheNodes <= 0 {
+		return
+	}
+	queue := []uint32{g.entry}
+	seen := map[uint32]bool{g.entry: true}
+	for len(queue) > 0 && len(g.cache) < cacheNodes {
+		node := queue[0]
+		queue = queue[1:]
+		vector, neighbors := g.vector(node), g.neighbors(node)
+		g.cache[node] = len(g.cacheVectors)
+		g.cacheVectors = append(g.cacheVectors, append([]float32(nil), vector...))
+		g.cacheNeighbors = append(g.cacheNeighbors, append([]uint32(nil), neighbors...))
+		for _, neighbor := range neighbors {
+			if !seen[neighbor] {
+				seen[neighbor] = true
+				queue = append(queue, neighbor)
+			}
+		}
+	}
+}
+
+func (g *diskannGraph) record(node uint32) []byte {
+	offset := diskannHeaderSize + int(node)*g.nodeSize
+	return g.data[offset : offset+g.nodeSize]
+}
+
+// vector returns the vector of a node, it must not be modified
+func (g *diskannGraph) vector(node uint32) []float32 {
+	if i, ok := g.cache[node]; ok {
+		return g.cacheVectors[i]
+	}
+	record := g.record(node)
+	return unsafe.Slice((*float32)(unsafe.Pointer(&record[0])), g.dim)
+}
+
+// neighbors returns the out-neighbors of a node, it must not be modified
+func (g *diskannGraph) neighbors(node uint32) []uint32 {
+	if i, ok := g.cache[node]; ok {
+		return g.cacheNeighbors[i]
+	}
+	record := g.record(node)
+	degree := binary.NativeEndian.Uint32(record[g.dim*4:])
+	if degree == 0 {
+		return nil
+	}
+	return unsafe.Slice((*uint32)(unsafe.Pointer(&record[g.dim*4+4])), degree)
+}
+
+func (g *diskannGraph) close() error {
+	if g == nil || g.data == nil {
+		return nil
+	}
+	data := g.data
+	g.data = nil
+	return syscall.Munmap(data)
+}
+
+// writeDiskannGraph writes the header and node records of a graph
+func writeDiskannGraph(w io.Writer, dim, degree int, entry uint32, vector func(node uint32) []float32, graph [][]uint32) error {
+	bw := bufio.NewWriter(w)
+	header := make([]byte, diskannHeaderSize)
+	copy(header, diskannMagic)
+	binary.NativeEndian.PutUint32(header[8:], diskannVersion)
+	binary.NativeEndian.PutUint32(header[12:], uint32(dim))
+	binary.NativeEndian.PutUint32(header[16:], uint32(degree))
+	binary.NativeEndian.PutUint32(header[20:], uint32(len(graph)))
+	binary.NativeEndian.PutUint32(header[24:], entry)
+	if _, err := bw.Write(header); err != nil {
+		return err
+	}
+
+	record := make([]byte, diskannNodeSize(dim, degree))
+	for node, neighbors := range graph {
+		clear(record)
+		for i, v := range vector(uint32(node)) {
+			binary.NativeEndian.PutUint32(record[i*4:], math.Float32bits(v))
+		}
+		binary.NativeEndian.PutUint32(record[dim*4:], uint32(len(neighbors)))
+		for i, neighbor := range neighbors {
+			binary.NativeEndian.PutUint32(record[dim*4+4+i*4:], neighbor)
+		}
+		if _, err := bw.Write(record); err != nil {
+			return err
+		}
+	}
+	return bw.Flush()
+}
+
+// greedySearch walks the graph from entry towards query keeping the listSize
+// closest nodes seen, it returns them sorted by distance and the nodes it
+// expanded
+func greedySearch(query []float32, entry uint32, listSize int, space SpaceType,
+	vector func(uint32) []float32, neighbors func(uint32) []uint32) (nearest, expanded []diskannCandidate) {
+	list := []diskannCandidate{{node: entry, dist: distance(query, vector(entry), space)}}
+	seen := map[uint32]bool{entry: true}
+	done := map[uint32]bool{}
+	for {
+		next := -1
+		for i, c := range list {
+			if !done[c.node] {
+				next = i
+				break
+			}
+		}
+		if next < 0 {
+			return list, expanded
+		}
+		current := list[next]
+		done[current.node] = true
+		expanded = append(expanded, current)
+
+		for _, neighbor := range neighbors(current.node) {
+			if seen[neighbor] {
+				continue
+			}
+			seen[neighbor] = true
+			dist := distance(query, vector(neighbor), space)
+			if len(list) >= listSize && dist >= list[len(list)-1].dist {
+				continue
+			}
+			i := sort.Search(len(list), func(i int) bool { return list[i].dist > dist })
+			list = append(list, diskannCandidate{})
+			copy(list[i+1:], list[i:])
+			list[i] = diskannCandidate{node: neighbor, dist: dist}
+			if len(list) > listSize {
+				list = list[:listSize]
+			}
+		}
+	}
+}
+
+// robustPrune picks at most degree out-neighbors of node among candidates,
+// a candidate is skipped when a picked neighbor is alpha times closer to it
+// than node, which keeps long edges to other regions of the graph
+func robustPrune(node uint32, candidates []diskannCandidate, alpha float32, degree int, space SpaceType,
+	vector func(uint32) []float32) []uint32 {
+	sort.Slice(candidates, func(i, j int) bool { return candidates[i].dist < candidates[j].dist })
+	neighbors := make([]uint32, 0, degree)
+	picked := map[uint32]bool{node: true}
+	for len(candidates) > 0 && len(neighbors) < degree {
+		best := candidates[0]
+		candidates = candidates[1:]
+		if picked[best.node] {
+			continue
+		}
+		picked[best.node] = true
+		neighbors = append(neighbors, best.node)
+
+		bestVector := vector(best.node)
+		kept := candidates[:0:0]
+		for _, c := range candidates {
+			if !picked[c.node] && alpha*distance(bestVector, vector(c.node), space) > c.dist {
+				kept = append(kept, c)
+			}
+		}
+		candidates = kept
+	}
+	return neighbors
+}
+
+// buildVamana builds a Vamana graph over n vectors in two passes, the first
+// without and the second with alpha pruning, and returns its entry node, the
+// node closest to the mean vector
+func buildVamana(n, dim int, vector func(uint32) []float32, space SpaceType, degree, listSize int, alpha float32) (uint32, [][]uint32) {
+	graph := make([][]uint32, n)
+	if n == 0 {
+		return 0, graph
+	}
+
+	mean := make([]float32, dim)
+	for node := 0; node < n; node++ {
+		for i, v := range vector(uint32(node)) {
+			mean[i] += v / float32(n)
+		}
+	}
+	var entry uint32
+	best := distance(mean, vector(0), L2Space)
+	for node := 1; node < n; node++ {
+		if dist := distance(mean, vector(uint32(node)), L2Space); dist < best {
+			entry, best = uint32(node), dist
+		}
+	}
+
+	// alpha pruning relies on the triangle inequality, negated inner products
+	// don't satisfy it
+	if space == IPSpace {
+		alpha = 1
+	}
+	neighbors := func(node uint32) []uint32 { return graph[node] }
+	order := rand.New(rand.NewSource(1)).Perm(n)
+	for _, a := range []float32{1, alpha} {
+		for _, i := range order {
+			node := uint32(i)
+			nodeVector := vector(node)
+			_, expanded := greedySearch(nodeVector, entry, listSize, space, vector, neighbors)
+			for _, neighbor := range graph[node] {
+				expanded = append(expanded, diskannCandidate{node: neighbor, dist: distance(nodeVector, vector(neighbor), space)})
+			}
+			graph[node] = robustPrune(node, expanded, a, degree, space, vector)
+
+			// add the reverse edges, pruning neighbors that overflow
+			for _, neighbor := range graph[node] {
+				if containsNode(graph[neighbor], node) {
+					continue
+				}
+				if len(graph[neighbor]) < degree {
+					graph[neighbor] = append(graph[neighbor], node)
+					continue
+				}
+				neighborVector := vector(neighbor)
+				candidates := make([]diskannCandidate, 0, degree+1)
+				for _, c := range append(graph[neighbor], node) {
+					candidates = append(candidates, diskannCandidate{node: c, dist: distance(neighborVector, vector(c), space)})
+				}
+				graph[neighbor] = robustPrune(neighbor, candidates, a, degree, space, vector)
+			}
+		}
+	}
+	return entry, graph
+}
+
+func containsNode(nodes []uint32, node uint32) bool {
+	for _, n := range nodes {
+		if n == node {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,170 @@
+package index
+
+import (
+	"fmt"
+	"math/rand"
+	"path"
+	"slices"
+	"testing"
+
+	"oasisdb/internal/config"
+	"oasisdb/pkg/errors"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func randomVectors(rng *rand.Rand, n, dim int) [][]float32 {
+	vectors := make([][]float32, n)
+	for i := range vectors {
+		vectors[i] = make([]float32, dim)
+		for j := range vectors[i] {
+			vectors[i][j] = rng.Float32()
+		}
+	}
+	return vectors
+}
+
+func newTestDiskANN(t *testing.T, params map[string]any) *diskannIndex {
+	index, err := newDiskANNIndex(&IndexConfig{IndexType: DISKANNIndex, Dimension: 8, SpaceType: L2Space, Parameters: params})
+	require.NoError(t, err)
+	d := index.(*diskannIndex)
+	d.dir = t.TempDir()
+	t.Cleanup(func() { d.Close() })
+	return d
+}
+
+func TestDiskANNIndexBuildAndSearch(t *testing.T) {
+	d := newTestDiskANN(t, map[string]any{"maxDegree": float64(16), "cacheNodes": float64(50)})
+	rng := rand.New(rand.NewSource(1))
+	vectors := randomVectors(rng, 500, 8)
+	ids := make([]string, len(vectors))
+	for i := range ids {
+		ids[i] = fmt.Sprint(i)
+	}
+	require.NoError(t, d.Build(ids, vectors))
+	assert.Equal(t, 500, d.Count())
+	assert.Len(t, d.graph.cache, 50)
+
+	// the graph finds nearly all exact neighbors
+	found, total := 0, 0
+	for _, query := range randomVectors(rng, 20, 8) {
+		exact, err := d.ExactSearch(query, 10)
+		require.NoError(t, err)
+		result, err := d.Search(query, 10)
+		require.NoError(t, err)
+		for _, id := range result.IDs {
+			if slices.Contains(exact.IDs, id) {
+				found++
+			}
+		}
+		total += len(exact.IDs)
+	}
+	assert.GreaterOrEqual(t, float64(found)/float64(total), 0.9)
+
+	// vectors of the graph are searched along with the delta, deletes hide them
+	result, err := d.Search(vectors[7], 1)
+	require.NoError(t, err)
+	assert.Equal(t, []string{"7"}, result.IDs)
+	require.NoError(t, d.Delete("7"))
+	result, err = d.Search(vectors[7], 1)
+	require.NoError(t, err)
+	assert.NotEqual(t, []string{"7"}, result.IDs)
+	assert.ErrorIs(t, d.Delete("7"), errors.ErrDocumentNotFound)
+
+	require.NoError(t, d.Add("new", vectors[7]))
+	require.NoError(t, d.Add("3", []float32{9, 9, 9, 9, 9, 9, 9, 9}))
+	result, err = d.SearchWithParams(vectors[7], 1, map[string]any{"searchlist": float64(100)})
+	require.NoError(t, err)
+	assert.Equal(t, []string{"new"}, result.IDs)
+	vector, err := d.GetVector("3")
+	require.NoError(t, err)
+	assert.Equal(t, []float32{9, 9, 9, 9, 9, 9, 9, 9}, vector)
+	assert.Equal(t, 500, d.Count())
+	stats := d.Stats()
+	assert.Equal(t, 2, stats.Deleted)
+	assert.Equal(t, 2, stats.Params["delta"])
+
+	// saving and loading keeps graph, tombstones and delta
+	file := path.Join(t.TempDir(), "index.idx")
+	require.NoError(t, d.Save(file))
+	loaded := newTestDiskANN(t, nil)
+	require.NoError(t, loaded.Load(file))
+	assert.Equal(t, 500, loaded.Count())
+	_, err = loaded.GetVector("7")
+	assert.ErrorIs(t, err, errors.ErrDocumentNotFound)
+	vector, err = loaded.GetVector("3")
+	require.NoError(t, err)
+	assert.Equal(t, []float32{9, 9, 9, 9, 9, 9, 9, 9}, vector)
+	vector, err = loaded.GetVector("100")
+	require.NoError(t, err)
+	assert.Equal(t, vectors[100], vector)
+	result, err = loaded.Search(vectors[100], 1)
+	require.NoError(t, err)
+	assert.Equal(t, []string{"100"}, result.IDs)
+
+	// vacuum merges the delta and drops the tombstones
+	purged, err := loaded.Vacuum()
+	require.NoError(t, err)
+	assert.Equal(t, 2, purged)
+	stats = loaded.Stats()
+	assert.Equal(t, 500, stats.Count)
+	assert.Equal(t, 0, stats.Deleted)
+	assert.Equal(t, 500, stats.Params["graph_nodes"])
+	assert.Equal(t, 0, stats.Params["delta"])
+}
+
+func TestDiskANNIndexBackgroundBuild(t *testing.T) {
+	d := newTestDiskANN(t, map[string]any{"buildThreshold": float64(100)})
+	vectors := randomVectors(rand.New(rand.NewSource(2)), 250, 8)
+	for i, vector := range vectors {
+		require.NoError(t, d.Add(fmt.Sprint(i), vector))
+	}
+	// writes made while a build runs survive it
+	require.NoError(t, d.Delete("0"))
+	require.NoError(t, d.Add("1", vectors[0]))
+
+	d.lockIdle()
+	d.mu.Unlock()
+	stats := d.Stats()
+	assert.Equal(t, 249, stats.Count)
+	assert.Greater(t, stats.Params["graph_nodes"], 0)
+	assert.Less(t, stats.Params["delta"], 100)
+
+	_, err := d.GetVector("0")
+	assert.ErrorIs(t, err, errors.ErrDocumentNotFound)
+	vector, err := d.GetVector("1")
+	require.NoError(t, err)
+	assert.Equal(t, vectors[0], vector)
+	for i := 2; i < len(vectors); i++ {
+		result, err := d.Search(vectors[i], 1)
+		require.NoError(t, err)
+		assert.Equal(t, []string{fmt.Sprint(i)}, result.IDs)
+	}
+}
+
+func TestManagerDiskANNIndex(t *testing.T) {
+	conf := &config.Config{Dir: t.TempDir()}
+	manager, err := NewIndexManager(conf)
+	require.NoError(t, err)
+	_, err = manager.CreateIndex("big", &IndexConfig{IndexType: DISKANNIndex, Dimension: 8, SpaceType: L2Space})
+	require.NoError(t, err)
+	vectors := randomVectors(rand.New(rand.NewSource(3)), 50, 8)
+	ids := make([]string, len(vectors))
+	for i := range ids {
+		ids[i] = fmt.Sprint(i)
+	}
+	require.NoError(t, manager.BuildIndex("big", ids, vectors))
+	require.NoError(t, manager.AddVector("big", "extra", vectors[0]))
+	require.NoError(t, manager.Close())
+
+	manager, err = NewIndexManager(conf)
+	require.NoError(t, err)
+	defer manager.Close()
+	count, err := manager.Count("big")
+	require.NoError(t, err)
+	assert.Equal(t, 51, count)
+	vector, err := manager.GetVector("big", "extra")
+	require.NoError(t, err)
+	assert.Equal(t, vectors[0], vector)
+}
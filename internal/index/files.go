@@ -0,0 +1,279 @@
+package index
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	stderrors "errors"
+	"fmt"
+	"io"
+	"net/url"
+	"os"
+	"path"
+	"strings"
+
+	"oasisdb/internal/storage/wal"
+	"oasisdb/pkg/logger"
+)
+
+// fileKey names the files of a collection's index. Collection names may hold
+// characters file names can't, e.g. the ':' of tenant collections, so the
+// files are named by a hash of the name and the config records the name
+func fileKey(collectionName string) string {
+	sum := sha256.Sum256([]byte(collectionName))
+	return hex.EncodeToString(sum[:16])
+}
+
+// configFile is the config a checkpointed index is loaded with
+func (m *Manager) configFile(collectionName string) string {
+	return path.Join(m.conf.IndexDir(), fileKey(collectionName)+".conf")
+}
+
+// indexFile is the checkpoint of a collection's index
+func (m *Manager) indexFile(collectionName string) string {
+	return path.Join(m.conf.IndexDir(), "index_"+fileKey(collectionName)+".idx")
+}
+
+// walDir is the directory holding the WAL segments of a collection
+func (m *Manager) walDir(collectionName string) string {
+	return path.Join(m.conf.IndexWALDir(), fileKey(collectionName))
+}
+
+// indexConfigFile is the content of a config file, files written before
+// they were named by hash have no collection
+type indexConfigFile struct {
+	Collection string `json:"collection,omitempty"`
+	*IndexConfig
+}
+
+// readConfigFile reads a config file, the collection is empty for files
+// written before they were named by hash
+func readConfigFile(file string) (*indexConfigFile, error) {
+	data, err := os.ReadFile(file)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read index config: %w", err)
+	}
+	var config indexConfigFile
+	if err := json.Unmarshal(data, &config); err != nil {
+		return nil, fmt.Errorf("failed to parse index config: %w", err)
+	}
+	if config.IndexConfig == nil {
+		return nil, fmt.Errorf("failed to parse index config: no index settings")
+	}
+	return &config, nil
+}
+
+// migrateFiles renames the files of indices named by collection before they
+// were named by hash. Every step can be repeated, so a migration a crash
+// interrupted is finished by the next start
+func (m *Manager) migrateFiles() error {
+	entries, err := os.ReadDir(m.conf.IndexDir())
+	if err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	migrated := 0
+	for _, entry := range entries {
+		if entry.IsDir() || !strings.HasSuffix(entry.Name(), ".conf") {
+			continue
+		}
+		file := path.Join(m.conf.IndexDir(), entry.Name())
+		config, err := readConfigFile(file)
+		if err != nil {
+			// collected as garbage once the collections are reconciled
+			logger.Warn("Skip invalid index config", "file", entry.Name(), "error", err)
+			continue
+		}
+		if config.Collection != "" {
+			continue
+		}
+
+		collectionName := strings.TrimSuffix(entry.Name(), ".conf")
+		if err := m.migrateIndexFile(collectionName); err != nil {
+			logger.Error("Failed to migrate index file", "collection", collectionName, "error", err)
+			continue
+		}
+		// the new config is written before the old one goes, a config is
+		// never lost
+		if err := m.writeIndexConfig(collectionName, config.IndexConfig); err != nil {
+			return err
+		}
+		if err := os.Remove(file); err != nil {
+			return err
+		}
+		migrated++
+	}
+
+	walDirs, err := m.migrateWALDirs()
+	if err != nil {
+		return err
+	}
+	walFiles, err := m.migrateWALFiles()
+	if err != nil {
+		return err
+	}
+	if migrated+walDirs+walFiles > 0 {
+		logger.Info("Migrated index files to hashed names", "configs", migrated, "wal_dirs", walDirs, "wal_files", walFiles)
+	}
+	return nil
+}
+
+// migrateIndexFile renames the checkpoint of a collection, one moved to the
+// cold tier is fetched first as its object is named by the file
+func (m *Manager) migrateIndexFile(collectionName string) error {
+	legacy := path.Join(m.conf.IndexDir(), fmt.Sprintf("index_%d.idx", stringToInt32(collectionName)))
+	if !m.checkpointed(legacy) {
+		return nil
+	}
+	if _, err := os.Stat(legacy); os.IsNotExist(err) && m.conf.ColdTier == nil {
+		return fmt.Errorf("index %s is in the cold tier, which isn't configured", path.Base(legacy))
+	}
+	if err := m.fetchIndexFile(legacy); err != nil {
+		return err
+	}
+	if err := os.Rename(legacy, m.indexFile(collectionName)); err != nil {
+		return err
+	}
+	// drops the copy and the marker of the cold tier
+	m.removeIndexFile(legacy)
+	return nil
+}
+
+// migrateWALDirs renames the WAL directories named by escaped collection
+// names, the collection is read from their first entry as the directory of a
+// create a crash interrupted has no config
+func (m *Manager) migrateWALDirs() (int, error) {
+	entries, err := os.ReadDir(m.conf.IndexWALDir())
+	if os.IsNotExist(err) {
+		return 0, nil
+	}
+	if err != nil {
+		return 0, err
+	}
+	migrated := 0
+	for _, entry := range entries {
+		if !entry.IsDir() {
+			continue
+		}
+		dir := path.Join(m.conf.IndexWALDir(), entry.Name())
+		seqs, err := listSegments(dir)
+		if err != nil || len(seqs) == 0 {
+			continue
+		}
+		walEntry, err := firstEntry(segmentPath(dir, seqs[0]))
+		if err != nil || walEntry.Collection == "" {
+			continue
+		}
+		if entry.Name() == fileKey(walEntry.Collection) {
+			continue
+		}
+		if entry.Name() != url.PathEscape(walEntry.Collection) {
+			logger.Warn("Skip WAL directory of another collection", "dir", entry.Name(), "collection", walEntry.Collection)
+			continue
+		}
+		target := m.walDir(walEntry.Collection)
+		if _, err := os.Stat(target); err == nil {
+			logger.Warn("Skip WAL directory, the collection has a hashed one", "dir", entry.Name(), "collection", walEntry.Collection)
+			continue
+		}
+		if err := os.Rename(dir, target); err != nil {
+			return migrated, err
+		}
+		migrated++
+	}
+	return migrated, nil
+}
+
+// migrateWALFiles moves the entries of the WAL files older versions kept
+// directly in the WAL directory into the directories of their collections,
+// where they are replayed, and deletes the files. The entries of a collection
+// become its first segment, a collection that has segments already was
+// migrated by a start a crash interrupted
+func (m *Manager) migrateWALFiles() (int, error) {
+	entries, err := os.ReadDir(m.conf.IndexWALDir())
+	if os.IsNotExist(err) {
+		return 0, nil
+	}
+	if err != nil {
+		return 0, err
+	}
+	migrated := 0
+	for _, entry := range entries {
+		if entry.IsDir() || !strings.HasSuffix(entry.Name(), walSegmentExt) {
+			continue
+		}
+		file := path.Join(m.conf.IndexWALDir(), entry.Name())
+		var order []string
+		var encodeErr error
+		collections := make(map[string][][]byte)
+		_, err := replaySegment(file, func(walEntry *WALEntry) {
+			data, err := encodeWALEntry(walEntry)
+			if err != nil {
+				encodeErr = err
+				return
+			}
+			if _, ok := collections[walEntry.Collection]; !ok {
+				order = append(order, walEntry.Collection)
+			}
+			collections[walEntry.Collection] = append(collections[walEntry.Collection], data)
+		})
+		if err == nil || stderrors.Is(err, io.ErrUnexpectedEOF) {
+			err = encodeErr
+		}
+		if err != nil {
+			// a torn last record was never acknowledged, other damage keeps
+			// the file for inspection
+			logger.Error("Failed to read legacy WAL file", "file", entry.Name(), "error", err)
+			continue
+		}
+
+		for _, collectionName := range order {
+			if err := m.migrateWALEntries(collectionName, collections[collectionName]); err != nil {
+				return migrated, fmt.Errorf("failed to migrate WAL file %s: %w", entry.Name(), err)
+			}
+		}
+		if err := os.Remove(file); err != nil {
+			return migrated, err
+		}
+		migrated++
+	}
+	return migrated, nil
+}
+
+// migrateWALEntries writes the entries of a legacy WAL file as the first
+// segment of a collection, the segment only appears once it is complete
+func (m *Manager) migrateWALEntries(collectionName string, entries [][]byte) error {
+	dir := m.walDir(collectionName)
+	seqs, err := listSegments(dir)
+	if err != nil {
+		return err
+	}
+	if len(seqs) > 0 {
+		logger.Warn("Skip legacy WAL entries, the collection has segments", "collection", collectionName)
+		return nil
+	}
+
+	segment := segmentPath(dir, 0)
+	tmpPath := segment + tmpSuffix
+	if err := os.Remove(tmpPath); err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	writer, err := wal.NewWALWriter(tmpPath)
+	if err != nil {
+		return err
+	}
+	for _, data := range entries {
+		if err := writer.Write([]byte(collectionName), data); err != nil {
+			writer.Close()
+			return err
+		}
+	}
+	err = writer.Sync()
+	writer.Close()
+	if err != nil {
+		return err
+	}
+	if err := os.Rename(tmpPath, segment); err != nil {
+		return err
+	}
+	return syncFile(dir)
+}
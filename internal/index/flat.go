@@ -8,10 +8,14 @@ import (
 	"encoding/gob"
 	pkgerrors "oasisdb/pkg/errors"
 	"os"
-	"sort"
+	"sync"
 )
 
 type FlatIndex struct {
+	// mu guards every field below, searches run alongside the writes the
+	// Manager serializes, see ivfIndex.mu
+	mu sync.RWMutex
+
 	Dim     int
 	Data    []float32
 	Ids     []string
@@ -35,7 +39,12 @@ func newFlatIndex(config *IndexConfig) (VectorIndex, error) {
 
 // Add 添加单个向量
 func (f *FlatIndex) Add(id string, vector []float32) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return f.add(id, vector)
+}
 
+func (f *FlatIndex) add(id string, vector []float32) error {
 	if len(vector) != f.Dim {
 		return pkgerrors.ErrInvalidDimension
 	}
@@ -53,8 +62,10 @@ func (f *FlatIndex) AddBatch(ids []string, vectors [][]float32) error {
 	if len(ids) != len(vectors) {
 		return pkgerrors.ErrMisMatchKeysAndValues
 	}
+	f.mu.Lock()
+	defer f.mu.Unlock()
 	for i := range ids {
-		if err := f.Add(ids[i], vectors[i]); err != nil {
+		if err := f.add(ids[i], vectors[i]); err != nil {
 			return err
 		}
 	}
@@ -63,10 +74,11 @@ func (f *FlatIndex) AddBatch(ids []string, vectors [][]float32) error {
 
 // Build 构建索引（flat 实现直接批量添加）
 func (f *FlatIndex) Build(ids []string, vectors [][]float32) error {
-
 	if len(ids) != len(vectors) {
 		return pkgerrors.ErrMisMatchKeysAndValues
 	}
+	f.mu.Lock()
+	defer f.mu.Unlock()
 	f.Ids = make([]string, len(ids))
 	f.Data = make([]float32, 0) // 清空连续内存
 	f.IdToIdx = make(map[string]int)
@@ -83,7 +95,8 @@ func (f *FlatIndex) Build(ids []string, vectors [][]float32) error {
 
 // Delete 删除指定ID的向量
 func (f *FlatIndex) Delete(id string) error {
-
+	f.mu.Lock()
+	defer f.mu.Unlock()
 	idx, exists := f.IdToIdx[id]
 	if !exists {
 		return pkgerrors.ErrDocumentNotFound
@@ -104,39 +117,35 @@ func (f *FlatIndex) Delete(id string) error {
 
 // Search 进行k近邻暴力检索
 func (f *FlatIndex) Search(vector []float32, k int) (*SearchResult, error) {
+	f.mu.RLock()
+	defer f.mu.RUnlock()
+	return f.search(vector, k)
+}
 
+func (f *FlatIndex) search(vector []float32, k int) (*SearchResult, error) {
 	if len(vector) != f.Dim {
 		return nil, pkgerrors.ErrInvalidDimension
 	}
-	type pair struct {
-		id   string
-		dist float32
-	}
-	var results []pair
+	// 用大小为 k 的最大堆筛选，避免对全部候选排序
+	top := newTopK(min(k, len(f.Ids)))
 	for i := 0; i < len(f.Ids); i++ {
 		// 从连续内存中提取向量
 		start := i * f.Dim
 		end := start + f.Dim
-		searchVector := f.Data[start:end]
-
-		dist := distance(vector, searchVector, f.config.SpaceType)
-		results = append(results, pair{f.Ids[i], dist})
-	}
-	sort.Slice(results, func(i, j int) bool { return results[i].dist < results[j].dist })
-	if k > len(results) {
-		k = len(results)
-	}
-	ids := make([]string, k)
-	dists := make([]float32, k)
-	for i := 0; i < k; i++ {
-		ids[i] = results[i].id
-		dists[i] = results[i].dist
+		top.push(f.Ids[i], distance(vector, f.Data[start:end], f.config.SpaceType))
 	}
-	return &SearchResult{IDs: ids, Distances: dists}, nil
+	return top.result(), nil
+}
+
+// ExactSearch is the same as Search, flat search is already exhaustive
+func (f *FlatIndex) ExactSearch(vector []float32, k int) (*SearchResult, error) {
+	return f.Search(vector, k)
 }
 
 // GetVector 根据ID获取向量数据
 func (f *FlatIndex) GetVector(id string) ([]float32, error) {
+	f.mu.RLock()
+	defer f.mu.RUnlock()
 	idx, exists := f.IdToIdx[id]
 	if !exists {
 		return nil, pkgerrors.ErrDocumentNotFound
@@ -153,6 +162,37 @@ func (f *FlatIndex) GetVector(id string) ([]float32, error) {
 	return vector, nil
 }
 
+// Count 返回向量数量
+func (f *FlatIndex) Count() int {
+	f.mu.RLock()
+	defer f.mu.RUnlock()
+	return len(f.Ids)
+}
+
+// Stats 返回索引统计信息
+func (f *FlatIndex) Stats() IndexStats {
+	f.mu.RLock()
+	defer f.mu.RUnlock()
+	return IndexStats{
+		Type:      FLATIndex,
+		Dimension: f.Dim,
+		Count:     len(f.Ids),
+		Params:    map[string]any{},
+	}
+}
+
+// Iterate 按插入顺序遍历向量，fn 返回 false 时停止，fn 不能写入索引
+func (f *FlatIndex) Iterate(fn func(id string, vector []float32) bool) error {
+	f.mu.RLock()
+	defer f.mu.RUnlock()
+	for i, id := range f.Ids {
+		if !fn(id, f.Data[i*f.Dim:(i+1)*f.Dim]) {
+			return nil
+		}
+	}
+	return nil
+}
+
 // SetParams 设置参数（flat实现可忽略）
 func (f *FlatIndex) SetParams(params map[string]any) error {
 	return nil
@@ -160,24 +200,26 @@ func (f *FlatIndex) SetParams(params map[string]any) error {
 
 // Load 从磁盘加载索引
 func (f *FlatIndex) Load(filePath string) error {
-
 	file, err := os.Open(filePath)
 	if err != nil {
 		return err
 	}
 	defer file.Close()
+	f.mu.Lock()
+	defer f.mu.Unlock()
 	dec := gob.NewDecoder(file)
 	return dec.Decode(f)
 }
 
 // Save： save index into the disk
 func (f *FlatIndex) Save(filePath string) error {
-
 	file, err := os.Create(filePath)
 	if err != nil {
 		return err
 	}
 	defer file.Close()
+	f.mu.RLock()
+	defer f.mu.RUnlock()
 	enc := gob.NewEncoder(file)
 	return enc.Encode(f)
 }
@@ -0,0 +1,205 @@
+package index
+
+import (
+	"fmt"
+	"sync"
+
+	"oasisdb/internal/engine/go_api/gpu"
+	pkgerrors "oasisdb/pkg/errors"
+	"oasisdb/pkg/logger"
+)
+
+// gpuFlatIndex is a flat index computing the distances of searches over at
+// least minVectors vectors on a GPU, in batches of batchSize vectors. The
+// vectors are copied to the device on the first such search after a write.
+// Without GPU support, or for the hamming space, searches run on the CPU, so
+// the results only differ from a flat index by rounding
+type gpuFlatIndex struct {
+	*FlatIndex
+	minVectors int
+	batchSize  int
+
+	// writes hold the flat index lock exclusively, searches share it and
+	// take mu to update the copy on the device
+	mu         sync.Mutex
+	device     *gpu.Index
+	deviceErr  error // why the device can't be used, searches run on the CPU
+	generation int   // bumped by every write, guarded by the flat index lock
+	uploaded   int   // generation of the vectors on the device
+}
+
+var warnNoGPU sync.Once
+
+func newGPUFlatIndex(config *IndexConfig) (VectorIndex, error) {
+	minVectors, batchSize := DEFAULT_GPU_MIN_VECTORS, DEFAULT_GPU_BATCH
+	if val, ok := config.Parameters["gpuMinVectors"]; ok {
+		v, ok := intParam(val)
+		if !ok || v < 0 {
+			return nil, fmt.Errorf("%w: gpuMinVectors must be a non-negative integer", pkgerrors.ErrInvalidParameter)
+		}
+		minVectors = v
+	}
+	if val, ok := config.Parameters["gpuBatch"]; ok {
+		v, ok := intParam(val)
+		if !ok || v <= 0 {
+			return nil, fmt.Errorf("%w: gpuBatch must be a positive integer", pkgerrors.ErrInvalidParameter)
+		}
+		batchSize = v
+	}
+	flat, err := newFlatIndex(config)
+	if err != nil {
+		return nil, err
+	}
+
+	g := &gpuFlatIndex{
+		FlatIndex:  flat.(*FlatIndex),
+		minVectors: minVectors,
+		batchSize:  batchSize,
+		uploaded:   -1,
+	}
+	if !gpu.Available() {
+		g.deviceErr = gpu.ErrUnavailable
+		warnNoGPU.Do(func() {
+			logger.Warn("flat_gpu indices search on the CPU, build with the gpu tag on a host with a CUDA device to use it")
+		})
+	}
+	return g, nil
+}
+
+// deviceSpace is the space code of the GPU distances, 0 for the spaces it
+// doesn't compute
+func deviceSpace(space SpaceType) byte {
+	switch space {
+	case L2Space, "":
+		return 'l'
+	case IPSpace:
+		return 'i'
+	case CosSpace:
+		return 'c'
+	}
+	return 0
+}
+
+// written runs a write of the flat index and bumps the generation
+func (g *gpuFlatIndex) written(write func() error) error {
+	err := write()
+	g.FlatIndex.mu.Lock()
+	g.generation++
+	g.FlatIndex.mu.Unlock()
+	return err
+}
+
+func (g *gpuFlatIndex) Add(id string, vector []float32) error {
+	return g.written(func() error { return g.FlatIndex.Add(id, vector) })
+}
+
+func (g *gpuFlatIndex) AddBatch(ids []string, vectors [][]float32) error {
+	return g.written(func() error { return g.FlatIndex.AddBatch(ids, vectors) })
+}
+
+func (g *gpuFlatIndex) Build(ids []string, vectors [][]float32) error {
+	return g.written(func() error { return g.FlatIndex.Build(ids, vectors) })
+}
+
+func (g *gpuFlatIndex) Delete(id string) error {
+	return g.written(func() error { return g.FlatIndex.Delete(id) })
+}
+
+func (g *gpuFlatIndex) Load(filePath string) error {
+	return g.written(func() error { return g.FlatIndex.Load(filePath) })
+}
+
+// Search finds the k nearest vectors by brute force, on the GPU for large
+// indices
+func (g *gpuFlatIndex) Search(vector []float32, k int) (*SearchResult, error) {
+	g.FlatIndex.mu.RLock()
+	defer g.FlatIndex.mu.RUnlock()
+	if len(vector) != g.Dim {
+		return nil, pkgerrors.ErrInvalidDimension
+	}
+	space := deviceSpace(g.config.SpaceType)
+	if len(g.Ids) < g.minVectors || len(g.Ids) == 0 || space == 0 {
+		return g.search(vector, k)
+	}
+	distances, err := g.deviceDistances(vector, space)
+	if err != nil {
+		return g.search(vector, k)
+	}
+	top := newTopK(min(k, len(g.Ids)))
+	for i, d := range distances {
+		top.push(g.Ids[i], d)
+	}
+	return top.result(), nil
+}
+
+// ExactSearch is the same as Search, flat search is already exhaustive
+func (g *gpuFlatIndex) ExactSearch(vector []float32, k int) (*SearchResult, error) {
+	return g.Search(vector, k)
+}
+
+// deviceDistances computes the distance of vector to every vector on the
+// GPU, copying the vectors there first if they were written since. The
+// caller holds the flat index lock
+func (g *gpuFlatIndex) deviceDistances(vector []float32, space byte) ([]float32, error) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	if g.deviceErr != nil {
+		return nil, g.deviceErr
+	}
+	if g.device == nil {
+		device, err := gpu.NewIndex(g.Dim, g.batchSize)
+		if err != nil {
+			logger.Error("Failed to create GPU index, searching on the CPU", "error", err)
+			g.deviceErr = err
+			return nil, err
+		}
+		g.device = device
+	}
+	if g.uploaded != g.generation {
+		if err := g.device.Upload(g.Data); err != nil {
+			// retried by the next search, the device may be short of memory
+			logger.Error("Failed to copy vectors to the GPU, searching on the CPU", "vectors", len(g.Ids), "error", err)
+			g.uploaded = -1
+			return nil, err
+		}
+		g.uploaded = g.generation
+	}
+	distances, err := g.device.Distances(vector, space)
+	if err != nil {
+		logger.Error("Failed to compute distances on the GPU, searching on the CPU", "error", err)
+		return nil, err
+	}
+	return distances, nil
+}
+
+func (g *gpuFlatIndex) Stats() IndexStats {
+	count := g.FlatIndex.Count()
+	g.mu.Lock()
+	backend := "gpu"
+	if g.deviceErr != nil || deviceSpace(g.config.SpaceType) == 0 {
+		backend = "cpu"
+	}
+	g.mu.Unlock()
+	return IndexStats{
+		Type:      FLATGPUIndex,
+		Dimension: g.Dim,
+		Count:     count,
+		Params: map[string]any{
+			"backend":       backend,
+			"gpuMinVectors": g.minVectors,
+			"gpuBatch":      g.batchSize,
+		},
+	}
+}
+
+// Close releases the copy of the vectors on the GPU
+func (g *gpuFlatIndex) Close() error {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	if g.device != nil {
+		g.device.Free()
+		g.device = nil
+		g.uploaded = -1
+	}
+	return nil
+}
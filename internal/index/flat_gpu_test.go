@@ -0,0 +1,93 @@
+package index
+
+import (
+	"fmt"
+	"math/rand"
+	"path/filepath"
+	"testing"
+
+	"oasisdb/internal/engine/go_api/gpu"
+	"oasisdb/pkg/errors"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// TestGPUFlatIndexMatchesFlat checks the GPU searches against the CPU ones,
+// builds without the gpu tag check the CPU fallback
+func TestGPUFlatIndexMatchesFlat(t *testing.T) {
+	const dim, n = 16, 500
+	rng := rand.New(rand.NewSource(1))
+	ids := make([]string, n)
+	vectors := make([][]float32, n)
+	for i := range ids {
+		ids[i] = fmt.Sprintf("doc%d", i)
+		vectors[i] = make([]float32, dim)
+		for j := range vectors[i] {
+			vectors[i][j] = rng.Float32()*2 - 1
+		}
+	}
+
+	for _, space := range []SpaceType{L2Space, IPSpace, CosSpace} {
+		t.Run(string(space), func(t *testing.T) {
+			flat, err := newFlatIndex(&IndexConfig{SpaceType: space, IndexType: FLATIndex, Dimension: dim})
+			require.NoError(t, err)
+			// a small batch takes several batches per search
+			idx, err := newGPUFlatIndex(&IndexConfig{SpaceType: space, IndexType: FLATGPUIndex, Dimension: dim,
+				Parameters: map[string]any{"gpuMinVectors": 0, "gpuBatch": 128}})
+			require.NoError(t, err)
+			defer idx.Close()
+			require.NoError(t, flat.Build(ids, vectors))
+			require.NoError(t, idx.Build(ids, vectors))
+
+			check := func() {
+				for q := 0; q < 5; q++ {
+					want, err := flat.Search(vectors[q*7], 10)
+					require.NoError(t, err)
+					got, err := idx.Search(vectors[q*7], 10)
+					require.NoError(t, err)
+					assert.Equal(t, want.IDs, got.IDs)
+					assert.InDeltaSlice(t, want.Distances, got.Distances, 1e-4)
+				}
+			}
+			check()
+
+			// writes are copied to the device before the next search
+			require.NoError(t, flat.Delete("doc0"))
+			require.NoError(t, idx.Delete("doc0"))
+			check()
+		})
+	}
+}
+
+func TestGPUFlatIndex(t *testing.T) {
+	for _, params := range []map[string]any{{"gpuMinVectors": -1}, {"gpuBatch": 0}, {"gpuBatch": "many"}} {
+		_, err := newGPUFlatIndex(&IndexConfig{SpaceType: L2Space, IndexType: FLATGPUIndex, Dimension: 2, Parameters: params})
+		assert.ErrorIs(t, err, errors.ErrInvalidParameter, params)
+	}
+
+	idx, err := newGPUFlatIndex(&IndexConfig{SpaceType: L2Space, IndexType: FLATGPUIndex, Dimension: 2})
+	require.NoError(t, err)
+	require.NoError(t, idx.Build([]string{"a", "b"}, [][]float32{{0, 0}, {1, 1}}))
+	stats := idx.Stats()
+	assert.Equal(t, FLATGPUIndex, stats.Type)
+	assert.Equal(t, 2, stats.Count)
+	if !gpu.Available() {
+		assert.Equal(t, "cpu", stats.Params["backend"])
+	}
+
+	// checkpoints are flat index files
+	file := filepath.Join(t.TempDir(), "index.idx")
+	require.NoError(t, idx.Save(file))
+	require.NoError(t, idx.Close())
+	flat, err := newFlatIndex(&IndexConfig{SpaceType: L2Space, IndexType: FLATIndex, Dimension: 2})
+	require.NoError(t, err)
+	require.NoError(t, flat.Load(file))
+	loaded, err := newGPUFlatIndex(&IndexConfig{SpaceType: L2Space, IndexType: FLATGPUIndex, Dimension: 2})
+	require.NoError(t, err)
+	require.NoError(t, loaded.Load(file))
+	assert.Equal(t, 2, flat.Count())
+	res, err := loaded.Search([]float32{0.9, 0.9}, 1)
+	require.NoError(t, err)
+	assert.Equal(t, []string{"b"}, res.IDs)
+}
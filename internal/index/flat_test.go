@@ -129,3 +129,34 @@ func TestFlatIndex_AddAndDelete(t *testing.T) {
 	}
 }
 
+
+func TestFlatIndex_CountAndIterate(t *testing.T) {
+	dim := 4
+	vIdx, _ := newFlatIndex(&IndexConfig{SpaceType: L2Space, IndexType: FLATIndex, Dimension: dim})
+	ids, vecs := generateFlatVectors(5, dim)
+	if err := vIdx.Build(ids, vecs); err != nil {
+		t.Fatalf("build failed: %v", err)
+	}
+	if err := vIdx.Delete(ids[0]); err != nil {
+		t.Fatalf("delete failed: %v", err)
+	}
+	if got := vIdx.Count(); got != 4 {
+		t.Fatalf("count = %d, want 4", got)
+	}
+	if stats := vIdx.Stats(); stats.Count != 4 || stats.Type != FLATIndex {
+		t.Fatalf("unexpected stats %+v", stats)
+	}
+
+	// 遍历顺序与插入顺序一致
+	var seen []string
+	err := vIdx.Iterate(func(id string, vector []float32) bool {
+		if vector[0] != float32(len(seen)+1) {
+			t.Fatalf("vector of %s = %v", id, vector)
+		}
+		seen = append(seen, id)
+		return true
+	})
+	if err != nil || len(seen) != 4 || seen[0] != ids[1] {
+		t.Fatalf("iterate visited %v, err %v", seen, err)
+	}
+}
@@ -0,0 +1,129 @@
+package index
+
+import (
+	"fmt"
+	"io/fs"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+
+	"oasisdb/pkg/logger"
+)
+
+// GarbageReport describes the files removed by CollectGarbage
+type GarbageReport struct {
+	Files  []string // paths of the removed files and WAL directories
+	Bytes  int64
+	DryRun bool // the files were only logged
+}
+
+// CollectGarbage removes the files of collections without an index: index
+// files, configs and indices in the cold tier of deleted collections, WAL directories whose index
+// couldn't be recreated, and graph files of DiskANN builds a crash
+// interrupted. It must run once the collections were reconciled, as every
+// collection has an index by then
+func (m *Manager) CollectGarbage(dryRun bool) (*GarbageReport, error) {
+	m.mu.RLock()
+	indexFiles := make(map[string]bool, len(m.indices))
+	walDirs := make(map[string]bool, len(m.indices))
+	configs := make(map[string]bool, len(m.indices))
+	names := make([]string, 0, len(m.indices)+len(m.unloaded))
+	for name := range m.indices {
+		names = append(names, name)
+	}
+	for name := range m.unloaded {
+		names = append(names, name)
+	}
+	for _, name := range names {
+		indexFiles[path.Base(m.indexFile(name))] = true
+		walDirs[path.Base(m.walDir(name))] = true
+		configs[path.Base(m.configFile(name))] = true
+	}
+	m.mu.RUnlock()
+
+	report := &GarbageReport{DryRun: dryRun}
+	entries, err := os.ReadDir(m.conf.IndexDir())
+	if err != nil {
+		return nil, err
+	}
+	for _, entry := range entries {
+		name := entry.Name()
+		file := path.Join(m.conf.IndexDir(), name)
+		switch {
+		case entry.IsDir():
+		case strings.HasSuffix(name, ".conf") && !configs[name]:
+			report.remove(file, "config of a deleted collection")
+		case strings.HasPrefix(name, "index_") && strings.HasSuffix(name, ".idx") && !indexFiles[name]:
+			report.remove(file, "index of a deleted collection")
+		case strings.HasPrefix(name, "index_") && strings.HasSuffix(name, ".idx"+hnswIDsSuffix) &&
+			!indexFiles[strings.TrimSuffix(name, hnswIDsSuffix)]:
+			report.remove(file, "index id map of a deleted collection")
+		case strings.HasPrefix(name, "index_") && strings.HasSuffix(name, ".idx"+remoteSuffix) &&
+			!indexFiles[strings.TrimSuffix(name, remoteSuffix)]:
+			if !dryRun && m.conf.ColdTier != nil {
+				if err := m.conf.ColdTier.Delete(remoteIndexKey(strings.TrimSuffix(file, remoteSuffix))); err != nil {
+					logger.Warn("Failed to delete index from the tier", "file", name, "error", err)
+					continue
+				}
+			}
+			report.remove(file, "tier marker of a deleted collection")
+		case strings.HasPrefix(name, "diskann-") && strings.HasSuffix(name, ".graph"):
+			// a build unlinks its graph file once mapped
+			report.remove(file, "interrupted diskann build")
+		}
+	}
+
+	entries, err = os.ReadDir(m.conf.IndexWALDir())
+	if err != nil {
+		return nil, err
+	}
+	for _, entry := range entries {
+		if entry.IsDir() && !walDirs[entry.Name()] {
+			report.remove(path.Join(m.conf.IndexWALDir(), entry.Name()), "WAL of a deleted collection")
+		}
+	}
+
+	return report, nil
+}
+
+// remove removes a file or directory unless the report is a dry run
+func (r *GarbageReport) remove(file, reason string) {
+	size, err := diskUsage(file)
+	if err != nil {
+		return
+	}
+	if r.DryRun {
+		logger.Info("Found orphaned file, dry run keeps it", "file", file, "reason", reason, "bytes", size)
+	} else if err := os.RemoveAll(file); err != nil {
+		logger.Warn("Failed to remove orphaned file", "file", file, "error", err)
+		return
+	} else {
+		logger.Info("Removed orphaned file", "file", file, "reason", reason, "bytes", size)
+	}
+	r.Files = append(r.Files, file)
+	r.Bytes += size
+}
+
+// diskUsage returns the size of a file or of the files in a directory
+func diskUsage(file string) (int64, error) {
+	var size int64
+	err := filepath.WalkDir(file, func(_ string, entry fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if entry.IsDir() {
+			return nil
+		}
+		info, err := entry.Info()
+		if err != nil {
+			return err
+		}
+		size += info.Size()
+		return nil
+	})
+	if err != nil {
+		return 0, fmt.Errorf("failed to size %s: %w", file, err)
+	}
+	return size, nil
+}
@@ -5,39 +5,67 @@ import (
 	"oasisdb/internal/engine/go_api/hnsw"
 	"oasisdb/pkg/errors"
 	"oasisdb/pkg/logger"
+	"sync"
 )
 
 type hnswIndex struct {
 	index  *hnsw.Index
 	config *IndexConfig
+
+	mu        sync.RWMutex
+	labels    map[string]uint32 // non-numeric document ID -> label
+	ids       map[uint32]string // label -> non-numeric document ID
+	nextLabel uint32            // label of the next non-numeric document ID
+
+	growMu   sync.Mutex
+	reserved int // element slots promised to adds in progress
+
+	replaceDeleted bool // new IDs reuse the slots of deleted elements
+	buildThreads   int  // goroutines inserting a batch
 }
 
 func newHNSWIndex(config *IndexConfig) (VectorIndex, error) {
 	if config.Dimension <= 0 {
 		return nil, errors.ErrInvalidDimension
 	}
+	buildThreads, err := threadsParam(config, "buildThreads")
+	if err != nil {
+		return nil, err
+	}
+	if buildThreads == 0 {
+		buildThreads = DEFAULT_BUILD_THREADS
+	}
 
+	index, err := newNativeHNSW(config, hnswMaxElements(config.Parameters))
+	if err != nil {
+		return nil, err
+	}
+	if err := applyEfSearch(index, config.Parameters); err != nil {
+		return nil, err
+	}
+
+	return &hnswIndex{
+		index:          index,
+		config:         config,
+		labels:         make(map[string]uint32),
+		ids:            make(map[uint32]string),
+		nextLabel:      mappedLabelStart,
+		replaceDeleted: hnswReplaceDeleted(config.Parameters),
+		buildThreads:   buildThreads,
+	}, nil
+}
+
+// newNativeHNSW creates an empty hnswlib index with room for maxElements
+func newNativeHNSW(config *IndexConfig, maxElements uint32) (*hnsw.Index, error) {
 	// Get HNSW specific parameters
-	M := uint32(DEFAULT_M)                            // default M
+	M := uint32(hnswM(config.Parameters))
 	efConstruction := uint32(DEFAULT_EF_CONSTRUCTION) // default efConstruction
-	maxElements := uint32(DEFAULT_MAX_ELEMENTS)       // default maxElements
 
-	if v, ok := config.Parameters["M"]; ok {
-		if m, ok := v.(float64); ok {
-			M = uint32(m)
-		}
-	}
 	if v, ok := config.Parameters["efConstruction"]; ok {
 		if ef, ok := v.(float64); ok {
 			efConstruction = uint32(ef)
 		}
 	}
-	if v, ok := config.Parameters["maxElements"]; ok {
-		if max, ok := v.(float64); ok {
-			maxElements = uint32(max)
-		}
-	}
-
 	// Create HNSW index
 	index := hnsw.NewIndex(
 		uint32(config.Dimension),
@@ -45,26 +73,25 @@ func newHNSWIndex(config *IndexConfig) (VectorIndex, error) {
 		M,
 		efConstruction,
 		string(config.SpaceType),
+		hnswReplaceDeleted(config.Parameters),
 	)
 	if index == nil {
 		return nil, errors.ErrFailedToCreateIndex
 	}
-
-	return &hnswIndex{
-		index:  index,
-		config: config,
-	}, nil
+	return index, nil
 }
 
 func (h *hnswIndex) Add(id string, vector []float32) error {
 	if len(vector) != h.config.Dimension {
 		return errors.ErrInvalidDimension
 	}
-	return h.index.AddPoint(vector, uint32(stringToID(id)))
-}
-
-func (h *hnswIndex) Build(ids []string, vectors [][]float32) error {
-	return h.AddBatch(ids, vectors)
+	release, err := h.reserve(1, false)
+	if err != nil {
+		return err
+	}
+	defer release()
+	label, _ := h.label(id, true)
+	return h.index.AddPoint(vector, label, h.replaceDeleted)
 }
 
 func (h *hnswIndex) AddBatch(ids []string, vectors [][]float32) error {
@@ -72,29 +99,92 @@ func (h *hnswIndex) AddBatch(ids []string, vectors [][]float32) error {
 		return errors.ErrInvalidDimension
 	}
 
-	// Convert string IDs to uint32
-	uint32IDs := make([]uint32, len(ids))
-	for i, id := range ids {
-		uint32IDs[i] = uint32(stringToID(id))
+	labels, points := h.labelBatch(ids, vectors)
+	release, err := h.reserve(len(points), false)
+	if err != nil {
+		return err
 	}
+	defer release()
+	return h.index.AddItems(points, labels, h.buildThreads, h.replaceDeleted)
+}
+
+// reserve makes room for n more elements, growing the index by
+// HNSW_GROWTH_FACTOR when the elements and those of adds in progress would
+// exceed its capacity, or to just the needed capacity with exact. Updates of
+// existing IDs don't need a slot, counting them only grows the index a little
+// early. Slots of deleted elements count as free when the index replaces them
+func (h *hnswIndex) reserve(n int, exact bool) (release func(), err error) {
+	h.growMu.Lock()
+	defer h.growMu.Unlock()
 
-	return h.index.AddItems(vectors, uint32IDs, DEFAULT_BUILD_THREADS) // Use 4 goroutines for batch insert
+	capacity := h.index.GetMaxElements()
+	needed := h.index.GetCurrentElementCount() + h.reserved + n
+	if h.replaceDeleted {
+		needed -= h.index.GetDeletedCount()
+	}
+	if needed > capacity {
+		newCapacity := max(capacity*HNSW_GROWTH_FACTOR, needed, int(hnswMaxElements(h.config.Parameters)))
+		if exact {
+			newCapacity = needed
+		}
+		if err := h.index.ResizeIndex(newCapacity); err != nil {
+			return nil, err
+		}
+		logger.Info("Grew HNSW index", "from", capacity, "to", newCapacity)
+	}
+	h.reserved += n
+	return func() {
+		h.growMu.Lock()
+		h.reserved -= n
+		h.growMu.Unlock()
+	}, nil
 }
 
 func (h *hnswIndex) Delete(id string) error {
-	// 1. ensure id exists
-	if h.index.GetVectorByLabel(uint32(stringToID(id)), int(h.config.Dimension)) == nil {
+	// 1. ensure id exists, its label is kept so a later add restores it
+	label, ok := h.label(id, false)
+	if !ok || h.index.GetVectorByLabel(label, int(h.config.Dimension)) == nil {
 		return fmt.Errorf("id %s does not exist", id)
 	}
-	return h.index.MarkDeleted(uint32(stringToID(id)))
+	return h.index.MarkDeleted(label)
 }
 
 func (h *hnswIndex) Search(vector []float32, k int) (*SearchResult, error) {
+	return h.search(vector, k, 0)
+}
+
+// SearchWithParams searches with the efsearch of params for this query only
+func (h *hnswIndex) SearchWithParams(vector []float32, k int, params map[string]any) (*SearchResult, error) {
+	ef := 0
+	for key, val := range params {
+		switch key {
+		case "efsearch":
+			v, ok := intParam(val)
+			if !ok || v <= 0 {
+				return nil, fmt.Errorf("%w: efsearch must be a positive integer", errors.ErrInvalidParameter)
+			}
+			ef = v
+		default:
+			return nil, fmt.Errorf("%w: unknown hnsw search parameter %q", errors.ErrInvalidParameter, key)
+		}
+	}
+	return h.search(vector, k, ef)
+}
+
+// search runs a k-NN search, ef 0 uses the efsearch of the index
+func (h *hnswIndex) search(vector []float32, k, ef int) (*SearchResult, error) {
 	if len(vector) != h.config.Dimension {
 		return nil, errors.ErrInvalidDimension
 	}
 
-	ids, distances, err := h.index.SearchKNN(vector, k)
+	var ids []uint32
+	var distances []float32
+	var err error
+	if ef > 0 {
+		ids, distances, err = h.index.SearchKNNWithEf(vector, k, ef)
+	} else {
+		ids, distances, err = h.index.SearchKNN(vector, k)
+	}
 	if err != nil {
 		return nil, err
 	}
@@ -107,7 +197,7 @@ func (h *hnswIndex) Search(vector []float32, k int) (*SearchResult, error) {
 	// Convert uint32 IDs back to strings
 	strIDs := make([]string, len(ids))
 	for i, id := range ids {
-		strIDs[i] = idToString(int64(id))
+		strIDs[i] = h.documentID(id)
 	}
 	logger.Debug("Search result", "ids", strIDs, "dists", distances)
 	return &SearchResult{
@@ -116,13 +206,53 @@ func (h *hnswIndex) Search(vector []float32, k int) (*SearchResult, error) {
 	}, nil
 }
 
+func (h *hnswIndex) Count() int {
+	return h.index.GetCurrentElementCount() - h.index.GetDeletedCount()
+}
+
+func (h *hnswIndex) Stats() IndexStats {
+	deleted, total := h.Tombstones()
+	return IndexStats{
+		Type:      HNSWIndex,
+		Dimension: h.config.Dimension,
+		Count:     total - deleted,
+		Deleted:   deleted,
+		Params: map[string]any{
+			"max_elements":    h.index.GetMaxElements(),
+			"ef_search":       h.index.GetEf(),
+			"ef_construction": h.index.GetEfConstruction(),
+			"replace_deleted": h.replaceDeleted,
+		},
+	}
+}
+
+func (h *hnswIndex) Iterate(fn func(id string, vector []float32) bool) error {
+	if h.index == nil {
+		return fmt.Errorf("index is not initialized")
+	}
+	for _, label := range h.index.GetLabels() {
+		vector := h.index.GetVectorByLabel(label, h.config.Dimension)
+		if vector == nil {
+			continue // deleted meanwhile
+		}
+		if !fn(h.documentID(label), vector) {
+			return nil
+		}
+	}
+	return nil
+}
+
 // GetVector get vector by id
 func (h *hnswIndex) GetVector(id string) ([]float32, error) {
 	if h.index == nil {
 		return nil, fmt.Errorf("index is not initialized")
 	}
 
-	vector := h.index.GetVectorByLabel(uint32(stringToID(id)), int(h.config.Dimension))
+	label, ok := h.label(id, false)
+	if !ok {
+		return nil, errors.ErrDocumentNotFound
+	}
+	vector := h.index.GetVectorByLabel(label, int(h.config.Dimension))
 	if vector == nil {
 		return nil, errors.ErrDocumentNotFound
 	}
@@ -138,17 +268,60 @@ func (h *hnswIndex) Load(filePath string) error {
 		spaceType = "l2"
 	}
 
-	index, err := hnsw.LoadIndex(filePath, int(h.config.Dimension), spaceType)
+	labels, graphPath, cleanup, err := readHNSWFile(filePath)
 	if err != nil {
 		return errors.ErrFailedToLoadIndex
 	}
+	defer cleanup()
 
+	// the saved capacity of an index checkpointed empty is 0
+	index, err := hnsw.LoadIndex(graphPath, int(h.config.Dimension), hnswMaxElements(h.config.Parameters), spaceType, h.replaceDeleted)
+	if err != nil {
+		return errors.ErrFailedToLoadIndex
+	}
+	h.setLabels(labels)
+
+	// Update index, ef is not part of the index file, an index loaded over
+	// another keeps the ef set on it
 	if h.index != nil {
+		ef := h.index.GetEf()
 		h.index.Unload()
+		h.index = index
+		return index.SetEf(ef)
 	}
-
-	// Update index
 	h.index = index
+	return applyEfSearch(index, h.config.Parameters)
+}
+
+// hnswMaxElements returns the configured capacity of an HNSW index
+func hnswMaxElements(params map[string]interface{}) uint32 {
+	if v, ok := params["maxElements"]; ok {
+		if max, ok := v.(float64); ok {
+			return uint32(max)
+		}
+	}
+	return DEFAULT_MAX_ELEMENTS
+}
+
+// hnswReplaceDeleted reports whether an HNSW index reuses the slots of deleted
+// elements, collection parameters arrive as numbers or booleans
+func hnswReplaceDeleted(params map[string]interface{}) bool {
+	switch v := params["allowReplaceDeleted"].(type) {
+	case bool:
+		return v
+	case float64:
+		return v != 0
+	}
+	return false
+}
+
+// applyEfSearch sets the configured query-time ef, hnswlib resets it on load
+func applyEfSearch(index *hnsw.Index, params map[string]interface{}) error {
+	if v, ok := params["efSearch"]; ok {
+		if ef, ok := v.(float64); ok && ef > 0 {
+			return index.SetEf(int(ef))
+		}
+	}
 	return nil
 }
 
@@ -157,7 +330,14 @@ func (h *hnswIndex) Save(filePath string) error {
 		return fmt.Errorf("index is not initialized")
 	}
 	logger.Debug("Saving index to file", "file", filePath)
-	return h.index.SaveIndex(filePath)
+
+	// hnswlib writes the file itself, the ID map goes next to it
+	if err := h.index.SaveIndex(filePath); err != nil {
+		return err
+	}
+	h.mu.RLock()
+	defer h.mu.RUnlock()
+	return writeHNSWIDs(filePath, h.labels)
 }
 
 func (h *hnswIndex) Close() error {
@@ -203,14 +383,59 @@ func (h *hnswIndex) SetEfSearch(ef int) error {
 	return h.index.SetEf(ef)
 }
 
-// stringToID converts a string ID to int64
-func stringToID(id string) int64 {
-	var n int64
-	_, err := fmt.Sscanf(id, "%d", &n)
-	if err != nil {
-		return 0
+// ExactSearch compares the query against every element that is not deleted
+func (h *hnswIndex) ExactSearch(vector []float32, k int) (*SearchResult, error) {
+	if h.index == nil {
+		return nil, fmt.Errorf("index is not initialized")
+	}
+	if len(vector) != h.config.Dimension {
+		return nil, errors.ErrInvalidDimension
+	}
+	labels := h.index.GetLabels()
+	ids := make([]string, 0, len(labels))
+	vectors := make([][]float32, 0, len(labels))
+	for _, label := range labels {
+		v := h.index.GetVectorByLabel(label, h.config.Dimension)
+		if v == nil {
+			continue
+		}
+		ids = append(ids, h.documentID(label))
+		vectors = append(vectors, v)
+	}
+	return exactTopK(vector, k, h.config.SpaceType, ids, vectors), nil
+}
+
+// ListClusters approximates clusters with the graph entry point and its
+// level-0 neighbors, each reported with its own neighborhood as members
+func (h *hnswIndex) ListClusters(sampleSize int) ([]Cluster, error) {
+	if h.index == nil {
+		return nil, fmt.Errorf("index is not initialized")
+	}
+	entry, ok := h.index.GetEntryPoint()
+	if !ok {
+		return []Cluster{}, nil
+	}
+
+	points := append([]uint32{entry}, h.index.GetNeighbors(entry)...)
+	clusters := make([]Cluster, 0, len(points))
+	for i, label := range points {
+		vector := h.index.GetVectorByLabel(label, h.config.Dimension)
+		if vector == nil {
+			continue // deleted entry point
+		}
+		neighbors := h.index.GetNeighbors(label)
+		ids := make([]string, 0, sampleSize)
+		for j := 0; j < len(neighbors) && j < sampleSize; j++ {
+			ids = append(ids, h.documentID(neighbors[j]))
+		}
+		clusters = append(clusters, Cluster{
+			ID:        i,
+			Centroid:  vector,
+			Count:     len(neighbors),
+			SampleIDs: ids,
+		})
 	}
-	return n
+	return clusters, nil
 }
 
 // idToString converts an int64 ID back to string
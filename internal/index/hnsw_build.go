@@ -0,0 +1,178 @@
+package index
+
+import (
+	"cmp"
+	"math"
+	"math/rand"
+	"slices"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"oasisdb/pkg/errors"
+	"oasisdb/pkg/logger"
+)
+
+// Build inserts a batch in bulk, see BuildWithProgress
+func (h *hnswIndex) Build(ids []string, vectors [][]float32) error {
+	return h.BuildWithProgress(ids, vectors, nil)
+}
+
+// BuildWithProgress inserts a batch in bulk: the index grows to hold exactly
+// the batch, the level of every point is drawn up front in parallel and the
+// points are inserted from the top level down so the upper layers of the graph
+// exist before the bulk of level-0 points links into them. Without a
+// configured efConstruction it is tuned to the batch size for the build.
+// progress, if not nil, is called with the number of points inserted so far,
+// possibly from several goroutines at once
+func (h *hnswIndex) BuildWithProgress(ids []string, vectors [][]float32, progress func(inserted int)) error {
+	if len(ids) != len(vectors) {
+		return errors.ErrInvalidDimension
+	}
+	for _, vector := range vectors {
+		if len(vector) != h.config.Dimension {
+			return errors.ErrInvalidDimension
+		}
+	}
+	if h.replaceDeleted && h.index.GetDeletedCount() > 0 {
+		// new points take the slots of deleted elements one by one
+		if err := h.AddBatch(ids, vectors); err != nil {
+			return err
+		}
+		if progress != nil {
+			progress(len(ids))
+		}
+		return nil
+	}
+
+	labels, points := h.labelBatch(ids, vectors)
+	release, err := h.reserve(len(points), true)
+	if err != nil {
+		return err
+	}
+	defer release()
+
+	if _, ok := h.config.Parameters["efConstruction"]; !ok {
+		ef := h.index.GetEfConstruction()
+		if err := h.index.SetEfConstruction(bulkEfConstruction(len(points), hnswM(h.config.Parameters))); err != nil {
+			return err
+		}
+		defer h.index.SetEfConstruction(ef)
+	}
+
+	start := time.Now()
+	levels := hnswLevels(len(points), hnswM(h.config.Parameters), h.buildThreads)
+	order := make([]int, len(points))
+	for i := range order {
+		order[i] = i
+	}
+	slices.SortStableFunc(order, func(a, b int) int {
+		return cmp.Compare(levels[b], levels[a])
+	})
+
+	var next, inserted atomic.Int64
+	var wg sync.WaitGroup
+	errs := make([]error, min(h.buildThreads, len(points)))
+	for w := range errs {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for {
+				i := int(next.Add(1)) - 1
+				if i >= len(order) {
+					return
+				}
+				p := order[i]
+				if err := h.index.AddPointLevel(points[p], labels[p], levels[p]); err != nil {
+					errs[w] = err
+					next.Store(int64(len(order))) // stops the other goroutines
+					return
+				}
+				if n := inserted.Add(1); progress != nil && (n%HNSW_BUILD_PROGRESS_STEP == 0 || int(n) == len(points)) {
+					progress(int(n))
+				}
+			}
+		}()
+	}
+	wg.Wait()
+	for _, err := range errs {
+		if err != nil {
+			return err
+		}
+	}
+	logger.Info("Bulk inserted HNSW points", "points", len(points), "ef_construction", h.index.GetEfConstruction(),
+		"duration", time.Since(start))
+	return nil
+}
+
+// labelBatch maps the IDs of a batch to labels, the last vector of a repeated
+// ID wins as it would with one upsert after another
+func (h *hnswIndex) labelBatch(ids []string, vectors [][]float32) ([]uint32, [][]float32) {
+	positions := make(map[string]int, len(ids))
+	labels := make([]uint32, 0, len(ids))
+	points := make([][]float32, 0, len(ids))
+	for i, id := range ids {
+		if pos, ok := positions[id]; ok {
+			points[pos] = vectors[i]
+			continue
+		}
+		label, _ := h.label(id, true)
+		positions[id] = len(labels)
+		labels = append(labels, label)
+		points = append(points, vectors[i])
+	}
+	return labels, points
+}
+
+// hnswLevels draws the graph level of n points the way hnswlib does, the
+// level of a point is floor(-ln(U) / ln(m)) for U uniform in (0, 1]. The
+// points are split among threads goroutines, each with a source of its own
+func hnswLevels(n, m, threads int) []int {
+	levels := make([]int, n)
+	if n == 0 {
+		return levels
+	}
+	mult := 1 / math.Log(float64(max(m, 2)))
+	threads = max(1, min(threads, n))
+	block := (n + threads - 1) / threads
+	seed := time.Now().UnixNano()
+	var wg sync.WaitGroup
+	for t := range threads {
+		start, end := t*block, min((t+1)*block, n)
+		if start >= end {
+			break
+		}
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			rng := rand.New(rand.NewSource(seed + int64(t)))
+			for i := start; i < end; i++ {
+				levels[i] = int(-math.Log(1-rng.Float64()) * mult)
+			}
+		}()
+	}
+	wg.Wait()
+	return levels
+}
+
+// bulkEfConstruction returns the efConstruction of a bulk build of n points:
+// the default up to HNSW_BULK_EF_FULL points, shrinking with the square root
+// of the batch size beyond so large builds trade a little recall for time. It
+// stays at least HNSW_BULK_EF_MIN and twice m
+func bulkEfConstruction(n, m int) int {
+	ef := DEFAULT_EF_CONSTRUCTION
+	if n > HNSW_BULK_EF_FULL {
+		ef = int(float64(ef) * math.Sqrt(float64(HNSW_BULK_EF_FULL)/float64(n)))
+	}
+	return max(ef, HNSW_BULK_EF_MIN, 2*m)
+}
+
+// hnswM returns the configured M of an HNSW index
+func hnswM(params map[string]interface{}) int {
+	if v, ok := params["M"]; ok {
+		if m, ok := v.(float64); ok {
+			return int(m)
+		}
+	}
+	return DEFAULT_M
+}
@@ -0,0 +1,145 @@
+package index
+
+import (
+	"bytes"
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"strconv"
+)
+
+// mappedLabelStart is the first hnswlib label handed out to document IDs that
+// are not canonical numbers below it, those numbers are their own label
+const mappedLabelStart = 1 << 31
+
+// hnswIDMagic starts index files that carry the ID map ahead of the hnswlib
+// data, written before the map moved to its own file
+var hnswIDMagic = []byte("OASISID1")
+
+// hnswIDsSuffix names the file holding the ID map of an HNSW index next to
+// its hnswlib file. The map stays local when the index file is tiered
+const hnswIDsSuffix = ".ids"
+
+// hnswIDsFile returns the ID map file of the HNSW index saved at filePath
+func hnswIDsFile(filePath string) string {
+	return filePath + hnswIDsSuffix
+}
+
+// label returns the hnswlib label of a document ID, with create a label is
+// assigned to an unknown ID. A label is never reused by another ID, so adding
+// an ID again updates its point instead of duplicating it
+func (h *hnswIndex) label(id string, create bool) (uint32, bool) {
+	if n, err := strconv.ParseUint(id, 10, 32); err == nil && n < mappedLabelStart && strconv.FormatUint(n, 10) == id {
+		return uint32(n), true
+	}
+
+	h.mu.RLock()
+	label, ok := h.labels[id]
+	h.mu.RUnlock()
+	if ok || !create {
+		return label, ok
+	}
+
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if label, ok := h.labels[id]; ok {
+		return label, true
+	}
+	label = h.nextLabel
+	h.nextLabel++
+	h.labels[id] = label
+	h.ids[label] = id
+	return label, true
+}
+
+// documentID returns the document ID of an hnswlib label
+func (h *hnswIndex) documentID(label uint32) string {
+	if label < mappedLabelStart {
+		return idToString(int64(label))
+	}
+	h.mu.RLock()
+	defer h.mu.RUnlock()
+	return h.ids[label]
+}
+
+// setLabels replaces the ID map with one loaded from an index file
+func (h *hnswIndex) setLabels(labels map[string]uint32) {
+	if labels == nil {
+		labels = make(map[string]uint32)
+	}
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.labels = labels
+	h.ids = make(map[uint32]string, len(labels))
+	h.nextLabel = mappedLabelStart
+	for id, label := range labels {
+		h.ids[label] = id
+		h.nextLabel = max(h.nextLabel, label+1)
+	}
+}
+
+// writeHNSWIDs writes the ID map of the HNSW index saved at filePath
+func writeHNSWIDs(filePath string, labels map[string]uint32) error {
+	idMap, err := json.Marshal(labels)
+	if err != nil {
+		return fmt.Errorf("failed to marshal id map: %w", err)
+	}
+	return os.WriteFile(hnswIDsFile(filePath), idMap, 0644)
+}
+
+// readHNSWFile returns the ID map of an index file and the path of its
+// hnswlib data, cleanup removes the extracted data when done. Only files
+// carrying the map ahead of the data are copied, the map of newer files is
+// read from its own file
+func readHNSWFile(filePath string) (labels map[string]uint32, graphPath string, cleanup func(), err error) {
+	f, err := os.Open(filePath)
+	if err != nil {
+		return nil, "", nil, err
+	}
+	defer f.Close()
+
+	header := make([]byte, len(hnswIDMagic)+8)
+	if _, err := io.ReadFull(f, header); err != nil || !bytes.Equal(header[:len(hnswIDMagic)], hnswIDMagic) {
+		idMap, err := os.ReadFile(hnswIDsFile(filePath))
+		if os.IsNotExist(err) {
+			// written before IDs were mapped, all IDs are numeric
+			return map[string]uint32{}, filePath, func() {}, nil
+		}
+		if err != nil {
+			return nil, "", nil, fmt.Errorf("failed to read id map: %w", err)
+		}
+		if err := json.Unmarshal(idMap, &labels); err != nil {
+			return nil, "", nil, fmt.Errorf("failed to decode id map: %w", err)
+		}
+		return labels, filePath, func() {}, nil
+	}
+
+	// the map of an older file belongs to its data even if a save crashed
+	// after writing the map of the next one
+	idMap := make([]byte, binary.LittleEndian.Uint64(header[len(hnswIDMagic):]))
+	if _, err := io.ReadFull(f, idMap); err != nil {
+		return nil, "", nil, fmt.Errorf("failed to read id map: %w", err)
+	}
+	if err := json.Unmarshal(idMap, &labels); err != nil {
+		return nil, "", nil, fmt.Errorf("failed to decode id map: %w", err)
+	}
+
+	graph, err := os.CreateTemp(path.Dir(filePath), "hnsw-*"+tmpSuffix)
+	if err != nil {
+		return nil, "", nil, err
+	}
+	cleanup = func() { os.Remove(graph.Name()) }
+	if _, err := io.Copy(graph, f); err != nil {
+		graph.Close()
+		cleanup()
+		return nil, "", nil, err
+	}
+	if err := graph.Close(); err != nil {
+		cleanup()
+		return nil, "", nil, err
+	}
+	return labels, graph.Name(), cleanup, nil
+}
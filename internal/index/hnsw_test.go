@@ -1,14 +1,115 @@
 package index
 
 import (
+	"encoding/binary"
+	"math/rand"
+	"os"
+	"path"
+	"slices"
+	"sync"
 	"testing"
 
+	"oasisdb/pkg/errors"
+
 	"github.com/stretchr/testify/assert"
 )
 
-func TestStringToID(t *testing.T) {
-	id := stringToID("1")
-	assert.Equal(t, uint32(id), uint32(1))
+func TestHNSWIndexLabels(t *testing.T) {
+	index, err := newHNSWIndex(&IndexConfig{Dimension: 2, SpaceType: L2Space})
+	assert.NoError(t, err)
+	h := index.(*hnswIndex)
+
+	label, ok := h.label("7", false)
+	assert.True(t, ok)
+	assert.Equal(t, uint32(7), label)
+
+	// non-canonical numbers would collide with "7"
+	for _, id := range []string{"doc", "07", "-7"} {
+		_, ok := h.label(id, false)
+		assert.False(t, ok)
+		label, ok := h.label(id, true)
+		assert.True(t, ok)
+		assert.GreaterOrEqual(t, label, uint32(mappedLabelStart))
+		assert.Equal(t, id, h.documentID(label))
+	}
+	again, _ := h.label("doc", true)
+	first, _ := h.label("doc", false)
+	assert.Equal(t, first, again)
+}
+
+func TestHNSWIndexUpsert(t *testing.T) {
+	index, err := newHNSWIndex(&IndexConfig{Dimension: 2, SpaceType: L2Space})
+	assert.NoError(t, err)
+	defer index.Close()
+
+	assert.NoError(t, index.Add("alpha", []float32{1, 0}))
+	assert.NoError(t, index.Add("beta", []float32{0, 1}))
+	assert.NoError(t, index.Add("alpha", []float32{5, 5}))
+	assert.NoError(t, index.AddBatch([]string{"gamma", "gamma"}, [][]float32{{9, 9}, {-1, -1}}))
+
+	vector, err := index.GetVector("alpha")
+	assert.NoError(t, err)
+	assert.Equal(t, []float32{5, 5}, vector)
+	vector, err = index.GetVector("gamma")
+	assert.NoError(t, err)
+	assert.Equal(t, []float32{-1, -1}, vector)
+
+	// each ID is a single point
+	result, err := index.Search([]float32{5, 5}, 10)
+	assert.NoError(t, err)
+	assert.ElementsMatch(t, []string{"alpha", "beta", "gamma"}, result.IDs)
+	assert.Equal(t, "alpha", result.IDs[0])
+
+	// an ID added after its delete is restored
+	assert.NoError(t, index.Delete("beta"))
+	_, err = index.GetVector("beta")
+	assert.Error(t, err)
+	assert.NoError(t, index.Add("beta", []float32{0, 2}))
+	result, err = index.Search([]float32{0, 2}, 1)
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"beta"}, result.IDs)
+
+	// the ID map is saved with the index
+	filePath := path.Join(t.TempDir(), "index.idx")
+	assert.NoError(t, index.Save(filePath))
+	loaded, err := newHNSWIndex(&IndexConfig{Dimension: 2, SpaceType: L2Space})
+	assert.NoError(t, err)
+	defer loaded.Close()
+	assert.NoError(t, loaded.Load(filePath))
+	vector, err = loaded.GetVector("alpha")
+	assert.NoError(t, err)
+	assert.Equal(t, []float32{5, 5}, vector)
+	assert.NoError(t, loaded.Add("delta", []float32{3, 3}))
+	result, err = loaded.Search([]float32{3, 3}, 4)
+	assert.NoError(t, err)
+	assert.ElementsMatch(t, []string{"alpha", "beta", "gamma", "delta"}, result.IDs)
+	entries, err := os.ReadDir(path.Dir(filePath))
+	assert.NoError(t, err)
+	names := make([]string, 0, len(entries))
+	for _, entry := range entries {
+		names = append(names, entry.Name())
+	}
+	assert.ElementsMatch(t, []string{"index.idx", "index.idx" + hnswIDsSuffix}, names, "the ID map is kept next to the hnswlib file")
+
+	// files carrying the ID map ahead of the hnswlib data still load
+	legacyPath := path.Join(t.TempDir(), "legacy.idx")
+	graph, err := os.ReadFile(filePath)
+	assert.NoError(t, err)
+	idMap, err := os.ReadFile(hnswIDsFile(filePath))
+	assert.NoError(t, err)
+	header := make([]byte, len(hnswIDMagic)+8)
+	copy(header, hnswIDMagic)
+	binary.LittleEndian.PutUint64(header[len(hnswIDMagic):], uint64(len(idMap)))
+	assert.NoError(t, os.WriteFile(legacyPath, slices.Concat(header, idMap, graph), 0644))
+	legacy, err := newHNSWIndex(&IndexConfig{Dimension: 2, SpaceType: L2Space})
+	assert.NoError(t, err)
+	defer legacy.Close()
+	assert.NoError(t, legacy.Load(legacyPath))
+	vector, err = legacy.GetVector("gamma")
+	assert.NoError(t, err)
+	expected, err := loaded.GetVector("gamma")
+	assert.NoError(t, err)
+	assert.Equal(t, expected, vector)
 }
 
 func TestIDToString(t *testing.T) {
@@ -60,6 +161,273 @@ func TestHNSWIndex(t *testing.T) {
 	assert.NotEqual(t, "1", result.IDs[0]) // 删除后不应该返回ID "1"
 }
 
+func TestHNSWIndexListClusters(t *testing.T) {
+	config := &IndexConfig{
+		Dimension: 2,
+		SpaceType: L2Space,
+		Parameters: map[string]interface{}{
+			"M":              16,
+			"efConstruction": 200,
+			"maxElements":    100,
+		},
+	}
+
+	index, err := newHNSWIndex(config)
+	assert.NoError(t, err)
+	lister := index.(ClusterLister)
+
+	clusters, err := lister.ListClusters(3)
+	assert.NoError(t, err)
+	assert.Empty(t, clusters)
+
+	for i := 1; i <= 10; i++ {
+		assert.NoError(t, index.Add(idToString(int64(i)), []float32{float32(i), 0}))
+	}
+
+	clusters, err = lister.ListClusters(3)
+	assert.NoError(t, err)
+	assert.NotEmpty(t, clusters)
+	for _, c := range clusters {
+		assert.Len(t, c.Centroid, 2)
+		assert.LessOrEqual(t, len(c.SampleIDs), 3)
+		assert.LessOrEqual(t, len(c.SampleIDs), c.Count)
+	}
+}
+
+func TestHNSWIndexExactSearch(t *testing.T) {
+	config := &IndexConfig{
+		Dimension:  2,
+		SpaceType:  L2Space,
+		Parameters: map[string]interface{}{},
+	}
+	index, err := newHNSWIndex(config)
+	assert.NoError(t, err)
+	for i := 1; i <= 10; i++ {
+		assert.NoError(t, index.Add(idToString(int64(i)), []float32{float32(i), 0}))
+	}
+	assert.NoError(t, index.Delete("3"))
+
+	result, err := index.(ExactSearcher).ExactSearch([]float32{3, 0}, 3)
+	assert.NoError(t, err)
+	assert.Len(t, result.IDs, 3)
+	assert.ElementsMatch(t, []string{"2", "4"}, result.IDs[:2])
+	assert.NotContains(t, result.IDs, "3")
+
+	_, err = index.(ExactSearcher).ExactSearch([]float32{3}, 3)
+	assert.Error(t, err)
+}
+
+func TestHNSWIndexSearchWithParams(t *testing.T) {
+	index, err := newHNSWIndex(&IndexConfig{Dimension: 8, SpaceType: L2Space})
+	assert.NoError(t, err)
+	rng := rand.New(rand.NewSource(1))
+	vector := func() []float32 {
+		v := make([]float32, 8)
+		for i := range v {
+			v[i] = rng.Float32()
+		}
+		return v
+	}
+	for i := 1; i <= 300; i++ {
+		assert.NoError(t, index.Add(idToString(int64(i)), vector()))
+	}
+
+	// an ef covering the whole index finds the exact neighbors
+	query := vector()
+	exact, err := index.(ExactSearcher).ExactSearch(query, 10)
+	assert.NoError(t, err)
+	result, err := index.(ParamSearcher).SearchWithParams(query, 10, map[string]any{"efsearch": float64(300)})
+	assert.NoError(t, err)
+	assert.Equal(t, exact.IDs, result.IDs)
+
+	_, err = index.(ParamSearcher).SearchWithParams(query, 10, map[string]any{"efsearch": float64(0)})
+	assert.ErrorIs(t, err, errors.ErrInvalidParameter)
+	_, err = index.(ParamSearcher).SearchWithParams(query, 10, map[string]any{"nprobe": float64(4)})
+	assert.ErrorIs(t, err, errors.ErrInvalidParameter)
+}
+
+func TestHNSWIndexGrows(t *testing.T) {
+	index, err := newHNSWIndex(&IndexConfig{
+		Dimension:  2,
+		SpaceType:  L2Space,
+		Parameters: map[string]interface{}{"maxElements": float64(4)},
+	})
+	assert.NoError(t, err)
+	defer index.Close()
+	h := index.(*hnswIndex)
+
+	for i := 0; i < 10; i++ {
+		assert.NoError(t, index.Add(idToString(int64(i)), []float32{float32(i), 0}))
+	}
+	ids := make([]string, 20)
+	vectors := make([][]float32, 20)
+	for i := range ids {
+		ids[i] = idToString(int64(10 + i))
+		vectors[i] = []float32{float32(10 + i), 0}
+	}
+	assert.NoError(t, index.AddBatch(ids, vectors))
+
+	assert.Equal(t, 30, h.index.GetCurrentElementCount())
+	assert.GreaterOrEqual(t, h.index.GetMaxElements(), 30)
+	assert.Zero(t, h.reserved)
+	result, err := index.Search([]float32{29, 0}, 1)
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"29"}, result.IDs)
+}
+
+func TestHNSWIndexBulkBuild(t *testing.T) {
+	index, err := newHNSWIndex(&IndexConfig{
+		Dimension:  8,
+		SpaceType:  L2Space,
+		Parameters: map[string]interface{}{"maxElements": float64(100)},
+	})
+	assert.NoError(t, err)
+	defer index.Close()
+	h := index.(*hnswIndex)
+
+	rng := rand.New(rand.NewSource(1))
+	ids := make([]string, 3000)
+	vectors := make([][]float32, len(ids))
+	for i := range ids {
+		ids[i] = idToString(int64(i))
+		vectors[i] = make([]float32, 8)
+		for j := range vectors[i] {
+			vectors[i][j] = rng.Float32()
+		}
+	}
+	var reports []int
+	var mu sync.Mutex
+	err = h.BuildWithProgress(ids, vectors, func(inserted int) {
+		mu.Lock()
+		reports = append(reports, inserted)
+		mu.Unlock()
+	})
+	assert.NoError(t, err)
+
+	// the index grows to exactly the batch, not by HNSW_GROWTH_FACTOR
+	assert.Equal(t, 3000, h.index.GetMaxElements())
+	assert.Equal(t, 3000, index.Count())
+	assert.Zero(t, h.reserved)
+	assert.Contains(t, reports, 3000)
+	assert.Contains(t, reports, HNSW_BUILD_PROGRESS_STEP)
+	// the tuned efConstruction only applies to the build
+	assert.Equal(t, DEFAULT_EF_CONSTRUCTION, h.index.GetEfConstruction())
+
+	for _, i := range []int{0, 1234, 2999} {
+		result, err := index.Search(vectors[i], 1)
+		assert.NoError(t, err)
+		assert.Equal(t, []string{ids[i]}, result.IDs)
+	}
+}
+
+func TestHNSWLevels(t *testing.T) {
+	levels := hnswLevels(100000, 16, 4)
+	counts := map[int]int{}
+	for _, level := range levels {
+		counts[level]++
+	}
+	// a point reaches level l with probability 16^-l
+	assert.InDelta(t, 100000*15/16, counts[0], 1000)
+	assert.InDelta(t, 100000*15/256, counts[1], 500)
+	assert.Empty(t, hnswLevels(0, 16, 4))
+}
+
+func TestBulkEfConstruction(t *testing.T) {
+	assert.Equal(t, DEFAULT_EF_CONSTRUCTION, bulkEfConstruction(1000, 16))
+	assert.Equal(t, DEFAULT_EF_CONSTRUCTION, bulkEfConstruction(HNSW_BULK_EF_FULL, 16))
+	assert.Equal(t, 141, bulkEfConstruction(2*HNSW_BULK_EF_FULL, 16))
+	assert.Equal(t, HNSW_BULK_EF_MIN, bulkEfConstruction(100*HNSW_BULK_EF_FULL, 16))
+	assert.Equal(t, 128, bulkEfConstruction(100*HNSW_BULK_EF_FULL, 64))
+}
+
+func TestHNSWIndexReplaceDeleted(t *testing.T) {
+	index, err := newHNSWIndex(&IndexConfig{
+		Dimension:  2,
+		SpaceType:  L2Space,
+		Parameters: map[string]interface{}{"maxElements": float64(4), "allowReplaceDeleted": true},
+	})
+	assert.NoError(t, err)
+	defer index.Close()
+	h := index.(*hnswIndex)
+
+	for i, id := range []string{"a", "b", "c", "d"} {
+		assert.NoError(t, index.Add(id, []float32{float32(i), 0}))
+	}
+	assert.NoError(t, index.Delete("a"))
+	assert.NoError(t, index.Delete("b"))
+
+	// new IDs take the deleted slots instead of growing the index
+	assert.NoError(t, index.AddBatch([]string{"e", "f"}, [][]float32{{10, 0}, {11, 0}}))
+	assert.Equal(t, 4, h.index.GetMaxElements())
+	assert.Equal(t, 4, h.index.GetCurrentElementCount())
+	_, err = index.GetVector("a")
+	assert.ErrorIs(t, err, errors.ErrDocumentNotFound)
+	result, err := index.Search([]float32{11, 0}, 10)
+	assert.NoError(t, err)
+	assert.ElementsMatch(t, []string{"c", "d", "e", "f"}, result.IDs)
+
+	// an existing ID is updated in place, a replaced one is added again
+	assert.NoError(t, index.Add("c", []float32{12, 0}))
+	assert.NoError(t, index.Add("a", []float32{13, 0}))
+	assert.Equal(t, 5, h.index.GetCurrentElementCount())
+	result, err = index.Search([]float32{13, 0}, 2)
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"a", "c"}, result.IDs)
+}
+
+func TestHNSWIndexLoadKeepsEf(t *testing.T) {
+	index, err := newHNSWIndex(&IndexConfig{Dimension: 2, SpaceType: L2Space})
+	assert.NoError(t, err)
+	defer index.Close()
+	h := index.(*hnswIndex)
+	assert.NoError(t, index.Add("1", []float32{1, 0}))
+	assert.NoError(t, h.SetEfSearch(77))
+	assert.Equal(t, 77, h.index.GetEf())
+
+	file := path.Join(t.TempDir(), "index.idx")
+	assert.NoError(t, index.Save(file))
+	assert.NoError(t, index.Load(file))
+	assert.Equal(t, 77, h.index.GetEf())
+}
+
+func TestHNSWIndexVacuum(t *testing.T) {
+	index, err := newHNSWIndex(&IndexConfig{Dimension: 2, SpaceType: L2Space})
+	assert.NoError(t, err)
+	defer index.Close()
+	h := index.(*hnswIndex)
+
+	for i, id := range []string{"a", "b", "c", "7"} {
+		assert.NoError(t, index.Add(id, []float32{float32(i), 0}))
+	}
+	assert.NoError(t, index.Delete("a"))
+	assert.NoError(t, index.Delete("7"))
+	deleted, total := h.Tombstones()
+	assert.Equal(t, 2, deleted)
+	assert.Equal(t, 4, total)
+
+	purged, err := h.Vacuum()
+	assert.NoError(t, err)
+	assert.Equal(t, 2, purged)
+	deleted, total = h.Tombstones()
+	assert.Zero(t, deleted)
+	assert.Equal(t, 2, total)
+	assert.NotContains(t, h.labels, "a")
+
+	// string IDs keep their labels, new ones don't reuse purged labels
+	result, err := index.Search([]float32{2, 0}, 10)
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"c", "b"}, result.IDs)
+	assert.NoError(t, index.Add("d", []float32{3, 0}))
+	assert.NoError(t, index.Add("a", []float32{4, 0}))
+	result, err = index.Search([]float32{4, 0}, 10)
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"a", "d", "c", "b"}, result.IDs)
+
+	purged, err = h.Vacuum()
+	assert.NoError(t, err)
+	assert.Zero(t, purged)
+}
+
 func TestHNSWIndexInvalidInputs(t *testing.T) {
 	// 测试无效的维度
 	config := &IndexConfig{
@@ -85,4 +453,9 @@ func TestHNSWIndexInvalidInputs(t *testing.T) {
 	ids := []string{"1", "2"} // 多一个ID
 	err = index.AddBatch(ids, vectors)
 	assert.Error(t, err)
+
+	// 测试无效的构建线程数
+	config.Parameters = map[string]interface{}{"buildThreads": float64(-1)}
+	_, err = newHNSWIndex(config)
+	assert.ErrorIs(t, err, errors.ErrInvalidParameter)
 }
@@ -1,52 +1,52 @@
 package index
 
-// SpaceType represents the distance metric type
-type SpaceType string
-type IndexType string
-
-// IndexConfig represents index configuration
-type IndexConfig struct {
-	SpaceType  SpaceType              // distance metric type
-	IndexType  IndexType              // index type (e.g., "hnsw", "ivf")
-	Dimension  int                    // vector dimension
-	Parameters map[string]interface{} // index-specific parameters
+import "oasisdb/pkg/vectorindex"
+
+// The index interface and the types it needs are public so that applications
+// can register index types of their own, see vectorindex.Register
+type (
+	SpaceType    = vectorindex.SpaceType
+	IndexType    = vectorindex.IndexType
+	IndexConfig  = vectorindex.IndexConfig
+	SearchResult = vectorindex.SearchResult
+	IndexStats   = vectorindex.IndexStats
+	VectorIndex  = vectorindex.VectorIndex
+)
+
+// Cluster summarizes one region of the embedding space
+type Cluster struct {
+	ID        int       // cluster number within the index
+	Centroid  []float32 // representative vector of the cluster
+	Count     int       // number of vectors assigned to the cluster
+	SampleIDs []string  // a few member document IDs
 }
 
-// SearchResult represents a search result
-type SearchResult struct {
-	IDs       []string  // document IDs
-	Distances []float32 // distances to query vector
+// ClusterLister is implemented by indices that can describe their clustering,
+// IVF indices return their centroids and HNSW its level-0 entry points
+type ClusterLister interface {
+	// ListClusters returns all clusters with at most sampleSize member IDs each
+	ListClusters(sampleSize int) ([]Cluster, error)
 }
 
-// VectorIndex represents a vector index
-type VectorIndex interface {
-	// Add adds a vector to the index
-	Add(id string, vector []float32) error
-
-	// AddBatch adds multiple vectors to the index
-	AddBatch(ids []string, vectors [][]float32) error
-
-	// Build builds the index
-	Build(ids []string, vectors [][]float32) error
-
-	// Delete removes a vector from the index
-	Delete(id string) error
-
-	// Search performs a k-NN search
-	Search(vector []float32, k int) (*SearchResult, error)
-
-	// GetVector gets a vector by ID
-	GetVector(id string) ([]float32, error)
-
-	// SetParams sets index parameters
-	SetParams(params map[string]any) error
-
-	// Load loads the index from disk
-	Load(filePath string) error
+// ExactSearcher is implemented by indices that can run an exhaustive search,
+// used as ground truth to measure the recall of approximate searches
+type ExactSearcher interface {
+	// ExactSearch returns the true k nearest neighbors by brute force
+	ExactSearch(vector []float32, k int) (*SearchResult, error)
+}
 
-	// Save saves the index to disk
-	Save(filePath string) error
+// ParamSearcher is implemented by indices whose query-time parameters, such
+// as efsearch or nprobe, can be overridden for a single search
+type ParamSearcher interface {
+	// SearchWithParams performs a k-NN search with params applied to this
+	// search only, the parameters of the index are left unchanged
+	SearchWithParams(vector []float32, k int, params map[string]any) (*SearchResult, error)
+}
 
-	// Close closes the index and releases resources
-	Close() error
+// ProgressBuilder is implemented by indices whose builds report how far they
+// got, the manager publishes it as the progress of the build job
+type ProgressBuilder interface {
+	// BuildWithProgress builds the index like Build, calling progress with the
+	// number of vectors inserted so far
+	BuildWithProgress(ids []string, vectors [][]float32, progress func(inserted int)) error
 }
@@ -2,30 +2,69 @@ package index
 
 import (
 	"encoding/json"
+	stderrors "errors"
 	"fmt"
+	"io"
 	"os"
 	"path"
+	"runtime"
 	"sort"
 	"strings"
 	"sync"
 	"time"
 
 	"oasisdb/internal/config"
-	"oasisdb/internal/storage/wal"
 	"oasisdb/pkg/errors"
 	"oasisdb/pkg/logger"
 )
 
-// Manager manages vector index instances
+// Manager manages vector index instances. mu only guards the maps, every
+// index has locks of its own so operations on one collection don't wait for
+// another
 type Manager struct {
 	conf       *config.Config
 	mu         sync.RWMutex
-	indices    map[string]VectorIndex // collection name -> index
+	indices    map[string]VectorIndex  // collection name -> index
+	locks      map[string]*indexLocks  // collection name -> locks of its index
+	unloaded   map[string]*IndexConfig // collection name -> config of a checkpointed index not in memory
 	indexCh    chan indexSaveItem
 	stopCh     chan struct{}
 	doneCh     chan struct{} // signal when monitorIndexSave is done
 	stopSaveCh map[string]chan struct{}
-	walWriter  *wal.WALWriter
+
+	loadMu   sync.Mutex // serializes the loads of unloaded indices
+	lastUsed sync.Map   // collection name -> time of its last lookup, with IdleUnloadSeconds
+
+	walMu sync.Mutex
+	wals  map[string]*collectionWAL // collection name -> WAL
+
+	onWrite func(entry *WALEntry) // called with every logged operation, see SetWriteHook
+
+	ckMu      sync.Mutex
+	pending   map[string]int  // writes since the last checkpoint
+	queued    map[string]bool // checkpoint requested on indexCh
+	vacuuming map[string]bool // automatic vacuum running
+
+	reindexing map[string][]*WALEntry // writes made while the collection is reindexed
+
+	jobsMu    sync.Mutex
+	jobs      []*buildJob // running and last finished builds, see Jobs
+	lastJobID int64
+}
+
+// SetWriteHook registers a function called with every operation changing an
+// index, in the order they are applied to it. Builds are passed as regular
+// build operations even when they bypass the WAL. It must be set before the
+// first write and must not call into the manager
+func (m *Manager) SetWriteHook(hook func(entry *WALEntry)) {
+	m.onWrite = hook
+}
+
+// indexLocks order the operations on one index, they are taken in the order
+// ref, mu, then Manager.mu
+type indexLocks struct {
+	ref sync.RWMutex // held shared while the index is acquired
+	mu  sync.RWMutex // held by writes, shared by reads and checkpoints
 }
 
 type indexSaveItem struct {
@@ -38,10 +77,17 @@ func NewIndexManager(conf *config.Config) (*Manager, error) {
 	m := &Manager{
 		conf:       conf,
 		indices:    make(map[string]VectorIndex),
+		locks:      make(map[string]*indexLocks),
+		unloaded:   make(map[string]*IndexConfig),
 		indexCh:    make(chan indexSaveItem, 100),
 		stopCh:     make(chan struct{}),
 		doneCh:     make(chan struct{}),
 		stopSaveCh: make(map[string]chan struct{}),
+		wals:       make(map[string]*collectionWAL),
+		pending:    make(map[string]int),
+		queued:     make(map[string]bool),
+		vacuuming:  make(map[string]bool),
+		reindexing: make(map[string][]*WALEntry),
 	}
 	if err := m.LoadIndexs(); err != nil {
 		return nil, err
@@ -50,9 +96,14 @@ func NewIndexManager(conf *config.Config) (*Manager, error) {
 	return m, nil
 }
 
+// reconstructIndex replays the WAL of every collection, segments in sequence
+// order and every entry of a segment in write order. A torn last record was
+// never acknowledged, its segment is truncated before it and the later
+// segments, written after a restart, are still replayed. Any other damage
+// fails the load
 func (m *Manager) reconstructIndex() error {
-	// 1. Read WAL directory for index
-	entries, err := os.ReadDir(path.Join(m.conf.Dir, "walfile", "index"))
+	walRoot := m.conf.IndexWALDir()
+	entries, err := os.ReadDir(walRoot)
 	if err != nil {
 		if os.IsNotExist(err) {
 			return nil
@@ -60,160 +111,222 @@ func (m *Manager) reconstructIndex() error {
 		return fmt.Errorf("failed to read WAL directory: %w", err)
 	}
 
-	// 2. Sort WAL files by creation time
-	sort.Slice(entries, func(i, j int) bool {
-		info1, err1 := entries[i].Info()
-		info2, err2 := entries[j].Info()
-		if err1 != nil || err2 != nil {
-			return entries[i].Name() < entries[j].Name()
-		}
-		return info1.ModTime().Before(info2.ModTime())
-	})
-
-	// 3. Process each WAL file
 	for _, entry := range entries {
-		if !strings.HasSuffix(entry.Name(), ".wal") {
-			continue
-		}
-
-		walPath := path.Join(m.conf.Dir, "walfile", "index", entry.Name())
-		walReader, err := wal.NewWALReader(walPath)
-		if err != nil {
-			logger.Error("Failed to create WAL reader", "file", entry.Name(), "error", err)
+		if !entry.IsDir() {
+			// a legacy WAL file that couldn't be migrated
+			logger.Warn("Skip WAL file outside a collection directory", "file", entry.Name())
 			continue
 		}
-		defer walReader.Close()
 
-		data, err := os.ReadFile(walPath)
+		walDir := path.Join(walRoot, entry.Name())
+		seqs, err := listSegments(walDir)
 		if err != nil {
-			logger.Error("Failed to read WAL file", "file", entry.Name(), "error", err)
+			logger.Error("Failed to list WAL segments", "dir", entry.Name(), "error", err)
 			continue
 		}
-
-		walEntry, err := decodeWALEntry(data)
-		if err != nil {
-			logger.Error("Failed to decode WAL entry", "file", entry.Name(), "error", err)
-			continue
-		}
-
-		// Handle operation
-		if walEntry.OpType == WALOpCreateIndex {
-			var createData CreateIndexData
-			if err := json.Unmarshal(walEntry.Data, &createData); err != nil {
-				logger.Error("Failed to unmarshal create index data", "file", entry.Name(), "error", err)
-				continue
-			}
-
-			// Create index
-			var index VectorIndex
-			switch createData.Config.IndexType {
-			case HNSWIndex:
-				index, err = newHNSWIndex(createData.Config)
-			case IVFFLATIndex:
-				index, err = newIVFIndex(createData.Config)
-			case IVFPQIndex:
-				index, err = newIVFPQIndex(createData.Config)
-			default:
-				logger.Error("Unsupported index type", "file", entry.Name(), "type", createData.Config.IndexType)
+		// a bulk build snapshot holds the segments logged before its marker
+		for _, seq := range seqs[snapshotSegment(walDir, seqs):] {
+			file := segmentPath(walDir, seq)
+			good, err := replaySegment(file, func(walEntry *WALEntry) {
+				if err := m.replayEntry(walEntry); err != nil {
+					logger.Error("Failed to replay WAL entry", "collection", walEntry.Collection, "op", walEntry.OpType, "error", err)
+				}
+			})
+			if stderrors.Is(err, io.ErrUnexpectedEOF) {
+				logger.Warn("Truncating torn WAL record", "dir", entry.Name(), "segment", seq, "offset", good)
+				if err := os.Truncate(file, good); err != nil {
+					return fmt.Errorf("failed to truncate torn WAL record: %w", err)
+				}
 				continue
 			}
-
 			if err != nil {
-				logger.Error("Failed to create index", "file", entry.Name(), "error", err)
-				continue
+				return fmt.Errorf("failed to read WAL segment %d of %s: %w", seq, entry.Name(), err)
 			}
+		}
+	}
 
-			// Store index
-			m.indices[walEntry.Collection] = index
-			logger.Info("Reconstructed index from WAL", "collection", walEntry.Collection)
-		} else {
-			// Apply operation to existing index
-			if err := m.ApplyOpWithWal(walEntry); err != nil {
-				logger.Error("Failed to apply WAL entry", "collection", walEntry.Collection, "error", err)
-				continue
-			}
+	return nil
+}
+
+// replayEntry applies a WAL entry read at startup, the replayed writes count
+// towards the next checkpoint so the WAL is truncated even without new writes
+func (m *Manager) replayEntry(walEntry *WALEntry) error {
+	if walEntry.OpType != WALOpCreateIndex {
+		// loads a lazily loaded index with writes after its checkpoint
+		index, _, err := m.lookup(walEntry.Collection)
+		if err != nil {
+			return fmt.Errorf("index not found for collection %s: %w", walEntry.Collection, err)
+		}
+		if err := m.applyOp(index, walEntry); err != nil {
+			return err
 		}
+		m.pending[walEntry.Collection]++
+		return nil
+	}
+
+	if _, loaded := m.indices[walEntry.Collection]; loaded {
+		return nil
+	}
+	if _, unloaded := m.unloaded[walEntry.Collection]; unloaded {
+		return nil
+	}
+	var createData CreateIndexData
+	if err := json.Unmarshal(walEntry.Data, &createData); err != nil {
+		return fmt.Errorf("failed to unmarshal create index data: %w", err)
+	}
+
+	index, err := newIndex(createData.Config)
+	if err != nil {
+		return fmt.Errorf("failed to create index: %w", err)
+	}
+	// the config may be lost if the process died right after the create
+	if err := m.writeIndexConfig(walEntry.Collection, createData.Config); err != nil {
+		index.Close()
+		return err
 	}
 
+	m.storeIndex(walEntry.Collection, index)
+	m.pending[walEntry.Collection]++
+	logger.Info("Reconstructed index from WAL", "collection", walEntry.Collection)
 	return nil
 }
 
-// LoadIndexs loads all indexes from disk
+// LoadIndexs loads all indexes from disk, with LazyLoad only their configs
+// and the indices with writes in the WAL
 func (m *Manager) LoadIndexs() error {
+	// files named by older versions are renamed before they are read
+	if err := m.migrateFiles(); err != nil {
+		return fmt.Errorf("failed to migrate index files: %w", err)
+	}
+
 	// 1. Read index directory
-	entries, err := os.ReadDir(path.Join(m.conf.Dir, "indexfile"))
+	entries, err := os.ReadDir(m.conf.IndexDir())
 	if err != nil {
 		if os.IsNotExist(err) {
-			if err := os.MkdirAll(path.Join(m.conf.Dir, "indexfile"), 0755); err != nil {
+			if err := os.MkdirAll(m.conf.IndexDir(), 0755); err != nil {
 				return fmt.Errorf("failed to create index directory: %w", err)
 			}
-			return nil
+			// nothing was checkpointed yet, the WAL may still hold writes
+			return m.reconstructIndex()
 		}
 		return errors.ErrFailedToLoadIndex
 	}
 
-	// 2. Reconstruct index from WAL
-	if err := m.reconstructIndex(); err != nil {
-		return err
-	}
-
-	// 3. Load each index file
+	// 2. Load each checkpointed index, named by its config file
+	configs := make(map[string]*IndexConfig)
 	for _, entry := range entries {
 		if entry.IsDir() {
 			continue
 		}
+		if strings.HasSuffix(entry.Name(), tmpSuffix) || strings.HasSuffix(entry.Name(), tmpSuffix+hnswIDsSuffix) {
+			// left by a save interrupted by a crash, its WAL was kept
+			tmpPath := path.Join(m.conf.IndexDir(), entry.Name())
+			if err := os.Remove(tmpPath); err != nil {
+				logger.Error("Failed to remove partial index file", "file", entry.Name(), "error", err)
+			} else {
+				logger.Info("Removed partial index file", "file", entry.Name())
+			}
+			continue
+		}
+		if !strings.HasSuffix(entry.Name(), ".conf") {
+			continue
+		}
 
-		// Parse filename to get collection name and config
-		collectionName := strings.TrimSuffix(entry.Name(), ".idx")
-		configPath := path.Join(m.conf.Dir, "indexfile", collectionName+".conf")
-
-		// Read config file
-		configData, err := os.ReadFile(configPath)
+		// Read config file, it names the collection
+		file, err := readConfigFile(path.Join(m.conf.IndexDir(), entry.Name()))
 		if err != nil {
-			logger.Error("Failed to read index config", "collection", collectionName, "error", err)
+			logger.Error("Failed to read index config", "file", entry.Name(), "error", err)
 			continue
 		}
-
-		var config IndexConfig
-		if err := json.Unmarshal(configData, &config); err != nil {
-			logger.Error("Failed to parse index config", "collection", collectionName, "error", err)
+		collectionName, config := file.Collection, file.IndexConfig
+		if entry.Name() != path.Base(m.configFile(collectionName)) {
+			// left by a migration that failed, logged already
 			continue
 		}
-
-		// Create index
-		var index VectorIndex
-		switch config.IndexType {
-		case HNSWIndex:
-			index, err = newHNSWIndex(&config)
-		case IVFFLATIndex:
-			index, err = newIVFIndex(&config)
-		case IVFPQIndex:
-			index, err = newIVFPQIndex(&config)
-		case FLATIndex:
-			index, err = newFlatIndex(&config)
-		default:
-			logger.Error("Unsupported index type", "collection", collectionName, "type", config.IndexType)
+		if !m.checkpointed(m.indexFile(collectionName)) {
+			// never checkpointed, the WAL recreates it
 			continue
 		}
-
-		if err != nil {
-			logger.Error("Failed to create index", "collection", collectionName, "error", err)
+		if m.conf.Index.LazyLoad {
+			// loaded by its first lookup
+			m.unloaded[collectionName] = config
 			continue
 		}
+		configs[collectionName] = config
+	}
+	m.loadCheckpointed(configs)
 
-		// Load index data
-		indexPath := path.Join(m.conf.Dir, "indexfile", entry.Name())
-		if err := index.Load(indexPath); err != nil {
-			logger.Error("Failed to load index data", "collection", collectionName, "error", err)
-			continue
+	// 3. Replay writes made since the last checkpoint from the WAL, once
+	// every index is loaded
+	return m.reconstructIndex()
+}
+
+// loadCheckpointed loads the index files of collections with LoadThreads
+// goroutines, the largest first so a big index doesn't start last. An index
+// that fails to load is left out
+func (m *Manager) loadCheckpointed(configs map[string]*IndexConfig) {
+	if len(configs) == 0 {
+		return
+	}
+	names := make([]string, 0, len(configs))
+	sizes := make(map[string]int64, len(configs))
+	for name := range configs {
+		names = append(names, name)
+		if info, err := os.Stat(m.indexFile(name)); err == nil {
+			sizes[name] = info.Size()
 		}
+	}
+	sort.Slice(names, func(i, j int) bool {
+		return sizes[names[i]] > sizes[names[j]]
+	})
 
-		// Store index in table
-		m.indices[collectionName] = index
-		logger.Info("Loaded vector index", "collection", collectionName, "type", config.IndexType)
+	threads := m.conf.Index.LoadThreads
+	if threads <= 0 {
+		threads = runtime.GOMAXPROCS(0)
 	}
+	start := time.Now()
+	sem := make(chan struct{}, threads)
+	var wg sync.WaitGroup
+	for _, name := range names {
+		sem <- struct{}{}
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			defer func() { <-sem }()
+
+			loadStart := time.Now()
+			index, err := m.loadIndexFile(name, configs[name])
+			if err != nil {
+				logger.Error("Failed to load index", "collection", name, "error", err)
+				return
+			}
+			m.mu.Lock()
+			m.storeIndex(name, index)
+			m.mu.Unlock()
+			logger.Info("Loaded vector index", "collection", name, "type", configs[name].IndexType,
+				"bytes", sizes[name], "duration", time.Since(loadStart))
+		}()
+	}
+	wg.Wait()
+	logger.Info("Loaded vector indices", "indices", len(names), "threads", threads, "duration", time.Since(start))
+}
 
-	return nil
+// loadIndexFile creates an index and loads its checkpointed file
+func (m *Manager) loadIndexFile(collectionName string, config *IndexConfig) (VectorIndex, error) {
+	index, err := newIndex(config)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create index: %w", err)
+	}
+	indexPath := m.indexFile(collectionName)
+	if err := m.fetchIndexFile(indexPath); err != nil {
+		index.Close()
+		return nil, err
+	}
+	if err := index.Load(indexPath); err != nil {
+		index.Close()
+		return nil, fmt.Errorf("failed to load index data: %w", err)
+	}
+	return index, nil
 }
 
 // CreateIndex creates a new vector index
@@ -222,19 +335,26 @@ func (m *Manager) CreateIndex(collectionName string, config *IndexConfig) (Vecto
 	defer m.mu.Unlock()
 
 	// Check if index already exists
-	if _, exists := m.indices[collectionName]; exists {
+	_, exists := m.indices[collectionName]
+	if _, unloaded := m.unloaded[collectionName]; exists || unloaded {
 		return nil, fmt.Errorf("index already exists for collection %s", collectionName)
 	}
 
-	// Set WAL writer
-	if err := m.setWalWriter(collectionName); err != nil {
+	// Create the index first, a config it can't be created with must not
+	// reach the WAL
+	index, err := newIndex(config)
+	if err == errors.ErrUnsupportedIndexType || isInvalidParameter(err) {
 		return nil, err
 	}
+	if err != nil {
+		return nil, errors.ErrFailedToCreateIndex
+	}
 
 	// Create WAL entry
 	createData := CreateIndexData{Config: config}
 	dataBytes, err := json.Marshal(createData)
 	if err != nil {
+		index.Close()
 		return nil, fmt.Errorf("failed to marshal create index data: %w", err)
 	}
 
@@ -245,39 +365,19 @@ func (m *Manager) CreateIndex(collectionName string, config *IndexConfig) (Vecto
 	}
 
 	// Write to WAL
-	if err := m.ApplyOpWithWal(entry); err != nil {
+	if err := m.ApplyOpWithWal(nil, entry); err != nil {
+		index.Close()
 		return nil, err
 	}
 
-	// Create index based on type
-	var index VectorIndex
-	switch config.IndexType {
-	case HNSWIndex:
-		index, err = newHNSWIndex(config)
-	case IVFFLATIndex:
-		index, err = newIVFIndex(config)
-	case IVFPQIndex:
-		index, err = newIVFPQIndex(config)
-	default:
-		return nil, errors.ErrUnsupportedIndexType
-	}
-
-	if err != nil {
-		return nil, errors.ErrFailedToCreateIndex
-	}
-
 	// Write index config to file
-	configData, err := json.Marshal(config)
-	if err != nil {
-		return nil, fmt.Errorf("failed to marshal index config: %w", err)
-	}
-	configPath := path.Join(m.conf.Dir, "indexfile", collectionName+".conf")
-	if err := os.WriteFile(configPath, configData, 0644); err != nil {
-		return nil, fmt.Errorf("failed to write index config: %w", err)
+	if err := m.writeIndexConfig(collectionName, config); err != nil {
+		index.Close()
+		return nil, err
 	}
 
 	// Store index
-	m.indices[collectionName] = index
+	m.storeIndex(collectionName, index)
 	m.indexCh <- indexSaveItem{
 		collectionName: collectionName,
 		index:          index,
@@ -287,39 +387,135 @@ func (m *Manager) CreateIndex(collectionName string, config *IndexConfig) (Vecto
 	return index, nil
 }
 
-// GetIndex retrieves an existing vector index
-func (m *Manager) GetIndex(collectionName string) (VectorIndex, error) {
+// writeIndexConfig writes the config a checkpointed index is loaded with
+func (m *Manager) writeIndexConfig(collectionName string, config *IndexConfig) error {
+	configData, err := json.Marshal(indexConfigFile{Collection: collectionName, IndexConfig: config})
+	if err != nil {
+		return fmt.Errorf("failed to marshal index config: %w", err)
+	}
+	if err := os.WriteFile(m.configFile(collectionName), configData, 0644); err != nil {
+		return fmt.Errorf("failed to write index config: %w", err)
+	}
+	return nil
+}
+
+// storeIndex registers an index and its locks, the caller must hold m.mu or
+// be the only user of the manager
+func (m *Manager) storeIndex(collectionName string, index VectorIndex) {
+	m.indices[collectionName] = index
+	m.locks[collectionName] = &indexLocks{}
+}
+
+// lookup returns an index and its locks, an unloaded index is loaded
+func (m *Manager) lookup(collectionName string) (VectorIndex, *indexLocks, error) {
+	m.touch(collectionName)
+	for {
+		m.mu.RLock()
+		index, exists := m.indices[collectionName]
+		locks := m.locks[collectionName]
+		_, unloaded := m.unloaded[collectionName]
+		m.mu.RUnlock()
+		if exists {
+			return index, locks, nil
+		}
+		if !unloaded {
+			return nil, nil, errors.ErrIndexNotFound
+		}
+		if err := m.load(collectionName); err != nil {
+			return nil, nil, err
+		}
+	}
+}
+
+// current reports whether index is still the index of the collection, it may
+// have been deleted or replaced while its locks were awaited
+func (m *Manager) current(collectionName string, index VectorIndex) bool {
 	m.mu.RLock()
 	defer m.mu.RUnlock()
+	current, exists := m.indices[collectionName]
+	return exists && current == index
+}
 
-	index, exists := m.indices[collectionName]
-	if !exists {
-		return nil, errors.ErrIndexNotFound
+// lockIndex returns an index with its mu held, exclusively for writes and
+// shared for reads, until unlock is called
+func (m *Manager) lockIndex(collectionName string, write bool) (index VectorIndex, unlock func(), err error) {
+	for {
+		index, locks, err := m.lookup(collectionName)
+		if err != nil {
+			return nil, nil, err
+		}
+		lock, unlock := locks.mu.RLock, locks.mu.RUnlock
+		if write {
+			lock, unlock = locks.mu.Lock, locks.mu.Unlock
+		}
+		lock()
+		if m.current(collectionName, index) {
+			return index, unlock, nil
+		}
+		// deleted, replaced or unloaded meanwhile, the next lookup tells
+		unlock()
 	}
+}
 
+// GetIndex retrieves an existing vector index, the index may be closed by a
+// concurrent DeleteIndex, use AcquireIndex to operate on it
+func (m *Manager) GetIndex(collectionName string) (VectorIndex, error) {
+	index, _, err := m.lookup(collectionName)
+	if err != nil {
+		return nil, err
+	}
 	return index, nil
 }
 
-// GetAllIndexNames returns all collection names that have indices
+// AcquireIndex retrieves an existing vector index and keeps it open until
+// release is called, DeleteIndex and Close wait for all acquired references
+func (m *Manager) AcquireIndex(collectionName string) (index VectorIndex, release func(), err error) {
+	for {
+		index, locks, err := m.lookup(collectionName)
+		if err != nil {
+			return nil, nil, err
+		}
+		locks.ref.RLock()
+		if m.current(collectionName, index) {
+			return index, locks.ref.RUnlock, nil
+		}
+		locks.ref.RUnlock()
+	}
+}
+
+// GetAllIndexNames returns all collection names that have indices, loaded
+// or not
 func (m *Manager) GetAllIndexNames() []string {
 	m.mu.RLock()
 	defer m.mu.RUnlock()
 
-	names := make([]string, 0, len(m.indices))
+	names := make([]string, 0, len(m.indices)+len(m.unloaded))
 	for name := range m.indices {
 		names = append(names, name)
 	}
+	for name := range m.unloaded {
+		names = append(names, name)
+	}
 	return names
 }
 
-// DeleteIndex removes a vector index
+// DeleteIndex removes a vector index, it waits for operations that acquired
+// the index to finish before closing it
 func (m *Manager) DeleteIndex(collectionName string) error {
-	m.mu.Lock()
-	defer m.mu.Unlock()
+	if m.dropUnloaded(collectionName) {
+		return nil
+	}
 
-	// Get index instance
-	index, exists := m.indices[collectionName]
-	if !exists {
+	// Wait for writes and checkpoints of the index
+	index, locks, err := m.lookup(collectionName)
+	if err != nil {
+		return err
+	}
+	locks.mu.Lock()
+	m.mu.Lock()
+	if current, exists := m.indices[collectionName]; !exists || current != index {
+		m.mu.Unlock()
+		locks.mu.Unlock()
 		return errors.ErrIndexNotFound
 	}
 
@@ -331,17 +527,32 @@ func (m *Manager) DeleteIndex(collectionName string) error {
 
 	// Remove from map to prevent new operations
 	delete(m.indices, collectionName)
-
-	// Release lock temporarily to allow any ongoing save operations to complete
-	// This prevents deadlock while ensuring safety
+	delete(m.locks, collectionName)
+	m.lastUsed.Delete(collectionName)
+	m.ckMu.Lock()
+	delete(m.pending, collectionName)
+	delete(m.queued, collectionName)
+	m.ckMu.Unlock()
+
+	// Remove the WAL before a new index of the same name can log to it
+	m.walMu.Lock()
+	if walLog, ok := m.wals[collectionName]; ok {
+		walLog.close()
+		delete(m.wals, collectionName)
+	}
+	if err := os.RemoveAll(m.walDir(collectionName)); err != nil {
+		logger.Error("Failed to delete WAL directory", "error", err)
+	}
+	m.walMu.Unlock()
+	if m.onWrite != nil {
+		m.onWrite(&WALEntry{OpType: WALOpDeleteIndex, Collection: collectionName})
+	}
 	m.mu.Unlock()
+	locks.mu.Unlock()
 
-	// Give ongoing save operations a brief moment to detect the deletion and abort
-	// This is a small optimization to reduce the chance of race conditions
-	time.Sleep(10 * time.Millisecond)
-
-	// Reacquire lock for cleanup
-	m.mu.Lock()
+	// Wait for acquired references, saves hold locks.mu and are done already
+	locks.ref.Lock()
+	defer locks.ref.Unlock()
 
 	// Close index
 	if err := index.Close(); err != nil {
@@ -349,86 +560,113 @@ func (m *Manager) DeleteIndex(collectionName string) error {
 	}
 
 	// Delete files
-	indexPath := m.newIndexFile(stringToInt32(collectionName))
-	if err := os.Remove(indexPath); err != nil && !os.IsNotExist(err) {
-		logger.Error("Failed to delete index file", "error", err)
-	}
-
-	walPath := m.newWalFile(stringToInt32(collectionName))
-	if err := os.Remove(walPath); err != nil && !os.IsNotExist(err) {
-		logger.Error("Failed to delete WAL file", "error", err)
-	}
+	m.removeIndexFile(m.indexFile(collectionName))
 
 	logger.Info("Deleted vector index and related files", "collection", collectionName)
 	return nil
 }
 
+// Running reports whether the manager is open and saving indices in the
+// background
+func (m *Manager) Running() bool {
+	select {
+	case <-m.doneCh:
+		return false
+	default:
+		return true
+	}
+}
+
 // Close closes all indices
 func (m *Manager) Close() error {
 	// First signal monitor to stop and wait for it to finish current operations
 	close(m.stopCh)
 	<-m.doneCh
 
+	// Save indices with unsaved writes so the next start replays nothing
+	for _, item := range m.pendingCheckpoints() {
+		m.checkpoint(item)
+	}
+
 	// Now it's safe to close indices
 	m.mu.Lock()
-	defer m.mu.Unlock()
+	indices, locks := m.indices, m.locks
+	m.indices = make(map[string]VectorIndex)
+	m.locks = make(map[string]*indexLocks)
+	m.mu.Unlock()
 
-	for name, index := range m.indices {
+	for name, index := range indices {
+		// wait for operations that acquired the index, they may still call
+		// into the manager so no other lock must be held here, then for
+		// writes in flight
+		locks[name].ref.Lock()
+		locks[name].mu.Lock()
 		if err := index.Close(); err != nil {
 			logger.Error("Failed to close index", "collection", name, "error", err)
 		}
+		locks[name].mu.Unlock()
+		locks[name].ref.Unlock()
 	}
 
-	m.indices = make(map[string]VectorIndex)
+	m.walMu.Lock()
+	defer m.walMu.Unlock()
+	for _, walLog := range m.wals {
+		walLog.close()
+	}
 	return nil
 }
 
-// monitorIndexSave monitors the index channel and saves the index to disk
+// monitorIndexSave monitors the index channel and saves the index to disk,
+// it also checkpoints indices with writes older than the checkpoint interval
+// logs the memory of the indices, unloads the idle ones and moves the cold
+// ones to the tier
 func (m *Manager) monitorIndexSave() error {
 	defer close(m.doneCh)
+
+	var tick <-chan time.Time
+	if m.conf.Index.CheckpointIntervalSeconds > 0 {
+		ticker := time.NewTicker(time.Duration(m.conf.Index.CheckpointIntervalSeconds) * time.Second)
+		defer ticker.Stop()
+		tick = ticker.C
+	}
+	var memoryTick <-chan time.Time
+	if m.conf.Index.MemoryLogIntervalSeconds > 0 {
+		ticker := time.NewTicker(time.Duration(m.conf.Index.MemoryLogIntervalSeconds) * time.Second)
+		defer ticker.Stop()
+		memoryTick = ticker.C
+	}
+	var tierTick <-chan time.Time
+	if m.conf.ColdTier != nil && m.conf.Tier.IntervalSeconds > 0 {
+		ticker := time.NewTicker(time.Duration(m.conf.Tier.IntervalSeconds) * time.Second)
+		defer ticker.Stop()
+		tierTick = ticker.C
+	}
+	var unloadTick <-chan time.Time
+	if idle := m.conf.Index.IdleUnloadSeconds; idle > 0 {
+		// an index stays loaded at most 1.5 times the idle period
+		ticker := time.NewTicker(max(time.Duration(idle)*time.Second/2, time.Second))
+		defer ticker.Stop()
+		unloadTick = ticker.C
+	}
+
 	for {
 		select {
 		case indexItem := <-m.indexCh:
-			// Hold read lock during the entire save operation to prevent index deletion
-			m.mu.RLock()
-			stopCh, hasStopCh := m.stopSaveCh[indexItem.collectionName]
-			_, exists := m.indices[indexItem.collectionName]
-
-			// Skip if index is being deleted or doesn't exist
-			if !exists {
-				m.mu.RUnlock()
-				logger.Info("Skip saving deleted index", "collection", indexItem.collectionName)
-				continue
-			}
+			m.checkpoint(indexItem)
 
-			// Check if save operation should be stopped
-			if hasStopCh {
-				select {
-				case <-stopCh:
-					m.mu.RUnlock()
-					logger.Info("Skip saving index due to deletion", "collection", indexItem.collectionName)
-					continue
-				default:
-				}
+		case <-tick:
+			for _, item := range m.pendingCheckpoints() {
+				m.checkpoint(item)
 			}
 
-			// Save index to disk while holding the read lock
-			if err := indexItem.index.Save(m.newIndexFile(stringToInt32(indexItem.collectionName))); err != nil {
-				m.mu.RUnlock()
-				logger.Error("Failed to save index", "error", err)
-				continue
-			}
+		case <-memoryTick:
+			m.logMemoryUsage()
 
-			// Release the lock after save is complete
-			m.mu.RUnlock()
+		case <-unloadTick:
+			m.unloadIdle()
 
-			logger.Info("Saved index to disk", "collection", indexItem.collectionName)
-
-			// Delete WAL file
-			walPath := m.newWalFile(stringToInt32(indexItem.collectionName))
-			if err := os.Remove(walPath); err != nil && !os.IsNotExist(err) {
-				logger.Error("Failed to delete WAL file", "error", err)
-			}
+		case <-tierTick:
+			m.tierColdIndices(time.Now())
 
 		case <-m.stopCh:
 			logger.Info("Stop saving index")
@@ -437,16 +675,105 @@ func (m *Manager) monitorIndexSave() error {
 	}
 }
 
-// AddVector adds a vector to the specified index with WAL support
-func (m *Manager) AddVector(collectionName string, id string, vector []float32) error {
-	m.mu.Lock()
-	defer m.mu.Unlock()
+// checkpoint saves an index to disk and truncates its WAL, the WAL is only
+// removed once the saved index is durable
+func (m *Manager) checkpoint(item indexSaveItem) {
+	// Hold the read lock of the index during the entire save to prevent its
+	// deletion and writes between the save and the WAL removal. The locks
+	// aren't taken with lockIndex, an unloaded index was saved already
+	m.mu.RLock()
+	locks := m.locks[item.collectionName]
+	m.mu.RUnlock()
+	// Skip if index is being deleted, doesn't exist or was recreated
+	if locks == nil || !m.current(item.collectionName, item.index) {
+		logger.Info("Skip saving deleted index", "collection", item.collectionName)
+		return
+	}
+	locks.mu.RLock()
+	defer locks.mu.RUnlock()
+	if !m.current(item.collectionName, item.index) {
+		logger.Info("Skip saving deleted index", "collection", item.collectionName)
+		return
+	}
 
-	// Set WAL writer
-	if err := m.setWalWriter(collectionName); err != nil {
-		return err
+	m.mu.RLock()
+	stopCh, hasStopCh := m.stopSaveCh[item.collectionName]
+	m.mu.RUnlock()
+
+	// Check if save operation should be stopped
+	if hasStopCh {
+		select {
+		case <-stopCh:
+			logger.Info("Skip saving index due to deletion", "collection", item.collectionName)
+			return
+		default:
+		}
+	}
+
+	m.ckMu.Lock()
+	delete(m.queued, item.collectionName)
+	m.ckMu.Unlock()
+
+	if err := saveIndexFile(item.index, m.indexFile(item.collectionName)); err != nil {
+		logger.Error("Failed to save index", "collection", item.collectionName, "error", err)
+		return
+	}
+
+	// Delete WAL segments, writers are excluded by the read lock
+	walLog, err := m.walLog(item.collectionName)
+	if err == nil {
+		err = walLog.truncate()
+	}
+	if err != nil {
+		logger.Error("Failed to truncate WAL", "collection", item.collectionName, "error", err)
+	}
+
+	m.ckMu.Lock()
+	writes := m.pending[item.collectionName]
+	delete(m.pending, item.collectionName)
+	m.ckMu.Unlock()
+	logger.Info("Saved index to disk", "collection", item.collectionName, "writes", writes)
+}
+
+// recordWrite counts writes towards the next checkpoint of a collection and
+// requests one once CheckpointOps is reached, the caller must hold the write
+// lock of the index
+func (m *Manager) recordWrite(collectionName string, index VectorIndex, n int) {
+	m.ckMu.Lock()
+	defer m.ckMu.Unlock()
+
+	m.pending[collectionName] += n
+	ops := m.conf.Index.CheckpointOps
+	if ops <= 0 || m.pending[collectionName] < ops || m.queued[collectionName] {
+		return
+	}
+	// never block a write on the saver, the next write retries
+	select {
+	case m.indexCh <- indexSaveItem{collectionName: collectionName, index: index}:
+		m.queued[collectionName] = true
+	default:
+		logger.Warn("Index save queue full, checkpoint delayed", "collection", collectionName)
+	}
+}
+
+// pendingCheckpoints returns the indices with writes not yet checkpointed
+func (m *Manager) pendingCheckpoints() []indexSaveItem {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	m.ckMu.Lock()
+	defer m.ckMu.Unlock()
+
+	var items []indexSaveItem
+	for name, writes := range m.pending {
+		if index, exists := m.indices[name]; exists && writes > 0 {
+			items = append(items, indexSaveItem{collectionName: name, index: index})
+		}
 	}
+	return items
+}
 
+// AddVector adds a vector to the specified index with WAL support
+func (m *Manager) AddVector(collectionName string, id string, vector []float32) error {
 	// Create WAL entry
 	addData := AddVectorData{
 		ID:     id,
@@ -463,20 +790,14 @@ func (m *Manager) AddVector(collectionName string, id string, vector []float32)
 		Data:       dataBytes,
 	}
 
-	if err := m.ApplyOpWithWal(entry); err != nil {
-		return fmt.Errorf("failed to apply WAL entry: %w", err)
-	}
-	return nil
+	return m.write(entry, 1)
 }
 
-// BuildIndex builds an index with WAL support
+// BuildIndex builds an index with WAL support, builds of at least
+// BulkBuildMin vectors take the bulk path instead
 func (m *Manager) BuildIndex(collectionName string, ids []string, vectors [][]float32) error {
-	m.mu.Lock()
-	defer m.mu.Unlock()
-
-	// Set WAL writer
-	if err := m.setWalWriter(collectionName); err != nil {
-		return err
+	if min := m.conf.Index.BulkBuildMin; min > 0 && len(ids) >= min {
+		return m.bulkBuild(collectionName, ids, vectors)
 	}
 
 	// Create WAL entry
@@ -495,22 +816,109 @@ func (m *Manager) BuildIndex(collectionName string, ids []string, vectors [][]fl
 		Data:       dataBytes,
 	}
 
-	if err := m.ApplyOpWithWal(entry); err != nil {
-		return fmt.Errorf("failed to apply WAL entry: %w", err)
+	return m.write(entry, len(ids))
+}
+
+// bulkBuild builds an index without logging its vectors: the built index is
+// saved to disk and the WAL only records a marker pointing at the snapshot, so
+// the vectors are neither encoded nor written twice. The WAL segments logged
+// before the build are held by the snapshot and removed
+func (m *Manager) bulkBuild(collectionName string, ids []string, vectors [][]float32) error {
+	index, unlock, err := m.lockIndex(collectionName, true)
+	if err != nil {
+		return fmt.Errorf("failed to build index: %w", err)
+	}
+	defer unlock()
+
+	if err := m.build(collectionName, JobBuild, index, ids, vectors); err != nil {
+		return fmt.Errorf("failed to build index: %w", err)
+	}
+	if err := saveIndexFile(index, m.indexFile(collectionName)); err != nil {
+		// the build is only in memory, log it as a regular build instead
+		logger.Error("Failed to save bulk built index, logging the build", "collection", collectionName, "error", err)
+		return m.logBuild(collectionName, index, ids, vectors)
 	}
+
+	m.ckMu.Lock()
+	delete(m.pending, collectionName)
+	m.ckMu.Unlock()
+
+	// the marker starts a segment, replay skips the segments before it even
+	// if removing them is interrupted
+	walLog, err := m.walLog(collectionName)
+	if err == nil {
+		err = m.logSnapshot(walLog, collectionName, len(ids))
+	}
+	if err != nil {
+		// the saved index is durable, replaying older writes over it is what
+		// an interrupted checkpoint does as well
+		logger.Error("Failed to log bulk build snapshot", "collection", collectionName, "error", err)
+	}
+	if m.onWrite != nil || m.isReindexing(collectionName) {
+		dataBytes, err := json.Marshal(BuildIndexData{IDs: ids, Vectors: vectors})
+		if err != nil {
+			return fmt.Errorf("failed to marshal build index data: %w", err)
+		}
+		m.written(&WALEntry{OpType: WALOpBuildIndex, Collection: collectionName, Data: dataBytes})
+	}
+	logger.Info("Bulk built index", "collection", collectionName, "vectors", len(ids))
 	return nil
 }
 
-// AddVectorBatch adds multiple vectors to the specified index with WAL support
-func (m *Manager) AddVectorBatch(collectionName string, ids []string, vectors [][]float32) error {
-	m.mu.Lock()
-	defer m.mu.Unlock()
+// logSnapshot writes a build snapshot marker as the first record of a new
+// segment and removes the segments before it
+func (m *Manager) logSnapshot(walLog *collectionWAL, collectionName string, count int) error {
+	seq := walLog.rotate()
+	dataBytes, err := json.Marshal(BuildSnapshotData{Seq: seq, Count: count})
+	if err != nil {
+		return fmt.Errorf("failed to marshal build snapshot data: %w", err)
+	}
+	entryBytes, err := encodeWALEntry(&WALEntry{
+		OpType:     WALOpBuildSnapshot,
+		Collection: collectionName,
+		Data:       dataBytes,
+	})
+	if err != nil {
+		return fmt.Errorf("failed to encode WAL entry: %w", err)
+	}
+	if err := walLog.append([]byte(collectionName), entryBytes, m.walSegmentSize()); err != nil {
+		return fmt.Errorf("failed to write to WAL: %w", err)
+	}
+	if err := walLog.sync(); err != nil {
+		return fmt.Errorf("failed to sync WAL: %w", err)
+	}
+	return walLog.removeBefore(seq)
+}
 
-	// Set WAL writer
-	if err := m.setWalWriter(collectionName); err != nil {
+// logBuild logs a build already applied to index
+func (m *Manager) logBuild(collectionName string, index VectorIndex, ids []string, vectors [][]float32) error {
+	dataBytes, err := json.Marshal(BuildIndexData{IDs: ids, Vectors: vectors})
+	if err != nil {
+		return fmt.Errorf("failed to marshal build index data: %w", err)
+	}
+	entry := &WALEntry{
+		OpType:     WALOpBuildIndex,
+		Collection: collectionName,
+		Data:       dataBytes,
+	}
+	entryBytes, err := encodeWALEntry(entry)
+	if err != nil {
+		return fmt.Errorf("failed to encode WAL entry: %w", err)
+	}
+	walLog, err := m.walLog(collectionName)
+	if err != nil {
 		return err
 	}
+	if err := walLog.append([]byte(collectionName), entryBytes, m.walSegmentSize()); err != nil {
+		return fmt.Errorf("failed to write to WAL: %w", err)
+	}
+	m.written(entry)
+	m.recordWrite(collectionName, index, len(ids))
+	return nil
+}
 
+// AddVectorBatch adds multiple vectors to the specified index with WAL support
+func (m *Manager) AddVectorBatch(collectionName string, ids []string, vectors [][]float32) error {
 	// Create WAL entry
 	addData := AddBatchData{
 		IDs:     ids,
@@ -527,23 +935,12 @@ func (m *Manager) AddVectorBatch(collectionName string, ids []string, vectors []
 		Data:       dataBytes,
 	}
 
-	if err := m.ApplyOpWithWal(entry); err != nil {
-		return fmt.Errorf("failed to apply WAL entry: %w", err)
-	}
-	return nil
+	return m.write(entry, len(ids))
 }
 
 // DeleteVector deletes a vector from the specified index with WAL support
 func (m *Manager) DeleteVector(collectionName string, id string) error {
 	// TODO: fix delete vector
-	m.mu.Lock()
-	defer m.mu.Unlock()
-
-	// Set WAL writer
-	if err := m.setWalWriter(collectionName); err != nil {
-		return err
-	}
-
 	// Create WAL entry
 	deleteData := DeleteVectorData{ID: id}
 	dataBytes, err := json.Marshal(deleteData)
@@ -557,51 +954,163 @@ func (m *Manager) DeleteVector(collectionName string, id string) error {
 		Data:       dataBytes,
 	}
 
-	if err := m.ApplyOpWithWal(entry); err != nil {
+	index, unlock, err := m.lockIndex(collectionName, true)
+	if err != nil {
+		return fmt.Errorf("failed to apply WAL entry: %w", err)
+	}
+	defer unlock()
+	if err := m.ApplyOpWithWal(index, entry); err != nil {
+		return fmt.Errorf("failed to apply WAL entry: %w", err)
+	}
+	m.recordWrite(collectionName, index, 1)
+	m.maybeVacuum(collectionName, index)
+	return nil
+}
+
+// ApplyEntry applies an operation logged by another manager, e.g. of a
+// replication leader, as if it was made on this one
+func (m *Manager) ApplyEntry(entry *WALEntry) error {
+	switch entry.OpType {
+	case WALOpCreateIndex:
+		var data CreateIndexData
+		if err := json.Unmarshal(entry.Data, &data); err != nil {
+			return fmt.Errorf("failed to unmarshal create index data: %w", err)
+		}
+		_, err := m.CreateIndex(entry.Collection, data.Config)
+		return err
+	case WALOpDeleteIndex:
+		return m.DeleteIndex(entry.Collection)
+	case WALOpBuildSnapshot:
+		return fmt.Errorf("unsupported WAL operation type: %s", entry.OpType)
+	}
+	return m.write(entry, 1)
+}
+
+// write logs and applies an operation counting n writes, holding the write
+// lock of its index only so writes to other collections run concurrently
+func (m *Manager) write(entry *WALEntry, n int) error {
+	index, unlock, err := m.lockIndex(entry.Collection, true)
+	if err != nil {
 		return fmt.Errorf("failed to apply WAL entry: %w", err)
 	}
+	defer unlock()
+	if err := m.ApplyOpWithWal(index, entry); err != nil {
+		return fmt.Errorf("failed to apply WAL entry: %w", err)
+	}
+	m.recordWrite(entry.Collection, index, n)
 	return nil
 }
 
 // GetVector gets a vector by ID from the specified index
 func (m *Manager) GetVector(collectionName string, id string) ([]float32, error) {
-	m.mu.RLock()
-	defer m.mu.RUnlock()
+	index, unlock, err := m.lockIndex(collectionName, false)
+	if err != nil {
+		return nil, err
+	}
+	defer unlock()
+	return index.GetVector(id)
+}
 
-	index, exists := m.indices[collectionName]
-	if !exists {
-		return nil, errors.ErrIndexNotFound
+// Count returns the number of vectors in the specified index
+func (m *Manager) Count(collectionName string) (int, error) {
+	index, unlock, err := m.lockIndex(collectionName, false)
+	if err != nil {
+		return 0, err
 	}
+	defer unlock()
+	return index.Count(), nil
+}
 
-	return index.GetVector(id)
+// Stats describes the specified index
+func (m *Manager) Stats(collectionName string) (*IndexStats, error) {
+	index, unlock, err := m.lockIndex(collectionName, false)
+	if err != nil {
+		return nil, err
+	}
+	defer unlock()
+	stats := index.Stats()
+	if reporter, ok := index.(MemoryReporter); ok {
+		stats.MemoryBytes = reporter.MemoryUsage()
+	}
+	return &stats, nil
 }
 
-func (m *Manager) ApplyOpWithWal(entry *WALEntry) error {
+// Iterate calls fn with every vector of the specified index until fn returns
+// false. Writes to the index wait until it returns, fn must not write to it
+func (m *Manager) Iterate(collectionName string, fn func(id string, vector []float32) bool) error {
+	index, unlock, err := m.lockIndex(collectionName, false)
+	if err != nil {
+		return err
+	}
+	defer unlock()
+	return index.Iterate(fn)
+}
+
+// ExactSearch runs a brute-force search on the specified index
+func (m *Manager) ExactSearch(collectionName string, vector []float32, k int) (*SearchResult, error) {
+	index, unlock, err := m.lockIndex(collectionName, false)
+	if err != nil {
+		return nil, err
+	}
+	defer unlock()
+
+	searcher, ok := index.(ExactSearcher)
+	if !ok {
+		return nil, errors.ErrUnsupportedIndexType
+	}
+	return searcher.ExactSearch(vector, k)
+}
+
+// ListClusters lists the clusters of the specified index
+func (m *Manager) ListClusters(collectionName string, sampleSize int) ([]Cluster, error) {
+	index, unlock, err := m.lockIndex(collectionName, false)
+	if err != nil {
+		return nil, err
+	}
+	defer unlock()
+
+	lister, ok := index.(ClusterLister)
+	if !ok {
+		return nil, errors.ErrUnsupportedIndexType
+	}
+	return lister.ListClusters(sampleSize)
+}
+
+// ApplyOpWithWal logs an operation and applies it to index, the caller must
+// hold the write lock of the index. Creating an index is only logged, with a
+// nil index and m.mu held
+func (m *Manager) ApplyOpWithWal(index VectorIndex, entry *WALEntry) error {
 	entryBytes, err := encodeWALEntry(entry)
 	if err != nil {
 		return fmt.Errorf("failed to encode WAL entry: %w", err)
 	}
 
-	if err := m.walWriter.Write([]byte(entry.Collection), entryBytes); err != nil {
-		return fmt.Errorf("failed to write to WAL: %w", err)
+	walLog, err := m.walLog(entry.Collection)
+	if err != nil {
+		return err
 	}
-
-	if entry.OpType == WALOpCreateIndex {
-		return nil
+	if err := walLog.append([]byte(entry.Collection), entryBytes, m.walSegmentSize()); err != nil {
+		return fmt.Errorf("failed to write to WAL: %w", err)
 	}
 
-	index, exists := m.indices[entry.Collection]
-	if !exists {
-		return fmt.Errorf("index not found for collection %s", entry.Collection)
+	if entry.OpType != WALOpCreateIndex {
+		if err := m.applyOp(index, entry); err != nil {
+			return err
+		}
 	}
+	m.written(entry)
+	return nil
+}
 
+// applyOp applies a logged operation to its index
+func (m *Manager) applyOp(index VectorIndex, entry *WALEntry) error {
 	switch entry.OpType {
 	case WALOpBuildIndex:
 		var data BuildIndexData
 		if err := json.Unmarshal(entry.Data, &data); err != nil {
 			return fmt.Errorf("failed to unmarshal build index data: %w", err)
 		}
-		return index.Build(data.IDs, data.Vectors)
+		return m.build(entry.Collection, JobBuild, index, data.IDs, data.Vectors)
 
 	case WALOpAddVector:
 		var data AddVectorData
@@ -617,6 +1126,10 @@ func (m *Manager) ApplyOpWithWal(entry *WALEntry) error {
 		}
 		return index.AddBatch(data.IDs, data.Vectors)
 
+	case WALOpBuildSnapshot:
+		// the build was loaded with the index file
+		return nil
+
 	case WALOpDeleteVector:
 		var data DeleteVectorData
 		if err := json.Unmarshal(entry.Data, &data); err != nil {
@@ -629,19 +1142,87 @@ func (m *Manager) ApplyOpWithWal(entry *WALEntry) error {
 	}
 }
 
-func (m *Manager) setWalWriter(collectionName string) error {
-	walWriter, err := wal.NewWALWriter(m.newWalFile(stringToInt32(collectionName)))
-	if err != nil {
-		return fmt.Errorf("failed to create WAL writer: %w", err)
+// tmpSuffix marks an index file that is still being written
+const tmpSuffix = ".tmp"
+
+// saveIndexFile saves an index crash-safely: it writes and fsyncs a temporary
+// file and renames it over indexPath, so indexPath is either the old or the
+// new index and never a truncated one
+func saveIndexFile(index VectorIndex, indexPath string) error {
+	tmpPath := indexPath + tmpSuffix
+	remove := func() {
+		os.Remove(tmpPath)
+		os.Remove(hnswIDsFile(tmpPath))
+	}
+	if err := index.Save(tmpPath); err != nil {
+		remove()
+		return err
+	}
+	if err := syncFile(tmpPath); err != nil {
+		remove()
+		return fmt.Errorf("failed to sync index file: %w", err)
+	}
+	// the ID map of an HNSW index is renamed first, labels are never reused
+	// so it still maps the old index if the process dies before the rename
+	// of the index file
+	_, err := os.Stat(hnswIDsFile(tmpPath))
+	hasIDs := err == nil
+	if hasIDs {
+		if err := syncFile(hnswIDsFile(tmpPath)); err != nil {
+			remove()
+			return fmt.Errorf("failed to sync index id map: %w", err)
+		}
+		if err := os.Rename(hnswIDsFile(tmpPath), hnswIDsFile(indexPath)); err != nil {
+			remove()
+			return fmt.Errorf("failed to rename index id map: %w", err)
+		}
+	}
+	if err := os.Rename(tmpPath, indexPath); err != nil {
+		remove()
+		return fmt.Errorf("failed to rename index file: %w", err)
+	}
+	if !hasIDs {
+		// left by an HNSW index the collection was reindexed from
+		if err := os.Remove(hnswIDsFile(indexPath)); err != nil && !os.IsNotExist(err) {
+			return fmt.Errorf("failed to remove index id map: %w", err)
+		}
+	}
+	// persist the rename itself before the WAL is deleted
+	if err := syncFile(path.Dir(indexPath)); err != nil {
+		return fmt.Errorf("failed to sync index directory: %w", err)
 	}
-	m.walWriter = walWriter
 	return nil
 }
 
-func (m *Manager) newWalFile(seq int32) string {
-	return path.Join(m.conf.Dir, "walfile", "index", fmt.Sprintf("%d.wal", seq))
+// syncFile fsyncs a file or directory
+func syncFile(name string) error {
+	f, err := os.Open(name)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	return f.Sync()
 }
 
-func (m *Manager) newIndexFile(seq int32) string {
-	return path.Join(m.conf.Dir, "indexfile", fmt.Sprintf("index_%d.idx", seq))
+// walLog returns the WAL of a collection, opening it on first use. Appending
+// to and truncating it requires the locks that exclude other writers
+func (m *Manager) walLog(collectionName string) (*collectionWAL, error) {
+	m.walMu.Lock()
+	defer m.walMu.Unlock()
+	if walLog, ok := m.wals[collectionName]; ok {
+		return walLog, nil
+	}
+	walLog, err := newCollectionWAL(m.walDir(collectionName))
+	if err != nil {
+		return nil, fmt.Errorf("failed to open WAL: %w", err)
+	}
+	m.wals[collectionName] = walLog
+	return walLog, nil
+}
+
+func (m *Manager) walSegmentSize() uint64 {
+	if m.conf.Index.WALSegmentSize > 0 {
+		return m.conf.Index.WALSegmentSize
+	}
+	return config.DefaultWALSegmentSize
 }
@@ -2,12 +2,20 @@ package index
 
 import (
 	"encoding/json"
+	"fmt"
+	"net/url"
 	"os"
 	"path"
+	"slices"
+	"strconv"
 	"testing"
+	"time"
 
 	"oasisdb/internal/config"
+	"oasisdb/internal/storage/wal"
+	"oasisdb/internal/tier/tiertest"
 	"oasisdb/pkg/errors"
+	"oasisdb/pkg/vectorindex"
 
 	"github.com/stretchr/testify/assert"
 )
@@ -58,13 +66,14 @@ func TestManagerCreateIndex(t *testing.T) {
 	assert.NotNil(t, index)
 
 	// Verify config file was created
-	configPath := path.Join(manager.conf.Dir, "indexfile", "test_collection.conf")
+	configPath := manager.configFile("test_collection")
 	configData, err := os.ReadFile(configPath)
 	assert.NoError(t, err)
 
-	var savedConfig IndexConfig
+	var savedConfig indexConfigFile
 	err = json.Unmarshal(configData, &savedConfig)
 	assert.NoError(t, err)
+	assert.Equal(t, "test_collection", savedConfig.Collection)
 	assert.Equal(t, config.IndexType, savedConfig.IndexType)
 	assert.Equal(t, config.Dimension, savedConfig.Dimension)
 
@@ -124,6 +133,587 @@ func TestManagerDeleteIndex(t *testing.T) {
 	assert.ErrorIs(t, err, errors.ErrIndexNotFound)
 }
 
+func TestSaveIndexFile(t *testing.T) {
+	dir := t.TempDir()
+	index, err := newFlatIndex(&IndexConfig{IndexType: FLATIndex, Dimension: 3, SpaceType: L2Space})
+	assert.NoError(t, err)
+	assert.NoError(t, index.Add("1", []float32{1, 2, 3}))
+
+	indexPath := path.Join(dir, "index_1.idx")
+	assert.NoError(t, os.WriteFile(indexPath, []byte("old"), 0644))
+	assert.NoError(t, saveIndexFile(index, indexPath))
+
+	// the old file was replaced and no temporary file is left
+	_, err = os.Stat(indexPath + tmpSuffix)
+	assert.True(t, os.IsNotExist(err))
+	loaded, err := newFlatIndex(&IndexConfig{IndexType: FLATIndex, Dimension: 3, SpaceType: L2Space})
+	assert.NoError(t, err)
+	assert.NoError(t, loaded.Load(indexPath))
+	vector, err := loaded.GetVector("1")
+	assert.NoError(t, err)
+	assert.Equal(t, []float32{1, 2, 3}, vector)
+}
+
+func TestManagerRemovesPartialIndexFiles(t *testing.T) {
+	tmpDir := t.TempDir()
+	assert.NoError(t, os.MkdirAll(path.Join(tmpDir, "indexfile"), 0755))
+	tmpPath := path.Join(tmpDir, "indexfile", "index_1.idx"+tmpSuffix)
+	assert.NoError(t, os.WriteFile(tmpPath, []byte("truncated"), 0644))
+	assert.NoError(t, os.WriteFile(hnswIDsFile(tmpPath), []byte("{}"), 0644))
+
+	manager, err := NewIndexManager(&config.Config{Dir: tmpDir})
+	assert.NoError(t, err)
+	defer manager.Close()
+
+	_, err = os.Stat(tmpPath)
+	assert.True(t, os.IsNotExist(err))
+	assert.NoFileExists(t, hnswIDsFile(tmpPath))
+}
+
+func TestManagerCheckpointAfterOps(t *testing.T) {
+	tmpDir := t.TempDir()
+	conf := &config.Config{Dir: tmpDir}
+	conf.Index.CheckpointOps = 2
+	manager, err := NewIndexManager(conf)
+	assert.NoError(t, err)
+
+	_, err = manager.CreateIndex("1", &IndexConfig{IndexType: HNSWIndex, Dimension: 3, SpaceType: L2Space})
+	assert.NoError(t, err)
+	assert.NoError(t, manager.AddVector("1", "1", []float32{1, 2, 3}))
+	assert.NoError(t, manager.AddVector("1", "2", []float32{4, 5, 6}))
+
+	// the second write triggers a save that truncates the WAL
+	walDir := manager.walDir("1")
+	assert.Eventually(t, func() bool {
+		seqs, err := listSegments(walDir)
+		return err == nil && len(seqs) == 0
+	}, 2*time.Second, 10*time.Millisecond)
+	_, err = os.Stat(manager.indexFile("1"))
+	assert.NoError(t, err)
+	assert.NoError(t, manager.Close())
+
+	// the checkpoint is loaded on restart
+	manager, err = NewIndexManager(conf)
+	assert.NoError(t, err)
+	defer manager.Close()
+	vector, err := manager.GetVector("1", "2")
+	assert.NoError(t, err)
+	assert.Equal(t, []float32{4, 5, 6}, vector)
+}
+
+func TestManagerCheckpointOnClose(t *testing.T) {
+	tmpDir := t.TempDir()
+	conf := &config.Config{Dir: tmpDir}
+	conf.Index.CheckpointOps = -1
+	conf.Index.CheckpointIntervalSeconds = -1
+	manager, err := NewIndexManager(conf)
+	assert.NoError(t, err)
+
+	_, err = manager.CreateIndex("1", &IndexConfig{IndexType: IVFFLATIndex, Dimension: 2, SpaceType: L2Space,
+		Parameters: map[string]interface{}{"nlist": float64(1)}})
+	assert.NoError(t, err)
+	assert.NoError(t, manager.BuildIndex("1", []string{"1", "2"}, [][]float32{{1, 0}, {0, 1}}))
+	assert.NoError(t, manager.Close())
+
+	seqs, err := listSegments(manager.walDir("1"))
+	assert.NoError(t, err)
+	assert.Empty(t, seqs)
+
+	manager, err = NewIndexManager(conf)
+	assert.NoError(t, err)
+	defer manager.Close()
+	vector, err := manager.GetVector("1", "1")
+	assert.NoError(t, err)
+	assert.Equal(t, []float32{1, 0}, vector)
+}
+
+func TestManagerMigratesLegacyFiles(t *testing.T) {
+	tmpDir := t.TempDir()
+	conf := &config.Config{Dir: tmpDir}
+	conf.Index.CheckpointOps = -1
+	conf.Index.CheckpointIntervalSeconds = -1
+	manager, err := NewIndexManager(conf)
+	assert.NoError(t, err)
+
+	// a checkpoint of the created index and a write in the WAL
+	const name = "acme:docs"
+	_, err = manager.CreateIndex(name, &IndexConfig{IndexType: FLATIndex, Dimension: 2, SpaceType: L2Space})
+	assert.NoError(t, err)
+	assert.Eventually(t, func() bool {
+		seqs, err := listSegments(manager.walDir(name))
+		return err == nil && len(seqs) == 0
+	}, 2*time.Second, 10*time.Millisecond)
+	assert.NoError(t, manager.AddVector(name, "1", []float32{1, 0}))
+	crash(manager)
+
+	// the files as named before they were named by hash
+	legacyConfig := path.Join(conf.IndexDir(), name+".conf")
+	legacyIndex := path.Join(conf.IndexDir(), fmt.Sprintf("index_%d.idx", stringToInt32(name)))
+	legacyWAL := path.Join(conf.IndexWALDir(), url.PathEscape(name))
+	file, err := readConfigFile(manager.configFile(name))
+	assert.NoError(t, err)
+	data, err := json.Marshal(file.IndexConfig)
+	assert.NoError(t, err)
+	assert.NoError(t, os.WriteFile(legacyConfig, data, 0644))
+	assert.NoError(t, os.Remove(manager.configFile(name)))
+	assert.NoError(t, os.Rename(manager.indexFile(name), legacyIndex))
+	assert.NoError(t, os.Rename(manager.walDir(name), legacyWAL))
+
+	manager, err = NewIndexManager(conf)
+	assert.NoError(t, err)
+	defer manager.Close()
+	vector, err := manager.GetVector(name, "1")
+	assert.NoError(t, err)
+	assert.Equal(t, []float32{1, 0}, vector)
+	assert.FileExists(t, manager.configFile(name))
+	assert.FileExists(t, manager.indexFile(name))
+	assert.DirExists(t, manager.walDir(name))
+	assert.NoFileExists(t, legacyConfig)
+	assert.NoFileExists(t, legacyIndex)
+	assert.NoDirExists(t, legacyWAL)
+}
+
+// crash stops a manager without checkpointing, as if the process died
+func crash(m *Manager) {
+	close(m.stopCh)
+	<-m.doneCh
+	m.walMu.Lock()
+	defer m.walMu.Unlock()
+	for _, walLog := range m.wals {
+		walLog.close()
+	}
+	for _, index := range m.indices {
+		index.Close()
+	}
+}
+
+func TestManagerReplaysSegmentedWAL(t *testing.T) {
+	tmpDir := t.TempDir()
+	conf := &config.Config{Dir: tmpDir}
+	conf.Index.CheckpointOps = -1
+	conf.Index.CheckpointIntervalSeconds = -1
+	conf.Index.WALSegmentSize = 1 // one record per segment
+	manager, err := NewIndexManager(conf)
+	assert.NoError(t, err)
+
+	// non-numeric names must not share a WAL
+	for _, name := range []string{"books", "movies"} {
+		_, err = manager.CreateIndex(name, &IndexConfig{IndexType: HNSWIndex, Dimension: 2, SpaceType: L2Space})
+		assert.NoError(t, err)
+	}
+	// wait for the checkpoints of the empty indices
+	assert.Eventually(t, func() bool {
+		for _, name := range []string{"books", "movies"} {
+			seqs, err := listSegments(manager.walDir(name))
+			if err != nil || len(seqs) > 0 {
+				return false
+			}
+		}
+		return true
+	}, 2*time.Second, 10*time.Millisecond)
+	assert.NoError(t, manager.AddVector("books", "1", []float32{1, 0}))
+	assert.NoError(t, manager.AddVector("books", "2", []float32{0, 1}))
+	assert.NoError(t, manager.DeleteVector("books", "1"))
+	assert.NoError(t, manager.AddVector("movies", "1", []float32{5, 5}))
+
+	seqs, err := listSegments(manager.walDir("books"))
+	assert.NoError(t, err)
+	assert.Equal(t, []uint64{1, 2, 3}, seqs)
+	crash(manager)
+
+	manager, err = NewIndexManager(conf)
+	assert.NoError(t, err)
+	defer manager.Close()
+
+	vector, err := manager.GetVector("books", "2")
+	assert.NoError(t, err)
+	assert.Equal(t, []float32{0, 1}, vector)
+	_, err = manager.GetVector("books", "1")
+	assert.Error(t, err, "the delete replays after the add")
+	vector, err = manager.GetVector("movies", "1")
+	assert.NoError(t, err)
+	assert.Equal(t, []float32{5, 5}, vector)
+
+	// new writes continue after the replayed segments
+	assert.NoError(t, manager.AddVector("books", "3", []float32{1, 1}))
+	seqs, err = listSegments(manager.walDir("books"))
+	assert.NoError(t, err)
+	assert.Equal(t, []uint64{1, 2, 3, 4}, seqs)
+}
+
+func TestManagerMigratesLegacyWALFiles(t *testing.T) {
+	tmpDir := t.TempDir()
+	conf := &config.Config{Dir: tmpDir}
+	conf.Index.CheckpointOps = -1
+	conf.Index.CheckpointIntervalSeconds = -1
+
+	// older versions logged into files directly in the WAL directory
+	legacyPath := path.Join(conf.IndexWALDir(), fmt.Sprintf("%d.wal", stringToInt32("books")))
+	writer, err := wal.NewWALWriter(legacyPath)
+	assert.NoError(t, err)
+	for _, entry := range []struct {
+		opType     WALOpType
+		collection string
+		data       any
+	}{
+		{WALOpCreateIndex, "books", CreateIndexData{Config: &IndexConfig{IndexType: FLATIndex, Dimension: 2, SpaceType: L2Space}}},
+		{WALOpCreateIndex, "movies", CreateIndexData{Config: &IndexConfig{IndexType: FLATIndex, Dimension: 2, SpaceType: L2Space}}},
+		{WALOpAddVector, "books", AddVectorData{ID: "1", Vector: []float32{1, 0}}},
+		{WALOpAddVector, "movies", AddVectorData{ID: "a", Vector: []float32{0, 1}}},
+	} {
+		data, err := json.Marshal(entry.data)
+		assert.NoError(t, err)
+		entryBytes, err := encodeWALEntry(&WALEntry{OpType: entry.opType, Collection: entry.collection, Data: data})
+		assert.NoError(t, err)
+		assert.NoError(t, writer.Write([]byte(entry.collection), entryBytes))
+	}
+	writer.Close()
+
+	manager, err := NewIndexManager(conf)
+	assert.NoError(t, err)
+	assert.NoFileExists(t, legacyPath)
+	for _, name := range []string{"books", "movies"} {
+		seqs, err := listSegments(manager.walDir(name))
+		assert.NoError(t, err)
+		assert.Equal(t, []uint64{0}, seqs)
+	}
+	vector, err := manager.GetVector("books", "1")
+	assert.NoError(t, err)
+	assert.Equal(t, []float32{1, 0}, vector)
+	assert.NoError(t, manager.AddVector("books", "2", []float32{1, 1}))
+	crash(manager)
+
+	// the migrated entries are replayed once, before the later writes
+	manager, err = NewIndexManager(conf)
+	assert.NoError(t, err)
+	defer manager.Close()
+	count, err := manager.Count("books")
+	assert.NoError(t, err)
+	assert.Equal(t, 2, count)
+	vector, err = manager.GetVector("movies", "a")
+	assert.NoError(t, err)
+	assert.Equal(t, []float32{0, 1}, vector)
+}
+
+func TestManagerTruncatesTornSegment(t *testing.T) {
+	tmpDir := t.TempDir()
+	conf := &config.Config{Dir: tmpDir}
+	conf.Index.CheckpointOps = -1
+	conf.Index.CheckpointIntervalSeconds = -1
+	manager, err := NewIndexManager(conf)
+	assert.NoError(t, err)
+
+	_, err = manager.CreateIndex("books", &IndexConfig{IndexType: HNSWIndex, Dimension: 2, SpaceType: L2Space})
+	assert.NoError(t, err)
+	assert.Eventually(t, func() bool {
+		seqs, err := listSegments(manager.walDir("books"))
+		return err == nil && len(seqs) == 0
+	}, 2*time.Second, 10*time.Millisecond)
+	assert.NoError(t, manager.AddVector("books", "1", []float32{1, 0}))
+	assert.NoError(t, manager.AddVector("books", "2", []float32{0, 1}))
+	seqs, err := listSegments(manager.walDir("books"))
+	assert.NoError(t, err)
+	assert.Len(t, seqs, 1)
+	crash(manager)
+
+	// the process died in the middle of the second write
+	torn := segmentPath(manager.walDir("books"), seqs[0])
+	info, err := os.Stat(torn)
+	assert.NoError(t, err)
+	assert.NoError(t, os.Truncate(torn, info.Size()-3))
+
+	// the first restart truncates the torn record and logs to a new segment
+	manager, err = NewIndexManager(conf)
+	assert.NoError(t, err)
+	_, err = manager.GetVector("books", "2")
+	assert.Error(t, err)
+	assert.NoError(t, manager.AddVector("books", "3", []float32{1, 1}))
+	crash(manager)
+
+	// the second restart replays the segment after the truncated one
+	manager, err = NewIndexManager(conf)
+	assert.NoError(t, err)
+	defer manager.Close()
+	for id, want := range map[string][]float32{"1": {1, 0}, "3": {1, 1}} {
+		vector, err := manager.GetVector("books", id)
+		assert.NoError(t, err)
+		assert.Equal(t, want, vector)
+	}
+	_, err = manager.GetVector("books", "2")
+	assert.Error(t, err)
+}
+
+func TestManagerFailsOnCorruptWAL(t *testing.T) {
+	tmpDir := t.TempDir()
+	conf := &config.Config{Dir: tmpDir}
+	conf.Index.CheckpointOps = -1
+	conf.Index.CheckpointIntervalSeconds = -1
+
+	walLog, err := newCollectionWAL(path.Join(tmpDir, "walfile", "index", "books"))
+	assert.NoError(t, err)
+	appendWAL(t, walLog, WALOpCreateIndex, "books", CreateIndexData{
+		Config: &IndexConfig{IndexType: HNSWIndex, Dimension: 2, SpaceType: L2Space},
+	})
+	assert.NoError(t, walLog.append([]byte("books"), []byte("not an entry"), config.DefaultWALSegmentSize))
+	appendWAL(t, walLog, WALOpAddVector, "books", AddVectorData{ID: "1", Vector: []float32{1, 0}})
+	walLog.close()
+
+	// a complete record that can't be decoded is damage, not a torn write
+	_, err = NewIndexManager(conf)
+	assert.Error(t, err)
+}
+
+func TestManagerSearchesDuringWrites(t *testing.T) {
+	for _, indexType := range []IndexType{FLATIndex, IVFPQIndex} {
+		t.Run(string(indexType), func(t *testing.T) {
+			manager, cleanup := setupTestManager(t)
+			defer cleanup()
+
+			_, err := manager.CreateIndex("books", &IndexConfig{
+				IndexType: indexType,
+				Dimension: 8,
+				SpaceType: L2Space,
+				Parameters: map[string]interface{}{
+					"nlist": float64(2),
+					"m":     float64(4),
+				},
+			})
+			assert.NoError(t, err)
+			ids, vectors := generatePQVectors(20, 8)
+			assert.NoError(t, manager.BuildIndex("books", ids, vectors))
+
+			// searches only acquire the index, they run alongside writes
+			done := make(chan struct{})
+			go func() {
+				defer close(done)
+				for i := range 100 {
+					assert.NoError(t, manager.AddVector("books", fmt.Sprintf("new%d", i), vectors[i%len(vectors)]))
+					if i%10 == 0 {
+						assert.NoError(t, manager.DeleteVector("books", ids[i/10]))
+					}
+				}
+			}()
+			for range 100 {
+				index, release, err := manager.AcquireIndex("books")
+				assert.NoError(t, err)
+				_, err = index.Search(vectors[0], 5)
+				assert.NoError(t, err)
+				release()
+			}
+			<-done
+		})
+	}
+}
+
+// appendWAL logs an entry the way ApplyOpWithWal does
+func appendWAL(t *testing.T, walLog *collectionWAL, opType WALOpType, collection string, data any) {
+	t.Helper()
+	dataBytes, err := json.Marshal(data)
+	assert.NoError(t, err)
+	entryBytes, err := encodeWALEntry(&WALEntry{OpType: opType, Collection: collection, Data: dataBytes})
+	assert.NoError(t, err)
+	assert.NoError(t, walLog.append([]byte(collection), entryBytes, config.DefaultWALSegmentSize))
+}
+
+func TestManagerBulkBuild(t *testing.T) {
+	tmpDir := t.TempDir()
+	conf := &config.Config{Dir: tmpDir}
+	conf.Index.CheckpointOps = -1
+	conf.Index.CheckpointIntervalSeconds = -1
+	conf.Index.BulkBuildMin = 3
+	manager, err := NewIndexManager(conf)
+	assert.NoError(t, err)
+
+	_, err = manager.CreateIndex("bulk", &IndexConfig{IndexType: HNSWIndex, Dimension: 2, SpaceType: L2Space})
+	assert.NoError(t, err)
+	waitForEmptyWAL(t, manager, "bulk")
+	assert.NoError(t, manager.AddVector("bulk", "x", []float32{9, 9}))
+	assert.NoError(t, manager.BuildIndex("bulk", []string{"a", "b", "c"}, [][]float32{{1, 0}, {0, 1}, {1, 1}}))
+
+	// the vectors are saved with the index, the WAL only holds the marker
+	dir := manager.walDir("bulk")
+	seqs, err := listSegments(dir)
+	assert.NoError(t, err)
+	assert.Len(t, seqs, 1)
+	entry, err := firstEntry(segmentPath(dir, seqs[0]))
+	assert.NoError(t, err)
+	assert.Equal(t, WALOpBuildSnapshot, entry.OpType)
+	var data BuildSnapshotData
+	assert.NoError(t, json.Unmarshal(entry.Data, &data))
+	assert.Equal(t, BuildSnapshotData{Seq: seqs[0], Count: 3}, data)
+
+	assert.NoError(t, manager.AddVector("bulk", "d", []float32{2, 2}))
+	// a segment older than the marker, as left by an interrupted removal
+	stale := &collectionWAL{dir: dir}
+	appendWAL(t, stale, WALOpDeleteVector, "bulk", DeleteVectorData{ID: "a"})
+	stale.close()
+	crash(manager)
+
+	manager, err = NewIndexManager(conf)
+	assert.NoError(t, err)
+	defer manager.Close()
+	for id, want := range map[string][]float32{"x": {9, 9}, "a": {1, 0}, "c": {1, 1}, "d": {2, 2}} {
+		vector, err := manager.GetVector("bulk", id)
+		assert.NoError(t, err, id)
+		assert.Equal(t, want, vector, id)
+	}
+
+	// smaller builds are logged
+	_, err = manager.CreateIndex("small", &IndexConfig{IndexType: HNSWIndex, Dimension: 2, SpaceType: L2Space})
+	assert.NoError(t, err)
+	waitForEmptyWAL(t, manager, "small")
+	assert.NoError(t, manager.BuildIndex("small", []string{"a"}, [][]float32{{1, 0}}))
+	seqs, err = listSegments(manager.walDir("small"))
+	assert.NoError(t, err)
+	assert.Len(t, seqs, 1)
+	entry, err = firstEntry(segmentPath(manager.walDir("small"), seqs[0]))
+	assert.NoError(t, err)
+	assert.Equal(t, WALOpBuildIndex, entry.OpType)
+}
+
+func TestManagerJobs(t *testing.T) {
+	manager, cleanup := setupTestManager(t)
+	defer cleanup()
+
+	_, err := manager.CreateIndex("jobs", &IndexConfig{IndexType: HNSWIndex, Dimension: 2, SpaceType: L2Space})
+	assert.NoError(t, err)
+	_, err = manager.CreateIndex("other", &IndexConfig{IndexType: FLATIndex, Dimension: 2, SpaceType: L2Space})
+	assert.NoError(t, err)
+	assert.NoError(t, manager.BuildIndex("jobs", []string{"a", "b"}, [][]float32{{1, 0}, {0, 1}}))
+	assert.NoError(t, manager.BuildIndex("other", []string{"a"}, [][]float32{{1, 0}}))
+	assert.Error(t, manager.BuildIndex("jobs", []string{"c"}, [][]float32{{1, 0, 0}}))
+
+	jobs := manager.Jobs("jobs")
+	assert.Len(t, jobs, 2)
+	assert.Equal(t, JobBuild, jobs[0].Kind)
+	assert.Equal(t, HNSWIndex, jobs[0].IndexType)
+	assert.Equal(t, JobDone, jobs[0].State)
+	assert.Equal(t, 2, jobs[0].Total)
+	assert.Equal(t, 2, jobs[0].Inserted)
+	assert.NotNil(t, jobs[0].FinishedAt)
+	assert.Equal(t, JobFailed, jobs[1].State)
+	assert.NotEmpty(t, jobs[1].Error)
+	assert.Less(t, jobs[0].ID, jobs[1].ID)
+	assert.Len(t, manager.Jobs(""), 3)
+
+	// the oldest finished jobs are dropped, running ones are kept
+	running := manager.startJob("jobs", JobReindex, HNSWIndex, 10)
+	for range maxFinishedJobs {
+		manager.finishJob(manager.startJob("other", JobBuild, FLATIndex, 1), nil)
+	}
+	jobs = manager.Jobs("")
+	assert.Len(t, jobs, maxFinishedJobs+1)
+	assert.Equal(t, running.ID, jobs[0].ID)
+	assert.Equal(t, JobRunning, jobs[0].State)
+	assert.Empty(t, manager.Jobs("jobs")[1:])
+}
+
+// waitForEmptyWAL waits for the checkpoint requested by creating an index
+func waitForEmptyWAL(t *testing.T, manager *Manager, collectionName string) {
+	t.Helper()
+	assert.Eventually(t, func() bool {
+		seqs, err := listSegments(manager.walDir(collectionName))
+		return err == nil && len(seqs) == 0
+	}, 2*time.Second, 10*time.Millisecond)
+}
+
+func TestManagerRecoversUncheckpointedWAL(t *testing.T) {
+	tmpDir := t.TempDir()
+	conf := &config.Config{Dir: tmpDir}
+	conf.Index.CheckpointOps = -1
+	conf.Index.CheckpointIntervalSeconds = -1
+
+	// a process that died before its first checkpoint left only the WAL
+	walLog, err := newCollectionWAL(path.Join(tmpDir, "walfile", "index", "books"))
+	assert.NoError(t, err)
+	appendWAL(t, walLog, WALOpCreateIndex, "books", CreateIndexData{
+		Config: &IndexConfig{IndexType: HNSWIndex, Dimension: 2, SpaceType: L2Space},
+	})
+	appendWAL(t, walLog, WALOpAddBatch, "books", AddBatchData{
+		IDs:     []string{"1", "2", "3"},
+		Vectors: [][]float32{{1, 0}, {0, 1}, {1, 1}},
+	})
+	appendWAL(t, walLog, WALOpDeleteVector, "books", DeleteVectorData{ID: "2"})
+	walLog.close()
+	appendWAL(t, walLog, WALOpAddVector, "books", AddVectorData{ID: "4", Vector: []float32{2, 2}})
+	walLog.close()
+
+	manager, err := NewIndexManager(conf)
+	assert.NoError(t, err)
+	for id, want := range map[string][]float32{"1": {1, 0}, "3": {1, 1}, "4": {2, 2}} {
+		vector, err := manager.GetVector("books", id)
+		assert.NoError(t, err)
+		assert.Equal(t, want, vector)
+	}
+	_, err = manager.GetVector("books", "2")
+	assert.Error(t, err)
+
+	// the replayed writes are checkpointed on close
+	assert.NoError(t, manager.Close())
+	seqs, err := listSegments(manager.walDir("books"))
+	assert.NoError(t, err)
+	assert.Empty(t, seqs)
+
+	manager, err = NewIndexManager(conf)
+	assert.NoError(t, err)
+	defer manager.Close()
+	vector, err := manager.GetVector("books", "4")
+	assert.NoError(t, err)
+	assert.Equal(t, []float32{2, 2}, vector)
+}
+
+func TestManagerDeleteIndexRemovesWAL(t *testing.T) {
+	manager, cleanup := setupTestManager(t)
+	defer cleanup()
+
+	_, err := manager.CreateIndex("books", &IndexConfig{IndexType: HNSWIndex, Dimension: 2, SpaceType: L2Space})
+	assert.NoError(t, err)
+	assert.NoError(t, manager.AddVector("books", "1", []float32{1, 0}))
+	assert.NoError(t, manager.DeleteIndex("books"))
+
+	_, err = os.Stat(manager.walDir("books"))
+	assert.True(t, os.IsNotExist(err))
+}
+
+func TestManagerDeleteIndexWaitsForAcquired(t *testing.T) {
+	manager, cleanup := setupTestManager(t)
+	defer cleanup()
+
+	config := &IndexConfig{
+		IndexType: HNSWIndex,
+		Dimension: 3,
+		SpaceType: L2Space,
+	}
+	_, err := manager.CreateIndex("test_collection", config)
+	assert.NoError(t, err)
+	assert.NoError(t, manager.AddVector("test_collection", "1", []float32{1, 2, 3}))
+
+	index, release, err := manager.AcquireIndex("test_collection")
+	assert.NoError(t, err)
+
+	deleted := make(chan error)
+	go func() {
+		deleted <- manager.DeleteIndex("test_collection")
+	}()
+
+	// the delete must not close the index while it is acquired
+	select {
+	case err := <-deleted:
+		t.Fatalf("DeleteIndex returned before release: %v", err)
+	case <-time.After(50 * time.Millisecond):
+	}
+	result, err := index.Search([]float32{1, 2, 3}, 1)
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"1"}, result.IDs)
+
+	release()
+	assert.NoError(t, <-deleted)
+
+	// Verify the index can no longer be acquired
+	_, _, err = manager.AcquireIndex("test_collection")
+	assert.ErrorIs(t, err, errors.ErrIndexNotFound)
+}
+
 func TestManagerBuildIndexHNSW(t *testing.T) {
 	manager, cleanup := setupTestManager(t)
 	defer cleanup()
@@ -256,3 +846,578 @@ func TestManagerVectorOperations(t *testing.T) {
 	// assert.NoError(t, err)
 	// assert.Equal(t, 2, len(result.IDs))
 }
+
+func TestManagerVacuum(t *testing.T) {
+	manager, cleanup := setupTestManager(t)
+	defer cleanup()
+	manager.conf.Index.VacuumDeletedRatio = 0.5
+
+	_, err := manager.CreateIndex("vacuumed", &IndexConfig{IndexType: HNSWIndex, Dimension: 2, SpaceType: L2Space})
+	assert.NoError(t, err)
+	n := 2 * vacuumMinDeleted
+	ids := make([]string, n)
+	vectors := make([][]float32, n)
+	for i := range ids {
+		ids[i] = idToString(int64(i))
+		vectors[i] = []float32{float32(i), 0}
+	}
+	assert.NoError(t, manager.AddVectorBatch("vacuumed", ids, vectors))
+
+	// deleting half of the elements starts a background vacuum
+	for _, id := range ids[:n/2] {
+		assert.NoError(t, manager.DeleteVector("vacuumed", id))
+	}
+	assert.Eventually(t, func() bool {
+		index, unlock, err := manager.lockIndex("vacuumed", false)
+		assert.NoError(t, err)
+		defer unlock()
+		deleted, _ := index.(Vacuumer).Tombstones()
+		return deleted == 0
+	}, 5*time.Second, 10*time.Millisecond)
+
+	vector, err := manager.GetVector("vacuumed", ids[n-1])
+	assert.NoError(t, err)
+	assert.Equal(t, vectors[n-1], vector)
+
+	purged, err := manager.Vacuum("vacuumed")
+	assert.NoError(t, err)
+	assert.Zero(t, purged)
+	_, err = manager.Vacuum("missing")
+	assert.ErrorIs(t, err, errors.ErrIndexNotFound)
+}
+
+func TestManagerVacuumKeepsConcurrentWrites(t *testing.T) {
+	manager, cleanup := setupTestManager(t)
+	defer cleanup()
+
+	_, err := manager.CreateIndex("vacuumed", &IndexConfig{IndexType: HNSWIndex, Dimension: 2, SpaceType: L2Space})
+	assert.NoError(t, err)
+	n := 1000
+	ids := make([]string, n)
+	vectors := make([][]float32, n)
+	for i := range ids {
+		ids[i] = idToString(int64(i))
+		vectors[i] = []float32{float32(i), 0}
+	}
+	assert.NoError(t, manager.AddVectorBatch("vacuumed", ids, vectors))
+	for _, id := range ids[:n/2] {
+		assert.NoError(t, manager.DeleteVector("vacuumed", id))
+	}
+
+	// searches and writes go on while the vacuum builds, the writes end up
+	// in the new index
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		for i := range 100 {
+			assert.NoError(t, manager.AddVector("vacuumed", fmt.Sprintf("new%d", i), []float32{float32(i), 1}))
+			assert.NoError(t, manager.DeleteVector("vacuumed", ids[n/2+i]))
+			index, release, err := manager.AcquireIndex("vacuumed")
+			assert.NoError(t, err)
+			_, err = index.Search([]float32{0, 0}, 5)
+			assert.NoError(t, err)
+			release()
+		}
+	}()
+	purged, err := manager.Vacuum("vacuumed")
+	assert.NoError(t, err)
+	assert.GreaterOrEqual(t, purged, n/2)
+	<-done
+
+	count, err := manager.Count("vacuumed")
+	assert.NoError(t, err)
+	assert.Equal(t, n/2, count)
+	for i := range 100 {
+		vector, err := manager.GetVector("vacuumed", fmt.Sprintf("new%d", i))
+		assert.NoError(t, err)
+		assert.Equal(t, []float32{float32(i), 1}, vector)
+		_, err = manager.GetVector("vacuumed", ids[n/2+i])
+		assert.ErrorIs(t, err, errors.ErrDocumentNotFound)
+	}
+}
+
+func TestManagerCountStatsIterate(t *testing.T) {
+	manager, cleanup := setupTestManager(t)
+	defer cleanup()
+
+	dim := 4
+	configs := map[string]*IndexConfig{
+		"hnsw":  {IndexType: HNSWIndex, Dimension: dim, SpaceType: L2Space},
+		"ivf":   {IndexType: IVFFLATIndex, Dimension: dim, SpaceType: L2Space, Parameters: map[string]interface{}{"nlist": float64(2)}},
+		"ivfpq": {IndexType: IVFPQIndex, Dimension: dim, SpaceType: L2Space, Parameters: map[string]interface{}{"nlist": float64(2), "m": float64(2)}},
+	}
+	ids, vectors := generateVectors(10, dim)
+	for name, cfg := range configs {
+		_, err := manager.CreateIndex(name, cfg)
+		assert.NoError(t, err)
+		assert.NoError(t, manager.BuildIndex(name, ids, vectors))
+	}
+	assert.NoError(t, manager.DeleteVector("hnsw", ids[0]))
+
+	for name, cfg := range configs {
+		want := len(ids)
+		if name == "hnsw" {
+			want--
+		}
+		count, err := manager.Count(name)
+		assert.NoError(t, err)
+		assert.Equal(t, want, count, name)
+
+		stats, err := manager.Stats(name)
+		assert.NoError(t, err)
+		assert.Equal(t, cfg.IndexType, stats.Type)
+		assert.Equal(t, dim, stats.Dimension)
+		assert.Equal(t, want, stats.Count)
+
+		seen := make(map[string][]float32)
+		assert.NoError(t, manager.Iterate(name, func(id string, vector []float32) bool {
+			seen[id] = vector
+			return true
+		}))
+		assert.Len(t, seen, want, name)
+		assert.Equal(t, vectors[5], seen[ids[5]], name)
+
+		visited := 0
+		assert.NoError(t, manager.Iterate(name, func(string, []float32) bool {
+			visited++
+			return visited < 3
+		}))
+		assert.Equal(t, 3, visited, name)
+	}
+
+	stats, err := manager.Stats("hnsw")
+	assert.NoError(t, err)
+	assert.Equal(t, 1, stats.Deleted)
+	assert.Equal(t, false, stats.Params["replace_deleted"])
+
+	_, err = manager.Count("missing")
+	assert.ErrorIs(t, err, errors.ErrIndexNotFound)
+	_, err = manager.Stats("missing")
+	assert.ErrorIs(t, err, errors.ErrIndexNotFound)
+	assert.ErrorIs(t, manager.Iterate("missing", func(string, []float32) bool { return true }), errors.ErrIndexNotFound)
+}
+
+func TestManagerRegister(t *testing.T) {
+	const custom IndexType = "test_custom"
+	created := 0
+	assert.NoError(t, vectorindex.Register(custom, func(config *IndexConfig) (VectorIndex, error) {
+		created++
+		return newFlatIndex(config)
+	}))
+	assert.Contains(t, vectorindex.RegisteredTypes(), custom)
+	assert.Contains(t, vectorindex.RegisteredTypes(), HNSWIndex)
+
+	tmpDir := t.TempDir()
+	conf := &config.Config{Dir: tmpDir}
+	manager, err := NewIndexManager(conf)
+	assert.NoError(t, err)
+
+	// an unknown type is rejected before it reaches the WAL
+	_, err = manager.CreateIndex("unknown", &IndexConfig{IndexType: "missing", Dimension: 2})
+	assert.ErrorIs(t, err, errors.ErrUnsupportedIndexType)
+	_, err = os.Stat(manager.walDir("unknown"))
+	assert.True(t, os.IsNotExist(err))
+
+	_, err = manager.CreateIndex("plugged", &IndexConfig{IndexType: custom, Dimension: 2, SpaceType: L2Space})
+	assert.NoError(t, err)
+	assert.NoError(t, manager.AddVector("plugged", "a", []float32{1, 0}))
+	assert.NoError(t, manager.Close())
+
+	// the registered type is loaded from its checkpoint
+	manager, err = NewIndexManager(conf)
+	assert.NoError(t, err)
+	defer manager.Close()
+	vector, err := manager.GetVector("plugged", "a")
+	assert.NoError(t, err)
+	assert.Equal(t, []float32{1, 0}, vector)
+	assert.Equal(t, 2, created)
+}
+
+func TestManagerCollectionsLockIndependently(t *testing.T) {
+	manager, cleanup := setupTestManager(t)
+	defer cleanup()
+
+	config := &IndexConfig{IndexType: HNSWIndex, Dimension: 2, SpaceType: L2Space}
+	for _, name := range []string{"a", "b"} {
+		_, err := manager.CreateIndex(name, config)
+		assert.NoError(t, err)
+		assert.NoError(t, manager.AddVector(name, "1", []float32{1, 0}))
+	}
+
+	// a long iteration of a holds its index, writes to a wait for it
+	iterating, finish := make(chan struct{}), make(chan struct{})
+	go func() {
+		_ = manager.Iterate("a", func(string, []float32) bool {
+			close(iterating)
+			<-finish
+			return false
+		})
+	}()
+	<-iterating
+	written := make(chan error)
+	go func() {
+		written <- manager.AddVector("a", "2", []float32{0, 1})
+	}()
+
+	// b stays readable and writable meanwhile
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		assert.NoError(t, manager.AddVector("b", "2", []float32{0, 1}))
+		vector, err := manager.GetVector("b", "2")
+		assert.NoError(t, err)
+		assert.Equal(t, []float32{0, 1}, vector)
+	}()
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		t.Fatal("operations on b waited for a")
+	}
+	select {
+	case err := <-written:
+		t.Fatalf("write to a returned during its iteration: %v", err)
+	default:
+	}
+
+	close(finish)
+	assert.NoError(t, <-written)
+	count, err := manager.Count("a")
+	assert.NoError(t, err)
+	assert.Equal(t, 2, count)
+}
+
+// BenchmarkManagerConcurrentCollections runs reads of one collection while
+// another one is written, reads used to wait for writes to any collection
+func BenchmarkManagerConcurrentCollections(b *testing.B) {
+	tmpDir := b.TempDir()
+	manager, err := NewIndexManager(&config.Config{Dir: tmpDir})
+	if err != nil {
+		b.Fatal(err)
+	}
+	defer manager.Close()
+
+	config := &IndexConfig{IndexType: HNSWIndex, Dimension: 8, SpaceType: L2Space}
+	for _, name := range []string{"read", "write"} {
+		if _, err := manager.CreateIndex(name, config); err != nil {
+			b.Fatal(err)
+		}
+	}
+	vector := make([]float32, 8)
+	for i := 0; i < 1000; i++ {
+		vector[i%8] = float32(i)
+		if err := manager.AddVector("read", strconv.Itoa(i), vector); err != nil {
+			b.Fatal(err)
+		}
+	}
+
+	stop := make(chan struct{})
+	writerDone := make(chan struct{})
+	go func() {
+		defer close(writerDone)
+		for i := 0; ; i++ {
+			select {
+			case <-stop:
+				return
+			default:
+			}
+			_ = manager.AddVector("write", strconv.Itoa(i), vector)
+		}
+	}()
+
+	b.ResetTimer()
+	b.RunParallel(func(pb *testing.PB) {
+		i := 0
+		for pb.Next() {
+			if _, err := manager.GetVector("read", strconv.Itoa(i%1000)); err != nil {
+				b.Error(err)
+				return
+			}
+			i++
+		}
+	})
+	b.StopTimer()
+	close(stop)
+	<-writerDone
+}
+
+func TestManagerCollectGarbage(t *testing.T) {
+	manager, cleanup := setupTestManager(t)
+	defer cleanup()
+	_, err := manager.CreateIndex("kept", &IndexConfig{IndexType: FLATIndex, Dimension: 3, SpaceType: L2Space})
+	assert.NoError(t, err)
+
+	// files of a collection deleted before a crash and of an interrupted build
+	indexDir := manager.conf.IndexDir()
+	orphans := []string{
+		manager.configFile("deleted"),
+		manager.indexFile("deleted"),
+		hnswIDsFile(manager.indexFile("deleted")),
+		path.Join(indexDir, "diskann-123.graph"),
+		path.Join(manager.walDir("deleted"), "00000001.wal"),
+	}
+	for _, file := range orphans {
+		assert.NoError(t, os.MkdirAll(path.Dir(file), 0755))
+		assert.NoError(t, os.WriteFile(file, []byte("orphan"), 0644))
+	}
+
+	report, err := manager.CollectGarbage(true)
+	assert.NoError(t, err)
+	assert.Len(t, report.Files, 5)
+	assert.Equal(t, int64(5*len("orphan")), report.Bytes)
+	for _, file := range orphans {
+		assert.FileExists(t, file)
+	}
+
+	report, err = manager.CollectGarbage(false)
+	assert.NoError(t, err)
+	assert.Len(t, report.Files, 5)
+	for _, file := range orphans {
+		assert.NoFileExists(t, file)
+	}
+	assert.NoDirExists(t, manager.walDir("deleted"))
+	assert.FileExists(t, manager.configFile("kept"))
+	_, err = manager.GetIndex("kept")
+	assert.NoError(t, err)
+}
+
+func TestManagerLazyLoadAndIdleUnload(t *testing.T) {
+	tmpDir := t.TempDir()
+	conf := &config.Config{Dir: tmpDir}
+	conf.Index.CheckpointOps = -1
+	conf.Index.CheckpointIntervalSeconds = -1
+	manager, err := NewIndexManager(conf)
+	assert.NoError(t, err)
+	for _, name := range []string{"saved", "logged"} {
+		_, err = manager.CreateIndex(name, &IndexConfig{IndexType: FLATIndex, Dimension: 2, SpaceType: L2Space})
+		assert.NoError(t, err)
+		assert.NoError(t, manager.AddVector(name, "1", []float32{1, 0}))
+	}
+	assert.NoError(t, manager.Close())
+
+	// "logged" has a write after its checkpoint
+	manager, err = NewIndexManager(conf)
+	assert.NoError(t, err)
+	assert.NoError(t, manager.AddVector("logged", "2", []float32{0, 1}))
+	crash(manager)
+
+	conf.Index.LazyLoad = true
+	conf.Index.IdleUnloadSeconds = 3600
+	manager, err = NewIndexManager(conf)
+	assert.NoError(t, err)
+	defer manager.Close()
+	assert.ElementsMatch(t, []string{"logged"}, manager.loadedNames())
+	assert.ElementsMatch(t, []string{"saved", "logged"}, manager.GetAllIndexNames())
+	count, err := manager.Count("logged")
+	assert.NoError(t, err)
+	assert.Equal(t, 2, count)
+
+	vector, err := manager.GetVector("saved", "1")
+	assert.NoError(t, err)
+	assert.Equal(t, []float32{1, 0}, vector)
+	assert.ElementsMatch(t, []string{"saved", "logged"}, manager.loadedNames())
+
+	// idle since the lookups above
+	manager.lastUsed.Store("logged", time.Now().Add(-2*time.Hour))
+	manager.unloadIdle()
+	assert.ElementsMatch(t, []string{"saved"}, manager.loadedNames())
+	assert.ElementsMatch(t, []string{"saved", "logged"}, manager.GetAllIndexNames())
+	seqs, err := listSegments(manager.walDir("logged"))
+	assert.NoError(t, err)
+	assert.Empty(t, seqs)
+	_, err = manager.CreateIndex("logged", &IndexConfig{IndexType: FLATIndex, Dimension: 2, SpaceType: L2Space})
+	assert.Error(t, err)
+
+	vector, err = manager.GetVector("logged", "2")
+	assert.NoError(t, err)
+	assert.Equal(t, []float32{0, 1}, vector)
+
+	manager.lastUsed.Store("saved", time.Now().Add(-2*time.Hour))
+	manager.unloadIdle()
+	assert.NoError(t, manager.DeleteIndex("saved"))
+	assert.NoFileExists(t, manager.indexFile("saved"))
+	assert.ElementsMatch(t, []string{"logged"}, manager.GetAllIndexNames())
+	_, err = manager.GetIndex("saved")
+	assert.ErrorIs(t, err, errors.ErrIndexNotFound)
+}
+
+func TestManagerLoadsIndicesInParallel(t *testing.T) {
+	tmpDir := t.TempDir()
+	conf := &config.Config{Dir: tmpDir}
+	conf.Index.CheckpointOps = -1
+	conf.Index.CheckpointIntervalSeconds = -1
+	manager, err := NewIndexManager(conf)
+	assert.NoError(t, err)
+	for i := range 5 {
+		name := strconv.Itoa(i)
+		_, err = manager.CreateIndex(name, &IndexConfig{IndexType: FLATIndex, Dimension: 2, SpaceType: L2Space})
+		assert.NoError(t, err)
+		for j := range i + 1 {
+			assert.NoError(t, manager.AddVector(name, strconv.Itoa(j), []float32{float32(j), 1}))
+		}
+	}
+	assert.NoError(t, manager.Close())
+
+	// the WAL is replayed over the loaded index
+	manager, err = NewIndexManager(conf)
+	assert.NoError(t, err)
+	assert.NoError(t, manager.AddVector("4", "9", []float32{9, 1}))
+	crash(manager)
+
+	conf.Index.LoadThreads = 2
+	manager, err = NewIndexManager(conf)
+	assert.NoError(t, err)
+	defer manager.Close()
+	for i := range 5 {
+		count, err := manager.Count(strconv.Itoa(i))
+		assert.NoError(t, err)
+		if i == 4 {
+			assert.Equal(t, 6, count)
+		} else {
+			assert.Equal(t, i+1, count)
+		}
+	}
+}
+
+// blockingBuildIndex is a flat index whose Build waits until release is closed
+type blockingBuildIndex struct {
+	VectorIndex
+	building, release chan struct{}
+}
+
+func (b *blockingBuildIndex) Build(ids []string, vectors [][]float32) error {
+	close(b.building)
+	<-b.release
+	return b.VectorIndex.Build(ids, vectors)
+}
+
+func TestManagerReindex(t *testing.T) {
+	const blocking IndexType = "test_blocking_build"
+	building, release := make(chan struct{}), make(chan struct{})
+	assert.NoError(t, vectorindex.Register(blocking, func(config *IndexConfig) (VectorIndex, error) {
+		index, err := newFlatIndex(config)
+		if err != nil {
+			return nil, err
+		}
+		return &blockingBuildIndex{VectorIndex: index, building: building, release: release}, nil
+	}))
+
+	conf := &config.Config{Dir: t.TempDir()}
+	manager, err := NewIndexManager(conf)
+	assert.NoError(t, err)
+	var replicated []WALOpType
+	manager.SetWriteHook(func(entry *WALEntry) { replicated = append(replicated, entry.OpType) })
+
+	_, err = manager.CreateIndex("docs", &IndexConfig{IndexType: HNSWIndex, Dimension: 2, SpaceType: L2Space})
+	assert.NoError(t, err)
+	assert.NoError(t, manager.AddVectorBatch("docs", []string{"a", "b"}, [][]float32{{1, 0}, {0, 1}}))
+
+	iterate := func(current VectorIndex) ([]string, [][]float32, error) {
+		var ids []string
+		var vectors [][]float32
+		err := current.Iterate(func(id string, vector []float32) bool {
+			ids = append(ids, id)
+			vectors = append(vectors, slices.Clone(vector))
+			return true
+		})
+		return ids, vectors, err
+	}
+	type result struct {
+		count int
+		err   error
+	}
+	done := make(chan result)
+	go func() {
+		count, err := manager.Reindex("docs", &IndexConfig{IndexType: blocking, Dimension: 2, SpaceType: L2Space}, iterate)
+		done <- result{count, err}
+	}()
+	<-building
+
+	// the current index serves reads and writes during the build, the writes
+	// reach the new index
+	_, err = manager.Reindex("docs", &IndexConfig{IndexType: FLATIndex, Dimension: 2, SpaceType: L2Space}, iterate)
+	assert.ErrorIs(t, err, errors.ErrInvalidParameter)
+	assert.NoError(t, manager.AddVector("docs", "c", []float32{1, 1}))
+	assert.NoError(t, manager.DeleteVector("docs", "a"))
+	vector, err := manager.GetVector("docs", "b")
+	assert.NoError(t, err)
+	assert.Equal(t, []float32{0, 1}, vector)
+	replicated = nil
+	close(release)
+	res := <-done
+	assert.NoError(t, res.err)
+	assert.Equal(t, 2, res.count)
+	assert.Equal(t, []WALOpType{WALOpDeleteIndex, WALOpCreateIndex, WALOpBuildIndex, WALOpAddVector, WALOpDeleteVector}, replicated)
+
+	index, err := manager.GetIndex("docs")
+	assert.NoError(t, err)
+	assert.IsType(t, &blockingBuildIndex{}, index)
+	_, err = manager.GetVector("docs", "a")
+	assert.Error(t, err)
+	assert.NoError(t, manager.AddVector("docs", "d", []float32{2, 2}))
+	assert.NoError(t, manager.Close())
+
+	// the new index and its config survive a restart
+	manager, err = NewIndexManager(conf)
+	assert.NoError(t, err)
+	defer manager.Close()
+	index, err = manager.GetIndex("docs")
+	assert.NoError(t, err)
+	assert.IsType(t, &blockingBuildIndex{}, index)
+	for _, id := range []string{"b", "c", "d"} {
+		_, err := manager.GetVector("docs", id)
+		assert.NoError(t, err, id)
+	}
+	_, err = manager.Reindex("missing", &IndexConfig{IndexType: FLATIndex, Dimension: 2, SpaceType: L2Space}, iterate)
+	assert.ErrorIs(t, err, errors.ErrIndexNotFound)
+}
+
+func TestManagerTiersColdIndices(t *testing.T) {
+	tmpDir := t.TempDir()
+	conf := &config.Config{Dir: tmpDir}
+	conf.Index.CheckpointOps = -1
+	conf.Index.CheckpointIntervalSeconds = -1
+	conf.Tier.AfterHours = 24
+	coldTier, server := tiertest.NewTier(t, path.Join(tmpDir, "tiercache"), 1<<20)
+	conf.ColdTier = coldTier
+	manager, err := NewIndexManager(conf)
+	assert.NoError(t, err)
+	for _, name := range []string{"cold", "hot"} {
+		_, err = manager.CreateIndex(name, &IndexConfig{IndexType: FLATIndex, Dimension: 2, SpaceType: L2Space})
+		assert.NoError(t, err)
+		assert.NoError(t, manager.AddVector(name, "1", []float32{1, 0}))
+	}
+	assert.NoError(t, manager.Close())
+
+	coldPath := manager.indexFile("cold")
+	old := time.Now().Add(-48 * time.Hour)
+	assert.NoError(t, os.Chtimes(coldPath, old, old))
+	manager, err = NewIndexManager(conf)
+	assert.NoError(t, err)
+	files, _ := manager.tierColdIndices(time.Now())
+	assert.Equal(t, 1, files)
+	assert.Equal(t, []string{"index/" + path.Base(coldPath)}, server.Keys())
+	assert.NoFileExists(t, coldPath)
+	// loaded indices stay in memory, a second run has nothing to move
+	vector, err := manager.GetVector("cold", "1")
+	assert.NoError(t, err)
+	assert.Equal(t, []float32{1, 0}, vector)
+	files, _ = manager.tierColdIndices(time.Now())
+	assert.Equal(t, 0, files)
+	assert.NoError(t, manager.Close())
+
+	// the next start fetches the index back
+	manager, err = NewIndexManager(conf)
+	assert.NoError(t, err)
+	vector, err = manager.GetVector("cold", "1")
+	assert.NoError(t, err)
+	assert.Equal(t, []float32{1, 0}, vector)
+	assert.FileExists(t, coldPath)
+	// the fetched file is the save in the tier, it is removed without upload
+	files, _ = manager.tierColdIndices(time.Now())
+	assert.Equal(t, 1, files)
+
+	assert.NoError(t, manager.DeleteIndex("cold"))
+	assert.Empty(t, server.Keys())
+	assert.NoFileExists(t, coldPath+remoteSuffix)
+	assert.NoError(t, manager.Close())
+}
@@ -3,10 +3,13 @@ package index
 import (
 	"encoding/gob"
 	"errors"
+	"fmt"
 	pkgerrors "oasisdb/pkg/errors"
 	"oasisdb/pkg/logger"
 	"os"
 	"sort"
+	"sync"
+	"sync/atomic"
 )
 
 // ivfItem stores an individual vector and its document id.
@@ -24,15 +27,23 @@ type ivfItem struct {
 // platform.  The implementation is **NOT** production-grade but is sufficient
 // for functional tests and examples.
 type ivfIndex struct {
-	// Immutable after construction / training
+	// mu guards every field below. The Manager serializes writes but lets
+	// searches run alongside them, so searches take the read lock and adds,
+	// training and loading the write lock. Vectors are never modified once
+	// added, readers may keep them after unlocking
+	mu sync.RWMutex
+
 	config    *IndexConfig
 	nlist     int // number of clusters
 	nprobe    int // number of clusters to search
 	centroids [][]float32
 
-	// Mutable – protected by the Manager’s external locking guarantees; the
-	// surrounding code never accesses the same index from multiple goroutines
-	// concurrently, so we do not add extra locks here.
+	autoNprobe bool // nprobe adapts to each query, see autoNprobe
+
+	kmeansBatch   int // vectors per mini-batch k-means iteration, 0 trains on all
+	searchThreads int // goroutines scanning the lists of a query, 0 means GOMAXPROCS
+	buildThreads  int // goroutines training and assigning batches, 0 means GOMAXPROCS
+
 	lists [][]ivfItem
 
 	// pending vectors stored before training
@@ -44,12 +55,13 @@ type ivfIndex struct {
 
 // persistable snapshot with exported fields for gob
 type ivfSnapshot struct {
-	Config    *IndexConfig
-	Nlist     int
-	Nprobe    int
-	Centroids [][]float32
-	Lists     [][]ivfItem
-	Trained   bool
+	Config     *IndexConfig
+	Nlist      int
+	Nprobe     int
+	AutoNprobe bool
+	Centroids  [][]float32
+	Lists      [][]ivfItem
+	Trained    bool
 }
 
 // newIVFIndex creates an empty IVF index. Training **must** be performed by
@@ -78,11 +90,31 @@ func newIVFIndex(config *IndexConfig) (VectorIndex, error) {
 	if nprobe > nlist {
 		nprobe = nlist
 	}
+	kmeansBatch, err := kmeansBatchParam(config)
+	if err != nil {
+		return nil, err
+	}
+	searchThreads, err := threadsParam(config, "searchThreads")
+	if err != nil {
+		return nil, err
+	}
+	buildThreads, err := threadsParam(config, "buildThreads")
+	if err != nil {
+		return nil, err
+	}
+	auto, err := autoNprobeParam(config)
+	if err != nil {
+		return nil, err
+	}
 
 	idx := &ivfIndex{
 		config:         config,
 		nlist:          nlist,
 		nprobe:         nprobe,
+		autoNprobe:     auto,
+		kmeansBatch:    kmeansBatch,
+		searchThreads:  searchThreads,
+		buildThreads:   buildThreads,
 		centroids:      nil,
 		lists:          make([][]ivfItem, nlist),
 		pendingIDs:     nil,
@@ -97,6 +129,12 @@ func newIVFIndex(config *IndexConfig) (VectorIndex, error) {
 // the inverted lists.  After training, any vectors passed earlier via Add or
 // AddBatch are assigned to their closest centroid.
 func (ivf *ivfIndex) Train(vectors [][]float32) error {
+	ivf.mu.Lock()
+	defer ivf.mu.Unlock()
+	return ivf.train(vectors)
+}
+
+func (ivf *ivfIndex) train(vectors [][]float32) error {
 	if ivf.trained {
 		return nil // already trained
 	}
@@ -110,7 +148,7 @@ func (ivf *ivfIndex) Train(vectors [][]float32) error {
 		}
 	}
 
-	centroids := kMeans(vectors, ivf.nlist, ivf.config.Dimension, DEFAULT_MAX_KMEANS_ITER)
+	centroids := kMeans(vectors, ivf.nlist, ivf.config.Dimension, DEFAULT_MAX_KMEANS_ITER, ivf.kmeansBatch, ivf.buildThreads)
 	if len(centroids) != ivf.nlist {
 		return errors.New("failed to train k-means")
 	}
@@ -119,7 +157,7 @@ func (ivf *ivfIndex) Train(vectors [][]float32) error {
 
 	// Re-insert any pending vectors gathered before Train was called
 	if len(ivf.pendingIDs) > 0 {
-		_ = ivf.AddBatch(ivf.pendingIDs, ivf.pendingVectors)
+		_ = ivf.addBatch(ivf.pendingIDs, ivf.pendingVectors)
 		ivf.pendingIDs = nil
 		ivf.pendingVectors = nil
 	}
@@ -132,15 +170,23 @@ func (ivf *ivfIndex) Build(ids []string, vectors [][]float32) error {
 	if len(ids) != len(vectors) {
 		return pkgerrors.ErrMisMatchKeysAndValues
 	}
-	if err := ivf.Train(vectors); err != nil {
+	ivf.mu.Lock()
+	defer ivf.mu.Unlock()
+	if err := ivf.train(vectors); err != nil {
 		return err
 	}
-	return ivf.AddBatch(ids, vectors)
+	return ivf.addBatch(ids, vectors)
 }
 
 ///////////////////////// VectorIndex interface /////////////////////////
 
 func (ivf *ivfIndex) Add(id string, vector []float32) error {
+	ivf.mu.Lock()
+	defer ivf.mu.Unlock()
+	return ivf.add(id, vector)
+}
+
+func (ivf *ivfIndex) add(id string, vector []float32) error {
 	if len(vector) != ivf.config.Dimension {
 		return pkgerrors.ErrInvalidDimension
 	}
@@ -156,14 +202,39 @@ func (ivf *ivfIndex) Add(id string, vector []float32) error {
 }
 
 func (ivf *ivfIndex) AddBatch(ids []string, vectors [][]float32) error {
+	ivf.mu.Lock()
+	defer ivf.mu.Unlock()
+	return ivf.addBatch(ids, vectors)
+}
+
+func (ivf *ivfIndex) addBatch(ids []string, vectors [][]float32) error {
 	if len(ids) != len(vectors) {
 		return pkgerrors.ErrMisMatchKeysAndValues
 	}
-	for i, id := range ids {
-		if err := ivf.Add(id, vectors[i]); err != nil {
-			return err
+	if !ivf.trained {
+		for i, id := range ids {
+			if err := ivf.add(id, vectors[i]); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+	for _, vector := range vectors {
+		if len(vector) != ivf.config.Dimension {
+			return pkgerrors.ErrInvalidDimension
 		}
 	}
+	// finding the closest centroid dominates large batches, it runs in parallel
+	assignments := make([]int, len(vectors))
+	parallelFor(len(vectors), threadCount(ivf.buildThreads), func(start, end int) {
+		for i := start; i < end; i++ {
+			assignments[i] = ivf.closestCentroid(vectors[i])
+		}
+	})
+	for i, id := range ids {
+		c := assignments[i]
+		ivf.lists[c] = append(ivf.lists[c], ivfItem{ID: id, Vector: vectors[i]})
+	}
 	return nil
 }
 
@@ -173,6 +244,40 @@ func (ivf *ivfIndex) Delete(id string) error {
 }
 
 func (ivf *ivfIndex) Search(vector []float32, k int) (*SearchResult, error) {
+	ivf.mu.RLock()
+	defer ivf.mu.RUnlock()
+	return ivf.search(vector, k, ivf.nprobe, ivf.autoNprobe)
+}
+
+// SearchWithParams probes the nprobe lists of params for this query only
+func (ivf *ivfIndex) SearchWithParams(vector []float32, k int, params map[string]any) (*SearchResult, error) {
+	ivf.mu.RLock()
+	defer ivf.mu.RUnlock()
+	nprobe, auto := ivf.nprobe, ivf.autoNprobe
+	for key, val := range params {
+		switch key {
+		case "nprobe":
+			v, ok := intParam(val)
+			if !ok || v <= 0 || v > ivf.nlist {
+				return nil, fmt.Errorf("%w: nprobe must be an integer between 1 and %d", pkgerrors.ErrInvalidParameter, ivf.nlist)
+			}
+			nprobe = v
+		case "auto_nprobe":
+			v, ok := val.(bool)
+			if !ok {
+				return nil, fmt.Errorf("%w: auto_nprobe must be a boolean", pkgerrors.ErrInvalidParameter)
+			}
+			auto = v
+		default:
+			return nil, fmt.Errorf("%w: unknown ivf search parameter %q", pkgerrors.ErrInvalidParameter, key)
+		}
+	}
+	return ivf.search(vector, k, nprobe, auto)
+}
+
+// search probes the nprobe lists nearest to vector, with auto the number of
+// lists is picked by autoNprobe around nprobe
+func (ivf *ivfIndex) search(vector []float32, k, nprobe int, auto bool) (*SearchResult, error) {
 	if !ivf.trained {
 		return nil, errors.New("index not trained")
 	}
@@ -193,42 +298,68 @@ func (ivf *ivfIndex) Search(vector []float32, k int) (*SearchResult, error) {
 		cds[i] = centroidDist{idx: i, d: distance(vector, c, ivf.config.SpaceType)}
 	}
 	sort.Slice(cds, func(i, j int) bool { return cds[i].d < cds[j].d })
-
-	// 2. gather candidates from the selected lists
-	type cand struct {
-		id string
-		d  float32
-	}
-	candidates := make([]cand, 0, k*ivf.nprobe)
-	for i := 0; i < ivf.nprobe && i < len(cds); i++ {
-		listIdx := cds[i].idx
-		for _, it := range ivf.lists[listIdx] {
-			d := distance(vector, it.Vector, ivf.config.SpaceType)
-			candidates = append(candidates, cand{id: it.ID, d: d})
+	if auto {
+		dists := make([]float32, len(cds))
+		for i, cd := range cds {
+			dists[i] = cd.d
+		}
+		nprobe = autoNprobe(dists, nprobe)
+	}
+
+	// 2. scan the selected lists, workers take the next unscanned list and
+	// keep their own top-k
+	probed := make([]int, 0, nprobe)
+	size := 0
+	for i := 0; i < nprobe && i < len(cds); i++ {
+		probed = append(probed, cds[i].idx)
+		size += len(ivf.lists[cds[i].idx])
+	}
+	var next atomic.Int64
+	scan := func(top *topK) {
+		for i := int(next.Add(1)) - 1; i < len(probed); i = int(next.Add(1)) - 1 {
+			for _, it := range ivf.lists[probed[i]] {
+				top.push(it.ID, distance(vector, it.Vector, ivf.config.SpaceType))
+			}
 		}
 	}
-
-	// 3. select top-k from candidates
-	if len(candidates) == 0 {
-		return &SearchResult{}, nil
-	}
-	sort.Slice(candidates, func(i, j int) bool { return candidates[i].d < candidates[j].d })
-	if len(candidates) > k {
-		candidates = candidates[:k]
+	workers := 1
+	if size >= IVF_PARALLEL_SCAN_MIN {
+		workers = min(ivf.workers(), len(probed))
 	}
+	heaps := make([]*topK, workers)
+	var wg sync.WaitGroup
+	for w := range heaps {
+		heaps[w] = newTopK(k)
+		if w == 0 {
+			continue
+		}
+		wg.Add(1)
+		go func(top *topK) {
+			defer wg.Done()
+			scan(top)
+		}(heaps[w])
+	}
+	scan(heaps[0])
+	wg.Wait()
+
+	// 3. merge the partial top-k
+	for _, top := range heaps[1:] {
+		heaps[0].merge(top)
+	}
+	result := heaps[0].result()
+	logger.Debug("Search result", "ids", result.IDs, "dists", result.Distances)
+	return result, nil
+}
 
-	ids := make([]string, len(candidates))
-	dists := make([]float32, len(candidates))
-	for i, c := range candidates {
-		ids[i] = c.id
-		dists[i] = c.d
-	}
-	logger.Debug("Search result", "ids", ids, "dists", dists)
-	return &SearchResult{IDs: ids, Distances: dists}, nil
+// workers returns the goroutines scanning the lists of a query
+func (ivf *ivfIndex) workers() int {
+	return threadCount(ivf.searchThreads)
 }
 
 // GetVector get vector by id
 func (ivf *ivfIndex) GetVector(id string) ([]float32, error) {
+	ivf.mu.RLock()
+	defer ivf.mu.RUnlock()
 	if !ivf.trained {
 		for i, pendingID := range ivf.pendingIDs {
 			if pendingID == id {
@@ -249,6 +380,64 @@ func (ivf *ivfIndex) GetVector(id string) ([]float32, error) {
 	return nil, pkgerrors.ErrDocumentNotFound
 }
 
+func (ivf *ivfIndex) Count() int {
+	ivf.mu.RLock()
+	defer ivf.mu.RUnlock()
+	return ivf.count()
+}
+
+func (ivf *ivfIndex) count() int {
+	count := len(ivf.pendingIDs)
+	for _, list := range ivf.lists {
+		count += len(list)
+	}
+	return count
+}
+
+func (ivf *ivfIndex) Stats() IndexStats {
+	ivf.mu.RLock()
+	defer ivf.mu.RUnlock()
+	sizes := make([]int, len(ivf.lists))
+	for i, list := range ivf.lists {
+		sizes[i] = len(list)
+	}
+	occupancy, imbalance := listBalance(sizes)
+	return IndexStats{
+		Type:      IVFFLATIndex,
+		Dimension: ivf.config.Dimension,
+		Count:     ivf.count(),
+		Params: map[string]any{
+			"nlist":           ivf.nlist,
+			"nprobe":          ivf.nprobe,
+			"auto_nprobe":     ivf.autoNprobe,
+			"trained":         ivf.trained,
+			"pending":         len(ivf.pendingIDs),
+			"occupancy":       occupancy,
+			"imbalanceFactor": imbalance,
+		},
+	}
+}
+
+// Iterate visits the pending vectors of an untrained index and the inverted
+// lists of a trained one, fn must not call back into the index
+func (ivf *ivfIndex) Iterate(fn func(id string, vector []float32) bool) error {
+	ivf.mu.RLock()
+	defer ivf.mu.RUnlock()
+	for i, id := range ivf.pendingIDs {
+		if !fn(id, ivf.pendingVectors[i]) {
+			return nil
+		}
+	}
+	for _, list := range ivf.lists {
+		for _, item := range list {
+			if !fn(item.ID, item.Vector) {
+				return nil
+			}
+		}
+	}
+	return nil
+}
+
 func (ivf *ivfIndex) Load(filePath string) error {
 	f, err := os.Open(filePath)
 	if err != nil {
@@ -260,10 +449,13 @@ func (ivf *ivfIndex) Load(filePath string) error {
 	if err := dec.Decode(&snap); err != nil {
 		return err
 	}
+	ivf.mu.Lock()
+	defer ivf.mu.Unlock()
 	// restore fields
 	ivf.config = snap.Config
 	ivf.nlist = snap.Nlist
 	ivf.nprobe = snap.Nprobe
+	ivf.autoNprobe = snap.AutoNprobe
 	ivf.centroids = snap.Centroids
 	ivf.lists = snap.Lists
 	ivf.trained = snap.Trained
@@ -279,14 +471,17 @@ func (ivf *ivfIndex) Save(filePath string) error {
 		return err
 	}
 	defer f.Close()
+	ivf.mu.RLock()
+	defer ivf.mu.RUnlock()
 	enc := gob.NewEncoder(f)
 	snap := ivfSnapshot{
-		Config:    ivf.config,
-		Nlist:     ivf.nlist,
-		Nprobe:    ivf.nprobe,
-		Centroids: ivf.centroids,
-		Lists:     ivf.lists,
-		Trained:   ivf.trained,
+		Config:     ivf.config,
+		Nlist:      ivf.nlist,
+		Nprobe:     ivf.nprobe,
+		AutoNprobe: ivf.autoNprobe,
+		Centroids:  ivf.centroids,
+		Lists:      ivf.lists,
+		Trained:    ivf.trained,
 	}
 	logger.Debug("Saving index to file", "file", filePath)
 	return enc.Encode(&snap)
@@ -297,6 +492,47 @@ func (ivf *ivfIndex) Close() error {
 	return nil
 }
 
+// ExactSearch scans every inverted list, including vectors pending training
+func (ivf *ivfIndex) ExactSearch(vector []float32, k int) (*SearchResult, error) {
+	ivf.mu.RLock()
+	defer ivf.mu.RUnlock()
+	if len(vector) != ivf.config.Dimension {
+		return nil, pkgerrors.ErrInvalidDimension
+	}
+	ids := append([]string(nil), ivf.pendingIDs...)
+	vectors := append([][]float32(nil), ivf.pendingVectors...)
+	for _, list := range ivf.lists {
+		for _, item := range list {
+			ids = append(ids, item.ID)
+			vectors = append(vectors, item.Vector)
+		}
+	}
+	return exactTopK(vector, k, ivf.config.SpaceType, ids, vectors), nil
+}
+
+// ListClusters returns the IVF centroids with their list sizes
+func (ivf *ivfIndex) ListClusters(sampleSize int) ([]Cluster, error) {
+	ivf.mu.RLock()
+	defer ivf.mu.RUnlock()
+	if !ivf.trained {
+		return nil, errors.New("index not trained")
+	}
+	clusters := make([]Cluster, len(ivf.centroids))
+	for i, centroid := range ivf.centroids {
+		ids := make([]string, 0, sampleSize)
+		for j := 0; j < len(ivf.lists[i]) && j < sampleSize; j++ {
+			ids = append(ids, ivf.lists[i][j].ID)
+		}
+		clusters[i] = Cluster{
+			ID:        i,
+			Centroid:  append([]float32(nil), centroid...),
+			Count:     len(ivf.lists[i]),
+			SampleIDs: ids,
+		}
+	}
+	return clusters, nil
+}
+
 ///////////////////////// helpers /////////////////////////
 
 // closestCentroid returns the index of the centroid nearest to the provided
@@ -314,72 +550,12 @@ func (ivf *ivfIndex) closestCentroid(v []float32) int {
 	return best
 }
 
-// kMeans performs a very small-scale Lloyd-style k-means clustering. The
-// implementation is intentionally simple and stops after a fixed number of
-// iterations or when centroids stop moving.  It **does not** implement any
-// advanced initialisation (like k-means++); instead it picks the first k
-// vectors as initial centroids which is good enough for a demo.
-func kMeans(data [][]float32, k, dim, maxIter int) [][]float32 {
-	if len(data) < k {
-		k = len(data)
-	}
-	centroids := make([][]float32, k)
-	for i := 0; i < k; i++ {
-		centroids[i] = append([]float32(nil), data[i]...)
-	}
-
-	assignments := make([]int, len(data))
-
-	for iter := 0; iter < maxIter; iter++ {
-		changed := false
-		// assignment step
-		for i, v := range data {
-			best := 0
-			bestDist := distance(v, centroids[0], L2Space)
-			for c := 1; c < k; c++ {
-				d := distance(v, centroids[c], L2Space)
-				if d < bestDist {
-					bestDist = d
-					best = c
-				}
-			}
-			if assignments[i] != best {
-				changed = true
-				assignments[i] = best
-			}
-		}
-		// update step
-		counts := make([]int, k)
-		sums := make([][]float32, k)
-		for i := 0; i < k; i++ {
-			sums[i] = make([]float32, dim)
-		}
-		for i, v := range data {
-			c := assignments[i]
-			counts[c]++
-			for d := 0; d < dim; d++ {
-				sums[c][d] += v[d]
-			}
-		}
-		for c := 0; c < k; c++ {
-			if counts[c] == 0 {
-				continue // empty cluster – keep old centroid
-			}
-			for d := 0; d < dim; d++ {
-				centroids[c][d] = sums[c][d] / float32(counts[c])
-			}
-		}
-		if !changed {
-			break
-		}
-	}
-	return centroids
-}
-
 func (ivf *ivfIndex) SetParams(params map[string]any) error {
 	if len(params) == 0 {
 		return pkgerrors.ErrEmptyParameter
 	}
+	ivf.mu.Lock()
+	defer ivf.mu.Unlock()
 
 	for key, val := range params {
 		switch key {
@@ -393,9 +569,15 @@ func (ivf *ivfIndex) SetParams(params map[string]any) error {
 			default:
 				return pkgerrors.ErrInvalidParameter
 			}
-			if err := ivf.SetNProbe(ival); err != nil {
+			if err := ivf.setNProbe(ival); err != nil {
 				return err
 			}
+		case "auto_nprobe":
+			auto, ok := val.(bool)
+			if !ok {
+				return pkgerrors.ErrInvalidParameter
+			}
+			ivf.autoNprobe = auto
 		default:
 			return pkgerrors.ErrInvalidParameter
 		}
@@ -405,6 +587,12 @@ func (ivf *ivfIndex) SetParams(params map[string]any) error {
 }
 
 func (ivf *ivfIndex) SetNProbe(nprobe int) error {
+	ivf.mu.Lock()
+	defer ivf.mu.Unlock()
+	return ivf.setNProbe(nprobe)
+}
+
+func (ivf *ivfIndex) setNProbe(nprobe int) error {
 	if nprobe <= 0 || nprobe > ivf.nlist {
 		return pkgerrors.ErrInvalidParameter
 	}
@@ -0,0 +1,77 @@
+package index
+
+import (
+	"fmt"
+	"math"
+
+	pkgerrors "oasisdb/pkg/errors"
+)
+
+// autoNprobeParam reads the auto_nprobe parameter of an IVF index, false
+// when unset
+func autoNprobeParam(config *IndexConfig) (bool, error) {
+	val, ok := config.Parameters["auto_nprobe"]
+	if !ok {
+		return false, nil
+	}
+	auto, ok := val.(bool)
+	if !ok {
+		return false, fmt.Errorf("%w: auto_nprobe must be a boolean", pkgerrors.ErrInvalidParameter)
+	}
+	return auto, nil
+}
+
+// autoNprobe picks how many lists a query probes from its distances to the
+// centroids in ascending order. It probes between half and twice nprobe
+// lists: the nearest lists up to half of nprobe always, then the next ones
+// whose centroid is within IVF_AUTO_NPROBE_GAP of the span of distances to
+// the 2*nprobe nearest centroids. A query close to one centroid and far from
+// the others probes few lists, one between many equally close centroids,
+// where its neighbors are likely spread over them, probes more
+func autoNprobe(dists []float32, nprobe int) int {
+	maxProbe := min(len(dists), 2*nprobe)
+	n := min(max(1, (nprobe+1)/2), maxProbe)
+	span := dists[maxProbe-1] - dists[0]
+	if span <= 0 {
+		// every centroid is as close, any of them may hold the neighbors
+		return maxProbe
+	}
+	for n < maxProbe && dists[n]-dists[0] <= IVF_AUTO_NPROBE_GAP*span {
+		n++
+	}
+	return n
+}
+
+// listBalance summarizes the sizes of the inverted lists of an IVF index for
+// its stats. The imbalance factor is nlist times the sum of the squared list
+// sizes over the squared vector count, the cost of probing a list relative to
+// perfectly balanced lists: 1 when every list holds as many vectors, nlist
+// when a single list holds all of them. Retrain with more data or a full
+// k-means (no kmeansBatch) when it grows well above 1
+func listBalance(sizes []int) (occupancy map[string]any, imbalance float64) {
+	if len(sizes) == 0 {
+		return map[string]any{}, 0
+	}
+	total, sumSquares := 0, 0.0
+	lowest, highest, empty := sizes[0], sizes[0], 0
+	for _, size := range sizes {
+		total += size
+		sumSquares += float64(size) * float64(size)
+		lowest, highest = min(lowest, size), max(highest, size)
+		if size == 0 {
+			empty++
+		}
+	}
+	mean := float64(total) / float64(len(sizes))
+	stddev := math.Sqrt(max(sumSquares/float64(len(sizes))-mean*mean, 0))
+	if total > 0 {
+		imbalance = float64(len(sizes)) * sumSquares / (float64(total) * float64(total))
+	}
+	return map[string]any{
+		"min":    lowest,
+		"max":    highest,
+		"mean":   mean,
+		"stddev": stddev,
+		"empty":  empty,
+	}, imbalance
+}
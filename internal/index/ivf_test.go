@@ -1,8 +1,15 @@
 package index
 
 import (
+	"errors"
+	"fmt"
+	"math/rand"
 	"path/filepath"
+	"reflect"
+	"sync"
 	"testing"
+
+	pkgerrors "oasisdb/pkg/errors"
 )
 
 func generateVectors(n, dim int) (ids []string, vecs [][]float32) {
@@ -128,3 +135,357 @@ func TestIVFIndex_AddAfterTrain(t *testing.T) {
 		t.Fatalf("did not find added vector, got %v", res.IDs)
 	}
 }
+
+func TestIVFIndex_ListClusters(t *testing.T) {
+	dim := 4
+	ids, vectors := generateVectors(20, dim)
+	cfg := &IndexConfig{
+		SpaceType: L2Space,
+		IndexType: IVFFLATIndex,
+		Dimension: dim,
+		Parameters: map[string]interface{}{
+			"nlist":  float64(4),
+			"nprobe": float64(1),
+		},
+	}
+	vIdx, _ := newIVFIndex(cfg)
+	idx := vIdx.(*ivfIndex)
+	if _, err := idx.ListClusters(2); err == nil {
+		t.Fatalf("expected error for untrained index")
+	}
+	if err := idx.Build(ids, vectors); err != nil {
+		t.Fatalf("build failed: %v", err)
+	}
+
+	clusters, err := idx.ListClusters(2)
+	if err != nil {
+		t.Fatalf("list clusters failed: %v", err)
+	}
+	if len(clusters) != 4 {
+		t.Fatalf("expected 4 clusters, got %d", len(clusters))
+	}
+	total := 0
+	for _, c := range clusters {
+		if len(c.Centroid) != dim {
+			t.Fatalf("unexpected centroid dimension %d", len(c.Centroid))
+		}
+		if len(c.SampleIDs) > 2 || len(c.SampleIDs) > c.Count {
+			t.Fatalf("unexpected sample size %d for count %d", len(c.SampleIDs), c.Count)
+		}
+		total += c.Count
+	}
+	if total != len(ids) {
+		t.Fatalf("expected %d vectors across clusters, got %d", len(ids), total)
+	}
+}
+
+func TestIVFIndex_ExactSearch(t *testing.T) {
+	dim := 4
+	ids, vectors := generateVectors(20, dim)
+	cfg := &IndexConfig{
+		SpaceType: L2Space,
+		IndexType: IVFFLATIndex,
+		Dimension: dim,
+		Parameters: map[string]interface{}{
+			"nlist":  float64(4),
+			"nprobe": float64(1),
+		},
+	}
+	vIdx, _ := newIVFIndex(cfg)
+	idx := vIdx.(*ivfIndex)
+	if err := idx.Build(ids, vectors); err != nil {
+		t.Fatalf("build failed: %v", err)
+	}
+
+	res, err := idx.ExactSearch(vectors[10], 3)
+	if err != nil {
+		t.Fatalf("exact search failed: %v", err)
+	}
+	if len(res.IDs) != 3 || res.IDs[0] != ids[10] {
+		t.Fatalf("unexpected exact result: %+v", res.IDs)
+	}
+	for i := 1; i < len(res.Distances); i++ {
+		if res.Distances[i] < res.Distances[i-1] {
+			t.Fatalf("distances not sorted: %+v", res.Distances)
+		}
+	}
+}
+
+func TestIVFIndex_SearchWithParams(t *testing.T) {
+	dim := 4
+	ids, vectors := generateVectors(20, dim)
+	cfg := &IndexConfig{
+		SpaceType: L2Space,
+		IndexType: IVFFLATIndex,
+		Dimension: dim,
+		Parameters: map[string]interface{}{
+			"nlist":  float64(4),
+			"nprobe": float64(1),
+		},
+	}
+	vIdx, _ := newIVFIndex(cfg)
+	idx := vIdx.(*ivfIndex)
+	if err := idx.Build(ids, vectors); err != nil {
+		t.Fatalf("build failed: %v", err)
+	}
+
+	// probing every list finds all vectors
+	res, err := idx.SearchWithParams(vectors[0], len(ids), map[string]any{"nprobe": float64(4)})
+	if err != nil {
+		t.Fatalf("search with params failed: %v", err)
+	}
+	if len(res.IDs) != len(ids) {
+		t.Fatalf("expected %d results with nprobe 4, got %d", len(ids), len(res.IDs))
+	}
+
+	// the override doesn't change the nprobe of later searches
+	res, err = idx.Search(vectors[0], len(ids))
+	if err != nil {
+		t.Fatalf("search failed: %v", err)
+	}
+	if len(res.IDs) == len(ids) || idx.nprobe != 1 {
+		t.Fatalf("nprobe override leaked into the index: nprobe %d, %d results", idx.nprobe, len(res.IDs))
+	}
+
+	for _, params := range []map[string]any{
+		{"nprobe": float64(5)},
+		{"nprobe": float64(0)},
+		{"nprobe": "2"},
+		{"efsearch": float64(64)},
+	} {
+		if _, err := idx.SearchWithParams(vectors[0], 3, params); !errors.Is(err, pkgerrors.ErrInvalidParameter) {
+			t.Fatalf("expected invalid parameter error for %v, got %v", params, err)
+		}
+	}
+}
+
+// run with -race: searches and reads run alongside adds and parameter changes
+func TestIVFIndex_ConcurrentSearchAndAdd(t *testing.T) {
+	dim := 4
+	ids, vectors := generateVectors(20, dim)
+	cfg := &IndexConfig{
+		SpaceType: L2Space,
+		IndexType: IVFFLATIndex,
+		Dimension: dim,
+		Parameters: map[string]interface{}{
+			"nlist":  float64(4),
+			"nprobe": float64(2),
+		},
+	}
+	vIdx, _ := newIVFIndex(cfg)
+	idx := vIdx.(*ivfIndex)
+	if err := idx.Build(ids, vectors); err != nil {
+		t.Fatalf("build failed: %v", err)
+	}
+
+	const writers, adds = 4, 200
+	var wg sync.WaitGroup
+	for w := 0; w < writers; w++ {
+		wg.Add(1)
+		go func(w int) {
+			defer wg.Done()
+			for i := 0; i < adds; i++ {
+				v := make([]float32, dim)
+				v[0] = float32(i % 20)
+				if err := idx.AddBatch([]string{fmt.Sprintf("w%d-%d", w, i)}, [][]float32{v}); err != nil {
+					t.Errorf("add failed: %v", err)
+					return
+				}
+				if i%50 == 0 {
+					if err := idx.SetParams(map[string]any{"nprobe": float64(1 + i%4)}); err != nil {
+						t.Errorf("set params failed: %v", err)
+						return
+					}
+				}
+			}
+		}(w)
+	}
+	for r := 0; r < 4; r++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := 0; i < adds; i++ {
+				if _, err := idx.Search(vectors[i%20], 5); err != nil {
+					t.Errorf("search failed: %v", err)
+					return
+				}
+				if _, err := idx.SearchWithParams(vectors[i%20], 5, map[string]any{"nprobe": float64(4)}); err != nil {
+					t.Errorf("search with params failed: %v", err)
+					return
+				}
+				if _, err := idx.ExactSearch(vectors[i%20], 5); err != nil {
+					t.Errorf("exact search failed: %v", err)
+					return
+				}
+				idx.Stats()
+				_ = idx.Iterate(func(string, []float32) bool { return true })
+			}
+		}()
+	}
+	wg.Wait()
+
+	if got, want := idx.Count(), len(ids)+writers*adds; got != want {
+		t.Fatalf("expected %d vectors, got %d", want, got)
+	}
+}
+
+func TestIVFIndex_ParallelSearch(t *testing.T) {
+	dim := 8
+	vectors := randomVectors(rand.New(rand.NewSource(1)), 3*IVF_PARALLEL_SCAN_MIN, dim)
+	ids := make([]string, len(vectors))
+	for i := range ids {
+		ids[i] = fmt.Sprint(i)
+	}
+	results := map[int]*SearchResult{}
+	for _, threads := range []int{1, 4} {
+		cfg := &IndexConfig{
+			SpaceType: L2Space,
+			IndexType: IVFFLATIndex,
+			Dimension: dim,
+			Parameters: map[string]interface{}{
+				"nlist":         float64(8),
+				"nprobe":        float64(8),
+				"kmeansBatch":   float64(512),
+				"searchThreads": float64(threads),
+				"buildThreads":  float64(threads),
+			},
+		}
+		vIdx, err := newIVFIndex(cfg)
+		if err != nil {
+			t.Fatalf("failed to create IVF index: %v", err)
+		}
+		if err := vIdx.Build(ids, vectors); err != nil {
+			t.Fatalf("build failed: %v", err)
+		}
+		if results[threads], err = vIdx.Search(vectors[42], 10); err != nil {
+			t.Fatalf("search failed: %v", err)
+		}
+	}
+
+	// probing every list with any number of workers is exact
+	exact := exactTopK(vectors[42], 10, L2Space, ids, vectors)
+	for threads, result := range results {
+		if !reflect.DeepEqual(result.IDs, exact.IDs) {
+			t.Fatalf("%d threads: got %v, want %v", threads, result.IDs, exact.IDs)
+		}
+	}
+
+	for _, param := range []string{"searchThreads", "buildThreads"} {
+		cfg := &IndexConfig{IndexType: IVFFLATIndex, Dimension: dim, Parameters: map[string]any{param: float64(-1)}}
+		if _, err := newIVFIndex(cfg); !errors.Is(err, pkgerrors.ErrInvalidParameter) {
+			t.Fatalf("%s: expected invalid parameter error, got %v", param, err)
+		}
+	}
+}
+
+func TestAutoNprobe(t *testing.T) {
+	cases := []struct {
+		dists  []float32
+		nprobe int
+		want   int
+	}{
+		// one centroid far closer than the others probes the minimum
+		{[]float32{1, 10, 10.5, 11, 11.5, 12, 12.5, 13}, 4, 2},
+		// equally spaced centroids probe about nprobe lists
+		{[]float32{1, 2, 3, 4, 5, 6, 7, 8}, 4, 4},
+		// many centroids about as close probe up to twice nprobe
+		{[]float32{1, 1.1, 1.2, 1.3, 1.4, 1.5, 1.6, 8}, 4, 7},
+		{[]float32{2, 2, 2, 2, 2, 2, 2, 2}, 4, 8},
+		// capped by nlist
+		{[]float32{1, 1, 1}, 2, 3},
+		{[]float32{1, 5}, 1, 1},
+	}
+	for _, c := range cases {
+		if got := autoNprobe(c.dists, c.nprobe); got != c.want {
+			t.Fatalf("autoNprobe(%v, %d) = %d, want %d", c.dists, c.nprobe, got, c.want)
+		}
+	}
+}
+
+func TestListBalance(t *testing.T) {
+	occupancy, imbalance := listBalance([]int{5, 5, 5, 5})
+	if imbalance != 1 || occupancy["stddev"] != 0.0 || occupancy["empty"] != 0 {
+		t.Fatalf("balanced lists: occupancy %v, imbalance %v", occupancy, imbalance)
+	}
+	occupancy, imbalance = listBalance([]int{20, 0, 0, 0})
+	if imbalance != 4 || occupancy["max"] != 20 || occupancy["min"] != 0 || occupancy["empty"] != 3 || occupancy["mean"] != 5.0 {
+		t.Fatalf("one full list: occupancy %v, imbalance %v", occupancy, imbalance)
+	}
+	if _, imbalance = listBalance([]int{0, 0}); imbalance != 0 {
+		t.Fatalf("empty lists: imbalance %v", imbalance)
+	}
+}
+
+func TestIVFIndex_AutoNprobe(t *testing.T) {
+	dim := 8
+	vectors := randomVectors(rand.New(rand.NewSource(1)), 2000, dim)
+	ids := make([]string, len(vectors))
+	for i := range ids {
+		ids[i] = fmt.Sprint(i)
+	}
+	for _, indexType := range []IndexType{IVFFLATIndex, IVFPQIndex} {
+		cfg := &IndexConfig{
+			SpaceType: L2Space,
+			IndexType: indexType,
+			Dimension: dim,
+			Parameters: map[string]any{
+				"nlist":       float64(16),
+				"nprobe":      float64(4),
+				"auto_nprobe": true,
+			},
+		}
+		vIdx, err := newIndex(cfg)
+		if err != nil {
+			t.Fatalf("%s: failed to create index: %v", indexType, err)
+		}
+		if err := vIdx.Build(ids, vectors); err != nil {
+			t.Fatalf("%s: build failed: %v", indexType, err)
+		}
+		res, err := vIdx.Search(vectors[7], 5)
+		if err != nil || len(res.IDs) == 0 || res.IDs[0] != "7" {
+			t.Fatalf("%s: search found %v, %v", indexType, res, err)
+		}
+
+		stats := vIdx.Stats()
+		if stats.Params["auto_nprobe"] != true {
+			t.Fatalf("%s: stats don't report auto_nprobe: %v", indexType, stats.Params)
+		}
+		imbalance, ok := stats.Params["imbalanceFactor"].(float64)
+		if !ok || imbalance < 1 || imbalance > 16 {
+			t.Fatalf("%s: imbalance factor %v", indexType, stats.Params["imbalanceFactor"])
+		}
+		if occupancy := stats.Params["occupancy"].(map[string]any); occupancy["mean"] != 2000.0/16 {
+			t.Fatalf("%s: occupancy %v", indexType, occupancy)
+		}
+
+		// the mode survives a checkpoint and can be switched off
+		file := filepath.Join(t.TempDir(), "index.idx")
+		if err := vIdx.Save(file); err != nil {
+			t.Fatalf("%s: save failed: %v", indexType, err)
+		}
+		loaded, _ := newIndex(&IndexConfig{SpaceType: L2Space, IndexType: indexType, Dimension: dim})
+		if err := loaded.Load(file); err != nil {
+			t.Fatalf("%s: load failed: %v", indexType, err)
+		}
+		if loaded.Stats().Params["auto_nprobe"] != true {
+			t.Fatalf("%s: auto_nprobe lost by the checkpoint", indexType)
+		}
+		if err := loaded.SetParams(map[string]any{"auto_nprobe": false}); err != nil {
+			t.Fatalf("%s: set params failed: %v", indexType, err)
+		}
+		if loaded.Stats().Params["auto_nprobe"] != false {
+			t.Fatalf("%s: auto_nprobe not switched off", indexType)
+		}
+
+		if _, err := SearchWithParams(vIdx, vectors[0], 3, map[string]any{"auto_nprobe": "yes"}); !errors.Is(err, pkgerrors.ErrInvalidParameter) {
+			t.Fatalf("%s: expected invalid parameter error, got %v", indexType, err)
+		}
+		if _, err := SearchWithParams(vIdx, vectors[0], 3, map[string]any{"auto_nprobe": false}); err != nil {
+			t.Fatalf("%s: search with params failed: %v", indexType, err)
+		}
+		cfg.Parameters["auto_nprobe"] = float64(1)
+		if _, err := newIndex(cfg); !errors.Is(err, pkgerrors.ErrInvalidParameter) {
+			t.Fatalf("%s: expected invalid parameter error, got %v", indexType, err)
+		}
+	}
+}
@@ -3,10 +3,12 @@ package index
 import (
 	"encoding/gob"
 	"errors"
+	"fmt"
 	pkgerrors "oasisdb/pkg/errors"
 	"oasisdb/pkg/logger"
 	"os"
 	"sort"
+	"sync"
 )
 
 // ivfpqItem stores a quantized vector, its original vector and document id.
@@ -21,6 +23,10 @@ type ivfpqItem struct {
 // Product Quantization, significantly reducing memory usage and speeding up
 // distance computations at the cost of slightly lower recall.
 type ivfpqIndex struct {
+	// mu guards every field below, searches take the read lock and writes,
+	// training and loading the write lock, see ivfIndex.mu
+	mu sync.RWMutex
+
 	config    *IndexConfig
 	nlist     int
 	nprobe    int
@@ -30,6 +36,11 @@ type ivfpqIndex struct {
 	subDim    int // dimension per subspace = dim / m
 	centroids [][]float32
 
+	autoNprobe bool // nprobe adapts to each query, see autoNprobe
+
+	kmeansBatch  int // vectors per mini-batch k-means iteration, 0 trains on all
+	buildThreads int // goroutines training the quantizers, 0 means GOMAXPROCS
+
 	// pqCodebooks[j][c][d] : subspace j, code c, dimension d (d < subDim)
 	pqCodebooks [][][]float32
 
@@ -46,6 +57,7 @@ type ivfpqSnapshot struct {
 	Config      *IndexConfig
 	Nlist       int
 	Nprobe      int
+	AutoNprobe  bool
 	M           int
 	Nbits       int
 	Dim         int
@@ -104,13 +116,28 @@ func newIVFPQIndex(config *IndexConfig) (VectorIndex, error) {
 	if nbits != 8 {
 		return nil, errors.New("only nbits=8 is supported")
 	}
+	kmeansBatch, err := kmeansBatchParam(config)
+	if err != nil {
+		return nil, err
+	}
+	buildThreads, err := threadsParam(config, "buildThreads")
+	if err != nil {
+		return nil, err
+	}
+	auto, err := autoNprobeParam(config)
+	if err != nil {
+		return nil, err
+	}
 
 	idx := &ivfpqIndex{
 		config:         config,
 		nlist:          nlist,
 		nprobe:         nprobe,
+		autoNprobe:     auto,
 		m:              m,
 		nbits:          nbits,
+		kmeansBatch:    kmeansBatch,
+		buildThreads:   buildThreads,
 		dim:            config.Dimension,
 		subDim:         config.Dimension / m,
 		centroids:      nil,
@@ -128,6 +155,12 @@ func newIVFPQIndex(config *IndexConfig) (VectorIndex, error) {
 // Train performs k-means clustering for coarse centroids and then trains
 // Product Quantization codebooks on the residual vectors.
 func (idx *ivfpqIndex) Train(vectors [][]float32) error {
+	idx.mu.Lock()
+	defer idx.mu.Unlock()
+	return idx.train(vectors)
+}
+
+func (idx *ivfpqIndex) train(vectors [][]float32) error {
 	if idx.trained {
 		return nil
 	}
@@ -141,7 +174,7 @@ func (idx *ivfpqIndex) Train(vectors [][]float32) error {
 	}
 
 	// 1. coarse k-means
-	centroids := kMeans(vectors, idx.nlist, idx.dim, DEFAULT_MAX_KMEANS_ITER)
+	centroids := kMeans(vectors, idx.nlist, idx.dim, DEFAULT_MAX_KMEANS_ITER, idx.kmeansBatch, idx.buildThreads)
 	if len(centroids) != idx.nlist {
 		return errors.New("failed to train coarse k-means")
 	}
@@ -162,13 +195,13 @@ func (idx *ivfpqIndex) Train(vectors [][]float32) error {
 			}
 			subVectors[i] = residual
 		}
-		idx.pqCodebooks[j] = kMeans(subVectors, ksub, idx.subDim, DEFAULT_MAX_KMEANS_ITER)
+		idx.pqCodebooks[j] = kMeans(subVectors, ksub, idx.subDim, DEFAULT_MAX_KMEANS_ITER, idx.kmeansBatch, idx.buildThreads)
 	}
 
 	idx.trained = true
 
 	if len(idx.pendingIDs) > 0 {
-		_ = idx.AddBatch(idx.pendingIDs, idx.pendingVectors)
+		_ = idx.addBatch(idx.pendingIDs, idx.pendingVectors)
 		idx.pendingIDs = nil
 		idx.pendingVectors = nil
 	}
@@ -180,15 +213,23 @@ func (idx *ivfpqIndex) Build(ids []string, vectors [][]float32) error {
 	if len(ids) != len(vectors) {
 		return pkgerrors.ErrMisMatchKeysAndValues
 	}
-	if err := idx.Train(vectors); err != nil {
+	idx.mu.Lock()
+	defer idx.mu.Unlock()
+	if err := idx.train(vectors); err != nil {
 		return err
 	}
-	return idx.AddBatch(ids, vectors)
+	return idx.addBatch(ids, vectors)
 }
 
 ///////////////////////// VectorIndex interface /////////////////////////
 
 func (idx *ivfpqIndex) Add(id string, vector []float32) error {
+	idx.mu.Lock()
+	defer idx.mu.Unlock()
+	return idx.add(id, vector)
+}
+
+func (idx *ivfpqIndex) add(id string, vector []float32) error {
 	if len(vector) != idx.dim {
 		return pkgerrors.ErrInvalidDimension
 	}
@@ -204,11 +245,17 @@ func (idx *ivfpqIndex) Add(id string, vector []float32) error {
 }
 
 func (idx *ivfpqIndex) AddBatch(ids []string, vectors [][]float32) error {
+	idx.mu.Lock()
+	defer idx.mu.Unlock()
+	return idx.addBatch(ids, vectors)
+}
+
+func (idx *ivfpqIndex) addBatch(ids []string, vectors [][]float32) error {
 	if len(ids) != len(vectors) {
 		return pkgerrors.ErrMisMatchKeysAndValues
 	}
 	for i, id := range ids {
-		if err := idx.Add(id, vectors[i]); err != nil {
+		if err := idx.add(id, vectors[i]); err != nil {
 			return err
 		}
 	}
@@ -216,6 +263,8 @@ func (idx *ivfpqIndex) AddBatch(ids []string, vectors [][]float32) error {
 }
 
 func (idx *ivfpqIndex) Delete(id string) error {
+	idx.mu.Lock()
+	defer idx.mu.Unlock()
 	for ci := range idx.lists {
 		for i, item := range idx.lists[ci] {
 			if item.ID == id {
@@ -228,6 +277,40 @@ func (idx *ivfpqIndex) Delete(id string) error {
 }
 
 func (idx *ivfpqIndex) Search(vector []float32, k int) (*SearchResult, error) {
+	idx.mu.RLock()
+	defer idx.mu.RUnlock()
+	return idx.search(vector, k, idx.nprobe, idx.autoNprobe)
+}
+
+// SearchWithParams probes the nprobe lists of params for this query only
+func (idx *ivfpqIndex) SearchWithParams(vector []float32, k int, params map[string]any) (*SearchResult, error) {
+	idx.mu.RLock()
+	defer idx.mu.RUnlock()
+	nprobe, auto := idx.nprobe, idx.autoNprobe
+	for key, val := range params {
+		switch key {
+		case "nprobe":
+			v, ok := intParam(val)
+			if !ok || v <= 0 || v > idx.nlist {
+				return nil, fmt.Errorf("%w: nprobe must be an integer between 1 and %d", pkgerrors.ErrInvalidParameter, idx.nlist)
+			}
+			nprobe = v
+		case "auto_nprobe":
+			v, ok := val.(bool)
+			if !ok {
+				return nil, fmt.Errorf("%w: auto_nprobe must be a boolean", pkgerrors.ErrInvalidParameter)
+			}
+			auto = v
+		default:
+			return nil, fmt.Errorf("%w: unknown ivfpq search parameter %q", pkgerrors.ErrInvalidParameter, key)
+		}
+	}
+	return idx.search(vector, k, nprobe, auto)
+}
+
+// search probes the nprobe lists nearest to vector, with auto the number of
+// lists is picked by autoNprobe around nprobe
+func (idx *ivfpqIndex) search(vector []float32, k, nprobe int, auto bool) (*SearchResult, error) {
 	if !idx.trained {
 		return nil, errors.New("index not trained")
 	}
@@ -248,15 +331,22 @@ func (idx *ivfpqIndex) Search(vector []float32, k int) (*SearchResult, error) {
 		cds[i] = centroidDist{idx: i, d: distance(vector, c, idx.config.SpaceType)}
 	}
 	sort.Slice(cds, func(i, j int) bool { return cds[i].d < cds[j].d })
+	if auto {
+		dists := make([]float32, len(cds))
+		for i, cd := range cds {
+			dists[i] = cd.d
+		}
+		nprobe = autoNprobe(dists, nprobe)
+	}
 
 	// 2. gather candidates using ADC
 	type cand struct {
 		id string
 		d  float32
 	}
-	candidates := make([]cand, 0, k*idx.nprobe)
+	candidates := make([]cand, 0, k*nprobe)
 
-	for i := 0; i < idx.nprobe && i < len(cds); i++ {
+	for i := 0; i < nprobe && i < len(cds); i++ {
 		ci := cds[i].idx
 
 		// precompute distance table for this centroid
@@ -304,6 +394,8 @@ func (idx *ivfpqIndex) Search(vector []float32, k int) (*SearchResult, error) {
 }
 
 func (idx *ivfpqIndex) GetVector(id string) ([]float32, error) {
+	idx.mu.RLock()
+	defer idx.mu.RUnlock()
 	if !idx.trained {
 		for i, pendingID := range idx.pendingIDs {
 			if pendingID == id {
@@ -322,6 +414,66 @@ func (idx *ivfpqIndex) GetVector(id string) ([]float32, error) {
 	return nil, pkgerrors.ErrDocumentNotFound
 }
 
+func (idx *ivfpqIndex) Count() int {
+	idx.mu.RLock()
+	defer idx.mu.RUnlock()
+	return idx.count()
+}
+
+func (idx *ivfpqIndex) count() int {
+	count := len(idx.pendingIDs)
+	for _, list := range idx.lists {
+		count += len(list)
+	}
+	return count
+}
+
+func (idx *ivfpqIndex) Stats() IndexStats {
+	idx.mu.RLock()
+	defer idx.mu.RUnlock()
+	sizes := make([]int, len(idx.lists))
+	for i, list := range idx.lists {
+		sizes[i] = len(list)
+	}
+	occupancy, imbalance := listBalance(sizes)
+	return IndexStats{
+		Type:      IVFPQIndex,
+		Dimension: idx.dim,
+		Count:     idx.count(),
+		Params: map[string]any{
+			"nlist":           idx.nlist,
+			"nprobe":          idx.nprobe,
+			"auto_nprobe":     idx.autoNprobe,
+			"m":               idx.m,
+			"nbits":           idx.nbits,
+			"trained":         idx.trained,
+			"pending":         len(idx.pendingIDs),
+			"occupancy":       occupancy,
+			"imbalanceFactor": imbalance,
+		},
+	}
+}
+
+// Iterate visits the original vectors, not their quantized codes, fn must not
+// call back into the index
+func (idx *ivfpqIndex) Iterate(fn func(id string, vector []float32) bool) error {
+	idx.mu.RLock()
+	defer idx.mu.RUnlock()
+	for i, id := range idx.pendingIDs {
+		if !fn(id, idx.pendingVectors[i]) {
+			return nil
+		}
+	}
+	for _, list := range idx.lists {
+		for _, item := range list {
+			if !fn(item.ID, item.Vector) {
+				return nil
+			}
+		}
+	}
+	return nil
+}
+
 func (idx *ivfpqIndex) Load(filePath string) error {
 	f, err := os.Open(filePath)
 	if err != nil {
@@ -333,9 +485,12 @@ func (idx *ivfpqIndex) Load(filePath string) error {
 	if err := dec.Decode(&snap); err != nil {
 		return err
 	}
+	idx.mu.Lock()
+	defer idx.mu.Unlock()
 	idx.config = snap.Config
 	idx.nlist = snap.Nlist
 	idx.nprobe = snap.Nprobe
+	idx.autoNprobe = snap.AutoNprobe
 	idx.m = snap.M
 	idx.nbits = snap.Nbits
 	idx.dim = snap.Dim
@@ -355,11 +510,14 @@ func (idx *ivfpqIndex) Save(filePath string) error {
 		return err
 	}
 	defer f.Close()
+	idx.mu.RLock()
+	defer idx.mu.RUnlock()
 	enc := gob.NewEncoder(f)
 	snap := ivfpqSnapshot{
 		Config:      idx.config,
 		Nlist:       idx.nlist,
 		Nprobe:      idx.nprobe,
+		AutoNprobe:  idx.autoNprobe,
 		M:           idx.m,
 		Nbits:       idx.nbits,
 		Dim:         idx.dim,
@@ -381,6 +539,8 @@ func (idx *ivfpqIndex) SetParams(params map[string]any) error {
 	if len(params) == 0 {
 		return pkgerrors.ErrEmptyParameter
 	}
+	idx.mu.Lock()
+	defer idx.mu.Unlock()
 	for key, val := range params {
 		switch key {
 		case "nprobe":
@@ -393,9 +553,15 @@ func (idx *ivfpqIndex) SetParams(params map[string]any) error {
 			default:
 				return pkgerrors.ErrInvalidParameter
 			}
-			if err := idx.SetNProbe(ival); err != nil {
+			if err := idx.setNProbe(ival); err != nil {
 				return err
 			}
+		case "auto_nprobe":
+			auto, ok := val.(bool)
+			if !ok {
+				return pkgerrors.ErrInvalidParameter
+			}
+			idx.autoNprobe = auto
 		default:
 			return pkgerrors.ErrInvalidParameter
 		}
@@ -404,6 +570,12 @@ func (idx *ivfpqIndex) SetParams(params map[string]any) error {
 }
 
 func (idx *ivfpqIndex) SetNProbe(nprobe int) error {
+	idx.mu.Lock()
+	defer idx.mu.Unlock()
+	return idx.setNProbe(nprobe)
+}
+
+func (idx *ivfpqIndex) setNProbe(nprobe int) error {
 	if nprobe <= 0 || nprobe > idx.nlist {
 		return pkgerrors.ErrInvalidParameter
 	}
@@ -411,6 +583,48 @@ func (idx *ivfpqIndex) SetNProbe(nprobe int) error {
 	return nil
 }
 
+// ExactSearch scans the original vectors of every inverted list, including
+// vectors pending training
+func (idx *ivfpqIndex) ExactSearch(vector []float32, k int) (*SearchResult, error) {
+	idx.mu.RLock()
+	defer idx.mu.RUnlock()
+	if len(vector) != idx.dim {
+		return nil, pkgerrors.ErrInvalidDimension
+	}
+	ids := append([]string(nil), idx.pendingIDs...)
+	vectors := append([][]float32(nil), idx.pendingVectors...)
+	for _, list := range idx.lists {
+		for _, item := range list {
+			ids = append(ids, item.ID)
+			vectors = append(vectors, item.Vector)
+		}
+	}
+	return exactTopK(vector, k, idx.config.SpaceType, ids, vectors), nil
+}
+
+// ListClusters returns the coarse centroids with their list sizes
+func (idx *ivfpqIndex) ListClusters(sampleSize int) ([]Cluster, error) {
+	idx.mu.RLock()
+	defer idx.mu.RUnlock()
+	if !idx.trained {
+		return nil, errors.New("index not trained")
+	}
+	clusters := make([]Cluster, len(idx.centroids))
+	for i, centroid := range idx.centroids {
+		ids := make([]string, 0, sampleSize)
+		for j := 0; j < len(idx.lists[i]) && j < sampleSize; j++ {
+			ids = append(ids, idx.lists[i][j].ID)
+		}
+		clusters[i] = Cluster{
+			ID:        i,
+			Centroid:  append([]float32(nil), centroid...),
+			Count:     len(idx.lists[i]),
+			SampleIDs: ids,
+		}
+	}
+	return clusters, nil
+}
+
 ///////////////////////// helpers /////////////////////////
 
 func (idx *ivfpqIndex) closestCentroid(v []float32) int {
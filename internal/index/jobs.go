@@ -0,0 +1,134 @@
+package index
+
+import (
+	"slices"
+	"sync/atomic"
+	"time"
+)
+
+// States of a build job
+const (
+	JobRunning = "running"
+	JobDone    = "done"
+	JobFailed  = "failed"
+)
+
+// Kinds of build jobs
+const (
+	JobBuild   = "build"   // a batch built into the index of a collection
+	JobReindex = "reindex" // the new index of a reindex built from the collection
+	JobVacuum  = "vacuum"  // the new index of a vacuum built from the live vectors
+)
+
+// maxFinishedJobs bounds the finished build jobs kept for Jobs, running jobs
+// are always kept
+const maxFinishedJobs = 100
+
+// BuildJob describes an index build, Inserted counts the vectors inserted so
+// far by indices reporting progress and jumps to Total for the others
+type BuildJob struct {
+	ID         int64      `json:"id"`
+	Collection string     `json:"collection"`
+	Kind       string     `json:"kind"` // JobBuild, JobReindex or JobVacuum
+	IndexType  IndexType  `json:"index_type"`
+	State      string     `json:"state"` // JobRunning, JobDone or JobFailed
+	Total      int        `json:"total"`
+	Inserted   int        `json:"inserted"`
+	StartedAt  time.Time  `json:"started_at"`
+	FinishedAt *time.Time `json:"finished_at,omitempty"`
+	Error      string     `json:"error,omitempty"`
+}
+
+// buildJob is a job in progress, inserted is updated without jobsMu
+type buildJob struct {
+	BuildJob
+	inserted atomic.Int64
+}
+
+// buildWithProgress builds index, reporting progress if the index supports it
+// and once it is built otherwise
+func buildWithProgress(index VectorIndex, ids []string, vectors [][]float32, progress func(inserted int)) error {
+	if builder, ok := index.(ProgressBuilder); ok {
+		return builder.BuildWithProgress(ids, vectors, progress)
+	}
+	if err := index.Build(ids, vectors); err != nil {
+		return err
+	}
+	progress(len(ids))
+	return nil
+}
+
+// build builds index as a job listed by Jobs
+func (m *Manager) build(collectionName, kind string, index VectorIndex, ids []string, vectors [][]float32) error {
+	job := m.startJob(collectionName, kind, index.Stats().Type, len(ids))
+	err := buildWithProgress(index, ids, vectors, func(inserted int) {
+		job.inserted.Store(int64(inserted))
+	})
+	m.finishJob(job, err)
+	return err
+}
+
+func (m *Manager) startJob(collectionName, kind string, indexType IndexType, total int) *buildJob {
+	job := &buildJob{BuildJob: BuildJob{
+		Collection: collectionName,
+		Kind:       kind,
+		IndexType:  indexType,
+		State:      JobRunning,
+		Total:      total,
+		StartedAt:  time.Now(),
+	}}
+
+	m.jobsMu.Lock()
+	defer m.jobsMu.Unlock()
+	m.lastJobID++
+	job.ID = m.lastJobID
+	m.jobs = append(m.jobs, job)
+	return job
+}
+
+func (m *Manager) finishJob(job *buildJob, err error) {
+	m.jobsMu.Lock()
+	defer m.jobsMu.Unlock()
+	now := time.Now()
+	job.FinishedAt = &now
+	job.State = JobDone
+	if err != nil {
+		job.State = JobFailed
+		job.Error = err.Error()
+	} else {
+		job.inserted.Store(int64(job.Total))
+	}
+
+	finished := 0
+	for _, j := range m.jobs {
+		if j.State != JobRunning {
+			finished++
+		}
+	}
+	// the jobs are kept in start order, the oldest finished go first
+	m.jobs = slices.DeleteFunc(m.jobs, func(j *buildJob) bool {
+		if finished > maxFinishedJobs && j.State != JobRunning {
+			finished--
+			return true
+		}
+		return false
+	})
+}
+
+// Jobs returns the running index builds and the last finished ones, in the
+// order they started. An empty collectionName returns the jobs of every
+// collection
+func (m *Manager) Jobs(collectionName string) []BuildJob {
+	m.jobsMu.Lock()
+	defer m.jobsMu.Unlock()
+	jobs := make([]BuildJob, 0, len(m.jobs))
+	for _, job := range m.jobs {
+		if collectionName != "" && job.Collection != collectionName {
+			continue
+		}
+		snapshot := job.BuildJob
+		snapshot.Inserted = int(job.inserted.Load())
+		jobs = append(jobs, snapshot)
+	}
+	return jobs
+}
@@ -0,0 +1,186 @@
+package index
+
+import (
+	"fmt"
+	"math/rand"
+	"sync/atomic"
+
+	pkgerrors "oasisdb/pkg/errors"
+)
+
+// kmeansBatchParam reads the mini-batch size of IVF training, 0 when unset
+func kmeansBatchParam(config *IndexConfig) (int, error) {
+	val, ok := config.Parameters["kmeansBatch"]
+	if !ok {
+		return 0, nil
+	}
+	v, ok := intParam(val)
+	if !ok || v < 0 {
+		return 0, fmt.Errorf("%w: kmeansBatch must be a non-negative integer", pkgerrors.ErrInvalidParameter)
+	}
+	return v, nil
+}
+
+// kMeans clusters data into k centroids. The centroids are seeded with
+// k-means++, which spreads them over the data, then refined for at most
+// maxIter iterations. Distances to the centroids are computed on threads
+// goroutines, 0 means GOMAXPROCS. With batchSize 0 every iteration assigns all vectors
+// (Lloyd), otherwise it moves the centroids towards a random sample of
+// batchSize vectors (mini-batch k-means), which trains large data sets in a
+// fraction of the time at a small cost in cluster quality. Seeding is
+// deterministic so indices built from the same vectors match
+func kMeans(data [][]float32, k, dim, maxIter, batchSize, threads int) [][]float32 {
+	if len(data) < k {
+		k = len(data)
+	}
+	if k == 0 {
+		return nil
+	}
+	threads = threadCount(threads)
+	rng := rand.New(rand.NewSource(1))
+	if batchSize <= 0 || batchSize >= len(data) {
+		centroids := kMeansPlusPlus(data, k, threads, rng)
+		lloyd(data, centroids, dim, maxIter, threads)
+		return centroids
+	}
+
+	// seed on a sample, k-means++ costs a pass over its input per centroid
+	sample := make([][]float32, max(batchSize, k))
+	for i, j := range rng.Perm(len(data))[:len(sample)] {
+		sample[i] = data[j]
+	}
+	centroids := kMeansPlusPlus(sample, k, threads, rng)
+	miniBatch(data, centroids, dim, maxIter, batchSize, threads, rng)
+	return centroids
+}
+
+// kMeansPlusPlus picks k distinct vectors of data as centroids, each with a
+// probability proportional to its squared distance to the closest centroid
+// picked before
+func kMeansPlusPlus(data [][]float32, k, threads int, rng *rand.Rand) [][]float32 {
+	centroids := make([][]float32, 0, k)
+	centroids = append(centroids, append([]float32(nil), data[rng.Intn(len(data))]...))
+	minDist := make([]float64, len(data))
+	for i, v := range data {
+		minDist[i] = float64(distance(v, centroids[0], L2Space))
+	}
+	for len(centroids) < k {
+		var sum float64
+		for _, d := range minDist {
+			sum += d
+		}
+		// only duplicates are left when every vector is a centroid already
+		next := rng.Intn(len(data))
+		if sum > 0 {
+			target := rng.Float64() * sum
+			for i, d := range minDist {
+				if d == 0 {
+					continue
+				}
+				next = i
+				if target -= d; target < 0 {
+					break
+				}
+			}
+		}
+		centroid := append([]float32(nil), data[next]...)
+		centroids = append(centroids, centroid)
+		parallelFor(len(data), threads, func(start, end int) {
+			for i := start; i < end; i++ {
+				if d := float64(distance(data[i], centroid, L2Space)); d < minDist[i] {
+					minDist[i] = d
+				}
+			}
+		})
+	}
+	return centroids
+}
+
+// nearestCentroid returns the index of the centroid closest to v in L2
+func nearestCentroid(v []float32, centroids [][]float32) int {
+	best := 0
+	bestDist := distance(v, centroids[0], L2Space)
+	for c := 1; c < len(centroids); c++ {
+		if d := distance(v, centroids[c], L2Space); d < bestDist {
+			bestDist = d
+			best = c
+		}
+	}
+	return best
+}
+
+// lloyd refines centroids in place until no vector changes its cluster or
+// maxIter iterations ran, empty clusters keep their centroid
+func lloyd(data, centroids [][]float32, dim, maxIter, threads int) {
+	k := len(centroids)
+	assignments := make([]int, len(data))
+	for i := range assignments {
+		assignments[i] = -1
+	}
+	counts := make([]int, k)
+	sums := make([][]float32, k)
+	for c := range sums {
+		sums[c] = make([]float32, dim)
+	}
+	for iter := 0; iter < maxIter; iter++ {
+		var changed atomic.Bool
+		parallelFor(len(data), threads, func(start, end int) {
+			for i := start; i < end; i++ {
+				if best := nearestCentroid(data[i], centroids); assignments[i] != best {
+					changed.Store(true)
+					assignments[i] = best
+				}
+			}
+		})
+		if !changed.Load() {
+			break
+		}
+
+		for c := 0; c < k; c++ {
+			counts[c] = 0
+			clear(sums[c])
+		}
+		for i, v := range data {
+			c := assignments[i]
+			counts[c]++
+			for d := 0; d < dim; d++ {
+				sums[c][d] += v[d]
+			}
+		}
+		for c := 0; c < k; c++ {
+			if counts[c] == 0 {
+				continue
+			}
+			for d := 0; d < dim; d++ {
+				centroids[c][d] = sums[c][d] / float32(counts[c])
+			}
+		}
+	}
+}
+
+// miniBatch refines centroids in place over maxIter random batches, each
+// centroid moves towards its batch vectors with a step size that shrinks with
+// the number of vectors it has seen
+func miniBatch(data, centroids [][]float32, dim, maxIter, batchSize, threads int, rng *rand.Rand) {
+	seen := make([]int, len(centroids))
+	batch := make([]int, batchSize)
+	assignments := make([]int, batchSize)
+	for iter := 0; iter < maxIter; iter++ {
+		for i := range batch {
+			batch[i] = rng.Intn(len(data))
+		}
+		parallelFor(batchSize, threads, func(start, end int) {
+			for i := start; i < end; i++ {
+				assignments[i] = nearestCentroid(data[batch[i]], centroids)
+			}
+		})
+		for i, j := range batch {
+			c := assignments[i]
+			seen[c]++
+			eta := 1 / float32(seen[c])
+			for d := 0; d < dim; d++ {
+				centroids[c][d] += eta * (data[j][d] - centroids[c][d])
+			}
+		}
+	}
+}
@@ -0,0 +1,92 @@
+package index
+
+import (
+	"errors"
+	"math/rand"
+	"testing"
+
+	pkgerrors "oasisdb/pkg/errors"
+)
+
+// clusteredVectors returns n vectors around each of k well separated centers,
+// ordered by center so the first vectors all belong to the first cluster
+func clusteredVectors(rng *rand.Rand, k, n, dim int) [][]float32 {
+	vectors := make([][]float32, 0, k*n)
+	for c := 0; c < k; c++ {
+		for i := 0; i < n; i++ {
+			v := make([]float32, dim)
+			for d := range v {
+				v[d] = rng.Float32()
+			}
+			v[c%dim] += float32(100 * (c/dim + 1))
+			vectors = append(vectors, v)
+		}
+	}
+	return vectors
+}
+
+func TestKMeansFindsSeparatedClusters(t *testing.T) {
+	const k, n, dim = 8, 200, 4
+	data := clusteredVectors(rand.New(rand.NewSource(1)), k, n, dim)
+
+	for _, batchSize := range []int{0, 256} {
+		centroids := kMeans(data, k, dim, DEFAULT_MAX_KMEANS_ITER, batchSize, 0)
+		if len(centroids) != k {
+			t.Fatalf("batch %d: expected %d centroids, got %d", batchSize, k, len(centroids))
+		}
+		// every cluster gets its own centroid, so the lists are balanced
+		counts := make([]int, k)
+		for _, v := range data {
+			counts[nearestCentroid(v, centroids)]++
+		}
+		for c, count := range counts {
+			if count != n {
+				t.Fatalf("batch %d: centroid %d holds %d vectors, want %d: %v", batchSize, c, count, n, counts)
+			}
+		}
+	}
+}
+
+func TestKMeansDuplicates(t *testing.T) {
+	data := [][]float32{{1, 1}, {1, 1}, {1, 1}, {2, 2}}
+	centroids := kMeans(data, 3, 2, DEFAULT_MAX_KMEANS_ITER, 0, 0)
+	if len(centroids) != 3 {
+		t.Fatalf("expected 3 centroids, got %d", len(centroids))
+	}
+	if got := kMeans(data, 8, 2, DEFAULT_MAX_KMEANS_ITER, 0, 0); len(got) != len(data) {
+		t.Fatalf("expected k to be capped at %d, got %d centroids", len(data), len(got))
+	}
+}
+
+func TestIVFIndex_KMeansBatchParam(t *testing.T) {
+	for _, val := range []any{float64(-1), float64(1.5), "64"} {
+		cfg := &IndexConfig{IndexType: IVFFLATIndex, Dimension: 4, Parameters: map[string]any{"kmeansBatch": val}}
+		if _, err := newIVFIndex(cfg); !errors.Is(err, pkgerrors.ErrInvalidParameter) {
+			t.Fatalf("expected invalid parameter error for %v, got %v", val, err)
+		}
+	}
+
+	data := clusteredVectors(rand.New(rand.NewSource(2)), 4, 100, 4)
+	ids := make([]string, len(data))
+	for i := range ids {
+		ids[i] = string(rune('a' + i/100))
+	}
+	cfg := &IndexConfig{IndexType: IVFFLATIndex, Dimension: 4, SpaceType: L2Space,
+		Parameters: map[string]any{"nlist": float64(4), "nprobe": float64(1), "kmeansBatch": float64(64)}}
+	vIdx, err := newIVFIndex(cfg)
+	if err != nil {
+		t.Fatalf("failed to create IVF index: %v", err)
+	}
+	if err := vIdx.Build(ids, data); err != nil {
+		t.Fatalf("build failed: %v", err)
+	}
+	clusters, err := vIdx.(*ivfIndex).ListClusters(1)
+	if err != nil {
+		t.Fatalf("list clusters failed: %v", err)
+	}
+	for _, cluster := range clusters {
+		if cluster.Count != 100 {
+			t.Fatalf("unbalanced lists: %+v", clusters)
+		}
+	}
+}
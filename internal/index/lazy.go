@@ -0,0 +1,187 @@
+package index
+
+import (
+	"fmt"
+	"os"
+	"time"
+
+	"oasisdb/pkg/logger"
+)
+
+// readIndexConfig reads the config a checkpointed index is loaded with
+func (m *Manager) readIndexConfig(collectionName string) (*IndexConfig, error) {
+	file, err := readConfigFile(m.configFile(collectionName))
+	if err != nil {
+		return nil, err
+	}
+	return file.IndexConfig, nil
+}
+
+// load loads the checkpointed index of a collection left unloaded, it does
+// nothing if a concurrent lookup loaded it or it was deleted meanwhile
+func (m *Manager) load(collectionName string) error {
+	m.loadMu.Lock()
+	defer m.loadMu.Unlock()
+
+	m.mu.RLock()
+	config, unloaded := m.unloaded[collectionName]
+	m.mu.RUnlock()
+	if !unloaded {
+		return nil
+	}
+
+	start := time.Now()
+	index, err := m.loadIndexFile(collectionName, config)
+	if err != nil {
+		return fmt.Errorf("collection %s: %w", collectionName, err)
+	}
+
+	m.mu.Lock()
+	if _, unloaded := m.unloaded[collectionName]; !unloaded {
+		m.mu.Unlock()
+		index.Close()
+		return nil
+	}
+	delete(m.unloaded, collectionName)
+	m.storeIndex(collectionName, index)
+	m.mu.Unlock()
+	logger.Info("Loaded vector index on first use", "collection", collectionName,
+		"type", config.IndexType, "duration", time.Since(start))
+	return nil
+}
+
+// touch records an access to the index of a collection for the idle unload
+func (m *Manager) touch(collectionName string) {
+	if m.conf.Index.IdleUnloadSeconds > 0 {
+		m.lastUsed.Store(collectionName, time.Now())
+	}
+}
+
+// loadedNames returns the collections whose index is in memory
+func (m *Manager) loadedNames() []string {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	names := make([]string, 0, len(m.indices))
+	for name := range m.indices {
+		names = append(names, name)
+	}
+	return names
+}
+
+// unloadIdle unloads the indices not accessed for IdleUnloadSeconds
+func (m *Manager) unloadIdle() {
+	idle := time.Duration(m.conf.Index.IdleUnloadSeconds) * time.Second
+	now := time.Now()
+	for _, name := range m.loadedNames() {
+		// indices loaded at startup are idle from then on
+		last, _ := m.lastUsed.LoadOrStore(name, now)
+		if now.Sub(last.(time.Time)) < idle {
+			continue
+		}
+		if err := m.unload(name, last.(time.Time)); err != nil {
+			logger.Warn("Failed to unload idle index", "collection", name, "error", err)
+		}
+	}
+}
+
+// Unload checkpoints the index of a collection and frees its memory, the
+// next lookup loads it again
+func (m *Manager) Unload(collectionName string) error {
+	return m.unload(collectionName, time.Now())
+}
+
+// unload checkpoints the index of a collection and closes it, the next
+// lookup loads it again. It gives up if the index was used after lastUsed
+// or written while it was saved
+func (m *Manager) unload(collectionName string, lastUsed time.Time) error {
+	m.mu.RLock()
+	index, exists := m.indices[collectionName]
+	locks := m.locks[collectionName]
+	m.mu.RUnlock()
+	if !exists {
+		return nil
+	}
+	config, err := m.readIndexConfig(collectionName)
+	if err != nil {
+		return err
+	}
+
+	indexPath := m.indexFile(collectionName)
+	if m.unsaved(collectionName, indexPath) {
+		m.checkpoint(indexSaveItem{collectionName: collectionName, index: index})
+	}
+
+	// acquirers may call into the manager, so they must be done before mu
+	locks.ref.Lock()
+	defer locks.ref.Unlock()
+	locks.mu.Lock()
+	defer locks.mu.Unlock()
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if current, exists := m.indices[collectionName]; !exists || current != index {
+		return nil
+	}
+	if last, ok := m.lastUsed.Load(collectionName); ok && last.(time.Time).After(lastUsed) {
+		return nil
+	}
+	if m.unsaved(collectionName, indexPath) {
+		return fmt.Errorf("index has unsaved writes")
+	}
+
+	delete(m.indices, collectionName)
+	delete(m.locks, collectionName)
+	m.unloaded[collectionName] = config
+	m.lastUsed.Delete(collectionName)
+	m.walMu.Lock()
+	if walLog, ok := m.wals[collectionName]; ok {
+		walLog.close()
+		delete(m.wals, collectionName)
+	}
+	m.walMu.Unlock()
+
+	if err := index.Close(); err != nil {
+		logger.Error("Failed to close unloaded index", "collection", collectionName, "error", err)
+	}
+	logger.Info("Unloaded idle vector index", "collection", collectionName)
+	return nil
+}
+
+// unsaved reports whether an index has writes its file doesn't hold, or is
+// vacuumed or reindexed and about to have them
+func (m *Manager) unsaved(collectionName, indexPath string) bool {
+	m.ckMu.Lock()
+	_, reindexing := m.reindexing[collectionName]
+	pending := m.pending[collectionName] > 0 || m.vacuuming[collectionName] || reindexing
+	m.ckMu.Unlock()
+	if pending {
+		return true
+	}
+	return !m.checkpointed(indexPath)
+}
+
+// dropUnloaded deletes the files of an unloaded index, it reports false if
+// the index of the collection isn't unloaded
+func (m *Manager) dropUnloaded(collectionName string) bool {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if _, unloaded := m.unloaded[collectionName]; !unloaded {
+		return false
+	}
+	delete(m.unloaded, collectionName)
+	if ch, ok := m.stopSaveCh[collectionName]; ok {
+		close(ch)
+		delete(m.stopSaveCh, collectionName)
+	}
+
+	m.walMu.Lock()
+	if err := os.RemoveAll(m.walDir(collectionName)); err != nil {
+		logger.Error("Failed to delete WAL directory", "error", err)
+	}
+	m.walMu.Unlock()
+	if m.onWrite != nil {
+		m.onWrite(&WALEntry{OpType: WALOpDeleteIndex, Collection: collectionName})
+	}
+	m.removeIndexFile(m.indexFile(collectionName))
+	logger.Info("Deleted unloaded vector index and related files", "collection", collectionName)
+	return true
+}
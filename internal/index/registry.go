@@ -0,0 +1,43 @@
+package index
+
+import (
+	"oasisdb/pkg/errors"
+	"oasisdb/pkg/vectorindex"
+)
+
+// Factory creates an empty index from its config
+type Factory = vectorindex.Factory
+
+// the built-in index types are registered like the types of applications, a
+// type an application registered first under the same name is a conflict
+func init() {
+	for indexType, factory := range map[IndexType]Factory{
+		HNSWIndex:    newHNSWIndex,
+		IVFFLATIndex: newIVFIndex,
+		IVFPQIndex:   newIVFPQIndex,
+		FLATIndex:    newFlatIndex,
+		FLATGPUIndex: newGPUFlatIndex,
+		DISKANNIndex: newDiskANNIndex,
+	} {
+		if err := vectorindex.Register(indexType, factory); err != nil {
+			panic(err)
+		}
+	}
+}
+
+// newIndex creates an empty index of the configured type, split into the
+// configured number of shards
+func newIndex(config *IndexConfig) (VectorIndex, error) {
+	factory, ok := vectorindex.Lookup(config.IndexType)
+	if !ok {
+		return nil, errors.ErrUnsupportedIndexType
+	}
+	shards, err := shardsParam(config)
+	if err != nil {
+		return nil, err
+	}
+	if shards > 1 {
+		return newShardedIndex(config, factory, shards)
+	}
+	return factory(config)
+}
@@ -0,0 +1,180 @@
+package index
+
+import (
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"oasisdb/pkg/errors"
+	"oasisdb/pkg/logger"
+)
+
+// Reindex builds a new index of a collection with another config and swaps
+// it for the current one, returning the number of vectors it holds. vectors
+// returns the content of the new index and is called with the writes to the
+// collection blocked. Searches and writes use the current index while the new
+// one is built, the writes made meanwhile are applied to it before the swap
+func (m *Manager) Reindex(collectionName string, config *IndexConfig, vectors func(current VectorIndex) ([]string, [][]float32, error)) (int, error) {
+	replacement, err := newIndex(config)
+	if err == errors.ErrUnsupportedIndexType || isInvalidParameter(err) {
+		return 0, err
+	}
+	if err != nil {
+		return 0, errors.ErrFailedToCreateIndex
+	}
+
+	current, unlock, err := m.lockIndex(collectionName, true)
+	if err != nil {
+		replacement.Close()
+		return 0, err
+	}
+	ids, vecs, err := vectors(current)
+	if err == nil {
+		err = m.startReindex(collectionName)
+	}
+	unlock()
+	if err != nil {
+		replacement.Close()
+		return 0, err
+	}
+	defer m.stopReindex(collectionName)
+
+	start := time.Now()
+	if len(ids) > 0 {
+		if err := m.build(collectionName, JobReindex, replacement, ids, vecs); err != nil {
+			replacement.Close()
+			return 0, fmt.Errorf("failed to build index: %w", err)
+		}
+	}
+	if err := m.swap(collectionName, current, replacement, config, ids, vecs, true); err != nil {
+		replacement.Close()
+		return 0, err
+	}
+	logger.Info("Reindexed vector index", "collection", collectionName, "type", config.IndexType,
+		"vectors", replacement.Count(), "duration", time.Since(start))
+	return replacement.Count(), nil
+}
+
+// swap applies the writes made during a reindex to its new index, saves it
+// and makes it the index of the collection, passing it to the write hook if
+// replicate is set. It fails if current was deleted or unloaded meanwhile
+func (m *Manager) swap(collectionName string, current, replacement VectorIndex, config *IndexConfig, ids []string, vectors [][]float32, replicate bool) error {
+	m.mu.RLock()
+	locks := m.locks[collectionName]
+	m.mu.RUnlock()
+	if locks == nil {
+		return errors.ErrIndexNotFound
+	}
+	// acquirers may call into the manager, so they must be done before mu
+	locks.ref.Lock()
+	defer locks.ref.Unlock()
+	locks.mu.Lock()
+	defer locks.mu.Unlock()
+	if !m.current(collectionName, current) {
+		return fmt.Errorf("%w: the index was replaced during the reindex", errors.ErrIndexNotFound)
+	}
+
+	m.ckMu.Lock()
+	writes := m.reindexing[collectionName]
+	m.ckMu.Unlock()
+	for _, entry := range writes {
+		if err := m.applyOp(replacement, entry); err != nil {
+			return fmt.Errorf("failed to apply %s made during the reindex: %w", entry.OpType, err)
+		}
+	}
+
+	// the saved index replaces the WAL, as after a bulk build
+	indexPath := m.indexFile(collectionName)
+	if err := saveIndexFile(replacement, indexPath); err != nil {
+		return fmt.Errorf("failed to save index: %w", err)
+	}
+	if err := m.writeIndexConfig(collectionName, config); err != nil {
+		if restoreErr := saveIndexFile(current, indexPath); restoreErr != nil {
+			logger.Error("Failed to restore index file", "collection", collectionName, "error", restoreErr)
+		}
+		return err
+	}
+	walLog, err := m.walLog(collectionName)
+	if err == nil {
+		err = m.logSnapshot(walLog, collectionName, replacement.Count())
+	}
+	if err != nil {
+		logger.Error("Failed to log reindex snapshot", "collection", collectionName, "error", err)
+	}
+
+	m.mu.Lock()
+	m.indices[collectionName] = replacement
+	m.mu.Unlock()
+	m.ckMu.Lock()
+	delete(m.pending, collectionName)
+	m.ckMu.Unlock()
+	if replicate && m.onWrite != nil {
+		if err := m.replicateReindex(collectionName, config, ids, vectors, writes); err != nil {
+			logger.Error("Failed to replicate reindex", "collection", collectionName, "error", err)
+		}
+	}
+
+	if err := current.Close(); err != nil {
+		logger.Error("Failed to close replaced index", "collection", collectionName, "error", err)
+	}
+	return nil
+}
+
+// replicateReindex passes a reindex to the write hook as the operations
+// recreating the index from scratch
+func (m *Manager) replicateReindex(collectionName string, config *IndexConfig, ids []string, vectors [][]float32, writes []*WALEntry) error {
+	createBytes, err := json.Marshal(CreateIndexData{Config: config})
+	if err != nil {
+		return fmt.Errorf("failed to marshal create index data: %w", err)
+	}
+	buildBytes, err := json.Marshal(BuildIndexData{IDs: ids, Vectors: vectors})
+	if err != nil {
+		return fmt.Errorf("failed to marshal build index data: %w", err)
+	}
+	m.onWrite(&WALEntry{OpType: WALOpDeleteIndex, Collection: collectionName})
+	m.onWrite(&WALEntry{OpType: WALOpCreateIndex, Collection: collectionName, Data: createBytes})
+	m.onWrite(&WALEntry{OpType: WALOpBuildIndex, Collection: collectionName, Data: buildBytes})
+	for _, entry := range writes {
+		m.onWrite(entry)
+	}
+	return nil
+}
+
+// startReindex starts recording the writes to a collection for its reindex,
+// only one reindex of a collection runs at a time
+func (m *Manager) startReindex(collectionName string) error {
+	m.ckMu.Lock()
+	defer m.ckMu.Unlock()
+	if _, running := m.reindexing[collectionName]; running {
+		return fmt.Errorf("%w: collection %s is already being reindexed", errors.ErrInvalidParameter, collectionName)
+	}
+	m.reindexing[collectionName] = nil
+	return nil
+}
+
+func (m *Manager) stopReindex(collectionName string) {
+	m.ckMu.Lock()
+	delete(m.reindexing, collectionName)
+	m.ckMu.Unlock()
+}
+
+func (m *Manager) isReindexing(collectionName string) bool {
+	m.ckMu.Lock()
+	defer m.ckMu.Unlock()
+	_, running := m.reindexing[collectionName]
+	return running
+}
+
+// written passes an operation applied to an index to the write hook and to a
+// running reindex of its collection, the caller must hold the write lock of
+// the index
+func (m *Manager) written(entry *WALEntry) {
+	m.ckMu.Lock()
+	if writes, running := m.reindexing[entry.Collection]; running {
+		m.reindexing[entry.Collection] = append(writes, entry)
+	}
+	m.ckMu.Unlock()
+	if m.onWrite != nil {
+		m.onWrite(entry)
+	}
+}
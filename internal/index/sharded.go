@@ -0,0 +1,427 @@
+package index
+
+import (
+	"bufio"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"hash/fnv"
+	"io"
+	"maps"
+	"math"
+	"os"
+	"sync"
+	"sync/atomic"
+
+	pkgerrors "oasisdb/pkg/errors"
+)
+
+const (
+	// maxShards bounds the shards of a collection, every shard is a full index
+	maxShards = 256
+
+	shardedMagic = "OASISSHD"
+)
+
+// shardsParam reads the number of shards of an index, 1 when unset
+func shardsParam(config *IndexConfig) (int, error) {
+	val, ok := config.Parameters["shards"]
+	if !ok {
+		return 1, nil
+	}
+	n, ok := intParam(val)
+	if !ok || n < 1 || n > maxShards {
+		return 0, fmt.Errorf("%w: shards must be an integer from 1 to %d", pkgerrors.ErrInvalidParameter, maxShards)
+	}
+	return n, nil
+}
+
+// isInvalidParameter reports whether an index couldn't be created because of
+// its parameters
+func isInvalidParameter(err error) bool {
+	return errors.Is(err, pkgerrors.ErrInvalidParameter)
+}
+
+// shardedIndex partitions the vectors of a collection over independent
+// indices of one type. A vector lives in the shard picked by the hash of its
+// ID, searches run on all shards in parallel and merge their nearest vectors
+type shardedIndex struct {
+	config *IndexConfig
+	shards []VectorIndex
+}
+
+// newShardedIndex creates n empty shards with factory, the maxElements of the
+// config is split between them
+func newShardedIndex(config *IndexConfig, factory Factory, n int) (VectorIndex, error) {
+	shardConfig := *config
+	shardConfig.Parameters = maps.Clone(config.Parameters)
+	delete(shardConfig.Parameters, "shards")
+	if v, ok := intParam(shardConfig.Parameters["maxElements"]); ok && v > 0 {
+		shardConfig.Parameters["maxElements"] = float64((v + n - 1) / n)
+	}
+
+	s := &shardedIndex{config: config, shards: make([]VectorIndex, n)}
+	for i := range s.shards {
+		shard, err := factory(&shardConfig)
+		if err != nil {
+			s.Close()
+			return nil, err
+		}
+		s.shards[i] = shard
+	}
+	return s, nil
+}
+
+// shardOf returns the shard of an ID
+func (s *shardedIndex) shardOf(id string) int {
+	h := fnv.New32a()
+	h.Write([]byte(id))
+	return int(h.Sum32() % uint32(len(s.shards)))
+}
+
+// split groups vectors by shard
+func (s *shardedIndex) split(ids []string, vectors [][]float32) ([][]string, [][][]float32) {
+	shardIDs := make([][]string, len(s.shards))
+	shardVectors := make([][][]float32, len(s.shards))
+	for i, id := range ids {
+		shard := s.shardOf(id)
+		shardIDs[shard] = append(shardIDs[shard], id)
+		shardVectors[shard] = append(shardVectors[shard], vectors[i])
+	}
+	return shardIDs, shardVectors
+}
+
+// each runs fn on all shards in parallel and returns the first error
+func (s *shardedIndex) each(fn func(i int, shard VectorIndex) error) error {
+	errs := make([]error, len(s.shards))
+	var wg sync.WaitGroup
+	for i, shard := range s.shards {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			errs[i] = fn(i, shard)
+		}()
+	}
+	wg.Wait()
+	for i, err := range errs {
+		if err != nil {
+			return fmt.Errorf("shard %d: %w", i, err)
+		}
+	}
+	return nil
+}
+
+func (s *shardedIndex) Add(id string, vector []float32) error {
+	return s.shards[s.shardOf(id)].Add(id, vector)
+}
+
+func (s *shardedIndex) AddBatch(ids []string, vectors [][]float32) error {
+	if len(ids) != len(vectors) {
+		return fmt.Errorf("%w: ids and vectors must have the same length", pkgerrors.ErrInvalidParameter)
+	}
+	shardIDs, shardVectors := s.split(ids, vectors)
+	return s.each(func(i int, shard VectorIndex) error {
+		if len(shardIDs[i]) == 0 {
+			return nil
+		}
+		return shard.AddBatch(shardIDs[i], shardVectors[i])
+	})
+}
+
+func (s *shardedIndex) Build(ids []string, vectors [][]float32) error {
+	if len(ids) != len(vectors) {
+		return fmt.Errorf("%w: ids and vectors must have the same length", pkgerrors.ErrInvalidParameter)
+	}
+	shardIDs, shardVectors := s.split(ids, vectors)
+	return s.each(func(i int, shard VectorIndex) error {
+		return shard.Build(shardIDs[i], shardVectors[i])
+	})
+}
+
+// BuildWithProgress builds the shards in parallel, reporting the vectors
+// inserted into all of them
+func (s *shardedIndex) BuildWithProgress(ids []string, vectors [][]float32, progress func(inserted int)) error {
+	if len(ids) != len(vectors) {
+		return fmt.Errorf("%w: ids and vectors must have the same length", pkgerrors.ErrInvalidParameter)
+	}
+	shardIDs, shardVectors := s.split(ids, vectors)
+	inserted := make([]atomic.Int64, len(s.shards))
+	report := func(i, n int) {
+		inserted[i].Store(int64(n))
+		total := 0
+		for j := range inserted {
+			total += int(inserted[j].Load())
+		}
+		progress(total)
+	}
+	return s.each(func(i int, shard VectorIndex) error {
+		return buildWithProgress(shard, shardIDs[i], shardVectors[i], func(n int) { report(i, n) })
+	})
+}
+
+func (s *shardedIndex) Delete(id string) error {
+	return s.shards[s.shardOf(id)].Delete(id)
+}
+
+// search runs fn on every shard and merges the k nearest results
+func (s *shardedIndex) search(k int, fn func(shard VectorIndex) (*SearchResult, error)) (*SearchResult, error) {
+	results := make([]*SearchResult, len(s.shards))
+	err := s.each(func(i int, shard VectorIndex) error {
+		if shard.Count() == 0 {
+			results[i] = &SearchResult{}
+			return nil
+		}
+		result, err := fn(shard)
+		results[i] = result
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+	top := newTopK(k)
+	for _, result := range results {
+		for j, id := range result.IDs {
+			top.push(id, result.Distances[j])
+		}
+	}
+	return top.result(), nil
+}
+
+func (s *shardedIndex) Search(vector []float32, k int) (*SearchResult, error) {
+	return s.search(k, func(shard VectorIndex) (*SearchResult, error) {
+		return shard.Search(vector, k)
+	})
+}
+
+func (s *shardedIndex) SearchWithParams(vector []float32, k int, params map[string]any) (*SearchResult, error) {
+	return s.search(k, func(shard VectorIndex) (*SearchResult, error) {
+		return SearchWithParams(shard, vector, k, params)
+	})
+}
+
+func (s *shardedIndex) ExactSearch(vector []float32, k int) (*SearchResult, error) {
+	if _, ok := s.shards[0].(ExactSearcher); !ok {
+		return nil, pkgerrors.ErrUnsupportedIndexType
+	}
+	return s.search(k, func(shard VectorIndex) (*SearchResult, error) {
+		return shard.(ExactSearcher).ExactSearch(vector, k)
+	})
+}
+
+func (s *shardedIndex) GetVector(id string) ([]float32, error) {
+	return s.shards[s.shardOf(id)].GetVector(id)
+}
+
+func (s *shardedIndex) Count() int {
+	count := 0
+	for _, shard := range s.shards {
+		count += shard.Count()
+	}
+	return count
+}
+
+// Stats sums the counts of the shards, the params are those of a shard with
+// the shard count and the vectors held by each shard
+func (s *shardedIndex) Stats() IndexStats {
+	stats := IndexStats{Type: s.config.IndexType, Dimension: s.config.Dimension}
+	counts := make([]int, len(s.shards))
+	for i, shard := range s.shards {
+		shardStats := shard.Stats()
+		if i == 0 {
+			stats.Params = maps.Clone(shardStats.Params)
+		}
+		stats.Count += shardStats.Count
+		stats.Deleted += shardStats.Deleted
+		counts[i] = shardStats.Count
+	}
+	if stats.Params == nil {
+		stats.Params = map[string]any{}
+	}
+	stats.Params["shards"] = len(s.shards)
+	stats.Params["shardCounts"] = counts
+	return stats
+}
+
+func (s *shardedIndex) Iterate(fn func(id string, vector []float32) bool) error {
+	stopped := false
+	for _, shard := range s.shards {
+		err := shard.Iterate(func(id string, vector []float32) bool {
+			stopped = !fn(id, vector)
+			return !stopped
+		})
+		if err != nil || stopped {
+			return err
+		}
+	}
+	return nil
+}
+
+func (s *shardedIndex) SetParams(params map[string]any) error {
+	if _, ok := params["shards"]; ok {
+		return fmt.Errorf("%w: the shards of an index can't be changed", pkgerrors.ErrInvalidParameter)
+	}
+	for _, shard := range s.shards {
+		if err := shard.SetParams(params); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// ListClusters lists the clusters of all shards, numbered in shard order
+func (s *shardedIndex) ListClusters(sampleSize int) ([]Cluster, error) {
+	var clusters []Cluster
+	for _, shard := range s.shards {
+		lister, ok := shard.(ClusterLister)
+		if !ok {
+			return nil, pkgerrors.ErrUnsupportedIndexType
+		}
+		shardClusters, err := lister.ListClusters(sampleSize)
+		if err != nil {
+			return nil, err
+		}
+		for _, cluster := range shardClusters {
+			cluster.ID = len(clusters)
+			clusters = append(clusters, cluster)
+		}
+	}
+	return clusters, nil
+}
+
+func (s *shardedIndex) Tombstones() (deleted, total int) {
+	for _, shard := range s.shards {
+		if vacuumer, ok := shard.(Vacuumer); ok {
+			d, t := vacuumer.Tombstones()
+			deleted += d
+			total += t
+		}
+	}
+	return deleted, total
+}
+
+func (s *shardedIndex) Vacuum() (int, error) {
+	if _, ok := s.shards[0].(Vacuumer); !ok {
+		return 0, pkgerrors.ErrUnsupportedIndexType
+	}
+	purged := 0
+	for i, shard := range s.shards {
+		n, err := shard.(Vacuumer).Vacuum()
+		if err != nil {
+			return purged, fmt.Errorf("shard %d: %w", i, err)
+		}
+		purged += n
+	}
+	return purged, nil
+}
+
+func (s *shardedIndex) MemoryUsage() int64 {
+	var bytes int64
+	for _, shard := range s.shards {
+		if reporter, ok := shard.(MemoryReporter); ok {
+			bytes += reporter.MemoryUsage()
+		}
+	}
+	return bytes
+}
+
+// Save writes the shards into one file, each saved by its own index and
+// prefixed with its length, so the manager can replace the file atomically
+func (s *shardedIndex) Save(filePath string) error {
+	file, err := os.Create(filePath)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+	w := bufio.NewWriter(file)
+	w.WriteString(shardedMagic)
+	binary.Write(w, binary.LittleEndian, uint32(len(s.shards)))
+	for i, shard := range s.shards {
+		if err := s.saveShard(w, shard, fmt.Sprintf("%s.shard%d%s", filePath, i, tmpSuffix)); err != nil {
+			return fmt.Errorf("shard %d: %w", i, err)
+		}
+	}
+	return w.Flush()
+}
+
+func (s *shardedIndex) saveShard(w io.Writer, shard VectorIndex, tmpPath string) error {
+	defer os.Remove(tmpPath)
+	if err := shard.Save(tmpPath); err != nil {
+		return err
+	}
+	shardFile, err := os.Open(tmpPath)
+	if err != nil {
+		return err
+	}
+	defer shardFile.Close()
+	info, err := shardFile.Stat()
+	if err != nil {
+		return err
+	}
+	if err := binary.Write(w, binary.LittleEndian, uint64(info.Size())); err != nil {
+		return err
+	}
+	_, err = io.Copy(w, shardFile)
+	return err
+}
+
+func (s *shardedIndex) Load(filePath string) error {
+	file, err := os.Open(filePath)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+	r := bufio.NewReader(file)
+	magic := make([]byte, len(shardedMagic))
+	var n uint32
+	if _, err := io.ReadFull(r, magic); err != nil || string(magic) != shardedMagic {
+		return fmt.Errorf("not a sharded index file")
+	}
+	if err := binary.Read(r, binary.LittleEndian, &n); err != nil {
+		return err
+	}
+	if int(n) != len(s.shards) {
+		return fmt.Errorf("index file has %d shards, the index %d", n, len(s.shards))
+	}
+	for i, shard := range s.shards {
+		if err := loadShard(r, shard, fmt.Sprintf("%s.shard%d%s", filePath, i, tmpSuffix)); err != nil {
+			return fmt.Errorf("shard %d: %w", i, err)
+		}
+	}
+	return nil
+}
+
+func loadShard(r io.Reader, shard VectorIndex, tmpPath string) error {
+	var size uint64
+	if err := binary.Read(r, binary.LittleEndian, &size); err != nil {
+		return err
+	}
+	if size > math.MaxInt64 {
+		return fmt.Errorf("invalid shard size %d", size)
+	}
+	defer os.Remove(tmpPath)
+	shardFile, err := os.Create(tmpPath)
+	if err != nil {
+		return err
+	}
+	_, err = io.CopyN(shardFile, r, int64(size))
+	if cerr := shardFile.Close(); err == nil {
+		err = cerr
+	}
+	if err != nil {
+		return err
+	}
+	return shard.Load(tmpPath)
+}
+
+func (s *shardedIndex) Close() error {
+	var err error
+	for _, shard := range s.shards {
+		if shard == nil {
+			continue
+		}
+		if cerr := shard.Close(); err == nil {
+			err = cerr
+		}
+	}
+	return err
+}
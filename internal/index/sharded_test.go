@@ -0,0 +1,129 @@
+package index
+
+import (
+	"fmt"
+	"math/rand"
+	"path/filepath"
+	"sync/atomic"
+	"testing"
+
+	pkgerrors "oasisdb/pkg/errors"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestShardedIndex(t *testing.T) {
+	const n, dim = 500, 8
+	rng := rand.New(rand.NewSource(1))
+	ids := make([]string, n)
+	vectors := make([][]float32, n)
+	for i := range ids {
+		ids[i] = fmt.Sprintf("doc%d", i)
+		vectors[i] = make([]float32, dim)
+		for d := range vectors[i] {
+			vectors[i][d] = rng.Float32()
+		}
+	}
+
+	flat, err := newIndex(&IndexConfig{SpaceType: L2Space, IndexType: FLATIndex, Dimension: dim})
+	assert.NoError(t, err)
+	assert.NoError(t, flat.Build(ids, vectors))
+	idx, err := newIndex(&IndexConfig{SpaceType: L2Space, IndexType: FLATIndex, Dimension: dim,
+		Parameters: map[string]any{"shards": float64(4)}})
+	assert.NoError(t, err)
+	assert.IsType(t, &shardedIndex{}, idx)
+	assert.NoError(t, idx.Build(ids[:400], vectors[:400]))
+	assert.NoError(t, idx.AddBatch(ids[400:], vectors[400:]))
+	assert.Equal(t, n, idx.Count())
+
+	// every shard holds some vectors, together the same ones as one index
+	stats := idx.Stats()
+	assert.Equal(t, 4, stats.Params["shards"])
+	for _, count := range stats.Params["shardCounts"].([]int) {
+		assert.Greater(t, count, 50)
+	}
+	for _, query := range vectors[:20] {
+		want, err := flat.Search(query, 10)
+		assert.NoError(t, err)
+		got, err := idx.Search(query, 10)
+		assert.NoError(t, err)
+		assert.Equal(t, want, got)
+	}
+
+	assert.NoError(t, idx.Delete("doc0"))
+	_, err = idx.GetVector("doc0")
+	assert.Error(t, err)
+	vector, err := idx.GetVector("doc1")
+	assert.NoError(t, err)
+	assert.Equal(t, vectors[1], vector)
+
+	file := filepath.Join(t.TempDir(), "index")
+	assert.NoError(t, idx.Save(file))
+	loaded, err := newIndex(&IndexConfig{SpaceType: L2Space, IndexType: FLATIndex, Dimension: dim,
+		Parameters: map[string]any{"shards": float64(4)}})
+	assert.NoError(t, err)
+	assert.NoError(t, loaded.Load(file))
+	assert.Equal(t, n-1, loaded.Count())
+	want, err := idx.Search(vectors[5], 10)
+	assert.NoError(t, err)
+	got, err := loaded.Search(vectors[5], 10)
+	assert.NoError(t, err)
+	assert.Equal(t, want, got)
+	matches, _ := filepath.Glob(file + ".shard*")
+	assert.Empty(t, matches)
+
+	// a file of a different shard count is rejected
+	other, err := newIndex(&IndexConfig{SpaceType: L2Space, IndexType: FLATIndex, Dimension: dim,
+		Parameters: map[string]any{"shards": float64(2)}})
+	assert.NoError(t, err)
+	assert.Error(t, other.Load(file))
+
+	for _, shards := range []any{float64(0), float64(1.5), float64(maxShards + 1)} {
+		_, err = newIndex(&IndexConfig{SpaceType: L2Space, IndexType: FLATIndex, Dimension: dim,
+			Parameters: map[string]any{"shards": shards}})
+		assert.ErrorIs(t, err, pkgerrors.ErrInvalidParameter)
+	}
+}
+
+func TestShardedHNSWIndex(t *testing.T) {
+	const dim = 4
+	idx, err := newIndex(&IndexConfig{SpaceType: L2Space, IndexType: HNSWIndex, Dimension: dim,
+		Parameters: map[string]any{"shards": float64(3), "maxElements": float64(30)}})
+	assert.NoError(t, err)
+	defer idx.Close()
+	for i := 0; i < 50; i++ {
+		assert.NoError(t, idx.Add(fmt.Sprintf("doc%d", i), []float32{float32(i), 0, 0, 0}))
+	}
+	result, err := idx.Search([]float32{10, 0, 0, 0}, 3)
+	assert.NoError(t, err)
+	assert.Equal(t, "doc10", result.IDs[0])
+	assert.Len(t, result.IDs, 3)
+
+	result, err = SearchWithParams(idx, []float32{20, 0, 0, 0}, 1, map[string]any{"efsearch": float64(50)})
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"doc20"}, result.IDs)
+
+	// a build reports the vectors inserted into all shards
+	built, err := newIndex(&IndexConfig{SpaceType: L2Space, IndexType: HNSWIndex, Dimension: dim,
+		Parameters: map[string]any{"shards": float64(3)}})
+	assert.NoError(t, err)
+	defer built.Close()
+	ids := make([]string, 3000)
+	vectors := make([][]float32, len(ids))
+	for i := range ids {
+		ids[i] = fmt.Sprintf("doc%d", i)
+		vectors[i] = []float32{float32(i), 0, 0, 0}
+	}
+	var inserted atomic.Int64
+	err = built.(ProgressBuilder).BuildWithProgress(ids, vectors, func(n int) {
+		for {
+			current := inserted.Load()
+			if int64(n) <= current || inserted.CompareAndSwap(current, int64(n)) {
+				return
+			}
+		}
+	})
+	assert.NoError(t, err)
+	assert.Equal(t, int64(3000), inserted.Load())
+	assert.Equal(t, 3000, built.Count())
+}
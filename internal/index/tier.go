@@ -0,0 +1,150 @@
+package index
+
+import (
+	"fmt"
+	"os"
+	"path"
+	"time"
+
+	"oasisdb/pkg/logger"
+)
+
+// remoteSuffix names the marker of a saved index moved to the cold tier,
+// its modification time is the one of the save in the tier
+const remoteSuffix = ".remote"
+
+// remoteIndexKey returns the object key of a saved index in the cold tier
+func remoteIndexKey(indexPath string) string {
+	return "index/" + path.Base(indexPath)
+}
+
+// checkpointed reports whether an index was saved, locally or to the cold
+// tier
+func (m *Manager) checkpointed(indexPath string) bool {
+	if _, err := os.Stat(indexPath); err == nil {
+		return true
+	}
+	_, err := os.Stat(indexPath + remoteSuffix)
+	return err == nil
+}
+
+// fetchIndexFile downloads a saved index moved to the cold tier back to
+// indexPath, it does nothing if the index is local
+func (m *Manager) fetchIndexFile(indexPath string) error {
+	if _, err := os.Stat(indexPath); err == nil || m.conf.ColdTier == nil {
+		return nil
+	}
+	marker, err := os.Stat(indexPath + remoteSuffix)
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	start := time.Now()
+	if err := m.conf.ColdTier.Download(remoteIndexKey(indexPath), indexPath); err != nil {
+		return fmt.Errorf("failed to fetch index from the tier: %w", err)
+	}
+	// the same save as in the tier, it isn't uploaded again
+	if err := os.Chtimes(indexPath, marker.ModTime(), marker.ModTime()); err != nil {
+		return err
+	}
+	logger.Info("Fetched index from the tier", "file", path.Base(indexPath), "duration", time.Since(start))
+	return nil
+}
+
+// removeIndexFile deletes a saved index, locally and from the cold tier
+func (m *Manager) removeIndexFile(indexPath string) {
+	for _, file := range []string{indexPath, hnswIDsFile(indexPath)} {
+		if err := os.Remove(file); err != nil && !os.IsNotExist(err) {
+			logger.Error("Failed to delete index file", "error", err)
+		}
+	}
+	if _, err := os.Stat(indexPath + remoteSuffix); err != nil {
+		return
+	}
+	if m.conf.ColdTier != nil {
+		if err := m.conf.ColdTier.Delete(remoteIndexKey(indexPath)); err != nil {
+			logger.Error("Failed to delete index from the tier", "file", path.Base(indexPath), "error", err)
+			return
+		}
+	}
+	if err := os.Remove(indexPath + remoteSuffix); err != nil {
+		logger.Error("Failed to delete index tier marker", "error", err)
+	}
+}
+
+// tierColdIndices moves the saved indices last modified before now minus
+// tier.after_hours to the cold tier, it runs in the goroutine checkpointing
+// the indices. Loaded indices stay in memory, the others are fetched back
+// when they are loaded
+func (m *Manager) tierColdIndices(now time.Time) (files int, bytes int64) {
+	cutoff := now.Add(-time.Duration(m.conf.Tier.AfterHours) * time.Hour)
+	m.mu.RLock()
+	names := make([]string, 0, len(m.indices)+len(m.unloaded))
+	for name := range m.indices {
+		names = append(names, name)
+	}
+	for name := range m.unloaded {
+		names = append(names, name)
+	}
+	m.mu.RUnlock()
+
+	for _, name := range names {
+		indexPath := m.indexFile(name)
+		info, err := os.Stat(indexPath)
+		if err != nil || !info.ModTime().Before(cutoff) {
+			// moved already, deleted or saved lately
+			continue
+		}
+		moved, err := m.tierIndexFile(name, indexPath, info)
+		if err != nil {
+			logger.Warn("Failed to move index to the tier", "collection", name, "error", err)
+			continue
+		}
+		if moved {
+			files++
+			bytes += info.Size()
+		}
+	}
+	if files > 0 {
+		logger.Info("Moved cold indices to the tier", "files", files, "bytes", bytes)
+	}
+	return files, bytes
+}
+
+// tierIndexFile uploads a saved index unless the tier holds the same save
+// and removes it, it reports false if the index was saved again meanwhile
+func (m *Manager) tierIndexFile(collectionName, indexPath string, info os.FileInfo) (bool, error) {
+	marker := indexPath + remoteSuffix
+	if uploaded, err := os.Stat(marker); err != nil || !uploaded.ModTime().Equal(info.ModTime()) {
+		if err := m.conf.ColdTier.Upload(remoteIndexKey(indexPath), indexPath); err != nil {
+			return false, err
+		}
+	}
+
+	// saves are made by checkpoints of this goroutine and by writers holding
+	// the index lock, loads of unloaded indices hold loadMu
+	m.loadMu.Lock()
+	m.mu.RLock()
+	locks := m.locks[collectionName]
+	m.mu.RUnlock()
+	if locks != nil {
+		m.loadMu.Unlock()
+		locks.mu.Lock()
+		defer locks.mu.Unlock()
+	} else {
+		defer m.loadMu.Unlock()
+	}
+	current, err := os.Stat(indexPath)
+	if err != nil || !current.ModTime().Equal(info.ModTime()) || current.Size() != info.Size() {
+		return false, nil
+	}
+	if err := os.WriteFile(marker, nil, 0644); err != nil {
+		return false, err
+	}
+	if err := os.Chtimes(marker, info.ModTime(), info.ModTime()); err != nil {
+		return false, err
+	}
+	return true, os.Remove(indexPath)
+}
@@ -0,0 +1,94 @@
+package index
+
+// topKItem is a candidate result of a search
+type topKItem struct {
+	id   string
+	dist float32
+}
+
+// topK keeps the k nearest candidates pushed to it in a max-heap, so a
+// candidate only costs O(log k) and the farthest kept one is replaced first.
+// Equal distances are ordered by ID, which makes results deterministic
+type topK struct {
+	k     int
+	items []topKItem
+}
+
+func newTopK(k int) *topK {
+	return &topK{k: k, items: make([]topKItem, 0, max(k, 0))}
+}
+
+// farther reports whether a ranks after b
+func farther(a, b topKItem) bool {
+	if a.dist != b.dist {
+		return a.dist > b.dist
+	}
+	return a.id > b.id
+}
+
+// push offers a candidate, it is dropped when k nearer ones are kept
+func (t *topK) push(id string, dist float32) {
+	if t.k <= 0 {
+		return
+	}
+	item := topKItem{id: id, dist: dist}
+	if len(t.items) < t.k {
+		t.items = append(t.items, item)
+		t.up(len(t.items) - 1)
+		return
+	}
+	if !farther(t.items[0], item) {
+		return
+	}
+	t.items[0] = item
+	t.down(0)
+}
+
+// merge pushes the candidates kept by o
+func (t *topK) merge(o *topK) {
+	for _, item := range o.items {
+		t.push(item.id, item.dist)
+	}
+}
+
+func (t *topK) up(i int) {
+	for i > 0 {
+		parent := (i - 1) / 2
+		if !farther(t.items[i], t.items[parent]) {
+			return
+		}
+		t.items[i], t.items[parent] = t.items[parent], t.items[i]
+		i = parent
+	}
+}
+
+func (t *topK) down(i int) {
+	for {
+		largest := i
+		if left := 2*i + 1; left < len(t.items) && farther(t.items[left], t.items[largest]) {
+			largest = left
+		}
+		if right := 2*i + 2; right < len(t.items) && farther(t.items[right], t.items[largest]) {
+			largest = right
+		}
+		if largest == i {
+			return
+		}
+		t.items[i], t.items[largest] = t.items[largest], t.items[i]
+		i = largest
+	}
+}
+
+// result empties the heap into a result sorted by distance
+func (t *topK) result() *SearchResult {
+	n := len(t.items)
+	result := &SearchResult{IDs: make([]string, n), Distances: make([]float32, n)}
+	for i := n - 1; i >= 0; i-- {
+		result.IDs[i], result.Distances[i] = t.items[0].id, t.items[0].dist
+		last := len(t.items) - 1
+		t.items[0] = t.items[last]
+		t.items = t.items[:last]
+		t.down(0)
+	}
+	return result
+}
@@ -0,0 +1,121 @@
+package index
+
+import (
+	"fmt"
+	"math/rand"
+	"reflect"
+	"sort"
+	"testing"
+)
+
+func TestTopK(t *testing.T) {
+	rng := rand.New(rand.NewSource(1))
+	ids := make([]string, 1000)
+	vectors := make([][]float32, len(ids))
+	parts := []*topK{newTopK(10), newTopK(10), newTopK(10)}
+	for i := range ids {
+		ids[i] = fmt.Sprint(i)
+		// few distinct distances, so ties are ordered by ID
+		vectors[i] = []float32{float32(rng.Intn(50))}
+		parts[i%len(parts)].push(ids[i], distance([]float32{0}, vectors[i], L2Space))
+	}
+	for _, part := range parts[1:] {
+		parts[0].merge(part)
+	}
+	got := parts[0].result()
+
+	order := make([]int, len(ids))
+	for i := range order {
+		order[i] = i
+	}
+	sort.Slice(order, func(a, b int) bool {
+		if vectors[order[a]][0] != vectors[order[b]][0] {
+			return vectors[order[a]][0] < vectors[order[b]][0]
+		}
+		return ids[order[a]] < ids[order[b]]
+	})
+	want := &SearchResult{}
+	for _, i := range order[:10] {
+		want.IDs = append(want.IDs, ids[i])
+		want.Distances = append(want.Distances, distance([]float32{0}, vectors[i], L2Space))
+	}
+	if !reflect.DeepEqual(got.IDs, want.IDs) || !reflect.DeepEqual(got.Distances, want.Distances) {
+		t.Fatalf("top 10 mismatch: got %v %v, want %v %v", got.IDs, got.Distances, want.IDs, want.Distances)
+	}
+
+	if result := newTopK(0).result(); len(result.IDs) != 0 {
+		t.Fatalf("expected an empty result, got %v", result.IDs)
+	}
+}
+
+// benchmarks search 1M vectors, run with -bench . -benchtime 20x
+const benchVectors, benchDim, benchK = 1000000, 16, 10
+
+func benchData(b *testing.B) ([]string, [][]float32) {
+	b.Helper()
+	rng := rand.New(rand.NewSource(1))
+	ids := make([]string, benchVectors)
+	for i := range ids {
+		ids[i] = fmt.Sprint(i)
+	}
+	return ids, randomVectors(rng, benchVectors, benchDim)
+}
+
+// BenchmarkTopKSelection compares sorting every candidate with the bounded
+// heap searches use
+func BenchmarkTopKSelection(b *testing.B) {
+	ids, vectors := benchData(b)
+	query := vectors[0]
+	b.Run("sort", func(b *testing.B) {
+		type pair struct {
+			id   string
+			dist float32
+		}
+		for n := 0; n < b.N; n++ {
+			var results []pair
+			for i, id := range ids {
+				results = append(results, pair{id, distance(query, vectors[i], L2Space)})
+			}
+			sort.Slice(results, func(i, j int) bool { return results[i].dist < results[j].dist })
+			_ = results[:benchK]
+		}
+	})
+	b.Run("heap", func(b *testing.B) {
+		for n := 0; n < b.N; n++ {
+			top := newTopK(benchK)
+			for i, id := range ids {
+				top.push(id, distance(query, vectors[i], L2Space))
+			}
+			_ = top.result()
+		}
+	})
+}
+
+func BenchmarkFlatSearch(b *testing.B) {
+	ids, vectors := benchData(b)
+	index, _ := newFlatIndex(&IndexConfig{IndexType: FLATIndex, Dimension: benchDim, SpaceType: L2Space})
+	if err := index.Build(ids, vectors); err != nil {
+		b.Fatal(err)
+	}
+	b.ResetTimer()
+	for n := 0; n < b.N; n++ {
+		if _, err := index.Search(vectors[n%len(vectors)], benchK); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+func BenchmarkIVFSearch(b *testing.B) {
+	ids, vectors := benchData(b)
+	index, _ := newIVFIndex(&IndexConfig{IndexType: IVFFLATIndex, Dimension: benchDim, SpaceType: L2Space,
+		Parameters: map[string]any{"nlist": float64(100), "nprobe": float64(10), "kmeansBatch": float64(2000)}})
+	if err := index.Build(ids, vectors); err != nil {
+		b.Fatal(err)
+	}
+	b.ResetTimer()
+	for n := 0; n < b.N; n++ {
+		if _, err := index.Search(vectors[n%len(vectors)], benchK); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
@@ -0,0 +1,195 @@
+package index
+
+import (
+	"os"
+
+	"oasisdb/pkg/logger"
+)
+
+// Rough per-entry costs of Go and hnswlib bookkeeping, used by the memory
+// estimates
+const (
+	sliceHeaderBytes  = 24
+	stringHeaderBytes = 16
+	mapEntryBytes     = 48         // bucket share of a map entry besides its key and value
+	hnswElementBytes  = 4 + 8 + 40 // level, link list pointer and lock of an element slot
+)
+
+// MemoryReporter is implemented by indices that can estimate their memory
+// footprint
+type MemoryReporter interface {
+	// MemoryUsage returns the approximate bytes held in memory
+	MemoryUsage() int64
+}
+
+// IndexUsage describes the disk and memory used by the index of a collection
+type IndexUsage struct {
+	IndexFileBytes int64 // checkpointed index and its config
+	WALBytes       int64 // writes since the last checkpoint
+	MemoryBytes    int64 // approximate, 0 if the index can't estimate it
+}
+
+// Usage reports the disk and memory used by the index of a collection
+func (m *Manager) Usage(collectionName string) (*IndexUsage, error) {
+	index, unlock, err := m.lockIndex(collectionName, false)
+	if err != nil {
+		return nil, err
+	}
+	defer unlock()
+
+	usage := &IndexUsage{}
+	for _, file := range []string{
+		m.indexFile(collectionName),
+		hnswIDsFile(m.indexFile(collectionName)),
+		m.configFile(collectionName),
+	} {
+		if info, err := os.Stat(file); err == nil {
+			usage.IndexFileBytes += info.Size()
+		}
+	}
+	entries, err := os.ReadDir(m.walDir(collectionName))
+	if err != nil && !os.IsNotExist(err) {
+		return nil, err
+	}
+	for _, entry := range entries {
+		if info, err := entry.Info(); err == nil && !entry.IsDir() {
+			usage.WALBytes += info.Size()
+		}
+	}
+	if reporter, ok := index.(MemoryReporter); ok {
+		usage.MemoryBytes = reporter.MemoryUsage()
+	}
+	return usage, nil
+}
+
+// MemoryUsage estimates the memory of every loaded index by collection,
+// indices that can't estimate it are left out
+func (m *Manager) MemoryUsage() map[string]int64 {
+	usage := make(map[string]int64)
+	for _, name := range m.loadedNames() {
+		m.mu.RLock()
+		index, exists := m.indices[name]
+		locks := m.locks[name]
+		m.mu.RUnlock()
+		if !exists {
+			continue
+		}
+		// deleted or unloaded meanwhile, lockIndex would load it again
+		locks.mu.RLock()
+		if reporter, ok := index.(MemoryReporter); ok && m.current(name, index) {
+			usage[name] = reporter.MemoryUsage()
+		}
+		locks.mu.RUnlock()
+	}
+	return usage
+}
+
+// logMemoryUsage logs the total memory estimate and the largest index, so
+// the growth of the indices towards the memory limit shows in the log
+func (m *Manager) logMemoryUsage() {
+	var total, largest int64
+	var largestName string
+	usage := m.MemoryUsage()
+	for name, bytes := range usage {
+		total += bytes
+		if bytes > largest {
+			largest, largestName = bytes, name
+		}
+	}
+	if len(usage) == 0 {
+		return
+	}
+	logger.Info("Index memory usage", "indices", len(usage), "total_bytes", total,
+		"largest", largestName, "largest_bytes", largest)
+}
+
+// MemoryUsage estimates the hnswlib allocation, level 0 is allocated for
+// maxElements up front, upper levels hold 1/(M-1) links lists per element
+func (h *hnswIndex) MemoryUsage() int64 {
+	m := int64(DEFAULT_M)
+	if v, ok := h.config.Parameters["M"].(float64); ok && v > 1 {
+		m = int64(v)
+	}
+	maxElements := int64(h.index.GetMaxElements())
+	count := int64(h.index.GetCurrentElementCount())
+	level0 := (2*m+1)*4 + int64(h.config.Dimension)*4 + 8
+	upper := (m + 1) * 4 * count / (m - 1)
+
+	h.mu.RLock()
+	var ids int64
+	for id := range h.labels {
+		ids += 2 * (int64(len(id)) + stringHeaderBytes + 4 + mapEntryBytes)
+	}
+	h.mu.RUnlock()
+
+	return maxElements*(level0+hnswElementBytes) + upper + count*mapEntryBytes + ids
+}
+
+// vectorBytes is the memory held by a vector stored with its ID
+func vectorBytes(id string, dimension int) int64 {
+	return stringHeaderBytes + int64(len(id)) + sliceHeaderBytes + int64(dimension)*4
+}
+
+func (ivf *ivfIndex) MemoryUsage() int64 {
+	ivf.mu.RLock()
+	defer ivf.mu.RUnlock()
+	dim := ivf.config.Dimension
+	usage := int64(len(ivf.centroids)) * (sliceHeaderBytes + int64(dim)*4)
+	for _, list := range ivf.lists {
+		for _, item := range list {
+			usage += vectorBytes(item.ID, dim)
+		}
+	}
+	for _, id := range ivf.pendingIDs {
+		usage += vectorBytes(id, dim)
+	}
+	return usage
+}
+
+func (idx *ivfpqIndex) MemoryUsage() int64 {
+	idx.mu.RLock()
+	defer idx.mu.RUnlock()
+	usage := int64(len(idx.centroids)) * (sliceHeaderBytes + int64(idx.dim)*4)
+	for _, codebook := range idx.pqCodebooks {
+		usage += int64(len(codebook)) * (sliceHeaderBytes + int64(idx.subDim)*4)
+	}
+	for _, list := range idx.lists {
+		for _, item := range list {
+			usage += vectorBytes(item.ID, len(item.Vector)) + sliceHeaderBytes + int64(len(item.Codes))
+		}
+	}
+	for _, id := range idx.pendingIDs {
+		usage += vectorBytes(id, idx.dim)
+	}
+	return usage
+}
+
+func (f *FlatIndex) MemoryUsage() int64 {
+	f.mu.RLock()
+	defer f.mu.RUnlock()
+	usage := int64(len(f.Data)) * 4
+	for _, id := range f.Ids {
+		usage += 2*(stringHeaderBytes+int64(len(id))) + 8 + mapEntryBytes
+	}
+	return usage
+}
+
+// MemoryUsage counts the navigation cache, the IDs and the delta, the graph
+// itself is mapped and paged in by the kernel
+func (d *diskannIndex) MemoryUsage() int64 {
+	d.mu.RLock()
+	defer d.mu.RUnlock()
+	usage := int64(len(d.deleted)) * (4 + 1 + mapEntryBytes)
+	for _, id := range d.ids {
+		usage += 2*(stringHeaderBytes+int64(len(id))) + 4 + mapEntryBytes
+	}
+	for _, id := range d.deltaIDs {
+		usage += vectorBytes(id, d.config.Dimension) + stringHeaderBytes + 8 + mapEntryBytes
+	}
+	if d.graph != nil {
+		for i, vector := range d.graph.cacheVectors {
+			usage += 2*sliceHeaderBytes + int64(len(vector))*4 + int64(len(d.graph.cacheNeighbors[i]))*4 + 8 + mapEntryBytes
+		}
+	}
+	return usage
+}
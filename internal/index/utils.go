@@ -1,8 +1,13 @@
 package index
 
 import (
+	"fmt"
 	"hash/fnv"
+	"runtime"
 	"strconv"
+	"sync"
+
+	"oasisdb/pkg/errors"
 )
 
 const (
@@ -41,3 +46,85 @@ func stringToInt32(str string) int32 {
 	nonNumericID := NON_NUMERIC_ID_START + (int32(hashValue) % RANGE_SIZE)
 	return nonNumericID
 }
+
+// parallelFor calls fn on contiguous ranges covering [0, n), one per worker
+// goroutine, and waits for them
+func parallelFor(n, workers int, fn func(start, end int)) {
+	workers = min(workers, n)
+	if workers <= 1 {
+		fn(0, n)
+		return
+	}
+	var wg sync.WaitGroup
+	chunk := (n + workers - 1) / workers
+	for start := 0; start < n; start += chunk {
+		wg.Add(1)
+		go func(start, end int) {
+			defer wg.Done()
+			fn(start, end)
+		}(start, min(start+chunk, n))
+	}
+	wg.Wait()
+}
+
+// threadCount returns the goroutines of a parallel step configured to
+// threads, 0 means GOMAXPROCS
+func threadCount(threads int) int {
+	if threads > 0 {
+		return threads
+	}
+	return runtime.GOMAXPROCS(0)
+}
+
+// threadsParam reads a goroutine count parameter such as searchThreads or
+// buildThreads, 0 when unset
+func threadsParam(config *IndexConfig, name string) (int, error) {
+	val, ok := config.Parameters[name]
+	if !ok {
+		return 0, nil
+	}
+	v, ok := intParam(val)
+	if !ok || v < 0 {
+		return 0, fmt.Errorf("%w: %s must be a non-negative integer", errors.ErrInvalidParameter, name)
+	}
+	return v, nil
+}
+
+// exactTopK ranks all candidates by distance to vector and keeps the k nearest
+func exactTopK(vector []float32, k int, space SpaceType, ids []string, vectors [][]float32) *SearchResult {
+	top := newTopK(min(k, len(ids)))
+	for i, id := range ids {
+		top.push(id, distance(vector, vectors[i], space))
+	}
+	return top.result()
+}
+
+// RankCandidates ranks the vectors of a known candidate set by distance to
+// vector and keeps the k nearest, it is exact like ExactSearch
+func RankCandidates(vector []float32, k int, space SpaceType, ids []string, vectors [][]float32) *SearchResult {
+	return exactTopK(vector, k, space, ids, vectors)
+}
+
+// SearchWithParams runs a k-NN search on idx with per-query parameters, no
+// params is a plain Search
+func SearchWithParams(idx VectorIndex, vector []float32, k int, params map[string]any) (*SearchResult, error) {
+	if len(params) == 0 {
+		return idx.Search(vector, k)
+	}
+	searcher, ok := idx.(ParamSearcher)
+	if !ok {
+		return nil, fmt.Errorf("%w: index does not accept search parameters", errors.ErrInvalidParameter)
+	}
+	return searcher.SearchWithParams(vector, k, params)
+}
+
+// intParam reads an integer parameter, JSON numbers are decoded as float64
+func intParam(val any) (int, bool) {
+	switch v := val.(type) {
+	case int:
+		return v, true
+	case float64:
+		return int(v), v == float64(int(v))
+	}
+	return 0, false
+}
@@ -0,0 +1,199 @@
+package index
+
+import (
+	"fmt"
+	"time"
+
+	"oasisdb/pkg/errors"
+	"oasisdb/pkg/logger"
+)
+
+// vacuumMinDeleted is the number of deleted elements below which an index is
+// never vacuumed automatically
+const vacuumMinDeleted = 100
+
+// Vacuumer is implemented by indices that keep deleted elements until they
+// are purged
+type Vacuumer interface {
+	// Tombstones returns the deleted elements still held and all elements
+	Tombstones() (deleted, total int)
+	// Vacuum rebuilds the index without its deleted elements and returns how
+	// many were purged, the caller must exclude all other operations
+	Vacuum() (int, error)
+}
+
+// Vacuum purges the deleted elements of a collection's index by building a
+// new index from its live vectors and swapping it in like a reindex. Searches
+// and writes use the current index while the new one is built, the writes
+// made meanwhile are applied to it before the swap
+func (m *Manager) Vacuum(collectionName string) (int, error) {
+	current, unlock, err := m.lockIndex(collectionName, false)
+	if err != nil {
+		return 0, err
+	}
+	vacuumer, ok := current.(Vacuumer)
+	if !ok {
+		unlock()
+		return 0, errors.ErrUnsupportedIndexType
+	}
+	deleted, _ := vacuumer.Tombstones()
+	if deleted == 0 {
+		unlock()
+		return 0, nil
+	}
+	// writes wait for the read lock, so none is missed between the copy of
+	// the live vectors and the start of the recording
+	var ids []string
+	var vectors [][]float32
+	config, err := m.readIndexConfig(collectionName)
+	if err == nil {
+		err = current.Iterate(func(id string, vector []float32) bool {
+			ids = append(ids, id)
+			vectors = append(vectors, vector)
+			return true
+		})
+	}
+	if err == nil {
+		err = m.startReindex(collectionName)
+	}
+	unlock()
+	if err != nil {
+		return 0, err
+	}
+	defer m.stopReindex(collectionName)
+
+	start := time.Now()
+	replacement, err := newIndex(config)
+	if err != nil {
+		return 0, fmt.Errorf("failed to create index: %w", err)
+	}
+	if len(ids) > 0 {
+		if err := m.build(collectionName, JobVacuum, replacement, ids, vectors); err != nil {
+			replacement.Close()
+			return 0, fmt.Errorf("failed to vacuum index: %w", err)
+		}
+	}
+	// the content is unchanged, followers vacuum on their own
+	if err := m.swap(collectionName, current, replacement, config, ids, vectors, false); err != nil {
+		replacement.Close()
+		return 0, err
+	}
+	logger.Info("Vacuumed vector index", "collection", collectionName, "purged", deleted,
+		"duration", time.Since(start))
+	return deleted, nil
+}
+
+// maybeVacuum starts a background vacuum of an index whose share of deleted
+// elements reached VacuumDeletedRatio, the caller must hold its write lock
+func (m *Manager) maybeVacuum(collectionName string, index VectorIndex) {
+	ratio := m.conf.Index.VacuumDeletedRatio
+	if ratio <= 0 {
+		return
+	}
+	vacuumer, ok := index.(Vacuumer)
+	if !ok {
+		return
+	}
+	deleted, total := vacuumer.Tombstones()
+	if deleted < vacuumMinDeleted || float64(deleted) < ratio*float64(total) {
+		return
+	}
+
+	m.ckMu.Lock()
+	defer m.ckMu.Unlock()
+	if m.vacuuming[collectionName] {
+		return
+	}
+	m.vacuuming[collectionName] = true
+	go func() {
+		defer func() {
+			m.ckMu.Lock()
+			delete(m.vacuuming, collectionName)
+			m.ckMu.Unlock()
+		}()
+		if _, err := m.Vacuum(collectionName); err != nil {
+			logger.Error("Failed to vacuum index", "collection", collectionName, "error", err)
+		}
+	}()
+}
+
+func (h *hnswIndex) Tombstones() (deleted, total int) {
+	return h.index.GetDeletedCount(), h.index.GetCurrentElementCount()
+}
+
+// Vacuum inserts the elements that aren't deleted into a fresh hnswlib index
+// and swaps it in, IDs keep their labels and IDs of purged elements are
+// forgotten
+func (h *hnswIndex) Vacuum() (int, error) {
+	deleted := h.index.GetDeletedCount()
+	if deleted == 0 {
+		return 0, nil
+	}
+
+	labels := h.index.GetLabels()
+	live := make(map[uint32]bool, len(labels))
+	kept := make([]uint32, 0, len(labels))
+	points := make([][]float32, 0, len(labels))
+	for _, label := range labels {
+		vector := h.index.GetVectorByLabel(label, h.config.Dimension)
+		if vector == nil {
+			continue
+		}
+		live[label] = true
+		kept = append(kept, label)
+		points = append(points, vector)
+	}
+
+	fresh, err := newNativeHNSW(h.config, max(uint32(len(kept)), hnswMaxElements(h.config.Parameters)))
+	if err != nil {
+		return 0, err
+	}
+	if len(kept) > 0 {
+		if err := fresh.AddItems(points, kept, h.buildThreads, false); err != nil {
+			fresh.Unload()
+			return 0, err
+		}
+	}
+	if err := fresh.SetEf(h.index.GetEf()); err != nil {
+		fresh.Unload()
+		return 0, err
+	}
+
+	old := h.index
+	h.index = fresh
+	old.Unload()
+
+	h.mu.Lock()
+	for label, id := range h.ids {
+		if !live[label] {
+			delete(h.ids, label)
+			delete(h.labels, id)
+		}
+	}
+	h.mu.Unlock()
+	return deleted, nil
+}
+
+func (d *diskannIndex) Tombstones() (deleted, total int) {
+	d.mu.RLock()
+	defer d.mu.RUnlock()
+	return len(d.deleted), len(d.ids) + len(d.deltaIDs)
+}
+
+// Vacuum rebuilds the graph from its live nodes and the delta, waiting for a
+// background build first
+func (d *diskannIndex) Vacuum() (int, error) {
+	d.lockIdle()
+	defer d.mu.Unlock()
+	deleted := len(d.deleted)
+	if deleted == 0 {
+		return 0, nil
+	}
+	source := d.snapshot()
+	graph, err := d.buildGraph(source, d.dir)
+	if err != nil {
+		return 0, err
+	}
+	d.install(graph, source.ids, append([]string(nil), d.deltaIDs...))
+	return deleted, nil
+}
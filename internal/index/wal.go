@@ -2,17 +2,29 @@ package index
 
 import (
 	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"slices"
+	"strconv"
+	"strings"
+
+	"oasisdb/internal/storage/wal"
 )
 
 // WALOpType represents the type of operation in WAL
 type WALOpType string
 
 const (
-	WALOpCreateIndex  WALOpType = "create_index"
-	WALOpAddVector    WALOpType = "add_vector"
-	WALOpAddBatch     WALOpType = "add_batch"
-	WALOpDeleteVector WALOpType = "delete_vector"
-	WALOpBuildIndex   WALOpType = "build_index"
+	WALOpCreateIndex   WALOpType = "create_index"
+	WALOpAddVector     WALOpType = "add_vector"
+	WALOpAddBatch      WALOpType = "add_batch"
+	WALOpDeleteVector  WALOpType = "delete_vector"
+	WALOpBuildIndex    WALOpType = "build_index"
+	WALOpBuildSnapshot WALOpType = "build_snapshot"
+	// WALOpDeleteIndex is only replicated, deleting an index removes its WAL
+	WALOpDeleteIndex WALOpType = "delete_index"
 )
 
 // WALEntry represents a single WAL log entry
@@ -44,6 +56,13 @@ type BuildIndexData struct {
 	Vectors [][]float32 `json:"vectors"`
 }
 
+// BuildSnapshotData marks a bulk build saved to the index file instead of
+// being logged, the snapshot holds every write logged before segment Seq
+type BuildSnapshotData struct {
+	Seq   uint64 `json:"seq"`
+	Count int    `json:"count"`
+}
+
 // DeleteVectorData represents the data for deleting a vector
 type DeleteVectorData struct {
 	ID string `json:"id"`
@@ -62,3 +81,197 @@ func decodeWALEntry(data []byte) (*WALEntry, error) {
 	}
 	return &entry, nil
 }
+
+// walSegmentExt is the extension of index WAL segments, a segment is named by
+// its zero padded sequence number so file names sort in write order
+const walSegmentExt = ".wal"
+
+// collectionWAL is the WAL of one collection, a directory of segments replayed in
+// sequence order. A segment is never reopened for writing, a new log starts
+// after the last existing segment
+type collectionWAL struct {
+	dir    string
+	seq    uint64
+	size   uint64
+	writer *wal.WALWriter
+}
+
+func newCollectionWAL(dir string) (*collectionWAL, error) {
+	seqs, err := listSegments(dir)
+	if err != nil {
+		return nil, err
+	}
+	l := &collectionWAL{dir: dir}
+	if len(seqs) > 0 {
+		l.seq = seqs[len(seqs)-1] + 1
+	}
+	return l, nil
+}
+
+func segmentPath(dir string, seq uint64) string {
+	return path.Join(dir, fmt.Sprintf("%020d%s", seq, walSegmentExt))
+}
+
+// listSegments returns the sequence numbers of the segments in dir in order
+func listSegments(dir string) ([]uint64, error) {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, nil
+		}
+		return nil, err
+	}
+
+	var seqs []uint64
+	for _, entry := range entries {
+		name := entry.Name()
+		if entry.IsDir() || !strings.HasSuffix(name, walSegmentExt) {
+			continue
+		}
+		seq, err := strconv.ParseUint(strings.TrimSuffix(name, walSegmentExt), 10, 64)
+		if err != nil {
+			continue
+		}
+		seqs = append(seqs, seq)
+	}
+	slices.Sort(seqs)
+	return seqs, nil
+}
+
+// append writes a record to the active segment, a new segment is started
+// once the active one reaches segmentSize bytes
+func (l *collectionWAL) append(key, value []byte, segmentSize uint64) error {
+	if l.writer != nil && l.size >= segmentSize {
+		l.writer.Close()
+		l.writer = nil
+		l.seq++
+	}
+	if l.writer == nil {
+		writer, err := wal.NewWALWriter(segmentPath(l.dir, l.seq))
+		if err != nil {
+			return fmt.Errorf("failed to create WAL writer: %w", err)
+		}
+		l.writer, l.size = writer, 0
+	}
+
+	if err := l.writer.Write(key, value); err != nil {
+		return err
+	}
+	l.size += uint64(len(key) + len(value))
+	return nil
+}
+
+// truncate removes all segments, the next record starts a new segment
+func (l *collectionWAL) truncate() error {
+	l.close()
+	seqs, err := listSegments(l.dir)
+	if err != nil {
+		return err
+	}
+	for _, seq := range seqs {
+		if err := os.Remove(segmentPath(l.dir, seq)); err != nil && !os.IsNotExist(err) {
+			return err
+		}
+	}
+	return nil
+}
+
+// rotate closes the active segment and returns the sequence number of the
+// segment the next record starts
+func (l *collectionWAL) rotate() uint64 {
+	l.close()
+	return l.seq
+}
+
+// sync flushes the active segment to stable storage
+func (l *collectionWAL) sync() error {
+	if l.writer == nil {
+		return nil
+	}
+	return l.writer.Sync()
+}
+
+// removeBefore removes the segments older than seq, oldest first
+func (l *collectionWAL) removeBefore(seq uint64) error {
+	seqs, err := listSegments(l.dir)
+	if err != nil {
+		return err
+	}
+	for _, s := range seqs {
+		if s >= seq {
+			break
+		}
+		if err := os.Remove(segmentPath(l.dir, s)); err != nil && !os.IsNotExist(err) {
+			return err
+		}
+	}
+	return nil
+}
+
+// close closes the active segment, the next record starts a new segment
+func (l *collectionWAL) close() {
+	if l.writer != nil {
+		l.writer.Close()
+		l.writer = nil
+		l.seq++
+	}
+}
+
+// replaySegment calls apply for every entry of a segment in write order, it
+// stops at the first record that can't be read or decoded. A segment ending
+// inside a record, left by a crash in the middle of a write, returns
+// io.ErrUnexpectedEOF and the offset after its last complete record
+func replaySegment(segmentPath string, apply func(*WALEntry)) (int64, error) {
+	reader, err := wal.NewWALReader(segmentPath)
+	if err != nil {
+		return 0, err
+	}
+	defer reader.Close()
+
+	for {
+		kv, err := reader.Next()
+		if err == io.EOF {
+			return reader.Offset(), nil
+		}
+		if err != nil {
+			return reader.Offset(), err
+		}
+		entry, err := decodeWALEntry(kv.Value)
+		if err != nil {
+			return reader.Offset(), fmt.Errorf("failed to decode WAL entry: %w", err)
+		}
+		apply(entry)
+	}
+}
+
+// snapshotSegment returns the position in seqs of the last segment starting
+// with a build snapshot marker, the segments before it are held by the
+// snapshot and must not be replayed. It returns 0 without a marker
+func snapshotSegment(dir string, seqs []uint64) int {
+	for i := len(seqs) - 1; i > 0; i-- {
+		entry, err := firstEntry(segmentPath(dir, seqs[i]))
+		if err != nil || entry.OpType != WALOpBuildSnapshot {
+			continue
+		}
+		var data BuildSnapshotData
+		if err := json.Unmarshal(entry.Data, &data); err == nil && data.Seq == seqs[i] {
+			return i
+		}
+	}
+	return 0
+}
+
+// firstEntry reads the first entry of a segment
+func firstEntry(segmentPath string) (*WALEntry, error) {
+	reader, err := wal.NewWALReader(segmentPath)
+	if err != nil {
+		return nil, err
+	}
+	defer reader.Close()
+
+	kv, err := reader.Next()
+	if err != nil {
+		return nil, err
+	}
+	return decodeWALEntry(kv.Value)
+}
@@ -0,0 +1,114 @@
+package llm
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+	"sync"
+)
+
+const (
+	DashScopeProvider = "dashscope"
+	OpenAIProvider    = "openai"
+
+	DefaultProvider = DashScopeProvider
+)
+
+var ErrUnknownProvider = errors.New("unknown llm provider")
+
+// Message is one turn of a chat completion
+type Message struct {
+	Role    string `json:"role"` // system, user or assistant
+	Content string `json:"content"`
+}
+
+// LLMProvider generates answers from chat messages
+type LLMProvider interface {
+	// Chat returns the full completion
+	Chat(messages []Message) (string, error)
+	// ChatStream calls onDelta with each piece of the completion as it
+	// arrives and returns the full completion, an error from onDelta stops
+	// the stream
+	ChatStream(messages []Message, onDelta func(string) error) (string, error)
+}
+
+// Options configures an LLM provider
+type Options struct {
+	Name        string  // provider name, e.g. "dashscope", "openai"
+	APIKeyEnv   string  // environment variable holding the API key
+	Model       string  // model name, empty means provider default
+	BaseURL     string  // API base URL, empty means provider default
+	MaxTokens   int     // max completion tokens, 0 means provider default
+	Temperature float64 // sampling temperature, 0 means provider default
+}
+
+// Constructor creates an LLM provider from options
+type Constructor func(opts Options) (LLMProvider, error)
+
+var (
+	registryMu sync.RWMutex
+	registry   = map[string]Constructor{
+		DashScopeProvider: NewDashScopeProvider,
+		OpenAIProvider:    NewOpenAIProvider,
+	}
+)
+
+// Register makes an LLM provider available by name, replacing any provider
+// previously registered under the same name
+func Register(name string, constructor Constructor) {
+	registryMu.Lock()
+	defer registryMu.Unlock()
+	registry[strings.ToLower(name)] = constructor
+}
+
+// New creates the LLM provider selected by opts.Name
+func New(opts Options) (LLMProvider, error) {
+	name := strings.ToLower(opts.Name)
+	if name == "" {
+		name = DefaultProvider
+	}
+
+	registryMu.RLock()
+	constructor, ok := registry[name]
+	registryMu.RUnlock()
+	if !ok {
+		return nil, fmt.Errorf("%w %q, available: %s", ErrUnknownProvider, opts.Name, strings.Join(Names(), ", "))
+	}
+	return constructor(opts)
+}
+
+// Names returns all registered provider names in sorted order
+func Names() []string {
+	registryMu.RLock()
+	defer registryMu.RUnlock()
+
+	names := make([]string, 0, len(registry))
+	for name := range registry {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// lookupAPIKey reads the API key from the configured environment variable,
+// falling back to defaultEnv
+func lookupAPIKey(opts Options, defaultEnv string) (string, error) {
+	env := opts.APIKeyEnv
+	if env == "" {
+		env = defaultEnv
+	}
+	apiKey, exists := os.LookupEnv(env)
+	if !exists {
+		return "", fmt.Errorf("%s not found", env)
+	}
+	return apiKey, nil
+}
+
+func orDefault(value, def string) string {
+	if value == "" {
+		return def
+	}
+	return value
+}
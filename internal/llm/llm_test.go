@@ -0,0 +1,115 @@
+package llm
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// mockChatServer mimics the chat completions API, streaming the answer word
+// by word when asked to
+func mockChatServer(t *testing.T, answer []string) *httptest.Server {
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, "/v1/chat/completions", r.URL.Path)
+		assert.Equal(t, "Bearer test-key", r.Header.Get("Authorization"))
+
+		var req chatCompletionRequest
+		require.NoError(t, json.NewDecoder(r.Body).Decode(&req))
+		assert.Equal(t, "custom-model", req.Model)
+		assert.Equal(t, 128, req.MaxTokens)
+		require.Len(t, req.Messages, 1)
+
+		if !req.Stream {
+			var full string
+			for _, s := range answer {
+				full += s
+			}
+			fmt.Fprintf(w, `{"choices":[{"message":{"role":"assistant","content":%q}}]}`, full)
+			return
+		}
+		w.Header().Set("Content-Type", "text/event-stream")
+		for _, s := range answer {
+			fmt.Fprintf(w, "data: {\"choices\":[{\"delta\":{\"content\":%q}}]}\n\n", s)
+		}
+		fmt.Fprint(w, "data: [DONE]\n\n")
+	}))
+}
+
+func TestChatCompletionProvider(t *testing.T) {
+	server := mockChatServer(t, []string{"Oasis", "DB"})
+	defer server.Close()
+
+	t.Setenv("TEST_LLM_KEY", "test-key")
+	provider, err := New(Options{
+		Name:      OpenAIProvider,
+		APIKeyEnv: "TEST_LLM_KEY",
+		Model:     "custom-model",
+		BaseURL:   server.URL + "/v1/",
+		MaxTokens: 128,
+	})
+	require.NoError(t, err)
+
+	messages := []Message{{Role: "user", Content: "name?"}}
+	answer, err := provider.Chat(messages)
+	require.NoError(t, err)
+	assert.Equal(t, "OasisDB", answer)
+
+	var deltas []string
+	answer, err = provider.ChatStream(messages, func(delta string) error {
+		deltas = append(deltas, delta)
+		return nil
+	})
+	require.NoError(t, err)
+	assert.Equal(t, "OasisDB", answer)
+	assert.Equal(t, []string{"Oasis", "DB"}, deltas)
+
+	stop := errors.New("stop")
+	answer, err = provider.ChatStream(messages, func(string) error { return stop })
+	assert.ErrorIs(t, err, stop)
+	assert.Equal(t, "Oasis", answer)
+}
+
+func TestNewProvider(t *testing.T) {
+	_, err := New(Options{Name: "unknown"})
+	assert.ErrorIs(t, err, ErrUnknownProvider)
+
+	_, err = New(Options{Name: DashScopeProvider, APIKeyEnv: "TEST_LLM_KEY_MISSING"})
+	assert.Error(t, err)
+
+	t.Setenv("TEST_LLM_KEY", "test-key")
+	provider, err := New(Options{APIKeyEnv: "TEST_LLM_KEY"})
+	require.NoError(t, err)
+	p := provider.(*ChatCompletionProvider)
+	assert.Equal(t, DASHSCOPE_BASE_URL+"/chat/completions", p.apiURL)
+	assert.Equal(t, DASHSCOPE_MODEL, p.opts.Model)
+}
+
+func TestPrompt(t *testing.T) {
+	prompt, err := NewPrompt("{{.Context}}|{{.Question}}", 3)
+	require.NoError(t, err)
+
+	// each passage is about two tokens, so only the first one fits
+	text, err := prompt.Render("q", []string{"aaaaaaa", "bbbbbbb"})
+	require.NoError(t, err)
+	assert.Equal(t, "aaaaaaa|q", text)
+
+	unlimited, err := NewPrompt("", 0)
+	require.NoError(t, err)
+	messages, err := unlimited.Messages("What is OasisDB?", []string{"OasisDB is a vector database.", "It is written in Go."})
+	require.NoError(t, err)
+	require.Len(t, messages, 1)
+	assert.Contains(t, messages[0].Content, "OasisDB is a vector database.\n\nIt is written in Go.")
+	assert.Contains(t, messages[0].Content, "Question: What is OasisDB?")
+
+	_, err = NewPrompt("{{.Context", 0)
+	assert.Error(t, err)
+
+	assert.Equal(t, 2, EstimateTokens("abcdefg"))
+	assert.Equal(t, 3, EstimateTokens("向量库"))
+}
@@ -0,0 +1,158 @@
+package llm
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"time"
+)
+
+const (
+	OPENAI_MODEL       = "gpt-4o-mini"
+	OPENAI_BASE_URL    = "https://api.openai.com/v1"
+	OPENAI_API_KEY_ENV = "OPENAI_API_KEY"
+
+	DASHSCOPE_MODEL       = "qwen-plus"
+	DASHSCOPE_BASE_URL    = "https://dashscope.aliyuncs.com/compatible-mode/v1"
+	DASHSCOPE_API_KEY_ENV = "DASHSCOPE_API_KEY"
+)
+
+// ChatCompletionProvider talks to any OpenAI-compatible /chat/completions
+// endpoint, DashScope is served through its compatible mode
+type ChatCompletionProvider struct {
+	apiKey string
+	apiURL string
+	opts   Options
+	client *http.Client
+}
+
+func NewOpenAIProvider(opts Options) (LLMProvider, error) {
+	return newChatCompletionProvider(opts, OPENAI_API_KEY_ENV, OPENAI_BASE_URL, OPENAI_MODEL)
+}
+
+func NewDashScopeProvider(opts Options) (LLMProvider, error) {
+	return newChatCompletionProvider(opts, DASHSCOPE_API_KEY_ENV, DASHSCOPE_BASE_URL, DASHSCOPE_MODEL)
+}
+
+func newChatCompletionProvider(opts Options, keyEnv, baseURL, model string) (*ChatCompletionProvider, error) {
+	apiKey, err := lookupAPIKey(opts, keyEnv)
+	if err != nil {
+		return nil, err
+	}
+	opts.Model = orDefault(opts.Model, model)
+	return &ChatCompletionProvider{
+		apiKey: apiKey,
+		apiURL: strings.TrimSuffix(orDefault(opts.BaseURL, baseURL), "/") + "/chat/completions",
+		opts:   opts,
+		// no overall timeout, streamed answers may take long
+		client: &http.Client{Transport: &http.Transport{ResponseHeaderTimeout: 60 * time.Second}},
+	}, nil
+}
+
+type chatCompletionRequest struct {
+	Model       string    `json:"model"`
+	Messages    []Message `json:"messages"`
+	MaxTokens   int       `json:"max_tokens,omitempty"`
+	Temperature float64   `json:"temperature,omitempty"`
+	Stream      bool      `json:"stream,omitempty"`
+}
+
+type chatCompletionResponse struct {
+	Choices []struct {
+		Message Message `json:"message"`
+		Delta   Message `json:"delta"` // set when streaming
+	} `json:"choices"`
+}
+
+func (p *ChatCompletionProvider) Chat(messages []Message) (string, error) {
+	resp, err := p.post(messages, false)
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+
+	var completion chatCompletionResponse
+	if err := json.NewDecoder(resp.Body).Decode(&completion); err != nil {
+		return "", err
+	}
+	if len(completion.Choices) == 0 {
+		return "", errors.New("no completion returned")
+	}
+	return completion.Choices[0].Message.Content, nil
+}
+
+// ChatStream reads the server-sent events of a streamed completion
+func (p *ChatCompletionProvider) ChatStream(messages []Message, onDelta func(string) error) (string, error) {
+	resp, err := p.post(messages, true)
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+
+	var answer strings.Builder
+	scanner := bufio.NewScanner(resp.Body)
+	scanner.Buffer(make([]byte, 64*1024), 1024*1024)
+	for scanner.Scan() {
+		data, ok := strings.CutPrefix(scanner.Text(), "data:")
+		if !ok {
+			continue
+		}
+		data = strings.TrimSpace(data)
+		if data == "[DONE]" {
+			break
+		}
+
+		var chunk chatCompletionResponse
+		if err := json.Unmarshal([]byte(data), &chunk); err != nil {
+			return answer.String(), fmt.Errorf("invalid stream chunk: %w", err)
+		}
+		if len(chunk.Choices) == 0 || chunk.Choices[0].Delta.Content == "" {
+			continue
+		}
+		delta := chunk.Choices[0].Delta.Content
+		answer.WriteString(delta)
+		if err := onDelta(delta); err != nil {
+			return answer.String(), err
+		}
+	}
+	return answer.String(), scanner.Err()
+}
+
+func (p *ChatCompletionProvider) post(messages []Message, stream bool) (*http.Response, error) {
+	body, err := json.Marshal(&chatCompletionRequest{
+		Model:       p.opts.Model,
+		Messages:    messages,
+		MaxTokens:   p.opts.MaxTokens,
+		Temperature: p.opts.Temperature,
+		Stream:      stream,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	httpReq, err := http.NewRequest("POST", p.apiURL, bytes.NewBuffer(body))
+	if err != nil {
+		return nil, err
+	}
+	httpReq.Header.Set("Content-Type", "application/json")
+	httpReq.Header.Set("Authorization", fmt.Sprintf("Bearer %s", p.apiKey))
+	if stream {
+		httpReq.Header.Set("Accept", "text/event-stream")
+	}
+
+	resp, err := p.client.Do(httpReq)
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode != http.StatusOK {
+		defer resp.Body.Close()
+		respBody, _ := io.ReadAll(resp.Body)
+		return nil, fmt.Errorf("chat completions API returned status %d: %s", resp.StatusCode, string(respBody))
+	}
+	return resp, nil
+}
@@ -0,0 +1,78 @@
+package llm
+
+import (
+	"fmt"
+	"strings"
+	"text/template"
+	"unicode"
+)
+
+// DefaultPromptTemplate answers a question from retrieved passages, templates
+// see .Context (the passages joined by blank lines) and .Question
+const DefaultPromptTemplate = `Answer the question using only the context below. If the context does not contain the answer, say you don't know.
+
+Context:
+{{.Context}}
+
+Question: {{.Question}}`
+
+// Prompt renders retrieval-augmented prompts within a context token budget
+type Prompt struct {
+	tmpl             *template.Template
+	maxContextTokens int
+}
+
+// NewPrompt parses text, empty means DefaultPromptTemplate, maxContextTokens
+// limits the passages included in the context, 0 means unlimited
+func NewPrompt(text string, maxContextTokens int) (*Prompt, error) {
+	tmpl, err := template.New("prompt").Option("missingkey=error").Parse(orDefault(text, DefaultPromptTemplate))
+	if err != nil {
+		return nil, fmt.Errorf("invalid prompt template: %w", err)
+	}
+	return &Prompt{tmpl: tmpl, maxContextTokens: maxContextTokens}, nil
+}
+
+// Render fills the template with the question and as many passages, in
+// order of relevance, as fit in the context budget
+func (p *Prompt) Render(question string, passages []string) (string, error) {
+	var context []string
+	used := 0
+	for _, passage := range passages {
+		tokens := EstimateTokens(passage)
+		if p.maxContextTokens > 0 && used+tokens > p.maxContextTokens {
+			break
+		}
+		context = append(context, passage)
+		used += tokens
+	}
+
+	var b strings.Builder
+	err := p.tmpl.Execute(&b, struct {
+		Context  string
+		Question string
+	}{strings.Join(context, "\n\n"), question})
+	return b.String(), err
+}
+
+// Messages renders the prompt as a single user message
+func (p *Prompt) Messages(question string, passages []string) ([]Message, error) {
+	content, err := p.Render(question, passages)
+	if err != nil {
+		return nil, err
+	}
+	return []Message{{Role: "user", Content: content}}, nil
+}
+
+// EstimateTokens approximates the token count of text without a tokenizer,
+// about four characters per token for latin text and one per CJK character
+func EstimateTokens(text string) int {
+	cjk, other := 0, 0
+	for _, r := range text {
+		if unicode.In(r, unicode.Han, unicode.Hiragana, unicode.Katakana, unicode.Hangul) {
+			cjk++
+		} else {
+			other++
+		}
+	}
+	return cjk + (other+3)/4
+}
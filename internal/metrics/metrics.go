@@ -0,0 +1,88 @@
+package metrics
+
+import (
+	"sort"
+	"sync"
+)
+
+// Summary aggregates the observations of one metric
+type Summary struct {
+	Count int64   `json:"count"`
+	Sum   float64 `json:"sum"`
+	Min   float64 `json:"min"`
+	Max   float64 `json:"max"`
+	Last  float64 `json:"last"`
+}
+
+// Mean returns the average observed value
+func (s Summary) Mean() float64 {
+	if s.Count == 0 {
+		return 0
+	}
+	return s.Sum / float64(s.Count)
+}
+
+// Registry holds named summaries, it is safe for concurrent use
+type Registry struct {
+	mu        sync.RWMutex
+	summaries map[string]*Summary
+}
+
+// NewRegistry creates an empty registry
+func NewRegistry() *Registry {
+	return &Registry{summaries: make(map[string]*Summary)}
+}
+
+// Observe records a value for the named metric
+func (r *Registry) Observe(name string, value float64) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	s, ok := r.summaries[name]
+	if !ok {
+		s = &Summary{Min: value, Max: value}
+		r.summaries[name] = s
+	}
+	s.Count++
+	s.Sum += value
+	s.Last = value
+	s.Min = min(s.Min, value)
+	s.Max = max(s.Max, value)
+}
+
+// Get returns the summary of the named metric
+func (r *Registry) Get(name string) (Summary, bool) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	s, ok := r.summaries[name]
+	if !ok {
+		return Summary{}, false
+	}
+	return *s, true
+}
+
+// Names returns all metric names in sorted order
+func (r *Registry) Names() []string {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	names := make([]string, 0, len(r.summaries))
+	for name := range r.summaries {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// Snapshot returns a copy of all summaries
+func (r *Registry) Snapshot() map[string]Summary {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	snapshot := make(map[string]Summary, len(r.summaries))
+	for name, s := range r.summaries {
+		snapshot[name] = *s
+	}
+	return snapshot
+}
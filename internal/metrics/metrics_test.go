@@ -0,0 +1,48 @@
+package metrics
+
+import (
+	"sync"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRegistryObserve(t *testing.T) {
+	r := NewRegistry()
+	_, ok := r.Get("missing")
+	assert.False(t, ok)
+
+	r.Observe("recall", 0.5)
+	r.Observe("recall", 1)
+	r.Observe("latency", 3)
+
+	s, ok := r.Get("recall")
+	assert.True(t, ok)
+	assert.Equal(t, int64(2), s.Count)
+	assert.Equal(t, 0.5, s.Min)
+	assert.Equal(t, 1.0, s.Max)
+	assert.Equal(t, 1.0, s.Last)
+	assert.Equal(t, 0.75, s.Mean())
+
+	assert.Equal(t, []string{"latency", "recall"}, r.Names())
+	assert.Len(t, r.Snapshot(), 2)
+	assert.Equal(t, 0.0, Summary{}.Mean())
+}
+
+func TestRegistryConcurrentObserve(t *testing.T) {
+	r := NewRegistry()
+	var wg sync.WaitGroup
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for j := 0; j < 100; j++ {
+				r.Observe("count", 1)
+			}
+		}()
+	}
+	wg.Wait()
+
+	s, _ := r.Get("count")
+	assert.Equal(t, int64(1000), s.Count)
+}
@@ -0,0 +1,422 @@
+// Package proxy routes the API of OasisDB over a static list of nodes, so a
+// deployment can grow beyond one machine. Collections are placed on nodes by
+// consistent hashing of their names. A collection may be spread over several
+// nodes, its documents are then partitioned by ID and searches are sent to
+// all of them and merged
+package proxy
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"hash/fnv"
+	"io"
+	"net/http"
+	"net/http/httputil"
+	"net/url"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+const (
+	defaultVirtualNodes = 100
+	defaultTimeout      = 60 * time.Second
+
+	// tenantHeader is the header the server reads the tenant from, tenants
+	// have collections of the same name placed independently
+	tenantHeader = "X-Tenant"
+)
+
+// Options configures a proxy
+type Options struct {
+	Nodes        []string     // API addresses of the nodes, e.g. "http://10.0.0.1:8080"
+	Spread       int          // nodes the documents of each collection are partitioned over, 0 means 1
+	VirtualNodes int          // points of each node on the hash ring, 0 means 100
+	Client       *http.Client // client of the requests to the nodes, nil means a default one
+}
+
+// Proxy is an HTTP handler routing the API to the nodes
+type Proxy struct {
+	ring    *ring
+	spread  int
+	client  *http.Client
+	proxies map[string]*httputil.ReverseProxy
+	router  *gin.Engine
+}
+
+// New returns a proxy of the nodes. The node list must be the same whenever
+// the proxy is started, a node added or removed moves collections
+func New(opts Options) (*Proxy, error) {
+	if len(opts.Nodes) == 0 {
+		return nil, fmt.Errorf("at least one node is required")
+	}
+	if opts.Spread <= 0 {
+		opts.Spread = 1
+	}
+	if opts.Spread > len(opts.Nodes) {
+		return nil, fmt.Errorf("spread %d is larger than the %d nodes", opts.Spread, len(opts.Nodes))
+	}
+	if opts.VirtualNodes <= 0 {
+		opts.VirtualNodes = defaultVirtualNodes
+	}
+	if opts.Client == nil {
+		opts.Client = &http.Client{Timeout: defaultTimeout}
+	}
+
+	p := &Proxy{
+		ring:    newRing(opts.Nodes, opts.VirtualNodes),
+		spread:  opts.Spread,
+		client:  opts.Client,
+		proxies: make(map[string]*httputil.ReverseProxy, len(opts.Nodes)),
+		router:  gin.New(),
+	}
+	for _, node := range opts.Nodes {
+		target, err := url.Parse(node)
+		if err != nil || target.Scheme == "" || target.Host == "" {
+			return nil, fmt.Errorf("invalid node address %q", node)
+		}
+		proxy := httputil.NewSingleHostReverseProxy(target)
+		proxy.ErrorHandler = func(w http.ResponseWriter, r *http.Request, err error) {
+			writeJSON(w, http.StatusBadGateway, gin.H{"error": fmt.Sprintf("node %s: %v", node, err)})
+		}
+		p.proxies[node] = proxy
+	}
+	p.router.Use(gin.Recovery())
+	p.setupRoutes()
+	return p, nil
+}
+
+// Handler returns the HTTP handler of the proxy
+func (p *Proxy) Handler() http.Handler {
+	return p.router
+}
+
+func (p *Proxy) setupRoutes() {
+	p.router.GET("/", p.handleHealthCheck)
+	p.router.GET("/v1/collections", p.handleListCollections)
+	p.router.POST("/v1/collections", p.handleCreateCollection)
+
+	p.router.GET("/v1/collections/:name", p.primary)
+	p.router.DELETE("/v1/collections/:name", p.spreadOr(p.broadcast))
+	p.router.POST("/v1/collections/:name/buildindex", p.spreadOr(p.splitDocuments))
+	p.router.POST("/v1/collections/:name/rebuild", p.spreadOr(p.broadcast))
+	p.router.POST("/v1/collections/:name/vacuum", p.spreadOr(p.broadcast))
+	p.router.GET("/v1/collections/:name/clusters", p.spreadOr(p.broadcast))
+	p.router.GET("/v1/collections/:name/usage", p.spreadOr(p.broadcast))
+	p.router.POST("/v1/collections/:name/archive", p.spreadOr(p.broadcast))
+
+	p.router.POST("/v1/collections/:name/documents", p.spreadOr(p.byBodyID))
+	p.router.POST("/v1/collections/:name/documents/setparams", p.spreadOr(p.broadcast))
+	p.router.GET("/v1/collections/:name/documents/:id", p.spreadOr(p.byPathID))
+	p.router.DELETE("/v1/collections/:name/documents/:id", p.spreadOr(p.byPathID))
+	p.router.POST("/v1/collections/:name/documents/:id/restore", p.spreadOr(p.byPathID))
+	p.router.POST("/v1/collections/:name/vectors/search", p.spreadOr(p.search))
+	p.router.POST("/v1/collections/:name/documents/search", p.spreadOr(p.search))
+	p.router.POST("/v1/collections/:name/documents/batchupsert", p.spreadOr(p.splitDocuments))
+	// chunk IDs are derived from the parent ID, and a cursor is per node
+	p.router.POST("/v1/collections/:name/documents/ingest", p.spreadOr(notSpread))
+	p.router.POST("/v1/collections/:name/scroll", p.spreadOr(notSpread))
+}
+
+// collectionNodes returns the nodes of a collection of the request tenant
+func (p *Proxy) collectionNodes(c *gin.Context, name string) []string {
+	key := name
+	if tenant := c.GetHeader(tenantHeader); tenant != "" {
+		key = tenant + "/" + name
+	}
+	return p.ring.owners(key, p.spread)
+}
+
+// documentNode returns the node of a document among the nodes of its
+// collection
+func documentNode(nodes []string, id string) string {
+	h := fnv.New32a()
+	h.Write([]byte(id))
+	return nodes[h.Sum32()%uint32(len(nodes))]
+}
+
+// spreadOr forwards requests to the node of the collection, handler handles
+// them when collections are spread over several nodes
+func (p *Proxy) spreadOr(handler gin.HandlerFunc) gin.HandlerFunc {
+	if p.spread == 1 {
+		return p.primary
+	}
+	return handler
+}
+
+// primary forwards a request to the first node of its collection
+func (p *Proxy) primary(c *gin.Context) {
+	p.forward(c, p.collectionNodes(c, c.Param("name"))[0])
+}
+
+func (p *Proxy) forward(c *gin.Context, node string) {
+	p.proxies[node].ServeHTTP(c.Writer, c.Request)
+}
+
+func (p *Proxy) byPathID(c *gin.Context) {
+	p.forward(c, documentNode(p.collectionNodes(c, c.Param("name")), c.Param("id")))
+}
+
+func (p *Proxy) byBodyID(c *gin.Context) {
+	body, err := io.ReadAll(c.Request.Body)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	var doc struct {
+		ID string `json:"id"`
+	}
+	if err := json.Unmarshal(body, &doc); err != nil || doc.ID == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "a document with an id is required"})
+		return
+	}
+	c.Request.Body = io.NopCloser(bytes.NewReader(body))
+	p.forward(c, documentNode(p.collectionNodes(c, c.Param("name")), doc.ID))
+}
+
+func notSpread(c *gin.Context) {
+	c.JSON(http.StatusNotImplemented, gin.H{"error": "not supported on collections spread over several nodes"})
+}
+
+// nodeResponse is the answer of a node to a request the proxy sent
+type nodeResponse struct {
+	node   string
+	status int
+	body   []byte
+	err    error
+}
+
+func (r *nodeResponse) ok() bool {
+	return r.err == nil && r.status >= 200 && r.status < 300
+}
+
+// send sends the request to each node with the body of that node, all at
+// once
+func (p *Proxy) send(c *gin.Context, nodes []string, bodies [][]byte) []*nodeResponse {
+	responses := make([]*nodeResponse, len(nodes))
+	var wg sync.WaitGroup
+	for i, node := range nodes {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			responses[i] = p.do(c, node, bodies[i])
+		}()
+	}
+	wg.Wait()
+	return responses
+}
+
+func (p *Proxy) do(c *gin.Context, node string, body []byte) *nodeResponse {
+	resp := &nodeResponse{node: node}
+	req, err := http.NewRequestWithContext(c.Request.Context(), c.Request.Method, node+c.Request.URL.RequestURI(), bytes.NewReader(body))
+	if err != nil {
+		resp.err = err
+		return resp
+	}
+	req.Header = c.Request.Header.Clone()
+	req.Header.Del("Content-Length")
+	res, err := p.client.Do(req)
+	if err != nil {
+		resp.err = err
+		return resp
+	}
+	defer res.Body.Close()
+	resp.status = res.StatusCode
+	resp.body, resp.err = io.ReadAll(res.Body)
+	return resp
+}
+
+// failed answers with the first failed response, if any
+func failed(c *gin.Context, responses []*nodeResponse) bool {
+	for _, resp := range responses {
+		if resp.err != nil {
+			c.JSON(http.StatusBadGateway, gin.H{"error": fmt.Sprintf("node %s: %v", resp.node, resp.err)})
+			return true
+		}
+		if !resp.ok() {
+			c.Data(resp.status, "application/json", resp.body)
+			return true
+		}
+	}
+	return false
+}
+
+// combine answers with the response all nodes agree on, or with the
+// responses of all nodes by address
+func combine(c *gin.Context, responses []*nodeResponse) {
+	if failed(c, responses) {
+		return
+	}
+	same := true
+	for _, resp := range responses[1:] {
+		same = same && bytes.Equal(resp.body, responses[0].body)
+	}
+	if same {
+		c.Data(responses[0].status, "application/json", responses[0].body)
+		return
+	}
+	nodes := make(map[string]json.RawMessage, len(responses))
+	for _, resp := range responses {
+		if len(resp.body) == 0 {
+			nodes[resp.node] = json.RawMessage("null")
+		} else {
+			nodes[resp.node] = resp.body
+		}
+	}
+	c.JSON(http.StatusOK, gin.H{"nodes": nodes})
+}
+
+// broadcast sends a request to all nodes of the collection
+func (p *Proxy) broadcast(c *gin.Context) {
+	body, err := io.ReadAll(c.Request.Body)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	nodes := p.collectionNodes(c, c.Param("name"))
+	bodies := make([][]byte, len(nodes))
+	for i := range bodies {
+		bodies[i] = body
+	}
+	combine(c, p.send(c, nodes, bodies))
+}
+
+// splitDocuments sends each node of the collection the documents of a batch
+// that belong to it. A failed node leaves the batch partially written
+func (p *Proxy) splitDocuments(c *gin.Context) {
+	if c.ContentType() != "application/json" && c.ContentType() != "" {
+		c.JSON(http.StatusUnsupportedMediaType, gin.H{"error": "spread collections only take JSON batches"})
+		return
+	}
+	var req map[string]json.RawMessage
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	var docs []json.RawMessage
+	if err := json.Unmarshal(req["documents"], &docs); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "documents must be a list"})
+		return
+	}
+
+	nodes := p.collectionNodes(c, c.Param("name"))
+	groups := make(map[string][]json.RawMessage, len(nodes))
+	for i, doc := range docs {
+		var d struct {
+			ID string `json:"id"`
+		}
+		if err := json.Unmarshal(doc, &d); err != nil || d.ID == "" {
+			c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("document %d has no id", i)})
+			return
+		}
+		node := documentNode(nodes, d.ID)
+		groups[node] = append(groups[node], doc)
+	}
+
+	var targets []string
+	var bodies [][]byte
+	for _, node := range nodes {
+		if len(groups[node]) == 0 {
+			continue
+		}
+		nodeReq := make(map[string]json.RawMessage, len(req))
+		for k, v := range req {
+			nodeReq[k] = v
+		}
+		nodeReq["documents"], _ = json.Marshal(groups[node])
+		body, err := json.Marshal(nodeReq)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+		targets = append(targets, node)
+		bodies = append(bodies, body)
+	}
+	if len(targets) == 0 {
+		c.Status(http.StatusOK)
+		return
+	}
+	combine(c, p.send(c, targets, bodies))
+}
+
+// handleCreateCollection creates a collection on all of its nodes
+func (p *Proxy) handleCreateCollection(c *gin.Context) {
+	body, err := io.ReadAll(c.Request.Body)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	var req struct {
+		Name string `json:"name"`
+	}
+	if err := json.Unmarshal(body, &req); err != nil || req.Name == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "collection name is required"})
+		return
+	}
+	nodes := p.collectionNodes(c, req.Name)
+	bodies := make([][]byte, len(nodes))
+	for i := range bodies {
+		bodies[i] = body
+	}
+	responses := p.send(c, nodes, bodies)
+	if !failed(c, responses) {
+		c.Data(responses[0].status, "application/json", responses[0].body)
+	}
+}
+
+// handleListCollections lists the collections of all nodes
+func (p *Proxy) handleListCollections(c *gin.Context) {
+	responses := p.send(c, p.ring.nodes, make([][]byte, len(p.ring.nodes)))
+	if failed(c, responses) {
+		return
+	}
+	seen := map[string]bool{}
+	collections := []string{}
+	for _, resp := range responses {
+		var list struct {
+			Collections []string `json:"collections"`
+		}
+		if err := json.Unmarshal(resp.body, &list); err != nil {
+			c.JSON(http.StatusBadGateway, gin.H{"error": fmt.Sprintf("node %s: %v", resp.node, err)})
+			return
+		}
+		for _, name := range list.Collections {
+			if !seen[name] {
+				seen[name] = true
+				collections = append(collections, name)
+			}
+		}
+	}
+	sort.Strings(collections)
+	c.JSON(http.StatusOK, gin.H{"collections": collections, "count": len(collections)})
+}
+
+// handleHealthCheck reports the health of every node, 503 when one is down
+func (p *Proxy) handleHealthCheck(c *gin.Context) {
+	responses := p.send(c, p.ring.nodes, make([][]byte, len(p.ring.nodes)))
+	status := http.StatusOK
+	nodes := make(map[string]string, len(responses))
+	for _, resp := range responses {
+		switch {
+		case resp.err != nil:
+			nodes[resp.node] = resp.err.Error()
+			status = http.StatusServiceUnavailable
+		case !resp.ok():
+			nodes[resp.node] = http.StatusText(resp.status)
+			status = http.StatusServiceUnavailable
+		default:
+			nodes[resp.node] = "ok"
+		}
+	}
+	c.JSON(status, gin.H{"nodes": nodes})
+}
+
+func writeJSON(w http.ResponseWriter, status int, v any) {
+	body, _ := json.Marshal(v)
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	w.Write(body)
+}
@@ -0,0 +1,199 @@
+package proxy
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"sort"
+	"testing"
+
+	"oasisdb/internal/config"
+	"oasisdb/internal/db"
+	"oasisdb/internal/server"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRing(t *testing.T) {
+	nodes := []string{"http://a", "http://b", "http://c"}
+	r := newRing(nodes, 100)
+
+	counts := map[string]int{}
+	for i := 0; i < 3000; i++ {
+		owners := r.owners(fmt.Sprintf("collection_%d", i), 2)
+		assert.Len(t, owners, 2)
+		assert.NotEqual(t, owners[0], owners[1])
+		counts[owners[0]]++
+	}
+	for _, node := range nodes {
+		assert.Greater(t, counts[node], 600, "node %s owns too few keys", node)
+	}
+	assert.Len(t, r.owners("x", 10), 3)
+
+	// a new node only takes keys over, the others stay in place
+	grown := newRing(append(nodes, "http://d"), 100)
+	for i := 0; i < 1000; i++ {
+		key := fmt.Sprintf("collection_%d", i)
+		if owner := grown.owners(key, 1)[0]; owner != "http://d" {
+			assert.Equal(t, r.owners(key, 1)[0], owner)
+		}
+	}
+}
+
+// setupCluster starts nodes OasisDB servers behind a proxy
+func setupCluster(t *testing.T, nodes, spread int) (*httptest.Server, []*db.DB) {
+	var addrs []string
+	var dbs []*db.DB
+	for i := 0; i < nodes; i++ {
+		tmpDir, err := os.MkdirTemp("", "oasisdb_proxy_test_*")
+		assert.NoError(t, err)
+		conf, err := config.NewConfig(tmpDir)
+		assert.NoError(t, err)
+		d, err := db.New(conf)
+		assert.NoError(t, err)
+		assert.NoError(t, d.Open())
+		ts := httptest.NewServer(server.New(d).Handler())
+		t.Cleanup(func() {
+			ts.Close()
+			d.Close()
+			os.RemoveAll(tmpDir)
+		})
+		addrs = append(addrs, ts.URL)
+		dbs = append(dbs, d)
+	}
+	p, err := New(Options{Nodes: addrs, Spread: spread})
+	assert.NoError(t, err)
+	ts := httptest.NewServer(p.Handler())
+	t.Cleanup(ts.Close)
+	return ts, dbs
+}
+
+func request(t *testing.T, method, url string, body any) (int, map[string]any) {
+	var reader *bytes.Reader
+	if body != nil {
+		data, err := json.Marshal(body)
+		assert.NoError(t, err)
+		reader = bytes.NewReader(data)
+	} else {
+		reader = bytes.NewReader(nil)
+	}
+	req, err := http.NewRequest(method, url, reader)
+	assert.NoError(t, err)
+	req.Header.Set("Content-Type", "application/json")
+	resp, err := http.DefaultClient.Do(req)
+	assert.NoError(t, err)
+	defer resp.Body.Close()
+	var result map[string]any
+	json.NewDecoder(resp.Body).Decode(&result)
+	return resp.StatusCode, result
+}
+
+func TestProxyPlacesCollections(t *testing.T) {
+	ts, dbs := setupCluster(t, 3, 1)
+
+	code, _ := request(t, http.MethodGet, ts.URL+"/", nil)
+	assert.Equal(t, http.StatusOK, code)
+
+	names := []string{"alpha", "beta", "gamma", "delta", "epsilon", "zeta"}
+	for _, name := range names {
+		code, _ := request(t, http.MethodPost, ts.URL+"/v1/collections", map[string]any{
+			"name": name, "index_type": "flat", "dimension": 2,
+		})
+		assert.Equal(t, http.StatusOK, code)
+		code, _ = request(t, http.MethodPost, ts.URL+"/v1/collections/"+name+"/documents", map[string]any{
+			"id": "doc", "vector": []float32{1, 2}, "dimension": 2,
+		})
+		assert.Equal(t, http.StatusOK, code)
+	}
+
+	// every collection lives on exactly one node
+	for _, name := range names {
+		found := 0
+		for _, d := range dbs {
+			if _, err := d.GetCollection(name); err == nil {
+				found++
+			}
+		}
+		assert.Equal(t, 1, found, "collection %s", name)
+	}
+
+	code, body := request(t, http.MethodGet, ts.URL+"/v1/collections", nil)
+	assert.Equal(t, http.StatusOK, code)
+	sort.Strings(names)
+	var listed []string
+	for _, name := range body["collections"].([]any) {
+		listed = append(listed, name.(string))
+	}
+	assert.Equal(t, names, listed)
+
+	code, body = request(t, http.MethodGet, ts.URL+"/v1/collections/beta/documents/doc", nil)
+	assert.Equal(t, http.StatusOK, code)
+	assert.Equal(t, "doc", body["id"])
+
+	code, _ = request(t, http.MethodGet, ts.URL+"/v1/collections/missing", nil)
+	assert.Equal(t, http.StatusNotFound, code)
+}
+
+func TestProxySpreadSearch(t *testing.T) {
+	ts, dbs := setupCluster(t, 3, 3)
+
+	code, _ := request(t, http.MethodPost, ts.URL+"/v1/collections", map[string]any{
+		"name": "spread", "index_type": "flat", "dimension": 2,
+	})
+	assert.Equal(t, http.StatusOK, code)
+
+	docs := make([]map[string]any, 30)
+	for i := range docs {
+		docs[i] = map[string]any{
+			"id": fmt.Sprintf("doc_%02d", i), "vector": []float32{float32(i), 0}, "dimension": 2,
+			"parameters": map[string]any{"i": i},
+		}
+	}
+	code, _ = request(t, http.MethodPost, ts.URL+"/v1/collections/spread/documents/batchupsert", map[string]any{"documents": docs})
+	assert.Equal(t, http.StatusOK, code)
+
+	// documents are partitioned, not copied
+	stored := 0
+	for _, d := range dbs {
+		for _, doc := range docs {
+			if _, err := d.GetDocument("spread", doc["id"].(string)); err == nil {
+				stored++
+			}
+		}
+	}
+	assert.Equal(t, len(docs), stored)
+
+	code, body := request(t, http.MethodPost, ts.URL+"/v1/collections/spread/vectors/search", map[string]any{
+		"vector": []float32{0, 0}, "limit": 4, "offset": 2,
+	})
+	assert.Equal(t, http.StatusOK, code)
+	assert.Equal(t, []any{"doc_02", "doc_03", "doc_04", "doc_05"}, body["ids"])
+
+	code, body = request(t, http.MethodPost, ts.URL+"/v1/collections/spread/documents/search", map[string]any{
+		"vector": []float32{10, 0}, "limit": 3,
+	})
+	assert.Equal(t, http.StatusOK, code)
+	results := body["documents"].([]any)
+	assert.Len(t, results, 3)
+	assert.Equal(t, "doc_10", results[0].(map[string]any)["id"])
+	assert.Equal(t, []any{0.0, 1.0, 1.0}, body["distances"])
+
+	code, body = request(t, http.MethodGet, ts.URL+"/v1/collections/spread/documents/doc_07", nil)
+	assert.Equal(t, http.StatusOK, code)
+	assert.Equal(t, "doc_07", body["id"])
+
+	code, _ = request(t, http.MethodPost, ts.URL+"/v1/collections/spread/documents/search", map[string]any{
+		"vector": []float32{0, 0}, "limit": 3, "rerank": map[string]any{"type": "mmr"},
+	})
+	assert.Equal(t, http.StatusBadRequest, code)
+
+	code, _ = request(t, http.MethodDelete, ts.URL+"/v1/collections/spread", nil)
+	assert.Equal(t, http.StatusOK, code)
+	for _, d := range dbs {
+		_, err := d.GetCollection("spread")
+		assert.Error(t, err)
+	}
+}
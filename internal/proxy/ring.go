@@ -0,0 +1,64 @@
+package proxy
+
+import (
+	"hash/fnv"
+	"sort"
+	"strconv"
+)
+
+// ring places keys on nodes by consistent hashing. Every node owns several
+// points of the ring, a key belongs to the node of the first point at or
+// after its hash, so adding a node only moves the keys it takes over
+type ring struct {
+	nodes  []string
+	points []uint64 // sorted hashes of the virtual nodes
+	owner  []int    // node of each point
+}
+
+// hash64 is fnv64a followed by the splitmix64 finalizer, fnv alone keeps
+// keys differing in their last bytes close on the ring
+func hash64(key string) uint64 {
+	h := fnv.New64a()
+	h.Write([]byte(key))
+	x := h.Sum64()
+	x = (x ^ (x >> 30)) * 0xbf58476d1ce4e5b9
+	x = (x ^ (x >> 27)) * 0x94d049bb133111eb
+	return x ^ (x >> 31)
+}
+
+func newRing(nodes []string, virtualNodes int) *ring {
+	r := &ring{nodes: nodes}
+	type point struct {
+		hash uint64
+		node int
+	}
+	points := make([]point, 0, len(nodes)*virtualNodes)
+	for i, node := range nodes {
+		for v := 0; v < virtualNodes; v++ {
+			points = append(points, point{hash64(node + "#" + strconv.Itoa(v)), i})
+		}
+	}
+	sort.Slice(points, func(i, j int) bool { return points[i].hash < points[j].hash })
+	for _, p := range points {
+		r.points = append(r.points, p.hash)
+		r.owner = append(r.owner, p.node)
+	}
+	return r
+}
+
+// owners returns the n distinct nodes following key on the ring, the first
+// one is its primary owner
+func (r *ring) owners(key string, n int) []string {
+	n = min(n, len(r.nodes))
+	start := sort.Search(len(r.points), func(i int) bool { return r.points[i] >= hash64(key) })
+	owners := make([]string, 0, n)
+	seen := make(map[int]bool, n)
+	for i := 0; len(owners) < n; i++ {
+		node := r.owner[(start+i)%len(r.points)]
+		if !seen[node] {
+			seen[node] = true
+			owners = append(owners, r.nodes[node])
+		}
+	}
+	return owners
+}
@@ -0,0 +1,153 @@
+package proxy
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sort"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+)
+
+// searchResponse is the answer of a node to a vector or document search
+type searchResponse struct {
+	IDs       []string          `json:"ids,omitempty"`
+	Documents []json.RawMessage `json:"documents,omitempty"`
+	Distances []float32         `json:"distances"`
+	Total     int               `json:"total_candidates"`
+}
+
+// hit is a result of one node
+type hit struct {
+	id       string
+	distance float32
+	document json.RawMessage // nil for vector searches
+}
+
+// search sends a search to all nodes of the collection and merges their
+// results by distance. Every node returns its own first limit+offset
+// results, the page is cut from the merged list
+func (p *Proxy) search(c *gin.Context) {
+	if c.ContentType() != "application/json" && c.ContentType() != "" {
+		c.JSON(http.StatusUnsupportedMediaType, gin.H{"error": "spread collections only take JSON searches"})
+		return
+	}
+	var req map[string]json.RawMessage
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if rerank, ok := req["rerank"]; ok && string(rerank) != "null" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "rerank is not supported on collections spread over several nodes"})
+		return
+	}
+	var limit, offset int
+	if err := unmarshalInt(req, "limit", &limit); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if err := unmarshalInt(req, "offset", &offset); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if limit < 0 || offset < 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "limit and offset must not be negative"})
+		return
+	}
+	if limit > 0 {
+		// limit 0 returns every result within max_distance, the offset is
+		// applied after the merge either way
+		req["limit"], _ = json.Marshal(limit + offset)
+	}
+	delete(req, "offset")
+	body, err := json.Marshal(req)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	nodes := p.collectionNodes(c, c.Param("name"))
+	bodies := make([][]byte, len(nodes))
+	for i := range bodies {
+		bodies[i] = body
+	}
+	responses := p.send(c, nodes, bodies)
+	if failed(c, responses) {
+		return
+	}
+
+	documents := strings.HasSuffix(c.FullPath(), "/documents/search")
+	var hits []hit
+	total := 0
+	for _, resp := range responses {
+		var result searchResponse
+		if err := json.Unmarshal(resp.body, &result); err != nil {
+			c.JSON(http.StatusBadGateway, gin.H{"error": fmt.Sprintf("node %s: %v", resp.node, err)})
+			return
+		}
+		total += result.Total
+		for i, distance := range result.Distances {
+			h := hit{distance: distance}
+			if documents {
+				var doc struct {
+					ID string `json:"id"`
+				}
+				if i >= len(result.Documents) || json.Unmarshal(result.Documents[i], &doc) != nil {
+					c.JSON(http.StatusBadGateway, gin.H{"error": fmt.Sprintf("node %s returned malformed documents", resp.node)})
+					return
+				}
+				h.id, h.document = doc.ID, result.Documents[i]
+			} else {
+				if i >= len(result.IDs) {
+					c.JSON(http.StatusBadGateway, gin.H{"error": fmt.Sprintf("node %s returned malformed ids", resp.node)})
+					return
+				}
+				h.id = result.IDs[i]
+			}
+			hits = append(hits, h)
+		}
+	}
+
+	sort.Slice(hits, func(i, j int) bool {
+		if hits[i].distance != hits[j].distance {
+			return hits[i].distance < hits[j].distance
+		}
+		return hits[i].id < hits[j].id
+	})
+	hits = hits[min(offset, len(hits)):]
+	if limit > 0 {
+		hits = hits[:min(limit, len(hits))]
+	}
+
+	distances := make([]float32, len(hits))
+	for i, h := range hits {
+		distances[i] = h.distance
+	}
+	response := gin.H{"distances": distances, "total_candidates": total}
+	if documents {
+		docs := make([]json.RawMessage, len(hits))
+		for i, h := range hits {
+			docs[i] = h.document
+		}
+		response["documents"] = docs
+	} else {
+		ids := make([]string, len(hits))
+		for i, h := range hits {
+			ids[i] = h.id
+		}
+		response["ids"] = ids
+	}
+	c.JSON(http.StatusOK, response)
+}
+
+func unmarshalInt(req map[string]json.RawMessage, key string, v *int) error {
+	raw, ok := req[key]
+	if !ok || string(raw) == "null" {
+		return nil
+	}
+	if err := json.Unmarshal(raw, v); err != nil {
+		return fmt.Errorf("%s must be an integer", key)
+	}
+	return nil
+}
@@ -0,0 +1,198 @@
+package replication
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"oasisdb/pkg/logger"
+)
+
+const (
+	// StreamPath is the leader endpoint followers fetch entries from
+	StreamPath = "/v1/replication/stream"
+
+	streamBatchSize = 1000
+	streamWait      = 5 * time.Second
+	retryInterval   = time.Second
+)
+
+// Applier applies replicated entries on a follower
+type Applier interface {
+	ApplyReplicated(entry *Entry) error
+}
+
+// FollowerStatus describes how far a follower is behind its leader
+type FollowerStatus struct {
+	Leader      string    `json:"leader"`
+	Epoch       string    `json:"epoch"`
+	AppliedSeq  uint64    `json:"applied_seq"`
+	LeaderSeq   uint64    `json:"leader_seq"`
+	LagEntries  uint64    `json:"lag_entries"`
+	LagSeconds  float64   `json:"lag_seconds"` // age of the last applied write while more are pending
+	LastContact time.Time `json:"last_contact"`
+	Error       string    `json:"error,omitempty"`
+}
+
+// followerState is the position of a follower, persisted across restarts
+type followerState struct {
+	Epoch      string `json:"epoch"`
+	AppliedSeq uint64 `json:"applied_seq"`
+}
+
+// Follower fetches the writes of a leader and applies them in order. Entries
+// are applied at least once, a restart may apply the last batch again
+type Follower struct {
+	leader    string
+	name      string
+	statePath string
+	applier   Applier
+	client    *http.Client
+
+	mu     sync.Mutex
+	status FollowerStatus
+}
+
+// NewFollower returns a follower of the leader at addr, e.g.
+// "http://10.0.0.1:8080", whose position is kept in statePath
+func NewFollower(addr, statePath string, applier Applier) (*Follower, error) {
+	f := &Follower{
+		leader:    strings.TrimSuffix(addr, "/"),
+		statePath: statePath,
+		applier:   applier,
+		client:    &http.Client{Timeout: streamWait + 30*time.Second},
+	}
+	f.name, _ = os.Hostname()
+	f.status.Leader = f.leader
+
+	data, err := os.ReadFile(statePath)
+	if err != nil && !os.IsNotExist(err) {
+		return nil, fmt.Errorf("failed to read replication state: %w", err)
+	}
+	if err == nil {
+		var state followerState
+		if err := json.Unmarshal(data, &state); err != nil {
+			return nil, fmt.Errorf("invalid replication state: %w", err)
+		}
+		f.status.Epoch, f.status.AppliedSeq = state.Epoch, state.AppliedSeq
+	}
+	return f, nil
+}
+
+// Run fetches and applies entries until stop is closed
+func (f *Follower) Run(stop <-chan struct{}) {
+	ctx, cancel := context.WithCancel(context.Background())
+	go func() {
+		<-stop
+		cancel()
+	}()
+
+	for ctx.Err() == nil {
+		err := f.poll(ctx)
+		if err == nil || ctx.Err() != nil {
+			continue
+		}
+		f.mu.Lock()
+		f.status.Error = err.Error()
+		f.mu.Unlock()
+		logger.Warn("Failed to replicate from leader", "leader", f.leader, "error", err)
+		select {
+		case <-ctx.Done():
+		case <-time.After(retryInterval):
+		}
+	}
+}
+
+// poll fetches one batch of entries and applies it
+func (f *Follower) poll(ctx context.Context) error {
+	f.mu.Lock()
+	epoch, applied := f.status.Epoch, f.status.AppliedSeq
+	f.mu.Unlock()
+
+	query := url.Values{}
+	query.Set("from", strconv.FormatUint(applied+1, 10))
+	query.Set("epoch", epoch)
+	query.Set("limit", strconv.Itoa(streamBatchSize))
+	query.Set("wait_ms", strconv.FormatInt(streamWait.Milliseconds(), 10))
+	query.Set("follower", f.name)
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, f.leader+StreamPath+"?"+query.Encode(), nil)
+	if err != nil {
+		return err
+	}
+	resp, err := f.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode == http.StatusGone {
+		return ErrResync
+	}
+	if resp.StatusCode != http.StatusOK {
+		body, _ := io.ReadAll(io.LimitReader(resp.Body, 1024))
+		return fmt.Errorf("leader responded %s: %s", resp.Status, strings.TrimSpace(string(body)))
+	}
+	var batch Batch
+	if err := json.NewDecoder(resp.Body).Decode(&batch); err != nil {
+		return fmt.Errorf("invalid batch from leader: %w", err)
+	}
+
+	for i := range batch.Entries {
+		entry := &batch.Entries[i]
+		if err := f.applier.ApplyReplicated(entry); err != nil {
+			// like a WAL replay, a failed entry doesn't stop the ones after it
+			logger.Error("Failed to apply replicated entry", "seq", entry.Seq, "error", err)
+		}
+		applied = entry.Seq
+	}
+	if len(batch.Entries) > 0 || epoch == "" {
+		if err := f.saveState(followerState{Epoch: batch.Epoch, AppliedSeq: applied}); err != nil {
+			return err
+		}
+	}
+
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.status.Epoch = batch.Epoch
+	f.status.AppliedSeq = applied
+	f.status.LeaderSeq = batch.LastSeq
+	f.status.LastContact = time.Now()
+	f.status.Error = ""
+	f.status.LagEntries = batch.LastSeq - min(applied, batch.LastSeq)
+	f.status.LagSeconds = 0
+	if f.status.LagEntries > 0 && len(batch.Entries) > 0 {
+		last := batch.Entries[len(batch.Entries)-1].Time
+		f.status.LagSeconds = time.Since(time.Unix(0, last)).Seconds()
+	}
+	return nil
+}
+
+// saveState writes the position crash-safely, replacing the previous one
+func (f *Follower) saveState(state followerState) error {
+	data, err := json.Marshal(state)
+	if err != nil {
+		return err
+	}
+	tmp := f.statePath + ".tmp"
+	if err := os.WriteFile(tmp, data, 0644); err != nil {
+		return fmt.Errorf("failed to save replication state: %w", err)
+	}
+	if err := os.Rename(tmp, f.statePath); err != nil {
+		return fmt.Errorf("failed to save replication state: %w", err)
+	}
+	return nil
+}
+
+// Status returns the position of the follower
+func (f *Follower) Status() FollowerStatus {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return f.status
+}
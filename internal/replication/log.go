@@ -0,0 +1,180 @@
+package replication
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"sort"
+	"sync"
+	"time"
+
+	"oasisdb/internal/index"
+)
+
+// ErrResync is returned to a follower that can't continue from its position:
+// the leader restarted, which starts a new epoch, or the entries it needs were
+// dropped from the log. It must be restarted from a copy of the leader's data
+var ErrResync = errors.New("follower must be resynced from a copy of the leader's data")
+
+// Entry is a write replicated to followers, either scalar writes or an index
+// operation
+type Entry struct {
+	Seq    uint64          `json:"seq"`
+	Time   int64           `json:"time"` // unix nanoseconds the leader recorded it at
+	Keys   [][]byte        `json:"keys,omitempty"`
+	Values [][]byte        `json:"values,omitempty"` // a nil value deletes its key
+	Index  *index.WALEntry `json:"index,omitempty"`
+}
+
+// Batch is a response of the stream endpoint
+type Batch struct {
+	Epoch    string  `json:"epoch"`
+	Entries  []Entry `json:"entries"`
+	LastSeq  uint64  `json:"last_seq"`  // seq of the last entry the leader recorded
+	LastTime int64   `json:"last_time"` // time of that entry
+}
+
+// FollowerInfo is what the leader knows about a follower from its requests
+type FollowerInfo struct {
+	Name       string    `json:"name"`
+	AppliedSeq uint64    `json:"applied_seq"`
+	LagEntries uint64    `json:"lag_entries"`
+	LastSeen   time.Time `json:"last_seen"`
+}
+
+// LeaderStatus describes the log of a leader and its followers
+type LeaderStatus struct {
+	Epoch     string         `json:"epoch"`
+	FirstSeq  uint64         `json:"first_seq"` // oldest entry a follower can still fetch
+	LastSeq   uint64         `json:"last_seq"`
+	Followers []FollowerInfo `json:"followers"`
+}
+
+// Log keeps the latest writes of a leader in memory for followers to fetch.
+// Entries are numbered from 1 in the order they were recorded, the log starts
+// empty with a new epoch on every start
+type Log struct {
+	mu        sync.Mutex
+	epoch     string
+	entries   []Entry // ring buffer of the retained entries
+	head      int     // position of the oldest entry
+	count     int
+	next      uint64        // seq of the next entry
+	changed   chan struct{} // closed when an entry is recorded
+	followers map[string]*FollowerInfo
+}
+
+// NewLog returns a log retaining the latest size entries
+func NewLog(size int) *Log {
+	epoch := make([]byte, 8)
+	rand.Read(epoch)
+	return &Log{
+		epoch:     hex.EncodeToString(epoch),
+		entries:   make([]Entry, max(size, 1)),
+		next:      1,
+		changed:   make(chan struct{}),
+		followers: make(map[string]*FollowerInfo),
+	}
+}
+
+// Epoch identifies the log, it changes when the leader restarts
+func (l *Log) Epoch() string {
+	return l.epoch
+}
+
+// RecordScalar records scalar writes, a nil value deletes its key
+func (l *Log) RecordScalar(keys, values [][]byte) {
+	l.record(Entry{Keys: keys, Values: values})
+}
+
+// RecordIndex records an index operation
+func (l *Log) RecordIndex(entry *index.WALEntry) {
+	l.record(Entry{Index: entry})
+}
+
+func (l *Log) record(entry Entry) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	entry.Seq = l.next
+	entry.Time = time.Now().UnixNano()
+	l.next++
+	if l.count < len(l.entries) {
+		l.entries[(l.head+l.count)%len(l.entries)] = entry
+		l.count++
+	} else {
+		l.entries[l.head] = entry
+		l.head = (l.head + 1) % len(l.entries)
+	}
+	close(l.changed)
+	l.changed = make(chan struct{})
+}
+
+// Read returns up to limit entries from seq from on, waiting up to wait for one
+// to be recorded if the follower is up to date. epoch is the epoch the
+// follower applied entries of, empty for a new follower
+func (l *Log) Read(ctx context.Context, follower, epoch string, from uint64, limit int, wait time.Duration) (*Batch, error) {
+	if from == 0 {
+		from = 1
+	}
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if epoch != "" && epoch != l.epoch {
+		return nil, ErrResync
+	}
+	if from > l.next || from < l.next-uint64(l.count) {
+		return nil, ErrResync
+	}
+	l.followers[follower] = &FollowerInfo{Name: follower, AppliedSeq: from - 1, LastSeen: time.Now()}
+
+	if from == l.next && wait > 0 {
+		changed := l.changed
+		l.mu.Unlock()
+		timer := time.NewTimer(wait)
+		select {
+		case <-changed:
+		case <-timer.C:
+		case <-ctx.Done():
+		}
+		timer.Stop()
+		l.mu.Lock()
+		// the entry may have been dropped while waiting
+		if from < l.next-uint64(l.count) {
+			return nil, ErrResync
+		}
+	}
+
+	n := min(int(l.next-from), limit)
+	batch := &Batch{Epoch: l.epoch, Entries: make([]Entry, n), LastSeq: l.next - 1}
+	first := l.next - uint64(l.count)
+	for i := range batch.Entries {
+		batch.Entries[i] = l.entries[(l.head+int(from-first)+i)%len(l.entries)]
+	}
+	if l.count > 0 {
+		batch.LastTime = l.entries[(l.head+l.count-1)%len(l.entries)].Time
+	}
+	return batch, nil
+}
+
+// Status returns the range of the log and the followers that read from it
+func (l *Log) Status() LeaderStatus {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	status := LeaderStatus{
+		Epoch:     l.epoch,
+		FirstSeq:  l.next - uint64(l.count),
+		LastSeq:   l.next - 1,
+		Followers: make([]FollowerInfo, 0, len(l.followers)),
+	}
+	for _, f := range l.followers {
+		info := *f
+		info.LagEntries = status.LastSeq - min(info.AppliedSeq, status.LastSeq)
+		status.Followers = append(status.Followers, info)
+	}
+	sort.Slice(status.Followers, func(i, j int) bool {
+		return status.Followers[i].Name < status.Followers[j].Name
+	})
+	return status
+}
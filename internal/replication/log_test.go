@@ -0,0 +1,85 @@
+package replication
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"oasisdb/internal/index"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestLogRead(t *testing.T) {
+	log := NewLog(3)
+	ctx := context.Background()
+
+	batch, err := log.Read(ctx, "f", "", 1, 10, 0)
+	assert.NoError(t, err)
+	assert.Equal(t, log.Epoch(), batch.Epoch)
+	assert.Empty(t, batch.Entries)
+
+	log.RecordScalar([][]byte{[]byte("a")}, [][]byte{[]byte("1")})
+	log.RecordScalar([][]byte{[]byte("b")}, [][]byte{nil})
+	log.RecordIndex(&index.WALEntry{OpType: index.WALOpDeleteIndex, Collection: "c"})
+
+	batch, err = log.Read(ctx, "f", log.Epoch(), 1, 2, 0)
+	assert.NoError(t, err)
+	assert.Len(t, batch.Entries, 2)
+	assert.Equal(t, uint64(1), batch.Entries[0].Seq)
+	assert.Equal(t, []byte("a"), batch.Entries[0].Keys[0])
+	assert.Nil(t, batch.Entries[1].Values[0])
+	assert.Equal(t, uint64(3), batch.LastSeq)
+
+	batch, err = log.Read(ctx, "f", log.Epoch(), 3, 10, 0)
+	assert.NoError(t, err)
+	assert.Len(t, batch.Entries, 1)
+	assert.Equal(t, "c", batch.Entries[0].Index.Collection)
+
+	// the fourth entry drops the first one
+	log.RecordScalar([][]byte{[]byte("d")}, [][]byte{[]byte("4")})
+	_, err = log.Read(ctx, "f", log.Epoch(), 1, 10, 0)
+	assert.ErrorIs(t, err, ErrResync)
+	batch, err = log.Read(ctx, "f", log.Epoch(), 2, 10, 0)
+	assert.NoError(t, err)
+	assert.Len(t, batch.Entries, 3)
+	assert.Equal(t, uint64(4), batch.Entries[2].Seq)
+
+	// a restarted leader has a new epoch
+	_, err = log.Read(ctx, "f", "old", 5, 10, 0)
+	assert.ErrorIs(t, err, ErrResync)
+	// positions past the log were never recorded
+	_, err = log.Read(ctx, "f", log.Epoch(), 6, 10, 0)
+	assert.ErrorIs(t, err, ErrResync)
+
+	status := log.Status()
+	assert.Equal(t, uint64(2), status.FirstSeq)
+	assert.Equal(t, uint64(4), status.LastSeq)
+	assert.Len(t, status.Followers, 1)
+	assert.Equal(t, uint64(3), status.Followers[0].LagEntries)
+}
+
+func TestLogReadWait(t *testing.T) {
+	log := NewLog(10)
+	ctx := context.Background()
+
+	start := time.Now()
+	batch, err := log.Read(ctx, "f", "", 1, 10, 50*time.Millisecond)
+	assert.NoError(t, err)
+	assert.Empty(t, batch.Entries)
+	assert.GreaterOrEqual(t, time.Since(start), 50*time.Millisecond)
+
+	go func() {
+		time.Sleep(20 * time.Millisecond)
+		log.RecordScalar([][]byte{[]byte("a")}, [][]byte{[]byte("1")})
+	}()
+	batch, err = log.Read(ctx, "f", "", 1, 10, 10*time.Second)
+	assert.NoError(t, err)
+	assert.Len(t, batch.Entries, 1)
+
+	ctx, cancel := context.WithCancel(ctx)
+	cancel()
+	batch, err = log.Read(ctx, "f", "", 2, 10, 10*time.Second)
+	assert.NoError(t, err)
+	assert.Empty(t, batch.Entries)
+}
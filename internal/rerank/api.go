@@ -0,0 +1,129 @@
+package rerank
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"strings"
+	"time"
+)
+
+const (
+	API_MODEL       = "jina-reranker-v2-base-multilingual"
+	API_BASE_URL    = "https://api.jina.ai/v1"
+	API_API_KEY_ENV = "RERANK_API_KEY"
+)
+
+// apiReranker scores candidates with a cross-encoder served behind a
+// Cohere/Jina-compatible /rerank endpoint
+type apiReranker struct {
+	apiKey string
+	apiURL string
+	model  string
+}
+
+type apiRerankRequest struct {
+	Model     string   `json:"model"`
+	Query     string   `json:"query"`
+	Documents []string `json:"documents"`
+	TopN      int      `json:"top_n"`
+}
+
+type apiRerankResponse struct {
+	Results []struct {
+		Index          int     `json:"index"`
+		RelevanceScore float64 `json:"relevance_score"`
+	} `json:"results"`
+}
+
+func NewAPIReranker(opts Options) (Reranker, error) {
+	keyEnv := opts.APIKeyEnv
+	if keyEnv == "" {
+		keyEnv = API_API_KEY_ENV
+	}
+	apiKey, exists := os.LookupEnv(keyEnv)
+	if !exists {
+		return nil, fmt.Errorf("%s not found", keyEnv)
+	}
+	baseURL := opts.BaseURL
+	if baseURL == "" {
+		baseURL = API_BASE_URL
+	}
+	model := opts.Model
+	if model == "" {
+		model = API_MODEL
+	}
+	return &apiReranker{
+		apiKey: apiKey,
+		apiURL: strings.TrimSuffix(baseURL, "/") + "/rerank",
+		model:  model,
+	}, nil
+}
+
+func (r *apiReranker) Rerank(query Query, candidates []Candidate, k int) ([]Candidate, error) {
+	if query.Text == "" {
+		return nil, ErrQueryTextRequired
+	}
+	if len(candidates) == 0 {
+		return nil, nil
+	}
+	if k > len(candidates) {
+		k = len(candidates)
+	}
+
+	documents := make([]string, len(candidates))
+	for i, c := range candidates {
+		documents[i] = c.Text
+	}
+	body, err := json.Marshal(&apiRerankRequest{
+		Model:     r.model,
+		Query:     query.Text,
+		Documents: documents,
+		TopN:      k,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	httpReq, err := http.NewRequest("POST", r.apiURL, bytes.NewBuffer(body))
+	if err != nil {
+		return nil, err
+	}
+	httpReq.Header.Set("Content-Type", "application/json")
+	httpReq.Header.Set("Authorization", fmt.Sprintf("Bearer %s", r.apiKey))
+
+	client := &http.Client{Timeout: 30 * time.Second}
+	resp, err := client.Do(httpReq)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		respBody, _ := io.ReadAll(resp.Body)
+		return nil, fmt.Errorf("rerank API returned status %d: %s", resp.StatusCode, string(respBody))
+	}
+
+	var rerankResp apiRerankResponse
+	if err := json.NewDecoder(resp.Body).Decode(&rerankResp); err != nil {
+		return nil, err
+	}
+
+	// results come back sorted by relevance, keep that order
+	reranked := make([]Candidate, 0, k)
+	for _, res := range rerankResp.Results {
+		if res.Index < 0 || res.Index >= len(candidates) {
+			return nil, fmt.Errorf("rerank API returned invalid index %d", res.Index)
+		}
+		c := candidates[res.Index]
+		c.Score = res.RelevanceScore
+		reranked = append(reranked, c)
+		if len(reranked) == k {
+			break
+		}
+	}
+	return reranked, nil
+}
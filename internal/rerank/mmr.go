@@ -0,0 +1,78 @@
+package rerank
+
+import (
+	"fmt"
+	"math"
+)
+
+// mmrReranker implements Maximal Marginal Relevance, it trades relevance to
+// the query against similarity to the results already selected
+type mmrReranker struct {
+	lambda float64
+}
+
+func NewMMRReranker(opts Options) (Reranker, error) {
+	if opts.Lambda < 0 || opts.Lambda > 1 {
+		return nil, fmt.Errorf("mmr lambda must be in [0, 1], got %v", opts.Lambda)
+	}
+	return &mmrReranker{lambda: opts.Lambda}, nil
+}
+
+func (r *mmrReranker) Rerank(query Query, candidates []Candidate, k int) ([]Candidate, error) {
+	if len(query.Vector) == 0 {
+		return nil, fmt.Errorf("mmr requires a query vector")
+	}
+	if k > len(candidates) {
+		k = len(candidates)
+	}
+
+	relevance := make([]float64, len(candidates))
+	for i, c := range candidates {
+		relevance[i] = cosine(query.Vector, c.Vector)
+	}
+
+	selected := make([]Candidate, 0, k)
+	used := make([]bool, len(candidates))
+	// maxSim[i] is the highest similarity of candidate i to any selected one
+	maxSim := make([]float64, len(candidates))
+	for len(selected) < k {
+		best, bestScore := -1, math.Inf(-1)
+		for i := range candidates {
+			if used[i] {
+				continue
+			}
+			score := r.lambda * relevance[i]
+			if len(selected) > 0 {
+				score -= (1 - r.lambda) * maxSim[i]
+			}
+			if score > bestScore {
+				best, bestScore = i, score
+			}
+		}
+
+		used[best] = true
+		c := candidates[best]
+		c.Score = bestScore
+		selected = append(selected, c)
+		for i := range candidates {
+			if !used[i] {
+				maxSim[i] = math.Max(maxSim[i], cosine(c.Vector, candidates[i].Vector))
+			}
+		}
+	}
+	return selected, nil
+}
+
+// cosine returns the cosine similarity of a and b, 0 if either is zero
+func cosine(a, b []float32) float64 {
+	var dot, normA, normB float64
+	for i := 0; i < len(a) && i < len(b); i++ {
+		dot += float64(a[i]) * float64(b[i])
+		normA += float64(a[i]) * float64(a[i])
+		normB += float64(b[i]) * float64(b[i])
+	}
+	if normA == 0 || normB == 0 {
+		return 0
+	}
+	return dot / (math.Sqrt(normA) * math.Sqrt(normB))
+}
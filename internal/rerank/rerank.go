@@ -0,0 +1,93 @@
+package rerank
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+)
+
+const (
+	MMRReranker = "mmr"
+	APIReranker = "api"
+
+	DefaultLambda = 0.5
+)
+
+var (
+	ErrUnknownReranker   = errors.New("unknown reranker")
+	ErrQueryTextRequired = errors.New("query text is required for reranking")
+)
+
+// Query is the search request being reranked
+type Query struct {
+	Vector []float32
+	Text   string
+}
+
+// Candidate is a search result to be reranked
+type Candidate struct {
+	ID       string
+	Vector   []float32
+	Text     string  // document text, used by text-based rerankers
+	Distance float32 // distance from the vector search
+	Score    float64 // relevance assigned by the reranker, higher is better
+}
+
+// Reranker reorders search candidates and keeps the best k
+type Reranker interface {
+	Rerank(query Query, candidates []Candidate, k int) ([]Candidate, error)
+}
+
+// Options configures a reranker, request options take precedence over conf.yaml
+type Options struct {
+	Type      string  // reranker name, e.g. "mmr", "api"
+	Lambda    float64 // MMR relevance weight in [0, 1], 1 means no diversity
+	Model     string  // API reranker model, empty means default
+	BaseURL   string  // API base URL, empty means default
+	APIKeyEnv string  // environment variable holding the API key
+}
+
+// Constructor creates a reranker from options
+type Constructor func(opts Options) (Reranker, error)
+
+var (
+	registryMu sync.RWMutex
+	registry   = map[string]Constructor{
+		MMRReranker: NewMMRReranker,
+		APIReranker: NewAPIReranker,
+	}
+)
+
+// Register makes a reranker available by name, replacing any reranker
+// previously registered under the same name
+func Register(name string, constructor Constructor) {
+	registryMu.Lock()
+	defer registryMu.Unlock()
+	registry[strings.ToLower(name)] = constructor
+}
+
+// New creates the reranker selected by opts.Type
+func New(opts Options) (Reranker, error) {
+	registryMu.RLock()
+	constructor, ok := registry[strings.ToLower(opts.Type)]
+	registryMu.RUnlock()
+	if !ok {
+		return nil, fmt.Errorf("%w %q, available: %s", ErrUnknownReranker, opts.Type, strings.Join(Names(), ", "))
+	}
+	return constructor(opts)
+}
+
+// Names returns all registered reranker names in sorted order
+func Names() []string {
+	registryMu.RLock()
+	defer registryMu.RUnlock()
+
+	names := make([]string, 0, len(registry))
+	for name := range registry {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
@@ -0,0 +1,111 @@
+package rerank
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func ids(candidates []Candidate) []string {
+	out := make([]string, len(candidates))
+	for i, c := range candidates {
+		out[i] = c.ID
+	}
+	return out
+}
+
+func TestMMRReranker(t *testing.T) {
+	query := Query{Vector: []float32{1, 0}}
+	// a and b are near duplicates, c is less relevant but different
+	candidates := []Candidate{
+		{ID: "a", Vector: []float32{1, 0.1}},
+		{ID: "b", Vector: []float32{1, 0.11}},
+		{ID: "c", Vector: []float32{1, -1}},
+	}
+
+	relevance, err := New(Options{Type: MMRReranker, Lambda: 1})
+	require.NoError(t, err)
+	got, err := relevance.Rerank(query, candidates, 2)
+	require.NoError(t, err)
+	assert.Equal(t, []string{"a", "b"}, ids(got))
+
+	diverse, err := New(Options{Type: "MMR", Lambda: DefaultLambda})
+	require.NoError(t, err)
+	got, err = diverse.Rerank(query, candidates, 2)
+	require.NoError(t, err)
+	assert.Equal(t, []string{"a", "c"}, ids(got))
+
+	got, err = diverse.Rerank(query, candidates, 10)
+	require.NoError(t, err)
+	assert.Len(t, got, 3)
+
+	_, err = New(Options{Type: MMRReranker, Lambda: 1.5})
+	assert.Error(t, err)
+}
+
+func TestAPIReranker(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, "/v1/rerank", r.URL.Path)
+		assert.Equal(t, "Bearer test-key", r.Header.Get("Authorization"))
+
+		var req apiRerankRequest
+		require.NoError(t, json.NewDecoder(r.Body).Decode(&req))
+		assert.Equal(t, "custom-model", req.Model)
+		assert.Equal(t, "query", req.Query)
+		assert.Equal(t, []string{"x", "y", "z"}, req.Documents)
+		assert.Equal(t, 2, req.TopN)
+
+		w.Header().Set("Content-Type", "application/json")
+		w.Write([]byte(`{"results":[{"index":2,"relevance_score":0.9},{"index":0,"relevance_score":0.4}]}`))
+	}))
+	defer server.Close()
+
+	t.Setenv("TEST_RERANK_KEY", "test-key")
+	reranker, err := New(Options{
+		Type:      APIReranker,
+		Model:     "custom-model",
+		BaseURL:   server.URL + "/v1/",
+		APIKeyEnv: "TEST_RERANK_KEY",
+	})
+	require.NoError(t, err)
+
+	candidates := []Candidate{{ID: "a", Text: "x"}, {ID: "b", Text: "y"}, {ID: "c", Text: "z"}}
+	got, err := reranker.Rerank(Query{Text: "query"}, candidates, 2)
+	require.NoError(t, err)
+	assert.Equal(t, []string{"c", "a"}, ids(got))
+	assert.Equal(t, 0.9, got[0].Score)
+
+	_, err = reranker.Rerank(Query{Vector: []float32{1}}, candidates, 2)
+	assert.ErrorIs(t, err, ErrQueryTextRequired)
+
+	_, err = New(Options{Type: APIReranker, APIKeyEnv: "TEST_RERANK_KEY_MISSING"})
+	assert.Error(t, err)
+}
+
+type reverseReranker struct{}
+
+func (reverseReranker) Rerank(_ Query, candidates []Candidate, k int) ([]Candidate, error) {
+	out := make([]Candidate, 0, k)
+	for i := len(candidates) - 1; i >= 0 && len(out) < k; i-- {
+		out = append(out, candidates[i])
+	}
+	return out, nil
+}
+
+func TestRegister(t *testing.T) {
+	_, err := New(Options{Type: "reverse"})
+	assert.ErrorIs(t, err, ErrUnknownReranker)
+
+	Register("reverse", func(Options) (Reranker, error) { return reverseReranker{}, nil })
+	assert.Contains(t, Names(), "reverse")
+
+	reranker, err := New(Options{Type: "reverse"})
+	require.NoError(t, err)
+	got, err := reranker.Rerank(Query{}, []Candidate{{ID: "a"}, {ID: "b"}}, 1)
+	require.NoError(t, err)
+	assert.Equal(t, []string{"b"}, ids(got))
+}
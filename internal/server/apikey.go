@@ -0,0 +1,35 @@
+package server
+
+import (
+	"os"
+
+	"oasisdb/internal/config"
+	"oasisdb/pkg/logger"
+
+	"github.com/gin-gonic/gin"
+)
+
+// apiKeyFilters maps the keys of server.api_keys to their filters, a key
+// whose env var is unset or empty is left out
+func apiKeyFilters(keys []config.APIKeyConfig) map[string]map[string]any {
+	filters := make(map[string]map[string]any, len(keys))
+	for _, key := range keys {
+		value, ok := os.LookupEnv(key.KeyEnv)
+		if !ok || value == "" {
+			logger.Warn("API key env var is not set, its filter is not enforced", "key_env", key.KeyEnv)
+			continue
+		}
+		filters[value] = key.Filter
+	}
+	return filters
+}
+
+// requestScope returns the filter enforced on the searches and gets of a
+// request, the filter of its API key or nil
+func (s *Server) requestScope(c *gin.Context) map[string]any {
+	key := requestAPIKey(c)
+	if key == "" {
+		return nil
+	}
+	return s.keyFilters[key]
+}
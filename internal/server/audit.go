@@ -0,0 +1,88 @@
+package server
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"strings"
+	"time"
+
+	"oasisdb/internal/audit"
+	"oasisdb/internal/consensus"
+	"oasisdb/pkg/logger"
+
+	"github.com/gin-gonic/gin"
+)
+
+// auditDetailsKey holds details a handler adds to the audit record of its
+// request, e.g. the changed parameters
+const auditDetailsKey = "audit_details"
+
+// OpenAuditLog opens the audit log of the config, it does nothing unless
+// audit.enabled is set
+func (s *Server) OpenAuditLog() error {
+	conf := s.db.Config().Audit
+	if !conf.Enabled {
+		return nil
+	}
+	log, err := audit.Open(conf.File, conf.MaxBytes, conf.MaxFiles)
+	if err != nil {
+		return err
+	}
+	s.audit = log
+	logger.Info("Audit log enabled", "file", conf.File)
+	return nil
+}
+
+// audited records the request in the audit log once it is answered, writes
+// applied from the raft log were recorded by the node that received them
+func (s *Server) audited(action string) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		c.Next()
+		if s.audit == nil || consensus.Applying(c.Request.Context()) {
+			return
+		}
+		record := &audit.Record{
+			Time:       time.Now().UTC(),
+			Action:     action,
+			Collection: c.Param("name"),
+			DocumentID: c.Param("id"),
+			Tenant:     c.GetHeader(TenantHeader),
+			ClientIP:   c.ClientIP(),
+			APIKey:     apiKeyFingerprint(c),
+			RequestID:  c.Writer.Header().Get(RequestIDHeader),
+			Status:     c.Writer.Status(),
+		}
+		if details, ok := c.Get(auditDetailsKey); ok {
+			record.Details = details.(map[string]any)
+		}
+		if err := s.audit.Write(record); err != nil {
+			logger.Ctx(c.Request.Context()).Errorw("Failed to write audit record", "action", action, "error", err)
+		}
+	}
+}
+
+// auditDetails adds details to the audit record of the request
+func auditDetails(c *gin.Context, details map[string]any) {
+	c.Set(auditDetailsKey, details)
+}
+
+// apiKeyFingerprint identifies the API key a request was sent with, by the
+// Authorization bearer token or the X-API-Key header, without logging it
+func apiKeyFingerprint(c *gin.Context) string {
+	key := requestAPIKey(c)
+	if key == "" {
+		return ""
+	}
+	sum := sha256.Sum256([]byte(key))
+	return "sha256:" + hex.EncodeToString(sum[:6])
+}
+
+// requestAPIKey returns the API key a request was sent with, the X-API-Key
+// header or else the Authorization bearer token
+func requestAPIKey(c *gin.Context) string {
+	key := c.GetHeader("X-API-Key")
+	if auth := c.GetHeader("Authorization"); key == "" && auth != "" {
+		key = strings.TrimSpace(strings.TrimPrefix(auth, "Bearer "))
+	}
+	return key
+}
@@ -0,0 +1,116 @@
+package server
+
+import (
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+	"io"
+	"math"
+
+	DB "oasisdb/internal/db"
+
+	"github.com/gin-gonic/gin"
+)
+
+// binaryContentType selects the binary layout for search and batch upsert
+// bodies, which carries vectors as raw floats instead of JSON numbers. All
+// values are little-endian:
+//
+//	header length  uint32
+//	header         the JSON request without vectors
+//	vectors        float32 values up to the end of the body
+//
+// A search body holds the query vector, a batch upsert body the vectors of
+// the documents in order, each of the dimension set in its header entry
+const binaryContentType = "application/octet-stream"
+
+func isBinaryRequest(c *gin.Context) bool {
+	return c.ContentType() == binaryContentType
+}
+
+// bindBinary decodes the header of a binary body into req and returns the
+// vector values that follow it
+func bindBinary(c *gin.Context, req any) ([]float32, error) {
+	body, err := io.ReadAll(c.Request.Body)
+	if err != nil {
+		return nil, err
+	}
+	if len(body) < 4 {
+		return nil, fmt.Errorf("binary body is missing the header length")
+	}
+	size := uint64(binary.LittleEndian.Uint32(body))
+	if size > uint64(len(body)-4) {
+		return nil, fmt.Errorf("binary header length %d exceeds the body", size)
+	}
+	if err := json.Unmarshal(body[4:4+size], req); err != nil {
+		return nil, fmt.Errorf("invalid binary header: %w", err)
+	}
+	data := body[4+size:]
+	if len(data)%4 != 0 {
+		return nil, fmt.Errorf("binary vector data of %d bytes is not a whole number of float32 values", len(data))
+	}
+	values := make([]float32, len(data)/4)
+	for i := range values {
+		values[i] = math.Float32frombits(binary.LittleEndian.Uint32(data[i*4:]))
+	}
+	return values, nil
+}
+
+// bindSearchRequest binds a JSON or binary search body, the binary query
+// vector is stored in vector
+func bindSearchRequest(c *gin.Context, req any, vector *[]float32) error {
+	if !isBinaryRequest(c) {
+		return bindJSON(c, req)
+	}
+	values, err := bindBinary(c, req)
+	if err != nil {
+		return err
+	}
+	if err := validateRequest(req); err != nil {
+		return err
+	}
+	if len(*vector) > 0 {
+		return fmt.Errorf("binary search bodies carry the vector after the header")
+	}
+	if len(values) > 0 {
+		*vector = values
+	}
+	return nil
+}
+
+// bindBatchUpsertRequest binds a JSON or binary batch upsert body, binary
+// vectors are split across the documents by their dimension
+func bindBatchUpsertRequest(c *gin.Context, req *BatchUpsertRequest) error {
+	if !isBinaryRequest(c) {
+		return bindJSON(c, req)
+	}
+	values, err := bindBinary(c, req)
+	if err != nil {
+		return err
+	}
+	if err := validateRequest(req); err != nil {
+		return err
+	}
+	return splitVectors(req.Documents, values)
+}
+
+func splitVectors(docs []*DB.Document, values []float32) error {
+	offset := 0
+	for i, doc := range docs {
+		if doc == nil {
+			return fmt.Errorf("document %d is null", i)
+		}
+		if len(doc.Vector) > 0 {
+			return fmt.Errorf("document %d: binary bodies carry vectors after the header", i)
+		}
+		if doc.Dimension <= 0 || doc.Dimension > len(values)-offset {
+			return fmt.Errorf("document %d: dimension %d doesn't fit the %d remaining vector values", i, doc.Dimension, len(values)-offset)
+		}
+		doc.Vector = values[offset : offset+doc.Dimension : offset+doc.Dimension]
+		offset += doc.Dimension
+	}
+	if offset != len(values) {
+		return fmt.Errorf("%d vector values are left after the last document", len(values)-offset)
+	}
+	return nil
+}
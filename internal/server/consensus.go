@@ -0,0 +1,127 @@
+package server
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httputil"
+	"net/url"
+
+	"oasisdb/internal/consensus"
+
+	"github.com/gin-gonic/gin"
+)
+
+// forwardedHeader marks a write forwarded to the leader, which answers
+// instead of forwarding it again when it lost the leadership meanwhile
+const forwardedHeader = "X-Oasis-Forwarded"
+
+// committedHeaders are the request headers the handlers read, they are kept
+// in the raft log with the request
+var committedHeaders = []string{"Content-Type", "Content-Encoding", TenantHeader, RequestIDHeader}
+
+// StartConsensus joins the raft cluster of the consensus config, writes are
+// then committed through the raft log. It does nothing without a node ID
+func (s *Server) StartConsensus() error {
+	conf := s.db.Config()
+	if conf.Consensus.NodeID == "" {
+		return nil
+	}
+	node, err := consensus.NewNode(conf.Consensus, conf.Dir, s.router)
+	if err != nil {
+		return err
+	}
+	s.node = node
+	return nil
+}
+
+// Close stops the raft node of the server, if any, and closes the audit log
+func (s *Server) Close() error {
+	if s.audit != nil {
+		s.audit.Close()
+	}
+	if s.node == nil {
+		return nil
+	}
+	return s.node.Close()
+}
+
+// commit sends a write to the leader to be committed through the raft log,
+// the response is what the leader answered when it applied the write
+func (s *Server) commit() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if s.node == nil || consensus.Applying(c.Request.Context()) {
+			return
+		}
+		if !s.node.IsLeader() {
+			s.forwardToLeader(c)
+			return
+		}
+
+		body, err := io.ReadAll(c.Request.Body)
+		if err != nil {
+			c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		cmd := &consensus.Command{Method: c.Request.Method, URL: c.Request.URL.RequestURI(), Header: http.Header{}, Body: body}
+		for _, name := range committedHeaders {
+			if value := c.GetHeader(name); value != "" {
+				cmd.Header.Set(name, value)
+			}
+		}
+		resp, err := s.node.Apply(cmd)
+		if errors.Is(err, consensus.ErrNotLeader) && c.GetHeader(forwardedHeader) == "" {
+			c.Request.Body = io.NopCloser(bytes.NewReader(body))
+			s.forwardToLeader(c)
+			return
+		}
+		if err != nil {
+			c.AbortWithStatusJSON(http.StatusServiceUnavailable, gin.H{"error": "failed to commit the write: " + err.Error()})
+			return
+		}
+		for name, values := range resp.Header {
+			c.Writer.Header()[name] = values
+		}
+		c.Writer.WriteHeader(resp.Status)
+		c.Writer.Write(resp.Body)
+		c.Abort()
+	}
+}
+
+// forwardToLeader proxies a write to the leader
+func (s *Server) forwardToLeader(c *gin.Context) {
+	leader := s.node.LeaderHTTPAddr()
+	if leader == "" || c.GetHeader(forwardedHeader) != "" {
+		c.Header("Retry-After", "1")
+		c.AbortWithStatusJSON(http.StatusServiceUnavailable, gin.H{"error": "no raft leader to send the write to"})
+		return
+	}
+	target, err := url.Parse(leader)
+	if err != nil {
+		c.AbortWithStatusJSON(http.StatusInternalServerError, gin.H{"error": "invalid leader address: " + err.Error()})
+		return
+	}
+	proxy := httputil.NewSingleHostReverseProxy(target)
+	proxy.ErrorHandler = func(w http.ResponseWriter, r *http.Request, err error) {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusBadGateway)
+		body, _ := json.Marshal(gin.H{"error": "failed to forward the write to the leader: " + err.Error()})
+		w.Write(body)
+	}
+	c.Request.Header.Set(forwardedHeader, s.db.Config().Consensus.NodeID)
+	proxy.ServeHTTP(c.Writer, c.Request)
+	c.Abort()
+}
+
+// handleConsensusStatus reports the raft state of the node
+func (s *Server) handleConsensusStatus() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if s.node == nil {
+			c.JSON(http.StatusNotFound, gin.H{"error": "raft is not enabled"})
+			return
+		}
+		c.JSON(http.StatusOK, s.node.Status())
+	}
+}
@@ -0,0 +1,116 @@
+package server
+
+import (
+	"compress/gzip"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+
+	DB "oasisdb/internal/db"
+	pkgerrors "oasisdb/pkg/errors"
+	"oasisdb/pkg/logger"
+
+	"github.com/gin-gonic/gin"
+)
+
+// ndjsonContentType is the content type of the export stream
+const ndjsonContentType = "application/x-ndjson"
+
+// ExportDocument is a line of an export, the format the CLI imports
+type ExportDocument struct {
+	ID         string         `json:"id"`
+	Vector     []float32      `json:"vector"`
+	Parameters map[string]any `json:"parameters"`
+}
+
+// exportErrorTrailer is the trailer of an export that failed after its
+// status was sent
+const exportErrorTrailer = "X-Export-Error"
+
+// handleExportCollection streams the documents of a collection matching an
+// optional filter as newline delimited JSON in ID order, read from a
+// snapshot taken when the request starts. A broken export resumes with the
+// ID of the last complete line as cursor
+func (s *Server) handleExportCollection() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		collectionName, ok := resolveCollection(c, c.Param("name"))
+		if !ok {
+			return
+		}
+		var filter map[string]any
+		if raw := c.Query("filter"); raw != "" {
+			if err := json.Unmarshal([]byte(raw), &filter); err != nil {
+				c.JSON(http.StatusBadRequest, gin.H{"error": "invalid filter: " + err.Error()})
+				return
+			}
+		}
+
+		// the first page reports a missing collection before the stream starts
+		scope := s.requestScope(c)
+		page, err := s.db.ScrollDocuments(collectionName, DB.ScrollOptions{
+			Scope:    scope,
+			Filter:   filter,
+			Size:     DB.MaxScrollSize,
+			After:    c.Query("cursor"),
+			Snapshot: true,
+		})
+		if errors.Is(err, pkgerrors.ErrCollectionNotFound) {
+			c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+			return
+		}
+		if errors.Is(err, pkgerrors.ErrInvalidParameter) {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+
+		c.Header("Content-Type", ndjsonContentType)
+		c.Header("X-Export-Seq", strconv.FormatUint(page.Seq, 10))
+		c.Header("Trailer", exportErrorTrailer)
+		var w io.Writer = c.Writer
+		var zw *gzip.Writer
+		if strings.Contains(c.GetHeader("Accept-Encoding"), "gzip") {
+			c.Header("Content-Encoding", "gzip")
+			c.Header("Vary", "Accept-Encoding")
+			zw = gzip.NewWriter(c.Writer)
+			w = zw
+		}
+		c.Status(http.StatusOK)
+
+		enc := json.NewEncoder(w)
+		exported := 0
+		for {
+			for _, doc := range page.Documents {
+				if err := enc.Encode(ExportDocument{ID: doc.ID, Vector: doc.Vector, Parameters: doc.Parameters}); err != nil {
+					// the client went away, its snapshot expires with the cursor
+					logger.Warn("Export aborted", "collection", collectionName, "documents", exported, "error", err)
+					return
+				}
+				exported++
+			}
+			if zw != nil {
+				zw.Flush()
+			}
+			c.Writer.Flush()
+			if page.Cursor == "" {
+				break
+			}
+			if page, err = s.db.ScrollDocuments(collectionName, DB.ScrollOptions{Cursor: page.Cursor, Size: DB.MaxScrollSize, Scope: scope}); err != nil {
+				// the status is sent, the trailer tells the client to resume
+				// and a gzip stream is left unterminated
+				logger.Error("Export failed", "collection", collectionName, "documents", exported, "error", err)
+				c.Writer.Header().Set(exportErrorTrailer, err.Error())
+				return
+			}
+		}
+		if zw != nil {
+			zw.Close()
+		}
+	}
+}
@@ -6,54 +6,188 @@ import (
 	"encoding/json"
 	"errors"
 	"fmt"
+	"maps"
 	"net/http"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
 
 	DB "oasisdb/internal/db"
+	"oasisdb/internal/index"
+	"oasisdb/internal/rerank"
 	pkgerrors "oasisdb/pkg/errors"
 
 	"github.com/gin-gonic/gin"
 )
 
-// generateCacheKey creates a unique key for caching search results
-func generateCacheKey(collection string, vector []float32, limit int) string {
+// generateCacheKey creates a unique key for caching search results, found
+// at the write version of the collection
+func generateCacheKey(collection string, version uint64, req *SearchVectorRequest) string {
 	// Convert parameters to a string representation
-	vectorBytes, _ := json.Marshal(vector)
+	reqBytes, _ := json.Marshal(req)
 
 	// Combine all parameters into a single string
-	data := fmt.Sprintf("%s:%s:%d", collection, string(vectorBytes), limit)
+	data := fmt.Sprintf("%s:%d:%s", collection, version, string(reqBytes))
 
 	// Generate SHA-256 hash
 	hash := sha256.Sum256([]byte(data))
 	return hex.EncodeToString(hash[:])
 }
 
+// generateQueryTextCacheKey creates the key caching the embedding of a query text
+func generateQueryTextCacheKey(text string) string {
+	hash := sha256.Sum256([]byte(text))
+	return "query_text:" + hex.EncodeToString(hash[:])
+}
+
+// embedQueryText embeds a search text, reusing the cached vector if possible
+// and allowed by the request
+func (s *Server) embedQueryText(c *gin.Context, text string) ([]float32, error) {
+	cacheKey := generateQueryTextCacheKey(text)
+	if cached, exists := s.db.Cache.Get(cacheKey); exists && !noCache(c) {
+		return cached.([]float32), nil
+	}
+
+	vector, err := s.db.EmbedText(text)
+	if err != nil {
+		return nil, err
+	}
+	s.db.Cache.Set(cacheKey, vector)
+	return vector, nil
+}
+
 func (s *Server) handleHealthCheck() gin.HandlerFunc {
 	return func(c *gin.Context) {
 		c.JSON(http.StatusOK, gin.H{"status": "ok"})
 	}
 }
 
+// handleReadiness runs the readiness checks of the database, answering 503
+// if one failed so probes take the server out of rotation. The embedding
+// provider is only checked with ?embedding=true
+func (s *Server) handleReadiness() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		embedding := false
+		if v := c.Query("embedding"); v != "" {
+			b, err := strconv.ParseBool(v)
+			if err != nil {
+				c.JSON(http.StatusBadRequest, gin.H{"error": "invalid embedding"})
+				return
+			}
+			embedding = b
+		}
+
+		response := ReadinessResponse{Status: "ready", Checks: make(map[string]HealthCheckResponse)}
+		for _, check := range s.db.CheckReadiness(embedding) {
+			if check.Err != nil {
+				response.Status = "not ready"
+				response.Checks[check.Name] = HealthCheckResponse{Status: "failed", Error: check.Err.Error()}
+				continue
+			}
+			response.Checks[check.Name] = HealthCheckResponse{Status: "ok"}
+		}
+		if response.Status != "ready" {
+			c.JSON(http.StatusServiceUnavailable, response)
+			return
+		}
+		c.JSON(http.StatusOK, response)
+	}
+}
+
+// handleStats reports the estimated memory of the loaded indices, to see an
+// OOM coming before the kernel kills the server. The totals cover the whole
+// server, the indices are only listed for the collections of the request
+// tenant
+func (s *Server) handleStats() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		tenant, err := requestTenant(c)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+
+		usage := s.db.IndexManager.MemoryUsage()
+		response := StatsResponse{
+			HeapBytes:   heapInUse(),
+			IndexMemory: make(map[string]int64),
+		}
+		for _, bytes := range usage {
+			response.IndexMemoryBytes += bytes
+		}
+		for _, name := range tenantCollections(tenant, slices.Collect(maps.Keys(usage))) {
+			response.IndexMemory[name] = usage[qualifiedName(tenant, name)]
+		}
+		c.JSON(http.StatusOK, response)
+	}
+}
+
+// handleMetrics returns every recorded metric with its mean
+func (s *Server) handleMetrics() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		snapshot := s.db.Metrics.Snapshot()
+		response := make(map[string]MetricResponse, len(snapshot))
+		for name, summary := range snapshot {
+			response[name] = MetricResponse{Summary: summary, Mean: summary.Mean()}
+		}
+		c.JSON(http.StatusOK, gin.H{"metrics": response})
+	}
+}
+
 func (s *Server) handleSearchVectors() gin.HandlerFunc {
 	return func(c *gin.Context) {
-		collectionName := c.Param("name")
+		collectionName, ok := resolveCollection(c, c.Param("name"))
+		if !ok {
+			return
+		}
+		start := time.Now()
+		debug, err := debugRequested(c)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
 		var req SearchVectorRequest
-		if err := c.ShouldBindJSON(&req); err != nil {
+		if err := bindSearchRequest(c, &req, &req.Vector); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		if err := checkSearchLimits(&s.db.Config().Server, req.Limit, req.Offset, 0, req.Params); err != nil {
 			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
 			return
 		}
 
-		// Generate cache key
-		cacheKey := generateCacheKey(collectionName, req.Vector, req.Limit)
+		// Generate cache key, the version is read before searching so results
+		// a concurrent write makes stale are never served after it returned
+		cacheKey := generateCacheKey(collectionName, s.db.WriteVersion(collectionName), &req)
 
-		// Try to get from cache first
-		if cachedResult, exists := s.db.Cache.Get(cacheKey); exists {
-			result := cachedResult.(gin.H)
-			result["other"] = "cache_hit"
-			c.JSON(http.StatusOK, result)
-			return
+		// Try to get from cache first, a missing collection is reported by the
+		// search. Results scoped to an API key are not shared with other keys
+		scope := s.requestScope(c)
+		searchCache, _ := s.db.SearchCache(collectionName)
+		if scope != nil {
+			searchCache = nil
+		}
+		if searchCache != nil && !noCache(c) {
+			if cachedResult, exists := searchCache.Get(cacheKey); exists {
+				result := cachedResult.(gin.H)
+				if debug {
+					// the cached response is shared, it is not modified
+					result = maps.Clone(result)
+					result["debug"] = &SearchDebug{CacheHit: true, TotalMs: milliseconds(time.Since(start))}
+				}
+				c.JSON(http.StatusOK, result)
+				return
+			}
 		}
 
-		ids, distances, err := s.db.SearchVectors(collectionName, req.Vector, req.Limit)
+		var total int
+		var timings DB.SearchTimings
+		opts := append(searchOptions(req.MaxDistance, req.Offset, req.Params, req.RerankExact, &total), DB.WithTimings(&timings), DB.WithScopeFilter(scope))
+		ids, distances, err := s.db.SearchVectors(c.Request.Context(), collectionName, req.Vector, req.Limit, opts...)
+		if errors.Is(err, pkgerrors.ErrInvalidParameter) {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
 		if err != nil {
 			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
 			return
@@ -61,52 +195,190 @@ func (s *Server) handleSearchVectors() gin.HandlerFunc {
 
 		// Prepare response
 		response := gin.H{
-			"ids":       ids,
-			"distances": distances,
+			"ids":              ids,
+			"distances":        distances,
+			"total_candidates": total,
 		}
 
 		// Cache the result
-		s.db.Cache.Set(cacheKey, response)
+		if searchCache != nil {
+			searchCache.Set(cacheKey, response)
+		}
 
 		// Return response
+		if debug {
+			response = maps.Clone(response)
+			response["debug"] = newSearchDebug(start, 0, timings)
+		}
+		c.JSON(http.StatusOK, response)
+	}
+}
+
+// handleWarmup loads indices and storage after a restart, so the first
+// queries don't pay for it
+func (s *Server) handleWarmup() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var req WarmupRequest
+		if c.Request.ContentLength > 0 {
+			if err := bindJSON(c, &req); err != nil {
+				c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+				return
+			}
+		}
+
+		report, err := s.db.Warmup(c.Request.Context(), req.Searches)
+		if errors.Is(err, pkgerrors.ErrInvalidParameter) {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+
+		c.JSON(http.StatusOK, gin.H{
+			"sst_files":   report.SSTFiles,
+			"sst_bytes":   report.SSTBytes,
+			"collections": report.Collections,
+			"duration_ms": report.Duration.Milliseconds(),
+		})
+	}
+}
+
+// handleCompact queues the compaction of a level of the scalar storage into
+// the next one, or of every level without a level
+func (s *Server) handleCompact() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		level := -1
+		if v := c.Query("level"); v != "" {
+			n, err := strconv.Atoi(v)
+			if err != nil || n < 0 {
+				c.JSON(http.StatusBadRequest, gin.H{"error": "invalid level"})
+				return
+			}
+			level = n
+		}
+
+		err := s.db.CompactStorage(level)
+		if errors.Is(err, pkgerrors.ErrInvalidParameter) {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+		c.JSON(http.StatusAccepted, gin.H{"message": "compaction queued"})
+	}
+}
+
+// handleCompactionStatus reports the size of every level of the scalar
+// storage and its queued, running and finished compactions
+func (s *Server) handleCompactionStatus() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		status := s.db.CompactionStatus()
+		response := CompactionStatusResponse{
+			Levels:         make([]LevelStatusResponse, len(status.Levels)),
+			Alive:          status.Alive,
+			PendingFlushes: status.PendingFlushes,
+			QueueDepth:     status.QueueDepth,
+			Flushes:        status.Flushes,
+			LastFlushMs:    status.LastFlush.Milliseconds(),
+			Writes:         string(status.Writes),
+			SlowedWrites:   status.SlowedWrites,
+			StoppedWrites:  status.StoppedWrites,
+			FailedWrites:   status.FailedWrites,
+		}
+		for i, level := range status.Levels {
+			response.Levels[i] = LevelStatusResponse{
+				Level:          level.Level,
+				Files:          level.Files,
+				Bytes:          level.Bytes,
+				Pending:        level.Pending,
+				Running:        level.Running,
+				Compactions:    level.Compactions,
+				LastDurationMs: level.LastDuration.Milliseconds(),
+			}
+			if !level.LastCompacted.IsZero() {
+				response.Levels[i].LastCompactedAt = &level.LastCompacted
+			}
+		}
 		c.JSON(http.StatusOK, response)
 	}
 }
 
+// handleWatchStatus reports the files of the watch directory ingested so far
+func (s *Server) handleWatchStatus() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		status, ok := s.db.WatchStatus()
+		if !ok {
+			c.JSON(http.StatusNotFound, gin.H{"error": "no directory is watched on this server"})
+			return
+		}
+		c.JSON(http.StatusOK, status)
+	}
+}
+
 func (s *Server) handleCreateCollection() gin.HandlerFunc {
 	return func(c *gin.Context) {
 		var req CreateCollectionRequest
-		if err := c.ShouldBindJSON(&req); err != nil {
+		if err := bindJSON(c, &req); err != nil {
 			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
 			return
 		}
 
+		name, ok := resolveCollection(c, req.Name)
+		if !ok {
+			return
+		}
+
 		collection, err := s.db.CreateCollection(&DB.CreateCollectionOptions{
-			Name:       req.Name,
-			Dimension:  int(req.Dimension),
-			Parameters: req.Parameters,
-			IndexType:  req.IndexType,
+			Name:           name,
+			Dimension:      int(req.Dimension),
+			Parameters:     req.Parameters,
+			IndexType:      req.IndexType,
+			DefaultFilter:  req.DefaultFilter,
+			StoreVectors:   req.StoreVectors,
+			Normalize:      req.Normalize,
+			Schema:         req.Schema,
+			Cache:          req.Cache.settings(),
+			DedupThreshold: req.DedupThreshold,
+			DedupMode:      req.DedupMode,
 		})
 		if errors.Is(err, pkgerrors.ErrCollectionExists) {
 			c.JSON(http.StatusOK, gin.H{"message": err.Error()})
 			return
 		}
+		if errors.Is(err, pkgerrors.ErrInvalidParameter) {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
 		if err != nil {
 			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
 			return
 		}
 
 		c.JSON(http.StatusOK, gin.H{
-			"name":      collection.Name,
-			"dimension": collection.Dimension,
-			"metadata":  collection.Metadata,
+			"name":            req.Name,
+			"dimension":       collection.Dimension,
+			"metadata":        collection.Metadata,
+			"default_filter":  collection.DefaultFilter,
+			"store_vectors":   collection.StoreVectors,
+			"normalize":       collection.Normalize,
+			"schema":          req.Schema,
+			"cache":           cacheResponse(collection.Cache),
+			"dedup_threshold": collection.DedupThreshold,
+			"dedup_mode":      collection.DedupMode,
 		})
 	}
 }
 
 func (s *Server) handleGetCollection() gin.HandlerFunc {
 	return func(c *gin.Context) {
-		name := c.Param("name")
+		name, ok := resolveCollection(c, c.Param("name"))
+		if !ok {
+			return
+		}
 		collection, err := s.db.GetCollection(name)
 		if err != nil {
 			if err == pkgerrors.ErrCollectionNotFound {
@@ -116,203 +388,1076 @@ func (s *Server) handleGetCollection() gin.HandlerFunc {
 			}
 			return
 		}
+		schema, err := collection.ParameterSchema()
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
 
-		c.JSON(http.StatusOK, gin.H{
-			"name":      collection.Name,
-			"dimension": collection.Dimension,
-			"metadata":  collection.Metadata,
-		})
+		response := gin.H{
+			"name":            c.Param("name"),
+			"dimension":       collection.Dimension,
+			"metadata":        collection.Metadata,
+			"default_filter":  collection.DefaultFilter,
+			"store_vectors":   collection.StoreVectors,
+			"normalize":       collection.Normalize,
+			"schema":          schema,
+			"cache":           cacheResponse(collection.Cache),
+			"dedup_threshold": collection.DedupThreshold,
+			"dedup_mode":      collection.DedupMode,
+		}
+		// type, counts and settings of the index, e.g. its shards
+		if stats, err := s.db.IndexManager.Stats(name); err == nil {
+			response["index"] = stats
+		}
+		if stats, err := s.db.CollectionStats(name); err == nil {
+			response["stats"] = collectionStatsResponse(stats)
+		}
+		c.JSON(http.StatusOK, response)
 	}
 }
 
-func (s *Server) handleDeleteCollection() gin.HandlerFunc {
+// handleCollectionUsage reports the disk and memory used by a collection
+func (s *Server) handleCollectionUsage() gin.HandlerFunc {
 	return func(c *gin.Context) {
-		name := c.Param("name")
-
-		// Clear cache entries for this collection before deletion
-		if s.db.Cache != nil {
-			prefix := fmt.Sprintf("%s:", name)
-			s.db.Cache.DeleteWithPrefix(prefix)
+		name, ok := resolveCollection(c, c.Param("name"))
+		if !ok {
+			return
 		}
-
-		if err := s.db.DeleteCollection(name); err != nil {
-			if err == pkgerrors.ErrCollectionNotFound {
-				c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
-			} else {
-				c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
-			}
+		usage, err := s.db.CollectionUsage(name)
+		if errors.Is(err, pkgerrors.ErrCollectionNotFound) {
+			c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
 			return
 		}
-
-		c.Status(http.StatusOK)
-	}
-}
-
-// ListCollections returns all collection names
-func (s *Server) handleListCollections() gin.HandlerFunc {
-	return func(c *gin.Context) {
-		collectionNames, err := s.db.ListCollections()
 		if err != nil {
 			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
 			return
 		}
 
 		c.JSON(http.StatusOK, gin.H{
-			"collections": collectionNames,
-			"count":       len(collectionNames),
+			"name":               c.Param("name"),
+			"storage_bytes":      usage.StorageBytes,
+			"index_file_bytes":   usage.IndexFileBytes,
+			"wal_bytes":          usage.WALBytes,
+			"disk_bytes":         usage.DiskBytes(),
+			"index_memory_bytes": usage.IndexMemoryBytes,
 		})
 	}
 }
 
-func (s *Server) handleBuildIndex() gin.HandlerFunc {
+// defaultClusterSamples is the number of member IDs returned per cluster
+const defaultClusterSamples = 5
+
+func (s *Server) handleListClusters() gin.HandlerFunc {
 	return func(c *gin.Context) {
-		collectionName := c.Param("name")
-		var req BatchUpsertRequest
-		if err := c.ShouldBindJSON(&req); err != nil {
-			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		name, ok := resolveCollection(c, c.Param("name"))
+		if !ok {
 			return
 		}
+		samples := defaultClusterSamples
+		if v := c.Query("samples"); v != "" {
+			n, err := strconv.Atoi(v)
+			if err != nil || n < 0 {
+				c.JSON(http.StatusBadRequest, gin.H{"error": "invalid samples"})
+				return
+			}
+			samples = n
+		}
 
-		if err := s.db.BatchUpsertDocuments(collectionName, req.Documents); err != nil {
-			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		clusters, err := s.db.ListClusters(name, samples, s.requestScope(c))
+		if err != nil {
+			switch {
+			case errors.Is(err, pkgerrors.ErrCollectionNotFound), errors.Is(err, pkgerrors.ErrIndexNotFound):
+				c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+			case errors.Is(err, pkgerrors.ErrUnsupportedIndexType):
+				c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			default:
+				c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			}
 			return
 		}
 
-		c.Status(http.StatusOK)
+		response := make([]ClusterResponse, len(clusters))
+		for i, cluster := range clusters {
+			response[i] = ClusterResponse{
+				ID:        cluster.ID,
+				Centroid:  cluster.Centroid,
+				Count:     cluster.Count,
+				SampleIDs: cluster.SampleIDs,
+			}
+		}
+		c.JSON(http.StatusOK, gin.H{
+			"clusters": response,
+			"count":    len(response),
+		})
 	}
 }
 
-func (s *Server) handleUpsertDocument() gin.HandlerFunc {
+func (s *Server) handleDeleteCollection() gin.HandlerFunc {
 	return func(c *gin.Context) {
-		collectionName := c.Param("name")
-		var req UpsertDocumentRequest
-		if err := c.ShouldBindJSON(&req); err != nil {
-			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		name, ok := resolveCollection(c, c.Param("name"))
+		if !ok {
 			return
 		}
 
-		doc := &DB.Document{
-			ID:         req.ID,
-			Vector:     req.Vector,
-			Parameters: req.Parameters,
-			Dimension:  int(len(req.Vector)),
-		}
-
-		if err := s.db.UpsertDocument(collectionName, doc); err != nil {
-			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		if err := s.db.DeleteCollection(name); err != nil {
+			if errors.Is(err, pkgerrors.ErrCollectionNotFound) {
+				c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+			} else {
+				c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			}
 			return
 		}
 
-		c.JSON(http.StatusOK, gin.H{
-			"id":         doc.ID,
-			"vector":     doc.Vector,
-			"parameters": doc.Parameters,
-			"dimension":  doc.Dimension,
-		})
+		c.Status(http.StatusOK)
 	}
 }
 
-func (s *Server) handleGetDocument() gin.HandlerFunc {
+// ListCollections returns the collection names of the request tenant
+func (s *Server) handleListCollections() gin.HandlerFunc {
 	return func(c *gin.Context) {
-		collectionName := c.Param("name")
-		docID := c.Param("id")
+		tenant, err := requestTenant(c)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
 
-		doc, err := s.db.GetDocument(collectionName, docID)
+		names, err := s.db.ListCollections()
 		if err != nil {
-			c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
 			return
 		}
+		collectionNames := tenantCollections(tenant, names)
+		stats := make(map[string]CollectionStatsResponse, len(collectionNames))
+		for _, name := range collectionNames {
+			// collections deleted meanwhile are listed without counters
+			if collectionStats, err := s.db.CollectionStats(qualifiedName(tenant, name)); err == nil {
+				stats[name] = collectionStatsResponse(collectionStats)
+			}
+		}
 
-		c.JSON(http.StatusOK, gin.H{
-			"id":         doc.ID,
-			"vector":     doc.Vector,
-			"parameters": doc.Parameters,
-			"dimension":  doc.Dimension,
+		c.JSON(http.StatusOK, ListCollectionsResponse{
+			Collections: collectionNames,
+			Count:       len(collectionNames),
+			Stats:       stats,
 		})
 	}
 }
 
-func (s *Server) handleDeleteDocument() gin.HandlerFunc {
+// handleRestoreCollection brings back a deleted collection from the trash
+func (s *Server) handleRestoreCollection() gin.HandlerFunc {
 	return func(c *gin.Context) {
-		collectionName := c.Param("name")
-		docID := c.Param("id")
+		name, ok := resolveCollection(c, c.Param("name"))
+		if !ok {
+			return
+		}
 
-		doc, err := s.db.GetDocument(collectionName, docID)
-		if err != nil {
+		collection, err := s.db.RestoreCollection(name)
+		if errors.Is(err, pkgerrors.ErrCollectionNotFound) {
 			c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
 			return
 		}
-
-		if err := s.db.DeleteDocument(collectionName, docID); err != nil {
-			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		if errors.Is(err, pkgerrors.ErrInvalidParameter) {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
 			return
 		}
-
-		if s.db.Cache != nil {
-			// Delete all cached entries for this document's vector
-			prefix := fmt.Sprintf("%s:%v", collectionName, doc.Vector)
-			s.db.Cache.DeleteWithPrefix(prefix)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
 		}
 
-		c.Status(http.StatusOK)
+		c.JSON(http.StatusOK, gin.H{
+			"name":      c.Param("name"),
+			"dimension": collection.Dimension,
+		})
 	}
 }
 
-func (s *Server) handleSearchDocuments() gin.HandlerFunc {
+// handleListTrash lists the deleted collections of the request tenant that
+// can still be restored
+func (s *Server) handleListTrash() gin.HandlerFunc {
 	return func(c *gin.Context) {
-		collectionName := c.Param("name")
-		var req SearchDocumentRequest
-		if err := c.ShouldBindJSON(&req); err != nil {
+		tenant, err := requestTenant(c)
+		if err != nil {
 			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
 			return
 		}
 
-		// Create query document from request
-		queryDoc := &DB.Document{
-			Vector:    req.Vector,
-			Dimension: len(req.Vector),
-		}
-
-		// Call SearchDocuments with query document and correct field names
-		results, distances, err := s.db.SearchDocuments(collectionName, queryDoc, req.Limit, req.Filter)
+		trashed, err := s.db.ListTrash()
 		if err != nil {
 			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
 			return
 		}
-
-		// Convert results to response format
-		docs := make([]map[string]interface{}, len(results))
-		for i, doc := range results {
-			docs[i] = map[string]interface{}{
-				"id":         doc.ID,
-				"vector":     doc.Vector,
-				"parameters": doc.Parameters,
-				"dimension":  doc.Dimension,
-				"distance":   distances[i],
+		collections := make([]DB.TrashedCollection, 0, len(trashed))
+		for _, t := range trashed {
+			if names := tenantCollections(tenant, []string{t.Name}); len(names) == 1 {
+				t.Name = names[0]
+				collections = append(collections, t)
 			}
 		}
 
-		// Prepare response
-		response := gin.H{
-			"documents": docs,
-			"distances": distances,
-		}
-
-		c.JSON(http.StatusOK, response)
+		c.JSON(http.StatusOK, gin.H{
+			"collections": collections,
+			"count":       len(collections),
+		})
 	}
 }
 
-func (s *Server) handleBatchUpsertDocuments() gin.HandlerFunc {
+func (s *Server) handleBuildIndex() gin.HandlerFunc {
 	return func(c *gin.Context) {
-		collectionName := c.Param("name")
+		collectionName, ok := resolveCollection(c, c.Param("name"))
+		if !ok {
+			return
+		}
 		var req BatchUpsertRequest
-		if err := c.ShouldBindJSON(&req); err != nil {
+		if err := bindBatchUpsertRequest(c, &req); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		if err := checkBatchSize(&s.db.Config().Server, len(req.Documents)); err != nil {
 			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
 			return
 		}
 
+		if s.checkWriteScope(c, collectionName, req.Documents) {
+			return
+		}
+		if s.validateBatch(c, collectionName, req.Documents) {
+			return
+		}
+
 		if err := s.db.BatchUpsertDocuments(collectionName, req.Documents); err != nil {
-			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			writeBatchError(c, err, nil)
+			return
+		}
+
+		c.Status(http.StatusOK)
+	}
+}
+
+// checkWriteScope rejects writes of documents outside the scope of the API
+// key of a request with 403, it reports whether it responded
+func (s *Server) checkWriteScope(c *gin.Context, collectionName string, docs []*DB.Document) bool {
+	err := s.db.CheckWriteScope(collectionName, docs, s.requestScope(c))
+	if err == nil {
+		return false
+	}
+	if errors.Is(err, pkgerrors.ErrOutOfScope) {
+		c.JSON(http.StatusForbidden, gin.H{"error": err.Error()})
+	} else {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+	}
+	return true
+}
+
+// validateBatch answers a batch write with ?dry_run=true with the documents
+// it would reject, embeddings are generated unless ?skip_embedding=true. It
+// returns whether it responded, the batch is written otherwise
+func (s *Server) validateBatch(c *gin.Context, collectionName string, docs []*DB.Document) bool {
+	flags := map[string]bool{"dry_run": false, "skip_embedding": false}
+	for name := range flags {
+		if v := c.Query(name); v != "" {
+			b, err := strconv.ParseBool(v)
+			if err != nil {
+				c.JSON(http.StatusBadRequest, gin.H{"error": "invalid " + name})
+				return true
+			}
+			flags[name] = b
+		}
+	}
+	if !flags["dry_run"] {
+		return false
+	}
+
+	validation, err := s.db.ValidateBatch(collectionName, docs, !flags["skip_embedding"])
+	if errors.Is(err, pkgerrors.ErrCollectionNotFound) {
+		c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+		return true
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return true
+	}
+	response := BatchValidationResponse{DryRun: true, Valid: validation.Valid, Failed: make([]DocumentFailure, len(validation.Errors))}
+	for i, e := range validation.Errors {
+		response.Failed[i] = DocumentFailure{Index: e.Index, ID: e.ID, Error: e.Err.Error()}
+	}
+	c.JSON(http.StatusOK, response)
+	return true
+}
+
+// writeBatchError reports a failed batch write, documents skipped because of
+// embedding failures are listed with 207 when the rest were written, with
+// the documents deduplicated
+func writeBatchError(c *gin.Context, err error, duplicates []DB.DedupMatch) {
+	if errors.Is(err, pkgerrors.ErrInvalidParameter) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if errors.Is(err, pkgerrors.ErrWriteStall) {
+		c.Header("Retry-After", "1")
+		c.JSON(http.StatusServiceUnavailable, gin.H{"error": err.Error()})
+		return
+	}
+	var embedErr *DB.BatchEmbeddingError
+	if !errors.As(err, &embedErr) {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	failed := make([]BatchFailure, len(embedErr.Failures))
+	for i, f := range embedErr.Failures {
+		failed[i] = BatchFailure{ID: f.ID, Error: f.Err.Error()}
+	}
+	status := http.StatusMultiStatus
+	if embedErr.Succeeded == 0 {
+		status = http.StatusInternalServerError
+	}
+	response := gin.H{
+		"error":     err.Error(),
+		"succeeded": embedErr.Succeeded,
+		"failed":    failed,
+	}
+	if len(duplicates) > 0 {
+		response["duplicates"] = duplicateResponses(duplicates)
+	}
+	c.JSON(status, response)
+}
+
+func (s *Server) handleUpsertDocument() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		collectionName, ok := resolveCollection(c, c.Param("name"))
+		if !ok {
+			return
+		}
+		var req UpsertDocumentRequest
+		if err := bindJSON(c, &req); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+
+		doc := &DB.Document{
+			ID:         req.ID,
+			Vector:     req.Vector,
+			Parameters: req.Parameters,
+			Dimension:  int(len(req.Vector)),
+		}
+		if s.checkWriteScope(c, collectionName, []*DB.Document{doc}) {
+			return
+		}
+
+		match, err := s.db.UpsertDocumentDedup(collectionName, doc)
+		if err != nil {
+			if errors.Is(err, pkgerrors.ErrInvalidParameter) {
+				c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			} else if errors.Is(err, pkgerrors.ErrWriteStall) {
+				c.Header("Retry-After", "1")
+				c.JSON(http.StatusServiceUnavailable, gin.H{"error": err.Error()})
+			} else {
+				c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			}
+			return
+		}
+
+		response := gin.H{
+			"id":         doc.ID,
+			"vector":     doc.Vector,
+			"parameters": doc.Parameters,
+			"dimension":  doc.Dimension,
+		}
+		// the document wasn't written, an existing one is near identical
+		if match != nil {
+			response["duplicate"] = duplicateResponses([]DB.DedupMatch{*match})[0]
+		}
+		c.JSON(http.StatusOK, response)
+	}
+}
+
+func (s *Server) handleGetDocument() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		collectionName, ok := resolveCollection(c, c.Param("name"))
+		if !ok {
+			return
+		}
+		docID := c.Param("id")
+
+		doc, err := s.db.GetScopedDocument(collectionName, docID, s.requestScope(c))
+		if err != nil {
+			c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+			return
+		}
+
+		c.JSON(http.StatusOK, gin.H{
+			"id":         doc.ID,
+			"vector":     doc.Vector,
+			"parameters": doc.Parameters,
+			"dimension":  doc.Dimension,
+		})
+	}
+}
+
+func (s *Server) handleDeleteDocument() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		collectionName, ok := resolveCollection(c, c.Param("name"))
+		if !ok {
+			return
+		}
+		docID := c.Param("id")
+
+		// documents outside the scope of the API key can't be deleted either
+		if _, err := s.db.GetScopedDocument(collectionName, docID, s.requestScope(c)); err != nil {
+			c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+			return
+		}
+
+		if err := s.db.DeleteDocument(collectionName, docID); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+
+		c.Status(http.StatusOK)
+	}
+}
+
+func (s *Server) handleSearchDocuments() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		collectionName, ok := resolveCollection(c, c.Param("name"))
+		if !ok {
+			return
+		}
+		start := time.Now()
+		debug, err := debugRequested(c)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		var req SearchDocumentRequest
+		if err := bindSearchRequest(c, &req, &req.Vector); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		topN := 0
+		if req.Rerank != nil {
+			topN = req.Rerank.TopN
+		}
+		if err := checkSearchLimits(&s.db.Config().Server, req.Limit, req.Offset, topN, req.Params); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+
+		if len(req.Vector) > 0 && req.QueryText != "" {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "only one of vector and query_text can be set"})
+			return
+		}
+		if len(req.Vector) == 0 && req.QueryText == "" {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "vector or query_text is required"})
+			return
+		}
+		var embedDuration time.Duration
+		if req.QueryText != "" {
+			embedStart := time.Now()
+			vector, err := s.embedQueryText(c, req.QueryText)
+			if err != nil {
+				c.JSON(http.StatusInternalServerError, gin.H{"error": fmt.Sprintf("failed to generate embedding: %v", err)})
+				return
+			}
+			req.Vector = vector
+			embedDuration = time.Since(embedStart)
+		}
+
+		// Create query document from request
+		queryDoc := &DB.Document{
+			Vector:    req.Vector,
+			Dimension: len(req.Vector),
+		}
+		if req.QueryText != "" {
+			// kept for text-based rerankers, the vector is already set
+			queryDoc.Parameters = map[string]any{"text": req.QueryText}
+		}
+
+		var results []*DB.Document
+		var distances []float32
+		var scores []float64
+		var total int
+		var timings DB.SearchTimings
+		opts := append(searchOptions(req.MaxDistance, req.Offset, req.Params, req.RerankExact, &total), DB.WithTimings(&timings), DB.WithScopeFilter(s.requestScope(c)))
+		if req.Rerank != nil {
+			results, distances, scores, err = s.db.SearchDocumentsReranked(c.Request.Context(), collectionName, queryDoc, req.Limit, req.Filter, rerankOptions(req.Rerank), opts...)
+		} else {
+			results, distances, err = s.db.SearchDocuments(c.Request.Context(), collectionName, queryDoc, req.Limit, req.Filter, opts...)
+		}
+		if errors.Is(err, pkgerrors.ErrInvalidParameter) {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+
+		// Convert results to response format
+		docs := make([]map[string]interface{}, len(results))
+		for i, doc := range results {
+			docs[i] = map[string]interface{}{
+				"id":         doc.ID,
+				"vector":     doc.Vector,
+				"parameters": doc.Parameters,
+				"dimension":  doc.Dimension,
+				"distance":   distances[i],
+			}
+			if scores != nil {
+				docs[i]["rerank_score"] = scores[i]
+			}
+		}
+
+		// Prepare response
+		response := gin.H{
+			"documents":        docs,
+			"distances":        distances,
+			"total_candidates": total,
+		}
+		if debug {
+			response["debug"] = newSearchDebug(start, embedDuration, timings)
+		}
+
+		c.JSON(http.StatusOK, response)
+	}
+}
+
+// handleMultiSearch searches a query across several collections, e.g. one
+// per language, and merges the results by weighted distance
+func (s *Server) handleMultiSearch() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var req MultiSearchRequest
+		if err := bindJSON(c, &req); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		if err := checkSearchLimits(&s.db.Config().Server, req.Limit, req.Offset, 0, nil); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		if len(req.Vector) > 0 && req.QueryText != "" {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "only one of vector and query_text can be set"})
+			return
+		}
+		if len(req.Vector) == 0 && req.QueryText == "" {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "vector or query_text is required"})
+			return
+		}
+
+		// results name the collections as the request did, without the tenant
+		names := make(map[string]string, len(req.Collections))
+		targets := make([]DB.MultiSearchTarget, len(req.Collections))
+		for i, collection := range req.Collections {
+			name, ok := resolveCollection(c, collection.Name)
+			if !ok {
+				return
+			}
+			names[name] = collection.Name
+			targets[i] = DB.MultiSearchTarget{Collection: name, Weight: collection.Weight}
+		}
+
+		if req.QueryText != "" {
+			vector, err := s.embedQueryText(c, req.QueryText)
+			if err != nil {
+				c.JSON(http.StatusInternalServerError, gin.H{"error": fmt.Sprintf("failed to generate embedding: %v", err)})
+				return
+			}
+			req.Vector = vector
+		}
+
+		queryDoc := &DB.Document{Vector: req.Vector, Dimension: len(req.Vector)}
+		results, err := s.db.SearchMultiple(c.Request.Context(), targets, queryDoc, req.Limit, req.Filter, req.Offset, DB.WithScopeFilter(s.requestScope(c)))
+		switch {
+		case errors.Is(err, pkgerrors.ErrInvalidParameter):
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		case errors.Is(err, pkgerrors.ErrCollectionNotFound):
+			c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+			return
+		case err != nil:
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+
+		response := make([]MultiSearchResult, len(results))
+		for i, result := range results {
+			response[i] = MultiSearchResult{
+				Collection:       names[result.Collection],
+				ID:               result.Document.ID,
+				Vector:           result.Document.Vector,
+				Parameters:       result.Document.Parameters,
+				Dimension:        result.Document.Dimension,
+				Distance:         result.Distance,
+				WeightedDistance: result.WeightedDistance,
+			}
+		}
+		c.JSON(http.StatusOK, gin.H{"results": response})
+	}
+}
+
+// noCache reports whether the request asks for a fresh search with
+// Cache-Control: no-cache, e.g. to benchmark uncached latencies
+// debugRequested reports whether a search asked for the debug section of
+// its response with ?debug=true
+func debugRequested(c *gin.Context) (bool, error) {
+	v := c.Query("debug")
+	if v == "" {
+		return false, nil
+	}
+	debug, err := strconv.ParseBool(v)
+	if err != nil {
+		return false, fmt.Errorf("invalid debug: %q", v)
+	}
+	return debug, nil
+}
+
+func noCache(c *gin.Context) bool {
+	for _, directive := range strings.Split(c.GetHeader("Cache-Control"), ",") {
+		if strings.EqualFold(strings.TrimSpace(directive), "no-cache") {
+			return true
+		}
+	}
+	return false
+}
+
+// searchOptions converts the optional search settings of a request, total
+// receives the number of candidates found for the requested page
+func searchOptions(maxDistance *float32, offset int, params map[string]any, rerankExact bool, total *int) []DB.SearchOption {
+	opts := []DB.SearchOption{DB.WithOffset(offset), DB.WithTotalCandidates(total), DB.WithSearchParams(params)}
+	if maxDistance != nil {
+		opts = append(opts, DB.WithMaxDistance(*maxDistance))
+	}
+	if rerankExact {
+		opts = append(opts, DB.WithExactRerank())
+	}
+	return opts
+}
+
+// rerankOptions converts a rerank request, MMR lambda defaults to 0.5
+func rerankOptions(req *RerankRequest) DB.RerankOptions {
+	opts := DB.RerankOptions{
+		Options: rerank.Options{
+			Type:   req.Type,
+			Lambda: rerank.DefaultLambda,
+			Model:  req.Model,
+		},
+		TopN: req.TopN,
+	}
+	if req.Lambda != nil {
+		opts.Lambda = *req.Lambda
+	}
+	return opts
+}
+
+func (s *Server) handleBatchUpsertDocuments() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		collectionName, ok := resolveCollection(c, c.Param("name"))
+		if !ok {
+			return
+		}
+		var req BatchUpsertRequest
+		if err := bindBatchUpsertRequest(c, &req); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		if err := checkBatchSize(&s.db.Config().Server, len(req.Documents)); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+
+		if s.checkWriteScope(c, collectionName, req.Documents) {
+			return
+		}
+		if s.validateBatch(c, collectionName, req.Documents) {
+			return
+		}
+
+		duplicates, err := s.db.BatchUpsertDocumentsDedup(collectionName, req.Documents)
+		if err != nil {
+			writeBatchError(c, err, duplicates)
+			return
+		}
+
+		if len(duplicates) > 0 {
+			c.JSON(http.StatusOK, gin.H{"duplicates": duplicateResponses(duplicates)})
+			return
+		}
+		c.Status(http.StatusOK)
+	}
+}
+
+// handleIngestDocument splits a long text into chunk documents and upserts
+// them with automatic embedding
+func (s *Server) handleIngestDocument() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		collectionName, ok := resolveCollection(c, c.Param("name"))
+		if !ok {
+			return
+		}
+		var req IngestDocumentRequest
+		if err := bindJSON(c, &req); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+
+		ids, err := s.db.IngestDocument(collectionName, DB.IngestOptions{
+			ID:         req.ID,
+			Text:       req.Text,
+			Parameters: req.Parameters,
+			Chunking:   req.Chunking,
+			StartID:    req.StartID,
+		})
+		if errors.Is(err, pkgerrors.ErrInvalidParameter) || errors.Is(err, pkgerrors.ErrEmptyParameter) {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		if err != nil {
+			writeBatchError(c, err, nil)
+			return
+		}
+
+		c.JSON(http.StatusOK, gin.H{
+			"ids":   ids,
+			"count": len(ids),
+		})
+	}
+}
+
+// handleArchiveDocuments moves documents nobody read recently out of the
+// vector index, an empty body uses the configured threshold
+func (s *Server) handleArchiveDocuments() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		collectionName, ok := resolveCollection(c, c.Param("name"))
+		if !ok {
+			return
+		}
+		var req ArchiveRequest
+		if c.Request.ContentLength > 0 {
+			if err := bindJSON(c, &req); err != nil {
+				c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+				return
+			}
+		}
+		if req.UnreadDays <= 0 {
+			req.UnreadDays = s.db.ArchiveAfterDays()
+		}
+		if req.UnreadDays <= 0 {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "unread_days is required when archive.after_days is not configured"})
+			return
+		}
+
+		ids, err := s.db.ArchiveDocuments(collectionName, time.Duration(req.UnreadDays)*24*time.Hour, s.requestScope(c))
+		if errors.Is(err, pkgerrors.ErrCollectionNotFound) {
+			c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+			return
+		}
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+
+		auditDetails(c, map[string]any{"unread_days": req.UnreadDays, "archived": ids})
+		c.JSON(http.StatusOK, gin.H{
+			"archived": ids,
+			"count":    len(ids),
+		})
+	}
+}
+
+// handleRebuildIndex recreates a collection's index from the vectors it
+// stores in scalar storage
+func (s *Server) handleRebuildIndex() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		collectionName, ok := resolveCollection(c, c.Param("name"))
+		if !ok {
+			return
+		}
+		count, err := s.db.RebuildIndex(collectionName)
+		if errors.Is(err, pkgerrors.ErrCollectionNotFound) {
+			c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+			return
+		}
+		if errors.Is(err, pkgerrors.ErrInvalidParameter) {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+
+		c.JSON(http.StatusOK, gin.H{"count": count})
+	}
+}
+
+// handleCloneCollection copies the documents of a collection into a new one,
+// e.g. to compare index types or parameters on real data
+func (s *Server) handleCloneCollection() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		collectionName, ok := resolveCollection(c, c.Param("name"))
+		if !ok {
+			return
+		}
+		var req CloneRequest
+		if err := bindJSON(c, &req); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		target, ok := resolveCollection(c, req.Target)
+		if !ok {
+			return
+		}
+
+		clone, count, err := s.db.CloneCollection(collectionName, DB.CloneOptions{
+			Target:     target,
+			IndexType:  req.IndexType,
+			Parameters: req.IndexParams,
+		})
+		switch {
+		case errors.Is(err, pkgerrors.ErrCollectionNotFound):
+			c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+			return
+		case errors.Is(err, pkgerrors.ErrCollectionExists):
+			c.JSON(http.StatusConflict, gin.H{"error": err.Error()})
+			return
+		case errors.Is(err, pkgerrors.ErrInvalidParameter):
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		case err != nil:
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+
+		c.JSON(http.StatusOK, gin.H{
+			"name":       req.Target,
+			"index_type": clone.IndexType,
+			"metadata":   clone.Metadata,
+			"count":      count,
+		})
+	}
+}
+
+// handleReindex starts rebuilding the index of a collection with new settings
+// in the background, the new index replaces the current one once built
+func (s *Server) handleReindex() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		collectionName, ok := resolveCollection(c, c.Param("name"))
+		if !ok {
+			return
+		}
+		var req ReindexRequest
+		if err := bindJSON(c, &req); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+
+		status, err := s.db.Reindex(collectionName, DB.ReindexOptions{
+			IndexType:  req.IndexType,
+			Parameters: req.Parameters,
+		})
+		switch {
+		case errors.Is(err, pkgerrors.ErrCollectionNotFound):
+			c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+			return
+		case errors.Is(err, pkgerrors.ErrInvalidParameter):
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		case err != nil:
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+
+		c.JSON(http.StatusAccepted, status)
+	}
+}
+
+// handleReindexStatus reports the last reindex of a collection
+func (s *Server) handleReindexStatus() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		collectionName, ok := resolveCollection(c, c.Param("name"))
+		if !ok {
+			return
+		}
+		status, ok := s.db.ReindexStatus(collectionName)
+		if !ok {
+			c.JSON(http.StatusNotFound, gin.H{"error": "collection was not reindexed"})
+			return
+		}
+		c.JSON(http.StatusOK, status)
+	}
+}
+
+// handleListJobs reports the running index builds of the request tenant and
+// the last finished ones, ?collection= narrows them to one collection
+func (s *Server) handleListJobs() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		tenant, err := requestTenant(c)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		var collectionName string
+		if name := c.Query("collection"); name != "" {
+			var ok bool
+			if collectionName, ok = resolveCollection(c, name); !ok {
+				return
+			}
+		}
+
+		jobs := make([]index.BuildJob, 0)
+		for _, job := range s.db.IndexManager.Jobs(collectionName) {
+			names := tenantCollections(tenant, []string{job.Collection})
+			if len(names) == 0 {
+				continue // a build of another tenant
+			}
+			job.Collection = names[0]
+			jobs = append(jobs, job)
+		}
+		c.JSON(http.StatusOK, ListJobsResponse{Jobs: jobs, Count: len(jobs)})
+	}
+}
+
+// handleVacuum purges the deleted elements of a collection's index
+func (s *Server) handleVacuum() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		collectionName, ok := resolveCollection(c, c.Param("name"))
+		if !ok {
+			return
+		}
+		purged, err := s.db.VacuumCollection(collectionName)
+		switch {
+		case errors.Is(err, pkgerrors.ErrCollectionNotFound):
+			c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+			return
+		case errors.Is(err, pkgerrors.ErrUnsupportedIndexType):
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		case err != nil:
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+
+		c.JSON(http.StatusOK, gin.H{"purged": purged})
+	}
+}
+
+// handleScrollDocuments returns one page of a scroll over all documents of a
+// collection, the response cursor is empty after the last page
+func (s *Server) handleScrollDocuments() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		collectionName, ok := resolveCollection(c, c.Param("name"))
+		if !ok {
+			return
+		}
+		var req ScrollRequest
+		if c.Request.ContentLength > 0 {
+			if err := bindJSON(c, &req); err != nil {
+				c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+				return
+			}
+		}
+
+		page, err := s.db.ScrollDocuments(collectionName, DB.ScrollOptions{
+			Filter:    req.Filter,
+			Size:      req.Size,
+			Cursor:    req.Cursor,
+			KeepAlive: time.Duration(req.KeepAliveSeconds) * time.Second,
+			Snapshot:  req.Snapshot,
+			Scope:     s.requestScope(c),
+		})
+		if errors.Is(err, pkgerrors.ErrCollectionNotFound) {
+			c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+			return
+		}
+		if errors.Is(err, pkgerrors.ErrInvalidParameter) {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+
+		response := gin.H{
+			"documents": page.Documents,
+			"count":     len(page.Documents),
+			"cursor":    page.Cursor,
+		}
+		// the write sequence the snapshot was taken at, backups record it
+		if page.Seq > 0 {
+			response["seq"] = page.Seq
+		}
+		c.JSON(http.StatusOK, response)
+	}
+}
+
+// handleListDocumentIDs pages through the document IDs of a collection, the
+// cursor of a page is the last ID it holds
+func (s *Server) handleListDocumentIDs() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		collectionName, ok := resolveCollection(c, c.Param("name"))
+		if !ok {
+			return
+		}
+		limit := 0
+		if v := c.Query("limit"); v != "" {
+			n, err := strconv.Atoi(v)
+			if err != nil || n < 0 {
+				c.JSON(http.StatusBadRequest, gin.H{"error": "invalid limit"})
+				return
+			}
+			limit = n
+		}
+
+		page, err := s.db.ListDocumentIDs(collectionName, limit, c.Query("cursor"), s.requestScope(c))
+		if errors.Is(err, pkgerrors.ErrCollectionNotFound) {
+			c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+			return
+		}
+		if errors.Is(err, pkgerrors.ErrInvalidParameter) {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+		c.JSON(http.StatusOK, gin.H{
+			"ids":    page.IDs,
+			"count":  len(page.IDs),
+			"cursor": page.Cursor,
+		})
+	}
+}
+
+// handleRestoreDocument moves an archived document back into the vector index
+func (s *Server) handleRestoreDocument() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		collectionName, ok := resolveCollection(c, c.Param("name"))
+		if !ok {
+			return
+		}
+		id := c.Param("id")
+
+		// documents outside the scope of the API key can't be restored either
+		if _, err := s.db.GetScopedDocument(collectionName, id, s.requestScope(c)); err != nil {
+			c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+			return
+		}
+
+		err := s.db.RestoreDocument(collectionName, id)
+		if errors.Is(err, pkgerrors.ErrInvalidParameter) {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		if errors.Is(err, pkgerrors.ErrDocumentNotFound) {
+			c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+			return
+		}
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
 			return
 		}
 
@@ -324,21 +1469,35 @@ func (s *Server) handleBatchUpsertDocuments() gin.HandlerFunc {
 // Currently supported parameters:
 //   - efsearch : HNSW indices (improves recall at the cost of speed)
 //   - nprobe   : IVF indices  (controls the number of inverted lists scanned)
+//   - auto_nprobe : IVF indices (adapts nprobe to each query)
 func (s *Server) handleSetParams() gin.HandlerFunc {
 	return func(c *gin.Context) {
-		collectionName := c.Param("name")
+		collectionName, ok := resolveCollection(c, c.Param("name"))
+		if !ok {
+			return
+		}
 
 		var req SetParamsRequest
-		if err := c.ShouldBindJSON(&req); err != nil {
+		if err := bindJSON(c, &req); err != nil {
 			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
 			return
 		}
+		auditDetails(c, map[string]any{"parameters": req.Parameters})
 
-		idx, err := s.db.IndexManager.GetIndex(collectionName)
+		if _, err := s.db.GetCollection(collectionName); err != nil {
+			if errors.Is(err, pkgerrors.ErrCollectionNotFound) {
+				c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+			} else {
+				c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			}
+			return
+		}
+		idx, release, err := s.db.IndexManager.AcquireIndex(collectionName)
 		if err != nil {
 			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
 			return
 		}
+		defer release()
 
 		if err := idx.SetParams(req.Parameters); err != nil {
 			if errors.Is(err, pkgerrors.ErrInvalidParameter) {
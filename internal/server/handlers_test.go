@@ -2,20 +2,40 @@ package server
 
 import (
 	"bytes"
+	"compress/gzip"
+	"encoding/binary"
 	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"net"
 	"net/http"
 	"net/http/httptest"
+	"net/url"
 	"os"
+	"strings"
 	"testing"
+	"time"
 
+	"oasisdb/internal/chunk"
 	"oasisdb/internal/config"
 	"oasisdb/internal/db"
 	"oasisdb/internal/index"
+	"oasisdb/internal/replication"
+	pkgerrors "oasisdb/pkg/errors"
+	"oasisdb/pkg/logger"
 
+	"github.com/gin-gonic/gin"
 	"github.com/stretchr/testify/assert"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/propagation"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+	semconv "go.opentelemetry.io/otel/semconv/v1.26.0"
 )
 
-func setupTestServer(t *testing.T) (*Server, func()) {
+func setupTestServer(t *testing.T, configure ...func(*config.Config)) (*Server, func()) {
 	// Create a temporary directory for testing
 	tmpDir, err := os.MkdirTemp("", "oasisdb_test_*")
 	assert.NoError(t, err)
@@ -23,6 +43,9 @@ func setupTestServer(t *testing.T) (*Server, func()) {
 	// Create config
 	conf, err := config.NewConfig(tmpDir)
 	assert.NoError(t, err)
+	for _, fn := range configure {
+		fn(conf)
+	}
 
 	// Create DB
 	db, err := db.New(conf)
@@ -84,7 +107,57 @@ func TestHandleCreateCollection(t *testing.T) {
 	r = httptest.NewRequest(http.MethodPost, "/v1/collections", bytes.NewReader(body))
 	server.router.ServeHTTP(w, r)
 
-	assert.Equal(t, http.StatusInternalServerError, w.Code)
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+	assert.Contains(t, w.Body.String(), "dimension is required")
+}
+
+func TestHandleRequestValidation(t *testing.T) {
+	server, cleanup := setupTestServer(t)
+	defer cleanup()
+
+	post := func(path, body string) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		server.router.ServeHTTP(w, httptest.NewRequest(http.MethodPost, path, bytes.NewBufferString(body)))
+		return w
+	}
+	assert.Equal(t, http.StatusOK, post("/v1/collections", `{"name":"docs-1_a","dimension":2}`).Code)
+	assert.Equal(t, http.StatusOK, post("/v1/collections/docs-1_a/documents", `{"id":"1","vector":[1,0]}`).Code)
+
+	for _, tc := range []struct {
+		path, body, message string
+	}{
+		{"/v1/collections", `{"dimension":2}`, "name is required"},
+		{"/v1/collections", `{"name":"a/b","dimension":2}`, "name must be 1 to 64 letters, digits, '_' or '-'"},
+		{"/v1/collections", `{"name":"a:b","dimension":2}`, "name must be"},
+		{"/v1/collections", `{"name":"docs","dimension":0}`, "dimension is required"},
+		{"/v1/collections", `{"name":"docs","dimension":2,"dedup_mode":"drop"}`, "dedup_mode must be one of skip, merge"},
+		{"/v1/collections", `{"name":"docs","dimension":2,"dedup_threshold":-1}`, "dedup_threshold must be at least 0"},
+		{"/v1/collections/docs-1_a/clone", `{}`, "target is required"},
+		{"/v1/collections/docs-1_a/documents", `{"vector":[1,0]}`, "id is required"},
+		{"/v1/collections/docs-1_a/vectors/search", `{"vector":[1,0]}`, "limit is required without max_distance"},
+		{"/v1/collections/docs-1_a/vectors/search", `{"vector":[1,0],"limit":10001}`, "limit must be at most 10000"},
+		{"/v1/collections/docs-1_a/documents/search", `{"vector":[1,0],"limit":-1,"max_distance":1}`, "limit must be at least 0"},
+		{"/v1/collections/docs-1_a/documents/search", `{"vector":[1,0],"limit":1,"offset":-1}`, "offset must be at least 0"},
+		{"/v1/collections/docs-1_a/documents/search", `{"vector":[1,0],"limit":1,"rerank":{}}`, "rerank.type is required"},
+	} {
+		w := post(tc.path, tc.body)
+		assert.Equal(t, http.StatusBadRequest, w.Code, tc.body)
+		assert.Contains(t, w.Body.String(), tc.message, tc.body)
+	}
+
+	// a range search needs no limit, binary headers are checked too
+	assert.Equal(t, http.StatusOK, post("/v1/collections/docs-1_a/vectors/search", `{"vector":[1,0],"max_distance":1}`).Code)
+	header := []byte(`{"limit":0}`)
+	body := binary.LittleEndian.AppendUint32(nil, uint32(len(header)))
+	body = append(body, header...)
+	body = binary.LittleEndian.AppendUint32(body, math.Float32bits(1))
+	body = binary.LittleEndian.AppendUint32(body, math.Float32bits(0))
+	w := httptest.NewRecorder()
+	r := httptest.NewRequest(http.MethodPost, "/v1/collections/docs-1_a/vectors/search", bytes.NewReader(body))
+	r.Header.Set("Content-Type", binaryContentType)
+	server.router.ServeHTTP(w, r)
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+	assert.Contains(t, w.Body.String(), "limit is required")
 }
 
 func TestHandleGetCollection(t *testing.T) {
@@ -118,6 +191,27 @@ func TestHandleGetCollection(t *testing.T) {
 	assert.NoError(t, err)
 	assert.Equal(t, req.Name, resp.Name)
 	assert.Equal(t, req.Dimension, resp.Dimension)
+	assert.Equal(t, index.HNSWIndex, resp.Index.Type)
+	assert.Zero(t, resp.Stats.Documents)
+	assert.NotNil(t, resp.Stats.CreatedAt)
+
+	// shards are set at creation and reported with the index
+	body, err = json.Marshal(CreateCollectionRequest{Name: "sharded", Dimension: 4, IndexType: "flat",
+		Parameters: map[string]string{"shards": "4"}})
+	assert.NoError(t, err)
+	w = httptest.NewRecorder()
+	server.router.ServeHTTP(w, httptest.NewRequest(http.MethodPost, "/v1/collections", bytes.NewReader(body)))
+	assert.Equal(t, http.StatusOK, w.Code)
+	w = httptest.NewRecorder()
+	server.router.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/v1/collections/sharded", nil))
+	assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &resp))
+	assert.Equal(t, float64(4), resp.Index.Params["shards"])
+
+	body, err = json.Marshal(CreateCollectionRequest{Name: "bad", Dimension: 4, Parameters: map[string]string{"shards": "0"}})
+	assert.NoError(t, err)
+	w = httptest.NewRecorder()
+	server.router.ServeHTTP(w, httptest.NewRequest(http.MethodPost, "/v1/collections", bytes.NewReader(body)))
+	assert.Equal(t, http.StatusBadRequest, w.Code)
 
 	// Test get non-existent collection
 	w = httptest.NewRecorder()
@@ -165,7 +259,53 @@ func TestHandleDeleteCollection(t *testing.T) {
 	r = httptest.NewRequest(http.MethodDelete, "/v1/collections/non_existent", nil)
 	server.router.ServeHTTP(w, r)
 
-	assert.Equal(t, http.StatusInternalServerError, w.Code)
+	assert.Equal(t, http.StatusNotFound, w.Code)
+}
+
+func TestHandleRestoreCollection(t *testing.T) {
+	server, cleanup := setupTestServer(t)
+	defer cleanup()
+
+	do := func(method, url string, tenant string) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		r := httptest.NewRequest(method, url, nil)
+		if tenant != "" {
+			r.Header.Set(TenantHeader, tenant)
+		}
+		server.router.ServeHTTP(w, r)
+		return w
+	}
+	body, err := json.Marshal(CreateCollectionRequest{Name: "docs", IndexType: "hnsw", Dimension: 3})
+	assert.NoError(t, err)
+	for _, tenant := range []string{"", "acme"} {
+		w := httptest.NewRecorder()
+		r := httptest.NewRequest(http.MethodPost, "/v1/collections", bytes.NewReader(body))
+		r.Header.Set(TenantHeader, tenant)
+		server.router.ServeHTTP(w, r)
+		assert.Equal(t, http.StatusOK, w.Code)
+	}
+
+	assert.Equal(t, http.StatusBadRequest, do(http.MethodPost, "/v1/collections/docs/restore", "").Code)
+	assert.Equal(t, http.StatusOK, do(http.MethodDelete, "/v1/collections/docs", "acme").Code)
+	assert.Equal(t, http.StatusNotFound, do(http.MethodGet, "/v1/collections/docs", "acme").Code)
+
+	// each tenant only sees its own trash
+	var trash struct {
+		Collections []db.TrashedCollection `json:"collections"`
+		Count       int                    `json:"count"`
+	}
+	w := do(http.MethodGet, "/v1/trash", "acme")
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &trash))
+	assert.Equal(t, 1, trash.Count)
+	assert.Equal(t, "docs", trash.Collections[0].Name)
+	w = do(http.MethodGet, "/v1/trash", "")
+	assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &trash))
+	assert.Equal(t, 0, trash.Count)
+
+	assert.Equal(t, http.StatusNotFound, do(http.MethodPost, "/v1/collections/missing/restore", "acme").Code)
+	assert.Equal(t, http.StatusOK, do(http.MethodPost, "/v1/collections/docs/restore", "acme").Code)
+	assert.Equal(t, http.StatusOK, do(http.MethodGet, "/v1/collections/docs", "acme").Code)
 }
 
 func TestHandleUpsertDocument(t *testing.T) {
@@ -230,6 +370,469 @@ func TestHandleUpsertDocument(t *testing.T) {
 	t.Log(w.Body.String())
 }
 
+func TestHandleSchema(t *testing.T) {
+	server, cleanup := setupTestServer(t)
+	defer cleanup()
+
+	post := func(path, body string) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		server.router.ServeHTTP(w, httptest.NewRequest(http.MethodPost, path, bytes.NewBufferString(body)))
+		return w
+	}
+
+	w := post("/v1/collections", `{"name":"bad","dimension":2,"schema":{"fields":[{"name":"year","type":"date"}]}}`)
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+
+	w = post("/v1/collections", `{"name":"movies","dimension":2,"schema":{"fields":[{"name":"genre","type":"keyword","required":true},{"name":"year","type":"number"}]}}`)
+	assert.Equal(t, http.StatusOK, w.Code)
+
+	w = httptest.NewRecorder()
+	server.router.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/v1/collections/movies", nil))
+	assert.Equal(t, http.StatusOK, w.Code)
+	var collection struct {
+		Schema db.Schema `json:"schema"`
+	}
+	assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &collection))
+	assert.Equal(t, []db.SchemaField{
+		{Name: "genre", Type: db.FieldKeyword, Required: true},
+		{Name: "year", Type: db.FieldNumber},
+	}, collection.Schema.Fields)
+
+	w = post("/v1/collections/movies/documents", `{"id":"1","vector":[1,0],"parameters":{"genre":"drama","year":1999}}`)
+	assert.Equal(t, http.StatusOK, w.Code)
+	w = post("/v1/collections/movies/documents", `{"id":"2","vector":[1,0],"parameters":{"year":"1999"}}`)
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+	w = post("/v1/collections/movies/documents/batchupsert", `{"documents":[{"id":"3","vector":[0,1]}]}`)
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+
+	// a dry run reports every rejected document and writes nothing
+	batch := `{"documents":[{"id":"4","vector":[0,1],"parameters":{"genre":"drama"}},{"id":"3","vector":[0,1]},{"id":"4","vector":[1,0]}]}`
+	for _, path := range []string{"documents/batchupsert", "buildindex"} {
+		w = post("/v1/collections/movies/"+path+"?dry_run=true", batch)
+		assert.Equal(t, http.StatusOK, w.Code, path)
+		var validation BatchValidationResponse
+		assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &validation))
+		assert.True(t, validation.DryRun)
+		assert.Equal(t, 1, validation.Valid)
+		assert.Equal(t, []int{1, 2}, []int{validation.Failed[0].Index, validation.Failed[1].Index})
+		assert.Equal(t, "3", validation.Failed[0].ID)
+	}
+	w = httptest.NewRecorder()
+	server.router.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/v1/collections/movies/documents/4", nil))
+	assert.Equal(t, http.StatusNotFound, w.Code)
+	w = post("/v1/collections/movies/documents/batchupsert?dry_run=maybe", batch)
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+	w = post("/v1/collections/missing/documents/batchupsert?dry_run=true", batch)
+	assert.Equal(t, http.StatusNotFound, w.Code)
+}
+
+func TestHandleSearchCache(t *testing.T) {
+	server, cleanup := setupTestServer(t)
+	defer cleanup()
+
+	do := func(method, path, body string, header ...string) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		r := httptest.NewRequest(method, path, bytes.NewBufferString(body))
+		if len(header) == 2 {
+			r.Header.Set(header[0], header[1])
+		}
+		server.router.ServeHTTP(w, r)
+		return w
+	}
+
+	w := do(http.MethodPost, "/v1/collections", `{"name":"bad","dimension":2,"cache":{"ttl_seconds":-1}}`)
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+	w = do(http.MethodPost, "/v1/collections", `{"name":"cached","dimension":2}`)
+	assert.Equal(t, http.StatusOK, w.Code)
+	w = do(http.MethodPost, "/v1/collections", `{"name":"uncached","dimension":2,"cache":{"enabled":false}}`)
+	assert.Equal(t, http.StatusOK, w.Code)
+
+	w = do(http.MethodGet, "/v1/collections/uncached", "")
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Contains(t, w.Body.String(), `"cache":{"enabled":false}`)
+
+	for _, name := range []string{"cached", "uncached"} {
+		w = do(http.MethodPost, "/v1/collections/"+name+"/documents", `{"id":"1","vector":[1,0]}`)
+		assert.Equal(t, http.StatusOK, w.Code)
+	}
+
+	search := `{"vector":[1,0],"limit":1}`
+	w = do(http.MethodPost, "/v1/collections/cached/vectors/search?debug=true", search)
+	assert.NotContains(t, w.Body.String(), `"cache_hit":true`)
+	w = do(http.MethodPost, "/v1/collections/cached/vectors/search?debug=true", search)
+	assert.Contains(t, w.Body.String(), `"cache_hit":true`)
+	w = do(http.MethodPost, "/v1/collections/cached/vectors/search?debug=true", search, "Cache-Control", "no-cache")
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.NotContains(t, w.Body.String(), `"cache_hit":true`)
+
+	for i := 0; i < 2; i++ {
+		w = do(http.MethodPost, "/v1/collections/uncached/vectors/search?debug=true", search)
+		assert.Equal(t, http.StatusOK, w.Code)
+		assert.NotContains(t, w.Body.String(), `"cache_hit":true`)
+	}
+
+	// deleting a document drops the cached results holding it
+	w = do(http.MethodDelete, "/v1/collections/cached/documents/1", "")
+	assert.Equal(t, http.StatusOK, w.Code)
+	w = do(http.MethodPost, "/v1/collections/cached/vectors/search?debug=true", search)
+	assert.NotContains(t, w.Body.String(), `"cache_hit":true`)
+}
+
+func TestHandleSearchReadsItsWrites(t *testing.T) {
+	server, cleanup := setupTestServer(t)
+	defer cleanup()
+
+	do := func(method, path, body string) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		server.router.ServeHTTP(w, httptest.NewRequest(method, path, bytes.NewBufferString(body)))
+		return w
+	}
+	searchIDs := func() []string {
+		w := do(http.MethodPost, "/v1/collections/docs/vectors/search", `{"vector":[0,1],"limit":1}`)
+		assert.Equal(t, http.StatusOK, w.Code)
+		var resp struct {
+			IDs []string `json:"ids"`
+		}
+		assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &resp))
+		return resp.IDs
+	}
+
+	w := do(http.MethodPost, "/v1/collections", `{"name":"docs","dimension":2}`)
+	assert.Equal(t, http.StatusOK, w.Code)
+	w = do(http.MethodPost, "/v1/collections/docs/documents", `{"id":"1","vector":[1,0]}`)
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, []string{"1"}, searchIDs())
+	assert.Equal(t, []string{"1"}, searchIDs()) // cached
+
+	// the same search right after an upsert finds the new document
+	w = do(http.MethodPost, "/v1/collections/docs/documents", `{"id":"2","vector":[0,1]}`)
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, []string{"2"}, searchIDs())
+
+	w = do(http.MethodPost, "/v1/collections/docs/documents/batchupsert", `{"documents":[{"id":"3","vector":[0.1,1]},{"id":"2","vector":[1,0.1]}]}`)
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, []string{"3"}, searchIDs())
+
+	// results found at an older version aren't served, even if they were
+	// cached after the write
+	version := server.db.WriteVersion("docs")
+	cacheKey := generateCacheKey("docs", version, &SearchVectorRequest{Vector: []float32{0, 1}, Limit: 1})
+	w = do(http.MethodPost, "/v1/collections/docs/documents", `{"id":"4","vector":[0,1]}`)
+	assert.Equal(t, http.StatusOK, w.Code)
+	searchCache, err := server.db.SearchCache("docs")
+	assert.NoError(t, err)
+	searchCache.Set(cacheKey, gin.H{"ids": []string{"3"}})
+	assert.Equal(t, []string{"4"}, searchIDs())
+}
+
+func TestHandleCompaction(t *testing.T) {
+	server, cleanup := setupTestServer(t)
+	defer cleanup()
+
+	for _, query := range []string{"", "?level=0"} {
+		w := httptest.NewRecorder()
+		server.router.ServeHTTP(w, httptest.NewRequest(http.MethodPost, "/v1/admin/compact"+query, nil))
+		assert.Equal(t, http.StatusAccepted, w.Code)
+	}
+	for _, query := range []string{"?level=x", "?level=-1", "?level=100"} {
+		w := httptest.NewRecorder()
+		server.router.ServeHTTP(w, httptest.NewRequest(http.MethodPost, "/v1/admin/compact"+query, nil))
+		assert.Equal(t, http.StatusBadRequest, w.Code, query)
+	}
+
+	w := httptest.NewRecorder()
+	server.router.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/v1/admin/compaction/status", nil))
+	assert.Equal(t, http.StatusOK, w.Code)
+	var status CompactionStatusResponse
+	assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &status))
+	assert.NotEmpty(t, status.Levels)
+	assert.Equal(t, 0, status.Levels[0].Level)
+}
+
+func TestHandleWatchStatus(t *testing.T) {
+	server, cleanup := setupTestServer(t)
+	w := httptest.NewRecorder()
+	server.router.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/v1/admin/watch/status", nil))
+	assert.Equal(t, http.StatusNotFound, w.Code)
+	cleanup()
+
+	dir := t.TempDir()
+	server, cleanup = setupTestServer(t, func(conf *config.Config) {
+		conf.Watch.Dir, conf.Watch.Collection = dir, "drop"
+	})
+	defer cleanup()
+	w = httptest.NewRecorder()
+	server.router.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/v1/admin/watch/status", nil))
+	assert.Equal(t, http.StatusOK, w.Code)
+	var status db.WatchStatus
+	assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &status))
+	assert.Equal(t, dir, status.Dir)
+	assert.Equal(t, "drop", status.Collection)
+}
+
+func TestAdminUI(t *testing.T) {
+	server, cleanup := setupTestServer(t)
+	defer cleanup()
+
+	w := httptest.NewRecorder()
+	server.router.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/ui", nil))
+	assert.Equal(t, http.StatusMovedPermanently, w.Code)
+	assert.Equal(t, "/ui/", w.Header().Get("Location"))
+
+	w = httptest.NewRecorder()
+	server.router.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/ui/", nil))
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Contains(t, w.Header().Get("Content-Type"), "text/html")
+	assert.Contains(t, w.Body.String(), "/v1/collections")
+}
+
+func TestOpenAPISpec(t *testing.T) {
+	server, cleanup := setupTestServer(t)
+	defer cleanup()
+
+	// every /v1 route is documented and every documented route exists
+	routes := make(map[string]bool)
+	for _, route := range server.router.Routes() {
+		if strings.HasPrefix(route.Path, "/v1/") {
+			routes[route.Method+" "+route.Path] = true
+		}
+	}
+	documented := make(map[string]bool)
+	for _, op := range apiOperations {
+		documented[op.Method+" "+op.Path] = true
+	}
+	assert.Equal(t, routes, documented)
+
+	w := httptest.NewRecorder()
+	server.router.ServeHTTP(w, httptest.NewRequest(http.MethodGet, OpenAPIPath, nil))
+	assert.Equal(t, http.StatusOK, w.Code)
+	var spec struct {
+		OpenAPI    string                               `json:"openapi"`
+		Paths      map[string]map[string]map[string]any `json:"paths"`
+		Components struct {
+			Schemas map[string]struct {
+				Properties map[string]map[string]any `json:"properties"`
+				Required   []string                  `json:"required"`
+			} `json:"schemas"`
+		} `json:"components"`
+	}
+	if !assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &spec)) {
+		return
+	}
+	assert.Equal(t, "3.0.3", spec.OpenAPI)
+
+	search := spec.Paths["/v1/collections/{name}/documents/search"]["post"]
+	assert.Equal(t, "searchDocuments", search["operationId"])
+	assert.Contains(t, search["requestBody"].(map[string]any)["content"], "application/octet-stream")
+	request := spec.Components.Schemas["SearchDocumentRequest"]
+	assert.Equal(t, "string", request.Properties["query_text"]["type"])
+	assert.Equal(t, "#/components/schemas/RerankRequest", request.Properties["rerank"]["$ref"])
+	assert.ElementsMatch(t, []string{"id", "text"}, spec.Components.Schemas["IngestDocumentRequest"].Required)
+	assert.Equal(t, "date-time", spec.Components.Schemas["CollectionStatsResponse"].Properties["created_at"]["format"])
+	// the embedded summary is promoted into the metric
+	assert.Contains(t, spec.Components.Schemas["MetricResponse"].Properties, "count")
+}
+
+func TestHandleReadiness(t *testing.T) {
+	provider := &stubEmbeddingProvider{}
+	server, cleanup := setupTestServer(t, func(conf *config.Config) {
+		conf.EmbeddingProvider = provider
+	})
+	defer cleanup()
+
+	w := httptest.NewRecorder()
+	server.router.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/healthz", nil))
+	assert.Equal(t, http.StatusOK, w.Code)
+
+	w = httptest.NewRecorder()
+	server.router.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/readyz", nil))
+	assert.Equal(t, http.StatusOK, w.Code)
+	var ready ReadinessResponse
+	assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &ready))
+	assert.Equal(t, "ready", ready.Status)
+	assert.Len(t, ready.Checks, 3)
+	assert.Equal(t, "ok", ready.Checks["compaction"].Status)
+	assert.Zero(t, provider.calls)
+
+	w = httptest.NewRecorder()
+	server.router.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/readyz?embedding=true", nil))
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, 1, provider.calls)
+
+	w = httptest.NewRecorder()
+	server.router.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/readyz?embedding=x", nil))
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+
+	// a provider that can't be reached takes the server out of rotation
+	server.db.Config().EmbeddingProvider = unreachableEmbeddingProvider{}
+	w = httptest.NewRecorder()
+	server.router.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/readyz?embedding=true", nil))
+	assert.Equal(t, http.StatusServiceUnavailable, w.Code)
+	ready = ReadinessResponse{}
+	assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &ready))
+	assert.Equal(t, "not ready", ready.Status)
+	assert.Equal(t, "failed", ready.Checks["embedding"].Status)
+	assert.Contains(t, ready.Checks["embedding"].Error, "connection refused")
+	assert.Equal(t, "ok", ready.Checks["storage"].Status)
+}
+
+type unreachableEmbeddingProvider struct{}
+
+func (unreachableEmbeddingProvider) Embed(text string) ([]float64, error) {
+	return nil, errors.New("connection refused")
+}
+
+func (unreachableEmbeddingProvider) EmbedBatch(texts []string) ([][]float64, error) {
+	return nil, errors.New("connection refused")
+}
+
+func TestHandleWarmup(t *testing.T) {
+	server, cleanup := setupTestServer(t)
+	defer cleanup()
+
+	w := httptest.NewRecorder()
+	server.router.ServeHTTP(w, httptest.NewRequest(http.MethodPost, "/v1/collections",
+		bytes.NewBufferString(`{"name":"warm","dimension":2}`)))
+	assert.Equal(t, http.StatusOK, w.Code)
+
+	w = httptest.NewRecorder()
+	server.router.ServeHTTP(w, httptest.NewRequest(http.MethodPost, "/v1/admin/warmup", nil))
+	assert.Equal(t, http.StatusOK, w.Code)
+
+	w = httptest.NewRecorder()
+	server.router.ServeHTTP(w, httptest.NewRequest(http.MethodPost, "/v1/admin/warmup",
+		bytes.NewBufferString(`{"searches":2}`)))
+	assert.Equal(t, http.StatusOK, w.Code)
+	var report struct {
+		Collections []db.CollectionWarmup `json:"collections"`
+	}
+	assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &report))
+	assert.Equal(t, []db.CollectionWarmup{{Name: "warm", Searches: 2}}, report.Collections)
+
+	w = httptest.NewRecorder()
+	server.router.ServeHTTP(w, httptest.NewRequest(http.MethodPost, "/v1/admin/warmup",
+		bytes.NewBufferString(`{"searches":-1}`)))
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+}
+
+func TestHandleCollectionUsage(t *testing.T) {
+	server, cleanup := setupTestServer(t)
+	defer cleanup()
+
+	w := httptest.NewRecorder()
+	server.router.ServeHTTP(w, httptest.NewRequest(http.MethodPost, "/v1/collections",
+		bytes.NewBufferString(`{"name":"sized","dimension":2}`)))
+	assert.Equal(t, http.StatusOK, w.Code)
+	w = httptest.NewRecorder()
+	server.router.ServeHTTP(w, httptest.NewRequest(http.MethodPost, "/v1/collections/sized/documents",
+		bytes.NewBufferString(`{"id":"1","vector":[1,0]}`)))
+	assert.Equal(t, http.StatusOK, w.Code)
+
+	w = httptest.NewRecorder()
+	server.router.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/v1/collections/sized/usage", nil))
+	assert.Equal(t, http.StatusOK, w.Code)
+	var usage struct {
+		WALBytes         int64 `json:"wal_bytes"`
+		DiskBytes        int64 `json:"disk_bytes"`
+		IndexMemoryBytes int64 `json:"index_memory_bytes"`
+	}
+	assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &usage))
+	// the upsert is in the index WAL until the next checkpoint
+	assert.Greater(t, usage.WALBytes, int64(0))
+	assert.GreaterOrEqual(t, usage.DiskBytes, usage.WALBytes)
+	assert.Greater(t, usage.IndexMemoryBytes, int64(0))
+
+	// the same estimate is in the server stats and the index stats
+	w = httptest.NewRecorder()
+	server.router.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/v1/stats", nil))
+	assert.Equal(t, http.StatusOK, w.Code)
+	var stats StatsResponse
+	assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &stats))
+	assert.Equal(t, map[string]int64{"sized": usage.IndexMemoryBytes}, stats.IndexMemory)
+	assert.Equal(t, usage.IndexMemoryBytes, stats.IndexMemoryBytes)
+	assert.Greater(t, stats.HeapBytes, uint64(0))
+	w = httptest.NewRecorder()
+	server.router.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/v1/collections/sized", nil))
+	assert.Contains(t, w.Body.String(), fmt.Sprintf(`"memoryBytes":%d`, usage.IndexMemoryBytes))
+
+	w = httptest.NewRecorder()
+	server.router.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/v1/collections/missing/usage", nil))
+	assert.Equal(t, http.StatusNotFound, w.Code)
+}
+
+func TestHandleStatsTenants(t *testing.T) {
+	server, cleanup := setupTestServer(t)
+	defer cleanup()
+
+	send := func(method, path, tenant, body string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(method, path, bytes.NewBufferString(body))
+		if tenant != "" {
+			req.Header.Set(TenantHeader, tenant)
+		}
+		w := httptest.NewRecorder()
+		server.router.ServeHTTP(w, req)
+		return w
+	}
+	for _, tenant := range []string{"a", "b"} {
+		assert.Equal(t, http.StatusOK, send(http.MethodPost, "/v1/collections", tenant, `{"name":"docs","dimension":2}`).Code)
+		assert.Equal(t, http.StatusOK, send(http.MethodPost, "/v1/collections/docs/documents", tenant, `{"id":"1","vector":[1,0]}`).Code)
+	}
+	assert.Equal(t, http.StatusOK, send(http.MethodPost, "/v1/collections", "", `{"name":"shared","dimension":2}`).Code)
+	assert.Equal(t, http.StatusOK, send(http.MethodPost, "/v1/collections/shared/documents", "", `{"id":"1","vector":[1,0]}`).Code)
+	usage := server.db.IndexManager.MemoryUsage()
+	assert.Greater(t, usage["a:docs"], int64(0))
+
+	stats := func(tenant string) StatsResponse {
+		w := send(http.MethodGet, "/v1/stats", tenant, "")
+		assert.Equal(t, http.StatusOK, w.Code)
+		var stats StatsResponse
+		assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &stats))
+		return stats
+	}
+	// each tenant only sees its own indices, the total covers the server
+	a := stats("a")
+	assert.Equal(t, map[string]int64{"docs": usage["a:docs"]}, a.IndexMemory)
+	assert.Equal(t, usage["a:docs"]+usage["b:docs"]+usage["shared"], a.IndexMemoryBytes)
+	assert.Equal(t, map[string]int64{"docs": usage["b:docs"]}, stats("b").IndexMemory)
+	assert.Equal(t, map[string]int64{"shared": usage["shared"]}, stats("").IndexMemory)
+
+	assert.Equal(t, http.StatusBadRequest, send(http.MethodGet, "/v1/stats", "bad tenant", "").Code)
+}
+
+func TestHandleVacuum(t *testing.T) {
+	server, cleanup := setupTestServer(t)
+	defer cleanup()
+
+	for _, body := range []string{
+		`{"name":"graph","dimension":2}`,
+		`{"name":"lists","dimension":2,"index_type":"ivf_flat"}`,
+	} {
+		w := httptest.NewRecorder()
+		server.router.ServeHTTP(w, httptest.NewRequest(http.MethodPost, "/v1/collections", bytes.NewBufferString(body)))
+		assert.Equal(t, http.StatusOK, w.Code)
+	}
+	for _, body := range []string{`{"id":"1","vector":[1,0]}`, `{"id":"2","vector":[0,1]}`} {
+		w := httptest.NewRecorder()
+		server.router.ServeHTTP(w, httptest.NewRequest(http.MethodPost, "/v1/collections/graph/documents", bytes.NewBufferString(body)))
+		assert.Equal(t, http.StatusOK, w.Code)
+	}
+	w := httptest.NewRecorder()
+	server.router.ServeHTTP(w, httptest.NewRequest(http.MethodDelete, "/v1/collections/graph/documents/1", nil))
+	assert.Equal(t, http.StatusOK, w.Code)
+
+	w = httptest.NewRecorder()
+	server.router.ServeHTTP(w, httptest.NewRequest(http.MethodPost, "/v1/collections/graph/vacuum", nil))
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.JSONEq(t, `{"purged":1}`, w.Body.String())
+
+	w = httptest.NewRecorder()
+	server.router.ServeHTTP(w, httptest.NewRequest(http.MethodPost, "/v1/collections/lists/vacuum", nil))
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+	w = httptest.NewRecorder()
+	server.router.ServeHTTP(w, httptest.NewRequest(http.MethodPost, "/v1/collections/missing/vacuum", nil))
+	assert.Equal(t, http.StatusNotFound, w.Code)
+}
+
 func TestHandleGetDocument(t *testing.T) {
 	server, cleanup := setupTestServer(t)
 	defer cleanup()
@@ -458,53 +1061,706 @@ func TestHandleSearchDocuments(t *testing.T) {
 	assert.Equal(t, http.StatusInternalServerError, w.Code)
 }
 
-func TestHandleBuildIndex(t *testing.T) {
-	server, cleanup := setupTestServer(t)
-	defer cleanup()
+type stubEmbeddingProvider struct {
+	calls int
+}
 
-	// create collection first
-	collReq := CreateCollectionRequest{
-		Name:      "test_collection",
-		IndexType: string(index.IVFFLATIndex),
-		Dimension: 3,
+func (p *stubEmbeddingProvider) Embed(text string) ([]float64, error) {
+	p.calls++
+	return []float64{1.0, 2.0, 3.0}, nil
+}
+
+func (p *stubEmbeddingProvider) EmbedBatch(texts []string) ([][]float64, error) {
+	results := make([][]float64, len(texts))
+	for i, text := range texts {
+		results[i], _ = p.Embed(text)
 	}
-	body, err := json.Marshal(collReq)
+	return results, nil
+}
+
+func TestHandleSearchDocumentsQueryText(t *testing.T) {
+	provider := &stubEmbeddingProvider{}
+	server, cleanup := setupTestServer(t, func(conf *config.Config) {
+		conf.EmbeddingProvider = provider
+	})
+	defer cleanup()
+
+	body, err := json.Marshal(CreateCollectionRequest{Name: "test_collection", Dimension: 3})
 	assert.NoError(t, err)
 	w := httptest.NewRecorder()
 	r := httptest.NewRequest(http.MethodPost, "/v1/collections", bytes.NewReader(body))
 	server.router.ServeHTTP(w, r)
 	assert.Equal(t, http.StatusOK, w.Code)
 
-	// prepare documents for build index
-	docs := []*db.Document{
-		{ID: "doc1", Vector: []float32{1.0, 2.0, 3.0}, Parameters: map[string]any{"tag": "a"}},
-		{ID: "doc2", Vector: []float32{4.0, 5.0, 6.0}},
-	}
-	buildReq := BatchUpsertRequest{Documents: docs}
-	body, err = json.Marshal(buildReq)
+	body, err = json.Marshal(UpsertDocumentRequest{ID: "1", Vector: []float32{1.0, 2.0, 3.0}})
 	assert.NoError(t, err)
+	w = httptest.NewRecorder()
+	r = httptest.NewRequest(http.MethodPost, "/v1/collections/test_collection/documents", bytes.NewReader(body))
+	server.router.ServeHTTP(w, r)
+	assert.Equal(t, http.StatusOK, w.Code)
+
+	// the same text twice only embeds once
+	for i := 0; i < 2; i++ {
+		body, err = json.Marshal(SearchDocumentRequest{QueryText: "hello", Limit: 1})
+		assert.NoError(t, err)
+		w = httptest.NewRecorder()
+		r = httptest.NewRequest(http.MethodPost, "/v1/collections/test_collection/documents/search", bytes.NewReader(body))
+		server.router.ServeHTTP(w, r)
+		assert.Equal(t, http.StatusOK, w.Code)
+
+		var resp map[string]any
+		assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &resp))
+		docs := resp["documents"].([]any)
+		assert.Len(t, docs, 1)
+		assert.Equal(t, "1", docs[0].(map[string]any)["id"])
+	}
+	assert.Equal(t, 1, provider.calls)
+
+	// vector and query_text are mutually exclusive
+	body, err = json.Marshal(SearchDocumentRequest{Vector: []float32{1.0, 2.0, 3.0}, QueryText: "hello", Limit: 1})
+	assert.NoError(t, err)
+	w = httptest.NewRecorder()
+	r = httptest.NewRequest(http.MethodPost, "/v1/collections/test_collection/documents/search", bytes.NewReader(body))
+	server.router.ServeHTTP(w, r)
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+
+	// one of them is required
+	body, err = json.Marshal(SearchDocumentRequest{Limit: 1})
+	assert.NoError(t, err)
+	w = httptest.NewRecorder()
+	r = httptest.NewRequest(http.MethodPost, "/v1/collections/test_collection/documents/search", bytes.NewReader(body))
+	server.router.ServeHTTP(w, r)
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+}
+
+func TestHandleSearchDocumentsRerank(t *testing.T) {
+	server, cleanup := setupTestServer(t)
+	defer cleanup()
+
+	body, err := json.Marshal(CreateCollectionRequest{Name: "test_collection", Dimension: 2})
+	assert.NoError(t, err)
+	w := httptest.NewRecorder()
+	r := httptest.NewRequest(http.MethodPost, "/v1/collections", bytes.NewReader(body))
+	server.router.ServeHTTP(w, r)
+	assert.Equal(t, http.StatusOK, w.Code)
+
+	for id, vector := range map[string][]float32{"1": {1, 0.1}, "2": {1, 0.11}, "3": {1, -1}} {
+		body, err = json.Marshal(UpsertDocumentRequest{ID: id, Vector: vector})
+		assert.NoError(t, err)
+		w = httptest.NewRecorder()
+		r = httptest.NewRequest(http.MethodPost, "/v1/collections/test_collection/documents", bytes.NewReader(body))
+		server.router.ServeHTTP(w, r)
+		assert.Equal(t, http.StatusOK, w.Code)
+	}
+
+	// MMR skips the near duplicate of the best match
+	lambda := 0.5
+	body, err = json.Marshal(SearchDocumentRequest{
+		Vector: []float32{1, 0},
+		Limit:  2,
+		Rerank: &RerankRequest{Type: "mmr", Lambda: &lambda},
+	})
+	assert.NoError(t, err)
+	w = httptest.NewRecorder()
+	r = httptest.NewRequest(http.MethodPost, "/v1/collections/test_collection/documents/search", bytes.NewReader(body))
+	server.router.ServeHTTP(w, r)
+	assert.Equal(t, http.StatusOK, w.Code)
+
+	var resp map[string]any
+	assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &resp))
+	docs := resp["documents"].([]any)
+	assert.Len(t, docs, 2)
+	assert.Equal(t, "1", docs[0].(map[string]any)["id"])
+	assert.Equal(t, "3", docs[1].(map[string]any)["id"])
+	assert.Contains(t, docs[0].(map[string]any), "rerank_score")
+
+	body, err = json.Marshal(SearchDocumentRequest{
+		Vector: []float32{1, 0},
+		Limit:  2,
+		Rerank: &RerankRequest{Type: "unknown"},
+	})
+	assert.NoError(t, err)
+	w = httptest.NewRecorder()
+	r = httptest.NewRequest(http.MethodPost, "/v1/collections/test_collection/documents/search", bytes.NewReader(body))
+	server.router.ServeHTTP(w, r)
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+}
+
+func TestHandleIngestDocument(t *testing.T) {
+	server, cleanup := setupTestServer(t, func(conf *config.Config) {
+		conf.EmbeddingProvider = &stubEmbeddingProvider{}
+	})
+	defer cleanup()
+
+	body, err := json.Marshal(CreateCollectionRequest{Name: "test_collection", Dimension: 3})
+	assert.NoError(t, err)
+	w := httptest.NewRecorder()
+	r := httptest.NewRequest(http.MethodPost, "/v1/collections", bytes.NewReader(body))
+	server.router.ServeHTTP(w, r)
+	assert.Equal(t, http.StatusOK, w.Code)
+
+	startID := 10
+	body, err = json.Marshal(IngestDocumentRequest{
+		ID:       "readme",
+		Text:     "# Intro\nOasisDB is a vector database.\n\n# Usage\nStart the server.",
+		Chunking: chunk.Options{Size: 40, Splitter: chunk.MarkdownSplitter},
+		StartID:  &startID,
+	})
+	assert.NoError(t, err)
+	w = httptest.NewRecorder()
+	r = httptest.NewRequest(http.MethodPost, "/v1/collections/test_collection/documents/ingest", bytes.NewReader(body))
+	server.router.ServeHTTP(w, r)
+	assert.Equal(t, http.StatusOK, w.Code)
+
+	var resp struct {
+		IDs   []string `json:"ids"`
+		Count int      `json:"count"`
+	}
+	assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &resp))
+	assert.Equal(t, []string{"10", "11"}, resp.IDs)
+	assert.Equal(t, 2, resp.Count)
+
+	w = httptest.NewRecorder()
+	r = httptest.NewRequest(http.MethodGet, "/v1/collections/test_collection/documents/11", nil)
+	server.router.ServeHTTP(w, r)
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Contains(t, w.Body.String(), `"parent_id":"readme"`)
+
+	// invalid chunking options
+	body, err = json.Marshal(IngestDocumentRequest{ID: "bad", Text: "text", Chunking: chunk.Options{Size: 5, Overlap: 5}})
+	assert.NoError(t, err)
+	w = httptest.NewRecorder()
+	r = httptest.NewRequest(http.MethodPost, "/v1/collections/test_collection/documents/ingest", bytes.NewReader(body))
+	server.router.ServeHTTP(w, r)
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+}
+
+func TestHandleArchiveAndRestore(t *testing.T) {
+	server, cleanup := setupTestServer(t)
+	defer cleanup()
+
+	body, err := json.Marshal(CreateCollectionRequest{Name: "test_collection", Dimension: 3})
+	assert.NoError(t, err)
+	w := httptest.NewRecorder()
+	r := httptest.NewRequest(http.MethodPost, "/v1/collections", bytes.NewReader(body))
+	server.router.ServeHTTP(w, r)
+	assert.Equal(t, http.StatusOK, w.Code)
+
+	body, err = json.Marshal(UpsertDocumentRequest{ID: "1", Vector: []float32{1.0, 2.0, 3.0}})
+	assert.NoError(t, err)
+	w = httptest.NewRecorder()
+	r = httptest.NewRequest(http.MethodPost, "/v1/collections/test_collection/documents", bytes.NewReader(body))
+	server.router.ServeHTTP(w, r)
+	assert.Equal(t, http.StatusOK, w.Code)
+
+	// no threshold configured or requested
+	w = httptest.NewRecorder()
+	r = httptest.NewRequest(http.MethodPost, "/v1/collections/test_collection/archive", nil)
+	server.router.ServeHTTP(w, r)
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+
+	// the document was just written, nothing to archive
+	body, err = json.Marshal(ArchiveRequest{UnreadDays: 1})
+	assert.NoError(t, err)
+	w = httptest.NewRecorder()
+	r = httptest.NewRequest(http.MethodPost, "/v1/collections/test_collection/archive", bytes.NewReader(body))
+	server.router.ServeHTTP(w, r)
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.JSONEq(t, `{"archived":[],"count":0}`, w.Body.String())
+
+	w = httptest.NewRecorder()
+	r = httptest.NewRequest(http.MethodPost, "/v1/collections/missing/archive", bytes.NewReader(body))
+	server.router.ServeHTTP(w, r)
+	assert.Equal(t, http.StatusNotFound, w.Code)
+
+	// only archived documents can be restored
+	w = httptest.NewRecorder()
+	r = httptest.NewRequest(http.MethodPost, "/v1/collections/test_collection/documents/1/restore", nil)
+	server.router.ServeHTTP(w, r)
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+}
+
+func TestHandleRebuildIndex(t *testing.T) {
+	server, cleanup := setupTestServer(t)
+	defer cleanup()
+
+	for _, req := range []CreateCollectionRequest{
+		{Name: "stored", Dimension: 3, StoreVectors: true},
+		{Name: "plain", Dimension: 3},
+	} {
+		body, err := json.Marshal(req)
+		assert.NoError(t, err)
+		w := httptest.NewRecorder()
+		r := httptest.NewRequest(http.MethodPost, "/v1/collections", bytes.NewReader(body))
+		server.router.ServeHTTP(w, r)
+		assert.Equal(t, http.StatusOK, w.Code)
+	}
+
+	body, err := json.Marshal(UpsertDocumentRequest{ID: "1", Vector: []float32{1.0, 2.0, 3.0}})
+	assert.NoError(t, err)
+	w := httptest.NewRecorder()
+	r := httptest.NewRequest(http.MethodPost, "/v1/collections/stored/documents", bytes.NewReader(body))
+	server.router.ServeHTTP(w, r)
+	assert.Equal(t, http.StatusOK, w.Code)
+
+	w = httptest.NewRecorder()
+	r = httptest.NewRequest(http.MethodPost, "/v1/collections/stored/rebuild", nil)
+	server.router.ServeHTTP(w, r)
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.JSONEq(t, `{"count":1}`, w.Body.String())
+
+	// collections without stored vectors can't be rebuilt
+	w = httptest.NewRecorder()
+	r = httptest.NewRequest(http.MethodPost, "/v1/collections/plain/rebuild", nil)
+	server.router.ServeHTTP(w, r)
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+
+	w = httptest.NewRecorder()
+	r = httptest.NewRequest(http.MethodPost, "/v1/collections/missing/rebuild", nil)
+	server.router.ServeHTTP(w, r)
+	assert.Equal(t, http.StatusNotFound, w.Code)
+}
+
+func TestHandleCloneCollection(t *testing.T) {
+	server, cleanup := setupTestServer(t)
+	defer cleanup()
+
+	post := func(url string, req any) *httptest.ResponseRecorder {
+		body, err := json.Marshal(req)
+		assert.NoError(t, err)
+		w := httptest.NewRecorder()
+		r := httptest.NewRequest(http.MethodPost, url, bytes.NewReader(body))
+		server.router.ServeHTTP(w, r)
+		return w
+	}
+	assert.Equal(t, http.StatusOK, post("/v1/collections", CreateCollectionRequest{Name: "source", Dimension: 3}).Code)
+	assert.Equal(t, http.StatusOK, post("/v1/collections/source/documents", UpsertDocumentRequest{ID: "1", Vector: []float32{1.0, 2.0, 3.0}}).Code)
+
+	w := post("/v1/collections/source/clone", map[string]any{
+		"target": "copy", "index_type": "flat", "index_params": map[string]any{"searchThreads": 2},
+	})
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.JSONEq(t, `{"name":"copy","index_type":"flat","metadata":{"searchThreads":"2"},"count":1}`, w.Body.String())
+
+	w = httptest.NewRecorder()
+	r := httptest.NewRequest(http.MethodGet, "/v1/collections/copy/documents/1", nil)
+	server.router.ServeHTTP(w, r)
+	assert.Equal(t, http.StatusOK, w.Code)
+
+	assert.Equal(t, http.StatusConflict, post("/v1/collections/source/clone", CloneRequest{Target: "copy"}).Code)
+	assert.Equal(t, http.StatusNotFound, post("/v1/collections/missing/clone", CloneRequest{Target: "other"}).Code)
+	assert.Equal(t, http.StatusBadRequest, post("/v1/collections/source/clone", CloneRequest{Target: "other", IndexType: "annoy"}).Code)
+}
+
+func TestHandleReindex(t *testing.T) {
+	server, cleanup := setupTestServer(t)
+	defer cleanup()
+
+	post := func(url string, req any) *httptest.ResponseRecorder {
+		body, err := json.Marshal(req)
+		assert.NoError(t, err)
+		w := httptest.NewRecorder()
+		r := httptest.NewRequest(http.MethodPost, url, bytes.NewReader(body))
+		server.router.ServeHTTP(w, r)
+		return w
+	}
+	assert.Equal(t, http.StatusOK, post("/v1/collections", CreateCollectionRequest{Name: "docs", IndexType: "flat", Dimension: 3}).Code)
+	assert.Equal(t, http.StatusOK, post("/v1/collections/docs/documents", UpsertDocumentRequest{ID: "1", Vector: []float32{1.0, 2.0, 3.0}}).Code)
+
+	w := httptest.NewRecorder()
+	r := httptest.NewRequest(http.MethodGet, "/v1/collections/docs/reindex", nil)
+	server.router.ServeHTTP(w, r)
+	assert.Equal(t, http.StatusNotFound, w.Code)
+
+	w = post("/v1/collections/docs/reindex", map[string]any{"index_type": "hnsw", "parameters": map[string]any{"M": 8}})
+	assert.Equal(t, http.StatusAccepted, w.Code)
+	var status db.ReindexStatus
+	assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &status))
+	assert.Equal(t, db.ReindexRunning, status.State)
+	assert.Equal(t, "hnsw", status.IndexType)
+
+	assert.Eventually(t, func() bool {
+		w := httptest.NewRecorder()
+		r := httptest.NewRequest(http.MethodGet, "/v1/collections/docs/reindex", nil)
+		server.router.ServeHTTP(w, r)
+		return json.Unmarshal(w.Body.Bytes(), &status) == nil && status.State != db.ReindexRunning
+	}, 5*time.Second, 10*time.Millisecond)
+	assert.Equal(t, db.ReindexDone, status.State)
+	assert.Equal(t, 1, status.Count)
+	collection, err := server.db.GetCollection("docs")
+	assert.NoError(t, err)
+	assert.Equal(t, "hnsw", collection.IndexType)
+
+	// the build of the new index is listed as a job of the collection
+	listJobs := func(url, tenant string) ListJobsResponse {
+		w := httptest.NewRecorder()
+		r := httptest.NewRequest(http.MethodGet, url, nil)
+		r.Header.Set(TenantHeader, tenant)
+		server.router.ServeHTTP(w, r)
+		assert.Equal(t, http.StatusOK, w.Code)
+		var response ListJobsResponse
+		assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &response))
+		return response
+	}
+	jobs := listJobs("/v1/jobs?collection=docs", "")
+	assert.Equal(t, 1, jobs.Count)
+	assert.Equal(t, "docs", jobs.Jobs[0].Collection)
+	assert.Equal(t, index.JobReindex, jobs.Jobs[0].Kind)
+	assert.Equal(t, index.HNSWIndex, jobs.Jobs[0].IndexType)
+	assert.Equal(t, index.JobDone, jobs.Jobs[0].State)
+	assert.Equal(t, 1, jobs.Jobs[0].Inserted)
+	assert.Equal(t, 1, listJobs("/v1/jobs", "").Count)
+	assert.Zero(t, listJobs("/v1/jobs", "acme").Count)
+
+	assert.Equal(t, http.StatusNotFound, post("/v1/collections/missing/reindex", ReindexRequest{}).Code)
+	assert.Equal(t, http.StatusBadRequest, post("/v1/collections/docs/reindex", ReindexRequest{IndexType: "annoy"}).Code)
+}
+
+func TestHandleScrollDocuments(t *testing.T) {
+	server, cleanup := setupTestServer(t)
+	defer cleanup()
+
+	body, err := json.Marshal(CreateCollectionRequest{Name: "test_collection", Dimension: 3})
+	assert.NoError(t, err)
+	w := httptest.NewRecorder()
+	r := httptest.NewRequest(http.MethodPost, "/v1/collections", bytes.NewReader(body))
+	server.router.ServeHTTP(w, r)
+	assert.Equal(t, http.StatusOK, w.Code)
+
+	for _, id := range []string{"1", "2", "3"} {
+		body, err = json.Marshal(UpsertDocumentRequest{ID: id, Vector: []float32{1.0, 2.0, 3.0}})
+		assert.NoError(t, err)
+		w = httptest.NewRecorder()
+		r = httptest.NewRequest(http.MethodPost, "/v1/collections/test_collection/documents", bytes.NewReader(body))
+		server.router.ServeHTTP(w, r)
+		assert.Equal(t, http.StatusOK, w.Code)
+	}
+
+	var ids []string
+	req := ScrollRequest{Size: 2}
+	for {
+		body, err = json.Marshal(req)
+		assert.NoError(t, err)
+		w = httptest.NewRecorder()
+		r = httptest.NewRequest(http.MethodPost, "/v1/collections/test_collection/scroll", bytes.NewReader(body))
+		server.router.ServeHTTP(w, r)
+		assert.Equal(t, http.StatusOK, w.Code)
+
+		var resp struct {
+			Documents []db.Document `json:"documents"`
+			Cursor    string        `json:"cursor"`
+		}
+		assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &resp))
+		for _, doc := range resp.Documents {
+			ids = append(ids, doc.ID)
+		}
+		if resp.Cursor == "" || len(ids) > 3 {
+			break
+		}
+		req = ScrollRequest{Cursor: resp.Cursor, Size: 2}
+	}
+	assert.Equal(t, []string{"1", "2", "3"}, ids)
+
+	body, err = json.Marshal(ScrollRequest{Cursor: "bogus"})
+	assert.NoError(t, err)
+	w = httptest.NewRecorder()
+	r = httptest.NewRequest(http.MethodPost, "/v1/collections/test_collection/scroll", bytes.NewReader(body))
+	server.router.ServeHTTP(w, r)
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+
+	w = httptest.NewRecorder()
+	r = httptest.NewRequest(http.MethodPost, "/v1/collections/missing/scroll", nil)
+	server.router.ServeHTTP(w, r)
+	assert.Equal(t, http.StatusNotFound, w.Code)
+}
+
+func TestHandleSearchDebug(t *testing.T) {
+	server, cleanup := setupTestServer(t)
+	defer cleanup()
+
+	post := func(path, body string) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		server.router.ServeHTTP(w, httptest.NewRequest(http.MethodPost, path, bytes.NewBufferString(body)))
+		return w
+	}
+	assert.Equal(t, http.StatusOK, post("/v1/collections", `{"name":"docs","dimension":2,"default_filter":{"lang":"en"}}`).Code)
+	assert.Equal(t, http.StatusOK, post("/v1/collections/docs/documents", `{"id":"1","vector":[1,0],"parameters":{"lang":"en"}}`).Code)
+
+	var resp struct {
+		Debug *SearchDebug `json:"debug"`
+	}
+	for _, path := range []string{"/v1/collections/docs/vectors/search", "/v1/collections/docs/documents/search"} {
+		w := post(path+"?debug=true", `{"vector":[1,0],"limit":1}`)
+		assert.Equal(t, http.StatusOK, w.Code)
+		resp.Debug = nil
+		assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &resp))
+		if assert.NotNil(t, resp.Debug, path) {
+			assert.False(t, resp.Debug.CacheHit)
+			assert.Zero(t, resp.Debug.EmbedMs)
+			assert.GreaterOrEqual(t, resp.Debug.TotalMs, resp.Debug.IndexMs+resp.Debug.FetchMs)
+		}
+
+		w = post(path, `{"vector":[1,0],"limit":1}`)
+		assert.Equal(t, http.StatusOK, w.Code)
+		assert.NotContains(t, w.Body.String(), "debug", "debug is only returned on request")
+
+		assert.Equal(t, http.StatusBadRequest, post(path+"?debug=maybe", `{"vector":[1,0],"limit":1}`).Code)
+	}
+
+	// a cache hit reports it without changing the cached response
+	w := post("/v1/collections/docs/vectors/search?debug=true", `{"vector":[1,0],"limit":1}`)
+	assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &resp))
+	assert.True(t, resp.Debug.CacheHit)
+	w = post("/v1/collections/docs/vectors/search", `{"vector":[1,0],"limit":1}`)
+	assert.NotContains(t, w.Body.String(), "debug")
+}
+
+func TestHandleExportCollection(t *testing.T) {
+	server, cleanup := setupTestServer(t)
+	defer cleanup()
+
+	body, err := json.Marshal(CreateCollectionRequest{Name: "docs", Dimension: 2})
+	assert.NoError(t, err)
+	w := httptest.NewRecorder()
+	server.router.ServeHTTP(w, httptest.NewRequest(http.MethodPost, "/v1/collections", bytes.NewReader(body)))
+	assert.Equal(t, http.StatusOK, w.Code)
+	// more documents than a scroll page
+	docs := make([]*db.Document, db.MaxScrollSize+5)
+	for i := range docs {
+		docs[i] = &db.Document{
+			ID:         fmt.Sprintf("%04d", i),
+			Vector:     []float32{float32(i), 1},
+			Dimension:  2,
+			Parameters: map[string]any{"even": i%2 == 0},
+		}
+	}
+	assert.NoError(t, server.db.BatchUpsertDocuments("docs", docs))
+
+	export := func(query string, gzipped bool) ([]ExportDocument, *httptest.ResponseRecorder) {
+		w := httptest.NewRecorder()
+		r := httptest.NewRequest(http.MethodGet, "/v1/collections/docs/export"+query, nil)
+		if gzipped {
+			r.Header.Set("Accept-Encoding", "gzip")
+		}
+		server.router.ServeHTTP(w, r)
+		var body io.Reader = w.Body
+		if w.Header().Get("Content-Encoding") == "gzip" {
+			zr, err := gzip.NewReader(w.Body)
+			assert.NoError(t, err)
+			body = zr
+		}
+		var docs []ExportDocument
+		dec := json.NewDecoder(body)
+		for dec.More() {
+			var doc ExportDocument
+			assert.NoError(t, dec.Decode(&doc))
+			docs = append(docs, doc)
+		}
+		return docs, w
+	}
+
+	all, w := export("", false)
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, ndjsonContentType, w.Header().Get("Content-Type"))
+	assert.NotEmpty(t, w.Header().Get("X-Export-Seq"))
+	assert.Len(t, all, len(docs))
+	assert.Equal(t, "0000", all[0].ID)
+	assert.Equal(t, []float32{3, 1}, all[3].Vector)
+	assert.Equal(t, false, all[3].Parameters["even"])
+
+	zipped, w := export("", true)
+	assert.Equal(t, "gzip", w.Header().Get("Content-Encoding"))
+	assert.Equal(t, all, zipped)
+
+	// a broken export resumes after the last document received
+	resumed, _ := export("?cursor=0999", false)
+	assert.Equal(t, all[1000:], resumed)
+
+	even, _ := export("?filter="+url.QueryEscape(`{"even":true}`), false)
+	assert.Len(t, even, len(docs)/2+1)
+
+	_, w = export("?filter=bogus", false)
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+	w = httptest.NewRecorder()
+	server.router.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/v1/collections/missing/export", nil))
+	assert.Equal(t, http.StatusNotFound, w.Code)
+}
+
+func TestHandleListDocumentIDs(t *testing.T) {
+	server, cleanup := setupTestServer(t)
+	defer cleanup()
+
+	body, err := json.Marshal(CreateCollectionRequest{Name: "docs", Dimension: 2})
+	assert.NoError(t, err)
+	w := httptest.NewRecorder()
+	server.router.ServeHTTP(w, httptest.NewRequest(http.MethodPost, "/v1/collections", bytes.NewReader(body)))
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.NoError(t, server.db.BatchUpsertDocuments("docs", []*db.Document{
+		{ID: "a", Vector: []float32{1, 0}, Dimension: 2},
+		{ID: "b", Vector: []float32{0, 1}, Dimension: 2},
+		{ID: "c", Vector: []float32{1, 1}, Dimension: 2},
+	}))
+
+	list := func(query string) (*httptest.ResponseRecorder, []string, string) {
+		w := httptest.NewRecorder()
+		server.router.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/v1/collections/docs/ids"+query, nil))
+		var resp struct {
+			IDs    []string `json:"ids"`
+			Count  int      `json:"count"`
+			Cursor string   `json:"cursor"`
+		}
+		if w.Code == http.StatusOK {
+			assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &resp))
+			assert.Equal(t, len(resp.IDs), resp.Count)
+		}
+		return w, resp.IDs, resp.Cursor
+	}
+
+	w, ids, cursor := list("?limit=2")
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, []string{"a", "b"}, ids)
+	assert.Equal(t, "b", cursor)
+	_, ids, cursor = list("?limit=2&cursor=" + cursor)
+	assert.Equal(t, []string{"c"}, ids)
+	assert.Empty(t, cursor)
+	_, ids, _ = list("")
+	assert.Len(t, ids, 3)
+
+	w, _, _ = list("?limit=-1")
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+	w, _, _ = list("?limit=10001")
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+	w = httptest.NewRecorder()
+	server.router.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/v1/collections/missing/ids", nil))
+	assert.Equal(t, http.StatusNotFound, w.Code)
+}
+
+func TestHandleMetrics(t *testing.T) {
+	server, cleanup := setupTestServer(t)
+	defer cleanup()
+
+	server.db.Metrics.Observe("search_recall_at_k:docs", 0.5)
+	server.db.Metrics.Observe("search_recall_at_k:docs", 1)
+
+	w := httptest.NewRecorder()
+	r := httptest.NewRequest(http.MethodGet, "/v1/metrics", nil)
+	server.router.ServeHTTP(w, r)
+	assert.Equal(t, http.StatusOK, w.Code)
+
+	var resp struct {
+		Metrics map[string]MetricResponse `json:"metrics"`
+	}
+	assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &resp))
+	metric := resp.Metrics["search_recall_at_k:docs"]
+	assert.Equal(t, int64(2), metric.Count)
+	assert.Equal(t, 0.75, metric.Mean)
+}
+
+func TestHandleBuildIndex(t *testing.T) {
+	server, cleanup := setupTestServer(t)
+	defer cleanup()
+
+	// create collection first
+	collReq := CreateCollectionRequest{
+		Name:      "test_collection",
+		IndexType: string(index.IVFFLATIndex),
+		Dimension: 3,
+	}
+	body, err := json.Marshal(collReq)
+	assert.NoError(t, err)
+	w := httptest.NewRecorder()
+	r := httptest.NewRequest(http.MethodPost, "/v1/collections", bytes.NewReader(body))
+	server.router.ServeHTTP(w, r)
+	assert.Equal(t, http.StatusOK, w.Code)
+
+	// prepare documents for build index
+	docs := []*db.Document{
+		{ID: "doc1", Vector: []float32{1.0, 2.0, 3.0}, Parameters: map[string]any{"tag": "a"}},
+		{ID: "doc2", Vector: []float32{4.0, 5.0, 6.0}},
+	}
+	buildReq := BatchUpsertRequest{Documents: docs}
+	body, err = json.Marshal(buildReq)
+	assert.NoError(t, err)
+
+	w = httptest.NewRecorder()
+	r = httptest.NewRequest(http.MethodPost, "/v1/collections/test_collection/buildindex", bytes.NewReader(body))
+	server.router.ServeHTTP(w, r)
+	assert.Equal(t, http.StatusOK, w.Code)
+
+	// invalid vector dimension
+	docsInvalid := []*db.Document{{ID: "bad", Vector: []float32{1.0, 2.0}}} // dimension 2 != 3
+	buildReq = BatchUpsertRequest{Documents: docsInvalid}
+	body, err = json.Marshal(buildReq)
+	assert.NoError(t, err)
+
+	w = httptest.NewRecorder()
+	r = httptest.NewRequest(http.MethodPost, "/v1/collections/test_collection/buildindex", bytes.NewReader(body))
+	server.router.ServeHTTP(w, r)
+	assert.Equal(t, http.StatusInternalServerError, w.Code)
+
+	// non-existent collection
+	w = httptest.NewRecorder()
+	r = httptest.NewRequest(http.MethodPost, "/v1/collections/non_existent/buildindex", bytes.NewReader(body))
+	server.router.ServeHTTP(w, r)
+	assert.Equal(t, http.StatusInternalServerError, w.Code)
+}
+
+func TestHandleListClusters(t *testing.T) {
+	server, cleanup := setupTestServer(t)
+	defer cleanup()
+
+	collReq := CreateCollectionRequest{
+		Name:      "hnsw_collection",
+		IndexType: string(index.HNSWIndex),
+		Dimension: 3,
+	}
+	body, err := json.Marshal(collReq)
+	assert.NoError(t, err)
+	w := httptest.NewRecorder()
+	r := httptest.NewRequest(http.MethodPost, "/v1/collections", bytes.NewReader(body))
+	server.router.ServeHTTP(w, r)
+	assert.Equal(t, http.StatusOK, w.Code)
 
+	docs := []*db.Document{
+		{ID: "1", Vector: []float32{1.0, 2.0, 3.0}},
+		{ID: "2", Vector: []float32{4.0, 5.0, 6.0}},
+		{ID: "3", Vector: []float32{7.0, 8.0, 9.0}},
+	}
+	body, err = json.Marshal(BatchUpsertRequest{Documents: docs})
+	assert.NoError(t, err)
 	w = httptest.NewRecorder()
-	r = httptest.NewRequest(http.MethodPost, "/v1/collections/test_collection/buildindex", bytes.NewReader(body))
+	r = httptest.NewRequest(http.MethodPost, "/v1/collections/hnsw_collection/documents/batchupsert", bytes.NewReader(body))
 	server.router.ServeHTTP(w, r)
 	assert.Equal(t, http.StatusOK, w.Code)
 
-	// invalid vector dimension
-	docsInvalid := []*db.Document{{ID: "bad", Vector: []float32{1.0, 2.0}}} // dimension 2 != 3
-	buildReq = BatchUpsertRequest{Documents: docsInvalid}
-	body, err = json.Marshal(buildReq)
-	assert.NoError(t, err)
+	w = httptest.NewRecorder()
+	r = httptest.NewRequest(http.MethodGet, "/v1/collections/hnsw_collection/clusters?samples=1", nil)
+	server.router.ServeHTTP(w, r)
+	assert.Equal(t, http.StatusOK, w.Code)
 
+	var resp struct {
+		Clusters []ClusterResponse `json:"clusters"`
+		Count    int               `json:"count"`
+	}
+	assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &resp))
+	assert.Equal(t, len(resp.Clusters), resp.Count)
+	assert.NotEmpty(t, resp.Clusters)
+	for _, cluster := range resp.Clusters {
+		assert.Len(t, cluster.Centroid, 3)
+		assert.LessOrEqual(t, len(cluster.SampleIDs), 1)
+	}
+
+	// invalid samples
 	w = httptest.NewRecorder()
-	r = httptest.NewRequest(http.MethodPost, "/v1/collections/test_collection/buildindex", bytes.NewReader(body))
+	r = httptest.NewRequest(http.MethodGet, "/v1/collections/hnsw_collection/clusters?samples=abc", nil)
 	server.router.ServeHTTP(w, r)
-	assert.Equal(t, http.StatusInternalServerError, w.Code)
+	assert.Equal(t, http.StatusBadRequest, w.Code)
 
 	// non-existent collection
 	w = httptest.NewRecorder()
-	r = httptest.NewRequest(http.MethodPost, "/v1/collections/non_existent/buildindex", bytes.NewReader(body))
+	r = httptest.NewRequest(http.MethodGet, "/v1/collections/non_existent/clusters", nil)
 	server.router.ServeHTTP(w, r)
-	assert.Equal(t, http.StatusInternalServerError, w.Code)
+	assert.Equal(t, http.StatusNotFound, w.Code)
 }
 
 func TestHandleSearchVectors(t *testing.T) {
@@ -565,18 +1821,71 @@ func TestHandleSearchVectors(t *testing.T) {
 	assert.NoError(t, err)
 
 	w = httptest.NewRecorder()
-	r = httptest.NewRequest(http.MethodPost, "/v1/collections/test_collection/vectors/search", bytes.NewReader(body))
+	r = httptest.NewRequest(http.MethodPost, "/v1/collections/test_collection/vectors/search?debug=true", bytes.NewReader(body))
 	server.router.ServeHTTP(w, r)
 	assert.Equal(t, http.StatusOK, w.Code)
 
 	// Test if lru enabled
 	w = httptest.NewRecorder()
-	r = httptest.NewRequest(http.MethodPost, "/v1/collections/test_collection/vectors/search", bytes.NewReader(body))
+	r = httptest.NewRequest(http.MethodPost, "/v1/collections/test_collection/vectors/search?debug=true", bytes.NewReader(body))
 	server.router.ServeHTTP(w, r)
 
 	assert.Equal(t, http.StatusOK, w.Code)
 	// print result
-	assert.Contains(t, w.Body.String(), "cache_hit")
+	assert.Contains(t, w.Body.String(), `"cache_hit":true`)
+
+	// Test range search, it must not be answered from the cached top-k
+	w = httptest.NewRecorder()
+	r = httptest.NewRequest(http.MethodPost, "/v1/collections/test_collection/vectors/search?debug=true",
+		bytes.NewBufferString(`{"vector":[1,2,3],"limit":2,"max_distance":1}`))
+	server.router.ServeHTTP(w, r)
+	assert.Equal(t, http.StatusOK, w.Code)
+	var ranged struct {
+		IDs []string `json:"ids"`
+	}
+	assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &ranged))
+	assert.Equal(t, []string{"1"}, ranged.IDs)
+
+	w = httptest.NewRecorder()
+	r = httptest.NewRequest(http.MethodPost, "/v1/collections/test_collection/documents/search",
+		bytes.NewBufferString(`{"vector":[10,10,10],"limit":2,"max_distance":1}`))
+	server.router.ServeHTTP(w, r)
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.JSONEq(t, `{"documents":[],"distances":[],"total_candidates":0}`, w.Body.String())
+
+	// Test paging, the offset is part of the cache key
+	w = httptest.NewRecorder()
+	r = httptest.NewRequest(http.MethodPost, "/v1/collections/test_collection/vectors/search?debug=true",
+		bytes.NewBufferString(`{"vector":[1,2,3],"limit":2,"offset":1}`))
+	server.router.ServeHTTP(w, r)
+	assert.Equal(t, http.StatusOK, w.Code)
+	var paged struct {
+		IDs   []string `json:"ids"`
+		Total int      `json:"total_candidates"`
+	}
+	assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &paged))
+	assert.Equal(t, []string{"2"}, paged.IDs)
+	assert.Equal(t, 2, paged.Total)
+
+	w = httptest.NewRecorder()
+	r = httptest.NewRequest(http.MethodPost, "/v1/collections/test_collection/vectors/search?debug=true",
+		bytes.NewBufferString(`{"vector":[1,2,3],"limit":2,"offset":-1}`))
+	server.router.ServeHTTP(w, r)
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+
+	// Test per-query search params, unknown ones are rejected
+	w = httptest.NewRecorder()
+	r = httptest.NewRequest(http.MethodPost, "/v1/collections/test_collection/vectors/search?debug=true",
+		bytes.NewBufferString(`{"vector":[1,2,3],"limit":2,"params":{"efsearch":64}}`))
+	server.router.ServeHTTP(w, r)
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.NotContains(t, w.Body.String(), `"cache_hit":true`)
+
+	w = httptest.NewRecorder()
+	r = httptest.NewRequest(http.MethodPost, "/v1/collections/test_collection/documents/search",
+		bytes.NewBufferString(`{"vector":[1,2,3],"limit":2,"params":{"nprobe":4}}`))
+	server.router.ServeHTTP(w, r)
+	assert.Equal(t, http.StatusBadRequest, w.Code)
 
 	// Test invalid vector dimension
 	invalidReq := SearchVectorRequest{
@@ -588,7 +1897,7 @@ func TestHandleSearchVectors(t *testing.T) {
 	assert.NoError(t, err)
 
 	w = httptest.NewRecorder()
-	r = httptest.NewRequest(http.MethodPost, "/v1/collections/test_collection/vectors/search", bytes.NewReader(body))
+	r = httptest.NewRequest(http.MethodPost, "/v1/collections/test_collection/vectors/search?debug=true", bytes.NewReader(body))
 	server.router.ServeHTTP(w, r)
 
 	assert.Equal(t, http.StatusInternalServerError, w.Code)
@@ -601,6 +1910,77 @@ func TestHandleSearchVectors(t *testing.T) {
 	assert.Equal(t, http.StatusInternalServerError, w.Code)
 }
 
+// binaryBody encodes a request in the binary layout
+func binaryBody(t *testing.T, header any, vectors ...[]float32) *bytes.Buffer {
+	encoded, err := json.Marshal(header)
+	assert.NoError(t, err)
+	body := binary.LittleEndian.AppendUint32(nil, uint32(len(encoded)))
+	body = append(body, encoded...)
+	for _, vector := range vectors {
+		for _, v := range vector {
+			body = binary.LittleEndian.AppendUint32(body, math.Float32bits(v))
+		}
+	}
+	return bytes.NewBuffer(body)
+}
+
+func TestHandleBinaryBodies(t *testing.T) {
+	server, cleanup := setupTestServer(t)
+	defer cleanup()
+
+	post := func(path string, body *bytes.Buffer) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		r := httptest.NewRequest(http.MethodPost, path, body)
+		r.Header.Set("Content-Type", binaryContentType)
+		server.router.ServeHTTP(w, r)
+		return w
+	}
+
+	w := httptest.NewRecorder()
+	server.router.ServeHTTP(w, httptest.NewRequest(http.MethodPost, "/v1/collections", bytes.NewBufferString(`{"name":"binary","dimension":3}`)))
+	assert.Equal(t, http.StatusOK, w.Code)
+
+	header := map[string]any{"documents": []map[string]any{
+		{"id": "1", "dimension": 3, "parameters": map[string]any{"tag": "a"}},
+		{"id": "2", "dimension": 3},
+	}}
+	w = post("/v1/collections/binary/documents/batchupsert", binaryBody(t, header, []float32{1, 0, 0}, []float32{0, 1, 0}))
+	assert.Equal(t, http.StatusOK, w.Code, w.Body.String())
+
+	w = post("/v1/collections/binary/vectors/search", binaryBody(t, map[string]any{"limit": 1}, []float32{0, 0.9, 0.1}))
+	assert.Equal(t, http.StatusOK, w.Code, w.Body.String())
+	var vectors struct {
+		IDs []string `json:"ids"`
+	}
+	assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &vectors))
+	assert.Equal(t, []string{"2"}, vectors.IDs)
+
+	w = post("/v1/collections/binary/documents/search", binaryBody(t, map[string]any{"limit": 1}, []float32{0.9, 0.1, 0}))
+	assert.Equal(t, http.StatusOK, w.Code, w.Body.String())
+	var documents struct {
+		Documents []db.Document `json:"documents"`
+	}
+	assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &documents))
+	if assert.Len(t, documents.Documents, 1) {
+		assert.Equal(t, "1", documents.Documents[0].ID)
+		assert.Equal(t, "a", documents.Documents[0].Parameters["tag"])
+	}
+
+	// malformed bodies are rejected
+	for name, body := range map[string]*bytes.Buffer{
+		"short header":      bytes.NewBuffer([]byte{1, 0}),
+		"header overflow":   bytes.NewBuffer([]byte{9, 0, 0, 0, '{', '}'}),
+		"partial float":     bytes.NewBuffer(append(binaryBody(t, header, []float32{1, 0, 0, 0, 1, 0}).Bytes(), 0)),
+		"missing values":    binaryBody(t, header, []float32{1, 0, 0}),
+		"extra values":      binaryBody(t, header, []float32{1, 0, 0, 0, 1, 0, 1}),
+		"vector in header":  binaryBody(t, map[string]any{"documents": []map[string]any{{"id": "3", "dimension": 3, "vector": []float32{1, 1, 1}}}}, []float32{1, 1, 1}),
+		"missing dimension": binaryBody(t, map[string]any{"documents": []map[string]any{{"id": "3"}}}, []float32{1, 1, 1}),
+	} {
+		w = post("/v1/collections/binary/documents/batchupsert", body)
+		assert.Equal(t, http.StatusBadRequest, w.Code, name)
+	}
+}
+
 func TestHandleSetParams(t *testing.T) {
 	server, cleanup := setupTestServer(t)
 	defer cleanup()
@@ -664,3 +2044,654 @@ func TestHandleSetParams(t *testing.T) {
 	server.router.ServeHTTP(w, r)
 	assert.Equal(t, http.StatusBadRequest, w.Code)
 }
+
+func TestHandleTenants(t *testing.T) {
+	server, cleanup := setupTestServer(t)
+	defer cleanup()
+
+	do := func(method, path, tenant string, req any) *httptest.ResponseRecorder {
+		var body bytes.Buffer
+		if req != nil {
+			assert.NoError(t, json.NewEncoder(&body).Encode(req))
+		}
+		r := httptest.NewRequest(method, path, &body)
+		if tenant != "" {
+			r.Header.Set(TenantHeader, tenant)
+		}
+		w := httptest.NewRecorder()
+		server.router.ServeHTTP(w, r)
+		return w
+	}
+
+	// the same collection name is separate per tenant
+	for _, tenant := range []string{"", "acme"} {
+		w := do(http.MethodPost, "/v1/collections", tenant, CreateCollectionRequest{Name: "docs", Dimension: 3})
+		assert.Equal(t, http.StatusOK, w.Code)
+		var created map[string]interface{}
+		assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &created))
+		assert.Equal(t, "docs", created["name"])
+	}
+	w := do(http.MethodPost, "/v1/collections", "other", CreateCollectionRequest{Name: "notes", Dimension: 3})
+	assert.Equal(t, http.StatusOK, w.Code)
+
+	w = do(http.MethodPost, "/v1/collections/docs/documents", "acme", UpsertDocumentRequest{ID: "1", Vector: []float32{1, 2, 3}})
+	assert.Equal(t, http.StatusOK, w.Code)
+	w = do(http.MethodGet, "/v1/collections/docs/documents/1", "acme", nil)
+	assert.Equal(t, http.StatusOK, w.Code)
+	w = do(http.MethodGet, "/v1/collections/docs/documents/1", "", nil)
+	assert.Equal(t, http.StatusNotFound, w.Code)
+	w = do(http.MethodGet, "/v1/collections/notes", "acme", nil)
+	assert.Equal(t, http.StatusNotFound, w.Code)
+
+	for tenant, want := range map[string][]string{"": {"docs"}, "acme": {"docs"}, "other": {"notes"}, "none": {}} {
+		w = do(http.MethodGet, "/v1/collections", tenant, nil)
+		assert.Equal(t, http.StatusOK, w.Code)
+		var list ListCollectionsResponse
+		assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &list))
+		assert.ElementsMatch(t, want, list.Collections, "tenant %q", tenant)
+		assert.Len(t, list.Stats, len(want), "tenant %q", tenant)
+	}
+	var list ListCollectionsResponse
+	assert.NoError(t, json.Unmarshal(do(http.MethodGet, "/v1/collections", "acme", nil).Body.Bytes(), &list))
+	assert.Equal(t, int64(1), list.Stats["docs"].Documents)
+	assert.Equal(t, int64(1), list.Stats["docs"].Vectors)
+
+	// tenants can't reach each other through qualified names
+	w = do(http.MethodGet, "/v1/collections/acme:docs", "", nil)
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+	w = do(http.MethodGet, "/v1/collections", "bad tenant", nil)
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+
+	w = do(http.MethodDelete, "/v1/collections/docs", "acme", nil)
+	assert.Equal(t, http.StatusOK, w.Code)
+	w = do(http.MethodGet, "/v1/collections/docs", "", nil)
+	assert.Equal(t, http.StatusOK, w.Code)
+}
+
+func TestHandleMultiSearch(t *testing.T) {
+	server, cleanup := setupTestServer(t)
+	defer cleanup()
+
+	post := func(path, tenant, body string) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		r := httptest.NewRequest(http.MethodPost, path, bytes.NewBufferString(body))
+		if tenant != "" {
+			r.Header.Set(TenantHeader, tenant)
+		}
+		server.router.ServeHTTP(w, r)
+		return w
+	}
+
+	for name, vector := range map[string]string{"en": "[0,1]", "de": "[0.5,0]"} {
+		w := post("/v1/collections", "acme", `{"name":"`+name+`","dimension":2}`)
+		assert.Equal(t, http.StatusOK, w.Code)
+		w = post("/v1/collections/"+name+"/documents", "acme", `{"id":"`+name+`-1","vector":`+vector+`}`)
+		assert.Equal(t, http.StatusOK, w.Code)
+	}
+
+	w := post("/v1/search/multi", "acme", `{"collections":[{"name":"en","weight":100},{"name":"de"}],"vector":[1,0],"limit":2}`)
+	assert.Equal(t, http.StatusOK, w.Code)
+	var response struct {
+		Results []MultiSearchResult `json:"results"`
+	}
+	assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &response))
+	if assert.Len(t, response.Results, 2) {
+		assert.Equal(t, "de", response.Results[0].Collection)
+		assert.Equal(t, "de-1", response.Results[0].ID)
+		assert.InDelta(t, 0.25, response.Results[0].WeightedDistance, 1e-6)
+		assert.Equal(t, "en", response.Results[1].Collection)
+		assert.InDelta(t, 2, response.Results[1].Distance, 1e-6)
+		assert.InDelta(t, 200, response.Results[1].WeightedDistance, 1e-4)
+	}
+
+	w = post("/v1/search/multi", "acme", `{"collections":[{"name":"en"},{"name":"missing"}],"vector":[1,0],"limit":2}`)
+	assert.Equal(t, http.StatusNotFound, w.Code)
+	// other tenants don't see the collections
+	w = post("/v1/search/multi", "", `{"collections":[{"name":"en"}],"vector":[1,0],"limit":2}`)
+	assert.Equal(t, http.StatusNotFound, w.Code)
+	w = post("/v1/search/multi", "acme", `{"collections":[],"vector":[1,0],"limit":2}`)
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+	w = post("/v1/search/multi", "acme", `{"collections":[{"name":"en"}],"limit":2}`)
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+}
+
+func TestHandleUpsertDedup(t *testing.T) {
+	server, cleanup := setupTestServer(t)
+	defer cleanup()
+
+	post := func(path, body string) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		server.router.ServeHTTP(w, httptest.NewRequest(http.MethodPost, path, bytes.NewBufferString(body)))
+		return w
+	}
+
+	w := post("/v1/collections", `{"name":"docs","dimension":2,"dedup_threshold":0.01,"dedup_mode":"bogus"}`)
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+	w = post("/v1/collections", `{"name":"docs","dimension":2,"dedup_threshold":0.01}`)
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Contains(t, w.Body.String(), `"dedup_threshold":0.01`)
+
+	w = post("/v1/collections/docs/documents", `{"id":"1","vector":[1,0]}`)
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.NotContains(t, w.Body.String(), "duplicate")
+	w = post("/v1/collections/docs/documents", `{"id":"2","vector":[1,0]}`)
+	assert.Equal(t, http.StatusOK, w.Code)
+	var upsert struct {
+		Duplicate *DuplicateResponse `json:"duplicate"`
+	}
+	assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &upsert))
+	if assert.NotNil(t, upsert.Duplicate) {
+		assert.Equal(t, DuplicateResponse{ID: "2", MatchedID: "1"}, *upsert.Duplicate)
+	}
+
+	w = post("/v1/collections/docs/documents/batchupsert", `{"documents":[{"id":"3","vector":[1,0]},{"id":"4","vector":[0,1]}]}`)
+	assert.Equal(t, http.StatusOK, w.Code)
+	var batch struct {
+		Duplicates []DuplicateResponse `json:"duplicates"`
+	}
+	assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &batch))
+	assert.Equal(t, []DuplicateResponse{{ID: "3", MatchedID: "1"}}, batch.Duplicates)
+}
+
+func TestRateLimit(t *testing.T) {
+	server, cleanup := setupTestServer(t, func(conf *config.Config) {
+		conf.Server.RateLimit = 0.5
+		conf.Server.RateLimitBurst = 2
+	})
+	defer cleanup()
+
+	get := func(remoteAddr string) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		req := httptest.NewRequest(http.MethodGet, "/v1/collections", nil)
+		req.RemoteAddr = remoteAddr
+		server.router.ServeHTTP(w, req)
+		return w
+	}
+
+	// the burst is allowed, then the client has to wait for a token
+	assert.Equal(t, http.StatusOK, get("10.0.0.1:1000").Code)
+	assert.Equal(t, http.StatusOK, get("10.0.0.1:1001").Code)
+	w := get("10.0.0.1:1002")
+	assert.Equal(t, http.StatusTooManyRequests, w.Code)
+	assert.Equal(t, "2", w.Header().Get("Retry-After"))
+
+	// other clients have buckets of their own
+	assert.Equal(t, http.StatusOK, get("10.0.0.2:1000").Code)
+}
+
+func TestLimitInflight(t *testing.T) {
+	release := make(chan struct{})
+	started := make(chan struct{})
+	router := gin.New()
+	router.GET("/heavy", limitInflight(1), func(c *gin.Context) {
+		close(started)
+		<-release
+		c.Status(http.StatusOK)
+	})
+
+	first := httptest.NewRecorder()
+	done := make(chan struct{})
+	go func() {
+		router.ServeHTTP(first, httptest.NewRequest(http.MethodGet, "/heavy", nil))
+		close(done)
+	}()
+	<-started
+
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/heavy", nil))
+	assert.Equal(t, http.StatusTooManyRequests, w.Code)
+	assert.Equal(t, "1", w.Header().Get("Retry-After"))
+
+	close(release)
+	<-done
+	assert.Equal(t, http.StatusOK, first.Code)
+}
+
+func TestRequestGuardrails(t *testing.T) {
+	server, cleanup := setupTestServer(t, func(conf *config.Config) {
+		conf.Server.MaxLimit = 10
+		conf.Server.MaxEfSearch = 100
+		conf.Server.MaxBatchSize = 2
+		conf.Server.MaxBodyBytes = 256
+	})
+	defer cleanup()
+
+	post := func(path, body string) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		server.router.ServeHTTP(w, httptest.NewRequest(http.MethodPost, path, bytes.NewBufferString(body)))
+		return w
+	}
+
+	w := post("/v1/collections", `{"name":"docs","dimension":2}`)
+	assert.Equal(t, http.StatusOK, w.Code)
+
+	for body, want := range map[string]int{
+		`{"vector":[1,0],"limit":10}`:                          http.StatusOK,
+		`{"vector":[1,0],"limit":1000000}`:                     http.StatusBadRequest,
+		`{"vector":[1,0],"limit":5,"offset":6}`:                http.StatusBadRequest,
+		`{"vector":[1,0],"limit":1,"params":{"efsearch":100}}`: http.StatusOK,
+		`{"vector":[1,0],"limit":1,"params":{"efsearch":1e9}}`: http.StatusBadRequest,
+	} {
+		w = post("/v1/collections/docs/vectors/search", body)
+		assert.Equal(t, want, w.Code, body)
+	}
+	w = post("/v1/collections/docs/documents/search", `{"vector":[1,0],"limit":1,"rerank":{"type":"mmr","top_n":11}}`)
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+	assert.Contains(t, w.Body.String(), "top_n must be at most 10")
+
+	w = post("/v1/collections/docs/documents/batchupsert", `{"documents":[{"id":"1","vector":[1,0]},{"id":"2","vector":[0,1]}]}`)
+	assert.Equal(t, http.StatusOK, w.Code)
+	w = post("/v1/collections/docs/documents/batchupsert", `{"documents":[{"id":"1","vector":[1,0]},{"id":"2","vector":[0,1]},{"id":"3","vector":[1,1]}]}`)
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+	assert.Contains(t, w.Body.String(), "at most 2 documents")
+
+	w = post("/v1/collections/docs/documents", `{"id":"4","vector":[1,0],"parameters":{"text":"`+strings.Repeat("x", 256)+`"}}`)
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+	assert.Contains(t, w.Body.String(), "exceeds 256 bytes")
+}
+
+func TestShedLoad(t *testing.T) {
+	router := gin.New()
+	router.GET("/heavy", shedLoad(1), func(c *gin.Context) { c.Status(http.StatusOK) })
+	router.GET("/light", shedLoad(0), func(c *gin.Context) { c.Status(http.StatusOK) })
+
+	// any live heap is over a watermark of one byte
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/heavy", nil))
+	assert.Equal(t, http.StatusServiceUnavailable, w.Code)
+	assert.Equal(t, "1", w.Header().Get("Retry-After"))
+
+	w = httptest.NewRecorder()
+	router.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/light", nil))
+	assert.Equal(t, http.StatusOK, w.Code)
+}
+
+func TestHandleReloadConfig(t *testing.T) {
+	server, cleanup := setupTestServer(t)
+	defer cleanup()
+	defer logger.SetLevel(logger.InfoLevel)
+
+	reload := func() *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		server.router.ServeHTTP(w, httptest.NewRequest(http.MethodPost, "/v1/admin/reload", nil))
+		return w
+	}
+	get := func() int {
+		w := httptest.NewRecorder()
+		server.router.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/v1/collections", nil))
+		return w.Code
+	}
+
+	// reloading is off without a config file
+	assert.Equal(t, http.StatusInternalServerError, reload().Code)
+
+	configFile := server.db.Config().Dir + "/conf.yaml"
+	server.SetConfigFile(configFile)
+	write := func(content string) {
+		assert.NoError(t, os.WriteFile(configFile, []byte("dir: "+server.db.Config().Dir+"\n"+content), 0644))
+	}
+	write("server:\n  rate_limit: 0.001\n  rate_limit_burst: 1\ncache:\n  size: 3\nlogging:\n  level: debug\n")
+	w := reload()
+	assert.Equal(t, http.StatusOK, w.Code)
+	var resp struct {
+		Changed []string `json:"changed"`
+	}
+	assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &resp))
+	assert.ElementsMatch(t, []string{"server.rate_limit", "server.rate_limit_burst", "cache.size", "logging.level"}, resp.Changed)
+	assert.Equal(t, 3, server.db.Config().Cache.Size)
+	assert.Equal(t, http.StatusOK, get())
+	assert.Equal(t, http.StatusTooManyRequests, get())
+
+	// the client is rate limited now, SIGHUP reloads the same way
+	write("storage:\n  max_level: 3\n")
+	_, err := server.ReloadConfig()
+	assert.ErrorContains(t, err, "storage.max_level can't be changed without a restart")
+	assert.Equal(t, 3, server.db.Config().Cache.Size)
+
+	write("cache:\n  size: -1\n  unknown: 1\n")
+	_, err = server.ReloadConfig()
+	assert.ErrorIs(t, err, pkgerrors.ErrInvalidParameter)
+
+	write("")
+	changed, err := server.ReloadConfig()
+	assert.NoError(t, err)
+	assert.Len(t, changed, 4)
+	assert.Equal(t, http.StatusOK, get())
+	assert.Equal(t, http.StatusOK, get())
+}
+
+func TestAuditLog(t *testing.T) {
+	server, cleanup := setupTestServer(t, func(conf *config.Config) {
+		conf.Audit.Enabled = true
+	})
+	defer cleanup()
+	assert.NoError(t, server.OpenAuditLog())
+	defer server.Close()
+
+	do := func(method, url string, body any, header ...string) int {
+		var reader *bytes.Reader
+		if body != nil {
+			data, err := json.Marshal(body)
+			assert.NoError(t, err)
+			reader = bytes.NewReader(data)
+		} else {
+			reader = bytes.NewReader(nil)
+		}
+		w := httptest.NewRecorder()
+		req := httptest.NewRequest(method, url, reader)
+		for i := 0; i < len(header); i += 2 {
+			req.Header.Set(header[i], header[i+1])
+		}
+		server.router.ServeHTTP(w, req)
+		return w.Code
+	}
+	assert.Equal(t, http.StatusOK, do(http.MethodPost, "/v1/collections", CreateCollectionRequest{Name: "docs", IndexType: "hnsw", Dimension: 3}))
+	assert.Equal(t, http.StatusOK, do(http.MethodPost, "/v1/collections/docs/documents", UpsertDocumentRequest{ID: "doc1", Vector: []float32{1, 2, 3}}))
+
+	assert.Equal(t, http.StatusOK, do(http.MethodDelete, "/v1/collections/docs/documents/doc1", nil, "Authorization", "Bearer secret"))
+	assert.Equal(t, http.StatusNotFound, do(http.MethodDelete, "/v1/collections/docs/documents/doc2", nil))
+	assert.Equal(t, http.StatusOK, do(http.MethodPost, "/v1/collections/docs/documents/setparams", SetParamsRequest{Parameters: map[string]any{"efsearch": 64}}))
+	assert.Equal(t, http.StatusOK, do(http.MethodDelete, "/v1/collections/docs", nil, RequestIDHeader, "req-1"))
+
+	data, err := os.ReadFile(server.db.Config().Audit.File)
+	assert.NoError(t, err)
+	assert.NotContains(t, string(data), "secret")
+	var records []map[string]any
+	for _, line := range strings.Split(strings.TrimSpace(string(data)), "\n") {
+		var record map[string]any
+		assert.NoError(t, json.Unmarshal([]byte(line), &record))
+		records = append(records, record)
+	}
+	// upserts and the create aren't destructive
+	assert.Len(t, records, 4)
+	assert.Equal(t, "delete_document", records[0]["action"])
+	assert.Equal(t, "doc1", records[0]["document_id"])
+	assert.Equal(t, apiKeyFingerprint(&gin.Context{Request: &http.Request{Header: http.Header{"X-Api-Key": {"secret"}}}}), records[0]["api_key"])
+	assert.NotEmpty(t, records[0]["client_ip"])
+	assert.Equal(t, float64(http.StatusNotFound), records[1]["status"])
+	assert.Equal(t, "set_params", records[2]["action"])
+	assert.Equal(t, map[string]any{"parameters": map[string]any{"efsearch": float64(64)}}, records[2]["details"])
+	assert.Equal(t, "delete_collection", records[3]["action"])
+	assert.Equal(t, "docs", records[3]["collection"])
+	assert.Equal(t, "req-1", records[3]["request_id"])
+}
+
+func TestRequestID(t *testing.T) {
+	server, cleanup := setupTestServer(t)
+	defer cleanup()
+
+	get := func(id string) string {
+		w := httptest.NewRecorder()
+		req := httptest.NewRequest(http.MethodGet, "/", nil)
+		if id != "" {
+			req.Header.Set(RequestIDHeader, id)
+		}
+		server.router.ServeHTTP(w, req)
+		return w.Header().Get(RequestIDHeader)
+	}
+
+	assert.Len(t, get(""), 16)
+	assert.NotEqual(t, get(""), get(""))
+	assert.Equal(t, "trace-1", get("trace-1"))
+	// IDs that would garble the log are replaced
+	assert.Len(t, get("bad id\n"), 16)
+}
+
+func TestTraceRequest(t *testing.T) {
+	recorder := tracetest.NewSpanRecorder()
+	originalProvider, originalPropagator := otel.GetTracerProvider(), otel.GetTextMapPropagator()
+	otel.SetTracerProvider(sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(recorder)))
+	otel.SetTextMapPropagator(propagation.TraceContext{})
+	defer func() {
+		otel.SetTracerProvider(originalProvider)
+		otel.SetTextMapPropagator(originalPropagator)
+	}()
+
+	server, cleanup := setupTestServer(t)
+	defer cleanup()
+
+	w := httptest.NewRecorder()
+	req := httptest.NewRequest(http.MethodGet, "/v1/collections/missing", nil)
+	req.Header.Set("traceparent", "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01")
+	server.router.ServeHTTP(w, req)
+
+	spans := recorder.Ended()
+	if assert.Len(t, spans, 1) {
+		span := spans[0]
+		assert.Equal(t, "GET /v1/collections/:name", span.Name())
+		// the client's trace is continued
+		assert.Equal(t, "4bf92f3577b34da6a3ce929d0e0e4736", span.SpanContext().TraceID().String())
+		assert.Equal(t, "00f067aa0ba902b7", span.Parent().SpanID().String())
+		assert.Contains(t, span.Attributes(), semconv.HTTPResponseStatusCode(w.Code))
+	}
+}
+
+func TestReplication(t *testing.T) {
+	leader, cleanupLeader := setupTestServer(t)
+	defer cleanupLeader()
+	ts := httptest.NewServer(leader.Handler())
+	defer ts.Close()
+	follower, cleanupFollower := setupTestServer(t, func(conf *config.Config) {
+		conf.Replication.Leader = ts.URL
+	})
+	defer cleanupFollower()
+
+	do := func(s *Server, method, path string, req any) *httptest.ResponseRecorder {
+		var body bytes.Buffer
+		if req != nil {
+			assert.NoError(t, json.NewEncoder(&body).Encode(req))
+		}
+		w := httptest.NewRecorder()
+		s.router.ServeHTTP(w, httptest.NewRequest(method, path, &body))
+		return w
+	}
+
+	assert.Equal(t, http.StatusOK, do(leader, http.MethodPost, "/v1/collections",
+		CreateCollectionRequest{Name: "test_collection", Dimension: 3}).Code)
+	assert.Equal(t, http.StatusOK, do(leader, http.MethodPost, "/v1/collections/test_collection/documents",
+		UpsertDocumentRequest{ID: "doc1", Vector: []float32{1, 2, 3}, Parameters: map[string]any{"tag": "a"}}).Code)
+
+	assert.Eventually(t, func() bool {
+		return do(follower, http.MethodGet, "/v1/collections/test_collection/documents/doc1", nil).Code == http.StatusOK
+	}, 5*time.Second, 10*time.Millisecond)
+	w := do(follower, http.MethodPost, "/v1/collections/test_collection/vectors/search",
+		SearchVectorRequest{Vector: []float32{1, 2, 3}, Limit: 1})
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Contains(t, w.Body.String(), "doc1")
+
+	// writes must go to the leader
+	w = do(follower, http.MethodPost, "/v1/collections/test_collection/documents",
+		UpsertDocumentRequest{ID: "doc2", Vector: []float32{1, 2, 3}})
+	assert.Equal(t, http.StatusForbidden, w.Code)
+	assert.Contains(t, w.Body.String(), ts.URL)
+	w = do(follower, http.MethodPost, "/v1/collections/test_collection/vacuum", nil)
+	assert.Equal(t, http.StatusForbidden, w.Code)
+
+	w = do(follower, http.MethodGet, "/v1/replication/status", nil)
+	assert.Equal(t, http.StatusOK, w.Code)
+	var status struct {
+		Role     string                     `json:"role"`
+		Follower replication.FollowerStatus `json:"follower"`
+	}
+	assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &status))
+	assert.Equal(t, "follower", status.Role)
+	assert.NotEmpty(t, status.Follower.Epoch)
+	assert.NotZero(t, status.Follower.AppliedSeq)
+
+	assert.Equal(t, http.StatusOK, do(leader, http.MethodDelete, "/v1/collections/test_collection", nil).Code)
+	assert.Eventually(t, func() bool {
+		return do(follower, http.MethodGet, "/v1/collections/test_collection", nil).Code == http.StatusNotFound
+	}, 5*time.Second, 10*time.Millisecond)
+
+	w = do(leader, http.MethodGet, "/v1/replication/status", nil)
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Contains(t, w.Body.String(), `"role":"leader"`)
+
+	// a follower on a position the leader doesn't have must be resynced
+	w = do(leader, http.MethodGet, "/v1/replication/stream?epoch=old&from=1", nil)
+	assert.Equal(t, http.StatusGone, w.Code)
+}
+
+func TestConsensus(t *testing.T) {
+	const nodes = 3
+	var peers []config.PeerConfig
+	https := make([]*httptest.Server, nodes)
+	for i := range https {
+		https[i] = httptest.NewUnstartedServer(nil)
+		defer https[i].Close()
+		l, err := net.Listen("tcp", "127.0.0.1:0")
+		assert.NoError(t, err)
+		raftAddr := l.Addr().String()
+		l.Close()
+		peers = append(peers, config.PeerConfig{
+			ID:       fmt.Sprintf("n%d", i),
+			RaftAddr: raftAddr,
+			HTTPAddr: "http://" + https[i].Listener.Addr().String(),
+		})
+	}
+	servers := make([]*Server, nodes)
+	for i := range servers {
+		server, cleanup := setupTestServer(t, func(conf *config.Config) {
+			conf.Consensus.NodeID = peers[i].ID
+			conf.Consensus.Peers = peers
+		})
+		defer cleanup()
+		assert.NoError(t, server.StartConsensus())
+		defer server.Close()
+		https[i].Config.Handler = server.Handler()
+		https[i].Start()
+		servers[i] = server
+	}
+
+	send := func(i int, method, path string, req any) *http.Response {
+		body, err := json.Marshal(req)
+		assert.NoError(t, err)
+		r, err := http.NewRequest(method, https[i].URL+path, bytes.NewReader(body))
+		assert.NoError(t, err)
+		resp, err := http.DefaultClient.Do(r)
+		assert.NoError(t, err)
+		resp.Body.Close()
+		return resp
+	}
+
+	// writes are accepted once a leader is elected, on any node
+	assert.Eventually(t, func() bool {
+		return send(1, http.MethodPost, "/v1/collections",
+			CreateCollectionRequest{Name: "test_collection", Dimension: 3}).StatusCode == http.StatusOK
+	}, 10*time.Second, 100*time.Millisecond)
+	for i := 0; i < nodes; i++ {
+		resp := send(i, http.MethodPost, "/v1/collections/test_collection/documents",
+			UpsertDocumentRequest{ID: fmt.Sprintf("doc%d", i), Vector: []float32{1, 2, float32(i)}})
+		assert.Equal(t, http.StatusOK, resp.StatusCode)
+	}
+
+	// every node applies every write
+	for i := range servers {
+		assert.Eventually(t, func() bool {
+			count, err := servers[i].db.IndexManager.Count("test_collection")
+			return err == nil && count == nodes
+		}, 5*time.Second, 10*time.Millisecond)
+	}
+
+	leaders := 0
+	for i := range servers {
+		w := httptest.NewRecorder()
+		servers[i].router.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/v1/consensus/status", nil))
+		assert.Equal(t, http.StatusOK, w.Code)
+		if strings.Contains(w.Body.String(), `"state":"Leader"`) {
+			leaders++
+		}
+	}
+	assert.Equal(t, 1, leaders)
+}
+
+func TestAPIKeyFilter(t *testing.T) {
+	t.Setenv("OASISDB_TEST_TENANT_A_KEY", "key-a")
+	server, cleanup := setupTestServer(t, func(conf *config.Config) {
+		conf.Server.APIKeys = []config.APIKeyConfig{
+			{KeyEnv: "OASISDB_TEST_TENANT_A_KEY", Filter: map[string]any{"tenant_id": "a"}},
+		}
+	})
+	defer cleanup()
+
+	body, err := json.Marshal(CreateCollectionRequest{Name: "docs", Dimension: 2})
+	assert.NoError(t, err)
+	w := httptest.NewRecorder()
+	server.router.ServeHTTP(w, httptest.NewRequest(http.MethodPost, "/v1/collections", bytes.NewReader(body)))
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.NoError(t, server.db.BatchUpsertDocuments("docs", []*db.Document{
+		{ID: "1", Vector: []float32{1, 0}, Dimension: 2, Parameters: map[string]any{"tenant_id": "b"}},
+		{ID: "2", Vector: []float32{0, 1}, Dimension: 2, Parameters: map[string]any{"tenant_id": "a"}},
+	}))
+
+	send := func(method, path, body, key string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(method, path, strings.NewReader(body))
+		if key != "" {
+			req.Header.Set("Authorization", "Bearer "+key)
+		}
+		w := httptest.NewRecorder()
+		server.router.ServeHTTP(w, req)
+		return w
+	}
+	searchIDs := func(key string) []string {
+		w := send(http.MethodPost, "/v1/collections/docs/vectors/search", `{"vector":[1,0],"limit":2}`, key)
+		assert.Equal(t, http.StatusOK, w.Code)
+		var resp struct {
+			IDs []string `json:"ids"`
+		}
+		assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &resp))
+		return resp.IDs
+	}
+
+	// the cached search of a request without a key is not served to the key
+	assert.Equal(t, []string{"1", "2"}, searchIDs(""))
+	assert.Equal(t, []string{"2"}, searchIDs("key-a"))
+	assert.Equal(t, []string{"1", "2"}, searchIDs("other-key"))
+
+	w = send(http.MethodPost, "/v1/collections/docs/documents/search", `{"vector":[1,0],"limit":2,"filter":{"tenant_id":"b"}}`, "key-a")
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Contains(t, w.Body.String(), `"id":"2"`)
+	assert.NotContains(t, w.Body.String(), `"id":"1"`)
+
+	assert.Equal(t, http.StatusNotFound, send(http.MethodGet, "/v1/collections/docs/documents/1", "", "key-a").Code)
+	assert.Equal(t, http.StatusOK, send(http.MethodGet, "/v1/collections/docs/documents/2", "", "key-a").Code)
+	assert.Equal(t, http.StatusOK, send(http.MethodGet, "/v1/collections/docs/documents/1", "", "").Code)
+
+	w = send(http.MethodPost, "/v1/collections/docs/scroll", "", "key-a")
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Contains(t, w.Body.String(), `"id":"2"`)
+	assert.NotContains(t, w.Body.String(), `"id":"1"`)
+
+	w = send(http.MethodGet, "/v1/collections/docs/ids", "", "key-a")
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.JSONEq(t, `{"ids":["2"],"count":1,"cursor":""}`, w.Body.String())
+
+	w = send(http.MethodGet, "/v1/collections/docs/clusters", "", "key-a")
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Contains(t, w.Body.String(), `"2"`)
+	assert.NotContains(t, w.Body.String(), `"1"`)
+
+	// writes may neither leave the scope nor replace documents outside it
+	w = send(http.MethodPost, "/v1/collections/docs/documents", `{"id":"3","vector":[1,1],"parameters":{"tenant_id":"b"}}`, "key-a")
+	assert.Equal(t, http.StatusForbidden, w.Code)
+	w = send(http.MethodPost, "/v1/collections/docs/documents", `{"id":"1","vector":[1,1],"parameters":{"tenant_id":"a"}}`, "key-a")
+	assert.Equal(t, http.StatusForbidden, w.Code)
+	w = send(http.MethodPost, "/v1/collections/docs/documents", `{"id":"3","vector":[1,1],"parameters":{"tenant_id":1}}`, "key-a")
+	assert.Equal(t, http.StatusForbidden, w.Code, "values of another type don't match")
+	w = send(http.MethodPost, "/v1/collections/docs/documents/batchupsert", `{"documents":[{"id":"3","vector":[1,1],"parameters":{"tenant_id":"a"}},{"id":"1","vector":[1,1],"parameters":{"tenant_id":"a"}}]}`, "key-a")
+	assert.Equal(t, http.StatusForbidden, w.Code)
+	w = send(http.MethodPost, "/v1/collections/docs/documents", `{"id":"3","vector":[1,1],"parameters":{"tenant_id":"a"}}`, "key-a")
+	assert.Equal(t, http.StatusOK, w.Code)
+	w = send(http.MethodPost, "/v1/collections/docs/documents/batchupsert", `{"documents":[{"id":"4","vector":[1,1],"parameters":{"tenant_id":"a"}}]}`, "key-a")
+	assert.Equal(t, http.StatusOK, w.Code)
+	doc, err := server.db.GetDocument("docs", "1")
+	assert.NoError(t, err)
+	assert.Equal(t, "b", doc.Parameters["tenant_id"])
+
+	// archiving only moves the documents in scope, restoring only finds them
+	ids, err := server.db.ArchiveDocuments("docs", -time.Hour, map[string]any{"tenant_id": "a"})
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"2", "3", "4"}, ids)
+	assert.Equal(t, http.StatusNotFound, send(http.MethodPost, "/v1/collections/docs/documents/1/restore", "", "key-a").Code)
+	assert.Equal(t, http.StatusOK, send(http.MethodPost, "/v1/collections/docs/documents/2/restore", "", "key-a").Code)
+}
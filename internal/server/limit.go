@@ -0,0 +1,225 @@
+package server
+
+import (
+	"fmt"
+	"math"
+	"net/http"
+	"runtime/metrics"
+	"strconv"
+	"sync"
+	"time"
+
+	"oasisdb/internal/config"
+	"oasisdb/internal/consensus"
+	pkgerrors "oasisdb/pkg/errors"
+
+	"github.com/gin-gonic/gin"
+)
+
+// maxTrackedClients bounds the rate limit buckets kept in memory, buckets of
+// idle clients are dropped once it is reached
+const maxTrackedClients = 10000
+
+// tokenBucket holds the tokens of one client, it is refilled lazily
+type tokenBucket struct {
+	tokens float64
+	last   time.Time
+}
+
+// clientLimiter rate limits each client with a token bucket of its own
+type clientLimiter struct {
+	mu      sync.Mutex
+	rate    float64
+	burst   float64
+	buckets map[string]*tokenBucket
+}
+
+// newClientLimiter returns a limiter letting every request through when rate
+// is not positive, until set changes it
+func newClientLimiter(rate float64, burst int) *clientLimiter {
+	l := &clientLimiter{}
+	l.set(rate, burst)
+	return l
+}
+
+// set changes the rate and burst, the buckets of the clients start over
+func (l *clientLimiter) set(rate float64, burst int) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if burst <= 0 {
+		burst = int(math.Ceil(rate))
+	}
+	l.rate = rate
+	l.burst = float64(burst)
+	l.buckets = make(map[string]*tokenBucket)
+}
+
+// allow takes a token of client, without one it returns how long until the
+// next token is refilled
+func (l *clientLimiter) allow(client string, now time.Time) (bool, time.Duration) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if l.rate <= 0 {
+		return true, 0
+	}
+
+	b, ok := l.buckets[client]
+	if !ok {
+		if len(l.buckets) >= maxTrackedClients {
+			l.dropIdle(now)
+		}
+		b = &tokenBucket{tokens: l.burst, last: now}
+		l.buckets[client] = b
+	}
+	b.tokens = min(l.burst, b.tokens+now.Sub(b.last).Seconds()*l.rate)
+	b.last = now
+	if b.tokens < 1 {
+		return false, time.Duration((1 - b.tokens) / l.rate * float64(time.Second))
+	}
+	b.tokens--
+	return true, 0
+}
+
+// dropIdle removes the buckets that have refilled completely, a client
+// without a bucket starts with a full one so nothing is lost
+func (l *clientLimiter) dropIdle(now time.Time) {
+	full := time.Duration(l.burst / l.rate * float64(time.Second))
+	for client, b := range l.buckets {
+		if now.Sub(b.last) >= full {
+			delete(l.buckets, client)
+		}
+	}
+}
+
+// rateLimit rejects requests of clients that exceed the configured rate
+func rateLimit(limiter *clientLimiter) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		// writes committed through raft must be applied whatever the load
+		if limiter == nil || consensus.Applying(c.Request.Context()) {
+			c.Next()
+			return
+		}
+		if ok, wait := limiter.allow(c.ClientIP(), time.Now()); !ok {
+			tooManyRequests(c, wait, "rate limit exceeded")
+			return
+		}
+		c.Next()
+	}
+}
+
+// limitInflight caps the number of concurrent requests through the handler,
+// requests over the cap are rejected instead of queued so a burst of heavy
+// requests can't pile up
+func limitInflight(max int) gin.HandlerFunc {
+	if max <= 0 {
+		return func(c *gin.Context) { c.Next() }
+	}
+	slots := make(chan struct{}, max)
+	return func(c *gin.Context) {
+		if consensus.Applying(c.Request.Context()) {
+			c.Next()
+			return
+		}
+		select {
+		case slots <- struct{}{}:
+			defer func() { <-slots }()
+			c.Next()
+		default:
+			tooManyRequests(c, time.Second, "too many concurrent requests")
+		}
+	}
+}
+
+// limitBody rejects request bodies over max bytes, bodies without a
+// Content-Length fail to bind once they reach it
+func limitBody(max int64) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if max <= 0 || c.Request.Body == nil || consensus.Applying(c.Request.Context()) {
+			c.Next()
+			return
+		}
+		if c.Request.ContentLength > max {
+			c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("request body exceeds %d bytes", max)})
+			return
+		}
+		c.Request.Body = http.MaxBytesReader(c.Writer, c.Request.Body, max)
+		c.Next()
+	}
+}
+
+// heapMetric is the memory occupied by live and not yet swept heap objects
+const heapMetric = "/memory/classes/heap/objects:bytes"
+
+// heapInUse reads the heap in use without stopping the world, unlike
+// runtime.ReadMemStats
+func heapInUse() uint64 {
+	sample := []metrics.Sample{{Name: heapMetric}}
+	metrics.Read(sample)
+	if sample[0].Value.Kind() != metrics.KindUint64 {
+		return 0
+	}
+	return sample[0].Value.Uint64()
+}
+
+// shedLoad rejects requests with 503 while the heap is over the watermark,
+// so heavy requests don't add to it until the garbage collector catches up.
+// It doesn't call c.Next, it can run before another middleware
+func shedLoad(watermark uint64) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if watermark == 0 || consensus.Applying(c.Request.Context()) {
+			return
+		}
+		if heapInUse() > watermark {
+			c.Header("Retry-After", "1")
+			c.AbortWithStatusJSON(http.StatusServiceUnavailable, gin.H{"error": "server is over its memory watermark"})
+		}
+	}
+}
+
+// stallWrites rejects document writes with 503 while the scalar storage
+// stops writes until compaction catches up, instead of holding them open
+func (s *Server) stallWrites() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if consensus.Applying(c.Request.Context()) {
+			return
+		}
+		if s.db.WritesStopped() {
+			c.Header("Retry-After", "1")
+			c.AbortWithStatusJSON(http.StatusServiceUnavailable, gin.H{"error": pkgerrors.ErrWriteStall.Error()})
+		}
+	}
+}
+
+// checkSearchLimits checks a search against the configured caps, topN is the
+// rerank candidates or 0. Params are only checked if they are numbers, the
+// index rejects other values
+func checkSearchLimits(conf *config.ServerConfig, limit, offset, topN int, params map[string]any) error {
+	if conf.MaxLimit > 0 && limit+offset > conf.MaxLimit {
+		return fmt.Errorf("limit plus offset must be at most %d, got %d", conf.MaxLimit, limit+offset)
+	}
+	if conf.MaxLimit > 0 && topN > conf.MaxLimit {
+		return fmt.Errorf("rerank top_n must be at most %d, got %d", conf.MaxLimit, topN)
+	}
+	caps := map[string]int{"efsearch": conf.MaxEfSearch, "nprobe": conf.MaxNProbe}
+	for key, val := range params {
+		v, ok := val.(float64)
+		if max := caps[key]; ok && max > 0 && v > float64(max) {
+			return fmt.Errorf("%s must be at most %d, got %v", key, max, v)
+		}
+	}
+	return nil
+}
+
+// checkBatchSize checks the document count of a batch write against the cap
+func checkBatchSize(conf *config.ServerConfig, n int) error {
+	if conf.MaxBatchSize > 0 && n > conf.MaxBatchSize {
+		return fmt.Errorf("batch must have at most %d documents, got %d", conf.MaxBatchSize, n)
+	}
+	return nil
+}
+
+// tooManyRequests aborts with 429, Retry-After is rounded up to whole seconds
+func tooManyRequests(c *gin.Context, wait time.Duration, msg string) {
+	c.Header("Retry-After", strconv.Itoa(int(math.Ceil(wait.Seconds()))))
+	c.AbortWithStatusJSON(http.StatusTooManyRequests, gin.H{"error": msg})
+}
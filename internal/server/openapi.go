@@ -0,0 +1,465 @@
+package server
+
+import (
+	"encoding/json"
+	"net/http"
+	"reflect"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"oasisdb/internal/consensus"
+	DB "oasisdb/internal/db"
+	"oasisdb/internal/replication"
+
+	"github.com/gin-gonic/gin"
+)
+
+// OpenAPIPath serves the OpenAPI 3 specification of the /v1 routes
+const OpenAPIPath = "/v1/openapi.json"
+
+// apiOperation documents a route for the OpenAPI specification, every /v1
+// route registered in setupRoutes must be listed in apiOperations
+type apiOperation struct {
+	Method   string
+	Path     string // gin path, :name parameters become {name}
+	ID       string // operationId, names the method of generated clients
+	Summary  string
+	Tag      string
+	Query    []apiParam
+	Request  any  // JSON body, nil if the route takes none
+	Binary   bool // the body may use the binary layout, see binaryContentType
+	Response any  // JSON body of the success response, nil if it has none
+	Stream   bool // the response is newline delimited JSON, one Response per line
+	Status   int  // success status, defaults to 200
+}
+
+// apiParam is a query parameter of an operation
+type apiParam struct {
+	Name        string
+	Type        string // JSON schema type
+	Description string
+}
+
+var (
+	dryRunParams = []apiParam{
+		{"dry_run", "boolean", "only report the documents the batch would reject"},
+		{"skip_embedding", "boolean", "don't generate embeddings in a dry run"},
+	}
+	debugParams = []apiParam{
+		{"debug", "boolean", "add the cache and timing breakdown of the search to the response"},
+	}
+	documentFields = struct {
+		ID         string         `json:"id"`
+		Vector     []float32      `json:"vector"`
+		Parameters map[string]any `json:"parameters"`
+		Dimension  int            `json:"dimension"`
+	}{}
+)
+
+var apiOperations = []apiOperation{
+	{Method: "GET", Path: "/v1/metrics", ID: "getMetrics", Tag: "server", Summary: "Every recorded metric with its mean",
+		Response: struct {
+			Metrics map[string]MetricResponse `json:"metrics"`
+		}{}},
+	{Method: "GET", Path: "/v1/stats", ID: "getStats", Tag: "server", Summary: "Heap and estimated index memory of the server",
+		Response: StatsResponse{}},
+	{Method: "GET", Path: OpenAPIPath, ID: "getOpenAPI", Tag: "server", Summary: "This specification",
+		Response: map[string]any{}},
+	{Method: "GET", Path: replication.StreamPath, ID: "streamReplication", Tag: "replication", Summary: "Writes recorded by the leader for its followers",
+		Query: []apiParam{
+			{"from", "integer", "seq of the first entry, defaults to 1"},
+			{"limit", "integer", "max entries, defaults to 1000"},
+			{"wait_ms", "integer", "long poll for new entries"},
+			{"follower", "string", "name of the follower, defaults to its IP"},
+			{"epoch", "string", "epoch of the log the follower replicated so far"},
+		},
+		Response: replication.Batch{}},
+	{Method: "GET", Path: "/v1/replication/status", ID: "getReplicationStatus", Tag: "replication", Summary: "Role of the server and the replication lag",
+		Response: struct {
+			Role     string                      `json:"role"` // leader or follower
+			Leader   *replication.LeaderStatus   `json:"leader,omitempty"`
+			Follower *replication.FollowerStatus `json:"follower,omitempty"`
+		}{}},
+	{Method: "GET", Path: "/v1/consensus/status", ID: "getConsensusStatus", Tag: "replication", Summary: "Raft state of the node",
+		Response: consensus.Status{}},
+	{Method: "POST", Path: "/v1/admin/warmup", ID: "warmup", Tag: "admin", Summary: "Load indices and storage after a restart",
+		Request: WarmupRequest{},
+		Response: struct {
+			SSTFiles    int                   `json:"sst_files"`
+			SSTBytes    int64                 `json:"sst_bytes"`
+			Collections []DB.CollectionWarmup `json:"collections"`
+			DurationMs  int64                 `json:"duration_ms"`
+		}{}},
+	{Method: "POST", Path: "/v1/admin/compact", ID: "compact", Tag: "admin", Summary: "Queue a compaction of the scalar storage",
+		Query: []apiParam{{"level", "integer", "level compacted into the next one, all levels if omitted"}},
+		Response: struct {
+			Message string `json:"message"`
+		}{}, Status: http.StatusAccepted},
+	{Method: "POST", Path: "/v1/admin/reload", ID: "reloadConfig", Tag: "admin", Summary: "Apply the reloadable settings of the config file",
+		Response: struct {
+			Changed []string `json:"changed"`
+		}{}},
+	{Method: "GET", Path: "/v1/admin/compaction/status", ID: "getCompactionStatus", Tag: "admin", Summary: "Storage levels, compactions and write stalls",
+		Response: CompactionStatusResponse{}},
+	{Method: "GET", Path: "/v1/admin/watch/status", ID: "getWatchStatus", Tag: "admin", Summary: "Files ingested from the watch directory",
+		Response: DB.WatchStatus{}},
+
+	{Method: "POST", Path: "/v1/collections", ID: "createCollection", Tag: "collections", Summary: "Create a collection",
+		Request: CreateCollectionRequest{}, Response: map[string]any{}},
+	{Method: "GET", Path: "/v1/collections", ID: "listCollections", Tag: "collections", Summary: "List the collections of the tenant",
+		Response: ListCollectionsResponse{}},
+	{Method: "GET", Path: "/v1/collections/:name", ID: "getCollection", Tag: "collections", Summary: "Get a collection with its index and counters",
+		Response: GetCollectionResponse{}},
+	{Method: "DELETE", Path: "/v1/collections/:name", ID: "deleteCollection", Tag: "collections", Summary: "Move a collection to the trash"},
+	{Method: "POST", Path: "/v1/collections/:name/restore", ID: "restoreCollection", Tag: "collections", Summary: "Bring back a deleted collection",
+		Response: struct {
+			Name      string `json:"name"`
+			Dimension uint32 `json:"dimension"`
+		}{}},
+	{Method: "GET", Path: "/v1/trash", ID: "listTrash", Tag: "collections", Summary: "Deleted collections that can still be restored",
+		Response: struct {
+			Collections []DB.TrashedCollection `json:"collections"`
+			Count       int                    `json:"count"`
+		}{}},
+	{Method: "GET", Path: "/v1/jobs", ID: "listJobs", Tag: "collections", Summary: "Running and recently finished index builds with their progress",
+		Query:    []apiParam{{"collection", "string", "only the builds of this collection"}},
+		Response: ListJobsResponse{}},
+	{Method: "POST", Path: "/v1/collections/:name/buildindex", ID: "buildIndex", Tag: "collections", Summary: "Build the index of a collection offline",
+		Query: dryRunParams, Request: BatchUpsertRequest{}, Binary: true, Response: BatchValidationResponse{}},
+	{Method: "POST", Path: "/v1/collections/:name/rebuild", ID: "rebuildIndex", Tag: "collections", Summary: "Rebuild the index from the stored vectors",
+		Response: struct {
+			Count int `json:"count"`
+		}{}},
+	{Method: "POST", Path: "/v1/collections/:name/clone", ID: "cloneCollection", Tag: "collections", Summary: "Copy a collection into a new one",
+		Request: CloneRequest{},
+		Response: struct {
+			Name      string            `json:"name"`
+			IndexType string            `json:"index_type"`
+			Metadata  map[string]string `json:"metadata"`
+			Count     int               `json:"count"`
+		}{}},
+	{Method: "POST", Path: "/v1/collections/:name/reindex", ID: "reindex", Tag: "collections", Summary: "Rebuild the index in the background with new settings",
+		Request: ReindexRequest{}, Response: DB.ReindexStatus{}, Status: http.StatusAccepted},
+	{Method: "GET", Path: "/v1/collections/:name/reindex", ID: "getReindexStatus", Tag: "collections", Summary: "Status of the last reindex",
+		Response: DB.ReindexStatus{}},
+	{Method: "POST", Path: "/v1/collections/:name/vacuum", ID: "vacuum", Tag: "collections", Summary: "Purge deleted elements from the index",
+		Response: struct {
+			Purged int `json:"purged"`
+		}{}},
+	{Method: "GET", Path: "/v1/collections/:name/clusters", ID: "listClusters", Tag: "collections", Summary: "Index clusters with counts and sample IDs",
+		Query: []apiParam{{"samples", "integer", "sample IDs per cluster"}},
+		Response: struct {
+			Clusters []ClusterResponse `json:"clusters"`
+			Count    int               `json:"count"`
+		}{}},
+	{Method: "GET", Path: "/v1/collections/:name/usage", ID: "getCollectionUsage", Tag: "collections", Summary: "Disk and memory used by a collection",
+		Response: struct {
+			Name             string `json:"name"`
+			StorageBytes     int64  `json:"storage_bytes"`
+			IndexFileBytes   int64  `json:"index_file_bytes"`
+			WALBytes         int64  `json:"wal_bytes"`
+			DiskBytes        int64  `json:"disk_bytes"`
+			IndexMemoryBytes int64  `json:"index_memory_bytes"`
+		}{}},
+
+	{Method: "POST", Path: "/v1/collections/:name/documents", ID: "upsertDocument", Tag: "documents", Summary: "Insert or update a document",
+		Request: UpsertDocumentRequest{}, Response: map[string]any{}},
+	{Method: "POST", Path: "/v1/collections/:name/documents/setparams", ID: "setParams", Tag: "documents", Summary: "Adjust index and search parameters",
+		Request: SetParamsRequest{}},
+	{Method: "GET", Path: "/v1/collections/:name/documents/:id", ID: "getDocument", Tag: "documents", Summary: "Get a document",
+		Response: documentFields},
+	{Method: "DELETE", Path: "/v1/collections/:name/documents/:id", ID: "deleteDocument", Tag: "documents", Summary: "Delete a document"},
+	{Method: "POST", Path: "/v1/collections/:name/documents/batchupsert", ID: "batchUpsertDocuments", Tag: "documents", Summary: "Insert or update documents",
+		Query: dryRunParams, Request: BatchUpsertRequest{}, Binary: true, Response: BatchValidationResponse{}},
+	{Method: "POST", Path: "/v1/collections/:name/documents/ingest", ID: "ingestDocument", Tag: "documents", Summary: "Chunk, embed and upsert a long text",
+		Request: IngestDocumentRequest{},
+		Response: struct {
+			IDs   []string `json:"ids"`
+			Count int      `json:"count"`
+		}{}},
+	{Method: "POST", Path: "/v1/collections/:name/documents/:id/restore", ID: "restoreDocument", Tag: "documents", Summary: "Move an archived document back into the index"},
+	{Method: "POST", Path: "/v1/collections/:name/archive", ID: "archiveDocuments", Tag: "documents", Summary: "Move documents unread for a while out of the index",
+		Request: ArchiveRequest{},
+		Response: struct {
+			Archived []string `json:"archived"`
+			Count    int      `json:"count"`
+		}{}},
+	{Method: "POST", Path: "/v1/collections/:name/scroll", ID: "scrollDocuments", Tag: "documents", Summary: "Page through the documents matching a filter",
+		Request: ScrollRequest{},
+		Response: struct {
+			Documents []DB.Document `json:"documents"`
+			Count     int           `json:"count"`
+			Cursor    string        `json:"cursor"`
+			Seq       uint64        `json:"seq,omitempty"`
+		}{}},
+	{Method: "GET", Path: "/v1/collections/:name/export", ID: "exportCollection", Tag: "documents", Summary: "Stream the documents matching a filter as newline delimited JSON",
+		Query: []apiParam{
+			{"filter", "string", "JSON filter of the documents exported"},
+			{"cursor", "string", "ID of the last document received, resumes a broken export"},
+		},
+		Response: ExportDocument{}, Stream: true},
+	{Method: "GET", Path: "/v1/collections/:name/ids", ID: "listDocumentIDs", Tag: "documents", Summary: "Page through the document IDs of a collection",
+		Query: []apiParam{
+			{"limit", "integer", "IDs per page, at most 10000"},
+			{"cursor", "string", "cursor of the previous page, the last ID it returned"},
+		},
+		Response: struct {
+			IDs    []string `json:"ids"`
+			Count  int      `json:"count"`
+			Cursor string   `json:"cursor"`
+		}{}},
+
+	{Method: "POST", Path: "/v1/collections/:name/vectors/search", ID: "searchVectors", Tag: "search", Summary: "Nearest neighbors of a vector",
+		Query: debugParams, Request: SearchVectorRequest{}, Binary: true,
+		Response: struct {
+			IDs             []string     `json:"ids"`
+			Distances       []float32    `json:"distances"`
+			TotalCandidates int          `json:"total_candidates"`
+			Debug           *SearchDebug `json:"debug,omitempty"`
+		}{}},
+	{Method: "POST", Path: "/v1/collections/:name/documents/search", ID: "searchDocuments", Tag: "search", Summary: "Documents nearest to a vector or query text",
+		Query: debugParams, Request: SearchDocumentRequest{}, Binary: true,
+		Response: struct {
+			Documents []struct {
+				ID          string         `json:"id"`
+				Vector      []float32      `json:"vector"`
+				Parameters  map[string]any `json:"parameters"`
+				Dimension   int            `json:"dimension"`
+				Distance    float32        `json:"distance"`
+				RerankScore *float64       `json:"rerank_score,omitempty"`
+			} `json:"documents"`
+			Distances       []float32    `json:"distances"`
+			TotalCandidates int          `json:"total_candidates"`
+			Debug           *SearchDebug `json:"debug,omitempty"`
+		}{}},
+	{Method: "POST", Path: "/v1/search/multi", ID: "searchMulti", Tag: "search", Summary: "Search several collections and merge the results",
+		Request: MultiSearchRequest{},
+		Response: struct {
+			Results []MultiSearchResult `json:"results"`
+		}{}},
+}
+
+// openAPISpec is the specification of apiOperations, built once
+var openAPISpec = sync.OnceValues(func() ([]byte, error) {
+	return json.Marshal(buildOpenAPISpec(apiOperations))
+})
+
+func (s *Server) handleOpenAPI() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		spec, err := openAPISpec()
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+		c.Data(http.StatusOK, "application/json", spec)
+	}
+}
+
+// buildOpenAPISpec documents operations, the schemas of their bodies are
+// derived from the JSON encoding of their Go types
+func buildOpenAPISpec(operations []apiOperation) map[string]any {
+	b := newSchemaBuilder()
+	errorSchema := b.schema(reflect.TypeOf(ErrorResponse{}))
+	paths := make(map[string]map[string]any)
+	for _, op := range operations {
+		path, params := openAPIPath(op.Path)
+		parameters := []any{map[string]any{"$ref": "#/components/parameters/Tenant"}}
+		for _, name := range params {
+			parameters = append(parameters, map[string]any{
+				"name": name, "in": "path", "required": true, "schema": map[string]any{"type": "string"},
+			})
+		}
+		for _, p := range op.Query {
+			parameters = append(parameters, map[string]any{
+				"name": p.Name, "in": "query", "description": p.Description, "schema": map[string]any{"type": p.Type},
+			})
+		}
+
+		status := op.Status
+		if status == 0 {
+			status = http.StatusOK
+		}
+		success := map[string]any{"description": http.StatusText(status)}
+		if op.Response != nil {
+			contentType := "application/json"
+			if op.Stream {
+				contentType = ndjsonContentType
+			}
+			success["content"] = map[string]any{contentType: map[string]any{"schema": b.schema(reflect.TypeOf(op.Response))}}
+		}
+		operation := map[string]any{
+			"operationId": op.ID,
+			"summary":     op.Summary,
+			"tags":        []string{op.Tag},
+			"parameters":  parameters,
+			"responses": map[string]any{
+				strconv.Itoa(status): success,
+				"default": map[string]any{
+					"description": "Error",
+					"content":     map[string]any{"application/json": map[string]any{"schema": errorSchema}},
+				},
+			},
+		}
+		if op.Request != nil {
+			content := map[string]any{"application/json": map[string]any{"schema": b.schema(reflect.TypeOf(op.Request))}}
+			if op.Binary {
+				content[binaryContentType] = map[string]any{
+					"schema": map[string]any{"type": "string", "format": "binary"},
+				}
+			}
+			operation["requestBody"] = map[string]any{"content": content}
+		}
+		if paths[path] == nil {
+			paths[path] = make(map[string]any)
+		}
+		paths[path][strings.ToLower(op.Method)] = operation
+	}
+
+	return map[string]any{
+		"openapi": "3.0.3",
+		"info": map[string]any{
+			"title":   "OasisDB API",
+			"version": "1",
+		},
+		"paths": paths,
+		"components": map[string]any{
+			"schemas": b.schemas,
+			"parameters": map[string]any{
+				"Tenant": map[string]any{
+					"name": TenantHeader, "in": "header", "description": "tenant the request operates on, the default tenant if omitted",
+					"schema": map[string]any{"type": "string"},
+				},
+			},
+		},
+	}
+}
+
+// openAPIPath converts a gin path to an OpenAPI path and its parameters
+func openAPIPath(path string) (string, []string) {
+	segments := strings.Split(path, "/")
+	var params []string
+	for i, segment := range segments {
+		if name, ok := strings.CutPrefix(segment, ":"); ok {
+			segments[i] = "{" + name + "}"
+			params = append(params, name)
+		}
+	}
+	return strings.Join(segments, "/"), params
+}
+
+// schemaOverrides are the types whose JSON encoding differs from their Go
+// type
+var schemaOverrides = map[reflect.Type]map[string]any{
+	reflect.TypeOf(time.Time{}):       {"type": "string", "format": "date-time"},
+	reflect.TypeOf(json.RawMessage{}): {},
+	reflect.TypeOf(time.Duration(0)):  {"type": "integer", "format": "int64", "description": "nanoseconds"},
+	reflect.TypeOf(IndexParameters{}): {
+		"type": "object",
+		"additionalProperties": map[string]any{
+			"oneOf": []any{map[string]any{"type": "string"}, map[string]any{"type": "number"}, map[string]any{"type": "boolean"}},
+		},
+	},
+}
+
+// schemaBuilder derives JSON schemas from Go types, named structs become
+// components referenced by name
+type schemaBuilder struct {
+	schemas map[string]any
+	names   map[reflect.Type]string
+}
+
+func newSchemaBuilder() *schemaBuilder {
+	return &schemaBuilder{schemas: make(map[string]any), names: make(map[reflect.Type]string)}
+}
+
+func (b *schemaBuilder) schema(t reflect.Type) map[string]any {
+	if s, ok := schemaOverrides[t]; ok {
+		return s
+	}
+	switch t.Kind() {
+	case reflect.Pointer:
+		return b.schema(t.Elem())
+	case reflect.Bool:
+		return map[string]any{"type": "boolean"}
+	case reflect.Int64, reflect.Uint64:
+		return map[string]any{"type": "integer", "format": "int64"}
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32:
+		return map[string]any{"type": "integer"}
+	case reflect.Float32:
+		return map[string]any{"type": "number", "format": "float"}
+	case reflect.Float64:
+		return map[string]any{"type": "number", "format": "double"}
+	case reflect.String:
+		return map[string]any{"type": "string"}
+	case reflect.Slice, reflect.Array:
+		if t.Elem().Kind() == reflect.Uint8 {
+			return map[string]any{"type": "string", "format": "byte"}
+		}
+		return map[string]any{"type": "array", "items": b.schema(t.Elem())}
+	case reflect.Map:
+		return map[string]any{"type": "object", "additionalProperties": b.schema(t.Elem())}
+	case reflect.Struct:
+		if t.Name() == "" {
+			return b.object(t)
+		}
+		name, ok := b.names[t]
+		if !ok {
+			name = b.componentName(t)
+			b.names[t] = name
+			b.schemas[name] = map[string]any{} // placeholder for recursive types
+			b.schemas[name] = b.object(t)
+		}
+		return map[string]any{"$ref": "#/components/schemas/" + name}
+	}
+	return map[string]any{} // any JSON value
+}
+
+// componentName names a struct after its type, prefixed with its package if
+// another package has a type of that name
+func (b *schemaBuilder) componentName(t reflect.Type) string {
+	name := t.Name()
+	if _, taken := b.schemas[name]; taken {
+		pkg := t.PkgPath()[strings.LastIndex(t.PkgPath(), "/")+1:]
+		name = strings.ToUpper(pkg[:1]) + pkg[1:] + name
+	}
+	return name
+}
+
+// object is the schema of the JSON object encoding a struct, fields required
+// by binding tags are required
+func (b *schemaBuilder) object(t reflect.Type) map[string]any {
+	properties := make(map[string]any)
+	var required []string
+	b.fields(t, properties, &required)
+	schema := map[string]any{"type": "object", "properties": properties}
+	if len(required) > 0 {
+		schema["required"] = required
+	}
+	return schema
+}
+
+func (b *schemaBuilder) fields(t reflect.Type, properties map[string]any, required *[]string) {
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+		tag := field.Tag.Get("json")
+		if tag == "-" || (!field.IsExported() && !field.Anonymous) {
+			continue
+		}
+		name, _, _ := strings.Cut(tag, ",")
+		if field.Anonymous && name == "" && field.Type.Kind() == reflect.Struct {
+			b.fields(field.Type, properties, required) // promoted like encoding/json does
+			continue
+		}
+		if name == "" {
+			name = field.Name
+		}
+		properties[name] = b.schema(field.Type)
+		// required_without and the like depend on other fields
+		if slices.Contains(strings.Split(field.Tag.Get("binding"), ","), "required") {
+			*required = append(*required, name)
+		}
+	}
+}
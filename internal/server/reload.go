@@ -0,0 +1,56 @@
+package server
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+
+	"oasisdb/internal/config"
+	pkgerrors "oasisdb/pkg/errors"
+
+	"github.com/gin-gonic/gin"
+)
+
+// SetConfigFile sets the config file ReloadConfig reads, reloading is
+// disabled without one
+func (s *Server) SetConfigFile(path string) {
+	s.configFile = path
+}
+
+// ReloadConfig reads the config file again and applies the settings that can
+// change while running, see config.Reloadable. It returns the changed keys,
+// a config changing any other key is rejected as a whole
+func (s *Server) ReloadConfig() ([]string, error) {
+	if s.configFile == "" {
+		return nil, errors.New("no config file to reload")
+	}
+	next, err := config.FromFile(s.configFile)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", pkgerrors.ErrInvalidParameter, err)
+	}
+	changed, err := s.db.ApplyConfig(next)
+	if err != nil {
+		return nil, err
+	}
+	s.limiter.set(next.Server.RateLimit, next.Server.RateLimitBurst)
+	return changed, nil
+}
+
+// handleReloadConfig reloads the config file like SIGHUP does
+func (s *Server) handleReloadConfig() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		changed, err := s.ReloadConfig()
+		if errors.Is(err, pkgerrors.ErrInvalidParameter) {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+		if changed == nil {
+			changed = []string{}
+		}
+		c.JSON(http.StatusOK, gin.H{"changed": changed})
+	}
+}
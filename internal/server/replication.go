@@ -0,0 +1,86 @@
+package server
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+	"time"
+
+	"oasisdb/internal/replication"
+
+	"github.com/gin-gonic/gin"
+)
+
+const (
+	maxStreamLimit = 10000
+	maxStreamWait  = 30 * time.Second
+)
+
+// readOnly rejects writes on a follower, they must be sent to its leader
+func (s *Server) readOnly() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if !s.db.IsFollower() {
+			return
+		}
+		c.AbortWithStatusJSON(http.StatusForbidden, gin.H{
+			"error":  "this server is a read-only follower, send writes to the leader",
+			"leader": s.db.Config().Replication.Leader,
+		})
+	}
+}
+
+// handleReplicationStream returns the writes of the leader from a seq on,
+// waiting for one when the follower is up to date
+func (s *Server) handleReplicationStream() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		log := s.db.ReplicationLog()
+		if log == nil {
+			c.JSON(http.StatusNotFound, gin.H{"error": "this server doesn't serve followers"})
+			return
+		}
+		from, err := strconv.ParseUint(c.DefaultQuery("from", "1"), 10, 64)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "invalid from: " + err.Error()})
+			return
+		}
+		limit, err := strconv.Atoi(c.DefaultQuery("limit", "1000"))
+		if err != nil || limit <= 0 {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "limit must be a positive integer"})
+			return
+		}
+		waitMs, err := strconv.Atoi(c.DefaultQuery("wait_ms", "0"))
+		if err != nil || waitMs < 0 {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "wait_ms must be a non-negative integer"})
+			return
+		}
+		wait := min(time.Duration(waitMs)*time.Millisecond, maxStreamWait)
+		follower := c.DefaultQuery("follower", c.ClientIP())
+
+		batch, err := log.Read(c.Request.Context(), follower, c.Query("epoch"), from, min(limit, maxStreamLimit), wait)
+		if errors.Is(err, replication.ErrResync) {
+			c.JSON(http.StatusGone, gin.H{"error": err.Error(), "epoch": log.Epoch()})
+			return
+		}
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+		c.JSON(http.StatusOK, batch)
+	}
+}
+
+// handleReplicationStatus reports the role of the server and the lag of its
+// followers, or of itself on a follower
+func (s *Server) handleReplicationStatus() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if follower := s.db.Follower(); follower != nil {
+			c.JSON(http.StatusOK, gin.H{"role": "follower", "follower": follower.Status()})
+			return
+		}
+		response := gin.H{"role": "leader"}
+		if log := s.db.ReplicationLog(); log != nil {
+			response["leader"] = log.Status()
+		}
+		c.JSON(http.StatusOK, response)
+	}
+}
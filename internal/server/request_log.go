@@ -0,0 +1,62 @@
+package server
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"regexp"
+	"time"
+
+	"oasisdb/pkg/logger"
+
+	"github.com/gin-gonic/gin"
+)
+
+// RequestIDHeader carries the request ID, a valid ID sent by the client is
+// kept so calls can be traced across services, it is echoed in the response
+const RequestIDHeader = "X-Request-ID"
+
+var requestIDPattern = regexp.MustCompile(`^[A-Za-z0-9._-]{1,64}$`)
+
+func newRequestID() string {
+	b := make([]byte, 8)
+	rand.Read(b)
+	return hex.EncodeToString(b)
+}
+
+// requestLogger assigns every request an ID, passes it to the db layer in
+// the request context and logs the request once it is served
+func requestLogger() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		start := time.Now()
+		id := c.GetHeader(RequestIDHeader)
+		if !requestIDPattern.MatchString(id) {
+			id = newRequestID()
+		}
+		c.Header(RequestIDHeader, id)
+		c.Request = c.Request.WithContext(logger.WithRequestID(c.Request.Context(), id))
+
+		c.Next()
+
+		route := c.FullPath()
+		if route == "" {
+			route = "unmatched"
+		}
+		fields := []interface{}{
+			"method", c.Request.Method,
+			"route", route,
+			"path", c.Request.URL.Path,
+			"status", c.Writer.Status(),
+			"duration", time.Since(start),
+			"client_ip", c.ClientIP(),
+		}
+		log := logger.Ctx(c.Request.Context())
+		switch {
+		case c.Writer.Status() >= 500:
+			log.Errorw("Request failed", fields...)
+		case len(c.Errors) > 0:
+			log.Warnw("Request completed with errors", append(fields, "errors", c.Errors.String())...)
+		default:
+			log.Infow("Request completed", fields...)
+		}
+	}
+}
@@ -1,7 +1,12 @@
 package server
 
 import (
+	"net/http"
+
+	"oasisdb/internal/audit"
+	"oasisdb/internal/consensus"
 	DB "oasisdb/internal/db"
+	"oasisdb/internal/replication"
 
 	"github.com/gin-gonic/gin"
 )
@@ -9,31 +14,102 @@ import (
 type Server struct {
 	router *gin.Engine
 	db     *DB.DB
+	node   *consensus.Node // raft node committing writes, nil unless raft is enabled
+
+	limiter    *clientLimiter            // rate limit of every client, changed by ReloadConfig
+	configFile string                    // read by ReloadConfig, see SetConfigFile
+	audit      *audit.Log                // records destructive operations, nil unless enabled
+	keyFilters map[string]map[string]any // filters of the API keys, see requestScope
 }
 
 // New creates a new server instance
 func New(db *DB.DB) *Server {
 	s := &Server{
 		db:     db,
-		router: gin.Default(),
+		router: gin.New(),
 	}
+	s.router.Use(requestLogger(), traceRequest(), gin.Recovery())
+	setupValidation()
 	s.setupRoutes()
 	return s
 }
 
+// Handler returns the HTTP handler serving the API, for mounting the server
+// in tests or an existing http.Server
+func (s *Server) Handler() http.Handler {
+	return s.router
+}
+
 func (s *Server) setupRoutes() {
+	conf := s.db.Config().Server
+	s.limiter = newClientLimiter(conf.RateLimit, conf.RateLimitBurst)
+	s.keyFilters = apiKeyFilters(conf.APIKeys)
+	s.router.Use(rateLimit(s.limiter), limitBody(conf.MaxBodyBytes))
+	// searches and index builds share one cap on concurrent requests, they
+	// and batch writes are shed while the heap is over the watermark
+	inflight, shed := limitInflight(conf.MaxInflight), shedLoad(conf.MaxHeapBytes)
+	heavy := func(c *gin.Context) {
+		if shed(c); !c.IsAborted() {
+			inflight(c)
+		}
+	}
+
+	// followers replicate every write from their leader, raft nodes commit
+	// writes through the raft log
+	readOnly, commit := s.readOnly(), s.commit()
+	write := func(c *gin.Context) {
+		if readOnly(c); !c.IsAborted() {
+			commit(c)
+		}
+	}
+	// document writes are rejected before entering the log while the
+	// scalar storage waits for compaction to catch up
+	stalled := s.stallWrites()
+
+	// liveness only needs the process to answer, readiness checks the database
 	s.router.GET("/", s.handleHealthCheck())
+	s.router.GET("/healthz", s.handleHealthCheck())
+	s.router.GET("/readyz", s.handleReadiness())
+	s.router.StaticFS("/ui", uiFS())
+	s.router.GET("/v1/metrics", s.handleMetrics())
+	s.router.GET("/v1/stats", s.handleStats())
+	s.router.GET(OpenAPIPath, s.handleOpenAPI())
+	s.router.GET(replication.StreamPath, s.handleReplicationStream())
+	s.router.GET("/v1/replication/status", s.handleReplicationStatus())
+	s.router.GET("/v1/consensus/status", s.handleConsensusStatus())
+	s.router.POST("/v1/admin/warmup", heavy, s.handleWarmup())
+	s.router.POST("/v1/admin/compact", s.handleCompact())
+	s.router.POST("/v1/admin/reload", s.handleReloadConfig())
+	s.router.GET("/v1/admin/compaction/status", s.handleCompactionStatus())
+	s.router.GET("/v1/admin/watch/status", s.handleWatchStatus())
 	s.router.GET("/v1/collections/:name", s.handleGetCollection())
-	s.router.DELETE("/v1/collections/:name", s.handleDeleteCollection())
-	s.router.POST("/v1/collections/:name/buildindex", s.handleBuildIndex())
-	s.router.POST("/v1/collections", s.handleCreateCollection())
+	s.router.DELETE("/v1/collections/:name", s.audited("delete_collection"), write, s.handleDeleteCollection())
+	s.router.POST("/v1/collections/:name/restore", write, s.handleRestoreCollection())
+	s.router.GET("/v1/trash", s.handleListTrash())
+	s.router.GET("/v1/jobs", s.handleListJobs())
+	s.router.POST("/v1/collections/:name/buildindex", write, heavy, s.handleBuildIndex())
+	s.router.POST("/v1/collections/:name/rebuild", write, heavy, s.handleRebuildIndex())
+	s.router.POST("/v1/collections/:name/clone", write, heavy, s.handleCloneCollection())
+	s.router.POST("/v1/collections/:name/reindex", write, s.handleReindex())
+	s.router.GET("/v1/collections/:name/reindex", s.handleReindexStatus())
+	s.router.POST("/v1/collections/:name/vacuum", write, heavy, s.handleVacuum())
+	s.router.GET("/v1/collections/:name/clusters", s.handleListClusters())
+	s.router.GET("/v1/collections/:name/usage", s.handleCollectionUsage())
+	s.router.POST("/v1/collections", write, s.handleCreateCollection())
 	s.router.GET("/v1/collections", s.handleListCollections())
 
-	s.router.POST("/v1/collections/:name/documents", s.handleUpsertDocument())
-	s.router.POST("/v1/collections/:name/documents/setparams", s.handleSetParams())
+	s.router.POST("/v1/collections/:name/documents", stalled, write, s.handleUpsertDocument())
+	s.router.POST("/v1/collections/:name/documents/setparams", s.audited("set_params"), write, s.handleSetParams())
 	s.router.GET("/v1/collections/:name/documents/:id", s.handleGetDocument())
-	s.router.DELETE("/v1/collections/:name/documents/:id", s.handleDeleteDocument())
-	s.router.POST("/v1/collections/:name/vectors/search", s.handleSearchVectors())
-	s.router.POST("/v1/collections/:name/documents/search", s.handleSearchDocuments())
-	s.router.POST("/v1/collections/:name/documents/batchupsert", s.handleBatchUpsertDocuments())
+	s.router.DELETE("/v1/collections/:name/documents/:id", s.audited("delete_document"), write, s.handleDeleteDocument())
+	s.router.POST("/v1/collections/:name/vectors/search", heavy, s.handleSearchVectors())
+	s.router.POST("/v1/collections/:name/documents/search", heavy, s.handleSearchDocuments())
+	s.router.POST("/v1/search/multi", heavy, s.handleMultiSearch())
+	s.router.POST("/v1/collections/:name/documents/batchupsert", stalled, write, shed, s.handleBatchUpsertDocuments())
+	s.router.POST("/v1/collections/:name/documents/ingest", stalled, write, shed, s.handleIngestDocument())
+	s.router.POST("/v1/collections/:name/documents/:id/restore", write, s.handleRestoreDocument())
+	s.router.POST("/v1/collections/:name/archive", s.audited("archive_documents"), write, s.handleArchiveDocuments())
+	s.router.POST("/v1/collections/:name/scroll", s.handleScrollDocuments())
+	s.router.GET("/v1/collections/:name/export", s.handleExportCollection())
+	s.router.GET("/v1/collections/:name/ids", s.handleListDocumentIDs())
 }
@@ -0,0 +1,74 @@
+package server
+
+import (
+	"fmt"
+	"net/http"
+	"regexp"
+	"strings"
+
+	pkgerrors "oasisdb/pkg/errors"
+
+	"github.com/gin-gonic/gin"
+)
+
+// TenantHeader selects the tenant a request operates on, requests without it
+// use the default tenant
+const TenantHeader = "X-Tenant"
+
+// tenantSeparator joins a tenant and a collection name into the name the
+// collection is stored and indexed under, e.g. "acme:docs"
+const tenantSeparator = ":"
+
+var tenantPattern = regexp.MustCompile(`^[A-Za-z0-9_-]{1,64}$`)
+
+// qualifiedName returns the storage name of a tenant's collection, the
+// default tenant's collections keep their plain names
+func qualifiedName(tenant, name string) string {
+	if tenant == "" {
+		return name
+	}
+	return tenant + tenantSeparator + name
+}
+
+// tenantCollections returns the collections of a tenant with the tenant
+// prefix removed from the given storage names
+func tenantCollections(tenant string, names []string) []string {
+	prefix := qualifiedName(tenant, "")
+	collections := make([]string, 0, len(names))
+	for _, name := range names {
+		if tenant == "" {
+			if !strings.Contains(name, tenantSeparator) {
+				collections = append(collections, name)
+			}
+			continue
+		}
+		if strings.HasPrefix(name, prefix) {
+			collections = append(collections, strings.TrimPrefix(name, prefix))
+		}
+	}
+	return collections
+}
+
+// resolveCollection returns the storage name of a collection of the request
+// tenant, it responds with 400 and returns false if the tenant or the name is
+// invalid
+func resolveCollection(c *gin.Context, name string) (string, bool) {
+	tenant, err := requestTenant(c)
+	if err == nil && strings.Contains(name, tenantSeparator) {
+		err = fmt.Errorf("%w: collection name must not contain %q", pkgerrors.ErrInvalidParameter, tenantSeparator)
+	}
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return "", false
+	}
+	return qualifiedName(tenant, name), true
+}
+
+// requestTenant returns the tenant named by the request header
+func requestTenant(c *gin.Context) (string, error) {
+	tenant := c.GetHeader(TenantHeader)
+	if tenant != "" && !tenantPattern.MatchString(tenant) {
+		return "", fmt.Errorf("%w: invalid tenant %q", pkgerrors.ErrInvalidParameter, tenant)
+	}
+	return tenant, nil
+}
@@ -1,29 +1,131 @@
 package server
 
-import DB "oasisdb/internal/db"
+import (
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"time"
+
+	"oasisdb/internal/chunk"
+	DB "oasisdb/internal/db"
+	"oasisdb/internal/index"
+	"oasisdb/internal/metrics"
+)
 
 // CreateCollectionRequest represents the request body for creating a collection
 type CreateCollectionRequest struct {
-	Name       string            `json:"name"`
-	Dimension  uint32            `json:"dimension"`
-	IndexType  string            `json:"index_type"`
-	Parameters map[string]string `json:"parameters,omitempty"`
+	Name           string          `json:"name" binding:"required,collection_name"`
+	Dimension      uint32          `json:"dimension" binding:"required"`
+	IndexType      string          `json:"index_type"`
+	Parameters     IndexParameters `json:"parameters,omitempty"`
+	DefaultFilter  map[string]any  `json:"default_filter,omitempty"`                                  // enforced on every search and get
+	StoreVectors   bool            `json:"store_vectors,omitempty"`                                   // persist vectors in scalar storage too
+	Normalize      bool            `json:"normalize,omitempty"`                                       // L2-normalize vectors on upsert and search
+	Schema         *DB.Schema      `json:"schema,omitempty"`                                          // declared document parameters checked on upsert
+	Cache          *CacheRequest   `json:"cache,omitempty"`                                           // search cache overrides, unset fields use the config
+	DedupThreshold float32         `json:"dedup_threshold,omitempty" binding:"gte=0"`                 // upserts this close to a document are deduplicated
+	DedupMode      string          `json:"dedup_mode,omitempty" binding:"omitempty,oneof=skip merge"` // "skip" or "merge" them, defaults to "skip"
+}
+
+// CacheRequest overrides the search cache config for a collection
+type CacheRequest struct {
+	Enabled    *bool `json:"enabled,omitempty"`
+	MaxEntries int   `json:"max_entries,omitempty"` // max cached results
+	TTLSeconds int   `json:"ttl_seconds,omitempty"` // lifetime of cached results
+}
+
+func (r *CacheRequest) settings() *DB.CacheSettings {
+	if r == nil {
+		return nil
+	}
+	return &DB.CacheSettings{Enabled: r.Enabled, MaxEntries: r.MaxEntries, TTLSeconds: r.TTLSeconds}
+}
+
+// cacheResponse returns the cache overrides of a collection in request form
+func cacheResponse(s *DB.CacheSettings) *CacheRequest {
+	if s == nil {
+		return nil
+	}
+	return &CacheRequest{Enabled: s.Enabled, MaxEntries: s.MaxEntries, TTLSeconds: s.TTLSeconds}
+}
+
+// IndexParameters are index build parameters such as M or nlist, clients may
+// send them as JSON strings, numbers or booleans
+type IndexParameters map[string]string
+
+func (p *IndexParameters) UnmarshalJSON(data []byte) error {
+	var raw map[string]any
+	if err := json.Unmarshal(data, &raw); err != nil {
+		return err
+	}
+	*p = make(IndexParameters, len(raw))
+	for k, v := range raw {
+		switch v := v.(type) {
+		case string:
+			(*p)[k] = v
+		case float64:
+			(*p)[k] = strconv.FormatFloat(v, 'f', -1, 64)
+		case bool:
+			(*p)[k] = strconv.FormatBool(v)
+		default:
+			return fmt.Errorf("index parameter %q must be a string, number or boolean", k)
+		}
+	}
+	return nil
 }
 
 // GetCollectionResponse represents the response body for getting a collection
 type GetCollectionResponse struct {
-	Name      string `json:"name"`
-	Dimension uint32 `json:"dimension"`
+	Name      string                   `json:"name"`
+	Dimension uint32                   `json:"dimension"`
+	Index     *index.IndexStats        `json:"index,omitempty"`
+	Stats     *CollectionStatsResponse `json:"stats,omitempty"`
 }
 
 // ListCollectionsResponse represents the response body for listing collections
 type ListCollectionsResponse struct {
-	Collections []GetCollectionResponse `json:"collections"`
+	Collections []string                           `json:"collections"`
+	Count       int                                `json:"count"`
+	Stats       map[string]CollectionStatsResponse `json:"stats"` // collection name to its counters
+}
+
+// ListJobsResponse represents the response body for listing index builds
+type ListJobsResponse struct {
+	Jobs  []index.BuildJob `json:"jobs"` // in the order they started
+	Count int              `json:"count"`
+}
+
+// CollectionStatsResponse holds the counters of a collection
+type CollectionStatsResponse struct {
+	Documents int64      `json:"documents"` // archived documents included
+	Vectors   int64      `json:"vectors"`   // vectors in the index
+	Bytes     int64      `json:"bytes"`     // document metadata and stored vectors
+	CreatedAt *time.Time `json:"created_at,omitempty"`
+	UpdatedAt *time.Time `json:"updated_at,omitempty"` // last document write
+}
+
+func collectionStatsResponse(stats *DB.CollectionStats) CollectionStatsResponse {
+	response := CollectionStatsResponse{Documents: stats.Documents, Vectors: stats.Vectors, Bytes: stats.Bytes}
+	if !stats.CreatedAt.IsZero() {
+		response.CreatedAt = &stats.CreatedAt
+	}
+	if !stats.UpdatedAt.IsZero() {
+		response.UpdatedAt = &stats.UpdatedAt
+	}
+	return response
+}
+
+// ClusterResponse represents a single cluster of a collection's index
+type ClusterResponse struct {
+	ID        int       `json:"id"`
+	Centroid  []float32 `json:"centroid"`
+	Count     int       `json:"count"`
+	SampleIDs []string  `json:"sample_ids"`
 }
 
 // UpsertDocumentRequest represents the request body for upserting a document
 type UpsertDocumentRequest struct {
-	ID         string                 `json:"id"`
+	ID         string                 `json:"id" binding:"required"`
 	Vector     []float32              `json:"vector"`
 	Parameters map[string]interface{} `json:"parameters,omitempty"`
 }
@@ -39,6 +141,29 @@ type SearchResponse struct {
 	Results []SearchResult `json:"results"`
 }
 
+// SearchDebug reports how a search was answered, returned with ?debug=true.
+// Durations are in milliseconds
+type SearchDebug struct {
+	CacheHit bool    `json:"cache_hit"` // answered from the search cache
+	EmbedMs  float64 `json:"embed_ms"`  // embedding the query text
+	IndexMs  float64 `json:"index_ms"`  // searching the index
+	FetchMs  float64 `json:"fetch_ms"`  // reading documents for results and filters
+	TotalMs  float64 `json:"total_ms"`  // the whole request
+}
+
+func newSearchDebug(start time.Time, embed time.Duration, timings DB.SearchTimings) *SearchDebug {
+	return &SearchDebug{
+		EmbedMs: milliseconds(embed),
+		IndexMs: milliseconds(timings.Index),
+		FetchMs: milliseconds(timings.Fetch),
+		TotalMs: milliseconds(time.Since(start)),
+	}
+}
+
+func milliseconds(d time.Duration) float64 {
+	return float64(d.Microseconds()) / 1000
+}
+
 // SearchResult represents a single search result
 type SearchResult struct {
 	ID       string  `json:"id"`
@@ -47,23 +172,212 @@ type SearchResult struct {
 }
 
 type SearchDocumentRequest struct {
-	Vector []float32      `json:"vector"`
-	Limit  int            `json:"limit"`
-	Filter map[string]any `json:"filter"`
+	Vector      []float32      `json:"vector"`
+	QueryText   string         `json:"query_text,omitempty"` // embedded by the server instead of vector
+	Limit       int            `json:"limit" binding:"required_without=MaxDistance,gte=0,lte=10000"`
+	Filter      map[string]any `json:"filter"`
+	Rerank      *RerankRequest `json:"rerank,omitempty"`                 // optional rerank of the top-N candidates
+	MaxDistance *float32       `json:"max_distance,omitempty"`           // only results this close, limit 0 returns all of them
+	Offset      int            `json:"offset,omitempty" binding:"gte=0"` // results skipped for paging
+	Params      map[string]any `json:"params,omitempty"`                 // index search parameters of this query, e.g. efsearch or nprobe
+	RerankExact bool           `json:"rerank_exact,omitempty"`           // reorder over-fetched candidates by exact distance
+}
+
+// RerankRequest selects a reranker for document search, e.g.
+// {"type": "mmr", "lambda": 0.5} or {"type": "api", "model": "..."}
+type RerankRequest struct {
+	Type   string   `json:"type" binding:"required"`
+	Lambda *float64 `json:"lambda,omitempty"` // MMR relevance weight, defaults to 0.5
+	Model  string   `json:"model,omitempty"`  // API reranker model, defaults to the config
+	TopN   int      `json:"top_n,omitempty"`  // candidates to rerank, defaults to the config
 }
 
 type SetParamsRequest struct {
 	Parameters map[string]any `json:"parameters"`
 }
 type SearchVectorRequest struct {
-	Vector []float32 `json:"vector"`
-	Limit  int       `json:"limit"`
+	Vector      []float32      `json:"vector"`
+	Limit       int            `json:"limit" binding:"required_without=MaxDistance,gte=0,lte=10000"`
+	MaxDistance *float32       `json:"max_distance,omitempty"`           // only results this close, limit 0 returns all of them
+	Offset      int            `json:"offset,omitempty" binding:"gte=0"` // results skipped for paging
+	Params      map[string]any `json:"params,omitempty"`                 // index search parameters of this query, e.g. efsearch or nprobe
+	RerankExact bool           `json:"rerank_exact,omitempty"`           // reorder over-fetched candidates by exact distance
+}
+
+// MultiSearchRequest searches one query across several collections, their
+// results are merged by weighted distance
+type MultiSearchRequest struct {
+	Collections []MultiSearchCollection `json:"collections"`
+	Vector      []float32               `json:"vector"`
+	QueryText   string                  `json:"query_text,omitempty"` // embedded by the server instead of vector
+	Limit       int                     `json:"limit"`
+	Offset      int                     `json:"offset,omitempty"` // merged results skipped for paging
+	Filter      map[string]any          `json:"filter"`           // applied to every collection
+}
+
+// MultiSearchCollection is a collection of a multi-collection search
+type MultiSearchCollection struct {
+	Name   string  `json:"name"`
+	Weight float32 `json:"weight,omitempty"` // distances are multiplied by it, defaults to 1
+}
+
+// MultiSearchResult is a document of a multi-collection search
+type MultiSearchResult struct {
+	Collection       string         `json:"collection"`
+	ID               string         `json:"id"`
+	Vector           []float32      `json:"vector"`
+	Parameters       map[string]any `json:"parameters"`
+	Dimension        int            `json:"dimension"`
+	Distance         float32        `json:"distance"`          // distance in its collection
+	WeightedDistance float32        `json:"weighted_distance"` // results are ordered by it
 }
 
 type BatchUpsertRequest struct {
 	Documents []*DB.Document `json:"documents"`
 }
 
+// IngestDocumentRequest is a long text to be chunked, embedded and upserted
+type IngestDocumentRequest struct {
+	ID         string         `json:"id" binding:"required"`   // parent document ID
+	Text       string         `json:"text" binding:"required"` // text to split into chunks
+	Parameters map[string]any `json:"parameters"`              // copied to every chunk
+	Chunking   chunk.Options  `json:"chunking"`                // size, overlap and splitter
+	StartID    *int           `json:"start_id,omitempty"`      // number chunks instead of naming them
+}
+
+// CloneRequest copies a collection into Target, IndexType and IndexParams
+// replace the index settings of the source when set
+type CloneRequest struct {
+	Target      string          `json:"target" binding:"required,collection_name"`
+	IndexType   string          `json:"index_type,omitempty"`
+	IndexParams IndexParameters `json:"index_params,omitempty"`
+}
+
+// ReindexRequest rebuilds the index of a collection, IndexType and
+// Parameters replace its index settings when set
+type ReindexRequest struct {
+	IndexType  string          `json:"index_type,omitempty"`
+	Parameters IndexParameters `json:"parameters,omitempty"`
+}
+
+// ArchiveRequest archives documents unread for UnreadDays, 0 means the
+// archive.after_days config
+type ArchiveRequest struct {
+	UnreadDays int `json:"unread_days"`
+}
+
+// ScrollRequest fetches a page of all documents matching Filter, later pages
+// only need the Cursor of the previous response
+type ScrollRequest struct {
+	Filter           map[string]any `json:"filter,omitempty"`
+	Size             int            `json:"size,omitempty"`               // documents per page, defaults to 100
+	Cursor           string         `json:"cursor,omitempty"`             // empty starts a new scroll
+	KeepAliveSeconds int            `json:"keep_alive_seconds,omitempty"` // cursor lifetime, defaults to 300
+	Snapshot         bool           `json:"snapshot,omitempty"`           // read the collection as of the first page
+}
+
+// WarmupRequest optionally runs dummy searches on every collection
+type WarmupRequest struct {
+	Searches int `json:"searches,omitempty"` // per collection, 0 only loads
+}
+
+// ReadinessResponse reports whether the server can serve requests, Status is
+// "ready" if every check passed and "not ready" otherwise
+type ReadinessResponse struct {
+	Status string                         `json:"status"`
+	Checks map[string]HealthCheckResponse `json:"checks"`
+}
+
+// HealthCheckResponse is the result of one readiness check
+type HealthCheckResponse struct {
+	Status string `json:"status"`          // "ok" or "failed"
+	Error  string `json:"error,omitempty"` // why the check failed
+}
+
+// CompactionStatusResponse describes the levels of the scalar storage and
+// the state of their compactions
+type CompactionStatusResponse struct {
+	Levels         []LevelStatusResponse `json:"levels"`
+	Alive          bool                  `json:"alive"`           // the compaction goroutine is running
+	PendingFlushes int                   `json:"pending_flushes"` // memtables waiting to be written to level 0
+	QueueDepth     int                   `json:"queue_depth"`     // queued flush and level compactions
+	Flushes        uint64                `json:"flushes"`
+	LastFlushMs    int64                 `json:"last_flush_ms"`
+	Writes         string                `json:"writes"`         // normal, slowed or stopped until compaction catches up
+	SlowedWrites   uint64                `json:"slowed_writes"`  // writes delayed since start
+	StoppedWrites  uint64                `json:"stopped_writes"` // writes that waited for compaction since start
+	FailedWrites   uint64                `json:"failed_writes"`  // writes that failed waiting for compaction since start
+}
+
+// LevelStatusResponse describes one level of the scalar storage
+type LevelStatusResponse struct {
+	Level           int        `json:"level"`
+	Files           int        `json:"files"`
+	Bytes           uint64     `json:"bytes"`
+	Pending         bool       `json:"pending"` // a compaction into the next level is queued
+	Running         bool       `json:"running"`
+	Compactions     uint64     `json:"compactions"` // since the server started
+	LastDurationMs  int64      `json:"last_duration_ms"`
+	LastCompactedAt *time.Time `json:"last_compacted_at,omitempty"`
+}
+
+// ErrorResponse is the body of a failed request
+type ErrorResponse struct {
+	Error string `json:"error"`
+}
+
+// BatchFailure describes a document skipped by a batch write
+type BatchFailure struct {
+	ID    string `json:"id"`
+	Error string `json:"error"`
+}
+
+// StatsResponse reports the memory of the server, index estimates are by
+// collection storage name, tenant prefix included
+type StatsResponse struct {
+	HeapBytes        uint64           `json:"heap_bytes"`         // Go heap in use
+	IndexMemoryBytes int64            `json:"index_memory_bytes"` // estimated total of the loaded indices of every tenant
+	IndexMemory      map[string]int64 `json:"index_memory"`       // estimate of each loaded index of the request tenant
+}
+
+// DuplicateResponse is an upserted document deduplicated against an existing
+// one, it wasn't written
+type DuplicateResponse struct {
+	ID        string  `json:"id"`
+	MatchedID string  `json:"matched_id"`
+	Distance  float32 `json:"distance"`
+	Merged    bool    `json:"merged"` // its parameters were merged into the matched document
+}
+
+func duplicateResponses(matches []DB.DedupMatch) []DuplicateResponse {
+	duplicates := make([]DuplicateResponse, len(matches))
+	for i, m := range matches {
+		duplicates[i] = DuplicateResponse{ID: m.ID, MatchedID: m.MatchedID, Distance: m.Distance, Merged: m.Merged}
+	}
+	return duplicates
+}
+
+// BatchValidationResponse reports the documents a dry run of a batch write
+// would reject, nothing was written
+type BatchValidationResponse struct {
+	DryRun bool              `json:"dry_run"`
+	Valid  int               `json:"valid"` // documents the batch would write
+	Failed []DocumentFailure `json:"failed"`
+}
+
+// DocumentFailure is why a document of a batch would be rejected
+type DocumentFailure struct {
+	Index int    `json:"index"` // position of the document in the request
+	ID    string `json:"id"`
+	Error string `json:"error"`
+}
+
 type BatchDeleteRequest struct {
 	IDs []string `json:"ids"`
 }
+
+// MetricResponse represents a metric summary with its mean
+type MetricResponse struct {
+	metrics.Summary
+	Mean float64 `json:"mean"`
+}
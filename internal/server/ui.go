@@ -0,0 +1,21 @@
+package server
+
+import (
+	"embed"
+	"io/fs"
+	"net/http"
+)
+
+// uiFiles is the admin UI, a single page calling the REST API
+//
+//go:embed ui
+var uiFiles embed.FS
+
+// uiFS returns the files of the admin UI served under /ui
+func uiFS() http.FileSystem {
+	files, err := fs.Sub(uiFiles, "ui")
+	if err != nil {
+		panic(err) // the directory is embedded above
+	}
+	return http.FS(files)
+}
@@ -0,0 +1,107 @@
+package server
+
+import (
+	"errors"
+	"fmt"
+	"reflect"
+	"strings"
+	"sync"
+
+	"github.com/gin-gonic/gin"
+	"github.com/gin-gonic/gin/binding"
+	"github.com/go-playground/validator/v10"
+)
+
+// collectionNamePattern is the shape of a collection name, the same as a
+// tenant's so neither can hold the tenant separator
+var collectionNamePattern = tenantPattern
+
+var registerValidators sync.Once
+
+// setupValidation registers the validators of the binding tags of the
+// request types and reports fields by their JSON names, gin keeps a single
+// validator for the process
+func setupValidation() {
+	registerValidators.Do(func() {
+		v, ok := binding.Validator.Engine().(*validator.Validate)
+		if !ok {
+			return
+		}
+		v.RegisterTagNameFunc(func(field reflect.StructField) string {
+			name, _, _ := strings.Cut(field.Tag.Get("json"), ",")
+			if name == "-" {
+				return ""
+			}
+			return name
+		})
+		v.RegisterValidation("collection_name", func(fl validator.FieldLevel) bool {
+			return collectionNamePattern.MatchString(fl.Field().String())
+		})
+	})
+}
+
+// bindJSON binds a JSON body like ShouldBindJSON, binding tag violations are
+// reported in terms of the JSON fields
+func bindJSON(c *gin.Context, req any) error {
+	return validationError(c.ShouldBindJSON(req))
+}
+
+// validateRequest checks the binding tags of a request decoded without gin,
+// e.g. from the header of a binary body
+func validateRequest(req any) error {
+	return validationError(binding.Validator.ValidateStruct(req))
+}
+
+// validationError rewrites the failed binding tags of err as one message
+func validationError(err error) error {
+	var errs validator.ValidationErrors
+	if !errors.As(err, &errs) {
+		return err
+	}
+	messages := make([]string, len(errs))
+	for i, e := range errs {
+		messages[i] = fieldError(e)
+	}
+	return errors.New(strings.Join(messages, ", "))
+}
+
+func fieldError(e validator.FieldError) string {
+	// the namespace without the type, e.g. "rerank.type"
+	field := e.Namespace()
+	if _, rest, ok := strings.Cut(field, "."); ok {
+		field = rest
+	}
+	switch e.Tag() {
+	case "required":
+		return field + " is required"
+	case "required_without":
+		return fmt.Sprintf("%s is required without %s", field, jsonName(e.Param()))
+	case "gt":
+		return fmt.Sprintf("%s must be greater than %s", field, e.Param())
+	case "gte", "min":
+		return fmt.Sprintf("%s must be at least %s", field, e.Param())
+	case "lte", "max":
+		return fmt.Sprintf("%s must be at most %s", field, e.Param())
+	case "oneof":
+		return fmt.Sprintf("%s must be one of %s", field, strings.ReplaceAll(e.Param(), " ", ", "))
+	case "collection_name":
+		return fmt.Sprintf("%s must be 1 to 64 letters, digits, '_' or '-', got %q", field, e.Value())
+	}
+	return fmt.Sprintf("%s failed the %s check", field, e.Tag())
+}
+
+// jsonName converts the Go field name of a tag parameter, e.g. MaxDistance,
+// to its JSON name
+func jsonName(field string) string {
+	var b strings.Builder
+	for i, r := range field {
+		if 'A' <= r && r <= 'Z' {
+			if i > 0 {
+				b.WriteByte('_')
+			}
+			r += 'a' - 'A'
+		}
+		b.WriteRune(r)
+	}
+	return b.String()
+}
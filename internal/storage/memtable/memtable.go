@@ -3,9 +3,13 @@ package memtable
 type MemTableConstructor func() MemTable
 
 type MemTable interface {
-	Put(key, value []byte) error
-	Get(key []byte) ([]byte, bool)
-	All() []*KVPair  // return all key-value pairs
+	// Put adds the version of key written at seq, seqs only grow. Versions
+	// no read at or after keep can see are dropped
+	Put(key, value []byte, seq, keep uint64) error
+	Get(key []byte) ([]byte, bool) // newest version
+	// GetAt returns the newest version of key written at or before seq
+	GetAt(key []byte, seq uint64) ([]byte, bool)
+	All() []*KVPair  // return all versions by key, newest first
 	Size() int       // data size
 	EntriesCnt() int // num of entries
 }
@@ -13,4 +17,5 @@ type MemTable interface {
 type KVPair struct {
 	Key   []byte
 	Value []byte
+	Seq   uint64 // seq the pair was written at, 0 for data written before seqs
 }
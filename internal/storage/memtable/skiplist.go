@@ -20,8 +20,9 @@ type SkipList struct {
 }
 
 type skipListNode struct {
-	key, value []byte
-	next       []*skipListNode
+	key      []byte
+	versions []Version // newest first
+	next     []*skipListNode
 }
 
 func NewSkipList() MemTable {
@@ -49,13 +50,20 @@ func (s *SkipList) EntriesCnt() int {
 	return s.entriesCnt
 }
 
-func (s *SkipList) Put(key, value []byte) error {
+func (s *SkipList) Put(key, value []byte, seq, keep uint64) error {
 	s.mu.Lock()
 	defer s.mu.Unlock()
-	// if key exists
+	// if key exists, add the version and drop the ones nobody can read
 	if node := s.searchInternal(key); node != nil {
-		s.size += len(value) - len(node.value)
-		node.value = value
+		if node.versions[0].Seq == seq {
+			// replayed data written before seqs all has seq 0
+			s.size += len(value) - len(node.versions[0].Value)
+			node.versions[0].Value = value
+			return nil
+		}
+		versions := Prune(append([]Version{{Seq: seq, Value: value}}, node.versions...), keep)
+		s.size += valuesSize(versions) - valuesSize(node.versions)
+		node.versions = versions
 		return nil
 	}
 	// if key not exist, insert it
@@ -72,9 +80,9 @@ func (s *SkipList) Put(key, value []byte) error {
 	}
 
 	newNode := &skipListNode{
-		key:   key,
-		value: value,
-		next:  make([]*skipListNode, newLevel),
+		key:      key,
+		versions: []Version{{Seq: seq, Value: value}},
+		next:     make([]*skipListNode, newLevel),
 	}
 
 	// insert node from top to bottom
@@ -90,6 +98,15 @@ func (s *SkipList) Put(key, value []byte) error {
 	return nil
 }
 
+// valuesSize is the data size of versions, their key counts once
+func valuesSize(versions []Version) int {
+	size := 0
+	for _, v := range versions {
+		size += len(v.Value)
+	}
+	return size
+}
+
 func (s *SkipList) GetRandomLevel() int {
 	level := 1
 	for rand.Float32() < P && level < MAX_LEVEL {
@@ -123,22 +140,38 @@ func (s *SkipList) Get(key []byte) ([]byte, bool) {
 	s.mu.RLock()
 	defer s.mu.RUnlock()
 	if node := s.searchInternal(key); node != nil {
-		return node.value, true
+		return node.versions[0].Value, true
+	}
+	return nil, false
+}
+
+func (s *SkipList) GetAt(key []byte, seq uint64) ([]byte, bool) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	if node := s.searchInternal(key); node != nil {
+		if v, ok := VisibleAt(node.versions, seq); ok {
+			return v.Value, true
+		}
 	}
 	return nil, false
 }
 
 func (s *SkipList) All() []*KVPair {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
 	if s.entriesCnt == 0 {
 		return nil
 	}
 	nodes := make([]*KVPair, 0, s.entriesCnt)
 
-	for cur := s.head.next[0]; cur.next[0] != nil; cur = cur.next[0] {
-		nodes = append(nodes, &KVPair{
-			Key:   cur.key,
-			Value: cur.value,
-		})
+	for cur := s.head.next[0]; cur != nil; cur = cur.next[0] {
+		for _, v := range cur.versions {
+			nodes = append(nodes, &KVPair{
+				Key:   cur.key,
+				Value: v.Value,
+				Seq:   v.Seq,
+			})
+		}
 	}
 	return nodes
 }
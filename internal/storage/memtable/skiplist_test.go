@@ -15,7 +15,7 @@ func TestSkipList_BasicOperations(t *testing.T) {
 	// Test Put and Get
 	key1 := []byte("key1")
 	value1 := []byte("value1")
-	err := sl.Put(key1, value1)
+	err := sl.Put(key1, value1, 1, 1)
 	assert.NoError(t, err)
 
 	val, ok := sl.Get(key1)
@@ -24,7 +24,7 @@ func TestSkipList_BasicOperations(t *testing.T) {
 
 	// Test update existing key
 	value2 := []byte("value2")
-	err = sl.Put(key1, value2)
+	err = sl.Put(key1, value2, 2, 2)
 	assert.NoError(t, err)
 
 	val, ok = sl.Get(key1)
@@ -58,7 +58,7 @@ func TestSkipList_ConcurrentOperations(t *testing.T) {
 			for j := 0; j < numOpsPerGoroutine; j++ {
 				key := []byte("key" + string(rune(id)) + string(rune(j)))
 				value := []byte("value" + string(rune(id)) + string(rune(j)))
-				err := sl.Put(key, value)
+				err := sl.Put(key, value, 1, 1)
 				assert.NoError(t, err)
 			}
 		}(i)
@@ -85,3 +85,73 @@ func TestSkipList_ConcurrentOperations(t *testing.T) {
 	// Verify final state
 	assert.Equal(t, numGoroutines*numOpsPerGoroutine, sl.EntriesCnt())
 }
+
+func TestSkipList_All(t *testing.T) {
+	sl := memtable.NewSkipList()
+	assert.Nil(t, sl.All())
+
+	for _, key := range []string{"c", "a", "b"} {
+		assert.NoError(t, sl.Put([]byte(key), []byte("v"+key), 1, 1))
+	}
+	all := sl.All()
+	assert.Len(t, all, 3)
+	for i, key := range []string{"a", "b", "c"} {
+		assert.Equal(t, key, string(all[i].Key))
+		assert.Equal(t, "v"+key, string(all[i].Value))
+	}
+}
+
+func TestSkipList_Versions(t *testing.T) {
+	sl := memtable.NewSkipList()
+	key := []byte("key")
+
+	// a read at seq 1 keeps the first version alive
+	assert.NoError(t, sl.Put(key, []byte("v1"), 1, 1))
+	assert.NoError(t, sl.Put(key, []byte("v2"), 2, 1))
+	assert.NoError(t, sl.Put(key, nil, 3, 1))
+
+	val, ok := sl.Get(key)
+	assert.True(t, ok)
+	assert.Empty(t, val)
+	for seq, want := range map[uint64]string{1: "v1", 2: "v2", 3: ""} {
+		val, ok = sl.GetAt(key, seq)
+		assert.True(t, ok)
+		assert.Equal(t, want, string(val))
+	}
+	_, ok = sl.GetAt(key, 0)
+	assert.False(t, ok)
+	assert.Len(t, sl.All(), 3)
+	assert.Equal(t, 1, sl.EntriesCnt())
+
+	// once nobody reads older seqs only the newest version is kept
+	assert.NoError(t, sl.Put(key, []byte("v4"), 4, 4))
+	all := sl.All()
+	assert.Len(t, all, 1)
+	assert.Equal(t, uint64(4), all[0].Seq)
+	assert.Equal(t, len(key)+len("v4"), sl.Size())
+}
+
+func TestVersions_Encoding(t *testing.T) {
+	versions := []memtable.Version{{Seq: 9, Value: []byte("new")}, {Seq: 3, Value: nil}, {Seq: 1, Value: []byte("old")}}
+	data := memtable.EncodeVersions(versions)
+
+	decoded, err := memtable.DecodeVersions(data)
+	assert.NoError(t, err)
+	assert.Len(t, decoded, 3)
+	for i := range versions {
+		assert.Equal(t, versions[i].Seq, decoded[i].Seq)
+		assert.Equal(t, string(versions[i].Value), string(decoded[i].Value))
+	}
+	seq, err := memtable.NewestSeq(data)
+	assert.NoError(t, err)
+	assert.Equal(t, uint64(9), seq)
+
+	v, ok := memtable.VisibleAt(decoded, 5)
+	assert.True(t, ok)
+	assert.Equal(t, uint64(3), v.Seq)
+	assert.Len(t, memtable.Prune(decoded, 5), 2)
+	assert.Len(t, memtable.Prune(decoded, 0), 3)
+
+	_, err = memtable.DecodeVersions(data[:len(data)-1])
+	assert.ErrorIs(t, err, memtable.ErrInvalidVersions)
+}
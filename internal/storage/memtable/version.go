@@ -0,0 +1,94 @@
+package memtable
+
+import (
+	"encoding/binary"
+	"errors"
+)
+
+var ErrInvalidVersions = errors.New("invalid version list")
+
+// Version is the value of a key written at a seq, an empty value is the
+// tombstone of a delete
+type Version struct {
+	Seq   uint64
+	Value []byte
+}
+
+// VisibleAt returns the newest of versions, given newest first, written at or
+// before seq
+func VisibleAt(versions []Version, seq uint64) (Version, bool) {
+	for _, v := range versions {
+		if v.Seq <= seq {
+			return v, true
+		}
+	}
+	return Version{}, false
+}
+
+// Prune drops the versions, given newest first, that no read at or after
+// keep can see: all versions newer than keep are kept, and of the others only
+// the newest
+func Prune(versions []Version, keep uint64) []Version {
+	for i, v := range versions {
+		if v.Seq <= keep {
+			return versions[:i+1]
+		}
+	}
+	return versions
+}
+
+// EncodeVersions encodes versions, newest first, as the count followed by the
+// seq, value length and value of each
+func EncodeVersions(versions []Version) []byte {
+	size := binary.MaxVarintLen64
+	for _, v := range versions {
+		size += 2*binary.MaxVarintLen64 + len(v.Value)
+	}
+	buf := make([]byte, 0, size)
+	buf = binary.AppendUvarint(buf, uint64(len(versions)))
+	for _, v := range versions {
+		buf = binary.AppendUvarint(buf, v.Seq)
+		buf = binary.AppendUvarint(buf, uint64(len(v.Value)))
+		buf = append(buf, v.Value...)
+	}
+	return buf
+}
+
+// DecodeVersions decodes a list written by EncodeVersions, the values point
+// into data
+func DecodeVersions(data []byte) ([]Version, error) {
+	count, n := binary.Uvarint(data)
+	if n <= 0 || count > uint64(len(data)) {
+		return nil, ErrInvalidVersions
+	}
+	data = data[n:]
+	versions := make([]Version, count)
+	for i := range versions {
+		seq, n := binary.Uvarint(data)
+		if n <= 0 {
+			return nil, ErrInvalidVersions
+		}
+		data = data[n:]
+		size, n := binary.Uvarint(data)
+		if n <= 0 || size > uint64(len(data)-n) {
+			return nil, ErrInvalidVersions
+		}
+		data = data[n:]
+		versions[i] = Version{Seq: seq, Value: data[:size:size]}
+		data = data[size:]
+	}
+	return versions, nil
+}
+
+// NewestSeq returns the seq of the newest version of an encoded list
+func NewestSeq(data []byte) (uint64, error) {
+	count, n := binary.Uvarint(data)
+	if n <= 0 || count == 0 || count > uint64(len(data)) {
+		return 0, ErrInvalidVersions
+	}
+	seq, m := binary.Uvarint(data[n:])
+	if m <= 0 {
+		return 0, ErrInvalidVersions
+	}
+	return seq, nil
+}
@@ -0,0 +1,108 @@
+package sstable
+
+import (
+	"fmt"
+	"sync"
+
+	"github.com/klauspost/compress/s2"
+	"github.com/klauspost/compress/zstd"
+)
+
+// Codec is the compression of a data block, stored in its first byte
+type Codec byte
+
+const (
+	CodecNone Codec = iota
+	CodecSnappy
+	CodecZstd
+)
+
+// blockFormatHeader marks index entries of tables whose data blocks start
+// with a codec byte, tables written before compression have no marker
+const blockFormatHeader = 1
+
+// blockFormatVersions marks tables whose data blocks start with a codec byte
+// and whose values are version lists, see memtable.EncodeVersions. Their
+// index entries end with the newest seq up to their block
+const blockFormatVersions = 2
+
+// ParseCodec returns the codec configured by name, empty means none
+func ParseCodec(name string) (Codec, error) {
+	switch name {
+	case "", "none":
+		return CodecNone, nil
+	case "snappy":
+		return CodecSnappy, nil
+	case "zstd":
+		return CodecZstd, nil
+	}
+	return CodecNone, fmt.Errorf("unknown sstable compression %q", name)
+}
+
+var (
+	zstdDecoder, _ = zstd.NewReader(nil)
+	zstdEncoders   sync.Map // compression level to *zstd.Encoder
+)
+
+func zstdEncoder(level int) (*zstd.Encoder, error) {
+	if encoder, ok := zstdEncoders.Load(level); ok {
+		return encoder.(*zstd.Encoder), nil
+	}
+	opts := []zstd.EOption{zstd.WithEncoderConcurrency(1)}
+	if level != 0 {
+		opts = append(opts, zstd.WithEncoderLevel(zstd.EncoderLevelFromZstd(level)))
+	}
+	encoder, err := zstd.NewWriter(nil, opts...)
+	if err != nil {
+		return nil, err
+	}
+	actual, _ := zstdEncoders.LoadOrStore(level, encoder)
+	return actual.(*zstd.Encoder), nil
+}
+
+// compressBlock returns the codec byte followed by the compressed records,
+// records that don't shrink are stored uncompressed. level only applies to
+// zstd, 0 is its default
+func compressBlock(codec Codec, level int, records []byte) ([]byte, error) {
+	block := []byte{byte(codec)}
+	switch codec {
+	case CodecSnappy:
+		block = append(block, s2.EncodeSnappy(nil, records)...)
+	case CodecZstd:
+		encoder, err := zstdEncoder(level)
+		if err != nil {
+			return nil, err
+		}
+		block = encoder.EncodeAll(records, block)
+	default:
+		return append(block, records...), nil
+	}
+	if len(block) >= len(records)+1 {
+		return append([]byte{byte(CodecNone)}, records...), nil
+	}
+	return block, nil
+}
+
+// decompressBlock returns the records of a block written by compressBlock
+func decompressBlock(block []byte) ([]byte, error) {
+	if len(block) == 0 {
+		return nil, ErrInvalidFile
+	}
+	switch Codec(block[0]) {
+	case CodecNone:
+		return block[1:], nil
+	case CodecSnappy:
+		records, err := s2.Decode(nil, block[1:])
+		if err != nil {
+			return nil, fmt.Errorf("failed to decompress snappy block: %w", err)
+		}
+		return records, nil
+	case CodecZstd:
+		records, err := zstdDecoder.DecodeAll(block[1:], nil)
+		if err != nil {
+			return nil, fmt.Errorf("failed to decompress zstd block: %w", err)
+		}
+		return records, nil
+	}
+	return nil, fmt.Errorf("%w: unknown block codec %d", ErrInvalidFile, block[0])
+}
@@ -0,0 +1,114 @@
+package sstable
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"os"
+	"path"
+	"testing"
+
+	"oasisdb/internal/config"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestCompressBlock(t *testing.T) {
+	records := bytes.Repeat([]byte(`{"title":"movie","genre":"drama"}`), 50)
+	for _, codec := range []Codec{CodecNone, CodecSnappy, CodecZstd} {
+		block, err := compressBlock(codec, 0, records)
+		require.NoError(t, err)
+		assert.Equal(t, byte(codec), block[0])
+		if codec != CodecNone {
+			assert.Less(t, len(block), len(records)/4)
+		}
+		decompressed, err := decompressBlock(block)
+		require.NoError(t, err)
+		assert.Equal(t, records, decompressed)
+	}
+
+	// records that don't shrink are stored as they are
+	block, err := compressBlock(CodecZstd, 3, []byte("ab"))
+	require.NoError(t, err)
+	assert.Equal(t, []byte{byte(CodecNone), 'a', 'b'}, block)
+
+	_, err = decompressBlock([]byte{9, 1, 2})
+	assert.ErrorIs(t, err, ErrInvalidFile)
+	_, err = ParseCodec("lz4")
+	assert.Error(t, err)
+}
+
+func TestSSTableCompression(t *testing.T) {
+	var kvs [][2]string
+	for i := 0; i < 200; i++ {
+		kvs = append(kvs, [2]string{fmt.Sprintf("doc:%03d", i), fmt.Sprintf(`{"id":"%d","parameters":{"genre":"drama","year":2001}}`, i)})
+	}
+
+	sizes := map[string]uint64{}
+	for _, codec := range []string{"none", "snappy", "zstd"} {
+		conf, err := config.NewConfig(t.TempDir())
+		require.NoError(t, err)
+		conf.Storage.SSTDataBlockSize = 1024
+		conf.Storage.Compression = codec
+		reader := writeTestSSTable(t, conf, "c.sst", kvs)
+
+		assert.Equal(t, kvs, collect(t, reader.NewIterator()), codec)
+		data, err := reader.ReadData()
+		require.NoError(t, err)
+		assert.Len(t, data, len(kvs))
+		assert.Equal(t, kvs[150][1], string(data[150].Value))
+		sizes[codec], err = reader.Size()
+		require.NoError(t, err)
+	}
+	assert.Less(t, sizes["snappy"], sizes["none"])
+	assert.Less(t, sizes["zstd"], sizes["none"])
+
+	conf, err := config.NewConfig(t.TempDir())
+	require.NoError(t, err)
+	conf.Storage.Compression = "lz4"
+	_, err = NewSSTableWriter("c.sst", conf)
+	assert.Error(t, err)
+}
+
+// tables written before compression have no codec bytes and two uvarint
+// index values
+func TestSSTableWithoutBlockHeaders(t *testing.T) {
+	conf, err := config.NewConfig(t.TempDir())
+	require.NoError(t, err)
+
+	data, index := NewBlock(), NewBlock()
+	var value [20]byte
+	n := binary.PutUvarint(value[:], 0)
+	n += binary.PutUvarint(value[n:], 0)
+	require.NoError(t, index.Append([]byte("a"), value[:n]))
+	require.NoError(t, data.Append([]byte("a"), []byte("1")))
+	require.NoError(t, data.Append([]byte("b"), []byte("2")))
+	n = binary.PutUvarint(value[:], 0)
+	n += binary.PutUvarint(value[n:], data.Size())
+	require.NoError(t, index.Append([]byte("b"), value[:n]))
+
+	var file bytes.Buffer
+	dataSize, err := data.FlushTo(&file)
+	require.NoError(t, err)
+	indexSize, err := index.FlushTo(&file)
+	require.NoError(t, err)
+	footer := make([]byte, conf.Storage.SSTFooterSize)
+	binary.LittleEndian.PutUint64(footer[0:], dataSize)
+	binary.LittleEndian.PutUint64(footer[16:], dataSize)
+	binary.LittleEndian.PutUint64(footer[24:], indexSize)
+	file.Write(footer)
+	require.NoError(t, os.WriteFile(path.Join(conf.SSTDir(), "old.sst"), file.Bytes(), 0644))
+
+	reader, err := NewSSTableReader("old.sst", conf)
+	require.NoError(t, err)
+	defer reader.Close()
+	assert.Equal(t, [][2]string{{"a", "1"}, {"b", "2"}}, collect(t, reader.NewIterator()))
+	entries, err := reader.ReadIndex()
+	require.NoError(t, err)
+	block, err := reader.ReadBlock(entries[1].PrevOffset, entries[1].PrevSize)
+	require.NoError(t, err)
+	kvs, err := reader.ParseDataBlock(block)
+	require.NoError(t, err)
+	assert.Len(t, kvs, 2)
+}
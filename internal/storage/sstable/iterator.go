@@ -0,0 +1,226 @@
+package sstable
+
+import (
+	"bufio"
+	"bytes"
+	"container/heap"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+)
+
+// Iterator walks key-value pairs in ascending key order. Key and Value stay
+// valid after Next, so callers may keep them.
+type Iterator interface {
+	// Next moves to the next pair, it returns false once the pairs are
+	// exhausted or reading failed, Err tells the two apart
+	Next() bool
+	Key() []byte
+	Value() []byte
+	Err() error
+}
+
+// SSTableIterator streams the records of an SSTable's data blocks, only one
+// block is held in memory
+type SSTableIterator struct {
+	reader *bufio.Reader // data region of tables without block headers
+
+	// tables with block headers are read block by block
+	table  *SSTableReader
+	blocks []*IndexEntry
+	block  *bytes.Buffer
+
+	key   []byte
+	value []byte
+	err   error
+}
+
+// NewIterator returns an iterator over all records of the table. It reads the
+// file with positioned reads, so it may run alongside lookups on the reader.
+func (s *SSTableReader) NewIterator() *SSTableIterator {
+	return s.NewIteratorFrom(nil)
+}
+
+// NewIteratorFrom returns an iterator like NewIterator that skips the blocks
+// holding only keys before start. It may still return some keys before start,
+// tables without block headers are read from their first record
+func (s *SSTableReader) NewIteratorFrom(start []byte) *SSTableIterator {
+	if s.filterOffset == 0 {
+		if err := s.ReadFooter(); err != nil {
+			return &SSTableIterator{err: err}
+		}
+	}
+	if s.blockHeaders {
+		index, err := s.ReadIndex()
+		if err != nil {
+			return &SSTableIterator{err: err}
+		}
+		it := &SSTableIterator{table: s, block: &bytes.Buffer{}}
+		for _, entry := range index {
+			// a block holds the keys after the previous index key up to its own
+			if entry.PrevSize > 0 && bytes.Compare(entry.Key, start) >= 0 {
+				it.blocks = append(it.blocks, entry)
+			}
+		}
+		return it
+	}
+	data := io.NewSectionReader(s.src, 0, int64(s.filterOffset))
+	return &SSTableIterator{reader: bufio.NewReaderSize(data, int(s.conf.Storage.SSTDataBlockSize))}
+}
+
+func (it *SSTableIterator) Next() bool {
+	if it.table != nil {
+		return it.nextInBlock()
+	}
+	if it.err != nil || it.reader == nil {
+		return false
+	}
+
+	// records are laid out as in Block: key length, value length, key, value
+	var header [6]byte
+	if _, err := io.ReadFull(it.reader, header[:]); err != nil {
+		if err != io.EOF {
+			it.err = fmt.Errorf("failed to read record header: %w", err)
+		}
+		it.reader = nil
+		return false
+	}
+	keyLen := int(binary.LittleEndian.Uint16(header[0:]))
+	record := make([]byte, keyLen+int(binary.LittleEndian.Uint32(header[2:])))
+	if _, err := io.ReadFull(it.reader, record); err != nil {
+		if errors.Is(err, io.EOF) {
+			err = io.ErrUnexpectedEOF
+		}
+		it.err = fmt.Errorf("failed to read record: %w", err)
+		return false
+	}
+	it.key, it.value = record[:keyLen], record[keyLen:]
+	return true
+}
+
+// nextInBlock returns the next record of the current block, reading the next
+// block once it's exhausted. Blocks are read from the file, not a mapping,
+// so the iterator outlives a destroyed table with an error instead of a fault
+func (it *SSTableIterator) nextInBlock() bool {
+	for it.err == nil {
+		key, value, err := it.table.ReadRecord(nil, it.block)
+		if err == nil {
+			it.key, it.value = key, value
+			return true
+		}
+		if len(it.blocks) == 0 {
+			return false
+		}
+
+		entry := it.blocks[0]
+		it.blocks = it.blocks[1:]
+		raw := make([]byte, entry.PrevSize)
+		if _, err := it.table.src.ReadAt(raw, int64(entry.PrevOffset)); err != nil {
+			if errors.Is(err, io.EOF) {
+				err = io.ErrUnexpectedEOF
+			}
+			it.err = fmt.Errorf("failed to read block: %w", err)
+			return false
+		}
+		records, err := decompressBlock(raw)
+		if err != nil {
+			it.err = err
+			return false
+		}
+		it.block = bytes.NewBuffer(records)
+	}
+	return false
+}
+
+func (it *SSTableIterator) Key() []byte   { return it.key }
+func (it *SSTableIterator) Value() []byte { return it.value }
+func (it *SSTableIterator) Err() error    { return it.err }
+
+// MergeIterator merges sorted iterators into one sorted stream. Of pairs
+// with the same key only the one from the newest iterator is returned, a
+// later iterator is newer than an earlier one.
+type MergeIterator struct {
+	sources mergeHeap
+	merge   func(newer, older []byte) ([]byte, error)
+	key     []byte
+	value   []byte
+	err     error
+}
+
+type mergeSource struct {
+	it       Iterator
+	priority int // position in the input, higher is newer
+}
+
+// NewMergeIterator merges iters, they are given from oldest to newest
+func NewMergeIterator(iters ...Iterator) *MergeIterator {
+	m := &MergeIterator{sources: make(mergeHeap, 0, len(iters))}
+	for i, it := range iters {
+		m.advance(&mergeSource{it: it, priority: i})
+	}
+	return m
+}
+
+// NewMergeIteratorFunc merges iters like NewMergeIterator, but the values of
+// pairs with the same key are combined by merge, from newest to oldest,
+// instead of keeping the newest one
+func NewMergeIteratorFunc(merge func(newer, older []byte) ([]byte, error), iters ...Iterator) *MergeIterator {
+	m := NewMergeIterator(iters...)
+	m.merge = merge
+	return m
+}
+
+func (m *MergeIterator) Next() bool {
+	if m.err != nil || m.sources.Len() == 0 {
+		return false
+	}
+
+	// the top is the smallest key from the newest source, older versions of
+	// the key are skipped
+	top := heap.Pop(&m.sources).(*mergeSource)
+	m.key, m.value = top.it.Key(), top.it.Value()
+	m.advance(top)
+	for m.sources.Len() > 0 && bytes.Equal(m.sources[0].it.Key(), m.key) {
+		older := heap.Pop(&m.sources).(*mergeSource)
+		if m.merge != nil && m.err == nil {
+			m.value, m.err = m.merge(m.value, older.it.Value())
+		}
+		m.advance(older)
+	}
+	return m.err == nil
+}
+
+// advance moves a source to its next pair and puts it back into the heap
+// unless it is exhausted
+func (m *MergeIterator) advance(s *mergeSource) {
+	if s.it.Next() {
+		heap.Push(&m.sources, s)
+		return
+	}
+	if err := s.it.Err(); err != nil && m.err == nil {
+		m.err = err
+	}
+}
+
+func (m *MergeIterator) Key() []byte   { return m.key }
+func (m *MergeIterator) Value() []byte { return m.value }
+func (m *MergeIterator) Err() error    { return m.err }
+
+type mergeHeap []*mergeSource
+
+func (h mergeHeap) Len() int { return len(h) }
+func (h mergeHeap) Less(i, j int) bool {
+	if c := bytes.Compare(h[i].it.Key(), h[j].it.Key()); c != 0 {
+		return c < 0
+	}
+	return h[i].priority > h[j].priority
+}
+func (h mergeHeap) Swap(i, j int) { h[i], h[j] = h[j], h[i] }
+func (h *mergeHeap) Push(x any)   { *h = append(*h, x.(*mergeSource)) }
+func (h *mergeHeap) Pop() any {
+	old := *h
+	s := old[len(old)-1]
+	*h = old[:len(old)-1]
+	return s
+}
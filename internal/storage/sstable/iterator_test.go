@@ -0,0 +1,130 @@
+package sstable
+
+import (
+	"fmt"
+	"os"
+	"path"
+	"testing"
+
+	"oasisdb/internal/config"
+	"oasisdb/internal/storage/memtable"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func writeTestSSTable(t *testing.T, conf *config.Config, file string, kvs [][2]string) *SSTableReader {
+	t.Helper()
+	writer, err := NewSSTableWriter(file, conf)
+	require.NoError(t, err)
+	for _, kv := range kvs {
+		require.NoError(t, writer.Append([]byte(kv[0]), []byte(kv[1])))
+	}
+	_, _, _, err = writer.Finish()
+	require.NoError(t, err)
+
+	reader, err := NewSSTableReader(file, conf)
+	require.NoError(t, err)
+	t.Cleanup(func() { reader.Close() })
+	return reader
+}
+
+func collect(t *testing.T, it Iterator) [][2]string {
+	t.Helper()
+	var kvs [][2]string
+	for it.Next() {
+		kvs = append(kvs, [2]string{string(it.Key()), string(it.Value())})
+	}
+	require.NoError(t, it.Err())
+	return kvs
+}
+
+func TestSSTableIterator(t *testing.T) {
+	conf, err := config.NewConfig(t.TempDir())
+	require.NoError(t, err)
+	conf.Storage.SSTDataBlockSize = 64 // spread the records over several blocks
+
+	var kvs [][2]string
+	for i := 0; i < 50; i++ {
+		kvs = append(kvs, [2]string{fmt.Sprintf("key%03d", i), fmt.Sprintf("value%d", i)})
+	}
+	kvs = append(kvs, [2]string{"key999", ""}) // tombstone
+	reader := writeTestSSTable(t, conf, "iter.sst", kvs)
+
+	assert.Equal(t, kvs, collect(t, reader.NewIterator()))
+}
+
+func TestSSTableIteratorTruncated(t *testing.T) {
+	conf, err := config.NewConfig(t.TempDir())
+	require.NoError(t, err)
+	conf.Storage.SSTDataBlockSize = 1 // a block per record
+	reader := writeTestSSTable(t, conf, "iter.sst", [][2]string{{"a", "1"}, {"b", "2"}})
+
+	// a data region cut inside the second block
+	it := reader.NewIterator()
+	require.NoError(t, os.Truncate(path.Join(conf.SSTDir(), "iter.sst"), 10))
+	assert.True(t, it.Next())
+	assert.False(t, it.Next())
+	assert.Error(t, it.Err())
+}
+
+func TestMergeIterator(t *testing.T) {
+	conf, err := config.NewConfig(t.TempDir())
+	require.NoError(t, err)
+	older := writeTestSSTable(t, conf, "older.sst", [][2]string{{"a", "a1"}, {"c", "c1"}, {"e", "e1"}})
+	middle := writeTestSSTable(t, conf, "middle.sst", [][2]string{{"b", "b2"}, {"c", "c2"}})
+	newer := writeTestSSTable(t, conf, "newer.sst", [][2]string{{"c", ""}, {"d", "d3"}, {"e", "e3"}})
+	empty := writeTestSSTable(t, conf, "empty.sst", nil)
+
+	it := NewMergeIterator(older.NewIterator(), empty.NewIterator(), middle.NewIterator(), newer.NewIterator())
+	assert.Equal(t, [][2]string{
+		{"a", "a1"},
+		{"b", "b2"},
+		{"c", ""}, // the newest version, a delete, wins
+		{"d", "d3"},
+		{"e", "e3"},
+	}, collect(t, it))
+
+	assert.Empty(t, collect(t, NewMergeIterator()))
+}
+
+func TestMergeIteratorFunc(t *testing.T) {
+	conf, err := config.NewConfig(t.TempDir())
+	require.NoError(t, err)
+	older := writeTestSSTable(t, conf, "older.sst", [][2]string{{"a", "a1"}, {"c", "c1"}})
+	newer := writeTestSSTable(t, conf, "newer.sst", [][2]string{{"c", "c2"}, {"d", "d2"}})
+
+	concat := func(newer, older []byte) ([]byte, error) {
+		return []byte(string(newer) + "," + string(older)), nil
+	}
+	it := NewMergeIteratorFunc(concat, older.NewIterator(), newer.NewIterator())
+	assert.Equal(t, [][2]string{{"a", "a1"}, {"c", "c2,c1"}, {"d", "d2"}}, collect(t, it))
+}
+
+func TestVersionedSSTable(t *testing.T) {
+	conf, err := config.NewConfig(t.TempDir())
+	require.NoError(t, err)
+	conf.Storage.SSTDataBlockSize = 32
+
+	writer, err := NewVersionedSSTableWriter("versions.sst", conf)
+	require.NoError(t, err)
+	assert.Error(t, writer.Append([]byte("bad"), []byte("not versions")))
+	for i, seq := range []uint64{5, 9, 2} {
+		value := memtable.EncodeVersions([]memtable.Version{{Seq: seq, Value: []byte(fmt.Sprint(i))}})
+		require.NoError(t, writer.Append([]byte(fmt.Sprintf("key%d", i)), value))
+	}
+	_, _, index, err := writer.Finish()
+	require.NoError(t, err)
+	assert.Equal(t, uint64(9), index[len(index)-1].MaxSeq)
+
+	reader, err := NewSSTableReader("versions.sst", conf)
+	require.NoError(t, err)
+	defer reader.Close()
+	assert.True(t, reader.Versioned())
+	read, err := reader.ReadIndex()
+	require.NoError(t, err)
+	assert.Equal(t, uint64(9), read[len(read)-1].MaxSeq)
+
+	plain := writeTestSSTable(t, conf, "plain.sst", [][2]string{{"a", "1"}})
+	assert.False(t, plain.Versioned())
+}
@@ -1,7 +1,6 @@
 package sstable
 
 import (
-	"bufio"
 	"bytes"
 	"encoding/binary"
 	"errors"
@@ -10,6 +9,7 @@ import (
 	"oasisdb/internal/config"
 	"os"
 	"path"
+	"syscall"
 )
 
 var (
@@ -21,42 +21,66 @@ type KV struct {
 	Key   []byte
 	Value []byte
 }
+
+// source is the file of a table, local or in the cold tier
+type source interface {
+	io.ReaderAt
+	io.Closer
+}
+
 type SSTableReader struct {
 	conf         *config.Config
-	src          *os.File
-	reader       *bufio.Reader
+	src          source
+	size         int64  // of the file
 	filterOffset uint64 // bloom filter offset
 	filterSize   uint64 // bloom filter size
 	indexOffset  uint64 // index block offset
 	indexSize    uint64 // index block size
+	data         []byte // the mapped file if conf.Storage.MmapReads is set
+	blockHeaders bool   // data blocks start with a codec byte, false for tables written before compression
+	versioned    bool   // values are version lists
 }
 
+// NewSSTableReader opens a table of conf.SSTDir(), a table moved to the cold
+// tier is read from there
 func NewSSTableReader(file string, conf *config.Config) (*SSTableReader, error) {
-	src, err := os.OpenFile(path.Join(conf.Dir, file), os.O_RDONLY, 0644)
-	if err != nil {
+	var src source
+	var size int64
+	local, err := os.OpenFile(path.Join(conf.SSTDir(), file), os.O_RDONLY, 0644)
+	switch {
+	case err == nil:
+		stat, err := local.Stat()
+		if err != nil {
+			local.Close()
+			return nil, err
+		}
+		src, size = local, stat.Size()
+	case os.IsNotExist(err) && conf.ColdTier != nil:
+		object, err := openRemote(file, conf)
+		if err != nil {
+			return nil, err
+		}
+		src, size = object, object.Size()
+	default:
 		return nil, err
 	}
 
 	// read footer
-	stat, err := src.Stat()
-	if err != nil {
-		return nil, err
-	}
-
-	size := stat.Size()
-	if size < int64(conf.SSTFooterSize) {
+	if size < int64(conf.Storage.SSTFooterSize) {
+		src.Close()
 		return nil, ErrInvalidFile
 	}
 
-	footer := make([]byte, conf.SSTFooterSize)
-	if _, err := src.ReadAt(footer, size-int64(conf.SSTFooterSize)); err != nil {
+	footer := make([]byte, conf.Storage.SSTFooterSize)
+	if _, err := src.ReadAt(footer, size-int64(conf.Storage.SSTFooterSize)); err != nil {
+		src.Close()
 		return nil, err
 	}
 	// Create reader with correct footer offsets
 	ss := &SSTableReader{
-		conf:   conf,
-		src:    src,
-		reader: bufio.NewReader(src),
+		conf: conf,
+		src:  src,
+		size: size,
 	}
 
 	// Read footer values in same order as writer
@@ -65,22 +89,105 @@ func NewSSTableReader(file string, conf *config.Config) (*SSTableReader, error)
 	ss.indexOffset = binary.LittleEndian.Uint64(footer[16:24])
 	ss.indexSize = binary.LittleEndian.Uint64(footer[24:32])
 
+	if err := ss.readFormat(); err != nil {
+		src.Close()
+		return nil, err
+	}
+
+	// tables in the cold tier are read from their cached copy
+	if local, ok := src.(*os.File); ok && conf.Storage.MmapReads {
+		ss.data, err = syscall.Mmap(int(local.Fd()), 0, int(size), syscall.PROT_READ, syscall.MAP_SHARED)
+		if err != nil {
+			src.Close()
+			return nil, fmt.Errorf("failed to map sstable: %w", err)
+		}
+	}
 	return ss, nil
 }
 
+// ReadBlock reads size bytes at offset. A mapped table returns a slice of the
+// mapping instead of a copy, it is only valid until Close, so callers copy
+// what they keep
 func (s *SSTableReader) ReadBlock(offset, size uint64) ([]byte, error) {
-	if _, err := s.src.Seek(int64(offset), io.SeekStart); err != nil {
-		return nil, err
+	if s.data != nil {
+		if offset+size > uint64(len(s.data)) {
+			return nil, io.ErrUnexpectedEOF
+		}
+		return s.data[offset : offset+size : offset+size], nil
 	}
-	s.reader.Reset(s.src)
 
+	// positioned reads, lookups may run concurrently
 	buf := make([]byte, size)
-	if _, err := io.ReadFull(s.src, buf); err != nil {
+	if _, err := s.src.ReadAt(buf, int64(offset)); err != nil {
 		return nil, err
 	}
 	return buf, nil
 }
 
+// readFormat reads the block format from the first index entry
+func (s *SSTableReader) readFormat() error {
+	if s.indexSize < 6 {
+		return nil
+	}
+	var header [6]byte
+	if _, err := s.src.ReadAt(header[:], int64(s.indexOffset)); err != nil {
+		return err
+	}
+	keyLen := uint64(binary.LittleEndian.Uint16(header[0:]))
+	valueLen := uint64(binary.LittleEndian.Uint32(header[2:]))
+	if 6+keyLen+valueLen > s.indexSize {
+		return ErrInvalidFile
+	}
+	value := make([]byte, valueLen)
+	if _, err := s.src.ReadAt(value, int64(s.indexOffset+6+keyLen)); err != nil {
+		return err
+	}
+	_, format, err := parseIndexValue(value)
+	if err != nil {
+		return err
+	}
+	s.blockHeaders = format == blockFormatHeader || format == blockFormatVersions
+	s.versioned = format == blockFormatVersions
+	return nil
+}
+
+// parseIndexValue parses the offset, size and newest seq of a block and the
+// block format of the table, 0 if the entry has none
+func parseIndexValue(value []byte) (entry IndexEntry, format uint64, err error) {
+	offset, n := binary.Uvarint(value)
+	if n <= 0 {
+		return entry, 0, fmt.Errorf("failed to read offset from value")
+	}
+	size, m := binary.Uvarint(value[n:])
+	if m <= 0 {
+		return entry, 0, fmt.Errorf("failed to read size from value")
+	}
+	entry.PrevOffset, entry.PrevSize = offset, size
+	value = value[n+m:]
+	if len(value) > 0 {
+		if format, n = binary.Uvarint(value); format == 0 {
+			return entry, 0, fmt.Errorf("failed to read block format from value")
+		}
+		value = value[n:]
+	}
+	if format == blockFormatVersions {
+		if entry.MaxSeq, n = binary.Uvarint(value); n <= 0 {
+			return entry, 0, fmt.Errorf("failed to read seq from value")
+		}
+	}
+	return entry, format, nil
+}
+
+// Versioned reports whether the values of the table are version lists
+func (s *SSTableReader) Versioned() bool {
+	return s.versioned
+}
+
+// Mapped reports whether blocks are read from a mapping of the file
+func (s *SSTableReader) Mapped() bool {
+	return s.data != nil
+}
+
 // ReadIndex read index block to memory
 func (s *SSTableReader) ReadIndex() ([]*IndexEntry, error) {
 	// Reader footer first
@@ -118,23 +225,13 @@ func (s *SSTableReader) ReadIndex() ([]*IndexEntry, error) {
 		value := indexBlock[pos : pos+uint64(valueLen)]
 		pos += uint64(valueLen)
 
-		// Parse offset and size from value using varint
-		offset, n := binary.Uvarint(value[0:])
-		// fmt.Println("offset: ", offset)
-		if n <= 0 {
-			return nil, fmt.Errorf("failed to read offset from value")
-		}
-		size, m := binary.Uvarint(value[n:])
-		// fmt.Println("size: ", size)
-		if m <= 0 {
-			return nil, fmt.Errorf("failed to read size from value")
+		// Parse offset, size and seq from value using varint
+		entry, _, err := parseIndexValue(value)
+		if err != nil {
+			return nil, err
 		}
-
-		indexEntries = append(indexEntries, &IndexEntry{
-			Key:        key,
-			PrevOffset: offset,
-			PrevSize:   size,
-		})
+		entry.Key = key
+		indexEntries = append(indexEntries, &entry)
 	}
 
 	return indexEntries, nil
@@ -175,16 +272,18 @@ func (s *SSTableReader) ReadFilter() (map[uint64][]byte, error) {
 }
 
 func (s *SSTableReader) Close() error {
-	s.reader.Reset(s.src)
+	if s.data != nil {
+		if err := syscall.Munmap(s.data); err != nil {
+			s.src.Close()
+			return err
+		}
+		s.data = nil
+	}
 	return s.src.Close()
 }
 
 func (s *SSTableReader) Size() (uint64, error) {
-	stat, err := s.src.Stat()
-	if err != nil {
-		return 0, err
-	}
-	return uint64(stat.Size()), nil
+	return uint64(s.size), nil
 }
 
 func (s *SSTableReader) ReadRecord(prevKey []byte, buf *bytes.Buffer) ([]byte, []byte, error) {
@@ -211,7 +310,14 @@ func (s *SSTableReader) ReadRecord(prevKey []byte, buf *bytes.Buffer) ([]byte, [
 	return key, value, nil
 }
 
+// ParseDataBlock decompresses a data block and returns its records
 func (s *SSTableReader) ParseDataBlock(block []byte) ([]*KV, error) {
+	if s.blockHeaders {
+		var err error
+		if block, err = decompressBlock(block); err != nil {
+			return nil, err
+		}
+	}
 	var data []*KV
 	var prevKey []byte
 	buf := bytes.NewBuffer(block)
@@ -240,6 +346,30 @@ func (s *SSTableReader) ReadData() ([]*KV, error) {
 		}
 	}
 
+	if s.blockHeaders {
+		// blocks are compressed one by one
+		index, err := s.ReadIndex()
+		if err != nil {
+			return nil, err
+		}
+		var data []*KV
+		for _, entry := range index {
+			if entry.PrevSize == 0 {
+				continue
+			}
+			block, err := s.ReadBlock(entry.PrevOffset, entry.PrevSize)
+			if err != nil {
+				return nil, err
+			}
+			kvs, err := s.ParseDataBlock(block)
+			if err != nil {
+				return nil, err
+			}
+			data = append(data, kvs...)
+		}
+		return data, nil
+	}
+
 	// fetch data block from disk
 	dataBlock, err := s.ReadBlock(0, s.filterOffset)
 	if err != nil {
@@ -251,14 +381,9 @@ func (s *SSTableReader) ReadData() ([]*KV, error) {
 }
 
 func (s *SSTableReader) ReadFooter() error {
-	// find the footer position
-	if _, err := s.src.Seek(-int64(s.conf.SSTFooterSize), io.SeekEnd); err != nil {
-		return err
-	}
-
 	// read footer
-	footer := make([]byte, s.conf.SSTFooterSize)
-	if _, err := s.src.Read(footer); err != nil {
+	footer := make([]byte, s.conf.Storage.SSTFooterSize)
+	if _, err := s.src.ReadAt(footer, s.size-int64(s.conf.Storage.SSTFooterSize)); err != nil {
 		return err
 	}
 
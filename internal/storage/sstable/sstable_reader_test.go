@@ -78,7 +78,7 @@ func TestSSTableReader_InvalidFile(t *testing.T) {
 
 	// Test with empty file
 	emptyFile := "empty.sst"
-	_, err = os.Create(path.Join(tmpDir, emptyFile))
+	_, err = os.Create(path.Join(conf.SSTDir(), emptyFile))
 	assert.NoError(t, err)
 
 	_, err = NewSSTableReader(emptyFile, conf)
@@ -104,3 +104,32 @@ func TestSSTableReader_ReadFilter(t *testing.T) {
 	assert.NoError(t, err)
 	assert.NotEmpty(t, filters)
 }
+
+func TestSSTableReader_Mmap(t *testing.T) {
+	tmpDir := t.TempDir()
+	conf, err := config.NewConfig(tmpDir)
+	assert.NoError(t, err)
+	fileName := createTestSSTable(t, conf)
+
+	plain, err := NewSSTableReader(fileName, conf)
+	assert.NoError(t, err)
+	defer plain.Close()
+	assert.False(t, plain.Mapped())
+
+	conf.Storage.MmapReads = true
+	mapped, err := NewSSTableReader(fileName, conf)
+	assert.NoError(t, err)
+	assert.True(t, mapped.Mapped())
+
+	// both modes read the same blocks
+	expected, err := plain.ReadData()
+	assert.NoError(t, err)
+	data, err := mapped.ReadData()
+	assert.NoError(t, err)
+	assert.Equal(t, expected, data)
+	assert.Len(t, data, 5)
+
+	_, err = mapped.ReadBlock(0, 1<<20)
+	assert.Error(t, err)
+	assert.NoError(t, mapped.Close())
+}
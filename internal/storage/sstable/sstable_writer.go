@@ -4,7 +4,9 @@ import (
 	"bufio"
 	"bytes"
 	"encoding/binary"
+	"fmt"
 	"oasisdb/internal/config"
+	"oasisdb/internal/storage/memtable"
 	"oasisdb/pkg/logger"
 	"oasisdb/pkg/utils"
 	"os"
@@ -15,6 +17,7 @@ type IndexEntry struct {
 	Key        []byte
 	PrevOffset uint64
 	PrevSize   uint64
+	MaxSeq     uint64 // newest seq up to the block, 0 for tables without versions
 }
 
 type SSTableWriter struct {
@@ -24,7 +27,8 @@ type SSTableWriter struct {
 	filterBuf     *bytes.Buffer     // filter block buffer
 	indexBuf      *bytes.Buffer     // index block buffer
 	blockToFilter map[uint64][]byte // block offset to filter
-	assistBuf     [20]byte          // assist buffer
+	assistBuf     [40]byte          // assist buffer, fits four uvarints
+	codec         Codec             // compression of data blocks
 	indexEntries  []*IndexEntry
 
 	dataBlock   *Block
@@ -35,16 +39,25 @@ type SSTableWriter struct {
 	prevKey         []byte
 	prevBlockOffset uint64
 	prevBlockSize   uint64
+	unindexed       bool // the previous block has no index entry yet
+
+	versioned bool   // values are version lists
+	maxSeq    uint64 // newest seq appended so far
 }
 
 func NewSSTableWriter(file string, conf *config.Config) (*SSTableWriter, error) {
-	dest, err := os.OpenFile(path.Join(conf.Dir, file), os.O_CREATE|os.O_WRONLY, 0644)
+	codec, err := ParseCodec(conf.Storage.Compression)
+	if err != nil {
+		return nil, err
+	}
+	dest, err := os.OpenFile(path.Join(conf.SSTDir(), file), os.O_CREATE|os.O_WRONLY, 0644)
 	if err != nil {
 		return nil, err
 	}
 
 	return &SSTableWriter{
 		conf:            conf,
+		codec:           codec,
 		dest:            dest,
 		writer:          bufio.NewWriter(dest),
 		dataBuf:         bytes.NewBuffer(nil),
@@ -61,8 +74,27 @@ func NewSSTableWriter(file string, conf *config.Config) (*SSTableWriter, error)
 	}, nil
 }
 
+// NewVersionedSSTableWriter returns a writer of a table whose values are
+// version lists encoded by memtable.EncodeVersions
+func NewVersionedSSTableWriter(file string, conf *config.Config) (*SSTableWriter, error) {
+	s, err := NewSSTableWriter(file, conf)
+	if err != nil {
+		return nil, err
+	}
+	s.versioned = true
+	return s, nil
+}
+
 // Append a key-value pair to the block
 func (s *SSTableWriter) Append(key, value []byte) error {
+	if s.versioned {
+		seq, err := memtable.NewestSeq(value)
+		if err != nil {
+			return fmt.Errorf("value of key %q: %w", key, err)
+		}
+		s.maxSeq = max(s.maxSeq, seq)
+	}
+
 	// If open a new data block, insert index first
 	if s.dataBlock.entriesCnt == 0 {
 		if err := s.writeIndex(key); err != nil {
@@ -80,7 +112,7 @@ func (s *SSTableWriter) Append(key, value []byte) error {
 	s.prevKey = key
 
 	// if dataBlock size is greater than SSTDataBlockSize, refresh block
-	if s.dataBlock.Size() >= s.conf.SSTDataBlockSize {
+	if s.dataBlock.Size() >= s.conf.Storage.SSTDataBlockSize {
 		if err := s.refreshBlock(); err != nil {
 			return err
 		}
@@ -92,11 +124,17 @@ func (s *SSTableWriter) Append(key, value []byte) error {
 func (s *SSTableWriter) writeIndex(key []byte) error {
 	logger.Debug("Writing index", "prev_key", string(s.prevKey), "key", string(key))
 	indexKey := utils.GetSeparatorBetween(s.prevKey, key)
-	// Using assistBuf to store offset and size
+	// Using assistBuf to store offset, size, block format and newest seq
 	n := binary.PutUvarint(s.assistBuf[0:], s.prevBlockOffset)
 	n += binary.PutUvarint(s.assistBuf[n:], s.prevBlockSize)
+	if s.versioned {
+		n += binary.PutUvarint(s.assistBuf[n:], blockFormatVersions)
+		n += binary.PutUvarint(s.assistBuf[n:], s.maxSeq)
+	} else {
+		n += binary.PutUvarint(s.assistBuf[n:], blockFormatHeader)
+	}
 
-	// { key: indexKey value: offset and size }
+	// { key: indexKey value: offset, size and block format }
 	if err := s.indexBlock.Append(indexKey, s.assistBuf[:n]); err != nil {
 		return err
 	}
@@ -105,7 +143,9 @@ func (s *SSTableWriter) writeIndex(key []byte) error {
 		Key:        indexKey,
 		PrevOffset: s.prevBlockOffset,
 		PrevSize:   s.prevBlockSize,
+		MaxSeq:     s.maxSeq,
 	})
+	s.unindexed = false
 
 	return nil
 }
@@ -117,7 +157,12 @@ func (s *SSTableWriter) Finish() (uint64, map[uint64][]byte, []*IndexEntry, erro
 		if err := s.refreshBlock(); err != nil {
 			return 0, nil, nil, err
 		}
-		s.writeIndex(s.prevKey)
+	}
+	// including a last block that was flushed when it filled up
+	if s.unindexed {
+		if err := s.writeIndex(s.prevKey); err != nil {
+			return 0, nil, nil, err
+		}
 	}
 
 	// 2. Write bloom filter block
@@ -133,7 +178,7 @@ func (s *SSTableWriter) Finish() (uint64, map[uint64][]byte, []*IndexEntry, erro
 	}
 
 	// 4. Create and write footer
-	footer := make([]byte, s.conf.SSTFooterSize)
+	footer := make([]byte, s.conf.Storage.SSTFooterSize)
 	filterOffset := s.Size()
 	indexOffset := filterOffset + uint64(filterSize)
 
@@ -185,12 +230,16 @@ func (s *SSTableWriter) refreshBlock() error {
 	// reset bloom filter
 	s.conf.Filter.Reset()
 
-	// flush data block, all data blocks are contiguous
-	var err error
-	s.prevBlockSize, err = s.dataBlock.FlushTo(s.dataBuf)
+	// flush data block with its codec byte, all data blocks are contiguous
+	block, err := compressBlock(s.codec, s.conf.Storage.CompressionLevel, s.dataBlock.record.Bytes())
 	if err != nil {
 		return err
 	}
+	if _, err := s.dataBuf.Write(block); err != nil {
+		return err
+	}
+	s.prevBlockSize = uint64(len(block))
+	s.unindexed = true
 
 	// Reset the data block for next use
 	s.dataBlock = NewBlock()
@@ -44,7 +44,7 @@ func TestSSTableWriter_Basic(t *testing.T) {
 	assert.NoError(t, err)
 
 	// Verify file exists
-	_, err = os.Stat(path.Join(tmpDir, "test.sst"))
+	_, err = os.Stat(path.Join(conf.SSTDir(), "test.sst"))
 	assert.NoError(t, err)
 }
 
@@ -68,11 +68,11 @@ func TestSSTableWriter_BlockRefresh(t *testing.T) {
 	assert.NoError(t, err)
 
 	// Read and verify the file structure
-	data, err := os.ReadFile(path.Join(tmpDir, "test.sst"))
+	data, err := os.ReadFile(path.Join(conf.SSTDir(), "test.sst"))
 	assert.NoError(t, err)
 
 	// Read footer
-	footerStart := len(data) - int(conf.SSTFooterSize)
+	footerStart := len(data) - int(conf.Storage.SSTFooterSize)
 	footer := data[footerStart:]
 
 	// Verify footer format
@@ -99,7 +99,7 @@ func TestSSTableWriter_EmptyWrite(t *testing.T) {
 	assert.NoError(t, err)
 
 	// Verify file exists and has at least footer size
-	info, err := os.Stat(path.Join(tmpDir, "empty.sst"))
+	info, err := os.Stat(path.Join(conf.SSTDir(), "empty.sst"))
 	assert.NoError(t, err)
-	assert.GreaterOrEqual(t, info.Size(), int64(conf.SSTFooterSize)) // Footer size
+	assert.GreaterOrEqual(t, info.Size(), int64(conf.Storage.SSTFooterSize)) // Footer size
 }
@@ -0,0 +1,125 @@
+package sstable
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io/fs"
+	"oasisdb/internal/config"
+	"oasisdb/internal/tier"
+	"os"
+	"path"
+)
+
+// RemoteSuffix is appended to the name of a table moved to the cold tier for
+// the local file keeping its tail: the filter and index blocks and the
+// footer, so loading the table and lookups the filters rule out don't fetch
+// it
+const RemoteSuffix = ".remote"
+
+// RemoteKey returns the object key of a table in the cold tier
+func RemoteKey(file string) string {
+	return "sst/" + file
+}
+
+// Offload uploads a table to the cold tier and writes its tail next to it,
+// the caller removes the table once no reader uses it
+func Offload(file string, conf *config.Config) error {
+	if conf.ColdTier == nil {
+		return errors.New("no cold tier configured")
+	}
+	name := path.Join(conf.SSTDir(), file)
+	data, err := os.Open(name)
+	if err != nil {
+		return err
+	}
+	defer data.Close()
+	stat, err := data.Stat()
+	if err != nil {
+		return err
+	}
+	footerSize := int64(conf.Storage.SSTFooterSize)
+	if stat.Size() < footerSize {
+		return ErrInvalidFile
+	}
+	footer := make([]byte, footerSize)
+	if _, err := data.ReadAt(footer, stat.Size()-footerSize); err != nil {
+		return err
+	}
+	filterOffset := int64(binary.LittleEndian.Uint64(footer[0:8]))
+	if filterOffset > stat.Size()-footerSize {
+		return ErrInvalidFile
+	}
+	tail := make([]byte, stat.Size()-filterOffset)
+	if _, err := data.ReadAt(tail, filterOffset); err != nil {
+		return err
+	}
+
+	if err := conf.ColdTier.Upload(RemoteKey(file), name); err != nil {
+		return fmt.Errorf("failed to upload %s: %w", file, err)
+	}
+
+	// the tail is only written once the table is in the tier
+	tmp := name + RemoteSuffix + ".tmp"
+	out, err := os.Create(tmp)
+	if err != nil {
+		return err
+	}
+	var size [8]byte
+	binary.LittleEndian.PutUint64(size[:], uint64(stat.Size()))
+	if _, err := out.Write(size[:]); err != nil {
+		out.Close()
+		return err
+	}
+	if _, err := out.Write(tail); err != nil {
+		out.Close()
+		return err
+	}
+	if err := out.Sync(); err != nil {
+		out.Close()
+		return err
+	}
+	if err := out.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmp, name+RemoteSuffix)
+}
+
+// RemoveRemote deletes a table from the cold tier and its local tail, a
+// table that was never moved there is left alone
+func RemoveRemote(file string, conf *config.Config) error {
+	tail := path.Join(conf.SSTDir(), file+RemoteSuffix)
+	if _, err := os.Stat(tail); err != nil {
+		if os.IsNotExist(err) {
+			return nil
+		}
+		return err
+	}
+	if conf.ColdTier != nil {
+		if err := conf.ColdTier.Delete(RemoteKey(file)); err != nil {
+			return err
+		}
+	}
+	return os.Remove(tail)
+}
+
+// openRemote opens a table of the cold tier from its local tail, which starts
+// with the size of the table
+func openRemote(file string, conf *config.Config) (*tier.Object, error) {
+	tail, err := os.ReadFile(path.Join(conf.SSTDir(), file+RemoteSuffix))
+	if os.IsNotExist(err) {
+		// neither local nor in the tier
+		return nil, &fs.PathError{Op: "open", Path: path.Join(conf.SSTDir(), file), Err: fs.ErrNotExist}
+	}
+	if err != nil {
+		return nil, err
+	}
+	if len(tail) < 8 {
+		return nil, ErrInvalidFile
+	}
+	size := int64(binary.LittleEndian.Uint64(tail))
+	if size < int64(len(tail)-8) {
+		return nil, ErrInvalidFile
+	}
+	return conf.ColdTier.Open(RemoteKey(file), size, tail[8:]), nil
+}
@@ -1,6 +1,8 @@
 package storage
 
 import (
+	"sync"
+
 	"oasisdb/internal/config"
 	"oasisdb/internal/storage/tree"
 	"oasisdb/pkg/errors"
@@ -10,7 +12,32 @@ type ScalarStorage interface {
 	PutScalar(key []byte, value []byte) error
 	BatchPutScalar(keys [][]byte, values [][]byte) error
 	GetScalar(key []byte) ([]byte, bool, error)
+	// GetScalarAt returns the value of key as of the seq of a snapshot that
+	// is still pinned
+	GetScalarAt(key []byte, seq uint64) ([]byte, bool, error)
+	// Snapshot pins the current state of all keys, reads through it don't
+	// see later writes until it is released
+	Snapshot() *Snapshot
 	DeleteScalar(key []byte) error
+	// ScanScalar calls fn with the keys in [start, end) and their values in
+	// key order until fn returns false, nil end means no upper bound
+	ScanScalar(start, end []byte, fn func(key, value []byte) bool) error
+	// Warmup reads the stored tables into the page cache, returning the
+	// number of files and bytes read
+	Warmup() (files int, bytes int64, err error)
+	// ApproximateSize returns the bytes stored on disk for keys in
+	// [start, end), nil end means no upper bound
+	ApproximateSize(start, end []byte) int64
+	// Compact queues the compaction of a level into the next one, a negative
+	// level queues every level
+	Compact(level int) error
+	CompactionStatus() tree.CompactionStatus
+	// ObserveCompactionQueue calls observer with the number of queued
+	// compactions every time it changes
+	ObserveCompactionQueue(observer func(depth int))
+	// WriteState tells whether writes are slowed down or stopped until
+	// compaction catches up
+	WriteState() tree.WriteState
 	Stop()
 }
 
@@ -18,6 +45,35 @@ type Storage struct {
 	lsmTree *tree.LSMTree
 }
 
+// Snapshot is a consistent view of the scalar storage. The versions it reads
+// are kept until Release, so long-lived snapshots hold on to disk space
+type Snapshot struct {
+	tree *tree.LSMTree
+	seq  uint64
+	once sync.Once
+}
+
+// Seq returns the seq of the newest write the snapshot sees
+func (s *Snapshot) Seq() uint64 {
+	return s.seq
+}
+
+// GetScalar returns the value of key when the snapshot was taken
+func (s *Snapshot) GetScalar(key []byte) ([]byte, bool, error) {
+	return s.tree.GetAt(key, s.seq)
+}
+
+// ScanScalar calls fn with the keys in [start, end) and their values when the
+// snapshot was taken, see ScalarStorage
+func (s *Snapshot) ScanScalar(start, end []byte, fn func(key, value []byte) bool) error {
+	return s.tree.ScanAt(start, end, s.seq, fn)
+}
+
+// Release unpins the snapshot, it may be called more than once
+func (s *Snapshot) Release() {
+	s.once.Do(func() { s.tree.ReleaseSnapshot(s.seq) })
+}
+
 func NewStorage(conf *config.Config) (*Storage, error) {
 	lsmTree, err := tree.NewLSMTree(conf)
 	if err != nil {
@@ -27,6 +83,9 @@ func NewStorage(conf *config.Config) (*Storage, error) {
 }
 
 func (s *Storage) PutScalar(key []byte, value []byte) error {
+	if err := s.lsmTree.Throttle(); err != nil {
+		return err
+	}
 	return s.lsmTree.Put(key, value)
 }
 
@@ -34,20 +93,62 @@ func (s *Storage) GetScalar(key []byte) ([]byte, bool, error) {
 	return s.lsmTree.Get(key)
 }
 
+func (s *Storage) GetScalarAt(key []byte, seq uint64) ([]byte, bool, error) {
+	return s.lsmTree.GetAt(key, seq)
+}
+
+func (s *Storage) Snapshot() *Snapshot {
+	return &Snapshot{tree: s.lsmTree, seq: s.lsmTree.Snapshot()}
+}
+
 func (s *Storage) DeleteScalar(key []byte) error {
+	if err := s.lsmTree.Throttle(); err != nil {
+		return err
+	}
 	return s.lsmTree.Put(key, nil)
 }
 
+func (s *Storage) ScanScalar(start, end []byte, fn func(key, value []byte) bool) error {
+	return s.lsmTree.Scan(start, end, fn)
+}
+
 func (s *Storage) BatchPutScalar(keys [][]byte, values [][]byte) error {
 	if len(keys) != len(values) {
 		return errors.ErrMisMatchKeysAndValues
 	}
-	for i := range keys {
-		if err := s.lsmTree.Put(keys[i], values[i]); err != nil {
-			return err
-		}
+	// a batch is throttled as a whole, so it isn't left half written
+	if err := s.lsmTree.Throttle(); err != nil {
+		return err
+	}
+	return s.lsmTree.PutBatch(keys, values)
+}
+
+func (s *Storage) Warmup() (files int, bytes int64, err error) {
+	return s.lsmTree.Warmup()
+}
+
+func (s *Storage) ApproximateSize(start, end []byte) int64 {
+	return s.lsmTree.ApproximateSize(start, end)
+}
+
+func (s *Storage) Compact(level int) error {
+	if level < 0 {
+		s.lsmTree.CompactAll()
+		return nil
 	}
-	return nil
+	return s.lsmTree.Compact(level)
+}
+
+func (s *Storage) CompactionStatus() tree.CompactionStatus {
+	return s.lsmTree.CompactionStatus()
+}
+
+func (s *Storage) ObserveCompactionQueue(observer func(depth int)) {
+	s.lsmTree.ObserveCompactionQueue(observer)
+}
+
+func (s *Storage) WriteState() tree.WriteState {
+	return s.lsmTree.WriteState()
 }
 
 func (s *Storage) Stop() {
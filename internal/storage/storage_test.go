@@ -57,3 +57,36 @@ func TestStorageBatchPutScalarRejectsMismatchedLengths(t *testing.T) {
 	)
 	assert.ErrorIs(t, err, pkgerrors.ErrMisMatchKeysAndValues)
 }
+
+func TestStorageSnapshot(t *testing.T) {
+	conf, err := config.NewConfig(t.TempDir())
+	require.NoError(t, err)
+
+	storage, err := NewStorage(conf)
+	require.NoError(t, err)
+	t.Cleanup(storage.Stop)
+
+	require.NoError(t, storage.PutScalar([]byte("alpha"), []byte("one")))
+	snapshot := storage.Snapshot()
+	defer snapshot.Release()
+	require.NoError(t, storage.PutScalar([]byte("alpha"), []byte("two")))
+	require.NoError(t, storage.PutScalar([]byte("beta"), []byte("new")))
+
+	value, exists, err := snapshot.GetScalar([]byte("alpha"))
+	require.NoError(t, err)
+	assert.True(t, exists)
+	assert.Equal(t, []byte("one"), value)
+	_, exists, err = snapshot.GetScalar([]byte("beta"))
+	require.NoError(t, err)
+	assert.False(t, exists)
+
+	value, _, err = storage.GetScalarAt([]byte("alpha"), snapshot.Seq())
+	require.NoError(t, err)
+	assert.Equal(t, []byte("one"), value)
+	value, _, err = storage.GetScalar([]byte("alpha"))
+	require.NoError(t, err)
+	assert.Equal(t, []byte("two"), value)
+
+	snapshot.Release()
+	snapshot.Release()
+}
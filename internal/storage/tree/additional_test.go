@@ -17,20 +17,19 @@ import (
 
 func newBareTree(conf *config.Config) *LSMTree {
 	return &LSMTree{
-		conf:           conf,
-		memTable:       conf.MemTableConstructor(),
-		nodes:          make([][]*Node, conf.MaxLevel),
-		levelLocks:     make([]sync.RWMutex, conf.MaxLevel),
-		memCompactCh:   make(chan *memTableCompactItem, 4),
-		levelCompactCh: make(chan int, 4),
-		levelToSeq:     make([]atomic.Int32, conf.MaxLevel),
+		conf:       conf,
+		memTable:   conf.MemTableConstructor(),
+		nodes:      make([][]*Node, conf.Storage.MaxLevel),
+		levelLocks: make([]sync.RWMutex, conf.Storage.MaxLevel),
+		queue:      newCompactQueue(),
+		levelToSeq: make([]atomic.Int32, conf.Storage.MaxLevel),
 	}
 }
 
 func writeTestWAL(t *testing.T, conf *config.Config, name string, entries map[string]string) {
 	t.Helper()
 
-	writer, err := wal.NewWALWriter(path.Join(conf.Dir, "walfile", "memtable", name))
+	writer, err := wal.NewWALWriter(path.Join(conf.MemTableWALDir(), name))
 	require.NoError(t, err)
 	defer writer.Close()
 
@@ -42,7 +41,7 @@ func writeTestWAL(t *testing.T, conf *config.Config, name string, entries map[st
 func writeTestSSTable(t *testing.T, conf *config.Config, name string, entries [][2]string) {
 	t.Helper()
 
-	writer, err := sstable.NewSSTableWriter(path.Join("sstfile", name), conf)
+	writer, err := sstable.NewSSTableWriter(name, conf)
 	require.NoError(t, err)
 	defer writer.Close()
 
@@ -87,12 +86,10 @@ func TestConstructMemTablesRestoresLatestWalAsActive(t *testing.T) {
 	assert.True(t, exists)
 	assert.Equal(t, []byte("value-2"), value)
 
-	select {
-	case item := <-tree.memCompactCh:
-		assert.Equal(t, "2.wal", path.Base(item.walFile))
-	default:
-		t.Fatal("expected restored readonly memtable to be queued for compaction")
-	}
+	assert.Equal(t, "2.wal", path.Base(tree.rOnlyMemTables[0].walFile))
+	task, ok := tree.queue.pop()
+	require.True(t, ok, "expected restored readonly memtable to be queued for compaction")
+	assert.Equal(t, flushTask, task)
 }
 
 func TestConstructTreeLoadsSSTablesFromSSTDirectory(t *testing.T) {
@@ -102,7 +99,7 @@ func TestConstructTreeLoadsSSTablesFromSSTDirectory(t *testing.T) {
 	writeTestSSTable(t, conf, "1_2.sst", [][2]string{{"m", "13"}, {"z", "26"}})
 	writeTestSSTable(t, conf, "0_3.sst", [][2]string{{"c", "3"}, {"d", "4"}})
 	writeTestSSTable(t, conf, "0_1.sst", [][2]string{{"a", "1"}, {"b", "2"}})
-	require.NoError(t, os.WriteFile(path.Join(conf.Dir, "sstfile", "ignore.txt"), []byte("skip"), 0644))
+	require.NoError(t, os.WriteFile(path.Join(conf.SSTDir(), "ignore.txt"), []byte("skip"), 0644))
 
 	tree := newBareTree(conf)
 	t.Cleanup(func() { closeTreeNodes(tree) })
@@ -147,7 +144,7 @@ func TestNodeAccessorsAndCompactMemTable(t *testing.T) {
 
 	writeTestSSTable(t, conf, "accessor.sst", [][2]string{{"a", "1"}, {"b", "2"}})
 
-	reader, err := sstable.NewSSTableReader(path.Join("sstfile", "accessor.sst"), conf)
+	reader, err := sstable.NewSSTableReader("accessor.sst", conf)
 	require.NoError(t, err)
 
 	filters, err := reader.ReadFilter()
@@ -158,7 +155,7 @@ func TestNodeAccessorsAndCompactMemTable(t *testing.T) {
 	require.NoError(t, err)
 
 	node := NewNode(conf,
-		WithFile(path.Join("sstfile", "accessor.sst")),
+		WithFile("accessor.sst"),
 		WithLevel(2),
 		WithSeq(7),
 		WithSize(size),
@@ -190,10 +187,10 @@ func TestNodeAccessorsAndCompactMemTable(t *testing.T) {
 	t.Cleanup(func() { closeTreeNodes(tree) })
 
 	memTable := conf.MemTableConstructor()
-	require.NoError(t, memTable.Put([]byte("k1"), []byte("v1")))
-	require.NoError(t, memTable.Put([]byte("k2"), []byte("v2")))
+	require.NoError(t, memTable.Put([]byte("k1"), []byte("v1"), 1, 1))
+	require.NoError(t, memTable.Put([]byte("k2"), []byte("v2"), 2, 2))
 
-	walFile := path.Join(conf.Dir, "walfile", "memtable", "99.wal")
+	walFile := path.Join(conf.MemTableWALDir(), "99.wal")
 	writer, err := wal.NewWALWriter(walFile)
 	require.NoError(t, err)
 	writer.Close()
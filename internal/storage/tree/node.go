@@ -3,8 +3,12 @@ package tree
 import (
 	"bytes"
 	"errors"
+	"fmt"
+	"math"
 	"oasisdb/internal/config"
+	"oasisdb/internal/storage/memtable"
 	"oasisdb/internal/storage/sstable"
+	"oasisdb/pkg/logger"
 	"os"
 	"path"
 )
@@ -14,7 +18,7 @@ type NodeOption func(*Node)
 // Node in LSM Tree equals a sstable
 type Node struct {
 	conf          *config.Config
-	file          string            // file name of sstable
+	file          string            // file name of sstable in conf.SSTDir()
 	level         int               // level of sstable
 	seq           int32             // seq of sstable
 	size          uint64            // size of sstable
@@ -189,7 +193,10 @@ func (n *Node) Index() (level int, seq int32) {
 
 func (n *Node) Destroy() {
 	n.sstReader.Close()
-	_ = os.Remove(path.Join(n.conf.Dir, n.file))
+	_ = os.Remove(path.Join(n.conf.SSTDir(), n.file))
+	if err := sstable.RemoveRemote(n.file, n.conf); err != nil {
+		logger.Warn("Failed to remove SSTable from the tier", "sst_file", n.file, "error", err)
+	}
 }
 
 func (n *Node) Close() {
@@ -203,9 +210,34 @@ func (n *Node) mayContain(indexEntry *sstable.IndexEntry, key []byte) bool {
 }
 
 func (n *Node) Get(key []byte) ([]byte, bool, error) {
+	return n.GetAt(key, math.MaxUint64)
+}
+
+// GetAt returns the newest version of key written at or before seq
+func (n *Node) GetAt(key []byte, seq uint64) ([]byte, bool, error) {
+	versions, ok, err := n.versions(key)
+	if err != nil || !ok {
+		return nil, false, err
+	}
+	v, ok := memtable.VisibleAt(versions, seq)
+	if !ok {
+		return nil, false, nil
+	}
+	// a mapped block is gone once the node is destroyed
+	if n.sstReader.Mapped() {
+		return bytes.Clone(v.Value), true, nil
+	}
+	return v.Value, true, nil
+}
+
+// versions returns the versions of key newest first, a table written before
+// seqs holds one version with seq 0
+func (n *Node) versions(key []byte) ([]memtable.Version, bool, error) {
 	// 1. search index block by binary search
 	indexEntry, ok := n.binarySearchIndex(key, 0, len(n.indexEntries)-1)
-	if !ok {
+	if !ok || indexEntry.PrevSize == 0 {
+		// the first index entry of a table has no block, keys before the
+		// table end up on it
 		return nil, false, nil
 	}
 
@@ -228,17 +260,56 @@ func (n *Node) Get(key []byte) ([]byte, bool, error) {
 
 	// 5. find the key
 	for _, kv := range data {
-		if bytes.Equal(kv.Key, key) {
-			return kv.Value, true, nil
+		if !bytes.Equal(kv.Key, key) {
+			continue
+		}
+		if !n.sstReader.Versioned() {
+			return []memtable.Version{{Value: kv.Value}}, true, nil
 		}
+		versions, err := memtable.DecodeVersions(kv.Value)
+		if err != nil {
+			return nil, false, fmt.Errorf("%s: key %q: %w", n.file, key, err)
+		}
+		return versions, true, nil
 	}
 	return nil, false, nil
 }
 
+// MaxSeq returns the newest seq written to the node, 0 for tables written
+// before seqs
+func (n *Node) MaxSeq() uint64 {
+	return n.indexEntries[len(n.indexEntries)-1].MaxSeq
+}
+
 func (n *Node) GetAll() ([]*sstable.KV, error) {
 	return n.sstReader.ReadData()
 }
 
+// Iterator streams all kv data of the node in key order, values are version
+// lists, see memtable.EncodeVersions
+func (n *Node) Iterator() sstable.Iterator {
+	return n.IteratorFrom(nil)
+}
+
+// IteratorFrom streams the kv data of the node like Iterator, skipping the
+// blocks before start. Keys before start may still be returned
+func (n *Node) IteratorFrom(start []byte) sstable.Iterator {
+	if n.sstReader.Versioned() {
+		return n.sstReader.NewIteratorFrom(start)
+	}
+	return &versionsIterator{Iterator: n.sstReader.NewIteratorFrom(start)}
+}
+
+// versionsIterator returns the values of a table written before seqs as
+// lists of one version with seq 0
+type versionsIterator struct {
+	sstable.Iterator
+}
+
+func (it *versionsIterator) Value() []byte {
+	return memtable.EncodeVersions([]memtable.Version{{Value: it.Iterator.Value()}})
+}
+
 func (n *Node) binarySearchIndex(key []byte, start, end int) (*sstable.IndexEntry, bool) {
 	if start == end {
 		return n.indexEntries[start], bytes.Compare(n.indexEntries[start].Key, key) >= 0
@@ -3,83 +3,162 @@ package tree
 import (
 	"bytes"
 	"fmt"
+	"io"
+	"math"
 	"oasisdb/internal/config"
 	"oasisdb/internal/storage/memtable"
 	"oasisdb/internal/storage/wal"
 	"oasisdb/pkg/logger"
+	"os"
 	"path"
 	"strconv"
 	"strings"
 	"sync"
 	"sync/atomic"
+	"time"
 )
 
 // LSM Tree Engine
 type LSMTree struct {
 	conf           *config.Config
 	dataLock       sync.RWMutex
-	memTable       memtable.MemTable         // memtable
-	rOnlyMemTables []*memTableCompactItem    // read only memtables
-	walWriter      *wal.WALWriter            // WAL writer, using in memTable Put
-	nodes          [][]*Node                 // tree data structure
-	levelLocks     []sync.RWMutex            // locks used in every level
-	memCompactCh   chan *memTableCompactItem // when memtable size reach the limit, trigger compaction
-	levelCompactCh chan int                  // when sst file size of one layer reach the limit, trigger compaction
-	stopCh         chan struct{}             // stop all jobs
-	memTableIndex  int                       // memtable index , correspond to wal files
+	memTable       memtable.MemTable      // memtable
+	rOnlyMemTables []*memTableCompactItem // read only memtables
+	walWriter      *wal.WALWriter         // WAL writer, using in memTable Put
+	nodes          [][]*Node              // tree data structure
+	levelLocks     []sync.RWMutex         // locks used in every level
+	queue          *compactQueue          // flushes and level compactions for the compaction goroutine
+	stopCh         chan struct{}          // stop all jobs
+	compactDone    chan struct{}          // closed once the compaction goroutine returned
+	memTableIndex  int                    // memtable index , correspond to wal files
 	levelToSeq     []atomic.Int32
+	seq            uint64         // seq of the newest write, guarded by dataLock
+	snapshotLock   sync.Mutex     // guards snapshots
+	snapshots      map[uint64]int // seqs pinned by snapshots to their counts
+	stats          compactionStats
+	stalls         writeStalls
+	syncer         *walSyncer // nil if the WAL is left to the OS
 }
 
 func NewLSMTree(conf *config.Config) (*LSMTree, error) {
 	// 1. build LSM Tree
 	t := &LSMTree{
-		conf:           conf,
-		stopCh:         make(chan struct{}),
-		memTableIndex:  0,
-		levelToSeq:     make([]atomic.Int32, conf.MaxLevel),
-		nodes:          make([][]*Node, conf.MaxLevel),
-		levelLocks:     make([]sync.RWMutex, conf.MaxLevel),
-		memCompactCh:   make(chan *memTableCompactItem, 1),
-		levelCompactCh: make(chan int, 1),
-	}
-	// 2. Read sst file, construct nodes
+		conf:          conf,
+		stopCh:        make(chan struct{}),
+		compactDone:   make(chan struct{}),
+		memTableIndex: 0,
+		levelToSeq:    make([]atomic.Int32, conf.Storage.MaxLevel),
+		nodes:         make([][]*Node, conf.Storage.MaxLevel),
+		levelLocks:    make([]sync.RWMutex, conf.Storage.MaxLevel),
+		queue:         newCompactQueue(),
+		snapshots:     make(map[uint64]int),
+		stats:         newCompactionStats(conf.Storage.MaxLevel),
+		syncer:        newWALSyncer(conf.Storage.WALSync, time.Duration(conf.Storage.WALSyncIntervalMs)*time.Millisecond),
+	}
+	// 2. Read sst file, construct nodes, removing the files a crash left
+	g := &garbage{dryRun: conf.GC.DryRun}
+	if !conf.GC.Disabled {
+		if err := t.collectSSTGarbage(g); err != nil {
+			return nil, err
+		}
+	}
 	if err := t.constructTree(); err != nil {
 		return nil, err
 	}
-	// 3. Start lsm compaction
+	if !conf.GC.Disabled {
+		if err := t.collectWALGarbage(g); err != nil {
+			return nil, err
+		}
+	}
+	if g.files > 0 {
+		logger.Info("Storage garbage collection completed", "files", g.files, "bytes", g.bytes, "dry_run", g.dryRun)
+	}
+
+	// 3. Continue after the newest seq of the tables, compactions change the
+	// nodes once started
+	for level := range t.nodes {
+		for _, node := range t.nodes[level] {
+			t.seq = max(t.seq, node.MaxSeq())
+		}
+	}
+
+	// 4. Start lsm compaction
+	t.stats.setAlive(true)
 	go t.compact()
 
-	// 4. Read wal files to restore memtables
-	if err := t.constructMemTables(); err != nil {
+	// 5. Read wal files to restore memtables, the flushes they queue wait for
+	// the restore to finish
+	t.dataLock.Lock()
+	err := t.constructMemTables()
+	t.dataLock.Unlock()
+	if err != nil {
 		return nil, err
 	}
+
+	// 6. Start syncing the WAL
+	if t.syncer != nil {
+		go t.syncWAL()
+	}
+
+	// 7. Start moving cold tables to the tier
+	if conf.ColdTier != nil && conf.Tier.IntervalSeconds > 0 {
+		go t.runTiering()
+	}
 	return t, nil
 }
 
 // Add a pair of kv to lsm tree, directly write into memtable
 func (t *LSMTree) Put(key, value []byte) error {
+	seq, err := t.put(key, value)
+	if err != nil {
+		return err
+	}
+	return t.syncer.wait(seq)
+}
+
+// PutBatch adds pairs of kvs in order, with group commit they wait for a
+// single fsync
+func (t *LSMTree) PutBatch(keys, values [][]byte) error {
+	var seq uint64
+	for i := range keys {
+		var err error
+		if seq, err = t.put(keys[i], values[i]); err != nil {
+			return err
+		}
+	}
+	return t.syncer.wait(seq)
+}
+
+// put writes a pair of kv to the WAL and the memtable and returns its seq
+func (t *LSMTree) put(key, value []byte) (uint64, error) {
 	// 1. get lock
 	t.dataLock.Lock()
 	defer t.dataLock.Unlock()
 
 	// 2. write into WAL
-	if err := t.walWriter.Write(key, value); err != nil {
-		return err
+	seq := t.seq + 1
+	if err := t.walWriter.WriteVersion(key, value, seq); err != nil {
+		return 0, err
 	}
+	t.syncer.write(seq)
 
 	// 3. write into memtable(skiplist)
-	t.memTable.Put(key, value)
+	t.memTable.Put(key, value, seq, t.keep(seq))
+	t.seq = seq
 
 	// 4. refresh memtable if size reach the limit, here we use 5/4 to avoid too many refresh
-	if uint64(t.memTable.Size()*5/4) >= t.conf.SSTSize {
+	if uint64(t.memTable.Size()*5/4) >= t.conf.Storage.SSTSize {
 		t.refreshMemTableLocked()
 	}
 
-	return nil
+	return seq, nil
 }
 
 func (t *LSMTree) Stop() {
 	close(t.stopCh)
+	t.syncer.stop()
+	// a flush or compaction in progress still inserts nodes
+	<-t.compactDone
 	for i := range t.nodes {
 		for _, node := range t.nodes[i] {
 			node.Close()
@@ -88,9 +167,15 @@ func (t *LSMTree) Stop() {
 }
 
 func (t *LSMTree) Get(key []byte) ([]byte, bool, error) {
+	return t.GetAt(key, math.MaxUint64)
+}
+
+// GetAt returns the value of key as of seq, which must be pinned by Snapshot
+// for versions overwritten since to be kept
+func (t *LSMTree) GetAt(key []byte, seq uint64) ([]byte, bool, error) {
 	t.dataLock.RLock()
 	// 1. read active memtable
-	value, ok := t.memTable.Get(key)
+	value, ok := t.memTable.GetAt(key, seq)
 	if ok {
 		t.dataLock.RUnlock()
 		logger.Debug("Found in active memtable", "key", string(key), "value", string(value))
@@ -99,7 +184,7 @@ func (t *LSMTree) Get(key []byte) ([]byte, bool, error) {
 
 	// 2. if not found in active memtable, check read only memtables
 	for i := len(t.rOnlyMemTables) - 1; i >= 0; i-- {
-		value, ok = t.rOnlyMemTables[i].memTable.Get(key)
+		value, ok = t.rOnlyMemTables[i].memTable.GetAt(key, seq)
 		if ok {
 			t.dataLock.RUnlock()
 			logger.Debug("Found in read only memtable", "key", string(key), "value", string(value))
@@ -112,7 +197,7 @@ func (t *LSMTree) Get(key []byte) ([]byte, bool, error) {
 	var err error
 	t.levelLocks[0].RLock()
 	for i := len(t.nodes[0]) - 1; i >= 0; i-- {
-		if value, ok, err = t.nodes[0][i].Get(key); err != nil {
+		if value, ok, err = t.nodes[0][i].GetAt(key, seq); err != nil {
 			t.levelLocks[0].RUnlock()
 			return nil, false, err
 		}
@@ -132,7 +217,7 @@ func (t *LSMTree) Get(key []byte) ([]byte, bool, error) {
 			t.levelLocks[level].RUnlock()
 			continue
 		}
-		if value, ok, err = node.Get(key); err != nil {
+		if value, ok, err = node.GetAt(key, seq); err != nil {
 			t.levelLocks[level].RUnlock()
 			return nil, false, err
 		}
@@ -148,6 +233,101 @@ func (t *LSMTree) Get(key []byte) ([]byte, bool, error) {
 	return nil, false, nil
 }
 
+// Snapshot pins the current state, GetAt reads it at the returned seq until
+// ReleaseSnapshot while later writes go on
+func (t *LSMTree) Snapshot() uint64 {
+	// no write may drop the versions of seq before it is pinned
+	t.dataLock.RLock()
+	defer t.dataLock.RUnlock()
+	t.snapshotLock.Lock()
+	defer t.snapshotLock.Unlock()
+	t.snapshots[t.seq]++
+	return t.seq
+}
+
+// ReleaseSnapshot unpins a seq returned by Snapshot, versions only it reads
+// are dropped by later writes and compactions
+func (t *LSMTree) ReleaseSnapshot(seq uint64) {
+	t.snapshotLock.Lock()
+	defer t.snapshotLock.Unlock()
+	if t.snapshots[seq]--; t.snapshots[seq] <= 0 {
+		delete(t.snapshots, seq)
+	}
+}
+
+// Seq returns the seq of the newest write
+func (t *LSMTree) Seq() uint64 {
+	t.dataLock.RLock()
+	defer t.dataLock.RUnlock()
+	return t.seq
+}
+
+// keep returns the oldest seq that may still be read, the oldest snapshot or
+// current if there is none
+func (t *LSMTree) keep(current uint64) uint64 {
+	t.snapshotLock.Lock()
+	defer t.snapshotLock.Unlock()
+	for seq := range t.snapshots {
+		current = min(current, seq)
+	}
+	return current
+}
+
+// Warmup reads every SSTable once so its data blocks are in the page cache,
+// index and filter blocks are held in memory since the tables were loaded.
+// Tables compacted away meanwhile are skipped.
+func (t *LSMTree) Warmup() (files int, bytes int64, err error) {
+	var names []string
+	for level := range t.nodes {
+		t.levelLocks[level].RLock()
+		for _, node := range t.nodes[level] {
+			names = append(names, node.file)
+		}
+		t.levelLocks[level].RUnlock()
+	}
+
+	for _, name := range names {
+		file, err := os.Open(path.Join(t.conf.SSTDir(), name))
+		if os.IsNotExist(err) {
+			continue
+		}
+		if err != nil {
+			return files, bytes, err
+		}
+		n, err := io.Copy(io.Discard, file)
+		file.Close()
+		if err != nil {
+			return files, bytes, fmt.Errorf("failed to read %s: %w", name, err)
+		}
+		files++
+		bytes += n
+	}
+	return files, bytes, nil
+}
+
+// ApproximateSize returns the size of the SSTable data blocks holding keys in
+// [start, end), blocks on the range boundary count in full. Keys overwritten
+// in a newer table are counted in every table holding them.
+func (t *LSMTree) ApproximateSize(start, end []byte) int64 {
+	var size int64
+	for level := range t.nodes {
+		t.levelLocks[level].RLock()
+		for _, node := range t.nodes[level] {
+			// a block holds the keys after the previous index key up to its own
+			var prev []byte
+			for _, entry := range node.indexEntries {
+				if entry.PrevSize > 0 && bytes.Compare(entry.Key, start) >= 0 &&
+					(prev == nil || end == nil || bytes.Compare(prev, end) < 0) {
+					size += int64(entry.PrevSize)
+				}
+				prev = entry.Key
+			}
+		}
+		t.levelLocks[level].RUnlock()
+	}
+	return size
+}
+
 func (t *LSMTree) levelBinarySearch(level int, key []byte, left, right int) (*Node, bool) {
 	for left <= right {
 		mid := left + (right-left)/2
@@ -165,7 +345,7 @@ func (t *LSMTree) levelBinarySearch(level int, key []byte, left, right int) (*No
 
 func (t *LSMTree) refreshMemTableLocked() {
 	// 1. change to readOnly skiplist and add to slices
-	// 2. send to compact go routine
+	// 2. queue the flush for the compact go routine
 	// 3. compact write to level 0 sstable
 	logger.Debug("Refreshing memtable", "memtable_size", t.memTable.Size())
 	oldItem := &memTableCompactItem{
@@ -173,31 +353,42 @@ func (t *LSMTree) refreshMemTableLocked() {
 		walFile:  t.newWalFile(),
 	}
 	t.rOnlyMemTables = append(t.rOnlyMemTables, oldItem)
+	if t.syncer != nil {
+		// the fsync goroutine only syncs the WAL of the new memtable
+		err := t.walWriter.Sync()
+		if err != nil {
+			logger.Error("Failed to sync WAL", "wal_file", oldItem.walFile, "error", err)
+		}
+		t.syncer.record(t.seq, err)
+	}
 	t.walWriter.Close()
-	go func() {
-		t.memCompactCh <- oldItem
-	}()
+	t.queue.push(flushTask)
 
 	t.memTableIndex++
 	t.memTable, _ = t.newMemTable()
 }
 
 func (t *LSMTree) newMemTable() (memtable.MemTable, error) {
-	walWriter, err := wal.NewWALWriter(t.newWalFile())
+	walWriter, err := wal.NewVersionedWALWriter(t.newWalFile())
 	if err != nil {
 		return nil, err
 	}
+	if size := t.conf.Storage.WALPreallocateBytes; size > 0 {
+		if err := walWriter.Preallocate(size); err != nil {
+			logger.Warn("Failed to preallocate WAL", "wal_file", t.newWalFile(), "error", err)
+		}
+	}
 	t.walWriter = walWriter
 	memtable := t.conf.MemTableConstructor()
 	return memtable, nil
 }
 
 func (t *LSMTree) newWalFile() string {
-	return path.Join(t.conf.Dir, "walfile", "memtable", fmt.Sprintf("%d.wal", t.memTableIndex))
+	return path.Join(t.conf.MemTableWALDir(), fmt.Sprintf("%d.wal", t.memTableIndex))
 }
 
 func (t *LSMTree) sstFile(level int, seq int32) string {
-	return path.Join("sstfile", fmt.Sprintf("%d_%d.sst", level, seq))
+	return fmt.Sprintf("%d_%d.sst", level, seq)
 }
 
 func walFileToMemTableIndex(walFile string) int {
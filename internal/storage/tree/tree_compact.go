@@ -2,9 +2,11 @@ package tree
 
 import (
 	"bytes"
+	"fmt"
 	"math"
 	"oasisdb/internal/storage/memtable"
 	"oasisdb/internal/storage/sstable"
+	"oasisdb/pkg/errors"
 	"oasisdb/pkg/logger"
 	"os"
 	"time"
@@ -17,18 +19,56 @@ type memTableCompactItem struct {
 
 func (t *LSMTree) compact() {
 	logger.Info("LSM Tree compact goroutine started")
+	defer close(t.compactDone)
+	defer t.stats.setAlive(false)
 	for {
 		select {
 		case <-t.stopCh:
 			logger.Info("LSM Tree compact goroutine stopping")
 			return
-		case memTableCompactItem := <-t.memCompactCh:
-			logger.Debug("Received memtable compact request", "wal_file", memTableCompactItem.walFile)
-			t.compactMemTable(memTableCompactItem)
-		case level := <-t.levelCompactCh:
-			logger.Debug("Received level compact request", "level", level)
-			t.compactLevel(level)
+		case <-t.queue.ready:
 		}
+		for task, ok := t.queue.pop(); ok; task, ok = t.queue.pop() {
+			if t.stopped() {
+				logger.Info("LSM Tree compact goroutine stopping")
+				return
+			}
+			if task == flushTask {
+				t.flushPending()
+				continue
+			}
+			if task == tierTask {
+				t.tierColdTables(time.Now())
+				continue
+			}
+			logger.Debug("Received level compact request", "level", task)
+			t.compactLevel(int(task))
+		}
+	}
+}
+
+// stopped reports whether the tree was stopped
+func (t *LSMTree) stopped() bool {
+	select {
+	case <-t.stopCh:
+		return true
+	default:
+		return false
+	}
+}
+
+// flushPending writes the read only memtables to level 0, oldest first
+func (t *LSMTree) flushPending() {
+	for !t.stopped() {
+		t.dataLock.RLock()
+		if len(t.rOnlyMemTables) == 0 {
+			t.dataLock.RUnlock()
+			return
+		}
+		item := t.rOnlyMemTables[0]
+		t.dataLock.RUnlock()
+		logger.Debug("Received memtable compact request", "wal_file", item.walFile)
+		t.compactMemTable(item)
 	}
 }
 
@@ -36,6 +76,8 @@ func (t *LSMTree) compact() {
 func (t *LSMTree) compactLevel(level int) {
 	startTime := time.Now()
 	logger.Info("Starting level compaction", "level", level, "target_level", level+1)
+	t.stats.start(level)
+	defer t.stats.finish(level, startTime)
 
 	// get nodes in level i, and compact them to level i + 1
 	pickedNodes := t.pickCompactNodes(level)
@@ -47,18 +89,17 @@ func (t *LSMTree) compactLevel(level int) {
 
 	// insert to level i + 1 target sstWriter
 	seq := t.levelToSeq[level+1].Load() + 1
-	sstWriter, _ := sstable.NewSSTableWriter(t.sstFile(level+1, seq), t.conf)
+	sstWriter, _ := sstable.NewVersionedSSTableWriter(t.sstFile(level+1, seq), t.conf)
 	defer sstWriter.Close()
 
 	// get level i + 1 sst file size limit
-	sstLimit := t.conf.SSTSize * uint64(math.Pow10(level+1))
+	sstLimit := t.conf.Storage.SSTSize * uint64(math.Pow10(level+1))
 	logger.Debug("Compaction parameters", "target_level", level+1, "seq", seq, "sst_limit", sstLimit)
 
-	// get all kv data of picked nodes
-	pickedKVs := t.pickedNodesToKVs(pickedNodes)
-	logger.Debug("Collected KV pairs from picked nodes", "kv_count", len(pickedKVs))
-	// traverse every kv data
-	for i := 0; i < len(pickedKVs); i++ {
+	// stream the picked nodes merged by key, the versions of a key are merged
+	kvs := t.pickedNodesIterator(pickedNodes, t.keep(t.Seq()))
+	processed := 0
+	for kvs.Next() {
 		// if new level + 1 sst file size reach the limit
 		if sstWriter.Size() > sstLimit {
 			logger.Debug("SST file size limit reached, creating new file",
@@ -76,22 +117,31 @@ func (t *LSMTree) compactLevel(level int) {
 			// update seq
 			seq = t.levelToSeq[level+1].Load() + 1
 			// construct new sst writer
-			sstWriter, _ = sstable.NewSSTableWriter(t.sstFile(level+1, seq), t.conf)
+			sstWriter, _ = sstable.NewVersionedSSTableWriter(t.sstFile(level+1, seq), t.conf)
 			defer sstWriter.Close()
 		}
 
 		// append kv to sst writer in level i + 1
-		sstWriter.Append(pickedKVs[i].Key, pickedKVs[i].Value)
-		// if this is the last kv data, need to finish sst writer and insert node into lsm tree
-		if i == len(pickedKVs)-1 {
-			size, blockToFilter, index, err := sstWriter.Finish()
-			if err != nil {
-				logger.Error("Failed to finish final SST writer", "error", err)
-				panic(err)
-			}
-			t.insertNode(level+1, seq, size, blockToFilter, index)
-			logger.Debug("Inserted final SST node", "level", level+1, "seq", seq, "size", size)
+		if err := sstWriter.Append(kvs.Key(), kvs.Value()); err != nil {
+			logger.Error("Failed to append to SST writer", "error", err)
+			panic(err)
+		}
+		processed++
+	}
+	if err := kvs.Err(); err != nil {
+		logger.Error("Failed to read picked nodes", "level", level, "error", err)
+		panic(err)
+	}
+
+	// finish the last sst writer and insert node into lsm tree
+	if processed > 0 {
+		size, blockToFilter, index, err := sstWriter.Finish()
+		if err != nil {
+			logger.Error("Failed to finish final SST writer", "error", err)
+			panic(err)
 		}
+		t.insertNode(level+1, seq, size, blockToFilter, index)
+		logger.Debug("Inserted final SST node", "level", level+1, "seq", seq, "size", size)
 	}
 
 	// remove picked nodes
@@ -103,30 +153,32 @@ func (t *LSMTree) compactLevel(level int) {
 
 	duration := time.Since(startTime)
 	logger.Info("Level compaction completed", "level", level, "target_level", level+1,
-		"processed_kvs", len(pickedKVs), "duration", duration)
+		"processed_kvs", processed, "duration", duration)
 }
 
-func (t *LSMTree) pickedNodesToKVs(pickedNodes []*Node) []*sstable.KV {
-	memtable := t.conf.MemTableConstructor()
+// pickedNodesIterator merges the picked nodes, they are picked from level i + 1
+// to level i and by seq within a level, so later nodes hold newer data. The
+// versions of a key are merged, dropping those no read at or after keep sees
+func (t *LSMTree) pickedNodesIterator(pickedNodes []*Node, keep uint64) sstable.Iterator {
+	iters := make([]sstable.Iterator, 0, len(pickedNodes))
 	for _, node := range pickedNodes {
-		kvs, _ := node.GetAll()
-		for _, kv := range kvs {
-			// put kv into memtable, here larger index means newer data, and this will be used to cover older data
-			memtable.Put(kv.Key, kv.Value)
-		}
+		iters = append(iters, node.Iterator())
 	}
-
-	// sort by memtable
-	_kvs := memtable.All()
-	kvs := make([]*sstable.KV, 0, len(_kvs))
-	for _, kv := range _kvs {
-		kvs = append(kvs, &sstable.KV{
-			Key:   kv.Key,
-			Value: kv.Value,
-		})
-	}
-
-	return kvs
+	return sstable.NewMergeIteratorFunc(func(newer, older []byte) ([]byte, error) {
+		newerVersions, err := memtable.DecodeVersions(newer)
+		if err != nil {
+			return nil, err
+		}
+		if pruned := memtable.Prune(newerVersions, keep); pruned[len(pruned)-1].Seq <= keep {
+			// every read sees one of the newer versions
+			return memtable.EncodeVersions(pruned), nil
+		}
+		olderVersions, err := memtable.DecodeVersions(older)
+		if err != nil {
+			return nil, err
+		}
+		return memtable.EncodeVersions(memtable.Prune(append(newerVersions, olderVersions...), keep)), nil
+	}, iters...)
 }
 
 func (t *LSMTree) removeNodes(level int, nodes []*Node) {
@@ -159,6 +211,7 @@ outer:
 func (t *LSMTree) compactMemTable(memCompactItem *memTableCompactItem) {
 	startTime := time.Now()
 	logger.Info("Starting memtable compaction", "wal_file", memCompactItem.walFile)
+	defer t.stats.flushed(startTime)
 
 	// 1. flush memtable to level 0 sstable
 	t.flushMemTable(memCompactItem.memTable)
@@ -236,13 +289,23 @@ func (t *LSMTree) flushMemTable(memTable memtable.MemTable) {
 	logger.Debug("Flushing memtable to level 0", "seq", seq)
 
 	// 2. create sst writer
-	sstWriter, _ := sstable.NewSSTableWriter(t.sstFile(0, seq), t.conf)
+	sstWriter, _ := sstable.NewVersionedSSTableWriter(t.sstFile(0, seq), t.conf)
 	defer sstWriter.Close()
 
-	// 3. traverse memtable and write data to sst writer
+	// 3. traverse memtable and write the versions of each key to sst writer
+	keep := t.keep(t.Seq())
 	kvCount := 0
-	for _, kv := range memTable.All() {
-		sstWriter.Append(kv.Key, kv.Value)
+	all := memTable.All()
+	for i := 0; i < len(all); {
+		key := all[i].Key
+		var versions []memtable.Version
+		for ; i < len(all) && bytes.Equal(all[i].Key, key); i++ {
+			versions = append(versions, memtable.Version{Seq: all[i].Seq, Value: all[i].Value})
+		}
+		if err := sstWriter.Append(key, memtable.EncodeVersions(memtable.Prune(versions, keep))); err != nil {
+			logger.Error("Failed to append to SST writer during memtable flush", "error", err)
+			panic(err)
+		}
 		kvCount++
 	}
 	logger.Debug("Wrote KV pairs to SST", "count", kvCount, "level", 0, "seq", seq)
@@ -275,7 +338,7 @@ func (t *LSMTree) tryTriggerCompact(level int) {
 		size += node.size
 	}
 
-	threshold := t.conf.SSTSize * uint64(math.Pow10(level)) * uint64(t.conf.SSTNumPerLevel)
+	threshold := t.conf.Storage.SSTSize * uint64(math.Pow10(level)) * uint64(t.conf.Storage.SSTNumPerLevel)
 	logger.Debug("Checking compaction trigger", "level", level, "current_size", size,
 		"threshold", threshold, "node_count", nodeCount)
 
@@ -285,7 +348,37 @@ func (t *LSMTree) tryTriggerCompact(level int) {
 	}
 
 	logger.Info("Triggering level compaction", "level", level, "size", size, "threshold", threshold)
-	go func() {
-		t.levelCompactCh <- level
-	}()
+	t.enqueueCompact(level)
+}
+
+// Compact queues the compaction of a level into the next one, levels are
+// compacted one at a time by the compaction goroutine. A level already
+// queued isn't queued again
+func (t *LSMTree) Compact(level int) error {
+	if level < 0 || level >= len(t.nodes)-1 {
+		return fmt.Errorf("%w: level must be in [0, %d]", errors.ErrInvalidParameter, len(t.nodes)-2)
+	}
+	logger.Info("Manual level compaction requested", "level", level)
+	t.enqueueCompact(level)
+	return nil
+}
+
+// CompactAll queues the compaction of every level, from the top
+func (t *LSMTree) CompactAll() {
+	logger.Info("Manual compaction of all levels requested")
+	levels := make([]int, len(t.nodes)-1)
+	for level := range levels {
+		levels[level] = level
+	}
+	t.enqueueCompact(levels...)
+}
+
+// enqueueCompact queues the compaction of levels in order, without blocking
+// the caller
+func (t *LSMTree) enqueueCompact(levels ...int) {
+	tasks := make([]compactTask, len(levels))
+	for i, level := range levels {
+		tasks[i] = compactTask(level)
+	}
+	t.queue.push(tasks...)
 }
@@ -0,0 +1,154 @@
+package tree
+
+import (
+	"errors"
+	"io"
+	"oasisdb/internal/storage/sstable"
+	"oasisdb/internal/storage/wal"
+	"oasisdb/pkg/logger"
+	"os"
+	"path"
+	"strings"
+)
+
+// garbage counts the files removed by a garbage collection, a dry run only
+// logs them
+type garbage struct {
+	dryRun bool
+	files  int
+	bytes  int64
+}
+
+func (g *garbage) remove(file, reason string) {
+	info, err := os.Stat(file)
+	if err != nil {
+		return
+	}
+	if g.dryRun {
+		logger.Info("Found orphaned file, dry run keeps it", "file", file, "reason", reason, "bytes", info.Size())
+	} else if err := os.Remove(file); err != nil {
+		logger.Warn("Failed to remove orphaned file", "file", file, "error", err)
+		return
+	} else {
+		logger.Info("Removed orphaned file", "file", file, "reason", reason, "bytes", info.Size())
+	}
+	g.files++
+	g.bytes += info.Size()
+}
+
+// collectSSTGarbage removes the files of the SST directory a crash left
+// behind, before the tables are loaded: temporary files, and tables a flush
+// or compaction didn't finish. Their data is still in the WAL or in the
+// tables being compacted, which are only removed once the new table is in
+// place
+func (t *LSMTree) collectSSTGarbage(g *garbage) error {
+	entries, err := os.ReadDir(t.conf.SSTDir())
+	if err != nil {
+		return err
+	}
+	for _, entry := range entries {
+		file := path.Join(t.conf.SSTDir(), entry.Name())
+		switch {
+		case entry.IsDir():
+		case strings.HasSuffix(entry.Name(), ".tmp"):
+			g.remove(file, "temporary file")
+		case strings.HasSuffix(entry.Name(), ".sst") && !t.completeSST(entry.Name()):
+			g.remove(file, "incomplete table")
+		}
+	}
+	return nil
+}
+
+// completeSST reports whether a table can be loaded
+func (t *LSMTree) completeSST(name string) bool {
+	reader, err := sstable.NewSSTableReader(name, t.conf)
+	if err != nil {
+		return false
+	}
+	defer reader.Close()
+	index, err := reader.ReadIndex()
+	if err != nil || len(index) == 0 {
+		return false
+	}
+	_, err = reader.ReadFilter()
+	return err == nil
+}
+
+// collectWALGarbage removes the memtable WALs a crash left behind, after the
+// tables are loaded: temporary files, and WALs of memtables that were
+// flushed but not removed yet. A WAL is flushed if the tables hold every
+// record of it or a newer version. The newest WAL is the active memtable
+// and is kept, as are WALs written before seqs and WALs with a torn record
+func (t *LSMTree) collectWALGarbage(g *garbage) error {
+	entries, err := os.ReadDir(t.conf.MemTableWALDir())
+	if err != nil {
+		return err
+	}
+	newest := -1
+	for _, entry := range entries {
+		if !entry.IsDir() && strings.HasSuffix(entry.Name(), ".wal") {
+			newest = max(newest, walFileToMemTableIndex(entry.Name()))
+		}
+	}
+	for _, entry := range entries {
+		file := path.Join(t.conf.MemTableWALDir(), entry.Name())
+		switch {
+		case entry.IsDir():
+		case strings.HasSuffix(entry.Name(), ".tmp"):
+			g.remove(file, "temporary file")
+		case strings.HasSuffix(entry.Name(), ".wal") && walFileToMemTableIndex(entry.Name()) != newest:
+			flushed, err := t.flushedWAL(file)
+			if err != nil {
+				return err
+			}
+			if flushed {
+				g.remove(file, "flushed memtable")
+			}
+		}
+	}
+	return nil
+}
+
+// flushedWAL reports whether the tables hold every record of a WAL or a
+// newer version of its key
+func (t *LSMTree) flushedWAL(file string) (bool, error) {
+	reader, err := wal.NewWALReader(file)
+	if err != nil {
+		return false, err
+	}
+	defer reader.Close()
+	for {
+		kv, err := reader.Next()
+		if errors.Is(err, io.EOF) {
+			return reader.Versioned(), nil
+		}
+		if err != nil || !reader.Versioned() {
+			return false, nil
+		}
+		seq, err := t.flushedSeq(kv.Key)
+		if err != nil {
+			return false, err
+		}
+		if seq < kv.Seq {
+			return false, nil
+		}
+	}
+}
+
+// flushedSeq returns the newest seq of key in the tables, 0 if it isn't in
+// any or only in tables written before seqs
+func (t *LSMTree) flushedSeq(key []byte) (uint64, error) {
+	var seq uint64
+	for level := range t.nodes {
+		for _, node := range t.nodes[level] {
+			versions, ok, err := node.versions(key)
+			if err != nil {
+				return 0, err
+			}
+			if ok && len(versions) > 0 {
+				seq = max(seq, versions[0].Seq)
+			}
+		}
+	}
+	return seq, nil
+}
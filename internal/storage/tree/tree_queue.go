@@ -0,0 +1,108 @@
+package tree
+
+import (
+	"slices"
+	"sync"
+	"sync/atomic"
+)
+
+// compactTask is the level to compact into the next one, or flushTask
+type compactTask int
+
+const (
+	// flushTask writes the read only memtables to level 0
+	flushTask compactTask = -1
+	// tierTask moves the cold tables to the cold tier, no compaction reads a
+	// table while its reader is swapped
+	tierTask compactTask = -2
+)
+
+// compactQueue holds the tasks of the compaction goroutine. A task already
+// queued isn't queued again, so the queue holds at most the flush and one
+// compaction per level, and pushing never blocks
+type compactQueue struct {
+	mu     sync.Mutex
+	tasks  []compactTask
+	queued map[compactTask]bool
+	ready  chan struct{} // wakes the compaction goroutine
+
+	observer atomic.Pointer[func(depth int)] // called when the depth changes
+}
+
+func newCompactQueue() *compactQueue {
+	return &compactQueue{
+		queued: make(map[compactTask]bool),
+		ready:  make(chan struct{}, 1),
+	}
+}
+
+// push queues the tasks that aren't queued yet, in order, and returns how
+// many were
+func (q *compactQueue) push(tasks ...compactTask) int {
+	q.mu.Lock()
+	pushed := 0
+	for _, task := range tasks {
+		if q.queued[task] {
+			continue
+		}
+		q.queued[task] = true
+		q.tasks = append(q.tasks, task)
+		pushed++
+	}
+	depth := len(q.tasks)
+	q.mu.Unlock()
+
+	if pushed > 0 {
+		q.observe(depth)
+		select {
+		case q.ready <- struct{}{}:
+		default: // already woken
+		}
+	}
+	return pushed
+}
+
+// pop removes the next task, false if there is none. The flush goes first,
+// stalled writes wait for it and it adds the level 0 tables compactions merge
+func (q *compactQueue) pop() (compactTask, bool) {
+	q.mu.Lock()
+	if len(q.tasks) == 0 {
+		q.mu.Unlock()
+		return 0, false
+	}
+	i := max(slices.Index(q.tasks, flushTask), 0)
+	task := q.tasks[i]
+	q.tasks = slices.Delete(q.tasks, i, i+1)
+	delete(q.queued, task)
+	depth := len(q.tasks)
+	q.mu.Unlock()
+
+	q.observe(depth)
+	return task, true
+}
+
+func (q *compactQueue) observe(depth int) {
+	if observer := q.observer.Load(); observer != nil {
+		(*observer)(depth)
+	}
+}
+
+// pending reports whether a task is queued
+func (q *compactQueue) pending(task compactTask) bool {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	return q.queued[task]
+}
+
+// depth returns the number of queued tasks
+func (q *compactQueue) depth() int {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	return len(q.tasks)
+}
+
+// ObserveCompactionQueue calls observer with the number of queued flush and
+// level compactions every time it changes
+func (t *LSMTree) ObserveCompactionQueue(observer func(depth int)) {
+	t.queue.observer.Store(&observer)
+}
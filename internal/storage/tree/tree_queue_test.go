@@ -0,0 +1,43 @@
+package tree
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestCompactQueue(t *testing.T) {
+	q := newCompactQueue()
+	var depths []int
+	observer := func(depth int) { depths = append(depths, depth) }
+	q.observer.Store(&observer)
+	_, ok := q.pop()
+	assert.False(t, ok)
+
+	assert.Equal(t, 2, q.push(1, 0))
+	assert.Equal(t, 1, q.push(0, flushTask, 1))
+	assert.Equal(t, 3, q.depth())
+	assert.True(t, q.pending(0))
+	assert.True(t, q.pending(flushTask))
+	assert.False(t, q.pending(2))
+	select {
+	case <-q.ready:
+	default:
+		t.Fatal("expected the push to wake the compaction goroutine")
+	}
+
+	// the flush goes first, then the levels in the order they were queued
+	var tasks []compactTask
+	for task, ok := q.pop(); ok; task, ok = q.pop() {
+		tasks = append(tasks, task)
+	}
+	assert.Equal(t, []compactTask{flushTask, 1, 0}, tasks)
+	assert.Equal(t, []int{2, 3, 2, 1, 0}, depths)
+	assert.Zero(t, q.depth())
+	assert.False(t, q.pending(1))
+
+	// a popped task can be queued again
+	require.Equal(t, 1, q.push(1))
+	assert.Equal(t, 1, q.depth())
+}
@@ -3,6 +3,7 @@ package tree
 import (
 	"bytes"
 	"io/fs"
+	"oasisdb/internal/storage/memtable"
 	"oasisdb/internal/storage/sstable"
 	"oasisdb/internal/storage/wal"
 	"oasisdb/pkg/logger"
@@ -17,7 +18,7 @@ func (t *LSMTree) restoreMemTables(wals []fs.DirEntry) error {
 	// 1. restore memtable, and to memory
 	for i := 0; i < len(wals); i++ {
 		name := wals[i].Name()
-		file := path.Join(t.conf.Dir, "walfile", "memtable", name)
+		file := path.Join(t.conf.MemTableWALDir(), name)
 		logger.Debug("Restoring wal file", "wal_file", file)
 		walReader, err := wal.NewWALReader(file)
 		if err != nil {
@@ -28,26 +29,59 @@ func (t *LSMTree) restoreMemTables(wals []fs.DirEntry) error {
 		if err := walReader.RestoreToMemtable(memtable); err != nil {
 			return err
 		}
+		t.seq = max(t.seq, walReader.MaxSeq())
 		if i == len(wals)-1 { // if it is the last wal file, use this memtable as read-write memtable
+			if !walReader.Versioned() {
+				if err := upgradeWAL(file, memtable); err != nil {
+					return err
+				}
+			}
 			t.memTable = memtable
 			t.memTableIndex = walFileToMemTableIndex(name)
-			t.walWriter, _ = wal.NewWALWriter(file)
-		} else { // other memtables as read-only memtables, need to append to read-only memtables and channel
+			if t.walWriter, err = wal.NewVersionedWALWriter(file); err != nil {
+				return err
+			}
+		} else { // other memtables as read-only memtables, need to append to read-only memtables and flush
 			memTableCompactItem := &memTableCompactItem{
 				walFile:  file,
 				memTable: memtable,
 			}
 
 			t.rOnlyMemTables = append(t.rOnlyMemTables, memTableCompactItem)
-			t.memCompactCh <- memTableCompactItem
+			t.queue.push(flushTask)
 		}
 	}
 	return nil
 }
 
+// upgradeWAL rewrites a WAL written before seqs with the versions of its
+// restored memtable, so writes with seqs can be appended to it
+func upgradeWAL(file string, memTable memtable.MemTable) error {
+	tmp := file + ".tmp"
+	if err := os.Remove(tmp); err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	writer, err := wal.NewVersionedWALWriter(tmp)
+	if err != nil {
+		return err
+	}
+	for _, kv := range memTable.All() {
+		if err := writer.WriteVersion(kv.Key, kv.Value, kv.Seq); err != nil {
+			writer.Close()
+			return err
+		}
+	}
+	if err := writer.Sync(); err != nil {
+		writer.Close()
+		return err
+	}
+	writer.Close()
+	return os.Rename(tmp, file)
+}
+
 func (t *LSMTree) constructMemTables() error {
 	// 1. read wal dir to get all the wal files
-	rawFiles, err := os.ReadDir(path.Join(t.conf.Dir, "walfile", "memtable"))
+	rawFiles, err := os.ReadDir(t.conf.MemTableWALDir())
 	if err != nil {
 		return err
 	}
@@ -96,7 +130,8 @@ func (t *LSMTree) constructTree() error {
 }
 
 func (t *LSMTree) loadNode(sstEntry fs.DirEntry) error {
-	sstReader, err := sstable.NewSSTableReader(path.Join("sstfile", sstEntry.Name()), t.conf)
+	name := tableName(sstEntry.Name())
+	sstReader, err := sstable.NewSSTableReader(name, t.conf)
 	if err != nil {
 		return err
 	}
@@ -116,7 +151,7 @@ func (t *LSMTree) loadNode(sstEntry fs.DirEntry) error {
 		return err
 	}
 
-	level, seq := getLevelSeqFromSSTFile(sstEntry.Name())
+	level, seq := getLevelSeqFromSSTFile(name)
 	// insert sst file as a node to lsm tree
 	t.insertNodeWithReader(sstReader, level, seq, size, blockToFilter, index)
 	return nil
@@ -153,6 +188,12 @@ func (t *LSMTree) insertNodeWithReader(sstReader *sstable.SSTableReader, level i
 	t.levelLocks[level].Unlock()
 }
 
+// tableName returns the name of the table of an SST directory entry, a table
+// or the tail of a table in the cold tier
+func tableName(entry string) string {
+	return strings.TrimSuffix(entry, sstable.RemoteSuffix)
+}
+
 func getLevelSeqFromSSTFile(file string) (level int, seq int32) {
 	file = strings.ReplaceAll(file, ".sst", "")
 	splitted := strings.Split(file, "_")
@@ -162,18 +203,26 @@ func getLevelSeqFromSSTFile(file string) (level int, seq int32) {
 }
 
 func (t *LSMTree) getSortedSSTEntries() ([]fs.DirEntry, error) {
-	allEntries, err := os.ReadDir(path.Join(t.conf.Dir, "sstfile"))
+	allEntries, err := os.ReadDir(t.conf.SSTDir())
 	if err != nil {
 		return nil, err
 	}
 
+	local := make(map[string]bool, len(allEntries))
+	for _, entry := range allEntries {
+		local[entry.Name()] = true
+	}
+
 	sstEntries := make([]fs.DirEntry, 0, len(allEntries))
 	for _, entry := range allEntries {
 		if entry.IsDir() {
 			continue
 		}
 
-		if !strings.HasSuffix(entry.Name(), ".sst") {
+		// a table moved to the cold tier is named by its tail, unless the
+		// move was interrupted before the table was removed
+		name := tableName(entry.Name())
+		if !strings.HasSuffix(name, ".sst") || name != entry.Name() && local[name] {
 			continue
 		}
 
@@ -181,8 +230,8 @@ func (t *LSMTree) getSortedSSTEntries() ([]fs.DirEntry, error) {
 	}
 
 	sort.Slice(sstEntries, func(i, j int) bool {
-		levelI, seqI := getLevelSeqFromSSTFile(sstEntries[i].Name())
-		levelJ, seqJ := getLevelSeqFromSSTFile(sstEntries[j].Name())
+		levelI, seqI := getLevelSeqFromSSTFile(tableName(sstEntries[i].Name()))
+		levelJ, seqJ := getLevelSeqFromSSTFile(tableName(sstEntries[j].Name()))
 		if levelI == levelJ {
 			return seqI < seqJ
 		}
@@ -0,0 +1,152 @@
+package tree
+
+import (
+	"bytes"
+	"fmt"
+	"math"
+	"sort"
+
+	"oasisdb/internal/storage/memtable"
+	"oasisdb/internal/storage/sstable"
+)
+
+// scanChunkSize is the number of keys a scan reads with the tree locked
+// before passing them on
+const scanChunkSize = 1024
+
+// Scan calls fn with the newest value of each key in [start, end) in key order
+// until fn returns false, deleted keys are skipped and nil end means no upper
+// bound. Keys are read in chunks and fn runs with the tree unlocked, so it may
+// read and write the tree. A write made during the scan is seen if it lands
+// after the chunk being read
+func (t *LSMTree) Scan(start, end []byte, fn func(key, value []byte) bool) error {
+	return t.ScanAt(start, end, math.MaxUint64, fn)
+}
+
+// ScanAt scans like Scan as of seq, which must be pinned by Snapshot for
+// versions overwritten since to be kept
+func (t *LSMTree) ScanAt(start, end []byte, seq uint64, fn func(key, value []byte) bool) error {
+	for {
+		keys, values, next, err := t.scanChunk(start, end, seq, scanChunkSize)
+		if err != nil {
+			return err
+		}
+		for i := range keys {
+			if !fn(keys[i], values[i]) {
+				return nil
+			}
+		}
+		if next == nil {
+			return nil
+		}
+		start = next
+	}
+}
+
+// scanChunk reads the live keys among the first limit keys in [start, end)
+// and returns the key to continue from, nil once the range is exhausted
+func (t *LSMTree) scanChunk(start, end []byte, seq uint64, limit int) (keys, values [][]byte, next []byte, err error) {
+	// memtables first, a flush inserts its table before it drops the memtable
+	t.dataLock.RLock()
+	memIters := make([]sstable.Iterator, 0, len(t.rOnlyMemTables)+1)
+	for _, item := range t.rOnlyMemTables {
+		memIters = append(memIters, newMemTableIterator(item.memTable.All(), start, end))
+	}
+	memIters = append(memIters, newMemTableIterator(t.memTable.All(), start, end))
+	t.dataLock.RUnlock()
+
+	// the nodes can't be destroyed while their levels are locked
+	for level := range t.nodes {
+		t.levelLocks[level].RLock()
+		defer t.levelLocks[level].RUnlock()
+	}
+	// from oldest to newest: deeper levels first, then level 0 by seq, then
+	// the memtables
+	var iters []sstable.Iterator
+	for level := len(t.nodes) - 1; level >= 0; level-- {
+		for _, node := range t.nodes[level] {
+			if bytes.Compare(node.End(), start) < 0 || (end != nil && bytes.Compare(node.Start(), end) >= 0) {
+				continue
+			}
+			iters = append(iters, node.IteratorFrom(start))
+		}
+	}
+	// the versions of a key are merged, the newest one may be after seq
+	merged := sstable.NewMergeIteratorFunc(func(newer, older []byte) ([]byte, error) {
+		newerVersions, err := memtable.DecodeVersions(newer)
+		if err != nil {
+			return nil, err
+		}
+		if _, ok := memtable.VisibleAt(newerVersions, seq); ok {
+			return newer, nil
+		}
+		olderVersions, err := memtable.DecodeVersions(older)
+		if err != nil {
+			return nil, err
+		}
+		return memtable.EncodeVersions(append(newerVersions, olderVersions...)), nil
+	}, append(iters, memIters...)...)
+
+	visited := 0
+	for merged.Next() {
+		key := merged.Key()
+		if end != nil && bytes.Compare(key, end) >= 0 {
+			break
+		}
+		if bytes.Compare(key, start) < 0 {
+			continue
+		}
+		if visited == limit {
+			return keys, values, key, nil
+		}
+		visited++
+		versions, err := memtable.DecodeVersions(merged.Value())
+		if err != nil {
+			return nil, nil, nil, fmt.Errorf("failed to decode versions of %q: %w", key, err)
+		}
+		version, ok := memtable.VisibleAt(versions, seq)
+		if !ok || len(version.Value) == 0 {
+			continue // written after seq or deleted
+		}
+		keys = append(keys, key)
+		values = append(values, version.Value)
+	}
+	if err := merged.Err(); err != nil {
+		return nil, nil, nil, err
+	}
+	return keys, values, nil, nil
+}
+
+// memTableIterator streams the versions of the keys of a memtable in
+// [start, end) as version lists
+type memTableIterator struct {
+	pairs []*memtable.KVPair // all versions by key, newest first
+	key   []byte
+	value []byte
+}
+
+func newMemTableIterator(pairs []*memtable.KVPair, start, end []byte) *memTableIterator {
+	pairs = pairs[sort.Search(len(pairs), func(i int) bool { return bytes.Compare(pairs[i].Key, start) >= 0 }):]
+	if end != nil {
+		pairs = pairs[:sort.Search(len(pairs), func(i int) bool { return bytes.Compare(pairs[i].Key, end) >= 0 })]
+	}
+	return &memTableIterator{pairs: pairs}
+}
+
+func (it *memTableIterator) Next() bool {
+	if len(it.pairs) == 0 {
+		return false
+	}
+	it.key = it.pairs[0].Key
+	var versions []memtable.Version
+	for len(it.pairs) > 0 && bytes.Equal(it.pairs[0].Key, it.key) {
+		versions = append(versions, memtable.Version{Seq: it.pairs[0].Seq, Value: it.pairs[0].Value})
+		it.pairs = it.pairs[1:]
+	}
+	it.value = memtable.EncodeVersions(versions)
+	return true
+}
+
+func (it *memTableIterator) Key() []byte   { return it.key }
+func (it *memTableIterator) Value() []byte { return it.value }
+func (it *memTableIterator) Err() error    { return nil }
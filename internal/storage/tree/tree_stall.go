@@ -0,0 +1,94 @@
+package tree
+
+import (
+	"sync/atomic"
+	"time"
+
+	"oasisdb/pkg/errors"
+	"oasisdb/pkg/logger"
+)
+
+const (
+	// writeSlowdownDelay is added to every write while level 0 is over its
+	// slowdown trigger
+	writeSlowdownDelay = time.Millisecond
+
+	// stallPollInterval is how often a stopped write checks whether
+	// compaction caught up
+	stallPollInterval = 10 * time.Millisecond
+)
+
+// WriteState tells whether writes keep up with compaction
+type WriteState string
+
+const (
+	WritesNormal  WriteState = "normal"
+	WritesSlowed  WriteState = "slowed"  // every write is delayed
+	WritesStopped WriteState = "stopped" // writes wait for compaction
+)
+
+// WriteState returns the state of writes from the level 0 tables and the
+// memtables waiting for a flush
+func (t *LSMTree) WriteState() WriteState {
+	t.levelLocks[0].RLock()
+	files := len(t.nodes[0])
+	t.levelLocks[0].RUnlock()
+	t.dataLock.RLock()
+	pending := len(t.rOnlyMemTables)
+	t.dataLock.RUnlock()
+
+	conf := t.conf.Storage
+	switch {
+	case over(files, conf.L0StopFiles) || over(pending, conf.MaxPendingFlushes):
+		return WritesStopped
+	case over(files, conf.L0SlowdownFiles):
+		return WritesSlowed
+	}
+	return WritesNormal
+}
+
+// over reports whether n reached a trigger, negative triggers are disabled
+func over(n, trigger int) bool {
+	return trigger > 0 && n >= trigger
+}
+
+// Throttle is called before a write, or a batch of them, so heavy writes
+// don't outrun compaction. It delays the write while the tree is slowed and
+// blocks it while stopped, failing with ErrWriteStall if compaction doesn't
+// catch up within the write stall timeout
+func (t *LSMTree) Throttle() error {
+	switch t.WriteState() {
+	case WritesNormal:
+		return nil
+	case WritesSlowed:
+		t.stalls.slowed.Add(1)
+		time.Sleep(writeSlowdownDelay)
+		return nil
+	}
+
+	t.stalls.stopped.Add(1)
+	start := time.Now()
+	deadline := start.Add(time.Duration(t.conf.Storage.WriteStallSeconds) * time.Second)
+	ticker := time.NewTicker(stallPollInterval)
+	defer ticker.Stop()
+	for t.WriteState() == WritesStopped {
+		if !time.Now().Before(deadline) {
+			t.stalls.failed.Add(1)
+			logger.Warn("Write failed after waiting for compaction", "waited", time.Since(start))
+			return errors.ErrWriteStall
+		}
+		select {
+		case <-ticker.C:
+		case <-t.stopCh:
+			return errors.ErrWriteStall
+		}
+	}
+	return nil
+}
+
+// writeStalls counts the writes held back by Throttle
+type writeStalls struct {
+	slowed  atomic.Uint64 // writes delayed
+	stopped atomic.Uint64 // writes that waited for compaction
+	failed  atomic.Uint64 // writes that gave up waiting
+}
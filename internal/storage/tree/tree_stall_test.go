@@ -0,0 +1,70 @@
+package tree
+
+import (
+	"errors"
+	"fmt"
+	"testing"
+	"time"
+
+	pkgerrors "oasisdb/pkg/errors"
+)
+
+func TestLSMTreeWriteStall(t *testing.T) {
+	lsm, tmpDir := setupTestLSMTree(t)
+	defer cleanupTestLSMTree(t, lsm, tmpDir)
+	lsm.conf.Storage.L0SlowdownFiles = 2
+	lsm.conf.Storage.L0StopFiles = 3
+	lsm.conf.Storage.WriteStallSeconds = -1
+
+	flush := func(table int) {
+		memTable := lsm.conf.MemTableConstructor()
+		for i := 0; i < 10; i++ {
+			memTable.Put([]byte(fmt.Sprintf("key%03d", i)), []byte(fmt.Sprintf("value%d", table)), uint64(table+1), 0)
+		}
+		lsm.flushMemTable(memTable)
+	}
+
+	if state := lsm.WriteState(); state != WritesNormal {
+		t.Fatalf("expected normal writes, got %s", state)
+	}
+	flush(0)
+	flush(1)
+	if state := lsm.WriteState(); state != WritesSlowed {
+		t.Fatalf("expected slowed writes with 2 level 0 tables, got %s", state)
+	}
+	if err := lsm.Throttle(); err != nil {
+		t.Fatalf("slowed writes must not fail: %v", err)
+	}
+
+	flush(2)
+	if state := lsm.WriteState(); state != WritesStopped {
+		t.Fatalf("expected stopped writes with 3 level 0 tables, got %s", state)
+	}
+	if err := lsm.Throttle(); !errors.Is(err, pkgerrors.ErrWriteStall) {
+		t.Fatalf("expected a write stall error, got %v", err)
+	}
+
+	// a stopped write goes on once compaction caught up
+	lsm.conf.Storage.WriteStallSeconds = 5
+	done := make(chan error, 1)
+	go func() { done <- lsm.Throttle() }()
+	for lsm.stalls.stopped.Load() < 2 {
+		time.Sleep(time.Millisecond)
+	}
+	if err := lsm.Compact(0); err != nil {
+		t.Fatalf("Compact failed: %v", err)
+	}
+	select {
+	case err := <-done:
+		if err != nil {
+			t.Fatalf("expected the write to go on after compaction, got %v", err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("write still stalled after compaction")
+	}
+
+	status := lsm.CompactionStatus()
+	if status.Writes != WritesNormal || status.SlowedWrites != 1 || status.StoppedWrites != 2 || status.FailedWrites != 1 {
+		t.Fatalf("unexpected write stall status: %+v", status)
+	}
+}
@@ -0,0 +1,124 @@
+package tree
+
+import (
+	"sync"
+	"time"
+)
+
+// CompactionStatus describes the levels of the tree and the work of the
+// compaction goroutine
+type CompactionStatus struct {
+	Levels         []LevelStatus
+	Alive          bool          // the compaction goroutine is running
+	PendingFlushes int           // read only memtables not written to level 0 yet
+	QueueDepth     int           // queued flush and level compactions
+	Flushes        uint64        // memtables written to level 0 since start
+	LastFlush      time.Duration // duration of the last memtable flush
+
+	Writes        WriteState // whether writes are slowed down or stopped
+	SlowedWrites  uint64     // writes delayed since start
+	StoppedWrites uint64     // writes that waited for compaction since start
+	FailedWrites  uint64     // writes that failed waiting for compaction since start
+}
+
+// LevelStatus describes one level, compactions of a level move its data to
+// the next one
+type LevelStatus struct {
+	Level         int
+	Files         int
+	Bytes         uint64
+	Pending       bool // a compaction of the level is queued
+	Running       bool // the level is being compacted
+	Compactions   uint64
+	LastDuration  time.Duration
+	LastCompacted time.Time // zero if the level wasn't compacted since start
+}
+
+// compactionStats tracks the queued and finished compactions
+type compactionStats struct {
+	mu        sync.Mutex
+	alive     bool // the compaction goroutine is running
+	running   int  // level being compacted, -1 if none
+	count     []uint64
+	last      []time.Duration
+	lastAt    []time.Time
+	flushes   uint64
+	lastFlush time.Duration
+}
+
+func newCompactionStats(levels int) compactionStats {
+	return compactionStats{
+		running: -1,
+		count:   make([]uint64, levels),
+		last:    make([]time.Duration, levels),
+		lastAt:  make([]time.Time, levels),
+	}
+}
+
+// setAlive records whether the compaction goroutine is running
+func (s *compactionStats) setAlive(alive bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.alive = alive
+}
+
+func (s *compactionStats) start(level int) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.running = level
+}
+
+func (s *compactionStats) finish(level int, start time.Time) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.running = -1
+	s.count[level]++
+	s.last[level] = time.Since(start)
+	s.lastAt[level] = time.Now()
+}
+
+func (s *compactionStats) flushed(start time.Time) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.flushes++
+	s.lastFlush = time.Since(start)
+}
+
+// CompactionStatus returns the size of every level and the state of the
+// compactions
+func (t *LSMTree) CompactionStatus() CompactionStatus {
+	status := CompactionStatus{Levels: make([]LevelStatus, len(t.nodes))}
+	for level := range t.nodes {
+		t.levelLocks[level].RLock()
+		status.Levels[level] = LevelStatus{Level: level, Files: len(t.nodes[level])}
+		for _, node := range t.nodes[level] {
+			status.Levels[level].Bytes += node.size
+		}
+		t.levelLocks[level].RUnlock()
+	}
+
+	t.dataLock.RLock()
+	status.PendingFlushes = len(t.rOnlyMemTables)
+	t.dataLock.RUnlock()
+	status.QueueDepth = t.queue.depth()
+	for level := range status.Levels {
+		status.Levels[level].Pending = t.queue.pending(compactTask(level))
+	}
+
+	status.Writes = t.WriteState()
+	status.SlowedWrites = t.stalls.slowed.Load()
+	status.StoppedWrites = t.stalls.stopped.Load()
+	status.FailedWrites = t.stalls.failed.Load()
+
+	t.stats.mu.Lock()
+	defer t.stats.mu.Unlock()
+	for level := range status.Levels {
+		status.Levels[level].Running = t.stats.running == level
+		status.Levels[level].Compactions = t.stats.count[level]
+		status.Levels[level].LastDuration = t.stats.last[level]
+		status.Levels[level].LastCompacted = t.stats.lastAt[level]
+	}
+	status.Alive = t.stats.alive
+	status.Flushes, status.LastFlush = t.stats.flushes, t.stats.lastFlush
+	return status
+}
@@ -0,0 +1,162 @@
+package tree
+
+import (
+	stderrors "errors"
+	"fmt"
+	"os"
+	"sync"
+	"time"
+
+	"oasisdb/pkg/logger"
+)
+
+// WAL sync modes, see storage.wal_sync
+const (
+	WALSyncNone       = "none"       // the OS writes the WAL back when it sees fit
+	WALSyncBackground = "background" // fsync periodically, writes don't wait for it
+	WALSyncGroup      = "group"      // writes wait for an fsync shared with concurrent ones
+)
+
+var errSyncStopped = stderrors.New("lsm tree stopped before the write was synced")
+
+// walSyncer fsyncs the WAL of the memtable from a goroutine, so concurrent
+// writes share one fsync instead of paying for one each. A nil walSyncer
+// leaves the WAL to the OS
+type walSyncer struct {
+	group    bool          // writes wait for the fsync covering them
+	interval time.Duration // between background fsyncs
+
+	mu      sync.Mutex
+	cond    *sync.Cond
+	written uint64 // seq of the newest write
+	synced  uint64 // seq of the newest write on stable storage
+	failed  uint64 // seq of the newest write whose fsync failed
+	err     error  // error of that fsync
+	closing bool   // the goroutine is doing its last fsync
+	stopped bool
+	exited  chan struct{}
+}
+
+func newWALSyncer(mode string, interval time.Duration) *walSyncer {
+	if mode == "" || mode == WALSyncNone {
+		return nil
+	}
+	s := &walSyncer{group: mode == WALSyncGroup, interval: interval, exited: make(chan struct{})}
+	s.cond = sync.NewCond(&s.mu)
+	return s
+}
+
+// write records the seq of a write to the WAL
+func (s *walSyncer) write(seq uint64) {
+	if s == nil {
+		return
+	}
+	s.mu.Lock()
+	s.written = max(s.written, seq)
+	s.mu.Unlock()
+	if s.group {
+		s.cond.Broadcast()
+	}
+}
+
+// wait returns once the write at seq is on stable storage with group
+// commit, at once otherwise
+func (s *walSyncer) wait(seq uint64) error {
+	if s == nil || !s.group {
+		return nil
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for s.synced < seq {
+		if s.failed >= seq {
+			return fmt.Errorf("failed to sync WAL: %w", s.err)
+		}
+		if s.stopped {
+			return errSyncStopped
+		}
+		s.cond.Wait()
+	}
+	return nil
+}
+
+// record records the result of an fsync of the writes up to seq
+func (s *walSyncer) record(seq uint64, err error) {
+	s.mu.Lock()
+	if err != nil {
+		s.failed, s.err = max(s.failed, seq), err
+	} else {
+		s.synced = max(s.synced, seq)
+	}
+	s.mu.Unlock()
+	s.cond.Broadcast()
+}
+
+// next blocks until there are writes to sync, false once stopped
+func (s *walSyncer) next(stopCh <-chan struct{}) bool {
+	if !s.group {
+		timer := time.NewTimer(s.interval)
+		defer timer.Stop()
+		select {
+		case <-timer.C:
+		case <-stopCh:
+			return false
+		}
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for s.group && s.written <= max(s.synced, s.failed) && !s.closing {
+		s.cond.Wait()
+	}
+	return !s.closing
+}
+
+// stop waits for the last fsync of the goroutine, writes not covered by it
+// fail from then on
+func (s *walSyncer) stop() {
+	if s == nil {
+		return
+	}
+	s.mu.Lock()
+	s.closing = true
+	s.mu.Unlock()
+	s.cond.Broadcast()
+	<-s.exited
+}
+
+// syncWAL is the goroutine of the walSyncer, each fsync covers every write
+// made before it started
+func (t *LSMTree) syncWAL() {
+	defer close(t.syncer.exited)
+	for t.syncer.next(t.stopCh) {
+		t.syncWALOnce()
+	}
+	// writes acknowledged before the background fsync reach the disk on stop
+	t.syncWALOnce()
+	t.syncer.mu.Lock()
+	t.syncer.stopped = true
+	t.syncer.mu.Unlock()
+	t.syncer.cond.Broadcast()
+}
+
+func (t *LSMTree) syncWALOnce() {
+	t.dataLock.RLock()
+	writer, seq := t.walWriter, t.seq
+	t.dataLock.RUnlock()
+	t.syncer.mu.Lock()
+	pending := seq > t.syncer.synced
+	t.syncer.mu.Unlock()
+	if !pending {
+		return
+	}
+
+	err := writer.Sync()
+	if stderrors.Is(err, os.ErrClosed) {
+		// the memtable was refreshed meanwhile, its WAL was synced before it
+		// was closed and the next round syncs the new one
+		return
+	}
+	if err != nil {
+		logger.Error("Failed to sync WAL", "error", err)
+	}
+	t.syncer.record(seq, err)
+}
@@ -0,0 +1,95 @@
+package tree
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"sync"
+	"testing"
+
+	"oasisdb/internal/config"
+)
+
+func newSyncedTestLSMTree(t *testing.T, mode string) *LSMTree {
+	t.Helper()
+	conf, err := config.NewConfig(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	conf.Storage.WALSync = mode
+	conf.Storage.WALSyncIntervalMs = 1
+	lsm, err := NewLSMTree(conf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return lsm
+}
+
+func TestLSMTreeGroupCommit(t *testing.T) {
+	lsm := newSyncedTestLSMTree(t, WALSyncGroup)
+
+	var wg sync.WaitGroup
+	errs := make(chan error, 16)
+	for i := 0; i < 16; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for j := 0; j < 20; j++ {
+				if err := lsm.Put([]byte(fmt.Sprintf("key%d_%d", i, j)), []byte("value")); err != nil {
+					errs <- err
+					return
+				}
+			}
+		}()
+	}
+	wg.Wait()
+	close(errs)
+	for err := range errs {
+		t.Fatalf("Put failed: %v", err)
+	}
+	if err := lsm.PutBatch([][]byte{[]byte("a"), []byte("b")}, [][]byte{[]byte("1"), []byte("2")}); err != nil {
+		t.Fatalf("PutBatch failed: %v", err)
+	}
+
+	// every acknowledged write was synced
+	lsm.syncer.mu.Lock()
+	synced := lsm.syncer.synced
+	lsm.syncer.mu.Unlock()
+	if seq := lsm.Seq(); synced < seq {
+		t.Fatalf("expected writes up to %d synced, got %d", seq, synced)
+	}
+
+	// the preallocated space doesn't show in the WAL
+	info, err := os.Stat(lsm.newWalFile())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if info.Size() >= lsm.conf.Storage.WALPreallocateBytes {
+		t.Fatalf("expected the WAL to keep the size of its records, got %d", info.Size())
+	}
+
+	lsm.Stop()
+	if err := lsm.Put([]byte("late"), []byte("value")); !errors.Is(err, errSyncStopped) {
+		t.Fatalf("expected a write after stop to fail, got %v", err)
+	}
+}
+
+func TestLSMTreeBackgroundSync(t *testing.T) {
+	lsm := newSyncedTestLSMTree(t, WALSyncBackground)
+	for i := 0; i < 10; i++ {
+		if err := lsm.Put([]byte(fmt.Sprint("key", i)), []byte("value")); err != nil {
+			t.Fatalf("Put failed: %v", err)
+		}
+	}
+
+	// stopping syncs the writes the background fsync didn't cover yet
+	lsm.Stop()
+	if synced := lsm.syncer.synced; synced != lsm.Seq() {
+		t.Fatalf("expected writes up to %d synced on stop, got %d", lsm.Seq(), synced)
+	}
+
+	// without sync mode the WAL is left to the OS
+	if newWALSyncer(WALSyncNone, 0) != nil || newWALSyncer("", 0) != nil {
+		t.Fatal("expected no syncer without a sync mode")
+	}
+}
@@ -5,10 +5,12 @@ import (
 	"fmt"
 	"os"
 	"path"
+	"sync"
 	"testing"
 	"time"
 
 	"oasisdb/internal/config"
+	"oasisdb/internal/storage/wal"
 )
 
 func setupTestLSMTree(t *testing.T) (*LSMTree, string) {
@@ -148,3 +150,499 @@ func TestLSMTreeCompaction(t *testing.T) {
 		}
 	}
 }
+
+func TestLSMTreeRestoreThenWrite(t *testing.T) {
+	lsm, tmpDir := setupTestLSMTree(t)
+	defer os.RemoveAll(tmpDir)
+
+	for table := 0; table < 2; table++ {
+		memTable := lsm.conf.MemTableConstructor()
+		for i := 0; i < 10; i++ {
+			memTable.Put([]byte(fmt.Sprintf("key%03d", i)), []byte(fmt.Sprintf("value%d", table)), uint64(100*(table+1)), 0)
+		}
+		lsm.flushMemTable(memTable)
+	}
+	if err := lsm.Put([]byte("wal_key"), []byte("wal_value")); err != nil {
+		t.Fatalf("Put failed: %v", err)
+	}
+	lsm.Stop()
+	// read-only memtables are flushed while the others are restored
+	for i := 0; i < 20; i++ {
+		entries := make(map[string]string, 200)
+		for j := 0; j < 200; j++ {
+			entries[fmt.Sprintf("wal%02d_%03d", i, j)] = "w"
+		}
+		writeTestWAL(t, lsm.conf, fmt.Sprintf("%d.wal", 1000+i), entries)
+	}
+
+	// writes start while the restored tree compacts its tables
+	lsm, err := NewLSMTree(lsm.conf)
+	if err != nil {
+		t.Fatalf("failed to restore tree: %v", err)
+	}
+	defer lsm.Stop()
+	if seq := lsm.Seq(); seq < 200 {
+		t.Fatalf("expected the restored seq to continue after the tables, got %d", seq)
+	}
+	var wg sync.WaitGroup
+	for w := 0; w < 4; w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := 0; i < 50; i++ {
+				if err := lsm.Put([]byte(fmt.Sprintf("new%d_%03d", w, i)), []byte("v")); err != nil {
+					t.Errorf("Put failed: %v", err)
+				}
+				lsm.Seq()
+			}
+		}()
+	}
+	if err := lsm.Compact(0); err != nil {
+		t.Fatalf("Compact failed: %v", err)
+	}
+	wg.Wait()
+	deadline := time.Now().Add(5 * time.Second)
+	for lsm.CompactionStatus().Levels[0].Compactions == 0 {
+		if time.Now().After(deadline) {
+			t.Fatal("manual compaction did not run")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	for key, want := range map[string]string{"key005": "value1", "wal_key": "wal_value", "wal07_123": "w", "new3_049": "v"} {
+		if value, ok, err := lsm.Get([]byte(key)); err != nil || !ok || string(value) != want {
+			t.Fatalf("expected %s for %s, got %q %v %v", want, key, value, ok, err)
+		}
+	}
+}
+
+func TestLSMTreeCompactLevelKeepsNewestValues(t *testing.T) {
+	lsm, tmpDir := setupTestLSMTree(t)
+	defer cleanupTestLSMTree(t, lsm, tmpDir)
+
+	// three overlapping level 0 tables, each newer than the one before
+	for round := 0; round < 3; round++ {
+		memTable := lsm.conf.MemTableConstructor()
+		for i := round; i < 100; i += round + 1 {
+			memTable.Put([]byte(fmt.Sprintf("key_%03d", i)), []byte(fmt.Sprintf("value_%d_%d", i, round)), uint64(round+1), uint64(round+1))
+		}
+		lsm.flushMemTable(memTable)
+	}
+	if len(lsm.nodes[0]) != 3 {
+		t.Fatalf("expected 3 level 0 nodes, got %d", len(lsm.nodes[0]))
+	}
+
+	lsm.compactLevel(0)
+	if len(lsm.nodes[0]) != 0 || len(lsm.nodes[1]) == 0 {
+		t.Fatalf("expected level 0 to be compacted into level 1, got %d and %d nodes", len(lsm.nodes[0]), len(lsm.nodes[1]))
+	}
+
+	for i := 0; i < 100; i++ {
+		round := 0
+		switch {
+		case i >= 2 && i%3 == 2:
+			round = 2
+		case i >= 1 && i%2 == 1:
+			round = 1
+		}
+		key := []byte(fmt.Sprintf("key_%03d", i))
+		expected := []byte(fmt.Sprintf("value_%d_%d", i, round))
+		value, exists, err := lsm.Get(key)
+		if err != nil || !exists {
+			t.Fatalf("Get %s: exists=%v err=%v", key, exists, err)
+		}
+		if !bytes.Equal(value, expected) {
+			t.Errorf("For key %s: expected value %s, got %s", key, expected, value)
+		}
+	}
+}
+
+func TestLSMTreeCompactionCompressed(t *testing.T) {
+	lsm, tmpDir := setupTestLSMTree(t)
+	defer cleanupTestLSMTree(t, lsm, tmpDir)
+	lsm.conf.Storage.SSTDataBlockSize = 256
+
+	// level 0 tables written with every codec, each newer than the one before
+	codecs := []string{"none", "snappy", "zstd"}
+	for round, codec := range codecs {
+		lsm.conf.Storage.Compression = codec
+		memTable := lsm.conf.MemTableConstructor()
+		for i := round; i < 100; i += round + 1 {
+			memTable.Put([]byte(fmt.Sprintf("key_%03d", i)), []byte(fmt.Sprintf(`{"id":%d,"codec":"%s","tags":["a","b","c"]}`, i, codec)), uint64(round+1), uint64(round+1))
+		}
+		lsm.flushMemTable(memTable)
+	}
+
+	check := func() {
+		t.Helper()
+		for i := 0; i < 100; i++ {
+			round := 0
+			switch {
+			case i >= 2 && i%3 == 2:
+				round = 2
+			case i >= 1 && i%2 == 1:
+				round = 1
+			}
+			key := []byte(fmt.Sprintf("key_%03d", i))
+			expected := fmt.Sprintf(`{"id":%d,"codec":"%s","tags":["a","b","c"]}`, i, codecs[round])
+			value, exists, err := lsm.Get(key)
+			if err != nil || !exists {
+				t.Fatalf("Get %s: exists=%v err=%v", key, exists, err)
+			}
+			if string(value) != expected {
+				t.Errorf("For key %s: expected value %s, got %s", key, expected, value)
+			}
+		}
+	}
+	check()
+
+	// compaction reads all codecs and writes zstd
+	lsm.compactLevel(0)
+	if len(lsm.nodes[0]) != 0 || len(lsm.nodes[1]) == 0 {
+		t.Fatalf("expected level 0 to be compacted into level 1, got %d and %d nodes", len(lsm.nodes[0]), len(lsm.nodes[1]))
+	}
+	check()
+}
+
+func TestLSMTreeApproximateSizeAndWarmup(t *testing.T) {
+	lsm, tmpDir := setupTestLSMTree(t)
+	defer cleanupTestLSMTree(t, lsm, tmpDir)
+	lsm.conf.Storage.SSTDataBlockSize = 256
+
+	memTable := lsm.conf.MemTableConstructor()
+	for i := 0; i < 10; i++ {
+		memTable.Put([]byte(fmt.Sprintf("a:%03d", i)), bytes.Repeat([]byte("x"), 100), 1, 1)
+	}
+	for i := 0; i < 100; i++ {
+		memTable.Put([]byte(fmt.Sprintf("b:%03d", i)), bytes.Repeat([]byte("x"), 100), 1, 1)
+	}
+	lsm.flushMemTable(memTable)
+
+	a := lsm.ApproximateSize([]byte("a:"), []byte("a;"))
+	b := lsm.ApproximateSize([]byte("b:"), []byte("b;"))
+	all := lsm.ApproximateSize(nil, nil)
+	if a < 1000 || b < 10000 || a >= b {
+		t.Fatalf("unexpected sizes a=%d b=%d", a, b)
+	}
+	// only the block on the boundary is counted for both
+	if a+b > all+256*2 || all < 11000 {
+		t.Fatalf("sizes a=%d b=%d don't add up to %d", a, b, all)
+	}
+	if size := lsm.ApproximateSize([]byte("c:"), []byte("c;")); size != 0 {
+		t.Fatalf("expected no blocks after the last key, got %d", size)
+	}
+
+	files, n, err := lsm.Warmup()
+	if err != nil {
+		t.Fatalf("Warmup failed: %v", err)
+	}
+	if files != 1 || n < all {
+		t.Fatalf("expected one table of at least %d bytes, got %d files and %d bytes", all, files, n)
+	}
+}
+
+func TestLSMTreeSnapshot(t *testing.T) {
+	lsm, tmpDir := setupTestLSMTree(t)
+	defer func() { os.RemoveAll(tmpDir) }()
+
+	put := func(key, value string) {
+		t.Helper()
+		var v []byte
+		if value != "" {
+			v = []byte(value)
+		}
+		if err := lsm.Put([]byte(key), v); err != nil {
+			t.Fatalf("Put %s failed: %v", key, err)
+		}
+	}
+	flush := func() {
+		t.Helper()
+		lsm.dataLock.Lock()
+		lsm.refreshMemTableLocked()
+		lsm.dataLock.Unlock()
+		for deadline := time.Now().Add(5 * time.Second); ; time.Sleep(10 * time.Millisecond) {
+			lsm.dataLock.RLock()
+			flushed := len(lsm.rOnlyMemTables) == 0
+			lsm.dataLock.RUnlock()
+			if flushed {
+				return
+			}
+			if time.Now().After(deadline) {
+				t.Fatal("memtable was not flushed")
+			}
+		}
+	}
+
+	put("a", "a1")
+	put("b", "b1")
+	snapshot := lsm.Snapshot()
+	put("a", "a2")
+	put("b", "") // delete
+	put("c", "c1")
+
+	check := func(stage string) {
+		t.Helper()
+		for key, want := range map[string]string{"a": "a1", "b": "b1"} {
+			value, ok, err := lsm.GetAt([]byte(key), snapshot)
+			if err != nil || !ok || string(value) != want {
+				t.Errorf("%s: GetAt %s = %q, %v, %v, want %q", stage, key, value, ok, err, want)
+			}
+		}
+		if _, ok, _ := lsm.GetAt([]byte("c"), snapshot); ok {
+			t.Errorf("%s: c was written after the snapshot", stage)
+		}
+		if value, _, _ := lsm.Get([]byte("b")); len(value) != 0 {
+			t.Errorf("%s: b should be deleted, got %q", stage, value)
+		}
+	}
+	check("memtable")
+	flush()
+	check("level 0")
+	put("a", "a3")
+	flush()
+	lsm.compactLevel(0)
+	check("level 1")
+	if value, _, _ := lsm.Get([]byte("a")); string(value) != "a3" {
+		t.Errorf("expected the newest a, got %q", value)
+	}
+
+	// released versions are dropped by the next compaction
+	lsm.ReleaseSnapshot(snapshot)
+	put("a", "a4")
+	flush()
+	lsm.compactLevel(0)
+	node, ok := lsm.levelBinarySearch(1, []byte("a"), 0, len(lsm.nodes[1])-1)
+	if !ok {
+		t.Fatal("a should be in level 1")
+	}
+	if versions, _, err := node.versions([]byte("a")); err != nil || len(versions) != 1 || string(versions[0].Value) != "a4" {
+		t.Errorf("expected only the newest version of a, got %v, %v", versions, err)
+	}
+
+	// seqs continue after a restart
+	seq := lsm.Seq()
+	lsm.Stop()
+	lsm, err := NewLSMTree(lsm.conf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer lsm.Stop()
+	if lsm.Seq() != seq {
+		t.Errorf("expected seq %d after restart, got %d", seq, lsm.Seq())
+	}
+	if value, _, _ := lsm.Get([]byte("a")); string(value) != "a4" {
+		t.Errorf("expected a4 after restart, got %q", value)
+	}
+}
+
+func TestLSMTreeManualCompaction(t *testing.T) {
+	lsm, tmpDir := setupTestLSMTree(t)
+	defer cleanupTestLSMTree(t, lsm, tmpDir)
+
+	for table := 0; table < 2; table++ {
+		memTable := lsm.conf.MemTableConstructor()
+		for i := 0; i < 10; i++ {
+			memTable.Put([]byte(fmt.Sprintf("key%03d", i)), []byte(fmt.Sprintf("value%d", table)), uint64(table+1), 0)
+		}
+		lsm.flushMemTable(memTable)
+	}
+	status := lsm.CompactionStatus()
+	if len(status.Levels) != lsm.conf.Storage.MaxLevel || status.Levels[0].Files != 2 || status.Levels[0].Bytes == 0 {
+		t.Fatalf("unexpected status before compaction: %+v", status.Levels)
+	}
+
+	if err := lsm.Compact(-1); err == nil {
+		t.Fatal("expected an error for a negative level")
+	}
+	if err := lsm.Compact(lsm.conf.Storage.MaxLevel - 1); err == nil {
+		t.Fatal("expected an error for the last level")
+	}
+	if err := lsm.Compact(0); err != nil {
+		t.Fatalf("Compact failed: %v", err)
+	}
+
+	deadline := time.Now().Add(5 * time.Second)
+	for status = lsm.CompactionStatus(); status.Levels[0].Compactions == 0; status = lsm.CompactionStatus() {
+		if time.Now().After(deadline) {
+			t.Fatal("manual compaction did not run")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	if status.Levels[0].Files != 0 || status.Levels[1].Files == 0 || status.Levels[0].LastCompacted.IsZero() {
+		t.Fatalf("expected level 0 to be compacted into level 1, got %+v", status.Levels[:2])
+	}
+	if value, ok, err := lsm.Get([]byte("key005")); err != nil || !ok || string(value) != "value1" {
+		t.Fatalf("expected the newest value after compaction, got %q %v %v", value, ok, err)
+	}
+}
+
+func TestLSMTreeCollectsGarbage(t *testing.T) {
+	lsm, tmpDir := setupTestLSMTree(t)
+	defer os.RemoveAll(tmpDir)
+	memTable := lsm.conf.MemTableConstructor()
+	for i := 0; i < 10; i++ {
+		memTable.Put([]byte(fmt.Sprintf("key%03d", i)), []byte("flushed"), uint64(i+1), 0)
+	}
+	lsm.flushMemTable(memTable)
+	lsm.Stop()
+
+	// a crash after the flush left its WAL, a newer WAL not flushed yet and
+	// the files of an interrupted compaction
+	writeWAL := func(name string, seq uint64, value string) string {
+		file := path.Join(lsm.conf.MemTableWALDir(), name)
+		os.Remove(file)
+		writer, err := wal.NewVersionedWALWriter(file)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer writer.Close()
+		for i := 0; i < 10; i++ {
+			if err := writer.WriteVersion([]byte(fmt.Sprintf("key%03d", i)), []byte(value), seq+uint64(i)); err != nil {
+				t.Fatal(err)
+			}
+		}
+		return file
+	}
+	flushedWAL := writeWAL("0.wal", 1, "flushed")
+	writeWAL("1.wal", 11, "unflushed")
+	writeWAL("2.wal", 21, "active")
+	tmpSST := path.Join(lsm.conf.SSTDir(), "1_1.sst.tmp")
+	partialSST := path.Join(lsm.conf.SSTDir(), "1_2.sst")
+	for _, file := range []string{tmpSST, partialSST} {
+		if err := os.WriteFile(file, []byte("partial"), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// a dry run keeps the files, the incomplete table fails the load
+	lsm.conf.GC.DryRun = true
+	if _, err := NewLSMTree(lsm.conf); err == nil {
+		t.Fatal("expected the incomplete table to fail the load")
+	}
+	for _, file := range []string{flushedWAL, tmpSST, partialSST} {
+		if _, err := os.Stat(file); err != nil {
+			t.Fatalf("dry run removed %s: %v", file, err)
+		}
+	}
+
+	lsm.conf.GC.DryRun = false
+	restarted, err := NewLSMTree(lsm.conf)
+	if err != nil {
+		t.Fatalf("NewLSMTree failed: %v", err)
+	}
+	defer restarted.Stop()
+	for _, file := range []string{flushedWAL, tmpSST, partialSST} {
+		if _, err := os.Stat(file); !os.IsNotExist(err) {
+			t.Fatalf("expected %s to be removed, got %v", file, err)
+		}
+	}
+	if value, ok, err := restarted.Get([]byte("key005")); err != nil || !ok || string(value) != "active" {
+		t.Fatalf("expected the newest value, got %q %v %v", value, ok, err)
+	}
+}
+
+func TestLSMTreeScan(t *testing.T) {
+	lsm, tmpDir := setupTestLSMTree(t)
+	defer cleanupTestLSMTree(t, lsm, tmpDir)
+
+	// a table of 3000 keys, partly overwritten and deleted in the memtable
+	memTable := lsm.conf.MemTableConstructor()
+	for i := 0; i < 3000; i++ {
+		memTable.Put([]byte(fmt.Sprintf("key_%04d", i)), []byte(fmt.Sprintf("old_%d", i)), 1, 1)
+	}
+	lsm.flushMemTable(memTable)
+	for i := 0; i < 3000; i += 10 {
+		if err := lsm.Put([]byte(fmt.Sprintf("key_%04d", i)), []byte(fmt.Sprintf("new_%d", i))); err != nil {
+			t.Fatal(err)
+		}
+		if err := lsm.Put([]byte(fmt.Sprintf("key_%04d", i+1)), nil); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := lsm.Put([]byte("other"), []byte("value")); err != nil {
+		t.Fatal(err)
+	}
+
+	var keys []string
+	err := lsm.Scan([]byte("key_0100"), []byte("key_2500"), func(key, value []byte) bool {
+		i := len(keys)
+		keys = append(keys, string(key))
+		var n int
+		fmt.Sscanf(string(key), "key_%04d", &n)
+		expected := fmt.Sprintf("old_%d", n)
+		if n%10 == 0 {
+			expected = fmt.Sprintf("new_%d", n)
+		}
+		if string(value) != expected {
+			t.Errorf("key %d %s: expected value %s, got %s", i, key, expected, value)
+		}
+		return true
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	// 2400 keys of which every tenth is deleted
+	if len(keys) != 2160 {
+		t.Fatalf("expected 2160 keys, got %d", len(keys))
+	}
+	if keys[0] != "key_0100" || keys[len(keys)-1] != "key_2499" {
+		t.Errorf("unexpected range %s to %s", keys[0], keys[len(keys)-1])
+	}
+	for i := 1; i < len(keys); i++ {
+		if keys[i-1] >= keys[i] {
+			t.Fatalf("keys out of order: %s before %s", keys[i-1], keys[i])
+		}
+	}
+
+	// fn stops the scan, nil end has no upper bound
+	keys = nil
+	err = lsm.Scan([]byte("key_2998"), nil, func(key, value []byte) bool {
+		keys = append(keys, string(key))
+		return len(keys) < 10
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if fmt.Sprint(keys) != "[key_2998 key_2999 other]" {
+		t.Errorf("unexpected keys %v", keys)
+	}
+}
+
+func TestLSMTreeScanAt(t *testing.T) {
+	lsm, tmpDir := setupTestLSMTree(t)
+	defer cleanupTestLSMTree(t, lsm, tmpDir)
+
+	for _, key := range []string{"a", "b", "c"} {
+		if err := lsm.Put([]byte(key), []byte(key+"1")); err != nil {
+			t.Fatal(err)
+		}
+	}
+	seq := lsm.Snapshot()
+	defer lsm.ReleaseSnapshot(seq)
+	if err := lsm.Put([]byte("a"), []byte("a2")); err != nil {
+		t.Fatal(err)
+	}
+	if err := lsm.Put([]byte("b"), nil); err != nil {
+		t.Fatal(err)
+	}
+	if err := lsm.Put([]byte("d"), []byte("d2")); err != nil {
+		t.Fatal(err)
+	}
+
+	scan := func(seq uint64) string {
+		var pairs []string
+		if err := lsm.ScanAt(nil, nil, seq, func(key, value []byte) bool {
+			pairs = append(pairs, string(key)+"="+string(value))
+			return true
+		}); err != nil {
+			t.Fatal(err)
+		}
+		return fmt.Sprint(pairs)
+	}
+	if got := scan(seq); got != "[a=a1 b=b1 c=c1]" {
+		t.Errorf("unexpected snapshot scan %s", got)
+	}
+	if got := scan(lsm.Seq()); got != "[a=a2 c=c1 d=d2]" {
+		t.Errorf("unexpected current scan %s", got)
+	}
+}
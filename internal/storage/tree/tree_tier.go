@@ -0,0 +1,94 @@
+package tree
+
+import (
+	"oasisdb/internal/storage/sstable"
+	"oasisdb/pkg/logger"
+	"os"
+	"path"
+	"time"
+)
+
+// runTiering queues the move of the cold tables to the cold tier every
+// tier.interval_seconds until the tree is stopped
+func (t *LSMTree) runTiering() {
+	ticker := time.NewTicker(time.Duration(t.conf.Tier.IntervalSeconds) * time.Second)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+			t.queue.push(tierTask)
+		case <-t.stopCh:
+			return
+		}
+	}
+}
+
+// tierColdTables moves the local tables last modified before now minus
+// tier.after_hours to the cold tier, it runs in the compaction goroutine. A
+// moved table is read from the tier once it is swapped in, its local file is
+// removed. A table that fails to move stays local and is retried by the
+// next run
+func (t *LSMTree) tierColdTables(now time.Time) (tables int, bytes int64) {
+	defer func() {
+		if tables > 0 {
+			logger.Info("Moved cold SSTables to the tier", "tables", tables, "bytes", bytes)
+		}
+	}()
+	cutoff := now.Add(-time.Duration(t.conf.Tier.AfterHours) * time.Hour)
+	var nodes []*Node
+	for level := range t.nodes {
+		t.levelLocks[level].RLock()
+		nodes = append(nodes, t.nodes[level]...)
+		t.levelLocks[level].RUnlock()
+	}
+
+	for _, node := range nodes {
+		if t.stopped() {
+			break
+		}
+		file := path.Join(t.conf.SSTDir(), node.file)
+		info, err := os.Stat(file)
+		if err != nil || !info.ModTime().Before(cutoff) {
+			// moved already, compacted away or still hot
+			continue
+		}
+		if err := t.tierNode(node, file); err != nil {
+			logger.Warn("Failed to move SSTable to the tier", "sst_file", node.file, "error", err)
+			continue
+		}
+		tables++
+		bytes += info.Size()
+	}
+	return tables, bytes
+}
+
+// tierNode uploads the table of a node and swaps in a reader of the tier
+func (t *LSMTree) tierNode(node *Node, file string) error {
+	if err := sstable.Offload(node.file, t.conf); err != nil {
+		return err
+	}
+	// open readers keep reading the removed file
+	if err := os.Remove(file); err != nil {
+		return err
+	}
+	reader, err := sstable.NewSSTableReader(node.file, t.conf)
+	if err != nil {
+		return err
+	}
+
+	t.levelLocks[node.level].Lock()
+	current := false
+	for _, n := range t.nodes[node.level] {
+		current = current || n == node
+	}
+	if !current {
+		// compacted away meanwhile, its destruction may have missed the tail
+		t.levelLocks[node.level].Unlock()
+		reader.Close()
+		return sstable.RemoveRemote(node.file, t.conf)
+	}
+	old := node.sstReader
+	node.sstReader = reader
+	t.levelLocks[node.level].Unlock()
+	return old.Close()
+}
@@ -0,0 +1,67 @@
+package tree
+
+import (
+	"os"
+	"path"
+	"testing"
+	"time"
+
+	"oasisdb/internal/config"
+	"oasisdb/internal/storage/sstable"
+	"oasisdb/internal/tier/tiertest"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestTierColdTables(t *testing.T) {
+	dir := t.TempDir()
+	conf, err := config.NewConfig(dir)
+	require.NoError(t, err)
+	coldTier, server := tiertest.NewTier(t, path.Join(dir, "tiercache"), conf.Tier.CacheBytes)
+	conf.ColdTier = coldTier
+
+	writeTestSSTable(t, conf, "1_1.sst", [][2]string{{"a", "1"}, {"b", "2"}})
+	writeTestSSTable(t, conf, "1_2.sst", [][2]string{{"m", "13"}, {"z", "26"}})
+	old := time.Now().Add(-time.Duration(conf.Tier.AfterHours+1) * time.Hour)
+	require.NoError(t, os.Chtimes(path.Join(conf.SSTDir(), "1_1.sst"), old, old))
+
+	tree := newBareTree(conf)
+	t.Cleanup(func() { closeTreeNodes(tree) })
+	require.NoError(t, tree.constructTree())
+
+	tables, _ := tree.tierColdTables(time.Now())
+	assert.Equal(t, 1, tables, "only the cold table moves")
+	assert.Equal(t, []string{"sst/1_1.sst"}, server.Keys())
+	_, err = os.Stat(path.Join(conf.SSTDir(), "1_1.sst"))
+	assert.True(t, os.IsNotExist(err))
+	_, err = os.Stat(path.Join(conf.SSTDir(), "1_1.sst"+sstable.RemoteSuffix))
+	require.NoError(t, err)
+
+	// a key the filters rule out doesn't fetch the table
+	_, exists, err := tree.Get([]byte("aa"))
+	require.NoError(t, err)
+	assert.False(t, exists)
+	assert.Equal(t, 0, server.Gets())
+	value, exists, err := tree.Get([]byte("b"))
+	require.NoError(t, err)
+	assert.True(t, exists)
+	assert.Equal(t, []byte("2"), value)
+	assert.Equal(t, 1, server.Gets())
+
+	// a restart loads the table from its tail
+	restarted := newBareTree(conf)
+	t.Cleanup(func() { closeTreeNodes(restarted) })
+	require.NoError(t, restarted.constructTree())
+	require.Len(t, restarted.nodes[1], 2)
+	value, exists, err = restarted.Get([]byte("a"))
+	require.NoError(t, err)
+	assert.True(t, exists)
+	assert.Equal(t, []byte("1"), value)
+
+	// a compacted table is deleted from the tier
+	restarted.nodes[1][0].Destroy()
+	assert.Empty(t, server.Keys())
+	_, err = os.Stat(path.Join(conf.SSTDir(), "1_1.sst"+sstable.RemoteSuffix))
+	assert.True(t, os.IsNotExist(err))
+}
@@ -2,6 +2,8 @@ package wal
 
 import (
 	"bytes"
+	"errors"
+	"io"
 	"os"
 	"path/filepath"
 	"testing"
@@ -9,7 +11,7 @@ import (
 
 func TestWALReaderReadAllRejectsMalformedVarint(t *testing.T) {
 	reader := &WALReader{}
-	_, err := reader.readAll(bytes.NewReader(bytes.Repeat([]byte{0x80}, 11)))
+	_, _, err := reader.readAll(bytes.NewReader(bytes.Repeat([]byte{0x80}, 11)))
 	if err == nil {
 		t.Fatal("expected malformed varint to fail")
 	}
@@ -17,7 +19,7 @@ func TestWALReaderReadAllRejectsMalformedVarint(t *testing.T) {
 
 func TestWALReaderReadAllRejectsMissingValueLength(t *testing.T) {
 	reader := &WALReader{}
-	_, err := reader.readAll(bytes.NewReader([]byte{1}))
+	_, _, err := reader.readAll(bytes.NewReader([]byte{1}))
 	if err == nil {
 		t.Fatal("expected truncated value length to fail")
 	}
@@ -25,7 +27,7 @@ func TestWALReaderReadAllRejectsMissingValueLength(t *testing.T) {
 
 func TestWALReaderReadAllRejectsMissingKeyBytes(t *testing.T) {
 	reader := &WALReader{}
-	_, err := reader.readAll(bytes.NewReader([]byte{1, 1}))
+	_, _, err := reader.readAll(bytes.NewReader([]byte{1, 1}))
 	if err == nil {
 		t.Fatal("expected truncated key bytes to fail")
 	}
@@ -33,16 +35,77 @@ func TestWALReaderReadAllRejectsMissingKeyBytes(t *testing.T) {
 
 func TestWALReaderReadAllRejectsMissingValueBytes(t *testing.T) {
 	reader := &WALReader{}
-	_, err := reader.readAll(bytes.NewReader([]byte{1, 1, 'k'}))
+	_, _, err := reader.readAll(bytes.NewReader([]byte{1, 1, 'k'}))
 	if err == nil {
 		t.Fatal("expected truncated value bytes to fail")
 	}
 }
 
+func TestWALReaderReadAllReturnsRecordsBeforeTornRecord(t *testing.T) {
+	reader := &WALReader{}
+	kvs, good, err := reader.readAll(bytes.NewReader([]byte{1, 1, 'k', 'v', 1, 200, 1, 'k'}))
+	if !errors.Is(err, io.ErrUnexpectedEOF) {
+		t.Fatalf("expected io.ErrUnexpectedEOF for the torn record, got %v", err)
+	}
+	if len(kvs) != 1 || string(kvs[0].Key) != "k" || string(kvs[0].Value) != "v" {
+		t.Fatalf("expected the complete record, got %v", kvs)
+	}
+	if good != 4 {
+		t.Fatalf("expected the torn record to start at 4, got %d", good)
+	}
+}
+
+func TestWALReaderRestoreToMemtableTruncatesTornRecord(t *testing.T) {
+	tmpDir := t.TempDir()
+	walFile := filepath.Join(tmpDir, "torn.wal")
+	writer, err := NewWALWriter(walFile)
+	if err != nil {
+		t.Fatalf("failed to create wal writer: %v", err)
+	}
+	if err := writer.Write([]byte("key"), []byte("value")); err != nil {
+		t.Fatalf("failed to write: %v", err)
+	}
+	writer.Close()
+	info, err := os.Stat(walFile)
+	if err != nil {
+		t.Fatalf("failed to stat wal file: %v", err)
+	}
+	// a crash in the middle of the next write
+	file, err := os.OpenFile(walFile, os.O_WRONLY|os.O_APPEND, 0644)
+	if err != nil {
+		t.Fatalf("failed to open wal file: %v", err)
+	}
+	if _, err := file.Write([]byte{3, 5, 'k'}); err != nil {
+		t.Fatalf("failed to write torn record: %v", err)
+	}
+	file.Close()
+
+	reader, err := NewWALReader(walFile)
+	if err != nil {
+		t.Fatalf("failed to create reader: %v", err)
+	}
+	defer reader.Close()
+
+	memTable := NewMockMemTable()
+	if err := reader.RestoreToMemtable(memTable); err != nil {
+		t.Fatalf("expected restore to go on past the torn record: %v", err)
+	}
+	if value, ok := memTable.Get([]byte("key")); !ok || string(value) != "value" {
+		t.Fatalf("expected the record before the torn one, got %q, %v", value, ok)
+	}
+	truncated, err := os.Stat(walFile)
+	if err != nil {
+		t.Fatalf("failed to stat wal file: %v", err)
+	}
+	if truncated.Size() != info.Size() {
+		t.Fatalf("expected the file truncated to %d bytes, got %d", info.Size(), truncated.Size())
+	}
+}
+
 func TestWALReaderRestoreToMemtableReturnsDecodeError(t *testing.T) {
 	tmpDir := t.TempDir()
 	walFile := filepath.Join(tmpDir, "broken.wal")
-	if err := os.WriteFile(walFile, []byte{1}, 0644); err != nil {
+	if err := os.WriteFile(walFile, bytes.Repeat([]byte{0x80}, 11), 0644); err != nil {
 		t.Fatalf("failed to write broken wal file: %v", err)
 	}
 
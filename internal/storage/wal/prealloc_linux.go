@@ -0,0 +1,14 @@
+package wal
+
+import (
+	"os"
+	"syscall"
+)
+
+// fallocKeepSize is FALLOC_FL_KEEP_SIZE, the blocks are allocated but the
+// file keeps the size of its records, so readers don't see the reserved space
+const fallocKeepSize = 0x1
+
+func preallocate(file *os.File, size int64) error {
+	return syscall.Fallocate(int(file.Fd()), fallocKeepSize, 0, size)
+}
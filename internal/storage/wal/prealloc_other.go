@@ -0,0 +1,10 @@
+//go:build !linux
+
+package wal
+
+import "os"
+
+// preallocate is only supported on Linux, elsewhere appends allocate blocks
+func preallocate(file *os.File, size int64) error {
+	return nil
+}
@@ -5,15 +5,21 @@ import (
 	"bytes"
 	"encoding/binary"
 	"errors"
+	"fmt"
 	"io"
 	"oasisdb/internal/storage/memtable"
+	"oasisdb/pkg/logger"
 	"os"
 )
 
 type WALReader struct {
-	file   string
-	src    *os.File
-	reader *bufio.Reader
+	file      string
+	src       *os.File
+	reader    *bufio.Reader
+	started   bool   // the first record was read
+	versioned bool   // records carry a seq, see NewVersionedWALWriter
+	maxSeq    uint64 // newest seq restored
+	offset    int64  // offset after the last record read by Next
 }
 
 func NewWALReader(file string) (*WALReader, error) {
@@ -29,6 +35,10 @@ func NewWALReader(file string) (*WALReader, error) {
 	}, nil
 }
 
+// RestoreToMemtable puts all records into memTable. Records of WALs written
+// before seqs have seq 0, MaxSeq returns the newest seq afterwards. A torn
+// last record, left by a crash in the middle of a write, was never
+// acknowledged, so the file is truncated to the records before it
 func (w *WALReader) RestoreToMemtable(memTable memtable.MemTable) error {
 	// read all content
 	body, err := io.ReadAll(w.reader)
@@ -39,24 +49,143 @@ func (w *WALReader) RestoreToMemtable(memTable memtable.MemTable) error {
 	// reset file offset to start
 	defer func() {
 		_, _ = w.src.Seek(0, io.SeekStart)
+		w.reader.Reset(w.src)
+		w.started = false
+		w.offset = 0
 	}()
 
 	// parse content
-	kvs, err := w.readAll(bytes.NewReader(body))
-	if err != nil {
+	kvs, good, err := w.readAll(bytes.NewReader(body))
+	if errors.Is(err, io.ErrUnexpectedEOF) {
+		logger.Warn("Truncating torn WAL record", "file", w.file, "offset", good, "size", len(body))
+		if err := os.Truncate(w.file, good); err != nil {
+			return fmt.Errorf("failed to truncate torn WAL record: %w", err)
+		}
+	} else if err != nil {
 		return err
 	}
+	if len(kvs) > 0 && isVersionHeader(kvs[0]) {
+		w.versioned = true
+		kvs = kvs[1:]
+	}
 
 	// inject all kv data to memtable
 	for _, kv := range kvs {
-		memTable.Put(kv.Key, kv.Value)
+		if w.versioned {
+			if err := splitSeq(kv); err != nil {
+				return err
+			}
+		}
+		w.maxSeq = max(w.maxSeq, kv.Seq)
+		memTable.Put(kv.Key, kv.Value, kv.Seq, kv.Seq)
+	}
+
+	return nil
+}
+
+// Versioned reports whether the records read so far carry seqs
+func (w *WALReader) Versioned() bool {
+	return w.versioned
+}
+
+// MaxSeq returns the newest seq restored by RestoreToMemtable
+func (w *WALReader) MaxSeq() uint64 {
+	return w.maxSeq
+}
+
+// Offset returns the offset after the last complete record read by Next, a
+// file ending inside a record is truncated to it
+func (w *WALReader) Offset() int64 {
+	return w.offset
+}
+
+// Next reads the next record in write order, it returns io.EOF after the last
+// record and io.ErrUnexpectedEOF if the file ends inside a record
+func (w *WALReader) Next() (*memtable.KVPair, error) {
+	kv, err := w.next()
+	if err != nil {
+		return nil, err
+	}
+	if !w.started {
+		w.started = true
+		if isVersionHeader(kv) {
+			w.versioned = true
+			if kv, err = w.next(); err != nil {
+				return nil, err
+			}
+		}
+	}
+	if w.versioned {
+		if err := splitSeq(kv); err != nil {
+			return nil, err
+		}
+	}
+	return kv, nil
+}
+
+func (w *WALReader) next() (*memtable.KVPair, error) {
+	keyLen, err := binary.ReadUvarint(w.reader)
+	if err != nil {
+		return nil, err
+	}
+	valLen, err := binary.ReadUvarint(w.reader)
+	if err != nil {
+		return nil, truncated(err)
+	}
+
+	keyBuf := make([]byte, keyLen)
+	if _, err := io.ReadFull(w.reader, keyBuf); err != nil {
+		return nil, truncated(err)
+	}
+	valBuf := make([]byte, valLen)
+	if _, err := io.ReadFull(w.reader, valBuf); err != nil {
+		return nil, truncated(err)
+	}
+	w.offset += int64(uvarintLen(keyLen) + uvarintLen(valLen) + len(keyBuf) + len(valBuf))
+
+	return &memtable.KVPair{
+		Key:   keyBuf,
+		Value: valBuf,
+	}, nil
+}
+
+// uvarintLen returns the size of x encoded as a uvarint
+func uvarintLen(x uint64) int {
+	n := 1
+	for ; x >= 0x80; x >>= 7 {
+		n++
 	}
+	return n
+}
 
+func isVersionHeader(kv *memtable.KVPair) bool {
+	return len(kv.Key) == 0 && bytes.Equal(kv.Value, versionHeader)
+}
+
+// splitSeq moves the seq a versioned record starts its value with to Seq
+func splitSeq(kv *memtable.KVPair) error {
+	seq, n := binary.Uvarint(kv.Value)
+	if n <= 0 {
+		return fmt.Errorf("record of key %q has no seq", kv.Key)
+	}
+	kv.Seq, kv.Value = seq, kv.Value[n:]
 	return nil
 }
 
-func (w *WALReader) readAll(reader *bytes.Reader) ([]*memtable.KVPair, error) {
+// truncated reports the end of the file inside a record as unexpected
+func truncated(err error) error {
+	if errors.Is(err, io.EOF) {
+		return io.ErrUnexpectedEOF
+	}
+	return err
+}
+
+// readAll parses the records of a WAL and returns them with the offset after
+// the last complete one. If the content ends inside a record it returns the
+// records before it and io.ErrUnexpectedEOF
+func (w *WALReader) readAll(reader *bytes.Reader) ([]*memtable.KVPair, int64, error) {
 	var kvs []*memtable.KVPair
+	var good int64
 	for {
 		// read key length
 		keyLen, err := binary.ReadUvarint(reader)
@@ -65,42 +194,40 @@ func (w *WALReader) readAll(reader *bytes.Reader) ([]*memtable.KVPair, error) {
 			break
 		}
 		if err != nil {
-			return nil, err
+			return kvs, good, err
 		}
 
 		// read value length
-		if errors.Is(err, io.EOF) {
-			break
-		}
+		valLen, err := binary.ReadUvarint(reader)
 		if err != nil {
-			return nil, err
+			return kvs, good, truncated(err)
 		}
 
-		// read value length
-		valLen, err := binary.ReadUvarint(reader)
-		if err != nil {
-			return nil, err
+		// a length past the end is a torn record, not one to allocate for
+		if keyLen > uint64(reader.Len()) || valLen > uint64(reader.Len())-keyLen {
+			return kvs, good, io.ErrUnexpectedEOF
 		}
 
 		// read key
 		keyBuf := make([]byte, keyLen)
 		if _, err = io.ReadFull(reader, keyBuf); err != nil {
-			return nil, err
+			return kvs, good, truncated(err)
 		}
 
 		// read value
 		valBuf := make([]byte, valLen)
 		if _, err = io.ReadFull(reader, valBuf); err != nil {
-			return nil, err
+			return kvs, good, truncated(err)
 		}
 
 		kvs = append(kvs, &memtable.KVPair{
 			Key:   keyBuf,
 			Value: valBuf,
 		})
+		good = reader.Size() - int64(reader.Len())
 	}
 
-	return kvs, nil
+	return kvs, good, nil
 }
 
 func (w *WALReader) Close() {
@@ -1,6 +1,7 @@
 package wal
 
 import (
+	"io"
 	"oasisdb/internal/storage/memtable"
 	"os"
 	"path/filepath"
@@ -19,7 +20,7 @@ func NewMockMemTable() *MockMemTable {
 	}
 }
 
-func (m *MockMemTable) Put(key, value []byte) error {
+func (m *MockMemTable) Put(key, value []byte, seq, keep uint64) error {
 	m.data[string(key)] = value
 	return nil
 }
@@ -29,6 +30,10 @@ func (m *MockMemTable) Get(key []byte) ([]byte, bool) {
 	return value, exists
 }
 
+func (m *MockMemTable) GetAt(key []byte, seq uint64) ([]byte, bool) {
+	return m.Get(key)
+}
+
 func (m *MockMemTable) All() []*memtable.KVPair {
 	var pairs []*memtable.KVPair
 	for k, v := range m.data {
@@ -156,6 +161,65 @@ func TestWALReader_RestoreToMemtable(t *testing.T) {
 	}
 }
 
+// TestWALReader_Next tests reading records one by one
+func TestWALReader_Next(t *testing.T) {
+	tmpDir := t.TempDir()
+	walFile := filepath.Join(tmpDir, "test.wal")
+
+	writer, err := NewWALWriter(walFile)
+	if err != nil {
+		t.Fatalf("Failed to create WAL writer: %v", err)
+	}
+	keys := []string{"key1", "key2", "key3"}
+	for _, key := range keys {
+		if err := writer.Write([]byte(key), []byte("value-"+key)); err != nil {
+			t.Fatalf("Failed to write test data: %v", err)
+		}
+	}
+	writer.Close()
+
+	// cut the last record short
+	info, err := os.Stat(walFile)
+	if err != nil {
+		t.Fatalf("Failed to stat WAL file: %v", err)
+	}
+	if err := os.Truncate(walFile, info.Size()-2); err != nil {
+		t.Fatalf("Failed to truncate WAL file: %v", err)
+	}
+
+	reader, err := NewWALReader(walFile)
+	if err != nil {
+		t.Fatalf("Failed to create WAL reader: %v", err)
+	}
+	defer reader.Close()
+
+	for _, key := range keys[:2] {
+		kv, err := reader.Next()
+		if err != nil {
+			t.Fatalf("Failed to read record %s: %v", key, err)
+		}
+		if string(kv.Key) != key || string(kv.Value) != "value-"+key {
+			t.Errorf("Record mismatch: expected %s, got %s=%s", key, kv.Key, kv.Value)
+		}
+	}
+	if _, err := reader.Next(); err != io.ErrUnexpectedEOF {
+		t.Errorf("Expected io.ErrUnexpectedEOF for the torn record, got %v", err)
+	}
+
+	// a complete file ends with io.EOF
+	if err := os.Truncate(walFile, 0); err != nil {
+		t.Fatalf("Failed to truncate WAL file: %v", err)
+	}
+	empty, err := NewWALReader(walFile)
+	if err != nil {
+		t.Fatalf("Failed to create WAL reader: %v", err)
+	}
+	defer empty.Close()
+	if _, err := empty.Next(); err != io.EOF {
+		t.Errorf("Expected io.EOF, got %v", err)
+	}
+}
+
 // TestWALReader_RestoreToMemtable_EmptyFile tests restoring from empty file
 func TestWALReader_RestoreToMemtable_EmptyFile(t *testing.T) {
 	// Create temporary directory and empty file
@@ -263,3 +327,60 @@ func TestWALReader_Close(t *testing.T) {
 	_ = reader.RestoreToMemtable(memTable)
 	// We don't check for specific error as behavior after close is not defined
 }
+
+// TestWALReader_Versions tests that versioned records restore their seqs
+func TestWALReader_Versions(t *testing.T) {
+	walFile := filepath.Join(t.TempDir(), "versions.wal")
+	writer, err := NewVersionedWALWriter(walFile)
+	if err != nil {
+		t.Fatalf("Failed to create writer: %v", err)
+	}
+	if err := writer.WriteVersion([]byte("a"), []byte("1"), 7); err != nil {
+		t.Fatalf("Failed to write: %v", err)
+	}
+	writer.Close()
+
+	// reopening appends after the header
+	writer, err = NewVersionedWALWriter(walFile)
+	if err != nil {
+		t.Fatalf("Failed to reopen writer: %v", err)
+	}
+	if err := writer.WriteVersion([]byte("b"), nil, 9); err != nil {
+		t.Fatalf("Failed to write: %v", err)
+	}
+	writer.Close()
+
+	reader, err := NewWALReader(walFile)
+	if err != nil {
+		t.Fatalf("Failed to create reader: %v", err)
+	}
+	defer reader.Close()
+	memTable := memtable.NewSkipList()
+	if err := reader.RestoreToMemtable(memTable); err != nil {
+		t.Fatalf("Failed to restore: %v", err)
+	}
+	if !reader.Versioned() || reader.MaxSeq() != 9 {
+		t.Errorf("Expected a versioned WAL up to seq 9, got %v and %d", reader.Versioned(), reader.MaxSeq())
+	}
+	if value, ok := memTable.GetAt([]byte("a"), 7); !ok || string(value) != "1" {
+		t.Errorf("Expected a at seq 7, got %q", value)
+	}
+	if _, ok := memTable.GetAt([]byte("a"), 6); ok {
+		t.Error("Expected no version of a before seq 7")
+	}
+
+	var seqs []uint64
+	for {
+		kv, err := reader.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			t.Fatalf("Failed to read: %v", err)
+		}
+		seqs = append(seqs, kv.Seq)
+	}
+	if !reflect.DeepEqual(seqs, []uint64{7, 9}) {
+		t.Errorf("Expected seqs [7 9], got %v", seqs)
+	}
+}
@@ -6,6 +6,10 @@ import (
 	"path/filepath"
 )
 
+// versionHeader is the value of the first record of WALs whose records carry
+// the seq they were written at, its key is empty, which no stored key is
+var versionHeader = []byte("oasis-wal-versions")
+
 type WALWriter struct {
 	file      string
 	dest      *os.File
@@ -19,7 +23,7 @@ func NewWALWriter(file string) (*WALWriter, error) {
 		return nil, err
 	}
 
-	dest, err := os.OpenFile(file, os.O_CREATE|os.O_WRONLY, 0644)
+	dest, err := os.OpenFile(file, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0644)
 	if err != nil {
 		return nil, err
 	}
@@ -30,6 +34,34 @@ func NewWALWriter(file string) (*WALWriter, error) {
 	}, nil
 }
 
+// NewVersionedWALWriter opens a WAL for WriteVersion, a new file starts with
+// the version header
+func NewVersionedWALWriter(file string) (*WALWriter, error) {
+	w, err := NewWALWriter(file)
+	if err != nil {
+		return nil, err
+	}
+	stat, err := w.dest.Stat()
+	if err != nil {
+		w.Close()
+		return nil, err
+	}
+	if stat.Size() == 0 {
+		if err := w.Write(nil, versionHeader); err != nil {
+			w.Close()
+			return nil, err
+		}
+	}
+	return w, nil
+}
+
+// WriteVersion writes the version of key written at seq, the seq precedes
+// the value
+func (w *WALWriter) WriteVersion(key, value []byte, seq uint64) error {
+	record := binary.AppendUvarint(make([]byte, 0, binary.MaxVarintLen64+len(value)), seq)
+	return w.Write(key, append(record, value...))
+}
+
 func (w *WALWriter) Write(key, value []byte) error {
 	n := binary.PutUvarint(w.assistBuf[0:], uint64(len(key)))
 	n += binary.PutUvarint(w.assistBuf[n:], uint64(len(value)))
@@ -42,6 +74,18 @@ func (w *WALWriter) Write(key, value []byte) error {
 	return err
 }
 
+// Preallocate reserves disk space for size bytes of records, so appends up
+// to it don't allocate blocks and an fsync has less metadata to write. The
+// file size is unchanged
+func (w *WALWriter) Preallocate(size int64) error {
+	return preallocate(w.dest, size)
+}
+
+// Sync flushes written records to stable storage
+func (w *WALWriter) Sync() error {
+	return w.dest.Sync()
+}
+
 func (w *WALWriter) Close() {
 	_ = w.dest.Close()
 }
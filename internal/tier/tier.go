@@ -0,0 +1,244 @@
+package tier
+
+import (
+	"container/list"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"net/url"
+	"os"
+	"path"
+	"sync"
+
+	"oasisdb/pkg/logger"
+)
+
+// Options configures a Tier
+type Options struct {
+	Endpoint  string // e.g. "https://s3.us-east-1.amazonaws.com" or "http://localhost:9000"
+	Bucket    string
+	Prefix    string // prepended to every key
+	Region    string
+	AccessKey string
+	SecretKey string
+
+	CacheDir   string // local copies of the objects read, emptied when the tier is created
+	CacheBytes int64  // the least recently read copies are removed above this size
+}
+
+// Tier keeps cold files in an S3 compatible bucket. Objects are read from
+// local copies fetched on demand, the least recently read are removed from
+// the cache directory once it grows over its budget
+type Tier struct {
+	bucket *Bucket
+	prefix string
+
+	cacheDir   string
+	cacheBytes int64
+	mu         sync.Mutex
+	cached     map[string]*list.Element // key -> *cacheEntry in lru
+	lru        *list.List               // most recently read first
+	size       int64                    // bytes of the cached copies
+	fetching   map[string]*fetch        // key -> download in progress
+}
+
+type cacheEntry struct {
+	key  string
+	file string
+	size int64
+}
+
+// fetch is a download other readers of the same key wait for
+type fetch struct {
+	done chan struct{}
+	err  error
+}
+
+// New returns a tier storing objects in the bucket of opts
+func New(opts Options) (*Tier, error) {
+	bucket, err := NewBucket(opts.Endpoint, opts.Bucket, opts.Region, opts.AccessKey, opts.SecretKey)
+	if err != nil {
+		return nil, err
+	}
+	// the copies of a previous run may be stale
+	if err := os.RemoveAll(opts.CacheDir); err != nil {
+		return nil, err
+	}
+	if err := os.MkdirAll(opts.CacheDir, 0755); err != nil {
+		return nil, err
+	}
+	return &Tier{
+		bucket:     bucket,
+		prefix:     opts.Prefix,
+		cacheDir:   opts.CacheDir,
+		cacheBytes: opts.CacheBytes,
+		cached:     make(map[string]*list.Element),
+		lru:        list.New(),
+		fetching:   make(map[string]*fetch),
+	}, nil
+}
+
+// Upload copies a local file to key
+func (t *Tier) Upload(key, file string) error {
+	f, err := os.Open(file)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	info, err := f.Stat()
+	if err != nil {
+		return err
+	}
+	return t.bucket.Put(t.prefix+key, f, info.Size())
+}
+
+// Download copies key to a local file, replacing it once complete
+func (t *Tier) Download(key, file string) error {
+	body, err := t.bucket.Get(t.prefix + key)
+	if err != nil {
+		return err
+	}
+	defer body.Close()
+
+	tmp := file + ".download"
+	f, err := os.Create(tmp)
+	if err != nil {
+		return err
+	}
+	if _, err := io.Copy(f, body); err != nil {
+		f.Close()
+		os.Remove(tmp)
+		return err
+	}
+	if err := f.Close(); err != nil {
+		os.Remove(tmp)
+		return err
+	}
+	return os.Rename(tmp, file)
+}
+
+// Delete removes key from the bucket and its cached copy
+func (t *Tier) Delete(key string) error {
+	t.mu.Lock()
+	if elem, ok := t.cached[key]; ok {
+		t.evict(elem)
+	}
+	t.mu.Unlock()
+	return t.bucket.Delete(t.prefix + key)
+}
+
+// Open returns a reader of key, size bytes long, which ends with tail. Reads
+// of the tail are served from memory, others from the cached copy
+func (t *Tier) Open(key string, size int64, tail []byte) *Object {
+	return &Object{tier: t, key: key, size: size, tail: tail}
+}
+
+// CachedBytes returns the size of the local copies
+func (t *Tier) CachedBytes() int64 {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	return t.size
+}
+
+// cachedFile returns the local copy of key, downloading it if needed
+func (t *Tier) cachedFile(key string) (string, error) {
+	t.mu.Lock()
+	if elem, ok := t.cached[key]; ok {
+		t.lru.MoveToFront(elem)
+		t.mu.Unlock()
+		return elem.Value.(*cacheEntry).file, nil
+	}
+	if f, ok := t.fetching[key]; ok {
+		t.mu.Unlock()
+		<-f.done
+		if f.err != nil {
+			return "", f.err
+		}
+		return t.cachedFile(key)
+	}
+	f := &fetch{done: make(chan struct{})}
+	t.fetching[key] = f
+	t.mu.Unlock()
+
+	file := path.Join(t.cacheDir, url.PathEscape(key))
+	f.err = t.Download(key, file)
+	var info fs.FileInfo
+	if f.err == nil {
+		info, f.err = os.Stat(file)
+	}
+
+	t.mu.Lock()
+	delete(t.fetching, key)
+	if f.err == nil {
+		t.cached[key] = t.lru.PushFront(&cacheEntry{key: key, file: file, size: info.Size()})
+		t.size += info.Size()
+		// the copy just fetched is kept even over the budget
+		for t.size > t.cacheBytes && t.lru.Len() > 1 {
+			t.evict(t.lru.Back())
+		}
+	}
+	t.mu.Unlock()
+	close(f.done)
+	if f.err != nil {
+		return "", fmt.Errorf("failed to fetch %s: %w", key, f.err)
+	}
+	logger.Debug("Fetched cold file", "key", key, "bytes", info.Size())
+	return file, nil
+}
+
+// evict removes a cached copy, readers that opened it keep reading it
+func (t *Tier) evict(elem *list.Element) {
+	entry := t.lru.Remove(elem).(*cacheEntry)
+	delete(t.cached, entry.key)
+	t.size -= entry.size
+	if err := os.Remove(entry.file); err != nil && !os.IsNotExist(err) {
+		logger.Warn("Failed to remove cached file", "file", entry.file, "error", err)
+	}
+}
+
+// Object is a file of the bucket
+type Object struct {
+	tier *Tier
+	key  string
+	size int64
+	tail []byte
+}
+
+// ReadAt reads len(p) bytes at off, a read outside the tail fetches the
+// object into the cache unless it is there
+func (o *Object) ReadAt(p []byte, off int64) (int, error) {
+	if start := o.size - int64(len(o.tail)); off >= start && off < o.size {
+		n := copy(p, o.tail[off-start:])
+		if n < len(p) {
+			return n, io.EOF
+		}
+		return n, nil
+	}
+	for attempt := 0; ; attempt++ {
+		file, err := o.tier.cachedFile(o.key)
+		if err != nil {
+			return 0, err
+		}
+		f, err := os.Open(file)
+		if errors.Is(err, fs.ErrNotExist) && attempt == 0 {
+			// evicted meanwhile
+			continue
+		}
+		if err != nil {
+			return 0, err
+		}
+		defer f.Close()
+		return f.ReadAt(p, off)
+	}
+}
+
+// Size returns the size of the object
+func (o *Object) Size() int64 {
+	return o.size
+}
+
+// Close releases nothing, the cached copy stays until it is evicted
+func (o *Object) Close() error {
+	return nil
+}
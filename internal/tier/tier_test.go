@@ -0,0 +1,90 @@
+package tier_test
+
+import (
+	"errors"
+	"io"
+	"os"
+	"path"
+	"testing"
+
+	"oasisdb/internal/tier"
+	"oasisdb/internal/tier/tiertest"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestTierUploadDownloadDelete(t *testing.T) {
+	dir := t.TempDir()
+	coldTier, server := tiertest.NewTier(t, path.Join(dir, "cache"), 1024)
+
+	file := path.Join(dir, "table")
+	require.NoError(t, os.WriteFile(file, []byte("cold data"), 0644))
+	require.NoError(t, coldTier.Upload("sst/table", file))
+	assert.Equal(t, []string{"sst/table"}, server.Keys())
+
+	fetched := path.Join(dir, "fetched")
+	require.NoError(t, coldTier.Download("sst/table", fetched))
+	data, err := os.ReadFile(fetched)
+	require.NoError(t, err)
+	assert.Equal(t, "cold data", string(data))
+
+	require.NoError(t, coldTier.Delete("sst/table"))
+	assert.Empty(t, server.Keys())
+	assert.True(t, errors.Is(coldTier.Download("sst/table", fetched), tier.ErrNotFound))
+	// deleting a missing object succeeds
+	require.NoError(t, coldTier.Delete("sst/table"))
+}
+
+func TestObjectReadsTailWithoutFetching(t *testing.T) {
+	dir := t.TempDir()
+	coldTier, server := tiertest.NewTier(t, path.Join(dir, "cache"), 1024)
+	file := path.Join(dir, "table")
+	require.NoError(t, os.WriteFile(file, []byte("0123456789"), 0644))
+	require.NoError(t, coldTier.Upload("sst/table", file))
+
+	object := coldTier.Open("sst/table", 10, []byte("789"))
+	buf := make([]byte, 3)
+	n, err := object.ReadAt(buf, 7)
+	require.NoError(t, err)
+	assert.Equal(t, "789", string(buf[:n]))
+	assert.Equal(t, 0, server.Gets())
+
+	n, err = object.ReadAt(buf, 2)
+	require.NoError(t, err)
+	assert.Equal(t, "234", string(buf[:n]))
+	n, err = object.ReadAt(buf, 5)
+	require.NoError(t, err)
+	assert.Equal(t, "567", string(buf[:n]))
+	assert.Equal(t, 1, server.Gets(), "reads after the first are served by the cache")
+	assert.Equal(t, int64(10), coldTier.CachedBytes())
+
+	_, err = object.ReadAt(buf, 9)
+	assert.ErrorIs(t, err, io.EOF)
+}
+
+func TestCacheEvictsLeastRecentlyRead(t *testing.T) {
+	dir := t.TempDir()
+	coldTier, server := tiertest.NewTier(t, path.Join(dir, "cache"), 15)
+	for _, name := range []string{"a", "b"} {
+		file := path.Join(dir, name)
+		require.NoError(t, os.WriteFile(file, []byte("0123456789"), 0644))
+		require.NoError(t, coldTier.Upload(name, file))
+	}
+
+	buf := make([]byte, 1)
+	a := coldTier.Open("a", 10, nil)
+	b := coldTier.Open("b", 10, nil)
+	_, err := a.ReadAt(buf, 0)
+	require.NoError(t, err)
+	_, err = b.ReadAt(buf, 0)
+	require.NoError(t, err)
+	assert.Equal(t, int64(10), coldTier.CachedBytes(), "a is evicted to fit b")
+
+	_, err = b.ReadAt(buf, 1)
+	require.NoError(t, err)
+	assert.Equal(t, 2, server.Gets())
+	_, err = a.ReadAt(buf, 1)
+	require.NoError(t, err)
+	assert.Equal(t, 3, server.Gets(), "a is fetched again")
+}
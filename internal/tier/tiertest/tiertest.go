@@ -0,0 +1,109 @@
+// Package tiertest provides an in-memory S3 compatible server for the tests
+// of the cold tier
+package tiertest
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"sort"
+	"strings"
+	"sync"
+	"testing"
+
+	"oasisdb/internal/tier"
+)
+
+// Bucket is the name of the bucket of a Server
+const Bucket = "oasisdb-test"
+
+// Server stores the objects of signed PUT requests in memory
+type Server struct {
+	*httptest.Server
+	mu      sync.Mutex
+	objects map[string][]byte // key -> content
+	gets    int
+}
+
+// NewServer starts a server closed with the test
+func NewServer(t testing.TB) *Server {
+	s := &Server{objects: make(map[string][]byte)}
+	s.Server = httptest.NewServer(http.HandlerFunc(s.serve))
+	t.Cleanup(s.Close)
+	return s
+}
+
+// NewTier returns a tier storing its objects in a new server, its cache in
+// cacheDir
+func NewTier(t testing.TB, cacheDir string, cacheBytes int64) (*tier.Tier, *Server) {
+	s := NewServer(t)
+	coldTier, err := tier.New(tier.Options{
+		Endpoint:   s.URL,
+		Bucket:     Bucket,
+		Region:     "us-east-1",
+		AccessKey:  "test",
+		SecretKey:  "secret",
+		CacheDir:   cacheDir,
+		CacheBytes: cacheBytes,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return coldTier, s
+}
+
+// Keys returns the keys of the stored objects in order
+func (s *Server) Keys() []string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	keys := make([]string, 0, len(s.objects))
+	for key := range s.objects {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// Gets returns the number of objects downloaded
+func (s *Server) Gets() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.gets
+}
+
+func (s *Server) serve(w http.ResponseWriter, r *http.Request) {
+	if !strings.HasPrefix(r.Header.Get("Authorization"), "AWS4-HMAC-SHA256 Credential=test/") {
+		http.Error(w, "AccessDenied", http.StatusForbidden)
+		return
+	}
+	key, ok := strings.CutPrefix(r.URL.Path, "/"+Bucket+"/")
+	if !ok {
+		http.Error(w, "NoSuchBucket", http.StatusNotFound)
+		return
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	switch r.Method {
+	case http.MethodPut:
+		data, err := io.ReadAll(r.Body)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		s.objects[key] = data
+	case http.MethodGet:
+		data, ok := s.objects[key]
+		if !ok {
+			http.Error(w, "NoSuchKey", http.StatusNotFound)
+			return
+		}
+		s.gets++
+		w.Write(data)
+	case http.MethodDelete:
+		delete(s.objects, key)
+		w.WriteHeader(http.StatusNoContent)
+	default:
+		w.WriteHeader(http.StatusMethodNotAllowed)
+	}
+}
@@ -11,6 +11,7 @@ var (
 	ErrDocumentNotFound = errors.New("document not found")
 	ErrDocumentExists   = errors.New("document already exists")
 	ErrNoResultsFound   = errors.New("no satisfied results found")
+	ErrOutOfScope       = errors.New("document is outside the scope of the API key")
 
 	// Index errors
 	ErrIndexNotFound        = errors.New("index not found")
@@ -19,8 +20,12 @@ var (
 	ErrFailedToLoadIndex    = errors.New("failed to load index")
 	ErrUnsupportedIndexType = errors.New("unsupported index type")
 
+	// Embedding errors
+	ErrEmbeddingNotConfigured = errors.New("embedding provider is not configured")
+
 	// Storage errors
 	ErrMisMatchKeysAndValues = errors.New("keys and values length mismatch")
+	ErrWriteStall            = errors.New("writes are stalled until compaction catches up")
 
 	// Parameter errors
 	ErrInvalidParameter = errors.New("invalid parameter")
@@ -18,7 +18,9 @@ func TestExportedErrorsHaveStableMessages(t *testing.T) {
 		{"ErrFailedToCreateIndex", ErrFailedToCreateIndex, "failed to create index"},
 		{"ErrFailedToLoadIndex", ErrFailedToLoadIndex, "failed to load index"},
 		{"ErrUnsupportedIndexType", ErrUnsupportedIndexType, "unsupported index type"},
+		{"ErrEmbeddingNotConfigured", ErrEmbeddingNotConfigured, "embedding provider is not configured"},
 		{"ErrMisMatchKeysAndValues", ErrMisMatchKeysAndValues, "keys and values length mismatch"},
+		{"ErrWriteStall", ErrWriteStall, "writes are stalled until compaction catches up"},
 		{"ErrInvalidParameter", ErrInvalidParameter, "invalid parameter"},
 		{"ErrEmptyParameter", ErrEmptyParameter, "empty parameter"},
 	}
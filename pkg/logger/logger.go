@@ -1,6 +1,8 @@
 package logger
 
 import (
+	"context"
+	"fmt"
 	"os"
 	"strings"
 
@@ -18,31 +20,66 @@ const (
 
 var defaultLogger *zap.Logger
 
+// slowLogger receives slow queries, nil means the default logger
+var slowLogger *zap.Logger
+
 func init() {
 	// Initialize with default production config
 	// In main function, we will override the logger with the config file
 	InitLogger(InfoLevel, "")
 }
 
+// level of the default logger, SetLevel changes it while logging
+var level = zap.NewAtomicLevel()
+
 // InitLogger initializes the logger with specified level and file path
-func InitLogger(level, filePath string) {
-	// Parse log level
-	var zapLevel zapcore.Level
-	switch strings.ToLower(level) {
+func InitLogger(lvl, filePath string) {
+	level.SetLevel(parseLevel(lvl))
+	core := newCore(level, filePath)
+
+	// Build logger
+	defaultLogger = zap.New(core, zap.AddCaller())
+}
+
+// SetLevel changes the level of the default logger, unknown levels are an
+// error
+func SetLevel(lvl string) error {
+	switch strings.ToLower(lvl) {
+	case DebugLevel, InfoLevel, WarnLevel, ErrorLevel, FatalLevel:
+	default:
+		return fmt.Errorf("unknown log level %q", lvl)
+	}
+	level.SetLevel(parseLevel(lvl))
+	return nil
+}
+
+// parseLevel returns the zap level of a level name, info if unknown
+func parseLevel(lvl string) zapcore.Level {
+	switch strings.ToLower(lvl) {
 	case DebugLevel:
-		zapLevel = zapcore.DebugLevel
-	case InfoLevel:
-		zapLevel = zapcore.InfoLevel
+		return zapcore.DebugLevel
 	case WarnLevel:
-		zapLevel = zapcore.WarnLevel
+		return zapcore.WarnLevel
 	case ErrorLevel:
-		zapLevel = zapcore.ErrorLevel
+		return zapcore.ErrorLevel
 	case FatalLevel:
-		zapLevel = zapcore.FatalLevel
+		return zapcore.FatalLevel
 	default:
-		zapLevel = zapcore.InfoLevel
+		return zapcore.InfoLevel
+	}
+}
+
+// InitSlowLogger writes slow queries to their own file, an empty path keeps
+// them in the default log
+func InitSlowLogger(filePath string) {
+	if filePath == "" {
+		slowLogger = nil
+		return
 	}
+	slowLogger = zap.New(newCore(zapcore.InfoLevel, filePath))
+}
 
+func newCore(zapLevel zapcore.LevelEnabler, filePath string) zapcore.Core {
 	// Configure encoder
 	encoderConfig := zap.NewProductionEncoderConfig()
 	encoderConfig.EncodeTime = zapcore.ISO8601TimeEncoder
@@ -50,30 +87,24 @@ func InitLogger(level, filePath string) {
 	encoderConfig.EncodeCaller = zapcore.ShortCallerEncoder
 
 	// Configure output
-	var core zapcore.Core
 	if filePath != "" {
 		// Write to file
 		file, err := os.OpenFile(filePath, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0666)
 		if err != nil {
 			panic(err)
 		}
-		fileWriter := zapcore.AddSync(file)
-		core = zapcore.NewCore(
+		return zapcore.NewCore(
 			zapcore.NewJSONEncoder(encoderConfig),
-			fileWriter,
-			zapLevel,
-		)
-	} else {
-		// Write to stdout
-		core = zapcore.NewCore(
-			zapcore.NewConsoleEncoder(encoderConfig),
-			zapcore.AddSync(os.Stdout),
+			zapcore.AddSync(file),
 			zapLevel,
 		)
 	}
-
-	// Build logger
-	defaultLogger = zap.New(core, zap.AddCaller())
+	// Write to stdout
+	return zapcore.NewCore(
+		zapcore.NewConsoleEncoder(encoderConfig),
+		zapcore.AddSync(os.Stdout),
+		zapLevel,
+	)
 }
 
 // Debug logs a debug message with fields
@@ -105,3 +136,37 @@ func Fatal(msg string, fields ...interface{}) {
 func With(fields ...interface{}) *zap.SugaredLogger {
 	return defaultLogger.Sugar().With(fields...)
 }
+
+type requestIDKey struct{}
+
+// WithRequestID returns a context carrying the ID of the request it serves
+func WithRequestID(ctx context.Context, id string) context.Context {
+	return context.WithValue(ctx, requestIDKey{}, id)
+}
+
+// RequestID returns the request ID of ctx, empty if there is none
+func RequestID(ctx context.Context) string {
+	id, _ := ctx.Value(requestIDKey{}).(string)
+	return id
+}
+
+// Ctx returns a logger that adds the request ID of ctx to every line
+func Ctx(ctx context.Context) *zap.SugaredLogger {
+	if id := RequestID(ctx); id != "" {
+		return defaultLogger.Sugar().With("request_id", id)
+	}
+	return defaultLogger.Sugar()
+}
+
+// Slow logs a slow query to the slow query log, tagged with the request ID
+// of ctx
+func Slow(ctx context.Context, msg string, fields ...interface{}) {
+	l := defaultLogger
+	if slowLogger != nil {
+		l = slowLogger
+	}
+	if id := RequestID(ctx); id != "" {
+		fields = append(fields, "request_id", id)
+	}
+	l.Sugar().Warnw(msg, fields...)
+}
@@ -1,6 +1,7 @@
 package logger
 
 import (
+	"context"
 	"testing"
 
 	"go.uber.org/zap"
@@ -418,3 +419,60 @@ func TestNoFields(t *testing.T) {
 		t.Errorf("Expected 0 context fields, got %d", len(entry.Context))
 	}
 }
+
+// TestRequestIDLogging tests that Ctx and Slow tag lines with the request ID
+func TestRequestIDLogging(t *testing.T) {
+	originalLogger, originalSlow := defaultLogger, slowLogger
+	defer func() { defaultLogger, slowLogger = originalLogger, originalSlow }()
+
+	core, recorded := observer.New(zapcore.InfoLevel)
+	defaultLogger = zap.New(core)
+	slowCore, slowRecorded := observer.New(zapcore.InfoLevel)
+	slowLogger = zap.New(slowCore)
+
+	ctx := WithRequestID(context.Background(), "abc")
+	if got := RequestID(ctx); got != "abc" {
+		t.Fatalf("Expected request ID 'abc', got '%s'", got)
+	}
+
+	Ctx(ctx).Infow("with id")
+	Ctx(context.Background()).Infow("without id")
+	Slow(ctx, "slow", "k", 10)
+
+	logs := recorded.All()
+	if len(logs) != 2 {
+		t.Fatalf("Expected 2 log entries, got %d", len(logs))
+	}
+	if fields := logs[0].ContextMap(); fields["request_id"] != "abc" {
+		t.Errorf("Expected request_id 'abc', got %v", fields)
+	}
+	if len(logs[1].Context) != 0 {
+		t.Errorf("Expected no context fields, got %v", logs[1].Context)
+	}
+
+	slow := slowRecorded.All()
+	if len(slow) != 1 || slow[0].Level != zapcore.WarnLevel {
+		t.Fatalf("Expected 1 warning in the slow log, got %v", slow)
+	}
+	if fields := slow[0].ContextMap(); fields["request_id"] != "abc" || fields["k"] != int64(10) {
+		t.Errorf("Unexpected slow log fields %v", fields)
+	}
+}
+
+// TestSetLevel tests changing the level of the default logger
+func TestSetLevel(t *testing.T) {
+	defer InitLogger(InfoLevel, "")
+	InitLogger(InfoLevel, "")
+	if defaultLogger.Core().Enabled(zapcore.DebugLevel) {
+		t.Fatal("Expected debug to be disabled at info level")
+	}
+	if err := SetLevel("DEBUG"); err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	if !defaultLogger.Core().Enabled(zapcore.DebugLevel) {
+		t.Error("Expected debug to be enabled after SetLevel")
+	}
+	if err := SetLevel("verbose"); err == nil {
+		t.Error("Expected an error for an unknown level")
+	}
+}
@@ -0,0 +1,64 @@
+// Package processor lets applications embedding OasisDB enrich or sanitize
+// documents on their way into and out of the database
+package processor
+
+import "sync"
+
+// Document is a document as written to and read from a collection
+type Document struct {
+	ID         string         `json:"id"`
+	Vector     []float32      `json:"vector"`
+	Parameters map[string]any `json:"parameters"`
+	Dimension  int            `json:"dimension"`
+}
+
+// Processor hooks into the write and read paths of every collection
+type Processor interface {
+	// BeforeUpsert runs on each document before automatic embedding and
+	// storage, it may modify the document and an error rejects the write
+	BeforeUpsert(collectionName string, doc *Document) error
+	// AfterFetch runs on each document returned by a get, search, scroll or
+	// export after filtering, it may modify the document and an error fails
+	// the read
+	AfterFetch(collectionName string, doc *Document) error
+}
+
+// Funcs adapts plain functions to Processor, nil hooks are skipped
+type Funcs struct {
+	Upsert func(collectionName string, doc *Document) error
+	Fetch  func(collectionName string, doc *Document) error
+}
+
+func (p Funcs) BeforeUpsert(collectionName string, doc *Document) error {
+	if p.Upsert == nil {
+		return nil
+	}
+	return p.Upsert(collectionName, doc)
+}
+
+func (p Funcs) AfterFetch(collectionName string, doc *Document) error {
+	if p.Fetch == nil {
+		return nil
+	}
+	return p.Fetch(collectionName, doc)
+}
+
+var (
+	registryMu sync.RWMutex
+	registry   []Processor
+)
+
+// Register adds a processor run by every database, before the processors a
+// database registered itself. Processors run in registration order
+func Register(p Processor) {
+	registryMu.Lock()
+	defer registryMu.Unlock()
+	registry = append(registry, p)
+}
+
+// Registered returns the processors added by Register
+func Registered() []Processor {
+	registryMu.RLock()
+	defer registryMu.RUnlock()
+	return registry[:len(registry):len(registry)]
+}
@@ -0,0 +1,32 @@
+package processor
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestFuncs(t *testing.T) {
+	var p Processor = Funcs{
+		Fetch: func(collectionName string, doc *Document) error {
+			doc.Parameters["collection"] = collectionName
+			return nil
+		},
+	}
+	doc := &Document{ID: "1", Parameters: map[string]any{}}
+	assert.NoError(t, p.BeforeUpsert("docs", doc))
+	assert.Empty(t, doc.Parameters)
+	assert.NoError(t, p.AfterFetch("docs", doc))
+	assert.Equal(t, "docs", doc.Parameters["collection"])
+}
+
+func TestRegister(t *testing.T) {
+	before := len(Registered())
+	Register(Funcs{})
+	registered := Registered()
+	assert.Len(t, registered, before+1)
+
+	// appending to the returned processors leaves the registry alone
+	_ = append(registered, Funcs{})
+	assert.Len(t, Registered(), before+1)
+}
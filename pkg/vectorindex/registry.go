@@ -0,0 +1,65 @@
+package vectorindex
+
+import (
+	"fmt"
+	"slices"
+	"sync"
+
+	"oasisdb/pkg/errors"
+)
+
+// Factory creates an empty index from its config
+type Factory func(config *IndexConfig) (VectorIndex, error)
+
+var (
+	factoriesMu sync.RWMutex
+	// factories holds the factory of every index type collections can be
+	// created, loaded and replayed with, the built-in types included
+	factories = map[IndexType]Factory{}
+)
+
+// Register adds an index type so collections can be created with it, e.g.
+//
+//	vectorindex.Register("myindex", func(cfg *vectorindex.IndexConfig) (vectorindex.VectorIndex, error) { ... })
+//
+// The type is then available to CreateIndex and to loading checkpoints and
+// replaying the WAL, so it must be registered before the database is opened,
+// typically from an init function. Registering a type twice is an error
+func Register(indexType IndexType, factory Factory) error {
+	if indexType == "" || factory == nil {
+		return fmt.Errorf("%w: index type and factory are required", errors.ErrInvalidParameter)
+	}
+	factoriesMu.Lock()
+	defer factoriesMu.Unlock()
+	if _, exists := factories[indexType]; exists {
+		return fmt.Errorf("%w: index type %s is already registered", errors.ErrInvalidParameter, indexType)
+	}
+	factories[indexType] = factory
+	return nil
+}
+
+// Lookup returns the factory of a registered index type
+func Lookup(indexType IndexType) (Factory, bool) {
+	factoriesMu.RLock()
+	defer factoriesMu.RUnlock()
+	factory, ok := factories[indexType]
+	return factory, ok
+}
+
+// IsRegistered reports whether indices of the type can be created
+func IsRegistered(indexType IndexType) bool {
+	_, ok := Lookup(indexType)
+	return ok
+}
+
+// RegisteredTypes returns the registered index types in sorted order
+func RegisteredTypes() []IndexType {
+	factoriesMu.RLock()
+	defer factoriesMu.RUnlock()
+	types := make([]IndexType, 0, len(factories))
+	for indexType := range factories {
+		types = append(types, indexType)
+	}
+	slices.Sort(types)
+	return types
+}
@@ -0,0 +1,26 @@
+package vectorindex
+
+import (
+	"testing"
+
+	"oasisdb/pkg/errors"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRegister(t *testing.T) {
+	const custom IndexType = "test_registry"
+	factory := func(config *IndexConfig) (VectorIndex, error) { return nil, nil }
+
+	assert.False(t, IsRegistered(custom))
+	assert.NoError(t, Register(custom, factory))
+	assert.ErrorIs(t, Register(custom, factory), errors.ErrInvalidParameter)
+	assert.ErrorIs(t, Register("", factory), errors.ErrInvalidParameter)
+	assert.ErrorIs(t, Register("test_nil", nil), errors.ErrInvalidParameter)
+
+	assert.True(t, IsRegistered(custom))
+	assert.False(t, IsRegistered("missing"))
+	assert.Contains(t, RegisteredTypes(), custom)
+	_, ok := Lookup(custom)
+	assert.True(t, ok)
+}
@@ -0,0 +1,83 @@
+// Package vectorindex defines the vector index interface of OasisDB and the
+// registry of the index types collections can be created with, so that
+// applications can plug in index types of their own
+package vectorindex
+
+// SpaceType represents the distance metric type
+type SpaceType string
+type IndexType string
+
+const (
+	L2Space      SpaceType = "l2"
+	IPSpace      SpaceType = "ip"
+	CosSpace     SpaceType = "cos"
+	HammingSpace SpaceType = "hamming"
+)
+
+// IndexConfig represents index configuration
+type IndexConfig struct {
+	SpaceType  SpaceType              // distance metric type
+	IndexType  IndexType              // index type (e.g., "hnsw", "ivf")
+	Dimension  int                    // vector dimension
+	Parameters map[string]interface{} // index-specific parameters
+}
+
+// SearchResult represents a search result
+type SearchResult struct {
+	IDs       []string  // document IDs
+	Distances []float32 // distances to query vector
+}
+
+// IndexStats describes the contents and settings of an index
+type IndexStats struct {
+	Type      IndexType      `json:"type"`
+	Dimension int            `json:"dimension"`
+	Count     int            `json:"count"`   // vectors that can be found
+	Deleted   int            `json:"deleted"` // deleted elements still held until the index is vacuumed
+	Params    map[string]any `json:"params"`  // index specific settings and state
+
+	MemoryBytes int64 `json:"memoryBytes"` // estimated by the manager, 0 if the index can't estimate it
+}
+
+// VectorIndex represents a vector index
+type VectorIndex interface {
+	// Add adds a vector to the index
+	Add(id string, vector []float32) error
+
+	// AddBatch adds multiple vectors to the index
+	AddBatch(ids []string, vectors [][]float32) error
+
+	// Build builds the index
+	Build(ids []string, vectors [][]float32) error
+
+	// Delete removes a vector from the index
+	Delete(id string) error
+
+	// Search performs a k-NN search
+	Search(vector []float32, k int) (*SearchResult, error)
+
+	// GetVector gets a vector by ID
+	GetVector(id string) ([]float32, error)
+
+	// Count returns the number of vectors in the index
+	Count() int
+
+	// Stats describes the index
+	Stats() IndexStats
+
+	// Iterate calls fn with the ID and vector of every vector in the index
+	// until fn returns false, the index must not be modified meanwhile
+	Iterate(fn func(id string, vector []float32) bool) error
+
+	// SetParams sets index parameters
+	SetParams(params map[string]any) error
+
+	// Load loads the index from disk
+	Load(filePath string) error
+
+	// Save saves the index to disk
+	Save(filePath string) error
+
+	// Close closes the index and releases resources
+	Close() error
+}